@@ -0,0 +1,111 @@
+package cetest
+
+import (
+	"fmt"
+	"math"
+	"sync"
+	"sync/atomic"
+
+	"github.com/pingcap/errors"
+)
+
+// AdaptiveOpt adapts the generation of cases of each cell to results seen so far. Cases of cells are visited in
+// random orders in this mode, so stopped cells are still unbiased samples.
+//
+// With Precision, a cell stops once the confidence interval of its mean absolute PError converges, so easy cells
+// finish early and noisy ones spend the whole n-samples. With Importance, a fraction of cases of a cell is spent on
+// a biased pass after the uniform one, which draws cases from regions of adjacent values in proportion to their
+// errors in the uniform pass, to characterize failure regions precisely within the same number of cases.
+type AdaptiveOpt struct {
+	Precision  float64 `toml:"precision"`  // stop once the half width of the interval is within this fraction of the mean, disabled if it's 0
+	Confidence float64 `toml:"confidence"` // two-sided confidence level of the interval, 0.95 if it's 0
+	MinCases   int     `toml:"min-cases"`  // minimum number of cases of each cell before checking, 30 if it's 0
+
+	Importance float64 `toml:"importance"` // fraction of cases of the biased pass in [0, 1), disabled if it's 0
+	Regions    int     `toml:"regions"`    // number of regions of cases of each cell, 10 if it's 0
+}
+
+const (
+	defaultAdaptiveConfidence = 0.95
+	defaultAdaptiveMinCases   = 30
+	defaultAdaptiveRegions    = 10
+)
+
+func (ao *AdaptiveOpt) check() error {
+	if ao.Precision < 0 || ao.Confidence < 0 || ao.Confidence >= 1 || ao.MinCases < 0 {
+		return errors.Errorf("invalid adaptive precision=%v, confidence=%v or min-cases=%v", ao.Precision, ao.Confidence, ao.MinCases)
+	}
+	if ao.Importance < 0 || ao.Importance >= 1 || ao.Regions < 0 {
+		return errors.Errorf("invalid adaptive importance=%v or regions=%v", ao.Importance, ao.Regions)
+	}
+	if ao.Confidence == 0 {
+		ao.Confidence = defaultAdaptiveConfidence
+	}
+	if ao.MinCases == 0 {
+		ao.MinCases = defaultAdaptiveMinCases
+	}
+	if ao.Regions == 0 {
+		ao.Regions = defaultAdaptiveRegions
+	}
+	return nil
+}
+
+func (ao AdaptiveOpt) enabled() bool {
+	return ao.Precision > 0 || ao.Importance > 0
+}
+
+// convergence monitors the running confidence interval of the mean absolute PError of a cell by Welford's algorithm,
+// nil if the adaptive mode is disabled.
+type convergence struct {
+	opt  AdaptiveOpt
+	z    float64 // z-score of the confidence level
+	cell string
+
+	lock      sync.Mutex
+	n         int
+	mean, m2  float64
+	converged int32
+}
+
+func newConvergence(opt AdaptiveOpt, cell string) *convergence {
+	if opt.Precision <= 0 {
+		return nil
+	}
+	return &convergence{opt: opt, z: math.Sqrt2 * math.Erfinv(opt.Confidence), cell: cell}
+}
+
+// observe adds this result into the interval and checks whether it converges, cases of the biased pass of the
+// importance sampling are ignored since they're not uniform.
+func (c *convergence) observe(r EstResult) {
+	if c == nil || r.HasTag(TagImportanceSampled) {
+		return
+	}
+	c.lock.Lock()
+	defer c.lock.Unlock()
+	x := math.Abs(PError(r))
+	c.n++
+	delta := x - c.mean
+	c.mean += delta / float64(c.n)
+	c.m2 += delta * (x - c.mean)
+	if c.n < c.opt.MinCases || atomic.LoadInt32(&c.converged) == 1 {
+		return
+	}
+	half := c.halfWidth()
+	if half <= c.opt.Precision*c.mean {
+		atomic.StoreInt32(&c.converged, 1)
+		fmt.Printf("[Adaptive] cell=%v converges after %v cases, mean-abs-p-error=%.3f, half-width=%.3f\n", c.cell, c.n, c.mean, half)
+	}
+}
+
+// halfWidth returns the half width of the current confidence interval.
+func (c *convergence) halfWidth() float64 {
+	if c.n < 2 {
+		return math.Inf(1)
+	}
+	return c.z * math.Sqrt(c.m2/float64(c.n-1)/float64(c.n))
+}
+
+// stopped returns whether the cell converges and no more case is needed.
+func (c *convergence) stopped() bool {
+	return c != nil && atomic.LoadInt32(&c.converged) == 1
+}
@@ -0,0 +1,92 @@
+package cetest
+
+import (
+	"crypto/sha256"
+	"encoding/binary"
+	"fmt"
+	"strings"
+)
+
+var sqlKeywords = map[string]bool{ // read-only
+	"SELECT": true, "FROM": true, "WHERE": true, "AND": true, "OR": true, "NOT": true, "XOR": true,
+	"IN": true, "IS": true, "NULL": true, "BETWEEN": true, "LIKE": true, "ESCAPE": true, "AS": true,
+	"JOIN": true, "INNER": true, "LEFT": true, "RIGHT": true, "OUTER": true, "CROSS": true, "ON": true, "USING": true,
+	"GROUP": true, "BY": true, "ORDER": true, "ASC": true, "DESC": true, "LIMIT": true, "OFFSET": true, "HAVING": true,
+	"DISTINCT": true, "UNION": true, "ALL": true, "EXISTS": true, "ANY": true, "SOME": true, "WITH": true, "RECURSIVE": true,
+	"CASE": true, "WHEN": true, "THEN": true, "ELSE": true, "END": true, "TRUE": true, "FALSE": true,
+	"COUNT": true, "SUM": true, "AVG": true, "MIN": true, "MAX": true, "EXPLAIN": true, "ANALYZE": true, "FORMAT": true,
+	"INTERVAL": true, "DATE": true, "TIMESTAMP": true, "OVER": true, "PARTITION": true, "USE": true, "FORCE": true,
+	"IGNORE": true, "INDEX": true, "KEY": true, "DIV": true, "MOD": true,
+}
+
+// AnonymizeSQL replaces all literals and identifiers in this SQL with their salted hashes.
+// The same literal or identifier is always replaced with the same hash, so the shape of the SQL is kept
+// and anonymized SQLs from the same run can still be compared with each other.
+func AnonymizeSQL(sql, salt string) string {
+	var buf strings.Builder
+	for i := 0; i < len(sql); {
+		c := sql[i]
+		switch {
+		case c == '\'' || c == '"': // string literal
+			j := i + 1
+			for ; j < len(sql) && sql[j] != c; j++ {
+				if sql[j] == '\\' {
+					j++
+				}
+			}
+			if j > len(sql) {
+				j = len(sql)
+			}
+			buf.WriteString(fmt.Sprintf("'s_%08x'", anonymizeHash(sql[i+1:j], salt)))
+			i = j + 1
+		case c == '`': // quoted identifier
+			j := i + 1
+			for ; j < len(sql) && sql[j] != '`'; j++ {
+			}
+			buf.WriteString(fmt.Sprintf("`id_%08x`", anonymizeHash(strings.ToLower(sql[i+1:min(j, len(sql))]), salt)))
+			i = j + 1
+		case isDigit(c) || (c == '.' && i+1 < len(sql) && isDigit(sql[i+1]) && (i == 0 || !isIdentChar(sql[i-1]))): // number literal
+			j := i
+			for ; j < len(sql) && (isIdentChar(sql[j]) || sql[j] == '.' ||
+				((sql[j] == '+' || sql[j] == '-') && (sql[j-1] == 'e' || sql[j-1] == 'E'))); j++ {
+			}
+			buf.WriteString(fmt.Sprintf("%v", anonymizeHash(sql[i:j], salt)))
+			i = j
+		case isIdentChar(c):
+			j := i
+			for ; j < len(sql) && isIdentChar(sql[j]); j++ {
+			}
+			word := sql[i:j]
+			if sqlKeywords[strings.ToUpper(word)] {
+				buf.WriteString(word)
+			} else {
+				buf.WriteString(fmt.Sprintf("id_%08x", anonymizeHash(strings.ToLower(word), salt)))
+			}
+			i = j
+		default:
+			buf.WriteByte(c)
+			i++
+		}
+	}
+	return buf.String()
+}
+
+func anonymizeHash(val, salt string) uint32 {
+	h := sha256.Sum256([]byte(salt + "\x00" + val))
+	return binary.BigEndian.Uint32(h[:4])
+}
+
+func isDigit(c byte) bool {
+	return c >= '0' && c <= '9'
+}
+
+func isIdentChar(c byte) bool {
+	return c == '_' || c == '$' || isDigit(c) || (c >= 'a' && c <= 'z') || (c >= 'A' && c <= 'Z') || c >= 0x80
+}
+
+func min(a, b int) int {
+	if a < b {
+		return a
+	}
+	return b
+}
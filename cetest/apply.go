@@ -0,0 +1,70 @@
+package cetest
+
+import (
+	"strconv"
+	"strings"
+)
+
+// correlatedEstResult makes this result of a correlated case measure the inner side of its Apply, which is compared
+// with true rows of the correlated subquery for each outer row, or tags it with TagDecorrelated if there is no Apply,
+// and then the estimation of the whole query is kept.
+func correlatedEstResult(r EstResult) EstResult {
+	tags := make([]string, 0, len(r.Tags)+1)
+	for _, t := range r.Tags {
+		if t != TagDecorrelated {
+			tags = append(tags, t)
+		}
+	}
+	if r.ApplyEstRows > 0 {
+		r.EstCard = r.ApplyEstRows
+	} else {
+		tags = append(tags, TagDecorrelated)
+	}
+	r.Tags = tags
+	return r
+}
+
+// applyProbeEstRows returns estimated rows of the inner side of the first Apply in results of EXPLAIN, which is
+// the estimation of rows returned by the correlated subquery for each outer row, and false if there is no Apply.
+// Estimations of inner sides of Apply are made once for all outer rows, since correlated columns are unknown.
+// Operators only limiting or projecting rows on the top of the inner side, like Limit added for EXISTS, are skipped.
+func applyProbeEstRows(header []string, results [][]string) (float64, bool) {
+	idIdx, estIdx := -1, -1
+	for i, h := range header {
+		switch strings.ToLower(strings.Replace(h, " ", "", -1)) {
+		case "id":
+			idIdx = i
+		case "estrows", "count":
+			estIdx = i
+		}
+	}
+	if idIdx == -1 || estIdx == -1 {
+		return 0, false
+	}
+	applyDepth, probeDepth := -1, -1
+	for _, row := range results {
+		id, depth := trimTreePrefix(row[idIdx])
+		switch {
+		case applyDepth == -1:
+			if strings.Contains(id, "Apply") {
+				applyDepth = depth
+			}
+			continue
+		case depth <= applyDepth:
+			return 0, false
+		case probeDepth == -1:
+			if depth != applyDepth+1 || !strings.HasSuffix(id, "(Probe)") {
+				continue
+			}
+		case depth != probeDepth+1:
+			continue
+		}
+		probeDepth = depth
+		if strings.HasPrefix(id, "Limit") || strings.HasPrefix(id, "Projection") {
+			continue
+		}
+		est, err := strconv.ParseFloat(row[estIdx], 64)
+		return est, err == nil
+	}
+	return 0, false
+}
@@ -0,0 +1,113 @@
+package cetest_test
+
+import (
+	"fmt"
+	"strings"
+	"testing"
+
+	"github.com/qw4990/OptimizerTester/cetest"
+	"github.com/qw4990/OptimizerTester/tidb"
+)
+
+var benchExplainHeader = []string{"id", "estRows", "actRows", "task", "access object", "execution info", "operator info", "memory", "disk"}
+
+var benchExplainResults = [][]string{
+	{"IndexLookUp_10", "12.34", "10", "root", "", "time:1.2ms, loops:2, index_task:{total_time:1ms}", "", "10.5 KB", "N/A"},
+	{"├─IndexRangeScan_8(Build)", "12.34", "10", "cop[tikv]", "table:tmock0, index:idx_0(c0)", "tikv_task:{time:0s, loops:1}", "range:[1,1], keep order:false", "N/A", "N/A"},
+	{"└─TableRowIDScan_9(Probe)", "12.34", "10", "cop[tikv]", "table:tmock0", "tikv_task:{time:0s, loops:1}", "keep order:false", "N/A", "N/A"},
+}
+
+// newBenchInstance returns a mock instance answering all EXPLAIN statements with the same plan.
+func newBenchInstance(b *testing.B) tidb.Instance {
+	ins, err := tidb.NewMockInstance(tidb.Option{Label: "mock"}, "v7.5.0", func(query string) ([]string, [][]string, error) {
+		if strings.HasPrefix(query, "EXPLAIN") {
+			return benchExplainHeader, benchExplainResults, nil
+		}
+		return nil, nil, nil
+	})
+	if err != nil {
+		b.Fatal(err)
+	}
+	return ins
+}
+
+func BenchmarkGenEstResults(b *testing.B) {
+	ins := newBenchInstance(b)
+	defer ins.Close()
+	opt, err := cetest.DecodeOption(`
+progress-interval = "100000000"
+[[datasets]]
+name = "mock"
+db = "mock"
+label = "mock"
+[datasets.mock]
+rows = 1000
+ndv = 100
+`)
+	if err != nil {
+		b.Fatal(err)
+	}
+	ds, err := cetest.NewDataset(opt.Datasets[0])
+	if err != nil {
+		b.Fatal(err)
+	}
+	for _, qt := range []cetest.QueryType{cetest.QTSingleColPointQueryOnCol, cetest.QTMulColsRangeQueryOnIndex} {
+		b.Run(qt.String(), func(b *testing.B) {
+			for i := 0; i < b.N; i++ {
+				if _, err := ds.GenEstResults(ins, 100, qt); err != nil {
+					b.Fatal(err)
+				}
+			}
+		})
+	}
+}
+
+func BenchmarkExtractEstResultByHeader(b *testing.B) {
+	for i := 0; i < b.N; i++ {
+		if _, err := cetest.ExtractEstResultByHeader(benchExplainHeader, benchExplainResults); err != nil {
+			b.Fatal(err)
+		}
+	}
+}
+
+func BenchmarkParseExplainAnalyze(b *testing.B) {
+	for i := 0; i < b.N; i++ {
+		if _, err := cetest.ParseExplainAnalyze(benchExplainHeader, benchExplainResults); err != nil {
+			b.Fatal(err)
+		}
+	}
+}
+
+func BenchmarkCollectorAggregation(b *testing.B) {
+	const nIns, nDS, nQT, nCases = 2, 2, 4, 1000
+	for i := 0; i < b.N; i++ {
+		collector := cetest.NewEstResultCollector(nIns, nDS, nQT)
+		for insIdx := 0; insIdx < nIns; insIdx++ {
+			for dsIdx := 0; dsIdx < nDS; dsIdx++ {
+				for qtIdx := 0; qtIdx < nQT; qtIdx++ {
+					for c := 0; c < nCases; c++ {
+						collector.AddEstResult(insIdx, dsIdx, qtIdx, cetest.EstResult{
+							SQL:      fmt.Sprintf("q%v", c),
+							EstCard:  float64(c % 97),
+							TrueCard: float64(c % 89),
+							Labels:   map[string]string{"analyze-version": fmt.Sprintf("%v", c%2+1)},
+						})
+					}
+				}
+			}
+		}
+		rs := collector.EstResults(0, 0, 0)
+		for _, dim := range cetest.LabelDims(rs) {
+			cetest.GroupByLabel(rs, dim)
+		}
+		for insIdx := 0; insIdx < nIns; insIdx++ {
+			for dsIdx := 0; dsIdx < nDS; dsIdx++ {
+				for qtIdx := 0; qtIdx < nQT; qtIdx++ {
+					for _, r := range collector.EstResults(insIdx, dsIdx, qtIdx) {
+						cetest.PError(r)
+					}
+				}
+			}
+		}
+	}
+}
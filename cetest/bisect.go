@@ -0,0 +1,189 @@
+package cetest
+
+import (
+	"fmt"
+	"math"
+	"sort"
+
+	"github.com/pingcap/errors"
+	"github.com/qw4990/OptimizerTester/tidb"
+)
+
+// BisectOpt locates the range of builds where a regression of a cell appeared.
+// All instances of the option are builds ordered from the oldest one, which must be good, to the newest one,
+// which must be bad, and only builds picked by the binary search are connected.
+// Provisioning builds by versions is not supported, so all builds must be deployed in advance.
+type BisectOpt struct {
+	Dataset   string  `toml:"dataset"`    // label of the dataset of the failing cell
+	QueryType string  `toml:"query-type"` // query type of the failing cell
+	Threshold float64 `toml:"threshold"`  // a build is bad if P90 of absolute PErrors of the cell exceeds this
+	NSamples  int     `toml:"n-samples"`  // number of cases run on each build, 200 if it's 0
+}
+
+// BisectStep is the result of a build tested by bisect.
+type BisectStep struct {
+	Instance string
+	Version  string
+	Commit   string
+	P90      float64
+	Bad      bool
+}
+
+// BisectResult is the result of bisect, the regression appeared between builds Good and Bad, which are adjacent.
+type BisectResult struct {
+	Good  BisectStep
+	Bad   BisectStep
+	Steps []BisectStep // all tested builds in order of testing
+}
+
+func (bo BisectOpt) check(opt Option) (dsIdx, qtIdx int, err error) {
+	if len(opt.Instances) < 2 {
+		return 0, 0, errors.Errorf("bisect requires at least 2 instances")
+	}
+	dsIdx, qtIdx = opt.datasetIdx(bo.Dataset), opt.queryTypeIdx(bo.QueryType)
+	if dsIdx == -1 || qtIdx == -1 {
+		return 0, 0, errors.Errorf("unknown bisect dataset=%v or query-type=%v", bo.Dataset, bo.QueryType)
+	}
+	if bo.Threshold <= 0 || bo.NSamples < 0 {
+		return 0, 0, errors.Errorf("invalid bisect threshold=%v or n-samples=%v", bo.Threshold, bo.NSamples)
+	}
+	return dsIdx, qtIdx, nil
+}
+
+// RunBisect generates a reduced set of cases of the failing cell on the oldest build, and re-runs them on builds
+// picked by a binary search to find the adjacent good and bad builds.
+func RunBisect(opt Option) (BisectResult, error) {
+	dsIdx, qtIdx, err := opt.Bisect.check(opt)
+	if err != nil {
+		return BisectResult{}, err
+	}
+	cellOpt := opt
+	cellOpt.Datasets = []DatasetOpt{opt.Datasets[dsIdx]}
+	cellOpt.QueryTypes = []QueryType{opt.QueryTypes[qtIdx]}
+	cellOpt.NSamples = opt.Bisect.NSamples
+	if cellOpt.NSamples == 0 {
+		cellOpt.NSamples = 200
+	}
+
+	cases, err := genBisectCases(cellOpt)
+	if err != nil {
+		return BisectResult{}, err
+	}
+	fmt.Printf("[Bisect] %v cases of ds=%v, qt=%v are generated on %v\n", len(cases), opt.Bisect.Dataset, opt.Bisect.QueryType, opt.Instances[0].Label)
+
+	var result BisectResult
+	tested := make(map[int]BisectStep)
+	test := func(insIdx int) (BisectStep, error) {
+		if s, ok := tested[insIdx]; ok {
+			return s, nil
+		}
+		s, err := testBisectBuild(cellOpt, insIdx, cases)
+		if err != nil {
+			return s, err
+		}
+		fmt.Printf("[Bisect] ins=%v, version=%v, commit=%v, p90=%.3f, bad=%v\n", s.Instance, s.Version, s.Commit, s.P90, s.Bad)
+		tested[insIdx] = s
+		result.Steps = append(result.Steps, s)
+		return s, nil
+	}
+
+	lo, hi := 0, len(opt.Instances)-1
+	if s, err := test(lo); err != nil {
+		return result, err
+	} else if s.Bad {
+		return result, errors.Errorf("the oldest build %v is already bad, p90=%v", s.Instance, s.P90)
+	}
+	if s, err := test(hi); err != nil {
+		return result, err
+	} else if !s.Bad {
+		return result, errors.Errorf("the newest build %v is not bad, p90=%v", s.Instance, s.P90)
+	}
+	for hi-lo > 1 {
+		mid := (lo + hi) / 2
+		s, err := test(mid)
+		if err != nil {
+			return result, err
+		}
+		if s.Bad {
+			hi = mid
+		} else {
+			lo = mid
+		}
+	}
+	result.Good, result.Bad = tested[lo], tested[hi]
+	return result, nil
+}
+
+// genBisectCases generates cases of the only cell of this option on the first instance.
+func genBisectCases(cellOpt Option) ([]rerunCase, error) {
+	instances, err := tidb.ConnectToInstances(cellOpt.Instances[:1])
+	if err != nil {
+		return nil, errors.Trace(err)
+	}
+	defer instances[0].Close()
+	if err := cloneScratch(instances[0], cellOpt.Datasets[0], cellOpt.scratches); err != nil {
+		return nil, err
+	}
+	defer dropScratch(instances[0], cellOpt.Datasets[0], cellOpt.scratches)
+	ds := datasetMap[cellOpt.Datasets[0].Name](cellOpt.Datasets[0])
+	if err := ds.CheckRequirements(instances[0]); err != nil {
+		return nil, err
+	}
+	collector := NewEstResultCollector(1, 1, 1)
+	if err := runDatasetCases(cellOpt, instances[0], 0, 0, ds, collector); err != nil {
+		return nil, err
+	}
+	rs := collector.EstResults(0, 0, 0)
+	cases := make([]rerunCase, 0, len(rs))
+	for _, r := range rs {
+		cases = append(cases, rerunCase{r: EstResult{SQL: r.SQL, TrueCard: r.TrueCard, Tags: r.Tags}})
+	}
+	return cases, nil
+}
+
+// testBisectBuild re-runs these cases on this instance and returns whether it's bad.
+func testBisectBuild(cellOpt Option, insIdx int, cases []rerunCase) (BisectStep, error) {
+	insOpt := cellOpt.Instances[insIdx]
+	s := BisectStep{Instance: insOpt.Label}
+	instances, err := tidb.ConnectToInstances([]tidb.Option{insOpt})
+	if err != nil {
+		return s, errors.Trace(err)
+	}
+	ins := instances[0]
+	defer ins.Close()
+	s.Version, s.Commit = ins.Version(), ins.Build().Commit
+
+	dsOpt := cellOpt.Datasets[0]
+	if err := cloneScratch(ins, dsOpt, cellOpt.scratches); err != nil {
+		return s, err
+	}
+	defer dropScratch(ins, dsOpt, cellOpt.scratches)
+	if err := runHooks(ins, dsOpt.Setup); err != nil {
+		return s, fmt.Errorf("Setup ins=%v, ds=%v, err=%v", insOpt.Label, dsOpt.Label, err)
+	}
+	collector := NewEstResultCollector(1, 1, 1)
+	rerr := rerunEstResults(ins, 0, cases, collector, collectOpt{
+		ignoreErr:   true,
+		concurrency: cellOpt.Concurrency,
+		limiter:     cellOpt.limiter,
+	})
+	if err := runHooks(ins, dsOpt.Teardown); err != nil && rerr == nil {
+		rerr = fmt.Errorf("Teardown ins=%v, ds=%v, err=%v", insOpt.Label, dsOpt.Label, err)
+	}
+	if rerr != nil {
+		return s, rerr
+	}
+
+	rs := collector.EstResults(0, 0, 0)
+	if len(rs) == 0 {
+		return s, errors.Errorf("no case can be run on %v", insOpt.Label)
+	}
+	pes := make([]float64, len(rs))
+	for i := range rs {
+		pes[i] = math.Abs(PError(rs[i]))
+	}
+	sort.Float64s(pes)
+	s.P90 = pes[(len(pes)*9)/10]
+	s.Bad = s.P90 > cellOpt.Bisect.Threshold
+	return s, nil
+}
@@ -0,0 +1,121 @@
+package cetest
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/pingcap/errors"
+)
+
+// BudgetOpt limits the total resources consumed by cases which are actually executed on each instance during a run,
+// like cases measured by EXPLAIN ANALYZE, for predictable consumption on pay-per-use or shared clusters.
+// Once the budget of an instance is used up, its remaining cases are only explained.
+type BudgetOpt struct {
+	MaxScanRows float64 `toml:"max-scan-rows"` // total rows read by scan operators of all cases, unlimited if it's 0
+	MaxExecTime string  `toml:"max-exec-time"` // total execution time of all cases like "1h", unlimited if it's empty
+
+	maxExecTime time.Duration
+}
+
+func (bo *BudgetOpt) check() error {
+	if bo.MaxScanRows < 0 {
+		return errors.Errorf("invalid budget max-scan-rows=%v", bo.MaxScanRows)
+	}
+	if bo.MaxExecTime != "" {
+		d, err := time.ParseDuration(bo.MaxExecTime)
+		if err != nil || d <= 0 {
+			return errors.Errorf("invalid budget max-exec-time=%v", bo.MaxExecTime)
+		}
+		bo.maxExecTime = d
+	}
+	return nil
+}
+
+// BudgetUsage is the resource consumed by executed cases on an instance during a run.
+type BudgetUsage struct {
+	Cases     int
+	ScanRows  float64 // rows read by scan operators, only known for cases with runtime statistics of operators
+	ExecTime  time.Duration
+	Exhausted bool // whether the budget is used up and remaining cases are only explained
+}
+
+// runBudget accounts resources consumed on all instances during a run, nil if nothing is accounted.
+type runBudget struct {
+	opt   BudgetOpt
+	lock  sync.Mutex
+	usage map[string]*BudgetUsage // keyed by labels of instances
+}
+
+func newRunBudget(opt BudgetOpt) *runBudget {
+	return &runBudget{opt: opt, usage: make(map[string]*BudgetUsage)}
+}
+
+// exhausted returns whether the budget of this instance is used up.
+func (b *runBudget) exhausted(ins string) bool {
+	if b == nil {
+		return false
+	}
+	b.lock.Lock()
+	defer b.lock.Unlock()
+	u, ok := b.usage[ins]
+	return ok && u.Exhausted
+}
+
+// charge accounts this executed case on this instance, elapsed is used if its execution time is unknown.
+func (b *runBudget) charge(ins string, r EstResult, elapsed time.Duration) {
+	if b == nil {
+		return
+	}
+	b.lock.Lock()
+	defer b.lock.Unlock()
+	u, ok := b.usage[ins]
+	if !ok {
+		u = new(BudgetUsage)
+		b.usage[ins] = u
+	}
+	u.Cases++
+	u.ScanRows += scanRows(r.Operators)
+	if r.ExecTime > 0 {
+		u.ExecTime += r.ExecTime
+	} else {
+		u.ExecTime += elapsed
+	}
+	if !u.Exhausted && ((b.opt.MaxScanRows > 0 && u.ScanRows >= b.opt.MaxScanRows) ||
+		(b.opt.maxExecTime > 0 && u.ExecTime >= b.opt.maxExecTime)) {
+		u.Exhausted = true
+		fmt.Printf("[Budget] budget of ins=%v is used up after %v cases, scan-rows=%v, exec-time=%v, remaining cases are only explained\n",
+			ins, u.Cases, u.ScanRows, u.ExecTime)
+	}
+}
+
+// print prints resources consumed on all instances ordered by their labels.
+func (b *runBudget) print() {
+	if b == nil {
+		return
+	}
+	b.lock.Lock()
+	defer b.lock.Unlock()
+	labels := make([]string, 0, len(b.usage))
+	for l := range b.usage {
+		labels = append(labels, l)
+	}
+	sort.Strings(labels)
+	for _, l := range labels {
+		u := b.usage[l]
+		fmt.Printf("[Budget] ins=%v, executed-cases=%v, scan-rows=%v, exec-time=%v, exhausted=%v\n", l, u.Cases, u.ScanRows, u.ExecTime, u.Exhausted)
+	}
+}
+
+// scanRows returns the total rows read by scan operators in these runtime statistics.
+func scanRows(ops []OperatorStats) float64 {
+	rows := 0.0
+	for _, op := range ops {
+		if strings.Contains(op.ID, "Scan") || strings.Contains(op.ID, "PointGet") {
+			rows += op.ActRows
+		}
+	}
+	return rows
+}
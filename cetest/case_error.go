@@ -0,0 +1,200 @@
+package cetest
+
+import (
+	"bytes"
+	"fmt"
+	"sort"
+	"strings"
+	"sync"
+
+	"github.com/pingcap/errors"
+)
+
+// ErrorKind is the kind of the error of a failed case, which is stable for tools consuming results.
+type ErrorKind string
+
+// Kinds of errors of failed cases.
+const (
+	ErrKindSyntax        ErrorKind = "syntax"         // the case is rejected by the parser of the instance
+	ErrKindTimeout       ErrorKind = "timeout"        // the case is killed by timeouts like max_execution_time
+	ErrKindConnection    ErrorKind = "connection"     // the connection to the instance is broken
+	ErrKindParseExplain  ErrorKind = "parse-explain"  // results of EXPLAIN, TRACE or counting can't be parsed by this tool
+	ErrKindUnsupported   ErrorKind = "unsupported"    // the case uses features unsupported by the instance
+	ErrKindGuardRejected ErrorKind = "guard-rejected" // the case is rejected by the guard before it's executed
+	ErrKindTruthMismatch ErrorKind = "truth-mismatch" // the measured true cardinality differs from the calculated one
+	ErrKindLint          ErrorKind = "lint"           // the generated case is malformed, see Option.Lint
+	ErrKindExecute       ErrorKind = "execute"        // other failures of measuring the case on the instance
+)
+
+// errorKinds are all kinds of errors in the order of reports.
+var errorKinds = []ErrorKind{ErrKindSyntax, ErrKindTimeout, ErrKindConnection, ErrKindParseExplain, ErrKindUnsupported,
+	ErrKindGuardRejected, ErrKindTruthMismatch, ErrKindLint, ErrKindExecute}
+
+// errorKindPatterns are substrings of messages of errors of each kind, which are matched in order since errors of
+// the driver are only kept as messages once they're wrapped.
+var errorKindPatterns = []struct {
+	kind     ErrorKind
+	patterns []string
+}{
+	{ErrKindTimeout, []string{"Error 3024", "Error 1317", "maximum statement execution time exceeded", "Query execution was interrupted",
+		"context deadline exceeded", "i/o timeout"}},
+	{ErrKindConnection, []string{"invalid connection", "bad connection", "connection refused", "connection reset", "broken pipe",
+		"unexpected EOF", "Error 1040", "Error 2006", "Error 2013"}},
+	{ErrKindSyntax, []string{"Error 1064", "error in your SQL syntax"}},
+	{ErrKindUnsupported, []string{"Error 1235", "Error 1105: unsupported", "not supported"}},
+}
+
+// CaseError is the error of a failed case, which carries the case and the kind of the error.
+type CaseError struct {
+	Kind ErrorKind
+	SQL  string
+	Err  error
+}
+
+func (e *CaseError) Error() string {
+	return fmt.Sprintf("%v: %v", e.Kind, e.Err)
+}
+
+// Cause returns the underlying error, so errors.Cause sees through CaseError.
+func (e *CaseError) Cause() error { return e.Err }
+
+// Unwrap returns the underlying error for errors.Is and errors.As of the standard library.
+func (e *CaseError) Unwrap() error { return e.Err }
+
+// ErrorKindOf returns the kind of this error if it's a CaseError, and ErrKindExecute otherwise.
+func ErrorKindOf(err error) ErrorKind {
+	if ce, ok := err.(*CaseError); ok {
+		return ce.Kind
+	}
+	return ErrKindExecute
+}
+
+// newCaseError wraps this error of this case into a CaseError.
+func newCaseError(kind ErrorKind, sql string, err error) error {
+	return &CaseError{Kind: kind, SQL: sql, Err: err}
+}
+
+// parseExplainError wraps this error of parsing results of this case into a CaseError, nil if err is nil.
+func parseExplainError(sql string, err error) error {
+	if err == nil {
+		return nil
+	}
+	return newCaseError(ErrKindParseExplain, sql, err)
+}
+
+// classifyError wraps this error of this case into a CaseError of its kind, it's returned as is if it's classified.
+func classifyError(sql string, err error) error {
+	if _, ok := err.(*CaseError); ok {
+		return err
+	}
+	if rejectedByGuard(err) {
+		return newCaseError(ErrKindGuardRejected, sql, err)
+	}
+	msg := strings.ToLower(err.Error())
+	for _, kp := range errorKindPatterns {
+		for _, p := range kp.patterns {
+			if strings.Contains(msg, strings.ToLower(p)) {
+				return newCaseError(kp.kind, sql, err)
+			}
+		}
+	}
+	return newCaseError(ErrKindExecute, sql, err)
+}
+
+// failureLog keeps failed cases of all instances during a run, so they can be reported and consumed without
+// re-joining logs. Failed cases are not put into the collector since they have no estimations.
+type failureLog struct {
+	lock  sync.Mutex
+	cases map[string][]EstResult // keyed by labels of instances
+}
+
+func newFailureLog() *failureLog {
+	return &failureLog{cases: make(map[string][]EstResult)}
+}
+
+// record keeps this failed case of this instance.
+func (l *failureLog) record(ins string, r EstResult) {
+	if l == nil {
+		return
+	}
+	l.lock.Lock()
+	defer l.lock.Unlock()
+	l.cases[ins] = append(l.cases[ins], r)
+}
+
+// FailedCases returns failed cases of this instance during runs of this option, whose ErrKind and Err are set.
+func (opt Option) FailedCases(ins string) []EstResult {
+	if opt.failures == nil {
+		return nil
+	}
+	opt.failures.lock.Lock()
+	defer opt.failures.lock.Unlock()
+	rs := make([]EstResult, len(opt.failures.cases[ins]))
+	copy(rs, opt.failures.cases[ins])
+	return rs
+}
+
+// print prints numbers of failed cases of each kind on each instance ordered by their labels.
+func (l *failureLog) print() {
+	if l == nil {
+		return
+	}
+	for _, row := range l.taxonomy() {
+		fmt.Printf("[Failures] ins=%v, %v\n", row.ins, strings.Join(row.counts, ", "))
+	}
+}
+
+type failureRow struct {
+	ins    string
+	total  int
+	counts []string // like "timeout=3", only for kinds with failed cases
+}
+
+// taxonomy returns numbers of failed cases of each kind on instances with failed cases ordered by their labels.
+func (l *failureLog) taxonomy() []failureRow {
+	l.lock.Lock()
+	defer l.lock.Unlock()
+	labels := make([]string, 0, len(l.cases))
+	for ins := range l.cases {
+		labels = append(labels, ins)
+	}
+	sort.Strings(labels)
+	rows := make([]failureRow, 0, len(labels))
+	for _, ins := range labels {
+		cnt := make(map[ErrorKind]int)
+		for _, r := range l.cases[ins] {
+			cnt[r.ErrKind]++
+		}
+		row := failureRow{ins: ins, total: len(l.cases[ins])}
+		for _, k := range errorKinds {
+			if cnt[k] > 0 {
+				row.counts = append(row.counts, fmt.Sprintf("%v=%v", k, cnt[k]))
+			}
+		}
+		rows = append(rows, row)
+	}
+	return rows
+}
+
+// writeFailures writes the taxonomy of failed cases on each instance, nothing if no case fails.
+func writeFailures(md *bytes.Buffer, opt Option) {
+	if opt.failures == nil {
+		return
+	}
+	rows := opt.failures.taxonomy()
+	if len(rows) == 0 {
+		return
+	}
+	md.WriteString("# Failures\n")
+	md.WriteString("\n| Instance | Failed Cases | Kinds |\n")
+	md.WriteString("| ---- | ---- | ---- |\n")
+	for _, row := range rows {
+		md.WriteString(fmt.Sprintf("| %v | %v | %v |\n", row.ins, row.total, strings.Join(row.counts, ", ")))
+	}
+	md.WriteString("\n")
+}
+
+// failedEstResult returns the result of a failed case.
+func failedEstResult(query string, act float64, err error) EstResult {
+	return EstResult{SQL: query, TrueCard: act, ErrKind: ErrorKindOf(err), Err: errors.Cause(err).Error()}
+}
@@ -2,11 +2,14 @@ package cetest
 
 import (
 	"fmt"
+	"io"
 	"io/ioutil"
 	"math"
+	"os"
 	"sort"
 	"strings"
 	"sync"
+	"time"
 
 	"github.com/BurntSushi/toml"
 	"github.com/pingcap/errors"
@@ -14,10 +17,45 @@ import (
 )
 
 type DatasetOpt struct {
-	Name  string   `toml:"name"`
-	DB    string   `toml:"db"`
-	Label string   `toml:"label"`
-	Args  []string `toml:"args"`
+	Name       string     `toml:"name"`
+	DB         string     `toml:"db"`
+	DBs        []string   `toml:"dbs"` // other databases with the same schema as DB, used by cross-database queries
+	Label      string     `toml:"label"`
+	Args       []string   `toml:"args"`
+	Tables     []TableOpt `toml:"tables"`      // subset of tables and columns to test, all tables of the dataset are tested if empty
+	Warehouses int        `toml:"warehouses"`  // expected number of warehouses of TPCC datasets, not checked if 0
+	Mock       MockOpt    `toml:"mock"`        // shape of tables of mock datasets
+	MinRows    int        `toml:"min-rows"`    // minimum number of rows of each table used by the dataset, 1 if it's 0
+	TruthCheck int        `toml:"truth-check"` // number of queries of each query type verified by EXPLAIN ANALYZE if the dataset provides true cardinalities
+	Tags       []string   `toml:"tags"`        // only cases with any of these tags are tested, all cases are tested if empty
+
+	// Setup and Teardown are SQLs executed on each instance before and after cases of this dataset, like creating and
+	// dropping a temporary index. Session variables don't work since connections are pooled, use GLOBAL ones instead.
+	Setup    []string `toml:"setup"`
+	Teardown []string `toml:"teardown"`
+
+	Labels map[string]string `toml:"labels"` // labels of all results of this dataset, like { index = "with" }, see EstResult.Labels
+
+	Scratch ScratchOpt `toml:"scratch"` // run cases on a clone of the database of this dataset
+
+	progress    progressOpt
+	concurrency int
+	limiter     chan struct{}
+	planSample  float64
+	guard       GuardOpt
+	dashboard   *dashboard
+	executor    Executor
+	budget      *runBudget
+	adaptive    AdaptiveOpt
+	failures    *failureLog
+	lint        *lintLog
+	recheck     EstimateRecheckOpt
+	monitor     *statsMonitor
+	writes      *writeLoad
+	control     *runControl
+	timings     *cellTimings
+	latency     *instanceLatencies
+	archive     *explainArchive
 }
 
 type Option struct {
@@ -27,10 +65,164 @@ type Option struct {
 	AnaTables  []string      `toml:"analyze-tables"`
 	ReportDir  string        `toml:"report-dir"`
 	NSamples   int           `toml:"n-samples"`
+	ReadOnly   bool          `toml:"read-only"` // reject all SQLs that may modify data, useful on shared clusters
+
+	ResourceGroup string `toml:"resource-group"` // default resource group of all instances, see tidb.Option
+	LowPriority   bool   `toml:"low-priority"`   // run statements on all instances with low priority, see tidb.Option
+
+	// QueryPrefix, QuerySuffix and QueryHints are default comments and hints added into all statements of all
+	// instances, like "/* optimizertester run={run} */", so load of the tester can be attributed and filtered in
+	// server-side logs and STATEMENTS_SUMMARY, see tidb.Option and expandQueryComment.
+	QueryPrefix string   `toml:"query-prefix"`
+	QuerySuffix string   `toml:"query-suffix"`
+	QueryHints  []string `toml:"query-hints"`
+
+	Anonymize     bool   `toml:"anonymize"`      // hash literals and identifiers of SQLs in reports
+	AnonymizeSalt string `toml:"anonymize-salt"` // salt used to hash, required by anonymize, keep it secret to prevent values from being guessed
+
+	ExportFormats []string `toml:"export-formats"` // formats to export raw results into report-dir, "csv", "parquet", "json" or "bin"
+
+	Imports []ImportOpt `toml:"imports"` // results of external engines to compare with in reports
+
+	CollectPlanLatency bool `toml:"collect-plan-latency"` // report latencies of the optimizer, drawn with errors in each cell
+
+	Tags []string `toml:"tags"` // default tags of all datasets to filter cases
+
+	Rerun RerunOpt `toml:"rerun"` // re-run the worst cases of a previous run instead of generating new cases
+
+	MinVersions map[string]string `toml:"min-versions"` // minimum versions of instances required by query types, like "cross-db-join-query" = "v4.0.0"
+
+	SlowThreshold string `toml:"slow-threshold"` // capture triage bundles of cases whose latencies of EXPLAIN exceed this, like "500ms"
+
+	ProgressInterval string `toml:"progress-interval"` // interval of progress prints, a number of cases like "5000" or a duration like "30s"
+
+	Concurrency         int `toml:"concurrency"`           // number of cases running in parallel on each instance, 64 if it's 0
+	MaxTotalConnections int `toml:"max-total-connections"` // max number of cases running in parallel on all instances, unlimited if it's 0
+
+	PlanSampleRate float64 `toml:"plan-sample-rate"` // fraction of cases whose full plans are kept into plan_samples.csv, like 0.01
+
+	ExecTimeCases int `toml:"exec-time-cases"` // number of cases of each cell with identical plans on all instances to execute and compare
+
+	JoinOrder JoinOrderOpt `toml:"join-order"` // score join orders chosen by the optimizer against alternatives forced by hints
+
+	OptimizerTraceCases int `toml:"optimizer-trace-cases"` // number of the worst cases of each cell whose estimations are traced
+
+	Guard GuardOpt `toml:"guard"` // resource limits of cases which are actually executed
+
+	Collector CollectorOpt `toml:"collector"` // memory limit of collected results, cold cells are spilled to disk beyond it
+
+	Adaptive AdaptiveOpt `toml:"adaptive"` // stop generating cases of a cell once its mean absolute PError converges
+
+	Preflight PreflightOpt `toml:"preflight"` // estimate the run time by calibration cases before the run
+
+	Budget BudgetOpt `toml:"budget"` // total resource limits of executed cases on each instance, shared by all runs of the matrix
+
+	StatsCheck StatsCheckOpt `toml:"stats-check"` // check freshness of statistics before running
+
+	StatsMonitor StatsMonitorOpt `toml:"stats-monitor"` // detect statistics changing during the run, mostly by auto-analyze
+
+	WriteLoad WriteLoadOpt `toml:"write-load"` // write tables used by datasets in the background during the run, to measure estimations under churn
+
+	LockStats bool `toml:"lock-stats"` // lock statistics of tables used by datasets by LOCK STATS during the run, requires v6.5.0 or later
+
+	TopNCheck TopNCheckOpt `toml:"topn-check"` // cross-check true cardinalities of point cases against TopN counts after the run
+
+	EstimateRecheck EstimateRecheckOpt `toml:"estimate-recheck"` // explain cases again and tag those whose estimations changed
+
+	Matrix []MatrixDim `toml:"matrix"` // run the test once for each combination of values of these dimensions
+
+	Distribute DistributeOpt `toml:"distribute"` // Kubernetes Jobs generated by the distribute command to run shards in parallel
+
+	WhatIfIndexes []WhatIfIndexOpt `toml:"what-if-indexes"` // candidate indexes evaluated on cases after the run
+
+	Remediation RemediationOpt `toml:"remediation"` // test candidate statistics remediations of the worst-estimated columns after the run
+
+	StmtSummary StmtSummaryOpt `toml:"statements-summary"` // cross-reference cases against STATEMENTS_SUMMARY tables after the run
+
+	Dashboard bool `toml:"dashboard"` // show a live dashboard in the terminal instead of progress prints
+
+	// Control is the address of a local endpoint pausing, resuming, throttling or reporting the running test without
+	// killing it, a loopback address like "127.0.0.1:9090" or a unix socket like "unix:/tmp/cetest.sock", see runControl.
+	Control string `toml:"control"`
+
+	ExplainArchive ExplainArchiveOpt `toml:"explain-archive"` // archive raw EXPLAIN outputs of all cases in a content-addressed store
+
+	LatencyAware LatencyAwareOpt `toml:"latency-aware"` // scale concurrency of remote instances by their round-trip time
+
+	Email EmailOpt `toml:"email"` // send the report by email after the run
+
+	Charts ChartOpt `toml:"charts"` // formats and sizes of charts
+
+	ReportTemplates ReportTemplateOpt `toml:"report-templates"` // Go templates replacing sections of report.md
+
+	Reporters []string `toml:"reporters"` // reports to generate, "markdown", "charts", "json", "junit" or "html", only "markdown" if empty
+	JUnit     JUnitOpt `toml:"junit"`     // failing conditions of cells in the junit report
+
+	ReportOrder ReportOrderOpt `toml:"report-order"` // order of instances, datasets and query types in reports, sorted by default
+
+	NumberFormat NumberFormatOpt `toml:"number-format"` // formats of row counts and selectivities in reports
+
+	History HistoryOpt `toml:"history"` // keep summaries of runs and draw error trends across them
+
+	Bisect BisectOpt `toml:"bisect"` // the failing cell and threshold used by the bisect command
+
+	Issues IssueOpt `toml:"issues"` // draft GitHub issues for the worst cases
+
+	Corpus CorpusOpt `toml:"corpus"` // export or load versioned case sets shared with others
+
+	Lint bool `toml:"lint"` // check generated cases lexically before executing them, malformed ones are skipped and reported per dataset
+
+	Executor string `toml:"executor"` // how cases are measured, "explain", "explain-analyze", "trace" or "count-verify"
+
+	// Snapshot pins data read by executed cases to a snapshot by tidb_snapshot, so true cardinalities are identical
+	// during the whole run even if data is being written. It's "now" for the TSO allocated by PD when the run starts,
+	// a TSO or a time like "2024-01-01 10:00:00", which must be within the GC life time of all instances.
+	Snapshot string `toml:"snapshot"`
+
+	insVersions   []string // versions of connected instances
+	insCommits    []string // git commits of connected instances
+	runID         string   // ID of the run in comments of statements, see expandQueryComment
+	slowThreshold time.Duration
+	limiter       chan struct{}     // limits the number of cases running in parallel on all instances
+	matrixVars    map[string]string // global variables of the current matrix run
+	matrixResults *matrixResults    // labeled results of all runs of the matrix, nil if there is no matrix
+	executor      Executor
+	budget        *runBudget         // accounts resources consumed by executed cases
+	failures      *failureLog        // keeps failed cases, see FailedCases
+	lint          *lintLog           // counts malformed cases of each dataset
+	monitor       *statsMonitor      // nil if statistics are not monitored
+	statsLocks    *statsLocker       // nil if statistics are not locked
+	snapshots     *snapshotReads     // nil if reads are not pinned to a snapshot
+	scratches     *scratchDBs        // scratch databases created by the tester
+	writes        *writeLoad         // nil if there is no write load
+	control       *runControl        // nil if the control endpoint is disabled
+	timings       *cellTimings       // wall-clock time of cells on each instance
+	latency       *instanceLatencies // nil if the latency-aware mode is disabled
+	archive       *explainArchive    // nil if EXPLAIN outputs are not archived
+}
+
+// replaying returns whether cases are read from a previous run or corpora instead of being generated.
+func (opt Option) replaying() bool {
+	return opt.Rerun.Path != "" || len(opt.Corpus.Load) > 0
 }
 
-// DecodeOption decodes option content.
-func DecodeOption(content string) (Option, error) {
+// reportSQL returns the SQL to show in reports, which is anonymized if required.
+func (opt Option) reportSQL(sql string) string {
+	if opt.Anonymize {
+		return AnonymizeSQL(sql, opt.AnonymizeSalt)
+	}
+	return sql
+}
+
+// DecodeOption decodes option content, which is merged with these overlays in order if there are any.
+func DecodeOption(content string, overlays ...string) (Option, error) {
+	if len(overlays) > 0 {
+		merged, err := mergeConfigs(content, overlays...)
+		if err != nil {
+			return Option{}, err
+		}
+		content = merged
+	}
 	var opt Option
 	if _, err := toml.Decode(content, &opt); err != nil {
 		return Option{}, errors.Trace(err)
@@ -40,9 +232,260 @@ func DecodeOption(content string) (Option, error) {
 			return Option{}, fmt.Errorf("unknown dateset=%v", ds.Name)
 		}
 	}
+	if err := checkExportFormats(opt.ExportFormats); err != nil {
+		return Option{}, err
+	}
+	if err := opt.Rerun.check(); err != nil {
+		return Option{}, err
+	}
+	if opt.SlowThreshold != "" {
+		d, err := time.ParseDuration(opt.SlowThreshold)
+		if err != nil || d <= 0 {
+			return Option{}, errors.Errorf("invalid slow-threshold=%v", opt.SlowThreshold)
+		}
+		opt.slowThreshold = d
+	}
+	if opt.Anonymize && opt.AnonymizeSalt == "" {
+		// hashes without salt can be reversed by hashing guessed values
+		return Option{}, errors.Errorf("anonymize-salt is required when anonymize is enabled")
+	}
+	for name, ver := range opt.MinVersions {
+		var qt QueryType
+		if err := qt.UnmarshalText([]byte(name)); err != nil {
+			return Option{}, err
+		}
+		if !validVersion(ver) {
+			return Option{}, errors.Errorf("invalid min-version=%v of %v", ver, name)
+		}
+	}
+	if err := opt.Charts.check(); err != nil {
+		return Option{}, err
+	}
+	if err := opt.ReportTemplates.check(); err != nil {
+		return Option{}, err
+	}
+	if err := checkReporters(opt); err != nil {
+		return Option{}, err
+	}
+	if err := opt.ReportOrder.check(opt); err != nil {
+		return Option{}, err
+	}
+	if err := opt.NumberFormat.check(); err != nil {
+		return Option{}, err
+	}
+	if err := opt.History.check(); err != nil {
+		return Option{}, err
+	}
+	if err := opt.Issues.check(); err != nil {
+		return Option{}, err
+	}
+	if err := opt.Corpus.check(opt); err != nil {
+		return Option{}, err
+	}
+	if err := opt.Email.check(); err != nil {
+		return Option{}, err
+	}
+	if err := checkMatrix(opt.Matrix, opt.ReadOnly); err != nil {
+		return Option{}, err
+	}
+	if err := checkWhatIfIndexes(opt); err != nil {
+		return Option{}, err
+	}
+	if err := opt.Remediation.check(opt); err != nil {
+		return Option{}, err
+	}
+	if err := opt.StatsCheck.check(opt.ReadOnly); err != nil {
+		return Option{}, err
+	}
+	if err := opt.StatsMonitor.check(opt.ReadOnly); err != nil {
+		return Option{}, err
+	}
+	if opt.LockStats && opt.ReadOnly {
+		return Option{}, errors.Errorf("lock-stats is not allowed in read-only mode")
+	}
+	if opt.LockStats && strings.ToLower(opt.StatsMonitor.Action) == statsActionLock {
+		return Option{}, errors.Errorf("lock-stats conflicts with stats-monitor action=lock, statistics are locked during the whole run already")
+	}
+	if err := opt.JoinOrder.check(opt.ReadOnly); err != nil {
+		return Option{}, err
+	}
+	if err := opt.TopNCheck.check(); err != nil {
+		return Option{}, err
+	}
+	if err := opt.EstimateRecheck.check(); err != nil {
+		return Option{}, err
+	}
+	if err := opt.Guard.check(); err != nil {
+		return Option{}, err
+	}
+	if err := opt.Budget.check(); err != nil {
+		return Option{}, err
+	}
+	if err := opt.Collector.check(); err != nil {
+		return Option{}, err
+	}
+	if err := opt.Preflight.check(opt); err != nil {
+		return Option{}, err
+	}
+	if err := opt.Adaptive.check(); err != nil {
+		return Option{}, err
+	}
+	executor, err := newExecutor(opt)
+	if err != nil {
+		return Option{}, err
+	}
+	opt.executor = executor
+	if err := checkSnapshot(opt); err != nil {
+		return Option{}, err
+	}
+	if opt.snapshots = newSnapshotReads(opt.Snapshot); opt.snapshots != nil {
+		opt.executor = snapshotExecutor{opt.executor, opt.snapshots}
+	}
+	if err := opt.WriteLoad.check(opt); err != nil {
+		return Option{}, err
+	}
+	if err := checkReplicas(opt); err != nil {
+		return Option{}, err
+	}
+	if err := checkServerless(opt); err != nil {
+		return Option{}, err
+	}
+	progress, err := parseProgressOpt(opt.ProgressInterval)
+	if err != nil {
+		return Option{}, err
+	}
+	if opt.Dashboard {
+		progress = progressOpt{cases: math.MaxInt32} // progresses are shown in the dashboard
+	}
+	if opt.Concurrency < 0 || opt.MaxTotalConnections < 0 {
+		return Option{}, errors.Errorf("invalid concurrency=%v or max-total-connections=%v", opt.Concurrency, opt.MaxTotalConnections)
+	}
+	if opt.PlanSampleRate < 0 || opt.PlanSampleRate > 1 {
+		return Option{}, errors.Errorf("invalid plan-sample-rate=%v", opt.PlanSampleRate)
+	}
+	if opt.MaxTotalConnections > 0 {
+		opt.limiter = make(chan struct{}, opt.MaxTotalConnections)
+	}
+	opt.budget = newRunBudget(opt.Budget)
+	opt.failures = newFailureLog()
+	opt.lint = newLintLog(opt.Lint)
+	opt.monitor = newStatsMonitor(opt.StatsMonitor)
+	opt.statsLocks = newStatsLocker(opt.LockStats)
+	opt.writes = newWriteLoad(opt.WriteLoad)
+	if err := checkControlAddr(opt.Control); err != nil {
+		return Option{}, err
+	}
+	opt.control = newRunControl(opt.Control)
+	opt.timings = newCellTimings()
+	opt.scratches = newScratchDBs()
+	if err := opt.LatencyAware.check(); err != nil {
+		return Option{}, err
+	}
+	opt.latency = newInstanceLatencies(opt.LatencyAware)
+	opt.archive = newExplainArchive(opt)
+	for i := range opt.Datasets {
+		if err := opt.Datasets[i].Scratch.check(opt.Datasets[i], opt); err != nil {
+			return Option{}, err
+		}
+		if opt.Datasets[i].Scratch.DB != "" {
+			opt.Datasets[i].Scratch.source = opt.Datasets[i].DB
+			opt.Datasets[i].DB = opt.Datasets[i].Scratch.DB
+		}
+		if len(opt.Datasets[i].Tags) == 0 {
+			opt.Datasets[i].Tags = opt.Tags
+		}
+		opt.Datasets[i].progress = progress
+		opt.Datasets[i].concurrency = opt.Concurrency
+		opt.Datasets[i].limiter = opt.limiter
+		opt.Datasets[i].planSample = opt.PlanSampleRate
+		opt.Datasets[i].guard = opt.Guard
+		opt.Datasets[i].executor = opt.executor
+		opt.Datasets[i].budget = opt.budget
+		opt.Datasets[i].failures = opt.failures
+		opt.Datasets[i].lint = opt.lint
+		opt.Datasets[i].adaptive = opt.Adaptive
+		opt.Datasets[i].recheck = opt.EstimateRecheck
+		opt.Datasets[i].monitor = opt.monitor
+		opt.Datasets[i].writes = opt.writes
+		opt.Datasets[i].control = opt.control
+		opt.Datasets[i].timings = opt.timings
+		opt.Datasets[i].latency = opt.latency
+		opt.Datasets[i].archive = opt.archive
+	}
+	for i := range opt.Instances {
+		if opt.Instances[i].ResourceGroup == "" {
+			opt.Instances[i].ResourceGroup = opt.ResourceGroup
+		}
+		if opt.LowPriority {
+			opt.Instances[i].LowPriority = true
+		}
+	}
+	opt.runID = newRunID()
+	if err := setQueryComments(&opt); err != nil {
+		return Option{}, err
+	}
+	if opt.ReadOnly {
+		if opt.OptimizerTraceCases > 0 {
+			return Option{}, errors.Errorf("optimizer-trace-cases is not allowed in read-only mode since TRACE is rejected")
+		}
+		if len(opt.AnaTables) > 0 {
+			return Option{}, errors.Errorf("analyze-tables=%v is not allowed in read-only mode", opt.AnaTables)
+		}
+		for _, ds := range opt.Datasets {
+			for _, sql := range append(ds.Setup, ds.Teardown...) {
+				if !tidb.IsReadOnlySQL(sql) {
+					return Option{}, errors.Errorf("setup or teardown sql=%v of dataset=%v is not allowed in read-only mode", sql, ds.Label)
+				}
+			}
+		}
+		for i := range opt.Instances {
+			opt.Instances[i].ReadOnly = true
+		}
+	}
 	return opt, nil
 }
 
+// checkReplicas rejects options which make replicas of an instance diverge, since its cases are sharded across them.
+func checkReplicas(opt Option) error {
+	for _, ins := range opt.Instances {
+		if len(ins.Replicas) == 0 {
+			continue
+		}
+		if opt.WriteLoad.enabled() {
+			return errors.Errorf("write-load is not allowed on instance %v with replicas, whose data would diverge", ins.Label)
+		}
+		for _, ds := range opt.Datasets {
+			if ds.Scratch.DB != "" && ds.Scratch.SampleRate > 0 && ds.Scratch.SampleRate < 1 {
+				return errors.Errorf("scratch sample-rate of dataset=%v is not allowed on instance %v with replicas, which would sample different rows", ds.Label, ins.Label)
+			}
+		}
+	}
+	return nil
+}
+
+// checkServerless rejects options requiring statements unsupported on serverless instances, see
+// tidb.UnsupportedOnServerless, so runs fail before connecting instead of in the middle.
+func checkServerless(opt Option) error {
+	for _, ins := range opt.Instances {
+		if !ins.Serverless {
+			continue
+		}
+		if !strings.Contains(ins.User, ".") {
+			return errors.Errorf("user=%v of serverless instance %v should be prefixed like \"2xxxx.root\"", ins.User, ins.Label)
+		}
+		if strings.EqualFold(ins.TLS, "false") {
+			return errors.Errorf("serverless instance %v requires TLS", ins.Label)
+		}
+		if len(opt.Matrix) > 0 {
+			return errors.Errorf("matrix is not allowed on serverless instance %v, which doesn't support SET GLOBAL", ins.Label)
+		}
+		if opt.StmtSummary.Enabled && opt.StmtSummary.Cluster {
+			return errors.Errorf("statements-summary cluster is not allowed on serverless instance %v, which doesn't support CLUSTER_ tables", ins.Label)
+		}
+	}
+	return nil
+}
+
 // QueryType ...
 type QueryType int
 
@@ -51,9 +494,25 @@ const (
 	QTSingleColPointQueryOnIndex
 	QTSingleColMCVPointOnCol
 	QTSingleColMCVPointOnIndex
+	QTSingleColNullRangeQueryOnCol
+	QTSingleColBoundaryQueryOnCol
+	QTSingleColInQueryOnCol
+	QTSingleColRangeQueryOnCol
+	QTSingleColPrefixLikeQueryOnCol
+	QTSingleColLatestRangeQueryOnCol
+	QTSingleColCTEQueryOnCol
+	QTSingleColApplyQueryOnCol
+	QTSingleColPointGetQueryOnUniqueKey
 
 	QTMulColsPointQueryOnIndex
 	QTMulColsRangeQueryOnIndex
+	QTMulColsRangeSweepQueryOnIndex
+
+	QTCrossDBJoinQuery
+
+	QTRecursiveCTEQuery
+
+	numQueryTypes // number of query types, keep it the last one
 )
 
 var (
@@ -63,15 +522,58 @@ var (
 		QTSingleColMCVPointOnCol:     "single-col-mcv-point-on-col",
 		QTSingleColMCVPointOnIndex:   "single-col-mcv-point-on-index",
 
-		QTMulColsPointQueryOnIndex: "mul-cols-point-query-on-index",
-		QTMulColsRangeQueryOnIndex: "mul-cols-range-query-on-index",
+		QTSingleColNullRangeQueryOnCol:   "single-col-null-range-query-on-col",
+		QTSingleColBoundaryQueryOnCol:    "single-col-boundary-query-on-col",
+		QTSingleColInQueryOnCol:          "single-col-in-query-on-col",
+		QTSingleColRangeQueryOnCol:       "single-col-range-query-on-col",
+		QTSingleColPrefixLikeQueryOnCol:  "single-col-prefix-like-query-on-col",
+		QTSingleColLatestRangeQueryOnCol: "single-col-latest-range-query-on-col",
+		QTSingleColCTEQueryOnCol:         "single-col-cte-query-on-col",
+		QTSingleColApplyQueryOnCol:       "single-col-apply-query-on-col",
+
+		QTSingleColPointGetQueryOnUniqueKey: "single-col-point-get-query-on-unique-key",
+
+		QTMulColsPointQueryOnIndex:      "mul-cols-point-query-on-index",
+		QTMulColsRangeQueryOnIndex:      "mul-cols-range-query-on-index",
+		QTMulColsRangeSweepQueryOnIndex: "mul-cols-range-sweep-query-on-index",
+
+		QTCrossDBJoinQuery: "cross-db-join-query",
+
+		QTRecursiveCTEQuery: "recursive-cte-query",
 	}
 )
 
+// qtMinVersions are minimum versions of instances required by query types, which are declared when
+// query types use SQL features or statistics only supported by newer versions.
+// Query types not in this map are supported by all versions, and it can be overridden by Option.MinVersions.
+var qtMinVersions = map[QueryType]string{
+	QTSingleColCTEQueryOnCol:   "v5.1.0",
+	QTSingleColApplyQueryOnCol: "v6.1.0", // NO_DECORRELATE
+	QTRecursiveCTEQuery:        "v5.1.0",
+}
+
 func (qt QueryType) String() string {
 	return qtNameMap[qt]
 }
 
+// minVersion returns the minimum version of instances required by this query type, "" if there is no requirement.
+func (opt Option) minVersion(qt QueryType) string {
+	if v, ok := opt.MinVersions[qt.String()]; ok {
+		return v
+	}
+	return qtMinVersions[qt]
+}
+
+// unsupported returns whether this query type can't be tested on this instance because of its version.
+// Versions of instances are unknown if they are imported from external engines, which are always supported.
+func (opt Option) unsupported(insIdx int, qt QueryType) bool {
+	minVer := opt.minVersion(qt)
+	if minVer == "" || insIdx >= len(opt.insVersions) || opt.insVersions[insIdx] == "" {
+		return false
+	}
+	return tidb.ToComparableVersion(opt.insVersions[insIdx]) < tidb.ToComparableVersion(minVer)
+}
+
 func (qt *QueryType) UnmarshalText(text []byte) error {
 	for k, v := range qtNameMap {
 		if v == string(text) {
@@ -86,18 +588,98 @@ var datasetMap = map[string]func(DatasetOpt) Dataset{ // read-only
 	"zipfx": newDatasetZipFX,
 	"imdb":  newDatasetIMDB,
 	"tpcc":  newDatasetTPCC,
+	"wide":  newDatasetWide,
+
+	"prefixstr":  newDatasetPrefixStr,
+	"timeseries": newDatasetTimeSeries,
+	"hierarchy":  newDatasetHierarchy,
+	"mock":       newDatasetMock,
 }
 
-func RunCETestWithConfig(confPath string) error {
-	confContent, err := ioutil.ReadFile(confPath)
-	if err != nil {
-		return errors.Trace(err)
+// NewDataset creates the dataset of this option, which is used to drive datasets without running the whole test.
+func NewDataset(opt DatasetOpt) (Dataset, error) {
+	newDataset, ok := datasetMap[strings.ToLower(opt.Name)]
+	if !ok {
+		return nil, errors.Errorf("unknown dataset=%v", opt.Name)
 	}
-	opt, err := DecodeOption(string(confContent))
+	return newDataset(opt), nil
+}
+
+// runDatasetCases runs cases of all query types of this dataset on this instance between its setup and teardown.
+func runDatasetCases(opt Option, ins tidb.Instance, insIdx, dsIdx int, ds Dataset, collector EstResultCollector) (rerr error) {
+	dsOpt := opt.Datasets[dsIdx]
+	if err := runHooks(ins, dsOpt.Setup); err != nil {
+		return fmt.Errorf("Setup ins=%v, ds=%v, err=%v", opt.Instances[insIdx].Label, dsOpt.Label, err)
+	}
+	defer func() {
+		if err := runHooks(ins, dsOpt.Teardown); err != nil && rerr == nil {
+			rerr = fmt.Errorf("Teardown ins=%v, ds=%v, err=%v", opt.Instances[insIdx].Label, dsOpt.Label, err)
+		}
+	}()
+	for qtIdx, qt := range opt.QueryTypes {
+		if opt.unsupported(insIdx, qt) {
+			fmt.Printf("[GenEstResults] skip qt=%v on ins=%v, which requires %v\n", qt, opt.Instances[insIdx].Label, opt.minVersion(qt))
+			continue
+		}
+		ers, err := ds.GenEstResults(ins, opt.NSamples, qt)
+		if err != nil {
+			return fmt.Errorf("GenEstResult ins=%v, ds=%v, qt=%v, err=%v", opt.Instances[insIdx].Label,
+				dsOpt.Label, qt.String(), err)
+		}
+		collector.AppendEstResults(insIdx, dsIdx, qtIdx, ers)
+		if mem, ok := CollectorMemoryOf(collector); ok {
+			fmt.Printf("[Collector] ins=%v, ds=%v, qt=%v, results=%v, %v\n", opt.Instances[insIdx].Label, dsOpt.Label, qt.String(), len(ers), mem)
+		}
+	}
+	return nil
+}
+
+// runHooks executes these setup or teardown SQLs in order.
+func runHooks(ins tidb.Instance, sqls []string) error {
+	for _, sql := range sqls {
+		if err := ins.Exec(sql); err != nil {
+			return fmt.Errorf("sql=%v, err=%v", sql, err)
+		}
+	}
+	return nil
+}
+
+// DecodeOptionFiles decodes these configs, which are a base config and its overlays.
+func DecodeOptionFiles(confPaths []string) (Option, error) {
+	contents := make([]string, 0, len(confPaths))
+	for _, p := range confPaths {
+		content, err := ioutil.ReadFile(p)
+		if err != nil {
+			return Option{}, errors.Trace(err)
+		}
+		contents = append(contents, string(content))
+	}
+	return DecodeOption(contents[0], contents[1:]...)
+}
+
+// RunCETestWithConfig runs the test with these configs, which are a base config and its overlays,
+// tags override tags of all datasets if not empty.
+func RunCETestWithConfig(confPaths []string, tags []string) error {
+	opt, err := DecodeOptionFiles(confPaths)
 	if err != nil {
 		return err
 	}
+	return RunCETest(opt, tags)
+}
 
+// RunCETest runs the test with this option, tags override tags of all datasets if not empty.
+func RunCETest(opt Option, tags []string) error {
+	if len(opt.Matrix) > 0 {
+		return runMatrix(opt, tags)
+	}
+	if len(tags) > 0 {
+		opt.Tags = tags
+		for i := range opt.Datasets {
+			opt.Datasets[i].Tags = tags
+		}
+	}
+
+	printRunID(opt)
 	instances, err := tidb.ConnectToInstances(opt.Instances)
 	if err != nil {
 		return errors.Trace(err)
@@ -108,12 +690,90 @@ func RunCETestWithConfig(confPath string) error {
 		}
 	}()
 
+	for _, ins := range instances {
+		opt.insVersions = append(opt.insVersions, ins.Version())
+		opt.insCommits = append(opt.insCommits, ins.Build().Commit)
+	}
+	if err := setMatrixVars(instances, opt.matrixVars); err != nil {
+		return err
+	}
+
+	if err := cloneScratchDatabases(opt, instances); err != nil {
+		return err
+	}
+	defer dropScratchDatabases(opt, instances)
+
 	datasets := make([]Dataset, len(opt.Datasets))
 	for i := range opt.Datasets {
 		datasets[i] = datasetMap[opt.Datasets[i].Name](opt.Datasets[i])
 	}
 
-	collector := NewEstResultCollector(len(instances), len(opt.Datasets), len(opt.QueryTypes))
+	if !opt.replaying() {
+		if err := checkRequirements(opt, instances, datasets); err != nil {
+			return err
+		}
+		if err := checkStatsFreshness(opt, instances, datasets); err != nil {
+			return err
+		}
+		if err := preflight(opt, instances, datasets, os.Stdin); err != nil {
+			return err
+		}
+	}
+
+	opt, collector, err := ImportEstResults(opt)
+	if err != nil {
+		return err
+	}
+	if c, ok := collector.(io.Closer); ok {
+		defer c.Close()
+	}
+	var rerunCases []rerunCase
+	if opt.Rerun.Path != "" {
+		if rerunCases, err = readRerunCases(opt); err != nil {
+			return err
+		}
+		fmt.Printf("[Rerun] re-run %v cases of %v\n", len(rerunCases), opt.Rerun.Path)
+	}
+	if len(opt.Corpus.Load) > 0 {
+		if rerunCases, err = loadCorpusCases(opt, instances, datasets); err != nil {
+			return err
+		}
+		fmt.Printf("[Corpus] run %v cases of %v\n", len(rerunCases), opt.Corpus.Load)
+	}
+	labelRerunCases(opt, rerunCases)
+	if err := opt.snapshots.open(instances); err != nil {
+		return err
+	}
+	defer opt.snapshots.close()
+	tables := datasetTables(opt, datasets)
+	if err := opt.statsLocks.check(instances); err != nil {
+		return err
+	}
+	defer opt.statsLocks.unlock()
+	if err := opt.monitor.start(instances, tables); err != nil {
+		return err
+	}
+	defer opt.monitor.stop()
+	if err := opt.writes.start(instances, datasetColumns(opt, datasets)); err != nil {
+		return err
+	}
+	defer opt.writes.stop()
+	opt.timings.reset() // cells are timed again in each run of the matrix
+	if err := opt.control.start(opt, collector); err != nil {
+		return err
+	}
+	defer opt.control.stop()
+	var dash *dashboard
+	stopDash := make(chan struct{})
+	if opt.Dashboard {
+		dash = newDashboard()
+		for i := range datasets {
+			if b, ok := datasets[i].(interface{ base() *datasetBase }); ok {
+				b.base().opt.dashboard = dash
+			}
+		}
+		go dash.run(stopDash)
+	}
 	var wg sync.WaitGroup
 	insErrs := make([]error, len(instances))
 	for insIdx := range instances {
@@ -121,6 +781,7 @@ func RunCETestWithConfig(confPath string) error {
 		go func(insIdx int) {
 			defer wg.Done()
 			ins := instances[insIdx]
+			opt.latency.measure(ins, opt.Concurrency)
 
 			// analyze tables
 			for _, tbl := range opt.AnaTables {
@@ -130,21 +791,58 @@ func RunCETestWithConfig(confPath string) error {
 				}
 			}
 
-			for dsIdx := range opt.Datasets {
-				ds := datasets[dsIdx]
-				for qtIdx, qt := range opt.QueryTypes {
-					ers, err := ds.GenEstResults(ins, opt.NSamples, qt)
-					if err != nil {
-						insErrs[insIdx] = fmt.Errorf("GenEstResult ins=%v, ds=%v, qt=%v, err=%v", opt.Instances[insIdx].Label,
-							opt.Datasets[dsIdx].Label, qt.String(), err)
-						return
+			// lock statistics after analyzing tables, since locked tables can't be analyzed
+			if err := opt.statsLocks.lock(ins, tables); err != nil {
+				insErrs[insIdx] = fmt.Errorf("lock statistics on ins=%v, err=%v", opt.Instances[insIdx].Label, err)
+				return
+			}
+
+			if opt.replaying() {
+				var cases []rerunCase
+				for _, c := range rerunCases {
+					if !opt.unsupported(insIdx, opt.QueryTypes[c.qtIdx]) {
+						cases = append(cases, c)
 					}
-					collector.AppendEstResults(insIdx, dsIdx, qtIdx, ers)
+				}
+				if err := rerunEstResults(ins, insIdx, cases, collector, collectOpt{
+					ignoreErr:   opt.Rerun.IgnoreError,
+					concurrency: opt.Concurrency,
+					limiter:     opt.limiter,
+					planSample:  opt.PlanSampleRate,
+					dashboard:   dash,
+					executor:    opt.executor,
+					budget:      opt.budget,
+					failures:    opt.failures,
+					monitor:     opt.monitor,
+					writes:      opt.writes,
+					control:     opt.control,
+					latency:     opt.latency,
+					archive:     opt.archive,
+					ins:         opt.Instances[insIdx].Label,
+					cell:        fmt.Sprintf("%v/rerun", opt.Instances[insIdx].Label),
+				}); err != nil {
+					insErrs[insIdx] = fmt.Errorf("Rerun ins=%v, err=%v", opt.Instances[insIdx].Label, err)
+				}
+				return
+			}
+
+			for dsIdx := range opt.Datasets {
+				if err := runDatasetCases(opt, ins, insIdx, dsIdx, datasets[dsIdx], collector); err != nil {
+					insErrs[insIdx] = err
+					return
 				}
 			}
 		}(insIdx)
 	}
 	wg.Wait()
+	close(stopDash)
+	opt.monitor.stop()
+	opt.writes.stop()
+	opt.control.stop()
+	opt.statsLocks.unlock()
+	opt.budget.print()
+	opt.failures.print()
+	opt.lint.print()
 
 	for _, err := range insErrs {
 		if err != nil {
@@ -152,7 +850,61 @@ func RunCETestWithConfig(confPath string) error {
 		}
 	}
 
-	if err := GenPErrorBarChartsReport(opt, collector); err != nil {
+	if err := crossReferenceStmtSummary(opt, instances, collector); err != nil {
+		return err
+	}
+	if err := recordTableRows(opt, instances, collector); err != nil {
+		return err
+	}
+	tagDefaultSelectivities(opt, instances, collector)
+	if err := crossCheckTopN(opt, instances, collector); err != nil {
+		return err
+	}
+	if err := classifyPlanRisks(opt, instances, collector); err != nil {
+		return err
+	}
+	if err := evaluateWhatIfIndexes(opt, instances, collector); err != nil {
+		return err
+	}
+	if err := remediateColumns(opt, instances, collector); err != nil {
+		return err
+	}
+	if err := compareExecTime(opt, instances, collector); err != nil {
+		return err
+	}
+	if err := scoreJoinOrders(opt, instances, collector); err != nil {
+		return err
+	}
+	if err := traceWorstCases(opt, instances, collector); err != nil {
+		return err
+	}
+	if err := triageSlowCases(opt, instances, collector); err != nil {
+		return err
+	}
+	if err := fileIssues(opt, instances, collector); err != nil {
+		return err
+	}
+	opt.matrixResults.collect(opt, collector)
+	if err := GenReports(opt, collector); err != nil {
+		return err
+	}
+	if err := ExportRawResults(opt, collector); err != nil {
+		return err
+	}
+	opt.archive.summary()
+	if err := ExportPlanSamples(opt, collector); err != nil {
+		return err
+	}
+	if err := ExportCorpora(opt, instances, datasets, collector); err != nil {
+		return err
+	}
+	if err := RecordRunHistory(opt, collector, time.Now()); err != nil {
+		return err
+	}
+	if err := GenTrendReport(opt); err != nil {
+		return err
+	}
+	if err := SendReport(opt); err != nil {
 		return err
 	}
 
@@ -169,7 +921,7 @@ func printTop10BadCases(opt Option, collector EstResultCollector) error {
 				})
 				for i := 0; i < 10 && i < len(ers); i++ {
 					fmt.Printf("[BadCase-%v-%v-%v]: %v, perror=%v\n", opt.Instances[insIdx].Label, opt.Datasets[dsIdx].Label,
-						opt.QueryTypes[qtIdx].String(), ers[i].SQL, PError(ers[i]))
+						opt.QueryTypes[qtIdx].String(), opt.reportSQL(ers[i].SQL), PError(ers[i]))
 				}
 			}
 		}
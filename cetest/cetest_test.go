@@ -1,7 +1,23 @@
 package cetest_test
 
 import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path"
+	"reflect"
+	"regexp"
+	"strconv"
+	"strings"
+	"sync/atomic"
 	"testing"
+	"testing/quick"
+	"time"
 
 	"github.com/qw4990/OptimizerTester/cetest"
 	"github.com/qw4990/OptimizerTester/tidb"
@@ -9,7 +25,7 @@ import (
 
 func TestGenQErrorBoxPlotReport(t *testing.T) {
 	opt := cetest.Option{
-		QueryTypes: []cetest.QueryType{cetest.QTMultiColsPointQuery, cetest.QTMultiColsRangeQuery},
+		QueryTypes: []cetest.QueryType{cetest.QTMulColsPointQueryOnIndex, cetest.QTMulColsRangeQueryOnIndex},
 		Datasets: []cetest.DatasetOpt{
 			{Label: "zipfx"},
 			{Label: "tpcc-10G"},
@@ -32,7 +48,7 @@ func TestGenQErrorBoxPlotReport(t *testing.T) {
 
 func TestGenPErrorBarChartsReport(t *testing.T) {
 	opt := cetest.Option{
-		QueryTypes: []cetest.QueryType{cetest.QTMultiColsPointQuery, cetest.QTMultiColsRangeQuery},
+		QueryTypes: []cetest.QueryType{cetest.QTMulColsPointQueryOnIndex, cetest.QTMulColsRangeQueryOnIndex},
 		Datasets: []cetest.DatasetOpt{
 			{Label: "zipfx"},
 			{Label: "tpcc-10G"},
@@ -52,48 +68,3530 @@ func TestGenPErrorBarChartsReport(t *testing.T) {
 	}
 }
 
+func TestPErrorByTagReport(t *testing.T) {
+	opt := cetest.Option{
+		QueryTypes: []cetest.QueryType{cetest.QTSingleColPointQueryOnCol},
+		Datasets:   []cetest.DatasetOpt{{Label: "zipfx"}},
+		Instances:  []tidb.Option{{Label: "v4.0"}},
+		ReportDir:  "./test",
+	}
+	collector := cetest.NewEstResultCollector(1, 1, 1)
+	collector.AddEstResult(0, 0, 0, cetest.EstResult{SQL: "q1", EstCard: 10, TrueCard: 5, Tags: []string{cetest.TagMCV}})
+	collector.AddEstResult(0, 0, 0, cetest.EstResult{SQL: "q2", EstCard: 1, TrueCard: 0, Tags: []string{cetest.TagEmpty}})
+	if err := cetest.GenPErrorBarChartsReport(opt, collector); err != nil {
+		t.Fatal(err)
+	}
+	md, err := ioutil.ReadFile(path.Join(opt.ReportDir, "report.md"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, s := range []string{"Absolute PError by Tag", "| empty | v4.0 | 1 |", "| mcv | v4.0 | 1 |"} {
+		if !strings.Contains(string(md), s) {
+			t.Fatalf("%q is not in the report", s)
+		}
+	}
+}
+
+func TestCellPages(t *testing.T) {
+	opt := cetest.Option{
+		QueryTypes: []cetest.QueryType{cetest.QTSingleColPointQueryOnCol},
+		Datasets:   []cetest.DatasetOpt{{Label: "zipfx"}},
+		Instances:  []tidb.Option{{Label: "v4.0"}},
+		ReportDir:  "./test",
+	}
+	collector := cetest.NewEstResultCollector(1, 1, 1)
+	for i := 1; i <= 50; i++ {
+		collector.AddEstResult(0, 0, 0, cetest.EstResult{SQL: fmt.Sprintf("q%v", i), EstCard: float64(i), TrueCard: 10})
+	}
+	collector.AddEstResult(0, 0, 0, cetest.EstResult{SQL: "q100", EstCard: 100, TrueCard: 10, Plan: "TableFullScan"})
+	if err := cetest.GenPErrorBarChartsReport(opt, collector); err != nil {
+		t.Fatal(err)
+	}
+	md, err := ioutil.ReadFile(path.Join(opt.ReportDir, "report.md"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !strings.Contains(string(md), "[v4.0](cells/single-col-point-query-on-col-zipfx-v4.0.md)") {
+		t.Fatal("no link to the drill-down page")
+	}
+	page, err := ioutil.ReadFile(path.Join(opt.ReportDir, "cells", "single-col-point-query-on-col-zipfx-v4.0.md"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, s := range []string{"PError Histogram", "Worst 20 Cases", "Best 20 Cases",
+		"| 9.000 | 100 | 10 | `q100` | [plan](#plan-1) |", "| 0.000 | 10 | 10 | `q10` | - |", "<a id=\"plan-1\"></a>"} {
+		if !strings.Contains(string(page), s) {
+			t.Fatalf("%q is not in the page", s)
+		}
+	}
+}
+
+func TestReportTemplates(t *testing.T) {
+	dir, err := ioutil.TempDir("", "cetest-templates")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	templates := map[string]string{
+		"header.tmpl": "<h1>{{len .Instances}} instances: {{join .QueryTypes \",\"}}</h1>\n",
+		"cell.tmpl":   "<h2>{{.Dataset}}</h2>\n{{range .Instances}}{{.Instance}} p90={{.Over.p90}}\n{{end}}{{.Sections.tag}}",
+	}
+	for name, content := range templates {
+		if err := ioutil.WriteFile(path.Join(dir, name), []byte(content), 0666); err != nil {
+			t.Fatal(err)
+		}
+	}
+	opt, err := cetest.DecodeOption(fmt.Sprintf(`
+query-types = ["single-col-point-query-on-col"]
+report-dir = %q
+
+[[datasets]]
+name = "zipfx"
+label = "zipfx"
+
+[[instances]]
+label = "v4.0"
+
+[report-templates]
+header = %q
+cell = %q
+`, dir, path.Join(dir, "header.tmpl"), path.Join(dir, "cell.tmpl")))
+	if err != nil {
+		t.Fatal(err)
+	}
+	collector := cetest.NewEstResultCollector(1, 1, 1)
+	collector.AddEstResult(0, 0, 0, cetest.EstResult{SQL: "q1", EstCard: 10, TrueCard: 5, Tags: []string{cetest.TagMCV}})
+	if err := cetest.GenPErrorBarChartsReport(opt, collector); err != nil {
+		t.Fatal(err)
+	}
+	md, err := ioutil.ReadFile(path.Join(dir, "report.md"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, s := range []string{"<h1>1 instances: single-col-point-query-on-col</h1>", "<h2>zipfx</h2>", "v4.0 p90=1.000", "| mcv | v4.0 | 1 |"} {
+		if !strings.Contains(string(md), s) {
+			t.Fatalf("%q is not in the report", s)
+		}
+	}
+	if strings.Contains(string(md), "OverEstimation Statistics") {
+		t.Fatal("default sections should be replaced")
+	}
+
+	if _, err := cetest.DecodeOption("[report-templates]\nheader = \"/not/exist.tmpl\"\n"); err == nil {
+		t.Fatal("missing templates should be rejected")
+	}
+}
+
+func TestNumberFormat(t *testing.T) {
+	dir, err := ioutil.TempDir("", "cetest-number-format")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	for _, c := range []struct {
+		format string
+		est    string
+		act    string
+	}{
+		{``, "1.2345678912e+06", "2.5"},
+		{`locale = "en"`, "1,234,567.8912", "2.5"},
+		{`locale = "de"
+significant-digits = 3`, "1.230.000", "2,5"},
+		{`thousands-separator = "'"
+scientific = true`, "1.2345678912e+06", "2.5"},
+	} {
+		opt, err := cetest.DecodeOption(fmt.Sprintf(`
+query-types = ["single-col-point-query-on-col"]
+report-dir = %q
+
+[[datasets]]
+name = "zipfx"
+label = "zipfx"
+
+[[instances]]
+label = "v4.0"
+
+[number-format]
+%v
+`, dir, c.format))
+		if err != nil {
+			t.Fatal(err)
+		}
+		collector := cetest.NewEstResultCollector(1, 1, 1)
+		collector.AddEstResult(0, 0, 0, cetest.EstResult{SQL: "q1", EstCard: 1234567.8912, TrueCard: 2.5})
+		if err := cetest.GenCellPages(opt, collector); err != nil {
+			t.Fatal(err)
+		}
+		page, err := ioutil.ReadFile(path.Join(dir, "cells", "single-col-point-query-on-col-zipfx-v4.0.md"))
+		if err != nil {
+			t.Fatal(err)
+		}
+		if s := fmt.Sprintf("| %v | %v |", c.est, c.act); !strings.Contains(string(page), s) {
+			t.Fatalf("%q is not in the page with %q", s, c.format)
+		}
+	}
+	if _, err := cetest.DecodeOption("[number-format]\nlocale = \"xx\"\n"); err == nil {
+		t.Fatal("unknown locales should be rejected")
+	}
+}
+
+func TestTrendReport(t *testing.T) {
+	dir, err := ioutil.TempDir("", "cetest-history")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	opt := cetest.Option{
+		QueryTypes: []cetest.QueryType{cetest.QTSingleColPointQueryOnCol},
+		Datasets:   []cetest.DatasetOpt{{Label: "zipfx"}},
+		Instances:  []tidb.Option{{Label: "nightly"}},
+		ReportDir:  dir,
+		History:    cetest.HistoryOpt{Dir: path.Join(dir, "history")},
+	}
+	begin := time.Date(2021, 1, 1, 0, 0, 0, 0, time.UTC)
+	for i := 0; i < 3; i++ {
+		collector := cetest.NewEstResultCollector(1, 1, 1)
+		collector.AddEstResult(0, 0, 0, cetest.EstResult{SQL: "q1", EstCard: float64(10 + i), TrueCard: 10})
+		if err := cetest.RecordRunHistory(opt, collector, begin.Add(time.Duration(i)*24*time.Hour)); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := cetest.GenTrendReport(opt); err != nil {
+		t.Fatal(err)
+	}
+	md, err := ioutil.ReadFile(path.Join(dir, "trend.md"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, s := range []string{"# Trends of 3 Runs", "## single-col-point-query-on-col / zipfx", "single-col-point-query-on-col-zipfx-trend.png"} {
+		if !strings.Contains(string(md), s) {
+			t.Fatalf("%q is not in the trend report", s)
+		}
+	}
+	if _, err := os.Stat(path.Join(dir, "single-col-point-query-on-col-zipfx-trend.png")); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestBisectOptionCheck(t *testing.T) {
+	opt := cetest.Option{
+		QueryTypes: []cetest.QueryType{cetest.QTSingleColPointQueryOnCol},
+		Datasets:   []cetest.DatasetOpt{{Name: "zipfx", Label: "zipfx"}},
+		Instances:  []tidb.Option{{Label: "v5.0"}, {Label: "v5.1"}},
+		Bisect:     cetest.BisectOpt{Dataset: "zipfx", QueryType: "single-col-point-query-on-col", Threshold: 1},
+	}
+	for _, c := range []func(opt *cetest.Option){
+		func(opt *cetest.Option) { opt.Instances = opt.Instances[:1] },
+		func(opt *cetest.Option) { opt.Bisect.Dataset = "imdb" },
+		func(opt *cetest.Option) { opt.Bisect.QueryType = "mul-cols-point-query-on-index" },
+		func(opt *cetest.Option) { opt.Bisect.Threshold = 0 },
+	} {
+		o := opt
+		c(&o)
+		if _, err := cetest.RunBisect(o); err == nil {
+			t.Fatalf("invalid bisect option %+v should be rejected", o.Bisect)
+		}
+	}
+}
+
+func TestPostIssue(t *testing.T) {
+	var got cetest.IssueDraft
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path != "/repos/pingcap/tidb/issues" || r.Header.Get("Authorization") != "token xxx" {
+			w.WriteHeader(http.StatusNotFound)
+			return
+		}
+		if err := json.NewDecoder(r.Body).Decode(&got); err != nil {
+			w.WriteHeader(http.StatusBadRequest)
+			return
+		}
+		w.WriteHeader(http.StatusCreated)
+		fmt.Fprint(w, `{"html_url": "https://github.com/pingcap/tidb/issues/1"}`)
+	}))
+	defer server.Close()
+
+	iopt := cetest.IssueOpt{Repo: "pingcap/tidb", Token: "xxx", API: server.URL}
+	draft := cetest.IssueDraft{Title: "planner: wrong estimation", Body: "body", Labels: []string{"sig/planner"}}
+	url, err := cetest.PostIssue(iopt, draft)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if url != "https://github.com/pingcap/tidb/issues/1" || got.Title != draft.Title || got.Labels[0] != "sig/planner" {
+		t.Fatalf("unexpected url=%v, draft=%+v", url, got)
+	}
+	iopt.Token = "yyy"
+	if _, err := cetest.PostIssue(iopt, draft); err == nil {
+		t.Fatal("failed posts should return errors")
+	}
+
+	var query string
+	search := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path != "/search/issues" || r.Header.Get("Authorization") != "token xxx" {
+			w.WriteHeader(http.StatusNotFound)
+			return
+		}
+		query = r.URL.Query().Get("q")
+		fmt.Fprint(w, `{"items": [{"html_url": "https://github.com/pingcap/tidb/issues/2", "body": "Marker: optimizer-tester-ab"},
+			{"html_url": "https://github.com/pingcap/tidb/issues/3", "body": "Marker: optimizer-tester-abcd"}]}`)
+	}))
+	defer search.Close()
+	iopt = cetest.IssueOpt{Repo: "pingcap/tidb", Token: "xxx", API: search.URL}
+	url, found, err := cetest.FindIssue(iopt, "optimizer-tester-abcd")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !found || url != "https://github.com/pingcap/tidb/issues/3" || query != `repo:pingcap/tidb is:issue is:open in:body "optimizer-tester-abcd"` {
+		t.Fatalf("unexpected url=%v, found=%v, query=%v", url, found, query)
+	}
+	if _, found, err := cetest.FindIssue(iopt, "optimizer-tester-ef"); err != nil || found {
+		t.Fatalf("issues without the marker should not be found, found=%v, err=%v", found, err)
+	}
+}
+
+func TestCorpus(t *testing.T) {
+	dir, err := ioutil.TempDir("", "cetest-corpus")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	c := cetest.Corpus{
+		Format:      "optimizer-tester-corpus",
+		Version:     cetest.CorpusVersion,
+		Dataset:     "zipfx",
+		Fingerprint: "abc",
+		CreatedAt:   time.Date(2021, 1, 1, 0, 0, 0, 0, time.UTC),
+		Cases:       []cetest.CorpusCase{{QueryType: "single-col-point-query-on-col", SQL: "SELECT * FROM t WHERE a = 1", TrueCard: 10, Tags: []string{cetest.TagMCV}}},
+	}
+	p := path.Join(dir, "zipfx.corpus.json")
+	if err := cetest.WriteCorpus(p, c); err != nil {
+		t.Fatal(err)
+	}
+	loaded, err := cetest.ReadCorpus(p)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if fmt.Sprintf("%+v", loaded) != fmt.Sprintf("%+v", c) {
+		t.Fatalf("corpus %+v is changed after loading", loaded)
+	}
+
+	c.Version = cetest.CorpusVersion + 1
+	if err := cetest.WriteCorpus(p, c); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := cetest.ReadCorpus(p); err == nil {
+		t.Fatal("corpora with newer versions should be rejected")
+	}
+	if _, err := cetest.DecodeOption("[rerun]\npath = \"a.csv\"\nworst = 0.1\n[corpus]\nload = [\"b.json\"]\n"); err == nil {
+		t.Fatal("corpus load and rerun should be rejected")
+	}
+
+	// runs without live instances, like imports of results, export no corpus
+	collector := cetest.NewEstResultCollector(0, 1, 1)
+	if err := cetest.ExportCorpora(cetest.Option{}, nil, nil, collector); err != nil {
+		t.Fatal(err)
+	}
+	if err := cetest.ExportCorpora(cetest.Option{Corpus: cetest.CorpusOpt{Export: path.Join(dir, "export")}}, nil, nil, collector); err == nil {
+		t.Fatal("corpus export without instances should be rejected")
+	}
+}
+
+func TestTraceExecutor(t *testing.T) {
+	ins, err := tidb.NewMockInstance(tidb.Option{Label: "mock"}, "v7.5.0", func(query string) ([]string, [][]string, error) {
+		switch {
+		case strings.HasPrefix(query, "EXPLAIN"):
+			return []string{"id", "estRows", "task", "access object", "operator info"}, [][]string{{"TableReader_7", "12", "root", "", ""}}, nil
+		case strings.HasPrefix(query, "TRACE"):
+			return []string{"operation", "startTS", "duration"}, [][]string{
+				{"trace", "10:00:00.000000", "2.1ms"},
+				{"  ├─session.ExecuteStmt", "10:00:00.000100", "1.9ms"},
+				{"  │ ├─executor.Compile", "10:00:00.000200", "1.5ms"},
+			}, nil
+		}
+		return nil, nil, nil
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer ins.Close()
+	opt, err := cetest.DecodeOption(`
+executor = "trace"
+[[datasets]]
+name = "mock"
+db = "mock"
+label = "mock"
+[datasets.mock]
+rows = 100
+ndv = 10
+`)
+	if err != nil {
+		t.Fatal(err)
+	}
+	ds, err := cetest.NewDataset(opt.Datasets[0])
+	if err != nil {
+		t.Fatal(err)
+	}
+	rs, err := ds.GenEstResults(ins, 10, cetest.QTSingleColPointQueryOnCol)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(rs) != 10 {
+		t.Fatalf("expect 10 results, got %v", len(rs))
+	}
+	for _, r := range rs {
+		if r.EstCard != 12 || r.PlanLatency != 1500*time.Microsecond {
+			t.Fatalf("unexpected result %+v", r)
+		}
+	}
+
+	if _, err := cetest.DecodeOption(`executor = "xxx"`); err == nil {
+		t.Fatal("unknown executors should be rejected")
+	}
+	if _, err := cetest.DecodeOption("read-only = true\nexecutor = \"explain-analyze\""); err == nil {
+		t.Fatal("executors running queries should be rejected in read-only mode")
+	}
+}
+
+func TestBudget(t *testing.T) {
+	var traced int32
+	ins, err := tidb.NewMockInstance(tidb.Option{Label: "mock"}, "v7.5.0", func(query string) ([]string, [][]string, error) {
+		switch {
+		case strings.HasPrefix(query, "EXPLAIN"):
+			return []string{"id", "estRows", "task", "access object", "operator info"}, [][]string{{"TableReader_7", "12", "root", "", ""}}, nil
+		case strings.HasPrefix(query, "TRACE"):
+			atomic.AddInt32(&traced, 1)
+			return []string{"operation", "startTS", "duration"}, [][]string{{"  │ ├─executor.Compile", "10:00:00.000200", "1.5ms"}}, nil
+		}
+		return nil, nil, nil
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer ins.Close()
+	opt, err := cetest.DecodeOption(`
+executor = "trace"
+concurrency = 1
+[budget]
+max-exec-time = "1ns"
+[[datasets]]
+name = "mock"
+db = "mock"
+label = "mock"
+[datasets.mock]
+rows = 100
+ndv = 10
+`)
+	if err != nil {
+		t.Fatal(err)
+	}
+	ds, err := cetest.NewDataset(opt.Datasets[0])
+	if err != nil {
+		t.Fatal(err)
+	}
+	rs, err := ds.GenEstResults(ins, 10, cetest.QTSingleColPointQueryOnCol)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(rs) != 10 || traced != 1 {
+		t.Fatalf("only the first case should be executed before the budget is used up, got %v results and %v traced", len(rs), traced)
+	}
+
+	for _, content := range []string{"[budget]\nmax-exec-time = \"xxx\"", "[budget]\nmax-scan-rows = -1.0"} {
+		if _, err := cetest.DecodeOption(content); err == nil {
+			t.Fatalf("content=%v should be rejected", content)
+		}
+	}
+}
+
+func TestAdaptiveSampling(t *testing.T) {
+	ins, err := tidb.NewMockInstance(tidb.Option{Label: "mock"}, "v7.5.0", func(query string) ([]string, [][]string, error) {
+		if strings.HasPrefix(query, "EXPLAIN") {
+			return []string{"id", "estRows", "task", "access object", "operator info"}, [][]string{{"TableReader_7", "12", "root", "", ""}}, nil
+		}
+		return nil, nil, nil
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer ins.Close()
+	opt, err := cetest.DecodeOption(`
+concurrency = 1
+[adaptive]
+precision = 10.0
+min-cases = 3
+[[datasets]]
+name = "mock"
+db = "mock"
+label = "mock"
+[datasets.mock]
+rows = 100
+ndv = 10
+`)
+	if err != nil {
+		t.Fatal(err)
+	}
+	ds, err := cetest.NewDataset(opt.Datasets[0])
+	if err != nil {
+		t.Fatal(err)
+	}
+	rs, err := ds.GenEstResults(ins, 10, cetest.QTSingleColPointQueryOnCol)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(rs) != 3 {
+		t.Fatalf("the cell with a loose precision should stop after min-cases, got %v results", len(rs))
+	}
+
+	for _, content := range []string{"[adaptive]\nprecision = -0.1", "[adaptive]\nconfidence = 1.0", "[adaptive]\nmin-cases = -1"} {
+		if _, err := cetest.DecodeOption(content); err == nil {
+			t.Fatalf("content=%v should be rejected", content)
+		}
+	}
+}
+
+func TestImportanceSampling(t *testing.T) {
+	highErr := regexp.MustCompile(`c0=\d AND`) // values of c0 in [0, 10), which are in the first region
+	ins, err := tidb.NewMockInstance(tidb.Option{Label: "mock"}, "v7.5.0", func(query string) ([]string, [][]string, error) {
+		if strings.HasPrefix(query, "EXPLAIN") {
+			estRows := "1"
+			if highErr.MatchString(query) {
+				estRows = "10000"
+			}
+			return []string{"id", "estRows", "task", "access object", "operator info"}, [][]string{{"IndexReader_7", estRows, "root", "", ""}}, nil
+		}
+		return nil, nil, nil
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer ins.Close()
+	opt, err := cetest.DecodeOption(`
+concurrency = 1
+[adaptive]
+importance = 0.5
+[[datasets]]
+name = "mock"
+db = "mock"
+label = "mock"
+[datasets.mock]
+rows = 1000
+ndv = 100
+`)
+	if err != nil {
+		t.Fatal(err)
+	}
+	ds, err := cetest.NewDataset(opt.Datasets[0])
+	if err != nil {
+		t.Fatal(err)
+	}
+	rs, err := ds.GenEstResults(ins, 200, cetest.QTMulColsPointQueryOnIndex)
+	if err != nil {
+		t.Fatal(err)
+	}
+	sqls := make(map[string]bool)
+	var uniform, biased, uniformHigh, biasedHigh int
+	for _, r := range rs {
+		if sqls[r.SQL] {
+			t.Fatalf("case %v is visited twice", r.SQL)
+		}
+		sqls[r.SQL] = true
+		high := highErr.MatchString(r.SQL)
+		if r.HasTag(cetest.TagImportanceSampled) {
+			biased++
+			if high {
+				biasedHigh++
+			}
+		} else {
+			uniform++
+			if high {
+				uniformHigh++
+			}
+		}
+	}
+	if uniform == 0 || biased == 0 {
+		t.Fatalf("both passes should visit cases, got uniform=%v, biased=%v", uniform, biased)
+	}
+	if biasedHigh*2 < biased || uniformHigh*3 > uniform {
+		t.Fatalf("the biased pass should focus on the high-error region, got %v/%v high-error cases in the biased pass and %v/%v in the uniform one",
+			biasedHigh, biased, uniformHigh, uniform)
+	}
+
+	for _, content := range []string{"[adaptive]\nimportance = 1.0", "[adaptive]\nregions = -1"} {
+		if _, err := cetest.DecodeOption(content); err == nil {
+			t.Fatalf("content=%v should be rejected", content)
+		}
+	}
+}
+
+func TestFailedCases(t *testing.T) {
+	ins, err := tidb.NewMockInstance(tidb.Option{Label: "mock"}, "v7.5.0", func(query string) ([]string, [][]string, error) {
+		if strings.HasPrefix(query, "EXPLAIN") {
+			if strings.HasSuffix(query, "c1=1") {
+				return nil, nil, fmt.Errorf("mock failure")
+			} else if strings.HasSuffix(query, "c1=2") {
+				return nil, nil, fmt.Errorf("Error 1064: You have an error in your SQL syntax")
+			}
+			return []string{"id", "estRows", "task", "access object", "operator info"}, [][]string{{"TableReader_7", "12", "root", "", ""}}, nil
+		}
+		return nil, nil, nil
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer ins.Close()
+	opt, err := cetest.DecodeOption(`
+concurrency = 1
+report-dir = "./test"
+[[datasets]]
+name = "mock"
+db = "mock"
+label = "mock"
+args = ["error=ignore"]
+[datasets.mock]
+rows = 100
+ndv = 10
+`)
+	if err != nil {
+		t.Fatal(err)
+	}
+	ds, err := cetest.NewDataset(opt.Datasets[0])
+	if err != nil {
+		t.Fatal(err)
+	}
+	rs, err := ds.GenEstResults(ins, 10, cetest.QTSingleColPointQueryOnCol)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(rs) != 8 || rs[0].Operator != "TableReader_7" || rs[0].ErrKind != "" {
+		t.Fatalf("unexpected results %+v", rs)
+	}
+	kinds := make(map[string]cetest.ErrorKind)
+	for _, r := range opt.FailedCases("mock") {
+		kinds[r.SQL[len(r.SQL)-4:]] = r.ErrKind
+		if r.Err == "" {
+			t.Fatalf("no error message of %v", r.SQL)
+		}
+	}
+	if len(kinds) != 2 || kinds["c1=1"] != cetest.ErrKindExecute || kinds["c1=2"] != cetest.ErrKindSyntax {
+		t.Fatalf("unexpected kinds of failed cases %v", kinds)
+	}
+	opt.Instances = []tidb.Option{{Label: "mock"}}
+	if err := cetest.GenPErrorBarChartsReport(opt, cetest.NewEstResultCollector(1, 1, 0)); err != nil {
+		t.Fatal(err)
+	}
+	md, err := ioutil.ReadFile(path.Join(opt.ReportDir, "report.md"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if s := "| mock | 2 | syntax=1, execute=1 |"; !strings.Contains(string(md), s) {
+		t.Fatalf("%q is not in the report", s)
+	}
+	if kind := cetest.ErrorKindOf(&cetest.CaseError{Kind: cetest.ErrKindTruthMismatch}); kind != cetest.ErrKindTruthMismatch {
+		t.Fatalf("unexpected kind %v", kind)
+	}
+}
+
+func TestLintSQL(t *testing.T) {
+	for sql, valid := range map[string]bool{
+		"SELECT * FROM db.t WHERE a=1":                                          true,
+		"SELECT * FROM db.t WHERE a='it''s' AND b='a\\'b'":                      true,
+		"SELECT * FROM db.t WHERE a IN (1, 2) AND b LIKE 'x%'":                  true,
+		"SELECT * FROM db.t t1 WHERE EXISTS (SELECT /*+ NO_DECORRELATE() */ 1)": true,
+		"WITH RECURSIVE sub AS (SELECT 1) SELECT * FROM sub":                    true,
+		"SELECT * FROM db.t WHERE a <=> NULL":                                   true,
+		"SELECT * FROM db.t WHERE a='it's'":                                     false,
+		"SELECT * FROM db.t WHERE a=":                                           false,
+		"SELECT * FROM db.t WHERE a= AND b=1":                                   false,
+		"SELECT * FROM db.t WHERE a=%!v(MISSING)":                               false,
+		"SELECT * FROM db.t WHERE a IN ()":                                      false,
+		"SELECT * FROM db.t WHERE (a=1":                                         false,
+		"SELECT * FROM db.t WHERE a=1 AND":                                      false,
+		"SELECT * FROM .t WHERE a=1":                                            false,
+		"DELETE FROM db.t":                                                      false,
+		"SELECT * FROM db.t WHERE a=1 /* unterminated":                          false,
+	} {
+		if err := cetest.LintSQL(sql); (err == nil) != valid {
+			t.Fatalf("sql=%v, expected valid=%v, err=%v", sql, valid, err)
+		}
+	}
+
+	ins, err := tidb.NewMockInstance(tidb.Option{Label: "mock"}, "v7.5.0", func(query string) ([]string, [][]string, error) {
+		if strings.HasPrefix(query, "EXPLAIN") {
+			return []string{"id", "estRows", "task", "access object", "operator info"}, [][]string{{"TableReader_7", "12", "root", "", ""}}, nil
+		}
+		return nil, nil, nil
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer ins.Close()
+	opt, err := cetest.DecodeOption(`
+lint = true
+report-dir = "./test"
+[[datasets]]
+name = "mock"
+db = "mock"
+label = "mock"
+[datasets.mock]
+rows = 100
+ndv = 10
+`)
+	if err != nil {
+		t.Fatal(err)
+	}
+	ds, err := cetest.NewDataset(opt.Datasets[0])
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := ds.GenEstResults(ins, 10, cetest.QTSingleColPointQueryOnCol); err != nil {
+		t.Fatal(err)
+	}
+	if err := cetest.GenPErrorBarChartsReport(opt, cetest.NewEstResultCollector(0, 1, 0)); err != nil {
+		t.Fatal(err)
+	}
+	md, err := ioutil.ReadFile(path.Join(opt.ReportDir, "report.md"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if s := "| mock | 10 | 0 | 0.00% | - |"; !strings.Contains(string(md), s) {
+		t.Fatalf("%q is not in the report", s)
+	}
+}
+
+func TestQuoteString(t *testing.T) {
+	corpus := []string{"", "abc", "'", "''", "\\", "\\'", "a'b\\c", "\x00", "\n\r\x1a", "😀", "'😀\\", "中文", "\xff", "a\xfe'"}
+	for _, s := range corpus {
+		lit := cetest.QuoteString(s)
+		if v, ok := cetest.UnquoteString(lit); !ok || v != s {
+			t.Fatalf("%q is quoted as %v, unquoted as %q", s, lit, v)
+		}
+		if err := cetest.LintSQL("SELECT * FROM db.t WHERE c=" + lit); err != nil {
+			t.Fatalf("%q is quoted as %v: %v", s, lit, err)
+		}
+	}
+	if lit := cetest.QuoteString("a'b\\"); lit != `'a''b\\'` {
+		t.Fatalf("unexpected literal %v", lit)
+	}
+	if lit := cetest.QuoteString("\xff"); lit != "X'ff'" {
+		t.Fatalf("unexpected literal %v", lit)
+	}
+	if lit := cetest.QuoteLikePrefix(`a%_\`); lit != `'a\\%\\_\\\\%'` {
+		t.Fatalf("unexpected pattern %v", lit)
+	}
+	if _, ok := cetest.UnquoteString("'a'b'"); ok {
+		t.Fatalf("unquoted an invalid literal")
+	}
+
+	roundTrip := func(s string) bool {
+		lit := cetest.QuoteString(s)
+		v, ok := cetest.UnquoteString(lit)
+		return ok && v == s && cetest.LintSQL("SELECT * FROM db.t WHERE c="+lit) == nil
+	}
+	if err := quick.Check(roundTrip, &quick.Config{MaxCount: 2000}); err != nil {
+		t.Fatal(err)
+	}
+	bytesRoundTrip := func(b []byte) bool { return roundTrip(string(b)) }
+	if err := quick.Check(bytesRoundTrip, &quick.Config{MaxCount: 2000}); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestReportOrder(t *testing.T) {
+	opt := cetest.Option{
+		QueryTypes: []cetest.QueryType{cetest.QTSingleColInQueryOnCol, cetest.QTSingleColPointQueryOnCol},
+		Datasets:   []cetest.DatasetOpt{{Label: "y"}, {Label: "x"}},
+		Instances:  []tidb.Option{{Label: "b"}, {Label: "a"}},
+		ReportDir:  "./test",
+	}
+	collector := cetest.NewEstResultCollector(2, 2, 2)
+	collector.AddEstResult(0, 1, 1, cetest.EstResult{SQL: "q1", EstCard: 10, TrueCard: 5}) // b, x, point
+	report := func() string {
+		if err := cetest.GenPErrorBarChartsReport(opt, collector); err != nil {
+			t.Fatal(err)
+		}
+		md, err := ioutil.ReadFile(path.Join(opt.ReportDir, "report.md"))
+		if err != nil {
+			t.Fatal(err)
+		}
+		return string(md)
+	}
+	inOrder := func(md string, ss ...string) {
+		rest := md
+		for _, s := range ss {
+			idx := strings.Index(rest, s)
+			if idx < 0 {
+				t.Fatalf("%q is not in order %v", s, ss)
+			}
+			rest = rest[idx+len(s):]
+		}
+	}
+
+	md := report()
+	inOrder(md, "| a |", "| b |", "# single-col-point-query-on-col", "## x", "| a | 0 |", "| b | 1 |", "## y", "# single-col-in-query-on-col")
+	if md != report() {
+		t.Fatal("reports of the same results are different")
+	}
+
+	opt.ReportOrder = cetest.ReportOrderOpt{Instances: []string{"b"}, QueryTypes: []string{"single-col-in-query-on-col"}}
+	inOrder(report(), "| b |", "| a |", "# single-col-in-query-on-col", "## x", "## y", "# single-col-point-query-on-col", "## x", "| b | 1 |", "| a | 0 |")
+
+	conf := `
+query-types = ["single-col-point-query-on-col"]
+[[instances]]
+label = "a"
+[report-order]
+instances = ["c"]`
+	if _, err := cetest.DecodeOption(conf); err == nil || !strings.Contains(err.Error(), "unknown instance=c") {
+		t.Fatalf("unexpected error %v", err)
+	}
+}
+
+func TestErrorLatencyChart(t *testing.T) {
+	opt := cetest.Option{
+		QueryTypes:         []cetest.QueryType{cetest.QTSingleColPointQueryOnCol, cetest.QTSingleColInQueryOnCol},
+		Datasets:           []cetest.DatasetOpt{{Label: "zipfx"}},
+		Instances:          []tidb.Option{{Label: "v4.0"}, {Label: "v5.0"}},
+		ReportDir:          "./test",
+		CollectPlanLatency: true,
+	}
+	collector := cetest.NewEstResultCollector(2, 1, 2)
+	for i := 1; i <= 10; i++ {
+		collector.AddEstResult(0, 0, 0, cetest.EstResult{EstCard: 20, TrueCard: 10, PlanLatency: time.Millisecond})
+		collector.AddEstResult(1, 0, 0, cetest.EstResult{EstCard: 11, TrueCard: 10, PlanLatency: 2 * time.Millisecond})
+		collector.AddEstResult(0, 0, 1, cetest.EstResult{EstCard: 20, TrueCard: 10})
+	}
+	if err := cetest.GenPErrorBarChartsReport(opt, collector); err != nil {
+		t.Fatal(err)
+	}
+	md, err := ioutil.ReadFile(path.Join(opt.ReportDir, "report.md"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	chart := "single-col-point-query-on-col-zipfx-latency.png"
+	if !strings.Contains(string(md), "![latency]("+chart+")") {
+		t.Fatal("no chart of errors and latencies in the report")
+	}
+	if _, err := os.Stat(path.Join(opt.ReportDir, chart)); err != nil {
+		t.Fatal(err)
+	}
+	if strings.Contains(string(md), "single-col-in-query-on-col-zipfx-latency") {
+		t.Fatal("chart of a cell without latencies is drawn")
+	}
+}
+
+func TestConfigDiff(t *testing.T) {
+	dir, err := ioutil.TempDir("", "cetest-history")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	opt := cetest.Option{
+		QueryTypes: []cetest.QueryType{cetest.QTSingleColPointQueryOnCol},
+		Datasets:   []cetest.DatasetOpt{{Name: "zipfx", Label: "zipfx", Setup: []string{"SET tidb_opt_fix_control='44262:ON'"}}},
+		Instances:  []tidb.Option{{Label: "nightly"}},
+		NSamples:   100,
+		ReportDir:  dir,
+		History:    cetest.HistoryOpt{Dir: path.Join(dir, "history")},
+	}
+	collector := cetest.NewEstResultCollector(1, 1, 1)
+	collector.AddEstResult(0, 0, 0, cetest.EstResult{SQL: "q1", EstCard: 10, TrueCard: 10})
+	report := func() string {
+		if err := cetest.GenPErrorBarChartsReport(opt, collector); err != nil {
+			t.Fatal(err)
+		}
+		md, err := ioutil.ReadFile(path.Join(dir, "report.md"))
+		if err != nil {
+			t.Fatal(err)
+		}
+		return string(md)
+	}
+	if strings.Contains(report(), "# Config Diff") {
+		t.Fatal("config diff without previous runs")
+	}
+	if err := cetest.RecordRunHistory(opt, collector, time.Now().Add(-time.Hour)); err != nil {
+		t.Fatal(err)
+	}
+	if md := report(); !strings.Contains(md, "The effective configuration is the same as the previous run") {
+		t.Fatalf("unexpected report %v", md)
+	}
+
+	opt.NSamples = 200
+	opt.Datasets[0].Setup = nil
+	opt.Instances[0].MPP = true
+	md := report()
+	for _, s := range []string{"| n-samples | `100` | `200` |", "| dataset.zipfx.setup | `SET tidb_opt_fix_control='44262:ON'` | \"\" |",
+		"| instance.nightly.mpp | `false` | `true` |"} {
+		if !strings.Contains(md, s) {
+			t.Fatalf("%q is not in the report", s)
+		}
+	}
+	if strings.Contains(md, "| dataset.zipfx.db |") {
+		t.Fatal("unchanged parameters are in the config diff")
+	}
+}
+
+func TestProvenance(t *testing.T) {
+	dir, err := ioutil.TempDir("", "cetest-provenance")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	opt := cetest.Option{
+		QueryTypes:    []cetest.QueryType{cetest.QTSingleColPointQueryOnCol},
+		Datasets:      []cetest.DatasetOpt{{Label: "zipfx"}},
+		Instances:     []tidb.Option{{Label: "v4.0"}, {Label: "v5.0"}},
+		ReportDir:     dir,
+		ExportFormats: []string{"bin", "json"},
+	}
+	collector := cetest.NewEstResultCollector(2, 1, 1)
+	collector.AddEstResult(0, 0, 0, cetest.EstResult{SQL: "q1", EstCard: 10, TrueCard: 3})
+	collector.AddEstResult(1, 0, 0, cetest.EstResult{SQL: "q1", EstCard: 1.0 / 3, TrueCard: 3})
+	if err := cetest.GenPErrorBarChartsReport(opt, collector); err != nil {
+		t.Fatal(err)
+	}
+	if err := cetest.ExportRawResults(opt, collector); err != nil {
+		t.Fatal(err)
+	}
+	p, err := cetest.VerifyProvenance(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	md, err := ioutil.ReadFile(path.Join(dir, "report.md"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if p.Results != 2 || !strings.Contains(string(md), fmt.Sprintf("2 raw results: `%v`", p.Head)) {
+		t.Fatalf("unexpected provenance %+v", p)
+	}
+
+	// verified by the json format once the binary one is removed, and any modification is detected
+	if err := os.Remove(path.Join(dir, "results.bin")); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := cetest.VerifyProvenance(dir); err != nil {
+		t.Fatal(err)
+	}
+	results, err := ioutil.ReadFile(path.Join(dir, "results.json"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	modified := strings.Replace(string(results), `"est_card":10`, `"est_card":3`, 1)
+	if err := ioutil.WriteFile(path.Join(dir, "results.json"), []byte(modified), 0666); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := cetest.VerifyProvenance(dir); err == nil || !strings.Contains(err.Error(), "results are modified") {
+		t.Fatalf("unexpected error %v", err)
+	}
+}
+
+func TestReporters(t *testing.T) {
+	dir, err := ioutil.TempDir("", "cetest-reporters")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	opt := cetest.Option{
+		QueryTypes: []cetest.QueryType{cetest.QTSingleColPointQueryOnCol},
+		Datasets:   []cetest.DatasetOpt{{Label: "zipfx"}},
+		Instances:  []tidb.Option{{Label: "v4.0"}, {Label: "v5.0"}, {Label: "v6.0"}},
+		ReportDir:  dir,
+		Reporters:  []string{"markdown", "charts", "json", "junit", "html"},
+		JUnit:      cetest.JUnitOpt{MaxP90: 1},
+	}
+	collector := cetest.NewEstResultCollector(3, 1, 1)
+	collector.AddEstResult(0, 0, 0, cetest.EstResult{SQL: "q1", EstCard: 30, TrueCard: 10})
+	collector.AddEstResult(1, 0, 0, cetest.EstResult{SQL: "q1", EstCard: 12, TrueCard: 10})
+	if err := cetest.GenReports(opt, collector); err != nil {
+		t.Fatal(err)
+	}
+	read := func(name string) string {
+		content, err := ioutil.ReadFile(path.Join(dir, name))
+		if err != nil {
+			t.Fatal(err)
+		}
+		return string(content)
+	}
+
+	var report cetest.JSONReport
+	if err := json.Unmarshal([]byte(read("report.json")), &report); err != nil {
+		t.Fatal(err)
+	}
+	if len(report.Instances) != 3 || len(report.Cells) != 2 || report.Cells[0].Instance != "v4.0" || report.Cells[0].P90 != 2 {
+		t.Fatalf("unexpected json report %+v", report)
+	}
+	for name, ss := range map[string][]string{
+		"report.md":   {"# single-col-point-query-on-col", "single-col-point-query-on-col-zipfx-bar.png"},
+		"report.xml":  {`<testsuite name="single-col-point-query-on-col" tests="3" failures="1" skipped="1">`, `<failure message="p90 of absolute PErrors 2.000 exceeds 1">`, `<skipped message="no results">`},
+		"report.html": {`<img src="single-col-point-query-on-col-zipfx-bar.png"`, "<td>v5.0</td><td>1</td><td>0.200</td>"},
+	} {
+		content := read(name)
+		for _, s := range ss {
+			if !strings.Contains(content, s) {
+				t.Fatalf("%q is not in %v", s, name)
+			}
+		}
+	}
+	if _, err := os.Stat(path.Join(dir, "single-col-point-query-on-col-box-plot.png")); err != nil {
+		t.Fatal(err)
+	}
+
+	conf := `
+query-types = ["single-col-point-query-on-col"]
+reporters = ["pdf"]`
+	if _, err := cetest.DecodeOption(conf); err == nil || !strings.Contains(err.Error(), "unknown reporter=pdf") {
+		t.Fatalf("unexpected error %v", err)
+	}
+}
+
+func TestEstimateRecheck(t *testing.T) {
+	var explained int32
+	ins, err := tidb.NewMockInstance(tidb.Option{Label: "mock"}, "v7.5.0", func(query string) ([]string, [][]string, error) {
+		if strings.HasPrefix(query, "EXPLAIN") {
+			est := "12"
+			if strings.HasSuffix(query, "c1=3") && atomic.AddInt32(&explained, 1) > 1 {
+				est = "20" // statistics are loaded after the first EXPLAIN
+			}
+			return []string{"id", "estRows", "task", "access object", "operator info"}, [][]string{{"TableReader_7", est, "root", "", ""}}, nil
+		}
+		return nil, nil, nil
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer ins.Close()
+	opt, err := cetest.DecodeOption(`
+query-types = ["single-col-point-query-on-col"]
+report-dir = "./test"
+[[instances]]
+label = "mock"
+[[datasets]]
+name = "mock"
+db = "mock"
+label = "mock"
+[datasets.mock]
+rows = 100
+ndv = 10
+[estimate-recheck]
+enabled = true
+interval = "1ms"
+`)
+	if err != nil {
+		t.Fatal(err)
+	}
+	ds, err := cetest.NewDataset(opt.Datasets[0])
+	if err != nil {
+		t.Fatal(err)
+	}
+	rs, err := ds.GenEstResults(ins, 10, cetest.QTSingleColPointQueryOnCol)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var unstable []cetest.EstResult
+	for _, r := range rs {
+		if r.HasTag(cetest.TagUnstableEstimate) {
+			unstable = append(unstable, r)
+		}
+	}
+	if len(rs) != 10 || len(unstable) != 1 || unstable[0].EstCard != 12 || unstable[0].RecheckEstCard != 20 {
+		t.Fatalf("unexpected unstable cases %+v", unstable)
+	}
+
+	collector := cetest.NewEstResultCollector(1, 1, 1)
+	collector.AppendEstResults(0, 0, 0, rs)
+	if err := cetest.GenPErrorBarChartsReport(opt, collector); err != nil {
+		t.Fatal(err)
+	}
+	md, err := ioutil.ReadFile(path.Join(opt.ReportDir, "report.md"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if s := "| mock | 10 | 1 | `SELECT * FROM mock.tmock0 WHERE c1=3`: 12 => 20 |"; !strings.Contains(string(md), s) {
+		t.Fatalf("%q is not in the report", s)
+	}
+	if _, err := cetest.DecodeOption("[estimate-recheck]\nenabled = true\ninterval = \"soon\""); err == nil {
+		t.Fatalf("invalid interval should be rejected")
+	}
+}
+
+func TestWriteLoad(t *testing.T) {
+	ins, err := tidb.NewMockInstance(tidb.Option{Label: "mock"}, "v7.5.0", func(query string) ([]string, [][]string, error) {
+		if strings.HasPrefix(query, "EXPLAIN") {
+			return []string{"id", "estRows", "task", "access object", "operator info"}, [][]string{{"TableReader_7", "12", "root", "", ""}}, nil
+		}
+		if strings.HasPrefix(query, "SELECT COUNT(*)") {
+			return []string{"COUNT(*)"}, [][]string{{"1000"}}, nil // rows are inserted during the run
+		}
+		return nil, nil, nil
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer ins.Close()
+	conf := `
+query-types = ["single-col-point-query-on-col"]
+report-dir = "./test"
+executor = "count-verify"
+[[instances]]
+label = "mock"
+[[datasets]]
+name = "mock"
+db = "mock"
+label = "mock"
+[datasets.mock]
+rows = 100
+ndv = 10
+[datasets.scratch]
+db = "mock_scratch"
+`
+	opt, err := cetest.DecodeOption(conf + "[write-load]\ninserts = 10\n")
+	if err != nil {
+		t.Fatal(err)
+	}
+	ds, err := cetest.NewDataset(opt.Datasets[0])
+	if err != nil {
+		t.Fatal(err)
+	}
+	rs, err := ds.GenEstResults(ins, 10, cetest.QTSingleColPointQueryOnCol)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(rs) != 10 {
+		t.Fatalf("mismatched true cardinalities should be accepted under the write load, got %v cases", len(rs))
+	}
+	for _, r := range rs {
+		if !r.HasTag(cetest.TagChurned) || r.TrueCard != 1000 || r.CalcTrueCard > 100 {
+			t.Fatalf("the churned case should be compared against the measured true cardinality, got %+v", r)
+		}
+	}
+
+	collector := cetest.NewEstResultCollector(1, 1, 1)
+	collector.AppendEstResults(0, 0, 0, rs)
+	if err := cetest.GenPErrorBarChartsReport(opt, collector); err != nil {
+		t.Fatal(err)
+	}
+	md, err := ioutil.ReadFile(path.Join(opt.ReportDir, "report.md"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, s := range []string{"# Write Load", "| mock | 10 | 10 | 82.333 |"} {
+		if !strings.Contains(string(md), s) {
+			t.Fatalf("%q is not in the report", s)
+		}
+	}
+
+	for content, valid := range map[string]bool{
+		"executor = \"explain-analyze\"\n[write-load]\nupdates = 100":                   true,
+		"executor = \"explain-analyze\"\n[write-load]\ninserts = -1":                    false,
+		"executor = \"explain-analyze\"\n[write-load]\ninserts = 1\ntables = [\"t\"]":   false,
+		"[write-load]\ninserts = 1":                                                     false,
+		"executor = \"explain-analyze\"\nread-only = true\n[write-load]\ninserts = 1":   false,
+		"executor = \"explain-analyze\"\nsnapshot = \"now\"\n[write-load]\ninserts = 1": false,
+	} {
+		if _, err := cetest.DecodeOption(content); (err == nil) != valid {
+			t.Fatalf("content=%v, err=%v", content, err)
+		}
+	}
+	for content, valid := range map[string]bool{
+		"[write-load]\ninserts = 1":                                                  true,
+		"[write-load]\ninserts = 1\ntables = [\"mock_scratch.t\"]":                   true,
+		"[write-load]\ninserts = 1\ntables = [\"mock.t\"]":                           false,
+		"[write-load]\ninserts = 1\n[[datasets]]\nlabel = \"other\"\ndb = \"other\"": false,
+	} {
+		content = strings.Replace(conf, "count-verify", "explain-analyze", 1) + content
+		if _, err := cetest.DecodeOption(content); (err == nil) != valid {
+			t.Fatalf("content=%v, err=%v", content, err)
+		}
+	}
+}
+
+func TestExecutionSkew(t *testing.T) {
+	conf := `
+query-types = ["single-col-point-query-on-col"]
+report-dir = "./test"
+concurrency = 1
+[[instances]]
+label = "fast"
+[[instances]]
+label = "slow"
+[[datasets]]
+name = "mock"
+db = "mock"
+label = "mock"
+[datasets.mock]
+rows = 100
+ndv = 10
+`
+	opt, err := cetest.DecodeOption(conf)
+	if err != nil {
+		t.Fatal(err)
+	}
+	ds, err := cetest.NewDataset(opt.Datasets[0])
+	if err != nil {
+		t.Fatal(err)
+	}
+	collector := cetest.NewEstResultCollector(2, 1, 1)
+	for insIdx, delay := range []time.Duration{0, 5 * time.Millisecond} {
+		delay := delay
+		ins, err := tidb.NewMockInstance(opt.Instances[insIdx], "v7.5.0", func(query string) ([]string, [][]string, error) {
+			if strings.HasPrefix(query, "EXPLAIN") {
+				time.Sleep(delay)
+				return []string{"id", "estRows", "task", "access object", "operator info"}, [][]string{{"TableReader_7", "12", "root", "", ""}}, nil
+			}
+			return nil, nil, nil
+		})
+		if err != nil {
+			t.Fatal(err)
+		}
+		rs, err := ds.GenEstResults(ins, 10, cetest.QTSingleColPointQueryOnCol)
+		ins.Close()
+		if err != nil {
+			t.Fatal(err)
+		}
+		collector.AppendEstResults(insIdx, 0, 0, rs)
+	}
+	if err := cetest.GenPErrorBarChartsReport(opt, collector); err != nil {
+		t.Fatal(err)
+	}
+	md, err := ioutil.ReadFile(path.Join(opt.ReportDir, "report.md"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, s := range []string{"# Execution Skew", "| Dataset | Query Type | fast | slow | Skew |", "| mock | single-col-point-query-on-col |", "| **Overall** |", "⚠"} {
+		if !strings.Contains(string(md), s) {
+			t.Fatalf("%q is not in the report", s)
+		}
+	}
+	if !regexp.MustCompile(`\| \*\*Overall\*\* \|  \| [^*|]+ \| \*\*[^|]+\*\* \| ⚠ `).Match(md) {
+		t.Fatalf("the slow instance should be highlighted in total, got %s", md)
+	}
+}
+
+func TestStmtSummary(t *testing.T) {
+	for sql, digestText := range map[string]string{
+		"SELECT * FROM db.t WHERE a=1":                        "select * from `db` . `t` where `a` = ?",
+		"SELECT * FROM db.t WHERE a IN (1, 2, 3) AND b='x'":   "select * from `db` . `t` where `a` in ( ... ) and `b` = ?",
+		"EXPLAIN ANALYZE SELECT * FROM db.t1 WHERE a>-1.5e3":  "select * from `db` . `t1` where `a` > - ?",
+		"SELECT /*+ USE_INDEX(t, a) */ * FROM db.t WHERE a=1": "select * from `db` . `t` where `a` = ?",
+		"explain format='brief' select * from db.t where a=1": "explain format = ? select * from `db` . `t` where `a` = ?",
+	} {
+		if a, b := cetest.NormalizeDigestText(sql), cetest.NormalizeDigestText(digestText); a != b {
+			t.Fatalf("%v is normalized into %v, but %v is normalized into %v", sql, a, digestText, b)
+		}
+	}
+	if cetest.NormalizeDigestText("SELECT * FROM db.t WHERE a=1") == cetest.NormalizeDigestText("SELECT * FROM db.t WHERE b=1") {
+		t.Fatalf("statements on different columns should not be normalized into the same form")
+	}
+
+	fp := "IndexLookUp(IndexRangeScan{table:t, index:a(a)},TableRowIDScan{table:t})"
+	if d := cetest.PlanDigest(fp); len(d) != 64 || d != cetest.PlanDigest(fp) || d == cetest.PlanDigest("TableReader(TableFullScan{table:t})") {
+		t.Fatalf("unexpected plan digest %v", d)
+	}
+	if cetest.PlanDigest("") != "" {
+		t.Fatalf("unknown plans should have no digest")
+	}
+
+	opt, err := cetest.DecodeOption(`
+query-types = ["single-col-point-query-on-col"]
+report-dir = "./test"
+export-formats = ["csv"]
+[[instances]]
+label = "mock"
+[[datasets]]
+name = "mock"
+label = "mock"
+[statements-summary]
+enabled = true
+`)
+	if err != nil {
+		t.Fatal(err)
+	}
+	collector := cetest.NewEstResultCollector(1, 1, 1)
+	for i := 0; i < 4; i++ {
+		r := cetest.EstResult{SQL: fmt.Sprintf("SELECT * FROM db.t WHERE a=%v", i), EstCard: 1, TrueCard: 1, PlanDigest: cetest.PlanDigest(fp)}
+		if i < 3 {
+			r.StmtDigest, r.StmtPlanDigest = "sd", fmt.Sprintf("pd%v", i%2)
+		}
+		collector.AddEstResult(0, 0, 0, r)
+	}
+	if err := cetest.GenPErrorBarChartsReport(opt, collector); err != nil {
+		t.Fatal(err)
+	}
+	md, err := ioutil.ReadFile(path.Join(opt.ReportDir, "report.md"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !strings.Contains(string(md), "| mock | 4 | 3 | 1 | 2 | 1 |") {
+		t.Fatalf("cross-references are not in the report")
+	}
+	if err := cetest.ExportRawResults(opt, collector); err != nil {
+		t.Fatal(err)
+	}
+	content, err := ioutil.ReadFile(path.Join(opt.ReportDir, "results.csv"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !strings.Contains(string(content), "stmt_plan_digest") || !strings.Contains(string(content), cetest.PlanDigest(fp)+",sd,pd1") {
+		t.Fatalf("digests are not exported")
+	}
+}
+
+func TestServerless(t *testing.T) {
+	for sql, what := range map[string]string{
+		"SELECT * FROM db.t WHERE a=1":                                "",
+		"SET GLOBAL tidb_analyze_version = 2":                         "SET GLOBAL",
+		"set @@global.tidb_enable_extended_stats = ON":                "SET GLOBAL",
+		"SELECT @@GLOBAL.tidb_enable_extended_stats":                  "",
+		"SELECT * FROM INFORMATION_SCHEMA.CLUSTER_STATEMENTS_SUMMARY": "CLUSTER_ tables",
+		"SELECT * FROM INFORMATION_SCHEMA.STATEMENTS_SUMMARY":         "",
+		"SELECT * FROM db.t WHERE a='information_schema.cluster_x'":   "",
+		"PLAN REPLAYER DUMP EXPLAIN SELECT * FROM db.t":               "PLAN REPLAYER",
+		"/* SET GLOBAL x = 1 */ SELECT 1":                             "",
+	} {
+		if w := tidb.UnsupportedOnServerless(sql); w != what {
+			t.Fatalf("sql=%v, expected %q, got %q", sql, what, w)
+		}
+	}
+
+	for addr, endpoint := range map[string]string{
+		"127.0.0.1": "127.0.0.1:4000",
+		"::1":       "[::1]:4000",
+		"gateway01.us-west-2.prod.aws.tidbcloud.com:4000": "gateway01.us-west-2.prod.aws.tidbcloud.com:4000",
+	} {
+		if e := (tidb.Option{Addr: addr}).Endpoint(); e != endpoint {
+			t.Fatalf("expected endpoint %v, got %v", endpoint, e)
+		}
+	}
+	if e := (tidb.Option{Addr: "127.0.0.1", Port: 4001}).Endpoint(); e != "127.0.0.1:4001" {
+		t.Fatalf("unexpected endpoint %v", e)
+	}
+
+	ins, err := tidb.NewMockInstance(tidb.Option{Label: "cloud", Serverless: true}, "v7.5.0", func(query string) ([]string, [][]string, error) {
+		return []string{"1"}, [][]string{{"1"}}, nil
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer ins.Close()
+	if err := ins.Exec("SET GLOBAL tidb_analyze_version = 2"); err == nil || !strings.Contains(err.Error(), "serverless") {
+		t.Fatalf("SET GLOBAL should be rejected on serverless instances, err=%v", err)
+	}
+	if err := ins.Exec("ANALYZE TABLE db.t"); err != nil {
+		t.Fatal(err)
+	}
+
+	base := "query-types = [\"single-col-point-query-on-col\"]\n"
+	for content, valid := range map[string]bool{
+		"[[instances]]\nlabel = \"cloud\"\nuser = \"2xxxx.root\"\nserverless = true":                                                                                         true,
+		"[[instances]]\nlabel = \"cloud\"\nuser = \"root\"\nserverless = true":                                                                                               false,
+		"[[instances]]\nlabel = \"cloud\"\nuser = \"2xxxx.root\"\nserverless = true\ntls = \"false\"":                                                                        false,
+		"[[instances]]\nlabel = \"cloud\"\nuser = \"2xxxx.root\"\nserverless = true\n[statements-summary]\nenabled = true":                                                   true,
+		"[[instances]]\nlabel = \"cloud\"\nuser = \"2xxxx.root\"\nserverless = true\n[statements-summary]\nenabled = true\ncluster = true":                                   false,
+		"[[instances]]\nlabel = \"cloud\"\nuser = \"2xxxx.root\"\nserverless = true\n[[matrix]]\nname = \"v\"\nvariable = \"tidb_analyze_version\"\nvalues = [\"1\", \"2\"]": false,
+	} {
+		if _, err := cetest.DecodeOption(base + content); (err == nil) != valid {
+			t.Fatalf("content=%v, err=%v", content, err)
+		}
+	}
+}
+
+func TestLatencyAware(t *testing.T) {
+	if _, err := cetest.DecodeOption("[latency-aware]\nenabled = true\nbase-rtt = \"x\"\n"); err == nil {
+		t.Fatalf("invalid base-rtt should be rejected")
+	}
+	conf := `
+query-types = ["single-col-point-query-on-col"]
+report-dir = "./test"
+concurrency = 2
+[latency-aware]
+enabled = true
+base-rtt = "1ms"
+[[instances]]
+label = "remote"
+[[datasets]]
+name = "mock"
+db = "mock"
+label = "mock"
+[datasets.mock]
+rows = 1000
+ndv = 100
+`
+	opt, err := cetest.DecodeOption(conf)
+	if err != nil {
+		t.Fatal(err)
+	}
+	ds, err := cetest.NewDataset(opt.Datasets[0])
+	if err != nil {
+		t.Fatal(err)
+	}
+	var running, maxRunning int32
+	ins, err := tidb.NewMockInstance(opt.Instances[0], "v7.5.0", func(query string) ([]string, [][]string, error) {
+		time.Sleep(4 * time.Millisecond) // every round-trip is slow
+		if strings.HasPrefix(query, "EXPLAIN") {
+			n := atomic.AddInt32(&running, 1)
+			defer atomic.AddInt32(&running, -1)
+			for {
+				m := atomic.LoadInt32(&maxRunning)
+				if n <= m || atomic.CompareAndSwapInt32(&maxRunning, m, n) {
+					break
+				}
+			}
+			time.Sleep(4 * time.Millisecond)
+			return []string{"id", "estRows", "task", "access object", "operator info"}, [][]string{{"TableReader_7", "12", "root", "", ""}}, nil
+		}
+		return nil, nil, nil
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer ins.Close()
+	rs, err := ds.GenEstResults(ins, 40, cetest.QTSingleColPointQueryOnCol)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if maxRunning <= 2 {
+		t.Fatalf("concurrency of the remote instance should be scaled beyond 2, got %v", maxRunning)
+	}
+	collector := cetest.NewEstResultCollector(1, 1, 1)
+	collector.AppendEstResults(0, 0, 0, rs)
+	if err := cetest.GenPErrorBarChartsReport(opt, collector); err != nil {
+		t.Fatal(err)
+	}
+	md, err := ioutil.ReadFile(path.Join(opt.ReportDir, "report.md"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !strings.Contains(string(md), "| Instance | Version | Metadata | RTT P50 | RTT P90 | Concurrency |") {
+		t.Fatalf("RTT should be in the instances section, got %s", md)
+	}
+	m := regexp.MustCompile(`\| remote \| - \| - \| ([\d.]+)ms \| [\d.]+ms \| (\d+) \|`).FindSubmatch(md)
+	if m == nil {
+		t.Fatalf("RTT of the remote instance is not in the report, got %s", md)
+	}
+	if rtt, _ := strconv.ParseFloat(string(m[1]), 64); rtt < 4 {
+		t.Fatalf("P50 RTT should be at least 4ms, got %s", m[1])
+	}
+	if n, _ := strconv.Atoi(string(m[2])); n < 8 || int32(n) < maxRunning {
+		t.Fatalf("concurrency should be scaled by RTT to at least 8, got %s", m[2])
+	}
+}
+
+func TestExplainArchive(t *testing.T) {
+	dir, err := ioutil.TempDir("", "explain-archive")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	conf := fmt.Sprintf(`
+query-types = ["single-col-point-query-on-col"]
+report-dir = "./test"
+[explain-archive]
+enabled = true
+dir = %q
+[[instances]]
+label = "mock"
+[[datasets]]
+name = "mock"
+db = "mock"
+label = "mock"
+[datasets.mock]
+rows = 1000
+ndv = 100
+`, dir)
+	opt, err := cetest.DecodeOption(conf)
+	if err != nil {
+		t.Fatal(err)
+	}
+	ds, err := cetest.NewDataset(opt.Datasets[0])
+	if err != nil {
+		t.Fatal(err)
+	}
+	ins, err := tidb.NewMockInstance(opt.Instances[0], "v7.5.0", func(query string) ([]string, [][]string, error) {
+		if strings.HasPrefix(query, "EXPLAIN") {
+			return []string{"id", "estRows", "task", "access object", "operator info"}, [][]string{{"TableReader_7", "12", "root", "", ""}}, nil
+		}
+		return nil, nil, nil
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer ins.Close()
+	rs, err := ds.GenEstResults(ins, 20, cetest.QTSingleColPointQueryOnCol)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(rs) < 2 {
+		t.Fatalf("too few cases %v", len(rs))
+	}
+	for _, r := range rs {
+		if r.ExplainRef != rs[0].ExplainRef || r.Plan != "" {
+			t.Fatalf("identical outputs should be archived once and not kept in results, got %+v", r)
+		}
+	}
+	output, err := cetest.ReadArchivedExplain(dir, rs[0].ExplainRef)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if output != "id\testRows\ttask\taccess object\toperator info\nTableReader_7\t12\troot\t\t" {
+		t.Fatalf("unexpected archived output %q", output)
+	}
+	files, err := ioutil.ReadDir(path.Join(dir, rs[0].ExplainRef[:2]))
+	if err != nil || len(files) != 1 {
+		t.Fatalf("the output should be stored once, got %v, err=%v", len(files), err)
+	}
+	if _, err := cetest.ReadArchivedExplain(dir, "../../etc/passwd"); err == nil {
+		t.Fatalf("invalid refs should be rejected")
+	}
+
+	collector := cetest.NewEstResultCollector(1, 1, 1)
+	collector.AppendEstResults(0, 0, 0, rs)
+	for _, rr := range cetest.CollectRawResults(opt, collector) {
+		if rr.ExplainRef != rs[0].ExplainRef {
+			t.Fatalf("explain_ref should be in raw results, got %+v", rr)
+		}
+	}
+}
+
+func TestQueryComments(t *testing.T) {
+	for _, c := range []string{"SELECT 1", "/*! DROP TABLE t */", "/*+ MAX_EXECUTION_TIME(1) */", "/* x */ -- y", "/* x"} {
+		if _, err := cetest.DecodeOption(fmt.Sprintf("query-prefix = %q\n[[instances]]\nlabel = \"a\"\n", c)); err == nil {
+			t.Fatalf("query-prefix %q should be rejected", c)
+		}
+	}
+	for _, c := range []string{"/* x; */", "/* x */;"} {
+		if _, err := cetest.DecodeOption(fmt.Sprintf("query-suffix = %q\n[[instances]]\nlabel = \"a\"\n", c)); err == nil {
+			t.Fatalf("query-suffix %q should be rejected", c)
+		}
+	}
+	for _, h := range []string{"x */ DELETE FROM t /*+ y", "MAX_EXECUTION_TIME(1); DELETE FROM t", "/* x */", "MAX_EXECUTION_TIME"} {
+		if _, err := cetest.DecodeOption(fmt.Sprintf("query-hints = [%q]\n[[instances]]\nlabel = \"a\"\n", h)); err == nil {
+			t.Fatalf("query-hints %q should be rejected", h)
+		}
+	}
+	if _, err := cetest.DecodeOption("resource-group = \"rg) */ DELETE FROM t /*+ x(\"\n[[instances]]\nlabel = \"a\"\n"); err == nil {
+		t.Fatalf("resource-group closing the hint comment should be rejected")
+	}
+	conf := `
+query-types = ["single-col-point-query-on-col"]
+report-dir = "./test"
+concurrency = 1
+query-prefix = "/* optimizertester run={run} ins={instance} */"
+query-hints = ["MAX_EXECUTION_TIME(1000)"]
+[[instances]]
+label = "a*/b"
+[[instances]]
+label = "own"
+query-suffix = "/* suffix */"
+query-hints = ["USE_INDEX(t, a)"]
+[[datasets]]
+name = "mock"
+db = "mock"
+label = "mock"
+[datasets.mock]
+rows = 100
+ndv = 10
+`
+	opt, err := cetest.DecodeOption(conf)
+	if err != nil {
+		t.Fatal(err)
+	}
+	prefix := regexp.MustCompile(`^/\* optimizertester run=(\d{8}-\d{6}-[0-9a-f]{6}) ins=(\S+) \*/ `)
+	ds, err := cetest.NewDataset(opt.Datasets[0])
+	if err != nil {
+		t.Fatal(err)
+	}
+	runIDs := make(map[string]bool)
+	for insIdx, hint := range []string{"/*+ MAX_EXECUTION_TIME(1000) */", "/*+ USE_INDEX(t, a) */"} {
+		var queries []string
+		ins, err := tidb.NewMockInstance(opt.Instances[insIdx], "v7.5.0", func(query string) ([]string, [][]string, error) {
+			queries = append(queries, query)
+			if strings.Contains(query, "EXPLAIN") {
+				return []string{"id", "estRows", "task", "access object", "operator info"}, [][]string{{"TableReader_7", "12", "root", "", ""}}, nil
+			}
+			return nil, nil, nil
+		})
+		if err != nil {
+			t.Fatal(err)
+		}
+		if _, err := ds.GenEstResults(ins, 3, cetest.QTSingleColPointQueryOnCol); err != nil {
+			t.Fatal(err)
+		}
+		ins.Close()
+		if len(queries) == 0 {
+			t.Fatalf("no statement is run")
+		}
+		for _, q := range queries {
+			m := prefix.FindStringSubmatch(q)
+			if m == nil || m[2] != map[int]string{0: "ab", 1: "own"}[insIdx] {
+				t.Fatalf("statement %q of %v should be prefixed by the expanded comment", q, opt.Instances[insIdx].Label)
+			}
+			runIDs[m[1]] = true
+			if strings.Contains(q, "SELECT") && !strings.Contains(q, "SELECT "+hint) {
+				t.Fatalf("statement %q of %v should have hint %v", q, opt.Instances[insIdx].Label, hint)
+			}
+			if insIdx == 1 && !strings.HasSuffix(q, " /* suffix */") {
+				t.Fatalf("statement %q of %v should end with its own suffix", q, opt.Instances[insIdx].Label)
+			}
+		}
+	}
+	if len(runIDs) != 1 {
+		t.Fatalf("all instances should share the ID of the run, got %v", runIDs)
+	}
+}
+
+func TestJoinOrderScore(t *testing.T) {
+	r := cetest.EstResult{SQL: "SELECT * FROM db1.t t1 JOIN db2.t t2 ON t1.a=t2.a WHERE t1.a=1", EstCard: 10, TrueCard: 10}
+	if _, ok := cetest.JoinOrderScore(r); ok {
+		t.Fatalf("cases without join orders should not be scored")
+	}
+	r.JoinOrders = []cetest.JoinOrderResult{
+		{Order: "", ExecTime: 100 * time.Millisecond},
+		{Order: "t1,t2", ExecTime: 100 * time.Millisecond},
+		{Order: "t2,t1", ExecTime: 25 * time.Millisecond},
+	}
+	if score, ok := cetest.JoinOrderScore(r); !ok || score != 0.25 {
+		t.Fatalf("unexpected score %v", score)
+	}
+
+	opt, err := cetest.DecodeOption(`
+query-types = ["cross-db-join-query"]
+report-dir = "./test"
+[[instances]]
+label = "ins"
+[[datasets]]
+name = "zipfx"
+db = "zipfx"
+label = "zipfx"
+[join-order]
+cases = 10
+`)
+	if err != nil {
+		t.Fatal(err)
+	}
+	collector := cetest.NewEstResultCollector(1, 1, 1)
+	collector.AddEstResult(0, 0, 0, r)
+	if err := cetest.GenPErrorBarChartsReport(opt, collector); err != nil {
+		t.Fatal(err)
+	}
+	md, err := ioutil.ReadFile(path.Join(opt.ReportDir, "report.md"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if s := "| ins | 1 | 0.250 | 0 | 0.250 | `SELECT * FROM db1.t t1 JOIN db2.t t2 ON t1.a=t2.a WHERE t1.a=1`: chosen 100ms, best `t2,t1` 25ms |"; !strings.Contains(string(md), s) {
+		t.Fatalf("%q is not in the report", s)
+	}
+
+	for content, valid := range map[string]bool{
+		"[join-order]\ncases = 5\nmax-orders = 2":   true,
+		"[join-order]\ncases = -1":                  false,
+		"read-only = true\n[join-order]\ncases = 5": false,
+	} {
+		if _, err := cetest.DecodeOption(content); (err == nil) != valid {
+			t.Fatalf("content=%v, err=%v", content, err)
+		}
+	}
+}
+
+func TestEstimateRunTime(t *testing.T) {
+	ins, err := tidb.NewMockInstance(tidb.Option{Label: "mock"}, "v7.5.0", func(query string) ([]string, [][]string, error) {
+		if strings.HasPrefix(query, "EXPLAIN") {
+			time.Sleep(time.Millisecond)
+			return []string{"id", "estRows", "task", "access object", "operator info"}, [][]string{{"TableReader_7", "12", "root", "", ""}}, nil
+		}
+		return nil, nil, nil
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer ins.Close()
+	opt, err := cetest.DecodeOption(`
+query-types = ["single-col-point-query-on-col", "single-col-range-query-on-col"]
+n-samples = 10000
+concurrency = 1
+[preflight]
+samples = 5
+[[datasets]]
+name = "mock"
+db = "mock"
+label = "mock"
+[datasets.mock]
+rows = 100
+ndv = 10
+`)
+	if err != nil {
+		t.Fatal(err)
+	}
+	ds, err := cetest.NewDataset(opt.Datasets[0])
+	if err != nil {
+		t.Fatal(err)
+	}
+	cells, err := cetest.EstimateRunTime(opt, []tidb.Instance{ins}, []cetest.Dataset{ds})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(cells) != 2 {
+		t.Fatalf("expected 2 cells, got %v", len(cells))
+	}
+	for _, c := range cells {
+		if c.PerCase < time.Millisecond || c.Estimated < 10*time.Second {
+			t.Fatalf("unexpected estimate %+v", c)
+		}
+	}
+
+	// calibration cases have no side effects on the run, like archiving EXPLAIN outputs
+	dir, err := ioutil.TempDir("", "cetest-preflight")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	opt, err = cetest.DecodeOption(fmt.Sprintf(`
+query-types = ["single-col-point-query-on-col"]
+n-samples = 10
+concurrency = 1
+[preflight]
+samples = 5
+[explain-archive]
+enabled = true
+dir = %q
+[[datasets]]
+name = "mock"
+db = "mock"
+label = "mock"
+[datasets.mock]
+rows = 100
+ndv = 10
+`, dir))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if ds, err = cetest.NewDataset(opt.Datasets[0]); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := cetest.EstimateRunTime(opt, []tidb.Instance{ins}, []cetest.Dataset{ds}); err != nil {
+		t.Fatal(err)
+	}
+	if files, _ := ioutil.ReadDir(dir); len(files) != 0 {
+		t.Fatalf("calibration cases should not be archived, got %v entries", len(files))
+	}
+	rs, err := ds.GenEstResults(ins, 5, cetest.QTSingleColPointQueryOnCol)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if files, _ := ioutil.ReadDir(dir); len(rs) == 0 || rs[0].ExplainRef == "" || len(files) == 0 {
+		t.Fatalf("cases of the run should be archived after the preflight, got %v entries", len(files))
+	}
+
+	if _, err := cetest.DecodeOption("[preflight]\nsamples = 5"); err == nil {
+		t.Fatal("preflight without n-samples should be rejected")
+	}
+}
+
+func TestTraceStepsReport(t *testing.T) {
+	if _, err := cetest.DecodeOption("read-only = true\noptimizer-trace-cases = 5"); err == nil {
+		t.Fatal("optimizer-trace-cases should be rejected in read-only mode")
+	}
+}
+
+func TestSelectivityErrors(t *testing.T) {
+	r := cetest.EstResult{EstCard: 30, TrueCard: 10, TableRows: 1000}
+	if cetest.EstSelectivity(r) != 0.03 || cetest.SelectivityError(r) != 0.02 {
+		t.Fatalf("unexpected selectivities %v and %v", cetest.EstSelectivity(r), cetest.SelectivityError(r))
+	}
+	if cetest.SelectivityError(cetest.EstResult{EstCard: 30, TrueCard: 10}) != 0 {
+		t.Fatal("selectivity errors should be 0 if table sizes are unknown")
+	}
+}
+
+func TestMPPJoins(t *testing.T) {
+	ins, err := tidb.NewMockInstance(tidb.Option{Label: "mock"}, "v7.5.0", func(query string) ([]string, [][]string, error) {
+		if strings.HasPrefix(query, "EXPLAIN") {
+			return []string{"id", "estRows", "task", "access object", "operator info"}, [][]string{
+				{"TableReader_40", "100.00", "root", "", "MppVersion: 2, data:ExchangeSender_39"},
+				{"└─ExchangeSender_39", "100.00", "mpp[tiflash]", "", "ExchangeType: PassThrough"},
+				{"  └─HashJoin_38", "100.00", "mpp[tiflash]", "", "inner join, equal:[eq(t1.a, t2.a)]"},
+				{"    ├─ExchangeReceiver_22(Build)", "10.00", "mpp[tiflash]", "", ""},
+				{"    │ └─ExchangeSender_21", "10.00", "mpp[tiflash]", "", "ExchangeType: Broadcast, Compression: FAST"},
+				{"    └─TableFullScan_23(Probe)", "1000.00", "mpp[tiflash]", "table:t2", "keep order:false"},
+			}, nil
+		}
+		return nil, nil, nil
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer ins.Close()
+	opt, err := cetest.DecodeOption(`
+[[datasets]]
+name = "mock"
+db = "mock"
+label = "mock"
+[datasets.mock]
+rows = 100
+ndv = 10
+`)
+	if err != nil {
+		t.Fatal(err)
+	}
+	ds, err := cetest.NewDataset(opt.Datasets[0])
+	if err != nil {
+		t.Fatal(err)
+	}
+	rs, err := ds.GenEstResults(ins, 5, cetest.QTSingleColPointQueryOnCol)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, r := range rs {
+		if r.MPPJoin != cetest.MPPJoinBroadcast {
+			t.Fatalf("unexpected join type %v", r.MPPJoin)
+		}
+	}
+}
+
+func TestPlanRisks(t *testing.T) {
+	ops, err := cetest.ParseExplainAnalyze(benchExplainHeader, benchExplainResults)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if ops[1].Object != "table:tmock0, index:idx_0(c0)" || ops[1].Info != "range:[1,1], keep order:false" {
+		t.Fatalf("unexpected operator %+v", ops[1])
+	}
+
+	for _, c := range []struct {
+		est, act     float64
+		misestimated bool
+	}{
+		{100, 50000, true},
+		{3000, 4000, false},
+		{100, 200, true}, // off by 2x
+		{200, 100, true},
+		{150, 100, false},
+		{0, 5, true},
+		{0, 0, false},
+	} {
+		if m := (cetest.PlanRisk{EstRows: c.est, ActRows: c.act}).Misestimated(); m != c.misestimated {
+			t.Fatalf("est=%v, act=%v, expected misestimated=%v, got %v", c.est, c.act, c.misestimated, m)
+		}
+	}
+
+	join := func(id string, buildAct, probeAct float64) []cetest.OperatorStats {
+		return []cetest.OperatorStats{
+			{ID: id},
+			{ID: "TableReader_12(Build)", Depth: 1, EstRows: 100, ActRows: buildAct},
+			{ID: "TableReader_14(Probe)", Depth: 1, EstRows: 100, ActRows: probeAct},
+		}
+	}
+	fullScan := func(info, task string, scanned float64) []cetest.OperatorStats {
+		return []cetest.OperatorStats{
+			{ID: "Selection_7", Task: task, Info: info, EstRows: 5, ActRows: 5},
+			{ID: "TableFullScan_6", Depth: 1, Task: task, Object: "table:t", EstRows: 10000, ActRows: scanned},
+		}
+	}
+	indexed := func(db, tb, col string) (bool, error) { return tb == "t" && col == "a", nil }
+	for _, c := range []struct {
+		name  string
+		ops   []cetest.OperatorStats
+		risks []cetest.PlanRisk
+	}{
+		{"index join on huge outer", join("IndexJoin_10", 50000, 10),
+			[]cetest.PlanRisk{{Kind: cetest.RiskIndexJoinHugeOuter, Operator: "TableReader_12(Build)", EstRows: 100, ActRows: 50000}}},
+		{"index hash join on huge outer", join("IndexHashJoin_10", 50000, 10),
+			[]cetest.PlanRisk{{Kind: cetest.RiskIndexJoinHugeOuter, Operator: "TableReader_12(Build)", EstRows: 100, ActRows: 50000}}},
+		{"index join on small outer", join("IndexJoin_10", 5000, 10), nil},
+		{"hash join building on the larger side", join("HashJoin_10", 4000, 3000),
+			[]cetest.PlanRisk{{Kind: cetest.RiskHashJoinLargerBuild, Operator: "TableReader_12(Build)", EstRows: 100, ActRows: 4000}}},
+		{"hash join building on the smaller side", join("HashJoin_10", 3000, 4000), nil},
+		{"hash join building on a small larger side", join("HashJoin_10", 500, 100), nil},
+		{"full scan filtering an indexed column", fullScan("eq(test.t.a, 1)", "cop[tikv]", 10000),
+			[]cetest.PlanRisk{{Kind: cetest.RiskFullScanWithIndex, Operator: "Selection_7", EstRows: 5, ActRows: 5}}},
+		{"full scan filtering a column without indexes", fullScan("eq(test.t.b, 1)", "cop[tikv]", 10000), nil},
+		{"full scan filtering a column of another table", fullScan("eq(test.s.a, 1)", "cop[tikv]", 10000), nil},
+		{"full scan on tiflash", fullScan("eq(test.t.a, 1)", "mpp[tiflash]", 10000), nil},
+		{"small full scan", fullScan("eq(test.t.a, 1)", "cop[tikv]", 500), nil},
+	} {
+		risks, err := cetest.PlanRisks(c.ops, indexed)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if !reflect.DeepEqual(risks, c.risks) {
+			t.Fatalf("%v: expected risks %+v, got %+v", c.name, c.risks, risks)
+		}
+	}
+}
+
+func TestTopNCheck(t *testing.T) {
+	for _, c := range []struct {
+		cnt, act, tolerance float64
+		mismatch            bool
+	}{
+		{10, 10, 0, false},
+		{10, 12, 0, true},
+		{10, 12, 0.2, false}, // 2 <= 0.2*12
+		{10, 13, 0.2, true},
+		{13, 10, 0.2, true},
+		{0, 0, 0, false},
+	} {
+		if m := cetest.TopNMismatch(c.cnt, c.act, c.tolerance); m != c.mismatch {
+			t.Fatalf("cnt=%v, act=%v, tolerance=%v, expected mismatch=%v, got %v", c.cnt, c.act, c.tolerance, c.mismatch, m)
+		}
+	}
+
+	ins, err := tidb.NewMockInstance(tidb.Option{Label: "mock"}, "v7.5.0", func(query string) ([]string, [][]string, error) {
+		if strings.HasPrefix(query, "SHOW STATS_TOPN") {
+			return []string{"db_name", "table_name", "partition_name", "column_name", "is_index", "value", "count"}, [][]string{
+				{"db", "t", "", "a", "0", "1", "10"},
+				{"db", "t", "", "a", "0", "2", "10"},
+				{"db", "t", "", "b", "0", "x", "7"},
+				{"db", "t", "", "idx", "1", "1", "99"},
+			}, nil
+		}
+		return nil, nil, nil
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer ins.Close()
+	opt := cetest.Option{
+		QueryTypes: []cetest.QueryType{cetest.QTSingleColPointQueryOnCol, cetest.QTSingleColRangeQueryOnCol},
+		Datasets:   []cetest.DatasetOpt{{Label: "zipfx"}},
+		Instances:  []tidb.Option{{Label: "v7.5"}},
+		TopNCheck:  cetest.TopNCheckOpt{Enabled: true},
+	}
+	collector := cetest.NewEstResultCollector(1, 1, 2)
+	for _, r := range []cetest.EstResult{
+		{SQL: "SELECT * FROM db.t WHERE a=1", TrueCard: 10},
+		{SQL: "SELECT * FROM db.t WHERE a=2", TrueCard: 12},
+		{SQL: "SELECT * FROM db.t WHERE a=3", TrueCard: 12},
+		{SQL: "SELECT * FROM db.t WHERE b='x'", TrueCard: 7, Operators: []cetest.OperatorStats{{ID: "TableReader_7", ActRows: 8}}},
+	} {
+		collector.AddEstResult(0, 0, 0, r)
+	}
+	collector.AddEstResult(0, 0, 1, cetest.EstResult{SQL: "SELECT * FROM db.t WHERE a=1", TrueCard: 12})
+	if err := cetest.CrossCheckTopN(opt, []tidb.Instance{ins}, collector); err != nil {
+		t.Fatal(err)
+	}
+	for i, exp := range []struct {
+		cnt      float64
+		mismatch bool
+	}{{10, false}, {10, true}, {0, false}, {7, true}} {
+		r := collector.EstResults(0, 0, 0)[i]
+		if r.TopNCount != exp.cnt || r.HasTag(cetest.TagTopNMismatch) != exp.mismatch {
+			t.Fatalf("unexpected result of %v: topn-count=%v, tags=%v", r.SQL, r.TopNCount, r.Tags)
+		}
+	}
+	if r := collector.EstResults(0, 0, 1)[0]; r.TopNCount != 0 || len(r.Tags) != 0 {
+		t.Fatalf("cases of other query types should not be checked: %+v", r)
+	}
+
+	if _, err := cetest.DecodeOption("[topn-check]\nenabled = true\ntolerance = -0.1"); err == nil {
+		t.Fatalf("negative tolerance should be rejected")
+	}
+}
+
+func TestWhatIfIndexes(t *testing.T) {
+	for content, valid := range map[string]bool{
+		"[[what-if-indexes]]\ndb = \"zipfx\"\ntable = \"tint\"\ncolumns = [\"a\"]":                                       true,
+		"[[what-if-indexes]]\ndb = \"zipfx\"\ntable = \"tint\"\ncolumns = [\"a\"]\nmode = \"scratch\"":                   true,
+		"[[what-if-indexes]]\ndb = \"zipfx\"\ntable = \"tint\"":                                                          false,
+		"[[what-if-indexes]]\ndb = \"zipfx\"\ntable = \"tint\"\ncolumns = [\"a\"]\nmode = \"invisible\"":                 false,
+		"read-only = true\n[[what-if-indexes]]\ndb = \"zipfx\"\ntable = \"tint\"\ncolumns = [\"a\"]\nmode = \"scratch\"": false,
+		"read-only = true\n[[what-if-indexes]]\ndb = \"zipfx\"\ntable = \"tint\"\ncolumns = [\"a\"]":                     true,
+	} {
+		if _, err := cetest.DecodeOption(content); (err == nil) != valid {
+			t.Fatalf("content=%q, expected valid=%v, err=%v", content, valid, err)
+		}
+	}
+	if name := (cetest.WhatIfIndexOpt{DB: "zipfx", Table: "tint", Columns: []string{"a", "b"}}).Name(); name != "zipfx.tint(a,b)" {
+		t.Fatalf("unexpected name %v", name)
+	}
+}
+
+func TestPointGetQuery(t *testing.T) {
+	ins, err := tidb.NewMockInstance(tidb.Option{Label: "mock"}, "v7.5.0", func(query string) ([]string, [][]string, error) {
+		switch {
+		case strings.HasPrefix(query, "SELECT id, COUNT(*)"):
+			return []string{"id", "cnt"}, [][]string{{"1", "1"}, {"2", "1"}, {"3", "1"}, {"4", "1"}}, nil
+		case strings.HasPrefix(query, "SELECT COUNT(*)"):
+			return []string{"cnt"}, [][]string{{"0"}}, nil
+		case strings.HasPrefix(query, "EXPLAIN") && strings.Contains(query, " IN ("):
+			return []string{"id", "estRows", "task", "access object", "operator info"}, [][]string{
+				{"TableReader_7", "3.00", "root", "", "data:TableRangeScan_6"},
+				{"└─TableRangeScan_6", "3.00", "cop[tikv]", "table:thier", "range:[1,1], [2,2]"},
+			}, nil
+		case strings.HasPrefix(query, "EXPLAIN"):
+			return []string{"id", "estRows", "task", "access object", "operator info"}, [][]string{
+				{"Point_Get_1", "1.00", "root", "table:thier", "handle:1"},
+			}, nil
+		}
+		return nil, nil, nil
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer ins.Close()
+	ds, err := cetest.NewDataset(cetest.DatasetOpt{Name: "hierarchy", DB: "test", Label: "hierarchy"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	rs, err := ds.GenEstResults(ins, 0, cetest.QTSingleColPointGetQueryOnUniqueKey)
+	if err != nil {
+		t.Fatal(err)
+	}
+	degraded := 0
+	for _, r := range rs {
+		if strings.Contains(r.SQL, " IN (") != r.HasTag(cetest.TagNotPointGet) {
+			t.Fatalf("unexpected tags of %v: %v", r.SQL, r.Tags)
+		}
+		if r.HasTag(cetest.TagNotPointGet) {
+			degraded++
+		}
+	}
+	if degraded == 0 || degraded == len(rs) {
+		t.Fatalf("unexpected degraded plans %v of %v cases", degraded, len(rs))
+	}
+}
+
 func TestDecodeOption(t *testing.T) {
 	content := `
-query-types = ["multi-cols-point-query", "single-col-point-query"]
+query-types = ["mul-cols-point-query-on-index", "single-col-point-query-on-col"]
 report-dir = "/tmp/xxx"
 
 [[datasets]]
-name = "imdb"
-db = "imdb"
-label = "imdb"
+name = "imdb"
+db = "imdb"
+label = "imdb"
+
+[[datasets]]
+name = "tpcc"
+db = "tpcc10G"
+label = "tpcc10G"
+
+
+[[datasets]]
+name = "tpcc"
+db = "tpcc50G"
+label = "tpcc50G"
+
+[[instances]]
+addr = "127.0.0.1"
+port = 4000
+user = "root"
+password = "123456"
+label = "v4.0"
+
+
+[[instances]]
+addr = "127.0.0.1"
+port = 4001
+user = "root"
+password = "123456"
+label = "master"
+`
+	opt, err := cetest.DecodeOption(content)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(opt.QueryTypes) != 2 || len(opt.Datasets) != 3 || len(opt.Instances) != 2 ||
+		opt.QueryTypes[0] != cetest.QTMulColsPointQueryOnIndex || opt.QueryTypes[1] != cetest.QTSingleColPointQueryOnCol {
+		t.Fatal()
+	}
+}
+
+func TestDecodeReadOnlyOption(t *testing.T) {
+	content := `
+read-only = true
+analyze-tables = ["test.tint"]
+
+[[instances]]
+addr = "127.0.0.1"
+port = 4000
+label = "v4.0"
+`
+	if _, err := cetest.DecodeOption(content); err == nil {
+		t.Fatal("analyze-tables should be rejected in read-only mode")
+	}
+
+	opt, err := cetest.DecodeOption(strings.Replace(content, `analyze-tables = ["test.tint"]`, "", 1))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !opt.Instances[0].ReadOnly {
+		t.Fatal("read-only should be propagated to instances")
+	}
+
+	for sql, readOnly := range map[string]bool{
+		"SELECT * FROM t WHERE a=1":                      true,
+		"EXPLAIN ANALYZE SELECT * FROM t WHERE a='x;'":   true,
+		"EXPLAIN FORMAT='brief' SELECT * FROM t":         true,
+		"SELECT * FROM t WHERE b='delete into'":          true,
+		"/* DELETE */ SHOW STATS_META":                   true,
+		"EXPLAIN ANALYZE DELETE FROM t":                  false,
+		"ANALYZE TABLE t":                                false,
+		"INSERT INTO t VALUES (1)":                       false,
+		"  drop table t":                                 false,
+		"SET GLOBAL tidb_enable_fast_analyze=1":          false,
+		"SELECT * FROM t INTO OUTFILE '/tmp/x'":          false,
+		"SELECT * FROM t WHERE a=1 FOR UPDATE":           false,
+		"/*+ SET_VAR(x=1) */ UPDATE t SET a=1 WHERE a=2": false,
+	} {
+		if tidb.IsReadOnlySQL(sql) != readOnly {
+			t.Fatalf("sql=%v, expected read-only=%v", sql, readOnly)
+		}
+	}
+}
+
+func TestDecodeDatasetTables(t *testing.T) {
+	content := `
+[[datasets]]
+name = "imdb"
+label = "imdb"
+db = "imdb"
+
+[[datasets.tables]]
+name = "title"
+columns = ["phonetic_code"]
+
+[[datasets.tables.indexes]]
+name = "idx_kind_year"
+columns = ["kind_id", "production_year"]
+types = ["int", "int"]
+`
+	opt, err := cetest.DecodeOption(content)
+	if err != nil {
+		t.Fatal(err)
+	}
+	tbs := opt.Datasets[0].Tables
+	if len(tbs) != 1 || tbs[0].Name != "title" || len(tbs[0].Columns) != 1 || len(tbs[0].Indexes) != 1 {
+		t.Fatalf("unexpected tables %v", tbs)
+	}
+	if idx := tbs[0].Indexes[0]; idx.Name != "idx_kind_year" || len(idx.Columns) != 2 || len(idx.Types) != 2 {
+		t.Fatalf("unexpected index %v", idx)
+	}
+
+	// multi-column query types can't be generated on indexes with less than 2 columns
+	opt, err = cetest.DecodeOption(strings.Replace(strings.Replace(content, `, "production_year"]`, "]", 1), `, "int"]`, "]", 1))
+	if err != nil {
+		t.Fatal(err)
+	}
+	ds, err := cetest.NewDataset(opt.Datasets[0])
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := ds.CheckRequirements(nil); err == nil || !strings.Contains(err.Error(), "at least 2 columns") {
+		t.Fatalf("the 1-column index should be rejected, err=%v", err)
+	}
+}
+
+func TestDecodeRerunOption(t *testing.T) {
+	content := `
+[rerun]
+path = "./test/results.csv"
+`
+	if _, err := cetest.DecodeOption(content); err == nil {
+		t.Fatal("rerun without worst or max-p-error should be rejected")
+	}
+	opt, err := cetest.DecodeOption(content + "worst = 0.05\n")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if opt.Rerun.Worst != 0.05 {
+		t.Fatalf("unexpected rerun option %v", opt.Rerun)
+	}
+}
+
+func TestDecodeMinVersions(t *testing.T) {
+	for content, valid := range map[string]bool{
+		`min-versions = { "cross-db-join-query" = "v4.0.0" }`: true,
+		`min-versions = { "cross-db-join-query" = "4.0" }`:    false,
+		`min-versions = { "unknown-query" = "v4.0.0" }`:       false,
+	} {
+		if _, err := cetest.DecodeOption(content); (err == nil) != valid {
+			t.Fatalf("content=%v, err=%v", content, err)
+		}
+	}
+}
+
+func TestExtractEstResultByHeader(t *testing.T) {
+	cases := []struct {
+		header  []string
+		results [][]string
+		r       cetest.EstResult
+	}{
+		{ // v4.0 EXPLAIN FORMAT='row'
+			[]string{"id", "estRows", "task", "access object", "operator info"},
+			[][]string{{"IndexReader_6", "12.50", "root", "", "index:IndexRangeScan_5"}},
+			cetest.EstResult{EstCard: 12.5},
+		},
+		{ // EXPLAIN FORMAT='brief'
+			[]string{"id", "estRows", "task", "access object", "operator info"},
+			[][]string{{"IndexReader", "3.00", "root", "", "index:IndexRangeScan"}},
+			cetest.EstResult{EstCard: 3},
+		},
+		{ // EXPLAIN FORMAT='verbose'
+			[]string{"id", "estRows", "estCost", "task", "access object", "operator info"},
+			[][]string{{"IndexReader_6", "10.00", "219.00", "root", "", "index:IndexRangeScan_5"}},
+			cetest.EstResult{EstCard: 10, EstCost: 219},
+		},
+		{ // v4.0 EXPLAIN ANALYZE
+			[]string{"id", "estRows", "actRows", "task", "access object", "execution info", "operator info", "memory", "disk"},
+			[][]string{{"TableReader_5", "10000.00", "7", "root", "", "time:1ms, loops:2", "data:TableFullScan_4", "1 KB", "N/A"}},
+			cetest.EstResult{EstCard: 10000, TrueCard: 7},
+		},
+		{ // v3.0 EXPLAIN ANALYZE
+			[]string{"id", "count", "task", "operator info", "execution info", "memory"},
+			[][]string{{"TableReader_5", "10000.00", "root", "data:TableScan_4", "time:2.95024ms, loops:1, rows:3", "115 Bytes"}},
+			cetest.EstResult{EstCard: 10000, TrueCard: 3},
+		},
+	}
+	for _, c := range cases {
+		r, err := cetest.ExtractEstResultByHeader(c.header, c.results)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if r.EstCard != c.r.EstCard || r.TrueCard != c.r.TrueCard || r.EstCost != c.r.EstCost {
+			t.Fatalf("header=%v, expected %+v, got %+v", c.header, c.r, r)
+		}
+	}
+	if _, err := cetest.ExtractEstResultByHeader([]string{"dot contents"}, [][]string{{"digraph"}}); err == nil {
+		t.Fatal("unknown formats should be rejected")
+	}
+}
+
+func TestIndexLookUps(t *testing.T) {
+	header := []string{"id", "estRows", "actRows", "task", "access object", "execution info", "operator info", "memory", "disk"}
+	for _, c := range []struct {
+		name    string
+		results [][]string
+		sides   []cetest.IndexLookUpSides
+	}{
+		{"filtered table side", [][]string{
+			{"IndexLookUp_10", "10.00", "20", "root", "", "time:3ms, loops:2", "", "10.5 KB", "N/A"},
+			{"├─IndexRangeScan_8(Build)", "10.00", "400", "cop[tikv]", "table:t, index:a(a)", "time:1ms, loops:1", "range:[1,1], keep order:false", "N/A", "N/A"},
+			{"└─Selection_9(Probe)", "10.00", "20", "cop[tikv]", "", "time:1ms, loops:1", "gt(test.t.b, 1)", "N/A", "N/A"},
+			{"  └─TableRowIDScan_7", "10.00", "400", "cop[tikv]", "table:t", "time:1ms, loops:1", "keep order:false", "N/A", "N/A"},
+		}, []cetest.IndexLookUpSides{{Operator: "IndexLookUp_10", IndexEst: 10, IndexAct: 400, TableEst: 10, TableAct: 20, Act: 20}}},
+		{"nested in a limit", [][]string{
+			{"Limit_11", "5.00", "5", "root", "", "time:3ms, loops:2", "offset:0, count:5", "N/A", "N/A"},
+			{"└─IndexLookUp_10", "5.00", "5", "root", "", "time:3ms, loops:2", "", "10.5 KB", "N/A"},
+			{"  ├─IndexRangeScan_8(Build)", "5.00", "5", "cop[tikv]", "table:t, index:a(a)", "time:1ms, loops:1", "range:[1,1], keep order:false", "N/A", "N/A"},
+			{"  └─TableRowIDScan_9(Probe)", "5.00", "5", "cop[tikv]", "table:t", "time:1ms, loops:1", "keep order:false", "N/A", "N/A"},
+		}, []cetest.IndexLookUpSides{{Operator: "IndexLookUp_10", IndexEst: 5, IndexAct: 5, TableEst: 5, TableAct: 5, Act: 5}}},
+		{"index reader", [][]string{
+			{"IndexReader_6", "10.00", "20", "root", "", "time:1ms, loops:2", "index:IndexRangeScan_5", "1 KB", "N/A"},
+			{"└─IndexRangeScan_5", "10.00", "20", "cop[tikv]", "table:t, index:a(a)", "time:1ms, loops:1", "range:[1,1], keep order:false", "N/A", "N/A"},
+		}, nil},
+	} {
+		ops, err := cetest.ParseExplainAnalyze(header, c.results)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if sides := cetest.IndexLookUps(ops); !reflect.DeepEqual(sides, c.sides) {
+			t.Fatalf("%v: expected %+v, got %+v", c.name, c.sides, sides)
+		}
+	}
+
+	for _, c := range []struct {
+		sides  cetest.IndexLookUpSides
+		blowup float64
+	}{
+		{cetest.IndexLookUpSides{IndexAct: 400, Act: 20}, 20},
+		{cetest.IndexLookUpSides{IndexAct: 20, Act: 20}, 1},
+		{cetest.IndexLookUpSides{IndexAct: 30, Act: 0}, 30},
+	} {
+		if b := c.sides.Blowup(); b != c.blowup {
+			t.Fatalf("expected blowup %v of %+v, got %v", c.blowup, c.sides, b)
+		}
+	}
+}
+
+func TestCoverage(t *testing.T) {
+	for _, c := range []struct {
+		r        cetest.EstResult
+		features []string
+	}{
+		{cetest.EstResult{SQL: "SELECT * FROM db.t WHERE a=1", Tags: []string{cetest.TagMCV}}, []string{"topn"}},
+		{cetest.EstResult{SQL: "SELECT * FROM db.t WHERE a=1", TopNCount: 10}, []string{"topn"}},
+		{cetest.EstResult{SQL: "SELECT * FROM db.t WHERE a=2"}, []string{"histogram-point"}},
+		{cetest.EstResult{SQL: "SELECT * FROM db.t WHERE b IN (1, 2)", PseudoStats: true}, []string{"histogram-point", "pseudo-stats"}},
+		{cetest.EstResult{SQL: "SELECT * FROM db.t WHERE a>=1 AND a<=3"}, []string{"histogram-range"}},
+		{cetest.EstResult{SQL: "SELECT * FROM db.t WHERE a>=1 AND a<=3", EstCard: 80, TableRows: 100}, []string{"histogram-range", "default-selectivity"}},
+		{cetest.EstResult{SQL: "SELECT * FROM db.t WHERE a>=1 AND a<=3", EstCard: 8, TableRows: 10}, []string{"histogram-range"}},
+		{cetest.EstResult{SQL: "SELECT * FROM db.t WHERE b LIKE 'x%'"}, []string{"histogram-range"}},
+		{cetest.EstResult{SQL: "SELECT * FROM db.t WHERE a>100", Tags: []string{cetest.TagOutOfRange}}, []string{"histogram-range", "out-of-range"}},
+		{cetest.EstResult{SQL: "SELECT * FROM db.t WHERE a IS NULL", Tags: []string{cetest.TagNull}}, []string{"null"}},
+		{cetest.EstResult{SQL: "SELECT * FROM db.t WHERE a!=1 AND b IS NOT NULL"}, nil},
+		{cetest.EstResult{SQL: "SELECT * FROM db.t WHERE a=1", PlanFingerprint: "HashJoin(TableReader,TableReader)"}, []string{"histogram-point", "ndv-join"}},
+	} {
+		if features := cetest.CoverageFeatures(c.r); !reflect.DeepEqual(features, c.features) {
+			t.Fatalf("expected features %v of %+v, got %v", c.features, c.r, features)
+		}
+	}
+}
+
+func TestDefaultSelectivities(t *testing.T) {
+	for _, c := range []struct {
+		est, rows float64
+		name      string
+	}{
+		{1000, 3000, "1/3"},
+		{333.33, 1000, "1/3"}, // rounded by EXPLAIN
+		{3, 3000, "1/1000"},
+		{2400, 3000, "0.8"},
+		{300, 3000, "0.1"},
+		{75, 3000, "1/40"},
+		{50, 3000, ""},
+		{12, 3000, ""},
+		{8, 10, ""}, // too few rows to tell from coincidences
+		{80, 0, ""}, // unknown rows
+	} {
+		name, ok := cetest.MatchDefaultSelectivity(cetest.EstResult{EstCard: c.est, TableRows: c.rows})
+		if name != c.name || ok != (c.name != "") {
+			t.Fatalf("est=%v, rows=%v, expected %q, got %q, %v", c.est, c.rows, c.name, name, ok)
+		}
+	}
+}
+
+func TestColumnErrors(t *testing.T) {
+	for _, c := range []struct {
+		sql  string
+		cols []string
+	}{
+		{"SELECT * FROM db.t WHERE a=1", []string{"t.a"}},
+		{"SELECT * FROM db.t WHERE a>=1 AND a<=3 AND b>5", []string{"t.a", "t.b"}},
+		{"SELECT * FROM db.t t1 JOIN db.s t2 ON t1.a = t2.c WHERE t2.d IN ('x=1')", []string{"t.a", "s.d", "s.c"}},
+		{"SELECT * FROM db.t WHERE a IS NULL AND b=true", []string{"t.a", "t.b"}},
+	} {
+		if cols := cetest.PredicateColumns(c.sql); !reflect.DeepEqual(cols, c.cols) {
+			t.Fatalf("expected columns %v of %v, got %v", c.cols, c.sql, cols)
+		}
+	}
+
+	for _, c := range []struct {
+		sql, col, suggestion string
+	}{
+		{"SELECT * FROM db.t WHERE a>=1 AND a<=3 AND b>5", "t.b", "extended stats"},
+		{"SELECT * FROM db.t t1 JOIN db.s t2 ON t1.a = t2.c WHERE t2.d IN ('x=1')", "s.c", "extended stats"},
+		{"SELECT * FROM db.t t1 JOIN db.s t2 ON t1.a = t2.c WHERE t2.d IN ('x=1')", "t.a", "TopN tuning"},
+		{"SELECT * FROM db.t WHERE a=1", "t.a", "TopN tuning"},
+		{"SELECT * FROM db.t WHERE a>1", "t.a", "more buckets"},
+		{"SELECT * FROM db.t WHERE a IS NULL", "t.a", "-"},
+	} {
+		if s := cetest.ColumnStatsSuggestion(cetest.EstResult{SQL: c.sql}, c.col); s != c.suggestion {
+			t.Fatalf("expected suggestion %q for %v of %v, got %q", c.suggestion, c.col, c.sql, s)
+		}
+	}
+}
+
+// TestReportSections renders one case of each classified feature and checks that every section of it is in the report,
+// classifiers of these sections are tested by their own tests.
+func TestReportSections(t *testing.T) {
+	wi := cetest.WhatIfIndexOpt{DB: "zipfx", Table: "tint", Columns: []string{"a", "b"}}
+	opt := cetest.Option{
+		QueryTypes:    []cetest.QueryType{cetest.QTSingleColPointQueryOnCol, cetest.QTSingleColPointGetQueryOnUniqueKey},
+		Datasets:      []cetest.DatasetOpt{{Label: "zipfx"}},
+		Instances:     []tidb.Option{{Label: "v7.5"}},
+		ReportDir:     "./test",
+		TopNCheck:     cetest.TopNCheckOpt{Enabled: true},
+		WhatIfIndexes: []cetest.WhatIfIndexOpt{wi},
+	}
+	ops, err := cetest.ParseExplainAnalyze(benchExplainHeader, [][]string{
+		{"IndexLookUp_10", "10.00", "20", "root", "", "time:3ms, loops:2", "", "10.5 KB", "N/A"},
+		{"├─IndexRangeScan_8(Build)", "10.00", "400", "cop[tikv]", "table:t, index:a(a)", "time:1ms, loops:1", "range:[1,1], keep order:false", "N/A", "N/A"},
+		{"└─TableRowIDScan_9(Probe)", "10.00", "20", "cop[tikv]", "table:t", "time:1ms, loops:1", "keep order:false", "N/A", "N/A"},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	mpp := []cetest.OperatorStats{
+		{ID: "HashJoin_38"},
+		{ID: "ExchangeReceiver_22(Build)", Depth: 1, EstRows: 10, ActRows: 100000},
+		{ID: "TableFullScan_23(Probe)", Depth: 1},
+	}
+	collector := cetest.NewEstResultCollector(1, 1, 2)
+	for _, r := range []cetest.EstResult{
+		{SQL: "q-risk", EstCard: 1, TrueCard: 1, Risks: []cetest.PlanRisk{{Kind: cetest.RiskIndexJoinHugeOuter, Operator: "TableReader_12(Build)", EstRows: 100, ActRows: 50000}}},
+		{SQL: "q-topn", EstCard: 10, TrueCard: 12, TopNCount: 10, Tags: []string{cetest.TagTopNMismatch}},
+		{SQL: "q-what-if", EstCard: 40, TrueCard: 10, PlanFingerprint: "TableReader(TableFullScan)",
+			WhatIf: []cetest.WhatIfResult{{Index: wi.Name(), EstCard: 10, PlanFingerprint: "IndexReader(IndexRangeScan)"}}},
+		{SQL: "q-lookup", EstCard: 10, TrueCard: 20, Operators: ops},
+		{SQL: "q-mpp", EstCard: 10, TrueCard: 100000, MPPJoin: cetest.MPPJoinBroadcast, Operators: mpp},
+		{SQL: "q-trace", EstCard: 100, TrueCard: 10, TraceSteps: []string{"Column Stats-Point"}},
+		{SQL: "SELECT * FROM db.t WHERE a>1", EstCard: 1000, TrueCard: 10, TableRows: 3000},
+	} {
+		collector.AddEstResult(0, 0, 0, r)
+	}
+	collector.AddEstResult(0, 0, 1, cetest.EstResult{SQL: "q-point-get", EstCard: 3, TrueCard: 2, PlanFingerprint: "TableReader(TableRangeScan)",
+		Tags: []string{cetest.TagNotPointGet}})
+	if err := cetest.GenPErrorBarChartsReport(opt, collector); err != nil {
+		t.Fatal(err)
+	}
+	md, err := ioutil.ReadFile(path.Join(opt.ReportDir, "report.md"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, s := range []string{
+		"Risky Plan Choices", "`q-risk` (TableReader_12(Build): est 100, act 50000)",
+		"TopN Cross-check", "`q-topn`: true-card=12, topn-count=10",
+		"What-If Indexes", "`q-what-if`: `TableReader(TableFullScan)` => `IndexReader(IndexRangeScan)`",
+		"IndexLookUp Double Reads", "`q-lookup`: index side 10 => 400, blowup 20.0",
+		"MPP Joins", "| v7.5 | broadcast |",
+		"Selectivity Steps of the Worst Cases", "| v7.5 | Column Stats-Point |",
+		"Default Selectivities", "`SELECT * FROM db.t WHERE a>1`: 1/3 of 3000 rows",
+		"Errors in Row-Space and Selectivity-Space",
+		"PointGet Plans", "`q-point-get`: `TableReader(TableRangeScan)`",
+		"# Estimation Coverage", "| default-selectivity | predicates estimated by default selectivities without statistics | 1 |",
+		"# Column Error Leaderboard", "| t.a | 1 |",
+	} {
+		if !strings.Contains(string(md), s) {
+			t.Fatalf("%q is not in the report", s)
+		}
+	}
+}
+
+func TestRemediations(t *testing.T) {
+	for content, valid := range map[string]bool{
+		"[remediation]\ncolumns = 3":                                                           true,
+		"[remediation]\ncolumns = 3\ncandidates = [\"topn\", \"buckets\"]":                     true,
+		"[remediation]\ncolumns = 3\ncandidates = [\"cms\"]":                                   false,
+		"[remediation]\ncolumns = -1":                                                          false,
+		"read-only = true\n[remediation]\ncolumns = 3":                                         false,
+		"[remediation]\ncolumns = 3\n[[datasets]]\nname = \"mock\"\nlabel = \"a\"\ndb = \"a\"": true,
+		"[remediation]\ncolumns = 3\n[[datasets]]\nname = \"mock\"\nlabel = \"a\"\ndb = \"a\"\n[[datasets]]\nname = \"mock\"\nlabel = \"b\"\ndb = \"a_remedy\"":                false,
+		"[remediation]\ncolumns = 3\n[[datasets]]\nname = \"mock\"\nlabel = \"a\"\ndb = \"a\"\n[[datasets]]\nname = \"mock\"\nlabel = \"b\"\ndb = \"b\"\ndbs = [\"A_remedy\"]": false,
+		"[remediation]\ncolumns = 3\n[[datasets]]\nname = \"mock\"\nlabel = \"a\"\ndb = \"a\"\n[datasets.scratch]\ndb = \"a_remedy\"":                                          false,
+		"[remediation]\ncolumns = 3\n[[datasets]]\nname = \"mock\"\nlabel = \"a\"\ndb = \"a\"\n[datasets.scratch]\ndb = \"a_scratch\"":                                         true,
+	} {
+		if _, err := cetest.DecodeOption(content); (err == nil) != valid {
+			t.Fatalf("content=%v, err=%v", content, err)
+		}
+	}
+
+	opt := cetest.Option{
+		QueryTypes: []cetest.QueryType{cetest.QTSingleColRangeQueryOnCol},
+		Datasets:   []cetest.DatasetOpt{{Label: "zipfx"}},
+		Instances:  []tidb.Option{{Label: "v6.5"}},
+		ReportDir:  "./test",
+	}
+	collector := cetest.NewEstResultCollector(1, 1, 1)
+	collector.AddEstResult(0, 0, 0, cetest.EstResult{SQL: "SELECT * FROM db.t WHERE a>1", EstCard: 100, TrueCard: 10,
+		Remediations: []cetest.RemediationResult{{Column: "t.a", Remediation: "topn", EstCard: 50}, {Column: "t.a", Remediation: "buckets", EstCard: 20}}})
+	collector.AddEstResult(0, 0, 0, cetest.EstResult{SQL: "SELECT * FROM db.t WHERE a>2", EstCard: 10, TrueCard: 10,
+		Remediations: []cetest.RemediationResult{{Column: "t.a", Remediation: "topn", EstCard: 10}, {Column: "t.a", Remediation: "buckets", EstCard: 10}}})
+	collector.AddEstResult(0, 0, 0, cetest.EstResult{SQL: "SELECT * FROM db.t WHERE b>2", EstCard: 10, TrueCard: 10,
+		Remediations: []cetest.RemediationResult{{Column: "t.b", Remediation: "buckets", EstCard: 20}}})
+	if err := cetest.GenPErrorBarChartsReport(opt, collector); err != nil {
+		t.Fatal(err)
+	}
+	md, err := ioutil.ReadFile(path.Join(opt.ReportDir, "report.md"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, s := range []string{"Suggested Statistics Fixes",
+		"| v6.5 | t.a | buckets (ANALYZE WITH 1024 BUCKETS) | 2 | 4.500 | 0.500 | 88.9% | topn: 2.000 |",
+		"| v6.5 | t.b | none | 1 | 0.000 | 1.000 | 0.0% | - |"} {
+		if !strings.Contains(string(md), s) {
+			t.Fatalf("%q is not in the report", s)
+		}
+	}
+}
+
+func TestReplicaGroup(t *testing.T) {
+	var analyzed [2]int32
+	replicas := make([]tidb.Instance, 2)
+	for i := range replicas {
+		i := i
+		ins, err := tidb.NewMockInstance(tidb.Option{Label: "v7.5"}, "v7.5.0", func(query string) ([]string, [][]string, error) {
+			if strings.HasPrefix(query, "ANALYZE") {
+				atomic.AddInt32(&analyzed[i], 1)
+			}
+			return []string{"replica"}, [][]string{{fmt.Sprint(i)}}, nil
+		})
+		if err != nil {
+			t.Fatal(err)
+		}
+		replicas[i] = ins
+	}
+	older, err := tidb.NewMockInstance(tidb.Option{Label: "v7.5"}, "v7.1.0", func(query string) ([]string, [][]string, error) {
+		return nil, nil, nil
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := tidb.NewReplicaGroup(tidb.Option{Label: "v7.5"}, []tidb.Instance{replicas[0], older}); err == nil {
+		t.Fatal("replicas of different versions are grouped")
+	}
+	g, err := tidb.NewReplicaGroup(tidb.Option{Label: "v7.5", Replicas: []string{"127.0.0.2:4000"}}, replicas)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer g.Close()
+
+	if err := g.Exec("ANALYZE TABLE db.t"); err != nil {
+		t.Fatal(err)
+	}
+	if analyzed != [2]int32{1, 1} {
+		t.Fatalf("ANALYZE is not applied to all replicas, %v", analyzed)
+	}
+	replicaOf := func(query string) string {
+		rows, err := g.Query(query)
+		if err != nil {
+			t.Fatal(err)
+		}
+		defer rows.Close()
+		var r string
+		if !rows.Next() {
+			t.Fatalf("no result of %v", query)
+		}
+		if err := rows.Scan(&r); err != nil {
+			t.Fatal(err)
+		}
+		return r
+	}
+	shards := make(map[string]int)
+	for i := 0; i < 20; i++ {
+		q := fmt.Sprintf("SELECT * FROM db.t WHERE a=%v", i)
+		r := replicaOf("EXPLAIN " + q)
+		if replicaOf("EXPLAIN ANALYZE "+q) != r || replicaOf("EXPLAIN FORMAT='brief' "+q) != r {
+			t.Fatalf("%v is explained and executed on different replicas", q)
+		}
+		shards[r]++
+	}
+	if shards["0"] == 0 || shards["1"] == 0 {
+		t.Fatalf("cases are not sharded across replicas, %v", shards)
+	}
+
+	for content, valid := range map[string]bool{
+		"[[instances]]\nlabel = \"v7.5\"\nreplicas = [\"127.0.0.2:4000\"]":                                                             true,
+		"executor = \"explain-analyze\"\n[write-load]\ninserts = 10\n[[instances]]\nlabel = \"v7.5\"\nreplicas = [\"127.0.0.2:4000\"]": false,
+	} {
+		if _, err := cetest.DecodeOption(content); (err == nil) != valid {
+			t.Fatalf("content=%v, err=%v", content, err)
+		}
+	}
+}
+
+func TestDistribute(t *testing.T) {
+	dir, err := ioutil.TempDir("", "cetest-distribute")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	conf := fmt.Sprintf(`report-dir = "%v"
+query-types = ["single-col-point-query-on-col"]
+[[datasets]]
+name = "zipfx"
+db = "zipfx"
+label = "zipfx"
+[[instances]]
+addr = "127.0.0.1"
+port = 4000
+label = "v6.5"
+[[instances]]
+addr = "127.0.0.2"
+port = 4000
+label = "v7.5"
+[history]
+dir = "%v"
+[email]
+addr = "smtp.example.com:587"
+from = "tester@example.com"
+to = ["dev@example.com"]
+password = "secret"
+[issues]
+min-p-error = 100.0
+[distribute]
+name = "nightly"
+image = "optimizer-tester:latest"
+volume = "reports"
+`, path.Join(dir, "local"), path.Join(dir, "history"))
+	confPath := path.Join(dir, "cetest.toml")
+	if err := ioutil.WriteFile(confPath, []byte(conf), 0666); err != nil {
+		t.Fatal(err)
+	}
+	if err := cetest.Distribute([]string{confPath}, path.Join(dir, "k8s")); err != nil {
+		t.Fatal(err)
+	}
+	jobs, err := ioutil.ReadFile(path.Join(dir, "k8s", "jobs.yaml"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, s := range []string{"kind: Secret", "stringData:", "secretName: nightly-config", "name: nightly-config", "  shard-1.toml: |", "name: nightly-shard-0", "name: nightly-shard-1",
+		`args: ["cetest", "--config", "/config/cetest.toml", "--config", "/config/shard-1.toml"]`, "claimName: reports"} {
+		if !strings.Contains(string(jobs), s) {
+			t.Fatalf("%q is not in jobs.yaml", s)
+		}
+	}
+	if strings.Contains(string(jobs), "ConfigMap") || strings.Contains(string(jobs), "configMap") {
+		t.Fatalf("configs holding passwords should not be in a ConfigMap")
+	}
+	merge, err := ioutil.ReadFile(path.Join(dir, "k8s", "merge-job.yaml"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !strings.Contains(string(merge), `args: ["merge-shards", "--config", "/config/cetest.toml", "--config", "/config/merge.toml"]`) {
+		t.Fatalf("unexpected merge job %v", string(merge))
+	}
+
+	// run shards by their overlays in the config map, and merge their results
+	overlay := regexp.MustCompile(`(?s)  shard-1.toml: \|\n(.*?)\n---`).FindSubmatch(jobs)
+	if overlay == nil {
+		t.Fatalf("no overlay of shard-1 in %v", string(jobs))
+	}
+	shard, err := cetest.DecodeOption(conf, strings.Replace(string(overlay[1]), "\n    ", "\n", -1)[4:])
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(shard.Instances) != 1 || shard.Instances[0].Label != "v7.5" || shard.ReportDir != "/report/shard-1" {
+		t.Fatalf("unexpected shard %+v", shard)
+	}
+	if shard.Email.Addr != "" || shard.Issues.MinPError != 0 || shard.History.Dir != "" {
+		t.Fatalf("shards should leave emails, issues and history to the merge job, email=%+v, issues=%+v, history=%+v",
+			shard.Email, shard.Issues, shard.History)
+	}
+	opt, err := cetest.DecodeOption(conf)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for insIdx, ins := range opt.Instances {
+		shardOpt := opt
+		shardOpt.Instances = []tidb.Option{ins}
+		shardOpt.ReportDir = path.Join(opt.ReportDir, fmt.Sprintf("shard-%v", insIdx))
+		shardOpt.ExportFormats = []string{"bin"}
+		collector := cetest.NewEstResultCollector(1, 1, 1)
+		collector.AddEstResult(0, 0, 0, cetest.EstResult{SQL: "SELECT * FROM zipfx.t WHERE a=1", EstCard: float64(insIdx + 1), TrueCard: 1})
+		if err := cetest.ExportRawResults(shardOpt, collector); err != nil {
+			t.Fatal(err)
+		}
+	}
+	opt.ExportFormats = []string{"csv"}
+	opt.Email.Addr, opt.Issues.MinPError = "", 0 // not sent or filed by tests without SMTP servers or instances
+	if err := cetest.MergeShards(opt); err != nil {
+		t.Fatal(err)
+	}
+	csv, err := ioutil.ReadFile(path.Join(opt.ReportDir, "results.csv"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, s := range []string{"v6.5,zipfx,single-col-point-query-on-col,SELECT * FROM zipfx.t WHERE a=1,1,1,0,",
+		"v7.5,zipfx,single-col-point-query-on-col,SELECT * FROM zipfx.t WHERE a=1,2,1,1,"} {
+		if !strings.Contains(string(csv), s) {
+			t.Fatalf("%q is not in merged results %v", s, string(csv))
+		}
+	}
+	if _, err := os.Stat(path.Join(opt.ReportDir, "report.md")); err != nil {
+		t.Fatal(err)
+	}
+	if runs, err := ioutil.ReadDir(path.Join(dir, "history")); err != nil || len(runs) != 1 {
+		t.Fatalf("the merged run should be recorded into history, runs=%v, err=%v", len(runs), err)
+	}
+}
+
+func TestParseExplainAnalyze(t *testing.T) {
+	header := []string{"id", "estRows", "actRows", "task", "access object", "execution info", "operator info", "memory", "disk"}
+	results := [][]string{
+		{"TableReader_7", "10.00", "8", "root", "", "time:1.5ms, loops:2, cop_task: {num: 1, max: 1ms, proc_keys: 8}", "data:Selection_6", "1.5 KB", "N/A"},
+		{"└─Selection_6", "10.00", "8", "cop[tikv]", "", "time:0s, loops:1", "eq(test.t.a, 1)", "N/A", "N/A"},
+		{"  └─TableFullScan_5", "10000.00", "10000", "cop[tikv]", "table:t", "time:0s, loops:10", "keep order:false", "N/A", "N/A"},
+	}
+	ops, err := cetest.ParseExplainAnalyze(header, results)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(ops) != 3 {
+		t.Fatalf("expected 3 operators, got %v", len(ops))
+	}
+	root := ops[0]
+	if root.ID != "TableReader_7" || root.ActRows != 8 || root.Loops != 2 || root.Time != 1500*time.Microsecond || root.MemBytes != 1536 || root.DiskBytes != -1 {
+		t.Fatalf("unexpected root %+v", root)
+	}
+	if root.ExecInfo["cop_task"] != "{num: 1, max: 1ms, proc_keys: 8}" {
+		t.Fatalf("unexpected cop_task %v", root.ExecInfo["cop_task"])
+	}
+	if ops[1].ID != "Selection_6" || ops[1].Depth != 1 || ops[2].ID != "TableFullScan_5" || ops[2].Depth != 2 || ops[2].ActRows != 10000 {
+		t.Fatalf("unexpected operators %+v", ops[1:])
+	}
+}
+
+func TestPlanFingerprint(t *testing.T) {
+	header := []string{"id", "estRows", "task", "access object", "operator info"}
+	plan := func(est1, est2 string, id int) [][]string {
+		return [][]string{
+			{fmt.Sprintf("IndexLookUp_%v", id), est1, "root", "", ""},
+			{fmt.Sprintf("├─IndexRangeScan_%v(Build)", id+1), est2, "cop[tikv]", "table:t, index:a(a)", "range:[1,1]"},
+			{fmt.Sprintf("└─Selection_%v(Probe)", id+2), est1, "cop[tikv]", "", "gt(test.t.b, 1)"},
+			{fmt.Sprintf("  └─TableRowIDScan_%v", id+3), est2, "cop[tikv]", "table:t", "keep order:false"},
+		}
+	}
+	fp := cetest.PlanFingerprint(header, plan("10.00", "20.00", 10))
+	expected := "IndexLookUp(IndexRangeScan(Build){table:t, index:a(a)},Selection(Probe)(TableRowIDScan{table:t}))"
+	if fp != expected {
+		t.Fatalf("expected %v, got %v", expected, fp)
+	}
+	if fp != cetest.PlanFingerprint(header, plan("1.00", "3.00", 20)) {
+		t.Fatalf("fingerprints of the same plan shape should be the same")
+	}
+}
+
+func TestCTEPlans(t *testing.T) {
+	header := []string{"id", "estRows", "actRows", "task", "access object", "execution info", "operator info", "memory", "disk"}
+	results := [][]string{
+		{"Union_17", "20.00", "16", "root", "", "time:1ms, loops:2", "", "N/A", "N/A"},
+		{"├─CTEFullScan_19", "10.00", "8", "root", "CTE:cte", "time:0.5ms, loops:1", "data:CTE_0", "1 KB", "0 Bytes"},
+		{"└─CTEFullScan_20", "10.00", "8", "root", "CTE:cte", "time:0.5ms, loops:1", "data:CTE_0", "1 KB", "0 Bytes"},
+		{"CTE_0", "10.00", "8", "root", "", "time:0.8ms, loops:1", "Non-Recursive CTE", "1 KB", "0 Bytes"},
+		{"└─TableReader_14", "10.00", "8", "root", "", "time:0.7ms, loops:1", "data:Selection_13", "1 KB", "N/A"},
+		{"  └─TableFullScan_12", "10000.00", "10000", "cop[tikv]", "table:t", "time:0.6ms, loops:1", "keep order:false", "N/A", "N/A"},
+	}
+	ops, err := cetest.ParseExplainAnalyze(header, results)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for i, tree := range []int{0, 0, 0, 1, 1, 1} {
+		if ops[i].Tree != tree {
+			t.Fatalf("operator %v should be in tree %v, got %v", ops[i].ID, tree, ops[i].Tree)
+		}
+	}
+	expected := "Union(CTEFullScan{CTE:cte},CTEFullScan{CTE:cte});CTE(TableReader(TableFullScan{table:t}))"
+	if fp := cetest.PlanFingerprint(header, results); fp != expected {
+		t.Fatalf("expected %v, got %v", expected, fp)
+	}
+
+	ins, err := tidb.NewMockInstance(tidb.Option{Label: "mock"}, "v7.5.0", func(query string) ([]string, [][]string, error) {
+		if strings.HasPrefix(query, "EXPLAIN") {
+			return []string{"id", "estRows", "task", "access object", "operator info"}, [][]string{
+				{"Union_17", "20.00", "root", "", ""},
+				{"├─CTEFullScan_19", "10.00", "root", "CTE:cte", "data:CTE_0"},
+				{"└─CTEFullScan_20", "10.00", "root", "CTE:cte", "data:CTE_0"},
+				{"CTE_0", "10.00", "root", "", "Non-Recursive CTE"},
+				{"└─TableReader_14", "10.00", "root", "", "data:TableFullScan_12"},
+				{"  └─TableFullScan_12", "100.00", "cop[tikv]", "table:t", "keep order:false"},
+			}, nil
+		}
+		return nil, nil, nil
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer ins.Close()
+	opt, err := cetest.DecodeOption(`
+[[datasets]]
+name = "mock"
+db = "mock"
+label = "mock"
+[datasets.mock]
+rows = 100
+ndv = 10
+`)
+	if err != nil {
+		t.Fatal(err)
+	}
+	ds, err := cetest.NewDataset(opt.Datasets[0])
+	if err != nil {
+		t.Fatal(err)
+	}
+	rs, err := ds.GenEstResults(ins, 10, cetest.QTSingleColCTEQueryOnCol)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, r := range rs {
+		if !strings.HasPrefix(r.SQL, "WITH cte AS (") || !r.HasTag(cetest.TagCTEMaterialized) || r.EstCard != 20 || int(r.TrueCard)%2 != 0 {
+			t.Fatalf("unexpected result %+v", r)
+		}
+	}
+}
+
+func TestRecursiveCTEQuery(t *testing.T) {
+	// 1 -> (2 -> (4, 5), 3)
+	edges := [][]string{{"1", "0"}, {"2", "1"}, {"3", "1"}, {"4", "2"}, {"5", "2"}}
+	ins, err := tidb.NewMockInstance(tidb.Option{Label: "mock"}, "v7.5.0", func(query string) ([]string, [][]string, error) {
+		switch {
+		case strings.HasPrefix(query, "SELECT id, parent_id FROM"):
+			return []string{"id", "parent_id"}, edges, nil
+		case strings.HasPrefix(query, "EXPLAIN"):
+			return []string{"id", "estRows", "task", "access object", "operator info"}, [][]string{
+				{"CTEFullScan_22", "3.00", "root", "CTE:sub", "data:CTE_0"},
+				{"CTE_0", "3.00", "root", "", "Recursive CTE"},
+				{"├─Point_Get_12(Seed Part)", "1.00", "root", "table:thier", "handle:1"},
+				{"└─IndexJoin_17(Recursive Part)", "2.00", "root", "", "inner join"},
+			}, nil
+		}
+		return nil, nil, nil
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer ins.Close()
+	ds, err := cetest.NewDataset(cetest.DatasetOpt{Name: "hierarchy", DB: "test", Label: "hierarchy"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	rs, err := ds.GenEstResults(ins, 0, cetest.QTRecursiveCTEQuery)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(rs) != len(edges) {
+		t.Fatalf("expect %v results, got %v", len(edges), len(rs))
+	}
+	sizes := map[string]float64{"1": 5, "2": 3, "3": 1, "4": 1, "5": 1}
+	for _, r := range rs {
+		var id string
+		for node := range sizes {
+			if strings.Contains(r.SQL, "WHERE id = "+node+" ") {
+				id = node
+			}
+		}
+		if r.TrueCard != sizes[id] || r.EstCard != 3 || r.HasTag(cetest.TagLeaf) != (sizes[id] == 1) {
+			t.Fatalf("unexpected result %+v", r)
+		}
+	}
+}
+
+func TestApplyQuery(t *testing.T) {
+	header := []string{"id", "estRows", "task", "access object", "operator info"}
+	plans := map[string][][]string{
+		"apply": {
+			{"Apply_12", "8.00", "root", "", "semi join, equal:[eq(t1.b, t2.b)]"},
+			{"├─TableReader_15(Build)", "10.00", "root", "", "data:Selection_14"},
+			{"│ └─Selection_14", "10.00", "cop[tikv]", "", "eq(t1.b, 1)"},
+			{"│   └─TableFullScan_13", "100.00", "cop[tikv]", "table:t1", "keep order:false"},
+			{"└─Limit_18(Probe)", "1.00", "root", "", "offset:0, count:1"},
+			{"  └─TableReader_22", "4.00", "root", "", "data:Selection_21"},
+			{"    └─Selection_21", "4.00", "cop[tikv]", "", "eq(t2.b, t1.b)"},
+			{"      └─TableFullScan_20", "100.00", "cop[tikv]", "table:t2", "keep order:false"},
+		},
+		"join": {
+			{"HashJoin_10", "6.00", "root", "", "semi join, equal:[eq(t1.b, t2.b)]"},
+			{"├─TableReader_15(Build)", "10.00", "root", "", "data:Selection_14"},
+			{"└─TableReader_12(Probe)", "10.00", "root", "", "data:Selection_11"},
+		},
+	}
+	plan := "apply"
+	ins, err := tidb.NewMockInstance(tidb.Option{Label: "mock"}, "v7.5.0", func(query string) ([]string, [][]string, error) {
+		if strings.HasPrefix(query, "EXPLAIN") {
+			return header, plans[plan], nil
+		}
+		return nil, nil, nil
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer ins.Close()
+	opt, err := cetest.DecodeOption(`
+[[datasets]]
+name = "mock"
+db = "mock"
+label = "mock"
+[datasets.mock]
+rows = 100
+ndv = 10
+`)
+	if err != nil {
+		t.Fatal(err)
+	}
+	ds, err := cetest.NewDataset(opt.Datasets[0])
+	if err != nil {
+		t.Fatal(err)
+	}
+	for p, est := range map[string]float64{"apply": 4, "join": 6} {
+		plan = p
+		rs, err := ds.GenEstResults(ins, 5, cetest.QTSingleColApplyQueryOnCol)
+		if err != nil {
+			t.Fatal(err)
+		}
+		for _, r := range rs {
+			if !strings.Contains(r.SQL, "NO_DECORRELATE") || r.EstCard != est || !r.HasTag(cetest.TagCorrelated) || r.HasTag(cetest.TagDecorrelated) != (p == "join") {
+				t.Fatalf("unexpected result %+v of the %v plan", r, p)
+			}
+		}
+	}
+}
+
+func TestAnonymizeSQL(t *testing.T) {
+	sql := "SELECT * FROM imdb.title WHERE phonetic_code='A5362' AND `kind_id`=7 AND production_year>=1.5e3"
+	anonymized := cetest.AnonymizeSQL(sql, "salt")
+	for _, leaked := range []string{"imdb", "title", "phonetic_code", "A5362", "kind_id", "=7 ", "1.5e3"} {
+		if strings.Contains(anonymized, leaked) {
+			t.Fatalf("%v is leaked in %v", leaked, anonymized)
+		}
+	}
+	if !strings.HasPrefix(anonymized, "SELECT * FROM id_") {
+		t.Fatalf("unexpected anonymized sql %v", anonymized)
+	}
+	if anonymized != cetest.AnonymizeSQL(sql, "salt") || anonymized == cetest.AnonymizeSQL(sql, "another-salt") {
+		t.Fatal("anonymization should be deterministic for the same salt")
+	}
+
+	if _, err := cetest.DecodeOption(`anonymize = true`); err == nil {
+		t.Fatal("anonymize without a salt should be rejected")
+	}
+	opt, err := cetest.DecodeOption(`
+anonymize = true
+anonymize-salt = "salt"`)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !opt.Anonymize || opt.AnonymizeSalt != "salt" {
+		t.Fatalf("unexpected option %+v", opt)
+	}
+}
+
+func TestExportRawResults(t *testing.T) {
+	opt := cetest.Option{
+		QueryTypes:    []cetest.QueryType{cetest.QTMulColsPointQueryOnIndex},
+		Datasets:      []cetest.DatasetOpt{{Label: "zipfx"}},
+		Instances:     []tidb.Option{{Label: "v4.0"}, {Label: "master"}},
+		ReportDir:     "./test",
+		ExportFormats: []string{"csv", "parquet"},
+	}
+	collector := randEstResultCollector(opt, 100)
+	if rs := cetest.CollectRawResults(opt, collector); len(rs) != 200 {
+		t.Fatalf("expected 200 raw results, got %v", len(rs))
+	}
+	if err := cetest.ExportRawResults(opt, collector); err != nil {
+		t.Fatal(err)
+	}
+	for _, f := range []string{"results.csv", "results.parquet"} {
+		if info, err := os.Stat(path.Join(opt.ReportDir, f)); err != nil || info.Size() == 0 {
+			t.Fatalf("%v is not exported, err=%v", f, err)
+		}
+	}
+}
+
+func TestBinaryRawResults(t *testing.T) {
+	opt := cetest.Option{
+		QueryTypes:    []cetest.QueryType{cetest.QTMulColsPointQueryOnIndex},
+		Datasets:      []cetest.DatasetOpt{{Label: "zipfx"}},
+		Instances:     []tidb.Option{{Label: "v4.0"}, {Label: "master"}},
+		ReportDir:     "./test",
+		ExportFormats: []string{"bin", "csv"},
+	}
+	collector := randEstResultCollector(opt, 100)
+	if err := cetest.ExportRawResults(opt, collector); err != nil {
+		t.Fatal(err)
+	}
+	bin := path.Join(opt.ReportDir, "results.bin")
+	rs, err := cetest.ReadRawResults(bin)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if expected := cetest.CollectRawResults(opt, collector); !reflect.DeepEqual(rs, expected) {
+		t.Fatalf("results read from %v mismatch exported ones", bin)
+	}
+	binInfo, err1 := os.Stat(bin)
+	csvInfo, err2 := os.Stat(path.Join(opt.ReportDir, "results.csv"))
+	if err1 != nil || err2 != nil || binInfo.Size() >= csvInfo.Size() {
+		t.Fatalf("binary results should be smaller than CSV ones")
+	}
+
+	jsonPath := path.Join(opt.ReportDir, "converted.json")
+	if err := cetest.ConvertRawResults(bin, jsonPath); err != nil {
+		t.Fatal(err)
+	}
+	content, err := ioutil.ReadFile(jsonPath)
+	if err != nil {
+		t.Fatal(err)
+	}
+	lines := strings.Split(strings.TrimSpace(string(content)), "\n")
+	var first cetest.RawResult
+	if err := json.Unmarshal([]byte(lines[0]), &first); err != nil {
+		t.Fatal(err)
+	}
+	if len(lines) != len(rs) || first != rs[0] {
+		t.Fatalf("unexpected converted results %v", lines[0])
+	}
+	if err := cetest.ConvertRawResults(bin, path.Join(opt.ReportDir, "converted.txt")); err == nil {
+		t.Fatal("unknown formats should be rejected")
+	}
+}
+
+func TestCollectorSpill(t *testing.T) {
+	dir, err := ioutil.TempDir("", "collector")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	collector, err := cetest.NewEstResultCollectorWithOpt(1, 1, 4, cetest.CollectorOpt{MemoryLimitMB: 1, SpillDir: dir})
+	if err != nil {
+		t.Fatal(err)
+	}
+	sql := strings.Repeat("x", 1000)
+	for qtIdx := 0; qtIdx < 4; qtIdx++ {
+		for i := 0; i < 500; i++ {
+			collector.AddEstResult(0, 0, qtIdx, cetest.EstResult{SQL: sql, EstCard: float64(i), Labels: map[string]string{"qt": fmt.Sprint(qtIdx)}})
+		}
+	}
+	mem, ok := cetest.CollectorMemoryOf(collector)
+	if !ok || mem.SpilledCells == 0 || mem.Bytes > 1<<20 {
+		t.Fatalf("cold cells should be spilled, got %v", mem)
+	}
+	for qtIdx := 0; qtIdx < 4; qtIdx++ {
+		rs := collector.EstResults(0, 0, qtIdx)
+		if len(rs) != 500 || rs[499].EstCard != 499 || rs[0].SQL != sql || rs[0].Labels["qt"] != fmt.Sprint(qtIdx) {
+			t.Fatalf("results of cell %v are lost after spilling", qtIdx)
+		}
+	}
+	collector.UpdateEstResult(0, 0, 0, 1, cetest.EstResult{SQL: "q", EstCard: 100})
+	if rs := collector.EstResults(0, 0, 0); rs[1].EstCard != 100 {
+		t.Fatalf("updates of spilled cells are lost")
+	}
+	if err := collector.(io.Closer).Close(); err != nil {
+		t.Fatal(err)
+	}
+	if files, _ := ioutil.ReadDir(dir); len(files) != 0 {
+		t.Fatalf("spilled cells should be removed after closing")
+	}
+}
+
+func TestImportEstResults(t *testing.T) {
+	opt := cetest.Option{
+		QueryTypes: []cetest.QueryType{cetest.QTMulColsPointQueryOnIndex},
+		Datasets:   []cetest.DatasetOpt{{Label: "zipfx"}},
+		Instances:  []tidb.Option{{Label: "v4.0"}},
+		ReportDir:  "./test",
+	}
+	if err := os.MkdirAll(opt.ReportDir, 0755); err != nil {
+		t.Fatal(err)
+	}
+	csvPath := path.Join(opt.ReportDir, "imported.csv")
+	content := "engine,query,est,act\nproto,SELECT * FROM t WHERE a=1,10,20\nproto,SELECT * FROM t WHERE a=2,5,5\npg,SELECT * FROM t WHERE a=1,1,20\n"
+	if err := ioutil.WriteFile(csvPath, []byte(content), 0666); err != nil {
+		t.Fatal(err)
+	}
+	opt.Imports = []cetest.ImportOpt{{Path: csvPath, Dataset: "zipfx", QueryType: cetest.QTMulColsPointQueryOnIndex.String()}}
+
+	opt, collector, err := cetest.ImportEstResults(opt)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(opt.Instances) != 3 || opt.Instances[1].Label != "proto" || opt.Instances[2].Label != "pg" {
+		t.Fatalf("unexpected instances %v", opt.Instances)
+	}
+	if len(collector.EstResults(1, 0, 0)) != 2 || len(collector.EstResults(2, 0, 0)) != 1 {
+		t.Fatal("unexpected imported results")
+	}
+}
+
+func TestDecodeGuardOption(t *testing.T) {
+	for content, valid := range map[string]bool{
+		"[guard]\nmax-execution-time = \"10s\"\nmem-quota-mb = 512": true,
+		"[guard]\nmax-scan-rows = 1000000.0":                        true,
+		"[guard]\nmax-execution-time = \"10\"":                      false,
+		"[guard]\nmax-execution-time = \"10us\"":                    false,
+		"[guard]\nmem-quota-mb = -1":                                false,
+	} {
+		if _, err := cetest.DecodeOption(content); (err == nil) != valid {
+			t.Fatalf("content=%v, err=%v", content, err)
+		}
+	}
+}
+
+func TestParseBuildInfo(t *testing.T) {
+	out := "Release Version: v7.6.0-alpha-123-gabcdef\nEdition: Community\nGit Commit Hash: abcdef\nGit Branch: master\nUTC Build Time: 2023-12-01 08:00:00"
+	b := tidb.ParseBuildInfo(out)
+	if b.Release != "v7.6.0-alpha-123-gabcdef" || b.Commit != "abcdef" || b.Branch != "master" {
+		t.Fatalf("unexpected build info %v", b)
+	}
+	for release, ver := range map[string]string{
+		b.Release: "v7.6.0",
+		"v4.0.0":  "v4.0.0",
+		"6.5":     "v6.5.0",
+		"None":    "",
+	} {
+		if v := tidb.NormalizeVersion(release); v != ver {
+			t.Fatalf("release=%v, expected %v, got %v", release, ver, v)
+		}
+	}
+}
+
+func TestDecodeOptionWithOverlays(t *testing.T) {
+	base := `
+query-types = ["single-col-point-query-on-col"]
+report-dir = "./base"
+n-samples = 100
+
+[guard]
+max-execution-time = "10s"
 
 [[datasets]]
-name = "tpcc"
-db = "tpcc10G"
-label = "tpcc10G"
+name = "zipfx"
+db = "test"
+label = "zipf"
+`
+	nightly := `
+n-samples = 1000
+
+[guard]
+mem-quota-mb = 512
+`
+	opt, err := cetest.DecodeOption(base, nightly)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if opt.NSamples != 1000 || opt.ReportDir != "./base" || len(opt.Datasets) != 1 || len(opt.QueryTypes) != 1 {
+		t.Fatalf("unexpected merged option %+v", opt)
+	}
+	if opt.Guard.MaxExecutionTime != "10s" || opt.Guard.MemQuotaMB != 512 {
+		t.Fatalf("tables should be merged recursively, got %+v", opt.Guard)
+	}
+}
+
+func TestListQueryTypes(t *testing.T) {
+	for _, qt := range cetest.ListQueryTypes() {
+		if qt.Name == "" || qt.Example == "" {
+			t.Fatalf("query type %v has no name or example", qt)
+		}
+	}
+	for _, ds := range cetest.ListDatasets() {
+		if len(ds.Tables) == 0 || len(ds.QueryTypes) == 0 {
+			t.Fatalf("dataset %v has no tables or query types", ds.Name)
+		}
+	}
+}
+
+func TestGenConfig(t *testing.T) {
+	conf, err := cetest.GenConfig([]string{"imdb", "zipfx"}, 2)
+	if err != nil {
+		t.Fatal(err)
+	}
+	opt, err := cetest.DecodeOption(conf)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(opt.Datasets) != 2 || len(opt.Instances) != 2 || len(opt.QueryTypes) == 0 {
+		t.Fatalf("unexpected generated option %+v", opt)
+	}
+	if _, err := cetest.GenConfig([]string{"unknown"}, 2); err == nil {
+		t.Fatal("unknown datasets should be rejected")
+	}
+}
+
+func TestDecodeStatsCheckOption(t *testing.T) {
+	for content, valid := range map[string]bool{
+		"[stats-check]\nmin-healthy = 80":                                         true,
+		"[stats-check]\nmin-healthy = 80\naction = \"analyze\"":                   true,
+		"read-only = true\n[stats-check]\nmin-healthy = 80\naction = \"analyze\"": false,
+		"[stats-check]\nmin-healthy = 180":                                        false,
+		"[stats-check]\naction = \"ignore\"":                                      false,
+	} {
+		if _, err := cetest.DecodeOption(content); (err == nil) != valid {
+			t.Fatalf("content=%v, err=%v", content, err)
+		}
+	}
+}
+
+func TestDecodeStatsMonitorOption(t *testing.T) {
+	for content, valid := range map[string]bool{
+		"[stats-monitor]\naction = \"warn\"":                      true,
+		"[stats-monitor]\naction = \"pause\"\ninterval = \"30s\"": true,
+		"[stats-monitor]\naction = \"lock\"":                      true,
+		"read-only = true\n[stats-monitor]\naction = \"lock\"":    false,
+		"[stats-monitor]\naction = \"analyze\"":                   false,
+		"[stats-monitor]\naction = \"warn\"\ninterval = \"0s\"":   false,
+	} {
+		if _, err := cetest.DecodeOption(content); (err == nil) != valid {
+			t.Fatalf("content=%v, err=%v", content, err)
+		}
+	}
+}
+
+func TestDecodeControlOption(t *testing.T) {
+	for content, valid := range map[string]bool{
+		"control = \"127.0.0.1:9090\"":        true,
+		"control = \"localhost:9090\"":        true,
+		"control = \"[::1]:9090\"":            true,
+		"control = \"unix:/tmp/cetest.sock\"": true,
+		"control = \"0.0.0.0:9090\"":          false,
+		"control = \"10.0.0.1:9090\"":         false,
+		"control = \"127.0.0.1\"":             false,
+		"control = \"unix:\"":                 false,
+	} {
+		if _, err := cetest.DecodeOption(content); (err == nil) != valid {
+			t.Fatalf("content=%v, err=%v", content, err)
+		}
+	}
+}
+
+func TestDecodeLockStatsOption(t *testing.T) {
+	for content, valid := range map[string]bool{
+		"lock-stats = true": true,
+		"lock-stats = true\n[stats-monitor]\naction = \"warn\"": true,
+		"lock-stats = true\n[stats-monitor]\naction = \"lock\"": false,
+		"lock-stats = true\nread-only = true":                   false,
+	} {
+		if _, err := cetest.DecodeOption(content); (err == nil) != valid {
+			t.Fatalf("content=%v, err=%v", content, err)
+		}
+	}
+}
+
+func TestDecodeSnapshotOption(t *testing.T) {
+	for content, valid := range map[string]bool{
+		"executor = \"explain-analyze\"\nsnapshot = \"now\"":                 true,
+		"executor = \"count-verify\"\nsnapshot = \"446312097402388481\"":     true,
+		"executor = \"explain-analyze\"\nsnapshot = \"2024-01-01 10:00:00\"": true,
+		"executor = \"explain-analyze\"\nsnapshot = \"yesterday\"":           false,
+		"executor = \"explain\"\nsnapshot = \"now\"":                         false,
+		"snapshot = \"now\"": false,
+	} {
+		if _, err := cetest.DecodeOption(content); (err == nil) != valid {
+			t.Fatalf("content=%v, err=%v", content, err)
+		}
+	}
+}
 
+func TestDecodeScratchOption(t *testing.T) {
+	ds := "[[datasets]]\nname = \"zipfx\"\ndb = \"zipfx\"\nlabel = \"zipfx\"\n"
+	opt, err := cetest.DecodeOption(ds + "[datasets.scratch]\ndb = \"zipfx_scratch\"\nsample-rate = 0.1")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if opt.Datasets[0].DB != "zipfx_scratch" {
+		t.Fatalf("cases should run on the scratch database instead of %v", opt.Datasets[0].DB)
+	}
+	for content, valid := range map[string]bool{
+		ds: true,
+		ds + "[datasets.scratch]\ndb = \"zipfx\"":                                             false,
+		ds + "[datasets.scratch]\ndb = \"zipfx_scratch\"\nsample-rate = 1.5":                  false,
+		"read-only = true\n" + ds + "[datasets.scratch]\ndb = \"zipfx_scratch\"":              false,
+		ds + "[datasets.scratch]\ndb = \"mysql\"":                                             false,
+		ds + "[datasets.scratch]\ndb = \"INFORMATION_SCHEMA\"":                                false,
+		ds + "[datasets.scratch]\ndb = \"imdb\"\n" + strings.Replace(ds, "zipfx", "imdb", -1): false,
+		ds + "[datasets.scratch]\ndb = \"s\"\n" + strings.Replace(ds, "\"zipfx\"\nlabel = \"zipfx\"", "\"tpcc\"\nlabel = \"tpcc\"", 1) + "[datasets.scratch]\ndb = \"s\"":        false,
+		"[[what-if-indexes]]\ndb = \"zipfx\"\ntable = \"tint\"\ncolumns = [\"a\"]\nmode = \"scratch\"\n" + strings.Replace(ds, "\"zipfx\"\nlabel", "\"zipfx_whatif\"\nlabel", 1): false,
+	} {
+		if _, err := cetest.DecodeOption(content); (err == nil) != valid {
+			t.Fatalf("content=%v, err=%v", content, err)
+		}
+	}
+}
+
+func TestDecodeSetupInReadOnlyMode(t *testing.T) {
+	content := `
+read-only = true
 
 [[datasets]]
-name = "tpcc"
-db = "tpcc50G"
-label = "tpcc50G"
+name = "zipfx"
+db = "test"
+label = "zipf"
+setup = ["CREATE INDEX idx_b ON test.tint(b)"]
+`
+	if _, err := cetest.DecodeOption(content); err == nil {
+		t.Fatal("setup modifying data should be rejected in read-only mode")
+	}
+}
+
+func TestGroupByLabel(t *testing.T) {
+	rs := []cetest.EstResult{
+		{SQL: "q1", Labels: map[string]string{"analyze-version": "2", "index": "with"}},
+		{SQL: "q2", Labels: map[string]string{"analyze-version": "1"}},
+		{SQL: "q3"},
+	}
+	if dims := cetest.LabelDims(rs); fmt.Sprint(dims) != "[analyze-version index]" {
+		t.Fatalf("unexpected dims %v", dims)
+	}
+	vals, groups := cetest.GroupByLabel(rs, "analyze-version")
+	if fmt.Sprint(vals) != "[ 1 2]" || groups["2"][0].SQL != "q1" || groups[""][0].SQL != "q3" {
+		t.Fatalf("unexpected groups %v %v", vals, groups)
+	}
+	if l := rs[0].LabelText(); l != "analyze-version=2;index=with" {
+		t.Fatalf("unexpected label text %v", l)
+	}
 
+	// results of runs of the matrix are keyed by their labels in a collector
+	collector := cetest.NewEstResultCollector(1, 1, 1)
+	for i := 0; i < 10; i++ {
+		for _, v := range []string{"1", "2"} {
+			collector.AddEstResult(0, 0, 0, cetest.EstResult{SQL: fmt.Sprint("q", i), EstCard: 10, TrueCard: float64(10 * (i%2 + 1)),
+				Labels: map[string]string{"analyze-version": v}})
+		}
+	}
+	collector.AddEstResult(0, 0, 0, cetest.EstResult{SQL: "q10", EstCard: 1, TrueCard: 1})
+	if sets := collector.LabelSets(); fmt.Sprint(sets) != "[ analyze-version=1 analyze-version=2]" {
+		t.Fatalf("unexpected label sets %v", sets)
+	}
+	if rs := collector.LabeledEstResults("analyze-version=2", 0, 0, 0); len(rs) != 10 || rs[0].Labels["analyze-version"] != "2" {
+		t.Fatalf("unexpected labeled results %v", rs)
+	}
+	if rs := collector.LabeledEstResults("", 0, 0, 0); len(rs) != 1 || rs[0].SQL != "q10" {
+		t.Fatalf("unexpected unlabeled results %v", rs)
+	}
+	opt, err := cetest.DecodeOption(`
+query-types = ["single-col-point-query-on-col"]
+report-dir = "./test"
 [[instances]]
-addr = "127.0.0.1"
-port = 4000
-user = "root"
-password = "123456"
-label = "v4.0"
+label = "mock"
+[[datasets]]
+name = "mock"
+label = "mock"
+`)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := cetest.GenPErrorBarChartsReport(opt, collector); err != nil {
+		t.Fatal(err)
+	}
+	md, err := ioutil.ReadFile(path.Join(opt.ReportDir, "report.md"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, s := range []string{"Absolute PError by labels", "| - | mock | 1 |", "| `analyze-version=1` | mock | 10 |", "| `analyze-version=2` | mock | 10 |"} {
+		if !strings.Contains(string(md), s) {
+			t.Fatalf("%q is not in the report", s)
+		}
+	}
+}
 
+func TestDecodeEmailOption(t *testing.T) {
+	for content, valid := range map[string]bool{
+		"[email]\naddr = \"smtp.example.com:587\"\nfrom = \"a@example.com\"\nto = [\"b@example.com\"]": true,
+		"[email]\naddr = \"smtp.example.com\"\nfrom = \"a@example.com\"\nto = [\"b@example.com\"]":     false,
+		"[email]\naddr = \"smtp.example.com:587\"\nfrom = \"a@example.com\"":                           false,
+	} {
+		if _, err := cetest.DecodeOption(content); (err == nil) != valid {
+			t.Fatalf("content=%v, err=%v", content, err)
+		}
+	}
+}
 
-[[instances]]
-addr = "127.0.0.1"
-port = 4001
-user = "root"
-password = "123456"
-label = "master"
-`
-	opt, err := cetest.DecodeOption(content)
+func TestSingleColConds(t *testing.T) {
+	ints := cetest.NewSingleColQuerier(cetest.DTInt, []string{"-1", "0", "9223372036854775807"}, []int{2, 3, 5}, 4)
+	single := cetest.NewSingleColQuerier(cetest.DTInt, []string{"7"}, []int{3}, 4)
+	noNull := cetest.NewSingleColQuerier(cetest.DTInt, []string{"7"}, []int{3}, 0)
+	strs := cetest.NewSingleColQuerier(cetest.DTString, []string{"a'b", "%", "é", "éa"}, []int{1, 2, 3, 4}, 0)
+	quoted := cetest.NewSingleColQuerier(cetest.DTString, []string{"a'b"}, []int{1}, 0)
+	empty := cetest.NewSingleColQuerier(cetest.DTString, []string{"", "x"}, []int{1, 2}, 0)
+	nulls := cetest.NewSingleColQuerier(cetest.DTInt, nil, nil, 6)
+	latest := cetest.NewSingleColQuerier(cetest.DTInt, []string{"1", "2", "3"}, []int{1, 1, 1}, 0)
+	for _, c := range []struct {
+		gen  func() (string, int)
+		cond string
+		act  int
+	}{
+		{func() (string, int) { return ints.PointCond(2) }, "c=9223372036854775807", 5},
+		{func() (string, int) { return strs.PointCond(0) }, "c='a''b'", 1},
+		{single.NullRangeCond, "c IS NULL OR (c>=7 AND c<=7)", 7},
+		{noNull.NullRangeCond, "c IS NULL OR (c>=7 AND c<=7)", 3},
+		{single.RangeCond, "c>=7 AND c<=7", 3},
+		{latest.LatestRangeCond, "c>=3", 1},
+		{func() (string, int) { return strs.PrefixLikeCond(1) }, `c LIKE '\\%%'`, 2},
+		{func() (string, int) { return strs.PrefixLikeCond(2) }, "c LIKE 'é%'", 7},
+		{func() (string, int) { return empty.PrefixLikeCond(0) }, "c LIKE '%'", 3},
+		{nulls.RangeCond, "c IS NOT NULL", 0},
+		{nulls.NullRangeCond, "c IS NULL OR (c IS NOT NULL)", 6},
+		{nulls.LatestRangeCond, "c IS NOT NULL", 0},
+		{func() (string, int) { return single.InCond(0) }, "c IN (7)", 3},
+		{func() (string, int) { return quoted.InCond(0) }, "c IN ('a''b')", 1},
+		{func() (string, int) { return ints.BoundaryCond(0) }, "c=0", 3},
+		{func() (string, int) { return ints.BoundaryCond(1) }, "c=-1", 2},
+		{func() (string, int) { return ints.BoundaryCond(12 + 9) }, "c>=9223372036854775807", 5},
+		{func() (string, int) { return ints.BoundaryCond(12 + 10) }, "c>=9223372036854775808", 0},
+		{func() (string, int) { return ints.BoundaryCond(24 + 0) }, "c<0", 2},
+		{func() (string, int) { return ints.BoundaryCond(24 + 8) }, "c<-9223372036854775808", 0},
+		{func() (string, int) { return ints.BoundaryCond(24 + 11) }, "c<18446744073709551615", 10},
+	} {
+		if cond, act := c.gen(); cond != c.cond || act != c.act {
+			t.Fatalf("expected %v with %v rows, got %v with %v rows", c.cond, c.act, cond, act)
+		}
+	}
+	if cetest.NumBoundaryCases != 36 {
+		t.Fatalf("unexpected number of boundary cases %v", cetest.NumBoundaryCases)
+	}
+	for i := 0; i < cetest.NumBoundaryCases; i++ {
+		if cond, _ := ints.BoundaryCond(i); cetest.LintSQL("SELECT * FROM db.t WHERE "+cond) != nil {
+			t.Fatalf("invalid boundary condition %v", cond)
+		}
+	}
+
+	// random ranges and IN lists of 100 values of 1 row each
+	vals, cnts := make([]string, 100), make([]int, 100)
+	for i := range vals {
+		vals[i], cnts[i] = strconv.Itoa(i), 1
+	}
+	wide := cetest.NewSingleColQuerier(cetest.DTInt, vals, cnts, 10)
+	for i := 0; i < 100; i++ {
+		var low, high int
+		cond, act := wide.NullRangeCond()
+		if _, err := fmt.Sscanf(cond, "c IS NULL OR (c>=%d AND c<=%d)", &low, &high); err != nil || low > high || act != high-low+1+10 {
+			t.Fatalf("unexpected condition %v with %v rows", cond, act)
+		}
+		cond, act = wide.LatestRangeCond()
+		if _, err := fmt.Sscanf(cond, "c>=%d", &low); err != nil || low < 94 || act != 100-low {
+			t.Fatalf("unexpected condition %v with %v rows", cond, act)
+		}
+		cond, act = wide.InCond(i)
+		list := strings.Split(strings.TrimSuffix(strings.TrimPrefix(cond, "c IN ("), ")"), ", ")
+		contained := false
+		for _, v := range list {
+			contained = contained || v == vals[i]
+		}
+		if !contained || len(list) != act || act > 8 {
+			t.Fatalf("unexpected condition %v with %v rows of value %v", cond, act, vals[i])
+		}
+	}
+}
+
+func TestSingleColQueries(t *testing.T) {
+	q := cetest.NewSingleColQuerier(cetest.DTInt, []string{"1", "2"}, []int{3, 4}, 2)
+	for _, c := range []struct {
+		qt     cetest.QueryType
+		rowIdx int
+		sql    string
+		act    int
+	}{
+		{cetest.QTSingleColPointQueryOnCol, 0, "SELECT * FROM db.t WHERE c=1", 3},
+		{cetest.QTSingleColPointQueryOnIndex, 1, "SELECT * FROM db.t WHERE c=2", 4},
+		{cetest.QTSingleColMCVPointOnCol, 1, "SELECT * FROM db.t WHERE c=2", 4},
+		{cetest.QTSingleColMCVPointOnIndex, 0, "SELECT * FROM db.t WHERE c=1", 3},
+		{cetest.QTSingleColBoundaryQueryOnCol, 2, "SELECT * FROM db.t WHERE c=1", 3},
+		{cetest.QTSingleColBoundaryQueryOnCol, 24, "SELECT * FROM db.t WHERE c<0", 0},
+		{cetest.QTSingleColPointGetQueryOnUniqueKey, 0, "SELECT * FROM db.t WHERE c=1", 3},
+		{cetest.QTSingleColCTEQueryOnCol, 1, "WITH cte AS (SELECT * FROM db.t WHERE c=2) SELECT * FROM cte UNION ALL SELECT * FROM cte", 8},
+		{cetest.QTSingleColApplyQueryOnCol, 0, "SELECT * FROM db.t t1 WHERE t1.c=1 AND EXISTS (SELECT /*+ NO_DECORRELATE() */ 1 FROM db.t t2 WHERE t2.c = t1.c)", 3},
+	} {
+		if sql, act, ok := q.Query(c.qt, c.rowIdx); !ok || sql != c.sql || act != c.act {
+			t.Fatalf("qt=%v, row=%v, expected %v with %v rows, got %v with %v rows", c.qt, c.rowIdx, c.sql, c.act, sql, act)
+		}
+	}
+
+	// random cases are checked by their shapes
+	for qt, prefix := range map[cetest.QueryType]string{
+		cetest.QTSingleColNullRangeQueryOnCol:      "SELECT * FROM db.t WHERE c IS NULL OR (c>=",
+		cetest.QTSingleColRangeQueryOnCol:          "SELECT * FROM db.t WHERE c>=",
+		cetest.QTSingleColLatestRangeQueryOnCol:    "SELECT * FROM db.t WHERE c>=",
+		cetest.QTSingleColInQueryOnCol:             "SELECT * FROM db.t WHERE c IN (",
+		cetest.QTSingleColPointGetQueryOnUniqueKey: "SELECT * FROM db.t WHERE c IN (",
+	} {
+		sql, act, ok := q.Query(qt, 1)
+		if !ok || !strings.HasPrefix(sql, prefix) || act <= 0 {
+			t.Fatalf("qt=%v, expected %v..., got %v with %v rows", qt, prefix, sql, act)
+		}
+	}
+	strs := cetest.NewSingleColQuerier(cetest.DTString, []string{"a"}, []int{5}, 0)
+	if sql, act, ok := strs.Query(cetest.QTSingleColPrefixLikeQueryOnCol, 0); !ok || sql != "SELECT * FROM db.t WHERE c LIKE 'a%'" || act != 5 {
+		t.Fatalf("unexpected prefix-like query %v with %v rows", sql, act)
+	}
+
+	// every single-column query type has a generator, whose queries are valid
+	for qt := cetest.QTSingleColPointQueryOnCol; qt <= cetest.QTRecursiveCTEQuery; qt++ {
+		single := strings.HasPrefix(qt.String(), "single-col-")
+		sql, _, ok := q.Query(qt, 0)
+		if qt == cetest.QTSingleColPrefixLikeQueryOnCol {
+			sql, _, ok = strs.Query(qt, 0)
+		}
+		if ok != single {
+			t.Fatalf("qt=%v, generator found=%v", qt, ok)
+		}
+		if ok {
+			if err := cetest.LintSQL(sql); err != nil {
+				t.Fatalf("qt=%v, invalid query %v: %v", qt, sql, err)
+			}
+		}
+	}
+}
+
+func TestCompareVals(t *testing.T) {
+	for _, c := range []struct {
+		a, b string
+		tp   cetest.DATATYPE
+		cmp  int
+	}{
+		{"9007199254740993", "9007199254740992", cetest.DTInt, 1}, // 2^53+1 and 2^53 are the same float64
+		{"-9223372036854775808", "9223372036854775807", cetest.DTInt, -1},
+		{"18446744073709551615", "18446744073709551614", cetest.DTBit, 1},
+		{"10", "9", cetest.DTInt, 1},
+		{"-1", "-1", cetest.DTInt, 0},
+		{"1234567890123456.0001", "1234567890123456.0002", cetest.DTDecimal, -1},
+		{"1.50", "1.5", cetest.DTDecimal, 0},
+		{"-0.0001", "0", cetest.DTDecimal, -1},
+		{"1e3", "999.5", cetest.DTDouble, 1},
+		{"2.5", "10", cetest.DTDouble, -1},
+		{"10", "9", cetest.DTString, -1},
+		{"abc", "abd", cetest.DTString, -1},
+	} {
+		if cmp := cetest.CompareVals(c.a, c.b, c.tp); cmp != c.cmp {
+			t.Fatalf("compare %v and %v of type %v, expected %v, got %v", c.a, c.b, c.tp, c.cmp, cmp)
+		}
+		if cmp := cetest.CompareVals(c.b, c.a, c.tp); cmp != -c.cmp {
+			t.Fatalf("compare %v and %v of type %v, expected %v, got %v", c.b, c.a, c.tp, -c.cmp, cmp)
+		}
+	}
+}
+
+func TestBucketBoundaryTags(t *testing.T) {
+	tagged := func(tags []string) bool {
+		for _, tag := range tags {
+			if tag == cetest.TagBucketBoundary {
+				return true
+			}
+		}
+		return false
+	}
+
+	// 1000 values with 1 row each are split into 256 buckets of 4 rows, whose bounds are 0, 3, 7, ..., 995, 999
+	vals := make([]string, 1000)
+	cnts := make([]int, 1000)
+	for i := range vals {
+		vals[i], cnts[i] = strconv.Itoa(i), 1
+	}
+	q := cetest.NewSingleColQuerier(cetest.DTInt, vals, cnts, 0)
+	for rowIdx, exp := range map[int]bool{0: true, 1: false, 3: true, 5: false, 7: true, 998: false, 999: true} {
+		if tags := q.Tags(cetest.QTSingleColPointQueryOnCol, rowIdx); tagged(tags) != exp {
+			t.Fatalf("unexpected tags of value %v: %v", rowIdx, tags)
+		}
+	}
+
+	// rows (i/2, i), the first column has 2 rows per value, whose bounds are 0, 1, 3, ..., 499
+	rows := make([][]string, 1000)
+	for i := range rows {
+		rows[i] = []string{strconv.Itoa(i / 2), strconv.Itoa(i)}
+	}
+	mq := cetest.NewMulColIndexQuerier([]cetest.DATATYPE{cetest.DTInt, cetest.DTInt}, rows, cnts)
+	for rowIdx, exp := range map[int]bool{4: false, 6: true, 8: false, 11: true} {
+		if cond, tags := mq.Case(cetest.QTMulColsPointQueryOnIndex, rowIdx); tagged(tags) != exp {
+			t.Fatalf("unexpected tags of %v: %v", cond, tags)
+		}
+	}
+	for rowIdx, exp := range map[int]bool{4: false, 6: true} { // c1 from rowIdx to rowIdx+1 on c0=rowIdx/2
+		if cond, tags := mq.Case(cetest.QTMulColsRangeQueryOnIndex, rowIdx); tagged(tags) != exp {
+			t.Fatalf("unexpected tags of %v: %v", cond, tags)
+		}
+	}
+}
+
+func TestControlSocket(t *testing.T) {
+	dir, err := ioutil.TempDir("", "cetest-control")
 	if err != nil {
 		t.Fatal(err)
 	}
-	if len(opt.QueryTypes) != 2 || len(opt.Datasets) != 3 || len(opt.Instances) != 2 ||
-		opt.QueryTypes[0] != cetest.QTMultiColsPointQuery || opt.QueryTypes[1] != cetest.QTSingleColPointQuery {
-		t.Fatal()
+	defer os.RemoveAll(dir)
+
+	// other files at the path are never removed
+	report := path.Join(dir, "report.md")
+	if err := ioutil.WriteFile(report, []byte("# Report"), 0666); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := cetest.StartControl("unix:" + report); err == nil || !strings.Contains(err.Error(), "not a socket") {
+		t.Fatalf("a regular file should not be replaced by the socket, err=%v", err)
+	}
+	if _, err := os.Stat(report); err != nil {
+		t.Fatalf("the regular file is removed, err=%v", err)
+	}
+
+	// stale sockets left by killed runs are replaced
+	sock := path.Join(dir, "cetest.sock")
+	lis, err := net.Listen("unix", sock)
+	if err != nil {
+		t.Fatal(err)
+	}
+	lis.(*net.UnixListener).SetUnlinkOnClose(false)
+	lis.Close()
+	stop, err := cetest.StartControl("unix:" + sock)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer stop()
+	fi, err := os.Stat(sock)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if fi.Mode()&os.ModeSocket == 0 || fi.Mode().Perm() != 0600 {
+		t.Fatalf("unexpected mode %v of the control socket", fi.Mode())
 	}
 }
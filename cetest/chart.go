@@ -0,0 +1,84 @@
+package cetest
+
+import (
+	"os"
+
+	"github.com/pingcap/errors"
+	"gonum.org/v1/plot"
+	"gonum.org/v1/plot/vg"
+	"gonum.org/v1/plot/vg/draw"
+	"gonum.org/v1/plot/vg/vgimg"
+)
+
+// ChartOpt controls how charts are rendered, all formats are rendered in pure Go without external tools.
+type ChartOpt struct {
+	Formats []string `toml:"formats"` // "png" and "svg", only "png" if empty, the first one is embedded in report.md
+	DPI     int      `toml:"dpi"`     // DPI of PNG charts, 96 if it's 0
+	Scale   float64  `toml:"scale"`   // scale of sizes of all charts, 1 if it's 0
+}
+
+const defaultChartDPI = 96
+
+func (co ChartOpt) check() error {
+	for _, f := range co.Formats {
+		if f != "png" && f != "svg" {
+			return errors.Errorf("unknown chart format=%v", f)
+		}
+	}
+	if co.DPI < 0 || co.Scale < 0 {
+		return errors.Errorf("invalid chart dpi=%v or scale=%v", co.DPI, co.Scale)
+	}
+	return nil
+}
+
+func (co ChartOpt) formats() []string {
+	if len(co.Formats) == 0 {
+		return []string{"png"}
+	}
+	return co.Formats
+}
+
+// saveChart saves this plot with this size into files of all formats, whose paths are the base path with
+// extensions of formats, and returns the path of the first format.
+func saveChart(co ChartOpt, p *plot.Plot, w, h vg.Length, basePath string) (string, error) {
+	if co.Scale > 0 {
+		w, h = w*vg.Length(co.Scale), h*vg.Length(co.Scale)
+	}
+	dpi := co.DPI
+	if dpi == 0 {
+		dpi = defaultChartDPI
+	}
+	var first string
+	for _, f := range co.formats() {
+		file := basePath + "." + f
+		if first == "" {
+			first = file
+		}
+		if f == "svg" {
+			if err := p.Save(w, h, file); err != nil {
+				return "", errors.Trace(err)
+			}
+			continue
+		}
+		c := vgimg.NewWith(vgimg.UseWH(w, h), vgimg.UseDPI(dpi))
+		p.Draw(draw.New(c))
+		if err := writeChartFile(file, vgimg.PngCanvas{Canvas: c}); err != nil {
+			return "", err
+		}
+	}
+	return first, nil
+}
+
+func writeChartFile(file string, c vgimg.PngCanvas) (err error) {
+	f, err := os.Create(file)
+	if err != nil {
+		return errors.Trace(err)
+	}
+	defer func() {
+		if cerr := f.Close(); err == nil {
+			err = errors.Trace(cerr)
+		}
+	}()
+	_, err = c.WriteTo(f)
+	return errors.Trace(err)
+}
@@ -0,0 +1,204 @@
+package cetest
+
+import (
+	"encoding/gob"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path"
+	"unsafe"
+
+	"github.com/pingcap/errors"
+)
+
+// CollectorOpt limits the memory of collected results. Once the limit is exceeded, cells which are not accessed
+// recently are spilled to disk and loaded back when they're accessed again, to prevent OOMs on long matrix runs.
+type CollectorOpt struct {
+	MemoryLimitMB int    `toml:"memory-limit-mb"` // results are always kept in memory if it's 0
+	SpillDir      string `toml:"spill-dir"`       // directory of spilled cells, the system temporary directory if empty
+}
+
+func (co CollectorOpt) check() error {
+	if co.MemoryLimitMB < 0 {
+		return errors.Errorf("invalid collector memory-limit-mb=%v", co.MemoryLimitMB)
+	}
+	return nil
+}
+
+// CollectorMemory is the memory footprint of a collector.
+type CollectorMemory struct {
+	Bytes        int64 // approximate bytes of results in memory
+	Cells        int   // number of cells in memory
+	SpilledCells int   // number of cells spilled to disk
+}
+
+func (cm CollectorMemory) String() string {
+	return fmt.Sprintf("memory=%.2fMB, cells=%v, spilled-cells=%v", float64(cm.Bytes)/(1<<20), cm.Cells, cm.SpilledCells)
+}
+
+// CollectorMemoryOf returns the memory footprint of this collector, false if it's not instrumented.
+func CollectorMemoryOf(c EstResultCollector) (CollectorMemory, bool) {
+	if m, ok := c.(interface{ Memory() CollectorMemory }); ok {
+		return m.Memory(), true
+	}
+	return CollectorMemory{}, false
+}
+
+// NewEstResultCollectorWithOpt creates a collector which spills cold cells into a new directory in SpillDir if
+// MemoryLimitMB is exceeded, the directory is removed when the collector is closed.
+func NewEstResultCollectorWithOpt(insCap, dsCap, qtCap int, opt CollectorOpt) (EstResultCollector, error) {
+	c := NewEstResultCollector(insCap, dsCap, qtCap).(*estResultCollector)
+	if opt.MemoryLimitMB <= 0 {
+		return c, nil
+	}
+	dir, err := ioutil.TempDir(opt.SpillDir, "cetest-spill-")
+	if err != nil {
+		return nil, errors.Trace(err)
+	}
+	c.mem.limit = int64(opt.MemoryLimitMB) << 20
+	c.mem.dir = dir
+	return c, nil
+}
+
+type cellKey [3]int // insIdx, dsIdx and qtIdx
+
+// collectorMemory accounts approximate bytes of cells of a collector, and spills cold cells if the limit is exceeded.
+type collectorMemory struct {
+	limit int64  // spilling is disabled if it's 0
+	dir   string // directory of spilled cells
+
+	bytes   int64
+	sizes   map[cellKey]int64 // cells in memory
+	access  map[cellKey]int64 // the last access of cells in memory
+	spilled map[cellKey]string
+	clock   int64
+}
+
+func newCollectorMemory() *collectorMemory {
+	return &collectorMemory{
+		sizes:   make(map[cellKey]int64),
+		access:  make(map[cellKey]int64),
+		spilled: make(map[cellKey]string),
+	}
+}
+
+// Memory returns the memory footprint of this collector.
+func (c *estResultCollector) Memory() CollectorMemory {
+	c.lock.RLock()
+	defer c.lock.RUnlock()
+	return CollectorMemory{Bytes: c.mem.bytes, Cells: len(c.mem.sizes), SpilledCells: len(c.mem.spilled)}
+}
+
+// Close removes all spilled cells.
+func (c *estResultCollector) Close() error {
+	c.lock.Lock()
+	defer c.lock.Unlock()
+	if c.mem.dir == "" {
+		return nil
+	}
+	return errors.Trace(os.RemoveAll(c.mem.dir))
+}
+
+// touch loads this cell back if it's spilled and marks it as the most recently accessed one,
+// it's called with the write lock held.
+func (c *estResultCollector) touch(k cellKey) {
+	if c.mem.limit == 0 {
+		return
+	}
+	c.mem.clock++
+	c.mem.access[k] = c.mem.clock
+	p, ok := c.mem.spilled[k]
+	if !ok {
+		return
+	}
+	f, err := os.Open(p)
+	if err != nil {
+		panic(fmt.Sprintf("load spilled cell %v, err=%v", k, err))
+	}
+	defer f.Close()
+	var rs []EstResult
+	if err := gob.NewDecoder(f).Decode(&rs); err != nil {
+		panic(fmt.Sprintf("load spilled cell %v, err=%v", k, err))
+	}
+	f.Close()
+	os.Remove(p)
+	delete(c.mem.spilled, k)
+	c.rs[k[0]][k[1]][k[2]] = rs
+	size := int64(0)
+	for _, r := range rs {
+		size += estResultSize(r)
+	}
+	c.grow(k, size)
+}
+
+// grow accounts delta bytes of this cell, and spills other cells from the coldest one until the memory is under
+// the limit, it's called with the write lock held.
+func (c *estResultCollector) grow(k cellKey, delta int64) {
+	c.mem.sizes[k] += delta
+	c.mem.bytes += delta
+	for c.mem.limit > 0 && c.mem.bytes > c.mem.limit {
+		cold, found := cellKey{}, false
+		for ck := range c.mem.sizes {
+			if ck != k && c.mem.sizes[ck] > 0 && (!found || c.mem.access[ck] < c.mem.access[cold]) {
+				cold, found = ck, true
+			}
+		}
+		if !found {
+			return // the only cell in memory is the current one
+		}
+		if err := c.spill(cold); err != nil {
+			fmt.Printf("[Collector] spill cell %v, err=%v, keep it in memory\n", cold, err)
+			return
+		}
+	}
+}
+
+// spill writes this cell into a file and drops it from memory.
+func (c *estResultCollector) spill(k cellKey) error {
+	p := path.Join(c.mem.dir, fmt.Sprintf("cell-%v-%v-%v.gob", k[0], k[1], k[2]))
+	f, err := os.Create(p)
+	if err != nil {
+		return errors.Trace(err)
+	}
+	defer f.Close()
+	if err := gob.NewEncoder(f).Encode(c.rs[k[0]][k[1]][k[2]]); err != nil {
+		return errors.Trace(err)
+	}
+	if err := f.Close(); err != nil {
+		return errors.Trace(err)
+	}
+	c.rs[k[0]][k[1]][k[2]] = nil
+	c.mem.spilled[k] = p
+	c.mem.bytes -= c.mem.sizes[k]
+	delete(c.mem.sizes, k)
+	delete(c.mem.access, k)
+	return nil
+}
+
+var (
+	estResultStructSize     = int64(unsafe.Sizeof(EstResult{}))
+	operatorStatsStructSize = int64(unsafe.Sizeof(OperatorStats{}))
+)
+
+// estResultSize returns approximate bytes of this result, including its strings, slices and maps.
+func estResultSize(r EstResult) int64 {
+	size := estResultStructSize + int64(len(r.SQL)+len(r.Operator)+len(r.Plan)+len(r.PlanFingerprint)+len(r.MPPJoin)+len(r.Err))
+	for _, t := range r.Tags {
+		size += 16 + int64(len(t))
+	}
+	for _, s := range r.TraceSteps {
+		size += 16 + int64(len(s))
+	}
+	for _, op := range r.Operators {
+		size += operatorStatsStructSize + int64(len(op.ID)+len(op.Task)+len(op.Object)+len(op.Info))
+		for k, v := range op.ExecInfo {
+			size += 32 + int64(len(k)+len(v))
+		}
+	}
+	for k, v := range r.Labels {
+		size += 32 + int64(len(k)+len(v))
+	}
+	size += int64(len(r.Risks)) * int64(unsafe.Sizeof(PlanRisk{}))
+	size += int64(len(r.WhatIf)) * int64(unsafe.Sizeof(WhatIfResult{}))
+	return size
+}
@@ -0,0 +1,186 @@
+package cetest
+
+import (
+	"bytes"
+	"fmt"
+	"math"
+	"regexp"
+	"sort"
+	"strings"
+)
+
+var (
+	// stringLiteralPattern matches string literals in SQLs, which are removed before finding predicate columns.
+	stringLiteralPattern = regexp.MustCompile(`'(?:[^'\\]|\\.|'')*'`)
+	// predicateColumnPattern matches columns compared in predicates with their optional qualifiers, like "a" in
+	// "a>=1", "t1.a" in "t1.a = t2.b" and "a" in "a IN (1, 2)".
+	predicateColumnPattern = regexp.MustCompile("(?i)(?:`?(\\w+)`?\\.)?`?(\\w+)`?\\s*(?:[<>!]?=|<>|<|>|\\bNOT\\s+IN\\b|\\bIN\\b|\\bNOT\\s+LIKE\\b|\\bLIKE\\b|\\bBETWEEN\\b|\\bIS\\b)")
+	// rightColumnPattern matches qualified columns on the right of comparisons, like "t2.b" in "t1.a = t2.b".
+	rightColumnPattern = regexp.MustCompile("(?:[<>!]?=|<|>)\\s*`?(\\w+)`?\\.`?(\\w+)`?")
+)
+
+// predicateKeywords are matched by predicateColumnPattern but are not columns.
+var predicateKeywords = map[string]bool{"and": true, "or": true, "not": true, "where": true, "on": true, "null": true,
+	"true": true, "false": true, "exists": true, "select": true}
+
+// columnLeaderboardSize is the number of worst-estimated columns of each dataset in the leaderboard.
+const columnLeaderboardSize = 10
+
+// predicateColumns returns columns compared in predicates of this SQL like "t.a" without duplicates.
+// Qualifiers are resolved to tables by aliases, and unqualified columns belong to the first table.
+func predicateColumns(sql string) []string {
+	tables := make(map[string]string) // alias, table
+	first := ""
+	for _, m := range joinTablePattern.FindAllStringSubmatch(sql, -1) {
+		tb := m[1]
+		if m[2] != "" {
+			tb = m[2]
+		}
+		tb = strings.ToLower(tb)
+		if first == "" {
+			first = tb
+		}
+		tables[tb] = tb
+		if alias := m[3]; alias != "" && !joinKeywords[strings.ToLower(alias)] {
+			tables[strings.ToLower(alias)] = tb
+		}
+	}
+	var cols []string
+	seen := make(map[string]bool)
+	sql = stringLiteralPattern.ReplaceAllString(sql, "''")
+	matches := predicateColumnPattern.FindAllStringSubmatch(sql, -1)
+	for _, m := range rightColumnPattern.FindAllStringSubmatch(sql, -1) {
+		matches = append(matches, []string{m[0], m[1], m[2]})
+	}
+	for _, m := range matches {
+		col := strings.ToLower(m[2])
+		if predicateKeywords[col] || (col[0] >= '0' && col[0] <= '9') {
+			continue
+		}
+		tb := first
+		if m[1] != "" {
+			if t, ok := tables[strings.ToLower(m[1])]; ok {
+				tb = t
+			} else {
+				tb = strings.ToLower(m[1])
+			}
+		}
+		name := col
+		if tb != "" {
+			name = tb + "." + col
+		}
+		if !seen[name] {
+			seen[name] = true
+			cols = append(cols, name)
+		}
+	}
+	return cols
+}
+
+// columnErrors are errors of cases whose predicates reference a column.
+type columnErrors struct {
+	column string
+	pes    []float64 // absolute PErrors
+	worst  EstResult
+	worstI int // index of the instance of the worst case
+}
+
+func (ce *columnErrors) mean() float64 {
+	total := 0.0
+	for _, pe := range ce.pes {
+		total += pe
+	}
+	return total / float64(len(ce.pes))
+}
+
+// columnStatsSuggestion returns which statistics of the column may fix the worst case of it: extended statistics if
+// it also filters other columns of the same table, TopN for point predicates and more buckets for range ones.
+func columnStatsSuggestion(r EstResult, column string) string {
+	tb := column[:strings.LastIndex(column, ".")+1]
+	for _, c := range predicateColumns(r.SQL) {
+		if c != column && tb != "" && strings.HasPrefix(c, tb) {
+			return "extended stats"
+		}
+	}
+	where := wherePart(r.SQL)
+	if rangePredicatePattern.MatchString(where) {
+		return "more buckets"
+	}
+	if pointPredicatePattern.MatchString(where) {
+		return "TopN tuning"
+	}
+	return "-"
+}
+
+// rankColumnErrors returns errors of all columns referenced by cases of this dataset on the instance insIdx, or on
+// all instances if it's -1, ranked by mean absolute PErrors.
+func rankColumnErrors(opt Option, collector EstResultCollector, dsIdx, insIdx int) []*columnErrors {
+	errs := make(map[string]*columnErrors)
+	for i := range opt.Instances {
+		if insIdx != -1 && i != insIdx {
+			continue
+		}
+		for qtIdx := range opt.QueryTypes {
+			for _, r := range collector.EstResults(i, dsIdx, qtIdx) {
+				pe := math.Abs(PError(r))
+				for _, col := range predicateColumns(r.SQL) {
+					ce, ok := errs[col]
+					if !ok {
+						ce = &columnErrors{column: col, worstI: -1}
+						errs[col] = ce
+					}
+					ce.pes = append(ce.pes, pe)
+					if ce.worstI == -1 || pe > math.Abs(PError(ce.worst)) {
+						ce.worst, ce.worstI = r, i
+					}
+				}
+			}
+		}
+	}
+	board := make([]*columnErrors, 0, len(errs))
+	for _, ce := range errs {
+		sort.Float64s(ce.pes)
+		board = append(board, ce)
+	}
+	sort.Slice(board, func(i, j int) bool {
+		if mi, mj := board[i].mean(), board[j].mean(); mi != mj {
+			return mi > mj
+		}
+		return board[i].column < board[j].column
+	})
+	return board
+}
+
+// writeColumnErrors writes a leaderboard of the worst-estimated columns of each dataset, which ranks columns by mean
+// absolute PErrors of all cases referencing them in predicates on all instances. A case is counted for each column
+// it references, so errors of multi-column cases are shared by their columns.
+func writeColumnErrors(md *bytes.Buffer, opt Option, collector EstResultCollector) {
+	header := false
+	for dsIdx, ds := range opt.Datasets {
+		board := rankColumnErrors(opt, collector, dsIdx, -1)
+		if len(board) == 0 {
+			continue
+		}
+		if !header {
+			md.WriteString("# Column Error Leaderboard\n")
+			md.WriteString("\nWorst-estimated columns of each dataset ranked by mean absolute PErrors of cases referencing them in predicates on all instances.\n")
+			header = true
+		}
+		if len(board) > columnLeaderboardSize {
+			board = board[:columnLeaderboardSize]
+		}
+		md.WriteString(fmt.Sprintf("\n## %v\n", ds.Label))
+		md.WriteString("\n| Rank | Column | Cases | Mean | P90 | Max | Worst Case | Suggestion |\n")
+		md.WriteString("| ---- | ---- | ---- | ---- | ---- | ---- | ---- | ---- |\n")
+		for i, ce := range board {
+			n := len(ce.pes)
+			worst := fmt.Sprintf("`%v` on %v: %v => %v", strings.Replace(opt.reportSQL(ce.worst.SQL), "|", "\\|", -1),
+				opt.Instances[ce.worstI].Label, opt.NumberFormat.rows(ce.worst.EstCard), opt.NumberFormat.rows(ce.worst.TrueCard))
+			md.WriteString(fmt.Sprintf("| %v | %v | %v | %.3f | %.3f | %.3f | %v | %v |\n", i+1, ce.column, n,
+				ce.mean(), ce.pes[(n*9)/10], ce.pes[n-1], worst, columnStatsSuggestion(ce.worst, ce.column)))
+		}
+	}
+	if header {
+		md.WriteString("\n")
+	}
+}
@@ -0,0 +1,143 @@
+package cetest
+
+import (
+	"bytes"
+	"fmt"
+	"os"
+	"sort"
+	"strings"
+
+	"github.com/pingcap/errors"
+)
+
+// effectiveConfig flattens parameters of this run which affect its results into keys like "n-samples" or
+// "instance.v7.5.0.version", so runs kept in the history can be compared parameter by parameter.
+func effectiveConfig(opt Option) map[string]string {
+	qts := opt.queryTypeNames()
+	sort.Strings(qts)
+	conf := map[string]string{
+		"n-samples":      fmt.Sprintf("%v", opt.NSamples),
+		"query-types":    strings.Join(qts, ", "),
+		"executor":       opt.Executor,
+		"concurrency":    fmt.Sprintf("%v", opt.Concurrency),
+		"tags":           strings.Join(opt.Tags, ", "),
+		"read-only":      fmt.Sprintf("%v", opt.ReadOnly),
+		"analyze-tables": strings.Join(opt.AnaTables, ", "),
+	}
+	if opt.Adaptive.enabled() {
+		conf["adaptive"] = fmt.Sprintf("precision=%v, confidence=%v, min-cases=%v, importance=%v",
+			opt.Adaptive.Precision, opt.Adaptive.Confidence, opt.Adaptive.MinCases, opt.Adaptive.Importance)
+	}
+	if opt.WriteLoad.enabled() {
+		conf["write-load"] = fmt.Sprintf("inserts=%v, updates=%v, tables=%v", opt.WriteLoad.Inserts, opt.WriteLoad.Updates, strings.Join(opt.WriteLoad.Tables, ", "))
+	}
+	if opt.Snapshot != "" {
+		conf["snapshot"] = opt.Snapshot
+	}
+	if opt.Rerun.Path != "" {
+		conf["rerun"] = opt.Rerun.Path
+	}
+	if len(opt.Corpus.Load) > 0 {
+		conf["corpus"] = strings.Join(opt.Corpus.Load, ", ")
+	}
+	for k, v := range opt.matrixVars {
+		conf["global."+k] = v
+	}
+	for insIdx, ins := range opt.Instances {
+		prefix := "instance." + ins.Label + "."
+		if insIdx < len(opt.insVersions) {
+			conf[prefix+"version"] = opt.insVersions[insIdx]
+		}
+		if insIdx < len(opt.insCommits) && opt.insCommits[insIdx] != "" {
+			conf[prefix+"commit"] = opt.insCommits[insIdx]
+		}
+		conf[prefix+"explain-format"] = ins.ExplainFormat
+		conf[prefix+"resource-group"] = ins.ResourceGroup
+		conf[prefix+"low-priority"] = fmt.Sprintf("%v", ins.LowPriority)
+		if len(ins.QueryHints) > 0 { // hints change plans, but comments don't
+			conf[prefix+"query-hints"] = strings.Join(ins.QueryHints, " ")
+		}
+		conf[prefix+"mpp"] = fmt.Sprintf("%v", ins.MPP)
+	}
+	for _, ds := range opt.Datasets {
+		prefix := "dataset." + ds.Label + "."
+		conf[prefix+"name"] = ds.Name
+		conf[prefix+"db"] = ds.DB
+		conf[prefix+"args"] = strings.Join(ds.Args, ", ")
+		conf[prefix+"tags"] = strings.Join(ds.Tags, ", ")
+		conf[prefix+"setup"] = strings.Join(ds.Setup, "; ") // session variables of datasets are usually set here
+		if strings.ToLower(ds.Name) == "mock" {
+			conf[prefix+"mock"] = fmt.Sprintf("%+v", ds.Mock)
+		}
+	}
+	return conf
+}
+
+// configChange is a parameter changed since the previous run, "-" means it's absent.
+type configChange struct {
+	Key      string
+	Previous string
+	Current  string
+}
+
+func diffConfigs(prev, cur map[string]string) []configChange {
+	var changes []configChange
+	for k, v := range cur {
+		if p, ok := prev[k]; !ok {
+			changes = append(changes, configChange{k, "-", v})
+		} else if p != v {
+			changes = append(changes, configChange{k, p, v})
+		}
+	}
+	for k, p := range prev {
+		if _, ok := cur[k]; !ok {
+			changes = append(changes, configChange{k, p, "-"})
+		}
+	}
+	sort.Slice(changes, func(i, j int) bool { return changes[i].Key < changes[j].Key })
+	return changes
+}
+
+// writeConfigDiff writes changes of the effective configuration since the previous run in the history directory,
+// so apparent regressions caused by changed parameters can be told at a glance. It's skipped if there is no
+// previous run with its configuration recorded.
+func writeConfigDiff(md *bytes.Buffer, opt Option) error {
+	if opt.History.Dir == "" {
+		return nil
+	}
+	runs, err := readRunHistory(opt.History.Dir)
+	if os.IsNotExist(errors.Cause(err)) {
+		return nil
+	} else if err != nil {
+		return err
+	}
+	if len(runs) == 0 || runs[len(runs)-1].Config == nil {
+		return nil
+	}
+	prev := runs[len(runs)-1]
+	changes := diffConfigs(prev.Config, effectiveConfig(opt))
+	at := prev.Time.Local().Format("2006-01-02 15:04")
+	md.WriteString("# Config Diff\n")
+	if len(changes) == 0 {
+		md.WriteString(fmt.Sprintf("\nThe effective configuration is the same as the previous run at %v.\n\n", at))
+		return nil
+	}
+	md.WriteString(fmt.Sprintf("\nParameters changed since the previous run at %v, which may explain changes of errors.\n", at))
+	md.WriteString("\n| Parameter | Previous | Current |\n")
+	md.WriteString("| ---- | ---- | ---- |\n")
+	for _, c := range changes {
+		md.WriteString(fmt.Sprintf("| %v | %v | %v |\n", c.Key, markdownCell(c.Previous), markdownCell(c.Current)))
+	}
+	md.WriteString("\n")
+	return nil
+}
+
+// markdownCell escapes this value to be put in a cell of a Markdown table, empty values are shown as "".
+func markdownCell(v string) string {
+	if v == "" {
+		return `""`
+	} else if v == "-" {
+		return v
+	}
+	return "`" + strings.Replace(v, "|", "\\|", -1) + "`"
+}
@@ -0,0 +1,257 @@
+package cetest
+
+import (
+	"encoding/json"
+	"fmt"
+	"net"
+	"net/http"
+	"os"
+	"path"
+	"strconv"
+	"strings"
+	"sync"
+
+	"github.com/pingcap/errors"
+)
+
+// partialReportDir is the sub-directory of report-dir where partial reports requested by the control endpoint are
+// generated, so they never overwrite the final report.
+const partialReportDir = "partial"
+
+// runControl lets a running test be paused, resumed, throttled or reported partially from outside by a local HTTP
+// endpoint listening on Option.Control, which is a TCP address like "127.0.0.1:9090" or a unix socket like
+// "unix:/tmp/cetest.sock", which is only accessible by the owner of the run:
+//
+//	POST /pause                 pause all instances once their running cases finish
+//	POST /resume                resume paused instances
+//	POST /concurrency?n=N       run at most N cases in parallel on each instance, 0 restores the configured concurrency
+//	POST /report                generate reports of results collected so far into report-dir/partial
+//	GET  /status                show whether the run is paused, the concurrency limit and running cases
+type runControl struct {
+	addr string
+
+	mu      sync.Mutex
+	changed *sync.Cond
+	paused  bool
+	limit   int            // max number of cases running in parallel on each instance, unlimited if 0
+	running map[string]int // labels of instances, numbers of running cases
+
+	reportMu  sync.Mutex // serializes partial reports
+	opt       Option
+	collector EstResultCollector
+	lis       net.Listener // nil if it's not started
+	server    *http.Server
+	done      chan struct{}
+}
+
+// newRunControl returns nil if the control endpoint is disabled.
+func newRunControl(addr string) *runControl {
+	if addr == "" {
+		return nil
+	}
+	c := &runControl{addr: addr, running: make(map[string]int)}
+	c.changed = sync.NewCond(&c.mu)
+	return c
+}
+
+// checkControlAddr checks the address of the control endpoint, see runControl.
+func checkControlAddr(addr string) error {
+	if addr == "" {
+		return nil
+	}
+	if strings.HasPrefix(addr, "unix:") {
+		if addr == "unix:" {
+			return errors.Errorf("invalid control=%v without the path of the socket", addr)
+		}
+		return nil
+	}
+	host, _, err := net.SplitHostPort(addr)
+	if err != nil {
+		return errors.Errorf("invalid control=%v, err=%v", addr, err)
+	}
+	if ip := net.ParseIP(host); host != "localhost" && (ip == nil || !ip.IsLoopback()) {
+		return errors.Errorf("control=%v must listen on a loopback address", addr)
+	}
+	return nil
+}
+
+// start listens on the address of the control endpoint, partial reports are generated by this option from this
+// collector of the current run.
+func (c *runControl) start(opt Option, collector EstResultCollector) error {
+	if c == nil {
+		return nil
+	}
+	network, addr := "tcp", c.addr
+	if strings.HasPrefix(addr, "unix:") {
+		network, addr = "unix", strings.TrimPrefix(addr, "unix:")
+		if err := removeStaleSocket(addr); err != nil {
+			return err
+		}
+	}
+	lis, err := net.Listen(network, addr)
+	if err != nil {
+		return fmt.Errorf("listen on the control endpoint %v, err=%v", c.addr, err)
+	}
+	if network == "unix" { // other local users can't pause or throttle the run
+		if err := os.Chmod(addr, 0600); err != nil {
+			lis.Close()
+			return errors.Trace(err)
+		}
+	}
+	c.reportMu.Lock()
+	c.opt, c.collector = opt, collector
+	c.reportMu.Unlock()
+	c.lis, c.server, c.done = lis, &http.Server{Handler: c.handler()}, make(chan struct{})
+	go func() {
+		defer close(c.done)
+		c.server.Serve(lis)
+	}()
+	fmt.Printf("[Control] listening on %v\n", c.addr)
+	return nil
+}
+
+// removeStaleSocket removes the socket at this path left by a killed run, any other file at the path is an error
+// instead of being removed, since it's likely a typo of the path.
+func removeStaleSocket(p string) error {
+	fi, err := os.Lstat(p)
+	if os.IsNotExist(err) {
+		return nil
+	}
+	if err != nil {
+		return errors.Trace(err)
+	}
+	if fi.Mode()&os.ModeSocket == 0 {
+		return errors.Errorf("control socket %v already exists and is not a socket", p)
+	}
+	return errors.Trace(os.Remove(p))
+}
+
+// stop closes the endpoint and resumes paused cases, so a run is never left paused.
+func (c *runControl) stop() {
+	if c == nil || c.lis == nil {
+		return
+	}
+	c.server.Close()
+	<-c.done
+	c.lis = nil
+	c.mu.Lock()
+	c.paused = false
+	c.changed.Broadcast()
+	c.mu.Unlock()
+}
+
+// acquire waits until the run is not paused and this instance runs fewer cases than the limit.
+func (c *runControl) acquire(ins string) {
+	if c == nil {
+		return
+	}
+	c.mu.Lock()
+	for c.paused || (c.limit > 0 && c.running[ins] >= c.limit) {
+		c.changed.Wait()
+	}
+	c.running[ins]++
+	c.mu.Unlock()
+}
+
+func (c *runControl) release(ins string) {
+	if c == nil {
+		return
+	}
+	c.mu.Lock()
+	c.running[ins]--
+	c.changed.Broadcast()
+	c.mu.Unlock()
+}
+
+func (c *runControl) setPaused(paused bool) {
+	c.mu.Lock()
+	c.paused = paused
+	c.changed.Broadcast()
+	c.mu.Unlock()
+}
+
+func (c *runControl) setLimit(limit int) {
+	c.mu.Lock()
+	c.limit = limit
+	c.changed.Broadcast()
+	c.mu.Unlock()
+}
+
+// controlStatus is the response of GET /status.
+type controlStatus struct {
+	Paused      bool           `json:"paused"`
+	Concurrency int            `json:"concurrency"` // 0 if the configured concurrency is used
+	Running     map[string]int `json:"running"`     // numbers of running cases of each instance
+}
+
+func (c *runControl) status() controlStatus {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	s := controlStatus{Paused: c.paused, Concurrency: c.limit, Running: make(map[string]int, len(c.running))}
+	for ins, n := range c.running {
+		s.Running[ins] = n
+	}
+	return s
+}
+
+// report generates reports of results collected so far into report-dir/partial, and returns the directory.
+func (c *runControl) report() (string, error) {
+	c.reportMu.Lock()
+	defer c.reportMu.Unlock()
+	opt := c.opt
+	opt.ReportDir = path.Join(opt.ReportDir, partialReportDir)
+	if err := GenReports(opt, c.collector); err != nil {
+		return "", err
+	}
+	return opt.ReportDir, nil
+}
+
+func (c *runControl) handler() http.Handler {
+	mux := http.NewServeMux()
+	post := func(f func(w http.ResponseWriter, r *http.Request)) func(w http.ResponseWriter, r *http.Request) {
+		return func(w http.ResponseWriter, r *http.Request) {
+			if r.Method != http.MethodPost {
+				http.Error(w, "only POST is allowed", http.StatusMethodNotAllowed)
+				return
+			}
+			f(w, r)
+		}
+	}
+	mux.HandleFunc("/pause", post(func(w http.ResponseWriter, r *http.Request) {
+		c.setPaused(true)
+		fmt.Printf("[Control] paused\n")
+		fmt.Fprintln(w, "paused")
+	}))
+	mux.HandleFunc("/resume", post(func(w http.ResponseWriter, r *http.Request) {
+		c.setPaused(false)
+		fmt.Printf("[Control] resumed\n")
+		fmt.Fprintln(w, "resumed")
+	}))
+	mux.HandleFunc("/concurrency", post(func(w http.ResponseWriter, r *http.Request) {
+		n, err := strconv.Atoi(r.URL.Query().Get("n"))
+		if err != nil || n < 0 {
+			http.Error(w, fmt.Sprintf("invalid concurrency n=%v", r.URL.Query().Get("n")), http.StatusBadRequest)
+			return
+		}
+		c.setLimit(n)
+		fmt.Printf("[Control] concurrency of each instance is limited to %v\n", n)
+		fmt.Fprintf(w, "concurrency=%v\n", n)
+	}))
+	mux.HandleFunc("/report", post(func(w http.ResponseWriter, r *http.Request) {
+		dir, err := c.report()
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+			return
+		}
+		fmt.Printf("[Control] partial report is generated into %v\n", dir)
+		fmt.Fprintf(w, "partial report is generated into %v\n", dir)
+	}))
+	mux.HandleFunc("/status", func(w http.ResponseWriter, r *http.Request) {
+		s := c.status()
+		w.Header().Set("Content-Type", "application/json")
+		enc := json.NewEncoder(w)
+		enc.SetIndent("", "  ")
+		enc.Encode(s)
+	})
+	return mux
+}
@@ -0,0 +1,200 @@
+package cetest
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/pingcap/errors"
+	"github.com/qw4990/OptimizerTester/tidb"
+)
+
+// CorpusVersion is the version of the corpus format written by this tester,
+// corpora with newer versions can't be loaded.
+const CorpusVersion = 1
+
+// corpusFormat identifies corpus files.
+const corpusFormat = "optimizer-tester-corpus"
+
+// CorpusOpt shares case sets between groups, so different engines can be benchmarked on exactly the same cases.
+// A corpus contains cases of a dataset with their true cardinalities, and a fingerprint of the data they're generated on.
+type CorpusOpt struct {
+	Export            string   `toml:"export"`             // directory to write a corpus of each dataset after the run
+	Load              []string `toml:"load"`               // corpora to run instead of generating new cases, matched to datasets by labels
+	IgnoreFingerprint bool     `toml:"ignore-fingerprint"` // run loaded corpora even if fingerprints of data don't match
+}
+
+// Corpus is the serialized format of a case set.
+type Corpus struct {
+	Format      string       `json:"format"` // always "optimizer-tester-corpus"
+	Version     int          `json:"version"`
+	Dataset     string       `json:"dataset"`     // label of the dataset
+	Fingerprint string       `json:"fingerprint"` // see DatasetFingerprint
+	CreatedAt   time.Time    `json:"created_at"`
+	Cases       []CorpusCase `json:"cases"`
+}
+
+// CorpusCase is a case of a corpus with its expected true cardinality.
+type CorpusCase struct {
+	QueryType string   `json:"query_type"`
+	SQL       string   `json:"sql"`
+	TrueCard  float64  `json:"true_card"`
+	Tags      []string `json:"tags,omitempty"`
+}
+
+func (co CorpusOpt) check(opt Option) error {
+	if len(co.Load) > 0 && opt.Rerun.Path != "" {
+		return errors.Errorf("corpus load and rerun can't be used together")
+	}
+	if co.Export != "" && opt.Anonymize {
+		return errors.Errorf("corpus export is not allowed with anonymize, since anonymized SQLs can't be run")
+	}
+	if co.Export != "" && len(opt.Instances) == 0 {
+		return errors.Errorf("corpus export requires at least 1 instance")
+	}
+	return nil
+}
+
+// DatasetFingerprint returns a fingerprint of data of this dataset in this instance, which is a hash of
+// row counts of all used tables, and names, types and value ranges of all used columns.
+func DatasetFingerprint(ins tidb.Instance, ds Dataset) (string, error) {
+	b, ok := ds.(interface{ base() *datasetBase })
+	if !ok {
+		return "", errors.Errorf("dataset=%v doesn't support fingerprints", ds.Name())
+	}
+	base := b.base()
+	used := base.usedColumns()
+	tbs := make([]string, 0, len(used))
+	for tb := range used {
+		tbs = append(tbs, tb)
+	}
+	sort.Strings(tbs)
+
+	h := sha256.New()
+	for _, tb := range tbs {
+		cols := make([]string, 0, len(used[tb]))
+		for col := range used[tb] {
+			cols = append(cols, col)
+		}
+		sort.Strings(cols)
+		exprs := []string{"COUNT(*)"}
+		for _, col := range cols {
+			expr := used[tb][col].selectExpr(col)
+			exprs = append(exprs, fmt.Sprintf("MIN(%v)", expr), fmt.Sprintf("MAX(%v)", expr))
+		}
+		_, rows, err := queryText(ins, fmt.Sprintf("SELECT %v FROM %v.%v", strings.Join(exprs, ", "), base.opt.DB, tb))
+		if err != nil {
+			return "", err
+		}
+		if len(rows) != 1 {
+			return "", errors.Errorf("no result of the fingerprint of %v.%v", base.opt.DB, tb)
+		}
+		fmt.Fprintf(h, "%v|%v\n", tb, rows[0][0])
+		for i, col := range cols {
+			fmt.Fprintf(h, "%v|%v|%v|%v\n", col, used[tb][col], rows[0][1+2*i], rows[0][2+2*i])
+		}
+	}
+	return hex.EncodeToString(h.Sum(nil)[:16]), nil
+}
+
+// ExportCorpora writes a corpus of each dataset into the export directory, with cases and true cardinalities
+// of the first instance, whose data is fingerprinted.
+func ExportCorpora(opt Option, instances []tidb.Instance, datasets []Dataset, collector EstResultCollector) error {
+	if opt.Corpus.Export == "" {
+		return nil
+	}
+	if len(instances) == 0 {
+		return errors.Errorf("corpus export requires at least 1 instance")
+	}
+	ins := instances[0]
+	if err := os.MkdirAll(opt.Corpus.Export, 0755); err != nil {
+		return errors.Trace(err)
+	}
+	for dsIdx, ds := range opt.Datasets {
+		fp, err := DatasetFingerprint(ins, datasets[dsIdx])
+		if err != nil {
+			return err
+		}
+		c := Corpus{Format: corpusFormat, Version: CorpusVersion, Dataset: ds.Label, Fingerprint: fp, CreatedAt: time.Now()}
+		for qtIdx, qt := range opt.QueryTypes {
+			for _, r := range collector.EstResults(0, dsIdx, qtIdx) {
+				c.Cases = append(c.Cases, CorpusCase{QueryType: qt.String(), SQL: r.SQL, TrueCard: r.TrueCard, Tags: r.Tags})
+			}
+		}
+		if err := WriteCorpus(path.Join(opt.Corpus.Export, ds.Label+".corpus.json"), c); err != nil {
+			return err
+		}
+	}
+	fmt.Printf("[Corpus] exported %v corpora into %v\n", len(opt.Datasets), opt.Corpus.Export)
+	return nil
+}
+
+// WriteCorpus writes this corpus into this file.
+func WriteCorpus(p string, c Corpus) error {
+	content, err := json.MarshalIndent(c, "", "  ")
+	if err != nil {
+		return errors.Trace(err)
+	}
+	return errors.Trace(ioutil.WriteFile(p, content, 0666))
+}
+
+// ReadCorpus reads a corpus from this file and checks its format and version.
+func ReadCorpus(p string) (Corpus, error) {
+	content, err := ioutil.ReadFile(p)
+	if err != nil {
+		return Corpus{}, errors.Trace(err)
+	}
+	var c Corpus
+	if err := json.Unmarshal(content, &c); err != nil {
+		return Corpus{}, errors.Errorf("invalid corpus %v, err=%v", p, err)
+	}
+	if c.Format != corpusFormat {
+		return Corpus{}, errors.Errorf("%v is not a corpus", p)
+	}
+	if c.Version < 1 || c.Version > CorpusVersion {
+		return Corpus{}, errors.Errorf("unsupported version %v of corpus %v, the latest supported version is %v", c.Version, p, CorpusVersion)
+	}
+	return c, nil
+}
+
+// loadCorpusCases reads all loaded corpora and returns their cases, fingerprints of corpora are checked on all instances.
+func loadCorpusCases(opt Option, instances []tidb.Instance, datasets []Dataset) ([]rerunCase, error) {
+	var cases []rerunCase
+	for _, p := range opt.Corpus.Load {
+		c, err := ReadCorpus(p)
+		if err != nil {
+			return nil, err
+		}
+		dsIdx := opt.datasetIdx(c.Dataset)
+		if dsIdx == -1 {
+			return nil, errors.Errorf("dataset %v of corpus %v is not configured", c.Dataset, p)
+		}
+		if !opt.Corpus.IgnoreFingerprint {
+			for _, ins := range instances {
+				fp, err := DatasetFingerprint(ins, datasets[dsIdx])
+				if err != nil {
+					return nil, err
+				}
+				if fp != c.Fingerprint {
+					return nil, errors.Errorf("data of dataset %v in instance=%v doesn't match corpus %v, fingerprint %v != %v",
+						c.Dataset, ins.Opt().Label, p, fp, c.Fingerprint)
+				}
+			}
+		}
+		for _, cc := range c.Cases {
+			qtIdx := opt.queryTypeIdx(cc.QueryType)
+			if qtIdx == -1 {
+				continue // not tested in this run
+			}
+			cases = append(cases, rerunCase{dsIdx: dsIdx, qtIdx: qtIdx, r: EstResult{SQL: cc.SQL, TrueCard: cc.TrueCard, Tags: cc.Tags}})
+		}
+	}
+	return cases, nil
+}
@@ -0,0 +1,135 @@
+package cetest
+
+import (
+	"bytes"
+	"fmt"
+	"regexp"
+	"strings"
+)
+
+// coverageFeature is an estimation feature of TiDB, which is exercised by a case if match returns true. Features are
+// inferred from predicate shapes, tags and operators observed in the run, so they're approximate.
+type coverageFeature struct {
+	name  string
+	desc  string
+	match func(r EstResult) bool
+}
+
+var (
+	// rangePredicatePattern matches range predicates estimated by histograms, like "a>1", "a BETWEEN 1 AND 2" or "a LIKE 'x%'".
+	rangePredicatePattern = regexp.MustCompile(`(?i)[<>]|\bBETWEEN\b|\bLIKE\b`)
+	// pointPredicatePattern matches point predicates, like "a=1" or "a IN (1, 2)".
+	pointPredicatePattern = regexp.MustCompile(`(?i)[^<>!]=|\bIN\s*\(`)
+)
+
+// coverageFeatures are estimation features in the coverage matrix in order.
+var coverageFeatures = []coverageFeature{ // read-only
+	{"histogram-range", "range predicates estimated by histograms", func(r EstResult) bool {
+		return rangePredicatePattern.MatchString(wherePart(r.SQL))
+	}},
+	{"histogram-point", "point predicates on values out of TopN, estimated by histograms and NDVs", func(r EstResult) bool {
+		return pointPredicatePattern.MatchString(wherePart(r.SQL)) && !inTopN(r)
+	}},
+	{"topn", "point predicates on values in TopN", inTopN},
+	{"null", "predicates involving NULLs", func(r EstResult) bool { return r.HasTag(TagNull) }},
+	{"out-of-range", "predicates on values out of the range of histograms", func(r EstResult) bool { return r.HasTag(TagOutOfRange) }},
+	{"ndv-join", "joins estimated by NDVs of join keys", func(r EstResult) bool {
+		return strings.Contains(r.PlanFingerprint, "Join") || len(joinAliases(r.SQL)) > 1
+	}},
+	{"default-selectivity", "predicates estimated by default selectivities without statistics", func(r EstResult) bool {
+		_, ok := matchDefaultSelectivity(r)
+		return ok || r.HasTag(TagDefaultSelectivity)
+	}},
+	{"pseudo-stats", "tables estimated by pseudo statistics", func(r EstResult) bool { return r.PseudoStats }},
+}
+
+// inTopN returns whether this case is a point case on a value in TopN, which is known from tags of datasets or TopN
+// counts of the TopN check.
+func inTopN(r EstResult) bool {
+	return r.HasTag(TagMCV) || r.TopNCount > 0
+}
+
+// wherePart returns the part of this SQL after its first WHERE, or the whole SQL if there is none.
+func wherePart(sql string) string {
+	if i := strings.Index(strings.ToUpper(sql), "WHERE"); i != -1 {
+		return sql[i:]
+	}
+	return sql
+}
+
+// pseudoStats returns whether any operator in results of EXPLAIN is estimated by pseudo statistics.
+func pseudoStats(header []string, results [][]string) bool {
+	infoIdx := -1
+	for i, h := range header {
+		if strings.ToLower(strings.Replace(h, " ", "", -1)) == "operatorinfo" {
+			infoIdx = i
+		}
+	}
+	if infoIdx == -1 {
+		return false
+	}
+	for _, row := range results {
+		if strings.Contains(row[infoIdx], "stats:pseudo") {
+			return true
+		}
+	}
+	return false
+}
+
+// writeCoverage writes a matrix of how many cases of each dataset exercise each estimation feature on any instance,
+// so features never exercised are explicit gaps in the test matrix.
+func writeCoverage(md *bytes.Buffer, opt Option, collector EstResultCollector) {
+	counts := make([][]int, len(coverageFeatures)) // feature, dataset, number of cases
+	for f := range counts {
+		counts[f] = make([]int, len(opt.Datasets))
+	}
+	for dsIdx := range opt.Datasets {
+		for qtIdx := range opt.QueryTypes {
+			exercised := make([]map[string]bool, len(coverageFeatures)) // SQLs exercising each feature on any instance
+			for f := range exercised {
+				exercised[f] = make(map[string]bool)
+			}
+			for insIdx := range opt.Instances {
+				for _, r := range collector.EstResults(insIdx, dsIdx, qtIdx) {
+					for f, feature := range coverageFeatures {
+						if feature.match(r) {
+							exercised[f][r.SQL] = true
+						}
+					}
+				}
+			}
+			for f := range exercised {
+				counts[f][dsIdx] += len(exercised[f])
+			}
+		}
+	}
+
+	md.WriteString("# Estimation Coverage\n")
+	md.WriteString("\nCases exercising each estimation feature, which is inferred from predicates, tags and plans, so it's approximate.\n")
+	md.WriteString("\n| Feature | Description |")
+	for _, ds := range opt.Datasets {
+		md.WriteString(fmt.Sprintf(" %v |", ds.Label))
+	}
+	md.WriteString("\n| ---- | ---- |" + strings.Repeat(" ---- |", len(opt.Datasets)) + "\n")
+	var gaps []string
+	for f, feature := range coverageFeatures {
+		md.WriteString(fmt.Sprintf("| %v | %v |", feature.name, feature.desc))
+		total := 0
+		for dsIdx := range opt.Datasets {
+			if counts[f][dsIdx] == 0 {
+				md.WriteString(" **0** |")
+			} else {
+				md.WriteString(fmt.Sprintf(" %v |", counts[f][dsIdx]))
+			}
+			total += counts[f][dsIdx]
+		}
+		md.WriteString("\n")
+		if total == 0 {
+			gaps = append(gaps, feature.name)
+		}
+	}
+	if len(gaps) > 0 {
+		md.WriteString(fmt.Sprintf("\nNot exercised by any dataset: %v.\n", strings.Join(gaps, ", ")))
+	}
+	md.WriteString("\n")
+}
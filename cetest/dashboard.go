@@ -0,0 +1,114 @@
+package cetest
+
+import (
+	"bytes"
+	"fmt"
+	"math"
+	"os"
+	"sort"
+	"sync"
+	"time"
+)
+
+// dashboardInterval is the interval to redraw the dashboard.
+const dashboardInterval = time.Second
+
+// maxDashboardSamples is the max number of PErrors kept for each cell to calculate running percentiles,
+// later PErrors replace random old ones so percentiles still represent all cases.
+const maxDashboardSamples = 10000
+
+// dashboard shows live progresses of all cells in the terminal, which is redrawn periodically.
+type dashboard struct {
+	lock    sync.Mutex
+	begin   time.Time
+	cells   map[string]*cellStats // key of the cell like "ins/ds/qt"
+	order   []string
+	slowest EstResult // the case with the largest latency of EXPLAIN
+	slowKey string
+}
+
+type cellStats struct {
+	processed int
+	failed    int
+	pes       []float64 // absolute PErrors
+}
+
+func newDashboard() *dashboard {
+	return &dashboard{begin: time.Now(), cells: make(map[string]*cellStats)}
+}
+
+func (d *dashboard) cell(key string) *cellStats {
+	c, ok := d.cells[key]
+	if !ok {
+		c = new(cellStats)
+		d.cells[key] = c
+		d.order = append(d.order, key)
+	}
+	return c
+}
+
+func (d *dashboard) observe(key string, r EstResult) {
+	if d == nil {
+		return
+	}
+	d.lock.Lock()
+	defer d.lock.Unlock()
+	c := d.cell(key)
+	c.processed++
+	pe := math.Abs(PError(r))
+	if len(c.pes) < maxDashboardSamples {
+		c.pes = append(c.pes, pe)
+	} else {
+		c.pes[c.processed%maxDashboardSamples] = pe
+	}
+	if r.PlanLatency > d.slowest.PlanLatency {
+		d.slowest, d.slowKey = r, key
+	}
+}
+
+func (d *dashboard) fail(key string) {
+	if d == nil {
+		return
+	}
+	d.lock.Lock()
+	defer d.lock.Unlock()
+	d.cell(key).failed++
+}
+
+// run redraws the dashboard until stop is closed.
+func (d *dashboard) run(stop chan struct{}) {
+	ticker := time.NewTicker(dashboardInterval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-stop:
+			d.draw()
+			return
+		case <-ticker.C:
+			d.draw()
+		}
+	}
+}
+
+func (d *dashboard) draw() {
+	d.lock.Lock()
+	defer d.lock.Unlock()
+	var buf bytes.Buffer
+	buf.WriteString("\033[H\033[2J") // move to the top-left corner and clear the screen
+	buf.WriteString(fmt.Sprintf("CETest Dashboard, elapsed %v\n\n", time.Since(d.begin).Round(time.Second)))
+	buf.WriteString(fmt.Sprintf("%-60v %10v %8v %10v %10v %10v\n", "Cell", "Processed", "Failed", "P50", "P90", "P99"))
+	for _, key := range d.order {
+		c := d.cells[key]
+		pes := append([]float64(nil), c.pes...)
+		sort.Float64s(pes)
+		p50, p90, p99 := math.NaN(), math.NaN(), math.NaN()
+		if n := len(pes); n > 0 {
+			p50, p90, p99 = pes[n/2], pes[(n*9)/10], pes[(n*99)/100]
+		}
+		buf.WriteString(fmt.Sprintf("%-60v %10v %8v %10.3f %10.3f %10.3f\n", key, c.processed, c.failed, p50, p90, p99))
+	}
+	if d.slowKey != "" {
+		buf.WriteString(fmt.Sprintf("\nSlowest: %v in %v\n  %v\n", d.slowest.PlanLatency, d.slowKey, d.slowest.SQL))
+	}
+	os.Stdout.Write(buf.Bytes())
+}
@@ -2,7 +2,9 @@ package cetest
 
 import (
 	"fmt"
+	"math/rand"
 	"strings"
+	"sync"
 	"time"
 
 	"github.com/pingcap/errors"
@@ -14,21 +16,50 @@ type Dataset interface {
 	// Name returns the name of the dataset
 	Name() string
 
+	// CheckRequirements checks whether the schema and data in this instance match this dataset
+	CheckRequirements(ins tidb.Instance) error
+
 	// GenEstResults ...
 	GenEstResults(ins tidb.Instance, nSamples int, qt QueryType) ([]EstResult, error)
 }
 
+// TruthProvider is implemented by synthetic datasets which know their data exactly, so true cardinalities of
+// generated predicates are calculated from it instead of aggregating data in instances.
+type TruthProvider interface {
+	// Rows returns values of these columns of all rows in this table, formatted as those read from instances.
+	Rows(tb string, cols []string) [][]string
+}
+
 type DATATYPE int
 
 const (
 	DTInt DATATYPE = iota
 	DTDouble
 	DTString
+	DTDecimal
+	DTBit
+	DTEnum
+	DTSet
+	DTDateTime
 )
 
+// quoted returns whether values of this type should be quoted in SQLs.
+func (dt DATATYPE) quoted() bool {
+	return dt == DTString || dt == DTEnum || dt == DTSet || dt == DTDateTime
+}
+
+// selectExpr returns the expression used to read values of this column, BIT values are read as numbers.
+func (dt DATATYPE) selectExpr(col string) string {
+	if dt == DTBit {
+		return fmt.Sprintf("%v+0", col)
+	}
+	return col
+}
+
 type datasetArgs struct {
 	disableAnalyze bool
 	ignoreError    bool
+	dataType       string // type of columns to test, only used by datasets with tables of different types
 }
 
 func parseArgs(args []string) datasetArgs {
@@ -44,6 +75,8 @@ func parseArgs(args []string) datasetArgs {
 			da.disableAnalyze = true
 		case "error":
 			da.ignoreError = true
+		case "type":
+			da.dataType = strings.ToLower(tmp[1])
 		default:
 			panic(errors.Errorf("unknown argument %v", arg))
 		}
@@ -57,20 +90,238 @@ type datasetBase struct {
 
 	scq  *singleColQuerier
 	mciq *mulColIndexQuerier
+
+	cdjq     *crossDBJoinQuerier
+	cdjqOnce sync.Once
+
+	rcq *recursiveCTEQuerier // nil if this dataset has no hierarchy
+
+	optErr error         // error of DatasetOpt found when creating this dataset
+	truth  TruthProvider // not nil if this dataset knows its data exactly
+}
+
+// useTruth makes all queriers of this dataset calculate true cardinalities by this TruthProvider.
+func (ds *datasetBase) useTruth(tp TruthProvider) {
+	ds.truth = tp
+	ds.scq.truth = tp
+	ds.mciq.truth = tp
 }
 
 func (ds *datasetBase) GenEstResults(ins tidb.Instance, nSamples int, qt QueryType) (ers []EstResult, err error) {
 	defer func(begin time.Time) {
-		fmt.Printf("[GenEstResults] dataset=%v, ins=%v, qt=%v, cost=%v\n", ds.opt.Label, ins.Opt().Label, qt, time.Since(begin))
+		cost := time.Since(begin)
+		ds.opt.timings.record(ins.Opt().Label, ds.opt.Label, qt, cost, len(ers))
+		fmt.Printf("[GenEstResults] dataset=%v, ins=%v, qt=%v, cost=%v\n", ds.opt.Label, ins.Opt().Label, qt, cost)
 	}(time.Now())
 
 	switch qt {
-	case QTSingleColPointQueryOnCol, QTSingleColPointQueryOnIndex, QTSingleColMCVPointOnCol, QTSingleColMCVPointOnIndex:
-		ers, err = ds.scq.Collect(nSamples, qt, ers, ins, ds.args.ignoreError)
-	case QTMulColsRangeQueryOnIndex, QTMulColsPointQueryOnIndex:
-		ers, err = ds.mciq.Collect(nSamples, qt, ers, ins, ds.args.ignoreError)
+	case QTSingleColPointQueryOnCol, QTSingleColPointQueryOnIndex, QTSingleColMCVPointOnCol, QTSingleColMCVPointOnIndex,
+		QTSingleColNullRangeQueryOnCol, QTSingleColBoundaryQueryOnCol, QTSingleColInQueryOnCol, QTSingleColRangeQueryOnCol,
+		QTSingleColPrefixLikeQueryOnCol, QTSingleColLatestRangeQueryOnCol, QTSingleColCTEQueryOnCol,
+		QTSingleColApplyQueryOnCol, QTSingleColPointGetQueryOnUniqueKey:
+		ers, err = ds.scq.Collect(nSamples, qt, ers, ins, ds.collectOpt(ins, qt))
+	case QTMulColsRangeQueryOnIndex, QTMulColsPointQueryOnIndex, QTMulColsRangeSweepQueryOnIndex:
+		ers, err = ds.mciq.Collect(nSamples, qt, ers, ins, ds.collectOpt(ins, qt))
+	case QTCrossDBJoinQuery:
+		ds.cdjqOnce.Do(func() {
+			ds.cdjq = newCrossDBJoinQuerier(append([]string{ds.opt.DB}, ds.opt.DBs...), ds.scq)
+		})
+		ers, err = ds.cdjq.Collect(nSamples, qt, ers, ins, ds.collectOpt(ins, qt))
+	case QTRecursiveCTEQuery:
+		if ds.rcq == nil {
+			return nil, errors.Errorf("unsupported query-type=%v", qt)
+		}
+		ers, err = ds.rcq.Collect(nSamples, qt, ers, ins, ds.collectOpt(ins, qt))
 	default:
 		return nil, errors.Errorf("unsupported query-type=%v", qt)
 	}
+	if err == nil && ds.opt.recheck.Enabled {
+		recheckEstimates(ins, ers, ds.opt.recheck, ds.collectOpt(ins, qt))
+	}
+	if ds.opt.writes != nil {
+		for i := range ers {
+			ds.opt.writes.churn(ins.Opt().Label, &ers[i])
+		}
+	}
+	if len(ds.opt.Labels) > 0 {
+		for i := range ers {
+			ers[i].Labels = ds.opt.Labels
+		}
+	}
+	if err == nil && ds.truth != nil && ds.opt.TruthCheck > 0 {
+		err = checkTruth(ins, ers, ds.opt.TruthCheck, ds.opt.guard)
+	}
 	return
 }
+
+// defaultConcurrency is the default number of cases running in parallel on each instance.
+const defaultConcurrency = 64
+
+// collectOpt contains options shared by all queriers when collecting results.
+type collectOpt struct {
+	ignoreErr   bool
+	tagFilter   []string
+	progress    progressOpt
+	concurrency int
+	limiter     chan struct{} // limits the number of cases running in parallel on all instances, nil if unlimited
+	planSample  float64       // fraction of cases whose plans are kept
+	dashboard   *dashboard    // nil if the dashboard is disabled
+	cell        string        // key of the cell in the dashboard
+	executor    Executor      // nil if cases are only explained
+	budget      *runBudget    // nil if resources are not accounted
+	adaptive    AdaptiveOpt
+	convergence *convergence       // nil if cells don't stop early
+	failures    *failureLog        // nil if failed cases are not kept
+	lint        *lintLog           // nil if cases are not linted
+	monitor     *statsMonitor      // nil if statistics are not monitored
+	writes      *writeLoad         // nil if there is no write load
+	control     *runControl        // nil if the control endpoint is disabled
+	latency     *instanceLatencies // nil if the latency-aware mode is disabled
+	archive     *explainArchive    // nil if EXPLAIN outputs are not archived
+	ins         string             // label of the instance
+	ds          string             // label of the dataset
+}
+
+func (ds *datasetBase) collectOpt(ins tidb.Instance, qt QueryType) collectOpt {
+	ds.opt.latency.measure(ins, ds.opt.concurrency)
+	cell := fmt.Sprintf("%v/%v/%v", ins.Opt().Label, ds.opt.Label, qt)
+	return collectOpt{
+		ignoreErr:   ds.args.ignoreError,
+		tagFilter:   ds.opt.Tags,
+		progress:    ds.opt.progress,
+		concurrency: ds.opt.concurrency,
+		limiter:     ds.opt.limiter,
+		planSample:  ds.opt.planSample,
+		dashboard:   ds.opt.dashboard,
+		executor:    ds.opt.executor,
+		budget:      ds.opt.budget,
+		adaptive:    ds.opt.adaptive,
+		convergence: newConvergence(ds.opt.adaptive, cell),
+		failures:    ds.opt.failures,
+		lint:        ds.opt.lint,
+		monitor:     ds.opt.monitor,
+		writes:      ds.opt.writes,
+		control:     ds.opt.control,
+		latency:     ds.opt.latency,
+		archive:     ds.opt.archive,
+		ins:         ins.Opt().Label,
+		ds:          ds.opt.Label,
+		cell:        cell,
+	}
+}
+
+// observe shows this result in the dashboard and checks whether the cell converges.
+func (copt collectOpt) observe(r EstResult) {
+	copt.dashboard.observe(copt.cell, r)
+	copt.convergence.observe(r)
+}
+
+// stopped returns whether no more case of this cell is needed since it converges.
+func (copt collectOpt) stopped() bool {
+	return copt.convergence.stopped()
+}
+
+// cases returns the sampler of n cases of this cell, each of which is visited with probability rate.
+func (copt collectOpt) cases(n int, rate float64) *caseSampler {
+	return newCaseSampler(copt.adaptive, copt.convergence, n, rate)
+}
+
+// fail counts a failed case in the dashboard and keeps it in the failure log.
+func (copt collectOpt) fail(query string, act float64, err error) {
+	copt.dashboard.fail(copt.cell)
+	copt.failures.record(copt.ins, failedEstResult(query, act, err))
+}
+
+// malformed lints this case before it's executed, and counts it as a failed one if it's malformed.
+func (copt collectOpt) malformed(query string, act float64) bool {
+	err := copt.lint.check(copt.ds, query)
+	if err != nil {
+		fmt.Println(query, err)
+		copt.fail(query, act, err)
+	}
+	return err != nil
+}
+
+// execute measures this case by the executor of this run, and checks its true cardinality if it's measured.
+// Cases are only explained once the budget of this instance is used up. Outputs of EXPLAIN are archived if
+// ExplainArchiveOpt is enabled, and only kept in results of sampled cases.
+func (copt collectOpt) execute(ins tidb.Instance, query string, act float64) (EstResult, error) {
+	e := copt.executor
+	if e == nil || copt.budget.exhausted(ins.Opt().Label) {
+		e = explainExecutor{}
+	}
+	begin := time.Now()
+	keepPlan := copt.samplePlan()
+	r, err := e.Execute(ins, query, keepPlan || copt.archive != nil)
+	if err != nil {
+		return r, classifyError(query, err)
+	}
+	if copt.archive != nil {
+		if r.ExplainRef, err = copt.archive.put(r.Plan); err != nil {
+			return r, errors.Errorf("archive the explain of %v, err=%v", query, err)
+		}
+		if !keepPlan {
+			r.Plan = ""
+		}
+	}
+	if _, explainOnly := e.(explainExecutor); !explainOnly {
+		copt.budget.charge(ins.Opt().Label, r, time.Since(begin))
+	}
+	if e.MeasuresTruth() && r.TrueCard != act && !copt.writes.measured(copt.ins, query, act, r.TrueCard) {
+		return r, newCaseError(ErrKindTruthMismatch, query,
+			errors.Errorf("true cardinality mismatch of %v, calculated %v, measured by %v %v", query, act, e.Name(), r.TrueCard))
+	}
+	return r, nil
+}
+
+// samplePlan returns whether to keep the plan of the next case.
+func (copt collectOpt) samplePlan() bool {
+	return copt.planSample > 0 && rand.Float64() < copt.planSample
+}
+
+// workers returns the number of workers running cases in parallel on each instance, which is scaled by the RTT of
+// the instance in the latency-aware mode.
+func (copt collectOpt) workers() int {
+	if n := copt.latency.concurrency(copt.ins); n > 0 {
+		return n
+	}
+	if copt.concurrency > 0 {
+		return copt.concurrency
+	}
+	return defaultConcurrency
+}
+
+// acquire blocks until the number of cases running on all instances is under the limit, and cases on this instance
+// are not paused by the statistics monitor or the control endpoint.
+func (copt collectOpt) acquire() {
+	copt.monitor.wait(copt.ins)
+	copt.control.acquire(copt.ins)
+	if copt.limiter != nil {
+		copt.limiter <- struct{}{}
+	}
+}
+
+func (copt collectOpt) release() {
+	if copt.limiter != nil {
+		<-copt.limiter
+	}
+	copt.control.release(copt.ins)
+}
+
+// checkTruth runs the first n queries with EXPLAIN ANALYZE and checks whether their actual row counts are the same
+// as true cardinalities given by the TruthProvider, which verifies both the provider and parsing of actRows.
+// Queries rejected by the guard are skipped.
+func checkTruth(ins tidb.Instance, ers []EstResult, n int, g GuardOpt) error {
+	for i := 0; i < n && i < len(ers); i++ {
+		r, err := executeWithGuard(ins, ers[i].SQL, g)
+		if rejectedByGuard(err) {
+			continue
+		} else if err != nil {
+			return err
+		}
+		if r.TrueCard != ers[i].TrueCard {
+			return errors.Errorf("actRows=%v of %v mismatches the true cardinality %v", r.TrueCard, ers[i].SQL, ers[i].TrueCard)
+		}
+	}
+	return nil
+}
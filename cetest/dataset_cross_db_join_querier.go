@@ -0,0 +1,133 @@
+package cetest
+
+import (
+	"fmt"
+	"math/rand"
+	"sync"
+	"time"
+
+	"github.com/pingcap/errors"
+	"github.com/qw4990/OptimizerTester/tidb"
+)
+
+// crossDBJoinQuerier supports QTCrossDBJoinQuery.
+// All databases of the dataset should have the same schema, and it generates queries like:
+//
+//	SELECT * FROM db1.t t1 JOIN db2.t t2 ON t1.col = t2.col WHERE t1.col = ?
+//
+// Statistics of the same table in different databases are different, so wrong estimations
+// are produced if statistics are resolved with wrong schemas.
+type crossDBJoinQuerier struct {
+	dbs  []string
+	scqs []*singleColQuerier // one querier for each database to collect distinct values and their row counts
+
+	valRows  []map[string]int // dbIdx, value, numOfRows
+	initOnce sync.Once
+}
+
+func newCrossDBJoinQuerier(dbs []string, scq *singleColQuerier) *crossDBJoinQuerier {
+	scqs := make([]*singleColQuerier, len(dbs))
+	for i, db := range dbs {
+		scqs[i] = newSingleColQuerier(db, scq.tbs, scq.cols, scq.colTypes, scq.qMap)
+	}
+	return &crossDBJoinQuerier{
+		dbs:     dbs,
+		scqs:    scqs,
+		valRows: make([]map[string]int, len(dbs)),
+	}
+}
+
+func (q *crossDBJoinQuerier) init(ins tidb.Instance, tbIdx, colIdx int) (rerr error) {
+	q.initOnce.Do(func() {
+		for i, scq := range q.scqs {
+			if rerr = scq.init(ins); rerr != nil {
+				return
+			}
+			q.valRows[i] = make(map[string]int, scq.ndv(tbIdx, colIdx))
+			for j, val := range scq.orderedDistVals[tbIdx][colIdx] {
+				q.valRows[i][val] = scq.valActRows[tbIdx][colIdx][j]
+			}
+		}
+	})
+	return
+}
+
+func (q *crossDBJoinQuerier) Collect(nSamples int, qt QueryType, ers []EstResult, ins tidb.Instance, copt collectOpt) ([]EstResult, error) {
+	if len(q.dbs) < 2 {
+		return nil, errors.Errorf("query-type=%v requires at least 2 databases", qt)
+	}
+	scq := q.scqs[0]
+	if _, ok := scq.qMap[qt]; !ok {
+		return nil, errors.Errorf("unsupported query-type=%v", qt)
+	}
+	tbIdx, colIdx := scq.qMap[qt][0], scq.qMap[qt][1]
+	if err := q.init(ins, tbIdx, colIdx); err != nil {
+		return nil, err
+	}
+	if nSamples == 0 {
+		nSamples = scq.ndv(tbIdx, colIdx)
+	}
+
+	concurrency := copt.workers()
+	var wg sync.WaitGroup
+	var resultLock sync.Mutex
+	processed := 0
+
+	begin := time.Now()
+	pg := newProgress(copt.progress)
+	tb, col := scq.tbs[tbIdx], scq.cols[tbIdx][colIdx]
+	for workerID := 0; workerID < concurrency; workerID++ {
+		wg.Add(1)
+		go func(id int) {
+			defer wg.Done()
+			for i := id; i < nSamples; i += concurrency {
+				if copt.stopped() {
+					break
+				}
+				db1 := rand.Intn(len(q.dbs))
+				db2 := (db1 + 1 + rand.Intn(len(q.dbs)-1)) % len(q.dbs)
+				vals := q.scqs[db1].orderedDistVals[tbIdx][colIdx]
+				if len(vals) == 0 {
+					continue
+				}
+				val := vals[rand.Intn(len(vals))]
+				act := q.valRows[db1][val] * q.valRows[db2][val]
+				tags := emptyTags(act)
+				if !matchTags(copt.tagFilter, tags) {
+					continue
+				}
+
+				sql := fmt.Sprintf("SELECT * FROM %v.%v t1 JOIN %v.%v t2 ON t1.%v = t2.%v WHERE t1.%v = %v",
+					q.dbs[db1], tb, q.dbs[db2], tb, col, col, col, scq.literal(tbIdx, colIdx, val))
+				if copt.malformed(sql, float64(act)) {
+					continue
+				}
+				copt.acquire()
+				r, err := copt.execute(ins, sql, float64(act))
+				copt.release()
+				if err != nil {
+					if !copt.ignoreErr {
+						panic(err)
+					}
+					fmt.Println(sql, err)
+					copt.fail(sql, float64(act), err)
+					continue
+				}
+
+				r.SQL, r.TrueCard, r.Tags = sql, float64(act), tags
+				resultLock.Lock()
+				ers = append(ers, r)
+				copt.observe(r)
+				processed++
+				if pg.tick(processed) {
+					fmt.Printf("[CrossDBJoinQuerier-Process] ins=%v, table=%v, col=%v, qt=%v, concurrency=%v, time-cost=%v, progress (%v/%v)\n",
+						ins.Opt().Label, tb, col, qt, concurrency, time.Since(begin), processed, nSamples)
+				}
+				resultLock.Unlock()
+			}
+		}(workerID)
+	}
+
+	wg.Wait()
+	return ers, nil
+}
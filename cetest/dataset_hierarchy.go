@@ -0,0 +1,35 @@
+package cetest
+
+// datasetHierarchy's schema is generated by datagen, which is:
+//
+//	CREATE TABLE thier ( id INT PRIMARY KEY, parent_id INT, val INT, KEY(parent_id) )
+//
+// Rows form a random tree rooted at id=1 whose parent_id is 0, which is used to measure estimations of
+// recursive CTEs traversing subtrees, as well as point queries on parents with skewed numbers of children.
+type datasetHierarchy struct {
+	datasetBase
+}
+
+func newDatasetHierarchy(opt DatasetOpt) Dataset {
+	return &datasetHierarchy{datasetBase{
+		opt:  opt,
+		args: parseArgs(opt.Args),
+		scq: newSingleColQuerier(opt.DB,
+			[]string{"thier"},
+			[][]string{{"parent_id", "val", "id"}},
+			[][]DATATYPE{{DTInt, DTInt, DTInt}},
+			map[QueryType][2]int{
+				QTSingleColPointQueryOnCol:   {0, 1}, // SELECT * FROM thier WHERE val=?
+				QTSingleColPointQueryOnIndex: {0, 0}, // SELECT * FROM thier WHERE parent_id=?
+				QTSingleColMCVPointOnIndex:   {0, 0}, // SELECT * FROM thier WHERE parent_id=?
+
+				QTSingleColPointGetQueryOnUniqueKey: {0, 2}, // SELECT * FROM thier WHERE id=?
+			}),
+		mciq: newMulColIndexQuerier(opt.DB, nil, nil, nil, nil, map[QueryType]int{}),
+		rcq:  newRecursiveCTEQuerier(opt.DB, "thier", "id", "parent_id"), // WITH RECURSIVE sub AS (... WHERE id=? ...) SELECT * FROM sub
+	}}
+}
+
+func (ds *datasetHierarchy) Name() string {
+	return "Hierarchy"
+}
@@ -9,18 +9,28 @@ func (ds *datasetIMDB) Name() string {
 }
 
 func newDatasetIMDB(opt DatasetOpt) Dataset {
-	return &datasetIMDB{datasetBase{
+	ds := &datasetIMDB{datasetBase{
 		opt:  opt,
 		args: parseArgs(opt.Args),
 		scq: newSingleColQuerier(opt.DB,
 			[]string{"title", "cast_info"},
-			[][]string{{"phonetic_code"}, {"person_id"}},
-			[][]DATATYPE{{DTString}, {DTInt}},
+			[][]string{{"phonetic_code", "id"}, {"person_id"}},
+			[][]DATATYPE{{DTString, DTInt}, {DTInt}},
 			map[QueryType][2]int{
 				QTSingleColPointQueryOnCol:   {0, 0}, // SELECT * FROM title WHERE phonetic_code=?
 				QTSingleColPointQueryOnIndex: {1, 0}, // SELECT * FROM cast_info WHERE person_id=?
 				QTSingleColMCVPointOnCol:     {0, 0}, // SELECT * FROM title WHERE phonetic_code=?
 				QTSingleColMCVPointOnIndex:   {1, 0}, // SELECT * FROM cast_info WHERE person_id=?
+
+				QTSingleColNullRangeQueryOnCol: {0, 0}, // SELECT * FROM title WHERE phonetic_code IS NULL OR (phonetic_code>=? AND phonetic_code<=?)
+				QTSingleColBoundaryQueryOnCol:  {1, 0}, // SELECT * FROM cast_info WHERE person_id>=2147483647
+				QTSingleColInQueryOnCol:        {0, 0}, // SELECT * FROM title WHERE phonetic_code IN (?, ?, ?)
+				QTSingleColCTEQueryOnCol:       {0, 0}, // WITH cte AS (SELECT * FROM title WHERE phonetic_code=?) SELECT * FROM cte UNION ALL SELECT * FROM cte
+				QTSingleColApplyQueryOnCol:     {0, 0}, // SELECT * FROM title t1 WHERE t1.phonetic_code=? AND EXISTS (SELECT 1 FROM title t2 WHERE t2.phonetic_code=t1.phonetic_code)
+
+				QTSingleColPointGetQueryOnUniqueKey: {0, 1}, // SELECT * FROM title WHERE id=?
+
+				QTCrossDBJoinQuery: {1, 0}, // SELECT * FROM db1.cast_info t1 JOIN db2.cast_info t2 ON t1.person_id=t2.person_id WHERE t1.person_id=?
 			}),
 		mciq: newMulColIndexQuerier(opt.DB,
 			[]string{"TITLE_production_year_episode_of_id_IDX"},
@@ -28,8 +38,12 @@ func newDatasetIMDB(opt DatasetOpt) Dataset {
 			[][]string{{"production_year", "episode_of_id"}},
 			[][]DATATYPE{{DTInt, DTInt}},
 			map[QueryType]int{
-				QTMulColsRangeQueryOnIndex: 0,
-				QTMulColsPointQueryOnIndex: 0,
+				QTMulColsRangeQueryOnIndex:      0,
+				QTMulColsPointQueryOnIndex:      0,
+				QTMulColsRangeSweepQueryOnIndex: 0,
 			}),
 	}}
+	ds.selectTables()
+	ds.addIndexes()
+	return ds
 }
@@ -0,0 +1,353 @@
+package cetest
+
+import (
+	"fmt"
+	"math/rand"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/pingcap/errors"
+	"github.com/qw4990/OptimizerTester/tidb"
+)
+
+// MockOpt describes the shape of tables created by the mock dataset.
+// All tables have the same schema, columns are named c0, c1, ... in order of Types:
+//
+//	CREATE TABLE tmock0 ( c0 INT, c1 VARCHAR(64), ..., KEY idx_0(c0), KEY idx_1(c0, c1), ... )
+type MockOpt struct {
+	Tables       int      `toml:"tables"`       // number of tables
+	Rows         int      `toml:"rows"`         // number of rows of each table
+	NDV          int      `toml:"ndv"`          // number of distinct values of each column
+	Types        []string `toml:"types"`        // types of columns, which are int, double, string, decimal or datetime
+	Distribution string   `toml:"distribution"` // distribution of values, which is uniform or zipf
+	Indexes      []string `toml:"indexes"`      // columns of indexes separated by commas, like "c0,c1"
+}
+
+var defaultMockOpt = MockOpt{
+	Tables:       1,
+	Rows:         10000,
+	NDV:          1000,
+	Types:        []string{"int", "int"},
+	Distribution: "uniform",
+	Indexes:      []string{"c0", "c0,c1"},
+}
+
+// datasetMock creates and loads its tables by itself according to MockOpt, so it can be used as a quick smoke-test
+// target of any shape without preparing data by datagen.
+// Query types are spread over tables, and single-column query types on indexes use the first column of the first index.
+type datasetMock struct {
+	datasetBase
+
+	mock     MockOpt
+	types    []DATATYPE
+	idxCols  [][]string
+	data     [][][]string     // tbIdx, rowIdx, colIdx, values of all rows which are the same in all instances
+	prepared map[string]error // label of the instance, error of preparing
+	prepLock sync.Mutex
+}
+
+func newDatasetMock(opt DatasetOpt) Dataset {
+	ds := &datasetMock{
+		datasetBase: datasetBase{opt: opt, args: parseArgs(opt.Args)},
+		mock:        fillMockOpt(opt.Mock),
+		prepared:    make(map[string]error),
+	}
+	ds.optErr = ds.parseMockOpt()
+	ds.initQueriers()
+	if ds.optErr == nil {
+		ds.genData()
+	}
+	ds.useTruth(ds)
+	return ds
+}
+
+func fillMockOpt(opt MockOpt) MockOpt {
+	if opt.Tables <= 0 {
+		opt.Tables = defaultMockOpt.Tables
+	}
+	if opt.Rows <= 0 {
+		opt.Rows = defaultMockOpt.Rows
+	}
+	if opt.NDV <= 0 {
+		opt.NDV = defaultMockOpt.NDV
+	}
+	if len(opt.Types) == 0 {
+		opt.Types = defaultMockOpt.Types
+	}
+	if opt.Distribution == "" {
+		opt.Distribution = defaultMockOpt.Distribution
+	}
+	if len(opt.Indexes) == 0 {
+		opt.Indexes = defaultMockOpt.Indexes
+	}
+	return opt
+}
+
+func (ds *datasetMock) parseMockOpt() error {
+	for _, tp := range ds.mock.Types {
+		dt, ok := dataTypeNames[strings.ToLower(tp)]
+		if !ok || dt == DTBit || dt == DTEnum || dt == DTSet {
+			return errors.Errorf("unsupported mock type=%v", tp)
+		}
+		ds.types = append(ds.types, dt)
+	}
+	if d := strings.ToLower(ds.mock.Distribution); d != "uniform" && d != "zipf" {
+		return errors.Errorf("unknown mock distribution=%v", ds.mock.Distribution)
+	}
+	for _, idx := range ds.mock.Indexes {
+		var cols []string
+		for _, col := range strings.Split(idx, ",") {
+			col = strings.ToLower(strings.TrimSpace(col))
+			if ds.colIdx(col) == -1 {
+				return errors.Errorf("unknown column %v of mock index %v", col, idx)
+			}
+			cols = append(cols, col)
+		}
+		ds.idxCols = append(ds.idxCols, cols)
+	}
+	return nil
+}
+
+func (ds *datasetMock) colIdx(col string) int {
+	for i := range ds.types {
+		if col == fmt.Sprintf("c%v", i) {
+			return i
+		}
+	}
+	return -1
+}
+
+func (ds *datasetMock) initQueriers() {
+	tbs := make([]string, ds.mock.Tables)
+	cols := make([][]string, ds.mock.Tables)
+	colTypes := make([][]DATATYPE, ds.mock.Tables)
+	for i := range tbs {
+		tbs[i] = fmt.Sprintf("tmock%v", i)
+		for j := range ds.types {
+			cols[i] = append(cols[i], fmt.Sprintf("c%v", j))
+		}
+		colTypes[i] = ds.types
+	}
+
+	// columns used by query types on columns and on indexes
+	onIdx, onCol := 0, 0
+	if len(ds.idxCols) > 0 {
+		onIdx = ds.colIdx(ds.idxCols[0][0])
+	}
+	for j := range ds.types {
+		leading := false
+		for _, idx := range ds.idxCols {
+			leading = leading || ds.colIdx(idx[0]) == j
+		}
+		if !leading {
+			onCol = j
+			break
+		}
+	}
+
+	qMap := make(map[QueryType][2]int)
+	if len(ds.types) > 0 {
+		for qt, col := range map[QueryType]int{
+			QTSingleColPointQueryOnCol:       onCol,
+			QTSingleColPointQueryOnIndex:     onIdx,
+			QTSingleColMCVPointOnCol:         onCol,
+			QTSingleColMCVPointOnIndex:       onIdx,
+			QTSingleColNullRangeQueryOnCol:   onCol,
+			QTSingleColInQueryOnCol:          onCol,
+			QTSingleColRangeQueryOnCol:       onCol,
+			QTSingleColLatestRangeQueryOnCol: onCol,
+			QTSingleColCTEQueryOnCol:         onCol,
+			QTSingleColApplyQueryOnCol:       onCol,
+			QTCrossDBJoinQuery:               onCol,
+		} {
+			qMap[qt] = [2]int{int(qt) % ds.mock.Tables, col}
+		}
+	}
+	for j, dt := range ds.types {
+		if dt == DTInt {
+			qMap[QTSingleColBoundaryQueryOnCol] = [2]int{int(QTSingleColBoundaryQueryOnCol) % ds.mock.Tables, j}
+			break
+		}
+	}
+	for j, dt := range ds.types {
+		if dt == DTString {
+			qMap[QTSingleColPrefixLikeQueryOnCol] = [2]int{int(QTSingleColPrefixLikeQueryOnCol) % ds.mock.Tables, j}
+			break
+		}
+	}
+	ds.scq = newSingleColQuerier(ds.opt.DB, tbs, cols, colTypes, qMap)
+
+	var idxNames, idxTbs []string
+	var idxCols [][]string
+	var idxTypes [][]DATATYPE
+	for i, idx := range ds.idxCols {
+		if len(idx) < 2 {
+			continue
+		}
+		idxNames = append(idxNames, fmt.Sprintf("idx_%v", i))
+		idxTbs = append(idxTbs, tbs[0])
+		idxCols = append(idxCols, idx)
+		types := make([]DATATYPE, len(idx))
+		for j, col := range idx {
+			types[j] = ds.types[ds.colIdx(col)]
+		}
+		idxTypes = append(idxTypes, types)
+	}
+	mciqMap := make(map[QueryType]int)
+	if len(idxNames) > 0 {
+		mciqMap[QTMulColsPointQueryOnIndex] = 0
+		mciqMap[QTMulColsRangeQueryOnIndex] = 0
+		mciqMap[QTMulColsRangeSweepQueryOnIndex] = 0
+	}
+	ds.mciq = newMulColIndexQuerier(ds.opt.DB, idxNames, idxTbs, idxCols, idxTypes, mciqMap)
+}
+
+func (ds *datasetMock) genData() {
+	r := rand.New(rand.NewSource(time.Now().UnixNano()))
+	var zipf *rand.Zipf
+	if strings.ToLower(ds.mock.Distribution) == "zipf" {
+		zipf = rand.NewZipf(r, 1.1, 1, uint64(ds.mock.NDV-1))
+	}
+	ds.data = make([][][]string, ds.mock.Tables)
+	for i := range ds.data {
+		ds.data[i] = make([][]string, ds.mock.Rows)
+		for row := range ds.data[i] {
+			ds.data[i][row] = make([]string, len(ds.types))
+			for j, dt := range ds.types {
+				var v int
+				if zipf != nil {
+					v = int(zipf.Uint64())
+				} else {
+					v = r.Intn(ds.mock.NDV)
+				}
+				ds.data[i][row][j] = mockValue(dt, v)
+			}
+		}
+	}
+}
+
+// Rows implements TruthProvider.
+func (ds *datasetMock) Rows(tb string, cols []string) [][]string {
+	tbIdx := -1
+	for i, t := range ds.scq.tbs {
+		if t == tb {
+			tbIdx = i
+		}
+	}
+	if tbIdx == -1 {
+		return nil
+	}
+	rows := make([][]string, len(ds.data[tbIdx]))
+	for row, vals := range ds.data[tbIdx] {
+		rows[row] = make([]string, len(cols))
+		for j, col := range cols {
+			rows[row][j] = vals[ds.colIdx(col)]
+		}
+	}
+	return rows
+}
+
+func (ds *datasetMock) Name() string {
+	return "Mock"
+}
+
+// CheckRequirements creates and loads all mock tables into this instance before checking them.
+func (ds *datasetMock) CheckRequirements(ins tidb.Instance) error {
+	if ds.optErr != nil {
+		return ds.optErr
+	}
+	ds.prepLock.Lock()
+	err, ok := ds.prepared[ins.Opt().Label]
+	if !ok {
+		err = ds.prepare(ins)
+		ds.prepared[ins.Opt().Label] = err
+	}
+	ds.prepLock.Unlock()
+	if err != nil {
+		return err
+	}
+	return ds.datasetBase.CheckRequirements(ins)
+}
+
+func (ds *datasetMock) prepare(ins tidb.Instance) error {
+	if err := ins.Exec(fmt.Sprintf("CREATE DATABASE IF NOT EXISTS %v", ds.opt.DB)); err != nil {
+		return err
+	}
+	for i, tb := range ds.scq.tbs {
+		if err := ins.Exec(fmt.Sprintf("DROP TABLE IF EXISTS %v.%v", ds.opt.DB, tb)); err != nil {
+			return err
+		}
+		if err := ins.Exec(ds.createTableSQL(tb)); err != nil {
+			return err
+		}
+		const batch = 1000
+		for begin := 0; begin < len(ds.data[i]); begin += batch {
+			var buf strings.Builder
+			buf.WriteString(fmt.Sprintf("INSERT INTO %v.%v VALUES ", ds.opt.DB, tb))
+			for row := begin; row < begin+batch && row < len(ds.data[i]); row++ {
+				if row > begin {
+					buf.WriteString(", ")
+				}
+				buf.WriteString("(")
+				for j, dt := range ds.types {
+					if j > 0 {
+						buf.WriteString(", ")
+					}
+					buf.WriteString(dt.literal(ds.data[i][row][j]))
+				}
+				buf.WriteString(")")
+			}
+			if err := ins.Exec(buf.String()); err != nil {
+				return err
+			}
+		}
+		if !ds.args.disableAnalyze {
+			if err := ins.Exec(fmt.Sprintf("ANALYZE TABLE %v.%v", ds.opt.DB, tb)); err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
+
+func (ds *datasetMock) createTableSQL(tb string) string {
+	defs := make([]string, 0, len(ds.types)+len(ds.idxCols))
+	for j, dt := range ds.types {
+		defs = append(defs, fmt.Sprintf("c%v %v", j, mockColumnType(dt)))
+	}
+	for i, cols := range ds.idxCols {
+		defs = append(defs, fmt.Sprintf("KEY idx_%v(%v)", i, strings.Join(cols, ", ")))
+	}
+	return fmt.Sprintf("CREATE TABLE %v.%v ( %v )", ds.opt.DB, tb, strings.Join(defs, ", "))
+}
+
+func mockColumnType(dt DATATYPE) string {
+	switch dt {
+	case DTDouble:
+		return "DOUBLE"
+	case DTString:
+		return "VARCHAR(64)"
+	case DTDecimal:
+		return "DECIMAL(20, 2)"
+	case DTDateTime:
+		return "DATETIME"
+	}
+	return "INT"
+}
+
+// mockValue converts the v-th distinct value to a value of this type formatted as those read from instances,
+// and the order of values is kept.
+func mockValue(dt DATATYPE, v int) string {
+	switch dt {
+	case DTDouble:
+		return fmt.Sprintf("%v.5", v)
+	case DTString:
+		return fmt.Sprintf("v%08d", v)
+	case DTDecimal:
+		return fmt.Sprintf("%v.25", v)
+	case DTDateTime:
+		return time.Date(2020, 1, 1, 0, 0, 0, 0, time.UTC).Add(time.Duration(v) * time.Minute).Format("2006-01-02 15:04:05")
+	}
+	return fmt.Sprintf("%v", v)
+}
@@ -2,7 +2,10 @@ package cetest
 
 import (
 	"fmt"
+	"math/big"
 	"math/rand"
+	"sort"
+	"strconv"
 	"strings"
 	"sync"
 	"time"
@@ -10,10 +13,11 @@ import (
 	"github.com/qw4990/OptimizerTester/tidb"
 )
 
-// mulColIndexQuerier supports QTMulColsPointQueryOnIndex, QTMulColsRangeQueryOnIndex.
+// mulColIndexQuerier supports QTMulColsPointQueryOnIndex, QTMulColsRangeQueryOnIndex, QTMulColsRangeSweepQueryOnIndex.
 // It generates queries like:
 //	SELECT * FROM t WHERE idx1Col1=? 
 //	SELECT * FROM t WHERE idx1Col1=? and idx1Col2=?
+//	SELECT * FROM t WHERE idx1Col1>=? and idx1Col1<=? and idx1Col2>=? and idx1Col2<=?
 type mulColIndexQuerier struct {
 	db          string
 	indexes     []string
@@ -22,11 +26,20 @@ type mulColIndexQuerier struct {
 	colTypes    [][]DATATYPE // idxID, colID, type
 	qMap        map[QueryType]int
 
-	orderedVals [][][]string // idxID, rowID, colValues
-	valRows     [][]int      // idxID, rowID, numOfRows
+	orderedVals [][][]string        // idxID, rowID, colValues
+	valRows     [][]int             // idxID, rowID, numOfRows
+	totRows     []int               // idxID, numOfRows
+	colDistVals [][][]string        // idxID, colID, ordered distinct values of this column
+	firstRows   [][]int             // idxID, distinct value ID of the first column, the first rowID with this value
+	bounds      [][]map[string]bool // idxID, colID, bounds of buckets of the histogram of this column, see bucketBounds
+	truth       TruthProvider
 	initOnce    sync.Once
 }
 
+// rangeSweepWidths are widths of ranges used by QTMulColsRangeSweepQueryOnIndex, which are fractions of the NDV of each column.
+// The width of each column is chosen independently, so all combinations of these widths are covered.
+var rangeSweepWidths = []float64{0.001, 0.01, 0.05, 0.2, 0.5}
+
 func newMulColIndexQuerier(
 	db string,              // the database name
 	indexes []string,       // index names
@@ -50,15 +63,82 @@ func newMulColIndexQuerier(
 		qMap:        qMap,
 		orderedVals: distVals,
 		valRows:     actRows,
+		totRows:     make([]int, len(indexCols)),
+		colDistVals: make([][][]string, len(indexCols)),
+		firstRows:   make([][]int, len(indexCols)),
+		bounds:      make([][]map[string]bool, len(indexCols)),
+	}
+}
+
+// addIndex adds an index into this querier before initializing it and returns its idxIdx.
+func (q *mulColIndexQuerier) addIndex(index, tb string, cols []string, colTypes []DATATYPE) int {
+	q.indexes = append(q.indexes, index)
+	q.indexTables = append(q.indexTables, tb)
+	q.indexCols = append(q.indexCols, cols)
+	q.colTypes = append(q.colTypes, colTypes)
+	q.orderedVals = append(q.orderedVals, make([][]string, 0, len(cols)))
+	q.valRows = append(q.valRows, nil)
+	q.totRows = append(q.totRows, 0)
+	q.colDistVals = append(q.colDistVals, nil)
+	q.firstRows = append(q.firstRows, nil)
+	q.bounds = append(q.bounds, nil)
+	return len(q.indexes) - 1
+}
+
+// initFromTruth initializes this index by the TruthProvider without querying instances.
+func (q *mulColIndexQuerier) initFromTruth(idxIdx int) {
+	cnt := make(map[string]int)
+	var keys [][]string
+	for _, row := range q.truth.Rows(q.indexTables[idxIdx], q.indexCols[idxIdx]) {
+		key := strings.Join(row, "\x00")
+		if cnt[key] == 0 {
+			keys = append(keys, row)
+		}
+		cnt[key]++
+	}
+	types := q.colTypes[idxIdx]
+	sort.Slice(keys, func(i, j int) bool {
+		for c := range keys[i] {
+			if r := compareVals(keys[i][c], keys[j][c], types[c]); r != 0 {
+				return r < 0
+			}
+		}
+		return false
+	})
+	for _, key := range keys {
+		q.orderedVals[idxIdx] = append(q.orderedVals[idxIdx], key)
+		q.valRows[idxIdx] = append(q.valRows[idxIdx], cnt[strings.Join(key, "\x00")])
 	}
+	q.initDistVals(idxIdx)
+}
+
+// used returns whether this index is used by any query type, unused indexes are not initialized.
+func (q *mulColIndexQuerier) used(idxIdx int) bool {
+	for _, idx := range q.qMap {
+		if idx == idxIdx {
+			return true
+		}
+	}
+	return false
 }
 
 func (q *mulColIndexQuerier) init(ins tidb.Instance) (rerr error) {
 	q.initOnce.Do(func() {
 		for i := range q.indexes {
+			if !q.used(i) {
+				continue
+			}
+			if q.truth != nil {
+				q.initFromTruth(i)
+				continue
+			}
 			begin := time.Now()
 			nCols := len(q.indexCols[i])
 			cols := strings.Join(q.indexCols[i], ", ")
+			selCols := make([]string, nCols)
+			for j, col := range q.indexCols[i] {
+				selCols[j] = q.colTypes[i][j].selectExpr(col)
+			}
 			whereCond := ""
 			for j, col := range q.indexCols[i] {
 				if j > 0 {
@@ -66,7 +146,7 @@ func (q *mulColIndexQuerier) init(ins tidb.Instance) (rerr error) {
 				}
 				whereCond += fmt.Sprintf("%v IS NOT NULL", col)
 			}
-			sql := fmt.Sprintf("SELECT %v, COUNT(*) FROM %v.%v WHERE %v GROUP BY %v ORDER BY %v", cols, q.db, q.indexTables[i], whereCond, cols, cols)
+			sql := fmt.Sprintf("SELECT %v, COUNT(*) FROM %v.%v WHERE %v GROUP BY %v ORDER BY %v", strings.Join(selCols, ", "), q.db, q.indexTables[i], whereCond, cols, cols)
 			rows, err := ins.Query(sql)
 			if err != nil {
 				rerr = err
@@ -89,13 +169,14 @@ func (q *mulColIndexQuerier) init(ins tidb.Instance) (rerr error) {
 			if rerr = rows.Close(); rerr != nil {
 				return
 			}
+			q.initDistVals(i)
 			fmt.Printf("[MulColIndexQuerier-Init] index=%v, sql=%v, cost=%v\n", q.indexes[i], sql, time.Since(begin))
 		}
 	})
 	return
 }
 
-func (q *mulColIndexQuerier) Collect(nSamples int, qt QueryType, ers []EstResult, ins tidb.Instance, ignoreErr bool) ([]EstResult, error) {
+func (q *mulColIndexQuerier) Collect(nSamples int, qt QueryType, ers []EstResult, ins tidb.Instance, copt collectOpt) ([]EstResult, error) {
 	if err := q.init(ins); err != nil {
 		return nil, err
 	}
@@ -110,55 +191,67 @@ func (q *mulColIndexQuerier) Collect(nSamples int, qt QueryType, ers []EstResult
 	}
 
 	begin := time.Now()
-	concurrency := 64
+	pg := newProgress(copt.progress)
+	concurrency := copt.workers()
 	var resultLock sync.Mutex
 	processed := 0
 	var wg sync.WaitGroup
 
+	cases := copt.cases(nRows, sampleRate)
 	for workID := 0; workID < concurrency; workID++ {
 		wg.Add(1)
-		go func(id int) {
+		go func() {
 			defer wg.Done()
-			for rowIdx := id; rowIdx < nRows; rowIdx += concurrency {
-				if rand.Float64() > sampleRate {
-					continue
+			for {
+				rowIdx, biased, ok := cases.next()
+				if !ok {
+					break
 				}
 
-				var cond string
-				var act int
-				if qt == QTMulColsRangeQueryOnIndex {
-					cond, act = q.rangeCond(indexIdx, rowIdx)
-				} else {
-					cond, act = q.pointCond(indexIdx, rowIdx)
+				cond, act, selectivity, tags := q.caseCond(qt, indexIdx, rowIdx)
+				if !matchTags(copt.tagFilter, tags) {
+					continue
+				}
+				if biased {
+					tags = append(tags, TagImportanceSampled)
 				}
 
 				sql := fmt.Sprintf("SELECT * FROM %v.%v WHERE %v", q.db, q.indexTables[indexIdx], cond)
-				est, err := getEstRowFromExplain(ins, sql)
+				if copt.malformed(sql, float64(act)) {
+					continue
+				}
+				copt.acquire()
+				r, err := copt.execute(ins, sql, float64(act))
+				copt.release()
 				if err != nil {
-					if !ignoreErr {
+					if !copt.ignoreErr {
 						panic(err)
 					}
 					fmt.Println(sql, err)
+					copt.fail(sql, float64(act), err)
 					continue
 				}
 
+				r.SQL, r.TrueCard, r.Selectivity, r.Tags = sql, float64(act), selectivity, tags
 				resultLock.Lock()
-				ers = append(ers, EstResult{sql, est, float64(act)})
+				ers = append(ers, r)
+				copt.observe(r)
+				cases.observe(rowIdx, r)
 				processed++
-				if processed%5000 == 0 {
+				if pg.tick(processed) {
 					fmt.Printf("[MulColIndexQuerier-Process] ins=%v, index=%v, qt=%v, concurrency=%v, time-cost=%v, progress (%v/%v)\n",
 						ins.Opt().Label, q.indexTables[indexIdx], qt, concurrency, time.Since(begin), processed, nSamples)
 				}
 				resultLock.Unlock()
 			}
-		}(workID)
+		}()
 	}
 
 	wg.Wait()
 	return ers, nil
 }
 
-func (q *mulColIndexQuerier) rangeCond(indexIdx, rowIdx int) (string, int) {
+func (q *mulColIndexQuerier) rangeCond(indexIdx, rowIdx int) (string, int, [][]string) {
 	colVals := q.orderedVals[indexIdx][rowIdx]
 	last2ndColIdx := len(colVals) - 2
 	endRowIdx := rowIdx
@@ -172,41 +265,233 @@ func (q *mulColIndexQuerier) rangeCond(indexIdx, rowIdx int) (string, int) {
 	cond := ""
 	cols := q.indexCols[indexIdx]
 	types := q.colTypes[indexIdx]
+	consts := make([][]string, len(cols))
 	for c := 0; c < len(cols)-1; c++ {
-		pattern := "%v=%v AND "
-		if types[c] == DTString {
-			pattern = "%v='%v' AND "
-		}
-		cond += fmt.Sprintf(pattern, cols[c], colVals[c])
+		cond += fmt.Sprintf("%v=%v AND ", cols[c], types[c].literal(colVals[c]))
+		consts[c] = []string{colVals[c]}
 	}
-	pattern := "%v>=%v AND %v<=%v"
 	lastColIdx := len(cols) - 1
-	if types[lastColIdx] == DTString {
-		pattern = "%v>='%v' AND %v<='%v'"
-	}
-	cond += fmt.Sprintf(pattern, cols[lastColIdx], q.orderedVals[indexIdx][rowIdx][lastColIdx], cols[lastColIdx], q.orderedVals[indexIdx][endRowIdx][lastColIdx])
+	lastType := types[lastColIdx]
+	low, high := q.orderedVals[indexIdx][rowIdx][lastColIdx], q.orderedVals[indexIdx][endRowIdx][lastColIdx]
+	cond += fmt.Sprintf("%v>=%v AND %v<=%v", cols[lastColIdx], lastType.literal(low), cols[lastColIdx], lastType.literal(high))
+	consts[lastColIdx] = []string{low, high}
 
 	rows := 0
 	for i := rowIdx; i <= endRowIdx; i++ {
 		rows += q.valRows[indexIdx][i]
 	}
-	return cond, rows
+	return cond, rows, consts
 }
 
-func (q *mulColIndexQuerier) pointCond(indexIdx, rowIdx int) (string, int) {
+func (q *mulColIndexQuerier) pointCond(indexIdx, rowIdx int) (string, int, [][]string) {
 	cond := ""
 	cols := q.indexCols[indexIdx]
 	types := q.colTypes[indexIdx]
 	colVals := q.orderedVals[indexIdx][rowIdx]
+	consts := make([][]string, len(cols))
 	for i := 0; i < len(cols); i++ {
 		if i > 0 {
 			cond += " AND "
 		}
-		pattern := "%v=%v"
-		if types[i] == DTString {
-			pattern = "%v='%v'"
+		cond += fmt.Sprintf("%v=%v", cols[i], types[i].literal(colVals[i]))
+		consts[i] = []string{colVals[i]}
+	}
+	return cond, q.valRows[indexIdx][rowIdx], consts
+}
+
+// initDistVals prepares ordered distinct values of all columns of this index, which are used to generate range sweep queries.
+func (q *mulColIndexQuerier) initDistVals(indexIdx int) {
+	rows := q.orderedVals[indexIdx]
+	nCols := len(q.indexCols[indexIdx])
+	q.colDistVals[indexIdx] = make([][]string, nCols)
+	q.totRows[indexIdx] = 0
+	for _, cnt := range q.valRows[indexIdx] {
+		q.totRows[indexIdx] += cnt
+	}
+
+	// rows are already ordered by the first column
+	for rowIdx, colVals := range rows {
+		vals := q.colDistVals[indexIdx][0]
+		if len(vals) == 0 || vals[len(vals)-1] != colVals[0] {
+			q.colDistVals[indexIdx][0] = append(vals, colVals[0])
+			q.firstRows[indexIdx] = append(q.firstRows[indexIdx], rowIdx)
+		}
+	}
+	q.firstRows[indexIdx] = append(q.firstRows[indexIdx], len(rows))
+
+	for c := 1; c < nCols; c++ {
+		distinct := make(map[string]struct{})
+		for _, colVals := range rows {
+			distinct[colVals[c]] = struct{}{}
+		}
+		vals := make([]string, 0, len(distinct))
+		for v := range distinct {
+			vals = append(vals, v)
+		}
+		tp := q.colTypes[indexIdx][c]
+		sort.Slice(vals, func(i, j int) bool { return compareVals(vals[i], vals[j], tp) < 0 })
+		q.colDistVals[indexIdx][c] = vals
+	}
+
+	q.bounds[indexIdx] = make([]map[string]bool, nCols)
+	for c := 0; c < nCols; c++ {
+		cnt := make(map[string]int)
+		for r, colVals := range rows {
+			cnt[colVals[c]] += q.valRows[indexIdx][r]
+		}
+		vals := q.colDistVals[indexIdx][c]
+		valRows := make([]int, len(vals))
+		for i, v := range vals {
+			valRows[i] = cnt[v]
+		}
+		q.bounds[indexIdx][c] = bucketBounds(vals, valRows)
+	}
+}
+
+// caseCond returns the condition of the case generated from rowIdx, its actual row count, its selectivity if this
+// query type records it and its tags.
+func (q *mulColIndexQuerier) caseCond(qt QueryType, indexIdx, rowIdx int) (cond string, act int, selectivity float64, tags []string) {
+	var consts [][]string
+	if qt == QTMulColsRangeQueryOnIndex {
+		cond, act, consts = q.rangeCond(indexIdx, rowIdx)
+	} else if qt == QTMulColsRangeSweepQueryOnIndex {
+		cond, act, consts = q.rangeSweepCond(indexIdx, rowIdx)
+		selectivity = float64(act) / float64(q.totRows[indexIdx])
+	} else {
+		cond, act, consts = q.pointCond(indexIdx, rowIdx)
+	}
+	tags = emptyTags(act)
+	if q.onBucketBound(indexIdx, consts) {
+		tags = append(tags, TagBucketBoundary)
+	}
+	return
+}
+
+// onBucketBound returns whether any value compared with any column of this index is a bound of buckets of the
+// histogram of the column, consts are values compared with each column.
+func (q *mulColIndexQuerier) onBucketBound(indexIdx int, consts [][]string) bool {
+	for c, vals := range consts {
+		if onBucketBound(q.bounds[indexIdx][c], vals) {
+			return true
+		}
+	}
+	return false
+}
+
+// rangeSweepCond generates a range condition on every column of this index.
+// The lower bound of the first column comes from rowIdx, and other bounds are chosen randomly.
+func (q *mulColIndexQuerier) rangeSweepCond(indexIdx, rowIdx int) (string, int, [][]string) {
+	cols := q.indexCols[indexIdx]
+	types := q.colTypes[indexIdx]
+	lows := make([]string, len(cols))
+	highs := make([]string, len(cols))
+	var firstLow, firstHigh int
+	for c := range cols {
+		vals := q.colDistVals[indexIdx][c]
+		width := int(rangeSweepWidths[rand.Intn(len(rangeSweepWidths))] * float64(len(vals)))
+		low := rand.Intn(len(vals))
+		if c == 0 { // the distinct value which rowIdx belongs to
+			firstRows := q.firstRows[indexIdx]
+			low = sort.Search(len(vals), func(i int) bool { return firstRows[i+1] > rowIdx })
+		}
+		high := low + width
+		if high >= len(vals) {
+			high = len(vals) - 1
+		}
+		if c == 0 {
+			firstLow, firstHigh = low, high
+		}
+		lows[c], highs[c] = vals[low], vals[high]
+	}
+
+	cond := ""
+	consts := make([][]string, len(cols))
+	for c := range cols {
+		if c > 0 {
+			cond += " AND "
+		}
+		cond += fmt.Sprintf("%v>=%v AND %v<=%v", cols[c], types[c].literal(lows[c]), cols[c], types[c].literal(highs[c]))
+		consts[c] = []string{lows[c], highs[c]}
+	}
+
+	rows := 0
+	for r := q.firstRows[indexIdx][firstLow]; r < q.firstRows[indexIdx][firstHigh+1]; r++ {
+		colVals := q.orderedVals[indexIdx][r]
+		matched := true
+		for c := 1; c < len(cols) && matched; c++ {
+			matched = compareVals(colVals[c], lows[c], types[c]) >= 0 && compareVals(colVals[c], highs[c], types[c]) <= 0
+		}
+		if matched {
+			rows += q.valRows[indexIdx][r]
+		}
+	}
+	return cond, rows, consts
+}
+
+// compareVals compares two values of this type, returns -1, 0 or 1. Integers and decimals are compared exactly,
+// since BIGINT values beyond 2^53 and DECIMAL values with many digits can't be distinguished by float64.
+func compareVals(a, b string, tp DATATYPE) int {
+	switch tp {
+	case DTInt, DTBit:
+		ia, okA := new(big.Int).SetString(a, 10)
+		ib, okB := new(big.Int).SetString(b, 10)
+		if okA && okB {
+			return ia.Cmp(ib)
+		}
+	case DTDecimal:
+		ra, okA := new(big.Rat).SetString(a)
+		rb, okB := new(big.Rat).SetString(b)
+		if okA && okB {
+			return ra.Cmp(rb)
+		}
+	case DTDouble:
+		fa, errA := strconv.ParseFloat(a, 64)
+		fb, errB := strconv.ParseFloat(b, 64)
+		if errA == nil && errB == nil {
+			if fa < fb {
+				return -1
+			} else if fa > fb {
+				return 1
+			}
+			return 0
+		}
+	}
+	return strings.Compare(a, b)
+}
+
+// histogramBuckets is the number of buckets of histograms built by ANALYZE by default.
+const histogramBuckets = 256
+
+// bucketBounds returns bounds of buckets of the equi-depth histogram built on a column with these distinct values and
+// their row counts, which are sorted by values. Histograms are not read from instances, so bounds are where buckets
+// of histogramBuckets buckets of the same depth end, and the min value where the first bucket begins.
+func bucketBounds(vals []string, rows []int) map[string]bool {
+	bounds := make(map[string]bool)
+	total := 0
+	for _, cnt := range rows {
+		total += cnt
+	}
+	if total == 0 {
+		return bounds
+	}
+	depth := (total + histogramBuckets - 1) / histogramBuckets
+	bounds[vals[0]] = true
+	cum := 0
+	for i, v := range vals {
+		if (cum+rows[i])/depth > cum/depth || i == len(vals)-1 {
+			bounds[v] = true
+		}
+		cum += rows[i]
+	}
+	return bounds
+}
+
+// onBucketBound returns whether any of these values is a bound of buckets.
+func onBucketBound(bounds map[string]bool, vals []string) bool {
+	for _, v := range vals {
+		if bounds[v] {
+			return true
 		}
-		cond += fmt.Sprintf(pattern, cols[i], colVals[i])
 	}
-	return cond, q.valRows[indexIdx][rowIdx]
+	return false
 }
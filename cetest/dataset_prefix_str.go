@@ -0,0 +1,45 @@
+package cetest
+
+// datasetPrefixStr's schema is generated by datagen, which is:
+//
+//	CREATE TABLE tprefix ( url VARCHAR(512), path VARCHAR(512), KEY(url), KEY(url, path) )
+//
+// Values of both columns are long strings sharing long common prefixes like URLs and file paths,
+// which is a known weak spot of histograms storing truncated prefixes of values.
+type datasetPrefixStr struct {
+	datasetBase
+}
+
+func newDatasetPrefixStr(opt DatasetOpt) Dataset {
+	return &datasetPrefixStr{datasetBase{
+		opt:  opt,
+		args: parseArgs(opt.Args),
+		scq: newSingleColQuerier(opt.DB,
+			[]string{"tprefix"},
+			[][]string{{"url", "path"}},
+			[][]DATATYPE{{DTString, DTString}},
+			map[QueryType][2]int{
+				QTSingleColPointQueryOnCol:   {0, 1}, // SELECT * FROM tprefix WHERE path=?
+				QTSingleColPointQueryOnIndex: {0, 0}, // SELECT * FROM tprefix WHERE url=?
+				QTSingleColMCVPointOnCol:     {0, 1}, // SELECT * FROM tprefix WHERE path=?
+				QTSingleColMCVPointOnIndex:   {0, 0}, // SELECT * FROM tprefix WHERE url=?
+
+				QTSingleColInQueryOnCol:         {0, 1}, // SELECT * FROM tprefix WHERE path IN (?, ?, ?)
+				QTSingleColRangeQueryOnCol:      {0, 0}, // SELECT * FROM tprefix WHERE url>=? AND url<=?
+				QTSingleColPrefixLikeQueryOnCol: {0, 0}, // SELECT * FROM tprefix WHERE url LIKE 'prefix%'
+			}),
+		mciq: newMulColIndexQuerier(opt.DB,
+			[]string{"url_2"},
+			[]string{"tprefix"},
+			[][]string{{"url", "path"}},
+			[][]DATATYPE{{DTString, DTString}},
+			map[QueryType]int{
+				QTMulColsRangeQueryOnIndex: 0,
+				QTMulColsPointQueryOnIndex: 0,
+			}),
+	}}
+}
+
+func (ds *datasetPrefixStr) Name() string {
+	return "PrefixStr"
+}
@@ -0,0 +1,165 @@
+package cetest
+
+import (
+	"fmt"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/pingcap/errors"
+	"github.com/qw4990/OptimizerTester/tidb"
+)
+
+// recursiveCTEQuerier supports QTRecursiveCTEQuery on a table of a hierarchy, whose rows reference their parents.
+// It generates queries traversing the subtree of a node like:
+//
+//	WITH RECURSIVE sub AS (SELECT id FROM t WHERE id = ? UNION ALL SELECT t.id FROM t JOIN sub ON t.parent_id = sub.id) SELECT * FROM sub
+//
+// The seed part is a point query on the primary key, so errors of these cases mainly come from estimations of the
+// recursive part, whose true cardinalities are sizes of subtrees calculated from all edges of the hierarchy.
+type recursiveCTEQuerier struct {
+	db        string
+	tb        string
+	idCol     string
+	parentCol string
+
+	ids          []string // ordered by sizes of their subtrees
+	subtreeSizes []int
+	initOnce     sync.Once
+	initErr      error
+}
+
+func newRecursiveCTEQuerier(db, tb, idCol, parentCol string) *recursiveCTEQuerier {
+	return &recursiveCTEQuerier{db: db, tb: tb, idCol: idCol, parentCol: parentCol}
+}
+
+func (q *recursiveCTEQuerier) init(ins tidb.Instance) error {
+	q.initOnce.Do(func() {
+		begin := time.Now()
+		sql := fmt.Sprintf("SELECT %v, %v FROM %v.%v", q.idCol, q.parentCol, q.db, q.tb)
+		_, rows, err := queryText(ins, sql)
+		if err != nil {
+			q.initErr = err
+			return
+		}
+		children := make(map[string][]string, len(rows))
+		for _, row := range rows {
+			children[row[1]] = append(children[row[1]], row[0])
+		}
+		sizes := make(map[string]int, len(rows))
+		visiting := make(map[string]bool)
+		var size func(id string) (int, error)
+		size = func(id string) (int, error) {
+			if s, ok := sizes[id]; ok {
+				return s, nil
+			}
+			if visiting[id] {
+				return 0, errors.Errorf("cycle found in %v.%v at %v=%v", q.db, q.tb, q.idCol, id)
+			}
+			visiting[id] = true
+			s := 1
+			for _, c := range children[id] {
+				cs, err := size(c)
+				if err != nil {
+					return 0, err
+				}
+				s += cs
+			}
+			sizes[id] = s
+			return s, nil
+		}
+		for _, row := range rows {
+			if _, err := size(row[0]); err != nil {
+				q.initErr = err
+				return
+			}
+			q.ids = append(q.ids, row[0])
+		}
+		sort.Slice(q.ids, func(i, j int) bool { return sizes[q.ids[i]] < sizes[q.ids[j]] })
+		q.subtreeSizes = make([]int, len(q.ids))
+		for i, id := range q.ids {
+			q.subtreeSizes[i] = sizes[id]
+		}
+		fmt.Printf("[RecursiveCTEQuerier-Init] table=%v, nodes=%v, sql=%v, cost=%v\n", q.tb, len(q.ids), sql, time.Since(begin))
+	})
+	return q.initErr
+}
+
+func (q *recursiveCTEQuerier) Collect(nSamples int, qt QueryType, ers []EstResult, ins tidb.Instance, copt collectOpt) ([]EstResult, error) {
+	if qt != QTRecursiveCTEQuery {
+		return nil, errors.Errorf("unsupported query-type=%v", qt)
+	}
+	if err := q.init(ins); err != nil {
+		return nil, err
+	}
+	if nSamples == 0 {
+		nSamples = len(q.ids)
+	}
+	sampleRate := float64(len(q.ids)) / float64(nSamples)
+	if sampleRate > 1 {
+		sampleRate = 1
+	}
+
+	concurrency := copt.workers()
+	var wg sync.WaitGroup
+	var resultLock sync.Mutex
+	processed := 0
+
+	begin := time.Now()
+	pg := newProgress(copt.progress)
+	cases := copt.cases(len(q.ids), sampleRate)
+	for workerID := 0; workerID < concurrency; workerID++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for {
+				idx, biased, ok := cases.next()
+				if !ok {
+					break
+				}
+				act := q.subtreeSizes[idx]
+				var tags []string
+				if act == 1 {
+					tags = append(tags, TagLeaf)
+				}
+				if !matchTags(copt.tagFilter, tags) {
+					continue
+				}
+				if biased {
+					tags = append(tags, TagImportanceSampled)
+				}
+				sql := fmt.Sprintf("WITH RECURSIVE sub AS (SELECT %v FROM %v.%v WHERE %v = %v UNION ALL SELECT t.%v FROM %v.%v t JOIN sub ON t.%v = sub.%v) SELECT * FROM sub",
+					q.idCol, q.db, q.tb, q.idCol, q.ids[idx], q.idCol, q.db, q.tb, q.parentCol, q.idCol)
+				if copt.malformed(sql, float64(act)) {
+					continue
+				}
+				copt.acquire()
+				r, err := copt.execute(ins, sql, float64(act))
+				copt.release()
+				if err != nil {
+					if !copt.ignoreErr {
+						panic(err)
+					}
+					fmt.Println(sql, err)
+					copt.fail(sql, float64(act), err)
+					continue
+				}
+
+				r.SQL, r.TrueCard, r.Tags = sql, float64(act), tags
+				resultLock.Lock()
+				ers = append(ers, r)
+				copt.observe(r)
+				cases.observe(idx, r)
+				processed++
+				if pg.tick(processed) {
+					fmt.Printf("[RecursiveCTEQuerier-Process] ins=%v, table=%v, concurrency=%v, time-cost=%v, progress (%v/%v)\n",
+						ins.Opt().Label, q.tb, concurrency, time.Since(begin), processed, nSamples)
+				}
+				resultLock.Unlock()
+			}
+		}()
+	}
+
+	wg.Wait()
+	return ers, nil
+}
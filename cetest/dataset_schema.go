@@ -0,0 +1,359 @@
+package cetest
+
+import (
+	"fmt"
+	"strings"
+	"sync"
+
+	"github.com/pingcap/errors"
+	"github.com/qw4990/OptimizerTester/tidb"
+)
+
+// TableOpt selects a table and its columns used by a dataset.
+type TableOpt struct {
+	Name    string     `toml:"name"`
+	Columns []string   `toml:"columns"` // all columns of this table used by the dataset are selected if empty
+	Indexes []IndexOpt `toml:"indexes"` // extra indexes of this table to test, only supported by some datasets
+}
+
+// IndexOpt describes a multi-column index which is not known by the dataset.
+type IndexOpt struct {
+	Name    string   `toml:"name"`
+	Columns []string `toml:"columns"` // at least 2 columns, since multi-column query types are generated on it
+	Types   []string `toml:"types"`   // types of these columns, which are int, double, string, decimal, bit, enum, set or datetime
+}
+
+var dataTypeNames = map[string]DATATYPE{ // read-only
+	"int":      DTInt,
+	"double":   DTDouble,
+	"string":   DTString,
+	"decimal":  DTDecimal,
+	"bit":      DTBit,
+	"enum":     DTEnum,
+	"set":      DTSet,
+	"datetime": DTDateTime,
+}
+
+func (dt DATATYPE) String() string {
+	for name, t := range dataTypeNames {
+		if t == dt {
+			return name
+		}
+	}
+	return "unknown"
+}
+
+func tableSelected(tables []TableOpt, tb, col string) bool {
+	for _, t := range tables {
+		if !strings.EqualFold(t.Name, tb) {
+			continue
+		}
+		if len(t.Columns) == 0 {
+			return true
+		}
+		for _, c := range t.Columns {
+			if strings.EqualFold(c, col) {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// selectTables removes all query types whose tables or columns are not selected by DatasetOpt.Tables,
+// nothing is removed if no table is specified.
+func (ds *datasetBase) selectTables() {
+	tables := ds.opt.Tables
+	if len(tables) == 0 {
+		return
+	}
+	for qt, pos := range ds.scq.qMap {
+		if !tableSelected(tables, ds.scq.tbs[pos[0]], ds.scq.cols[pos[0]][pos[1]]) {
+			delete(ds.scq.qMap, qt)
+		}
+	}
+	for qt, idx := range ds.mciq.qMap {
+		for _, col := range ds.mciq.indexCols[idx] {
+			if !tableSelected(tables, ds.mciq.indexTables[idx], col) {
+				delete(ds.mciq.qMap, qt)
+				break
+			}
+		}
+	}
+}
+
+// addIndexes makes all multi-column query types test the extra index in DatasetOpt.Tables instead of the default one.
+// Errors of these options are kept and returned by CheckRequirements.
+func (ds *datasetBase) addIndexes() {
+	var idxs []IndexOpt
+	var tbs []string
+	for _, t := range ds.opt.Tables {
+		for _, idx := range t.Indexes {
+			idxs = append(idxs, idx)
+			tbs = append(tbs, t.Name)
+		}
+	}
+	if len(idxs) == 0 {
+		return
+	}
+	if len(idxs) > 1 {
+		ds.optErr = errors.Errorf("only one extra index is supported but got %v", len(idxs))
+		return
+	}
+	idx := idxs[0]
+	if len(idx.Types) != len(idx.Columns) {
+		ds.optErr = errors.Errorf("index %v should have the same number of columns and types", idx.Name)
+		return
+	}
+	if len(idx.Columns) < 2 { // multi-column query types fix all columns but the last one
+		ds.optErr = errors.Errorf("index %v should have at least 2 columns but got %v", idx.Name, len(idx.Columns))
+		return
+	}
+	types := make([]DATATYPE, len(idx.Types))
+	for i, tp := range idx.Types {
+		dt, ok := dataTypeNames[strings.ToLower(tp)]
+		if !ok {
+			ds.optErr = errors.Errorf("unknown type=%v of index %v", tp, idx.Name)
+			return
+		}
+		types[i] = dt
+	}
+	idxIdx := ds.mciq.addIndex(idx.Name, tbs[0], idx.Columns, types)
+	for _, qt := range []QueryType{QTMulColsPointQueryOnIndex, QTMulColsRangeQueryOnIndex, QTMulColsRangeSweepQueryOnIndex} {
+		ds.mciq.qMap[qt] = idxIdx
+	}
+}
+
+// usedColumns returns all columns used by the remaining query types, as well as their types, grouped by tables.
+func (ds *datasetBase) usedColumns() map[string]map[string]DATATYPE {
+	used := make(map[string]map[string]DATATYPE)
+	add := func(tb, col string, tp DATATYPE) {
+		if used[tb] == nil {
+			used[tb] = make(map[string]DATATYPE)
+		}
+		used[tb][col] = tp
+	}
+	for _, pos := range ds.scq.qMap {
+		add(ds.scq.tbs[pos[0]], ds.scq.cols[pos[0]][pos[1]], ds.scq.colTypes[pos[0]][pos[1]])
+	}
+	for _, idx := range ds.mciq.qMap {
+		for j, col := range ds.mciq.indexCols[idx] {
+			add(ds.mciq.indexTables[idx], col, ds.mciq.colTypes[idx][j])
+		}
+	}
+	if ds.rcq != nil {
+		add(ds.rcq.tb, ds.rcq.idCol, DTInt)
+		add(ds.rcq.tb, ds.rcq.parentCol, DTInt)
+	}
+	return used
+}
+
+// CheckRequirements checks whether all selected tables are used by this dataset, whether all columns and indexes used by
+// this dataset exist in the instance with compatible types, and whether all used tables have enough rows.
+func (ds *datasetBase) CheckRequirements(ins tidb.Instance) error {
+	if ds.optErr != nil {
+		return ds.optErr
+	}
+	for _, t := range ds.opt.Tables {
+		cols := t.Columns
+		if len(cols) == 0 {
+			cols = []string{""}
+		}
+		for _, col := range cols {
+			if !ds.knownColumn(t.Name, col) {
+				return errors.Errorf("table=%v, column=%v is not supported by dataset=%v", t.Name, col, ds.opt.Label)
+			}
+		}
+	}
+
+	for tb, cols := range ds.usedColumns() {
+		liveTypes, err := columnTypes(ins, ds.opt.DB, tb)
+		if err != nil {
+			return err
+		}
+		for col, tp := range cols {
+			liveType, ok := liveTypes[strings.ToLower(col)]
+			if !ok {
+				return errors.Errorf("column %v.%v.%v doesn't exist in instance=%v", ds.opt.DB, tb, col, ins.Opt().Label)
+			}
+			if !tp.compatible(liveType) {
+				return errors.Errorf("column %v.%v.%v has an incompatible type %v in instance=%v", ds.opt.DB, tb, col, liveType, ins.Opt().Label)
+			}
+		}
+	}
+
+	checked := make(map[int]bool)
+	for _, idx := range ds.mciq.qMap {
+		if checked[idx] {
+			continue
+		}
+		checked[idx] = true
+		if err := checkIndex(ins, ds.opt.DB, ds.mciq.indexTables[idx], ds.mciq.indexes[idx], ds.mciq.indexCols[idx]); err != nil {
+			return err
+		}
+	}
+
+	minRows := ds.opt.MinRows
+	if minRows <= 0 {
+		minRows = 1
+	}
+	for tb := range ds.usedColumns() {
+		if err := checkMinRows(ins, ds.opt.DB, tb, minRows); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// checkMinRows checks whether this table has at least n rows, without counting all of its rows.
+func checkMinRows(ins tidb.Instance, db, tb string, n int) error {
+	rows, err := ins.Query(fmt.Sprintf("SELECT 1 FROM %v.%v LIMIT %v, 1", db, tb, n-1))
+	if err != nil {
+		return err
+	}
+	defer rows.Close()
+	if !rows.Next() {
+		if err := rows.Err(); err != nil {
+			return errors.Trace(err)
+		}
+		return errors.Errorf("table %v.%v has less than %v rows in instance=%v", db, tb, n, ins.Opt().Label)
+	}
+	return nil
+}
+
+// checkRequirements checks requirements of all datasets on all instances before running any case,
+// so misconfigured runs fail in seconds, and returns errors of all failed pairs.
+// Requirements of each dataset are checked between its setup and teardown, which are the same as its cases.
+func checkRequirements(opt Option, instances []tidb.Instance, datasets []Dataset) error {
+	var wg sync.WaitGroup
+	errs := make([][]string, len(instances))
+	for insIdx := range instances {
+		wg.Add(1)
+		go func(insIdx int) {
+			defer wg.Done()
+			ins := instances[insIdx]
+			for dsIdx, ds := range datasets {
+				dsOpt := opt.Datasets[dsIdx]
+				err := runHooks(ins, dsOpt.Setup)
+				if err == nil {
+					err = ds.CheckRequirements(ins)
+					if terr := runHooks(ins, dsOpt.Teardown); err == nil {
+						err = terr
+					}
+				}
+				if err != nil {
+					errs[insIdx] = append(errs[insIdx], fmt.Sprintf("ins=%v, ds=%v, err=%v", opt.Instances[insIdx].Label, dsOpt.Label, err))
+				}
+			}
+		}(insIdx)
+	}
+	wg.Wait()
+	var msgs []string
+	for _, e := range errs {
+		msgs = append(msgs, e...)
+	}
+	if len(msgs) > 0 {
+		return errors.Errorf("CheckRequirements failed:\n%v", strings.Join(msgs, "\n"))
+	}
+	return nil
+}
+
+// checkIndex checks whether this index exists and starts with these columns.
+func checkIndex(ins tidb.Instance, db, tb, idx string, cols []string) error {
+	q := fmt.Sprintf("SELECT LOWER(COLUMN_NAME) FROM information_schema.statistics WHERE TABLE_SCHEMA='%v' AND TABLE_NAME='%v' AND INDEX_NAME='%v' ORDER BY SEQ_IN_INDEX", db, tb, idx)
+	rows, err := ins.Query(q)
+	if err != nil {
+		return err
+	}
+	defer rows.Close()
+	var idxCols []string
+	for rows.Next() {
+		var col string
+		if err := rows.Scan(&col); err != nil {
+			return errors.Trace(err)
+		}
+		idxCols = append(idxCols, col)
+	}
+	if err := rows.Err(); err != nil {
+		return errors.Trace(err)
+	}
+	if len(idxCols) == 0 {
+		return errors.Errorf("index %v of %v.%v doesn't exist in instance=%v", idx, db, tb, ins.Opt().Label)
+	}
+	if len(idxCols) < len(cols) {
+		return errors.Errorf("index %v of %v.%v has columns %v which don't start with %v", idx, db, tb, idxCols, cols)
+	}
+	for i, col := range cols {
+		if idxCols[i] != strings.ToLower(col) {
+			return errors.Errorf("index %v of %v.%v has columns %v which don't start with %v", idx, db, tb, idxCols, cols)
+		}
+	}
+	return nil
+}
+
+// knownColumn returns whether this column is known by this dataset, and an empty col matches any column of this table.
+func (ds *datasetBase) knownColumn(tb, col string) bool {
+	match := func(t, c string) bool {
+		return strings.EqualFold(t, tb) && (col == "" || strings.EqualFold(c, col))
+	}
+	for i, t := range ds.scq.tbs {
+		for _, c := range ds.scq.cols[i] {
+			if match(t, c) {
+				return true
+			}
+		}
+	}
+	for i, t := range ds.mciq.indexTables {
+		for _, c := range ds.mciq.indexCols[i] {
+			if match(t, c) {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// columnTypes returns lower-cased names and data types of all columns in this table.
+func columnTypes(ins tidb.Instance, db, tb string) (map[string]string, error) {
+	q := fmt.Sprintf("SELECT LOWER(COLUMN_NAME), LOWER(DATA_TYPE) FROM information_schema.columns WHERE TABLE_SCHEMA='%v' AND TABLE_NAME='%v'", db, tb)
+	rows, err := ins.Query(q)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	types := make(map[string]string)
+	for rows.Next() {
+		var col, tp string
+		if err := rows.Scan(&col, &tp); err != nil {
+			return nil, errors.Trace(err)
+		}
+		types[col] = tp
+	}
+	if len(types) == 0 {
+		return nil, errors.Errorf("table %v.%v doesn't exist in instance=%v", db, tb, ins.Opt().Label)
+	}
+	return types, errors.Trace(rows.Err())
+}
+
+// compatible returns whether a column with this data type in information_schema can be tested as this type.
+func (dt DATATYPE) compatible(dataType string) bool {
+	switch dt {
+	case DTInt:
+		return strings.HasSuffix(dataType, "int")
+	case DTDouble:
+		return dataType == "double" || dataType == "float"
+	case DTString:
+		return strings.HasSuffix(dataType, "char") || strings.HasSuffix(dataType, "text")
+	case DTDecimal:
+		return dataType == "decimal"
+	case DTBit:
+		return dataType == "bit"
+	case DTEnum:
+		return dataType == "enum"
+	case DTSet:
+		return dataType == "set"
+	case DTDateTime:
+		return dataType == "datetime" || dataType == "timestamp" || dataType == "date"
+	}
+	return false
+}
@@ -2,16 +2,31 @@ package cetest
 
 import (
 	"fmt"
+	"math/big"
 	"math/rand"
+	"sort"
+	"strings"
 	"sync"
 	"time"
 
+	"github.com/pingcap/errors"
 	"github.com/qw4990/OptimizerTester/tidb"
 )
 
-// singleColQuerier supports QTSingleColPointQueryOnCol, QTSingleColPointQueryOnIndex, QTSingleColMCVPointOnCol, QTSingleColMCVPointOnIndex
+// singleColQuerier supports QTSingleColPointQueryOnCol, QTSingleColPointQueryOnIndex, QTSingleColMCVPointOnCol, QTSingleColMCVPointOnIndex,
+// QTSingleColNullRangeQueryOnCol, QTSingleColBoundaryQueryOnCol, QTSingleColInQueryOnCol, QTSingleColRangeQueryOnCol,
+// QTSingleColPrefixLikeQueryOnCol, QTSingleColLatestRangeQueryOnCol, QTSingleColCTEQueryOnCol, QTSingleColApplyQueryOnCol,
+// QTSingleColPointGetQueryOnUniqueKey
 // It generates queries like:
 //	SELECT * FROM t WHERE col = ?
+//	SELECT * FROM t WHERE col IS NULL OR (col >= ? AND col <= ?)
+//	SELECT * FROM t WHERE col >= 9223372036854775807
+//	SELECT * FROM t WHERE col IN (?, ?, ?)
+//	SELECT * FROM t WHERE col >= ? AND col <= ?
+//	SELECT * FROM t WHERE col LIKE 'prefix%'
+//	SELECT * FROM t WHERE col >= ?
+//	WITH cte AS (SELECT * FROM t WHERE col = ?) SELECT * FROM cte UNION ALL SELECT * FROM cte
+//	SELECT * FROM t t1 WHERE t1.col = ? AND EXISTS (SELECT /*+ NO_DECORRELATE() */ 1 FROM t t2 WHERE t2.col = t1.col)
 type singleColQuerier struct {
 	db       string
 	tbs      []string   // table names
@@ -19,8 +34,13 @@ type singleColQuerier struct {
 	colTypes [][]DATATYPE
 	qMap     map[QueryType][2]int
 
-	orderedDistVals [][][]string // ordered distinct values
-	valActRows      [][][]int    // actual row count
+	orderedDistVals [][][]string        // ordered distinct values
+	valActRows      [][][]int           // actual row count
+	sortedDistVals  [][][]string        // distinct values ordered by values instead of their row counts
+	sortedActRows   [][][]int           // actual row count of sortedDistVals
+	nullRows        [][]int             // number of NULLs
+	bucketBounds    [][]map[string]bool // bounds of buckets of histograms, see bucketBounds
+	truth           TruthProvider
 	initOnce        sync.Once
 }
 
@@ -33,9 +53,17 @@ func newSingleColQuerier(
 ) *singleColQuerier {
 	distVals := make([][][]string, len(cols))
 	actRows := make([][][]int, len(cols))
+	sortedVals := make([][][]string, len(cols))
+	sortedRows := make([][][]int, len(cols))
+	nullRows := make([][]int, len(cols))
+	bounds := make([][]map[string]bool, len(cols))
 	for i := range cols {
 		distVals[i] = make([][]string, len(cols[i]))
 		actRows[i] = make([][]int, len(cols[i]))
+		sortedVals[i] = make([][]string, len(cols[i]))
+		sortedRows[i] = make([][]int, len(cols[i]))
+		nullRows[i] = make([]int, len(cols[i]))
+		bounds[i] = make([]map[string]bool, len(cols[i]))
 	}
 
 	return &singleColQuerier{
@@ -46,6 +74,10 @@ func newSingleColQuerier(
 		qMap:            qMap,
 		orderedDistVals: distVals,
 		valActRows:      actRows,
+		sortedDistVals:  sortedVals,
+		sortedActRows:   sortedRows,
+		nullRows:        nullRows,
+		bucketBounds:    bounds,
 	}
 }
 
@@ -53,8 +85,15 @@ func (tv *singleColQuerier) init(ins tidb.Instance) (rerr error) {
 	tv.initOnce.Do(func() {
 		for i, tb := range tv.tbs {
 			for j, col := range tv.cols[i] {
+				if !tv.used(i, j) {
+					continue
+				}
+				if tv.truth != nil {
+					tv.initFromTruth(i, j)
+					continue
+				}
 				begin := time.Now()
-				q := fmt.Sprintf("SELECT %v, COUNT(*) FROM %v.%v where %v is not null GROUP BY %v ORDER BY COUNT(*)", col, tv.db, tb, col, col)
+				q := fmt.Sprintf("SELECT %v, COUNT(*) FROM %v.%v where %v is not null GROUP BY %v ORDER BY COUNT(*)", tv.colTypes[i][j].selectExpr(col), tv.db, tb, col, col)
 				rows, err := ins.Query(q)
 				if err != nil {
 					rerr = err
@@ -73,6 +112,10 @@ func (tv *singleColQuerier) init(ins tidb.Instance) (rerr error) {
 				if rerr = rows.Close(); rerr != nil {
 					return
 				}
+				if rerr = tv.initNullRows(ins, i, j); rerr != nil {
+					return
+				}
+				tv.initSortedDistVals(i, j)
 				fmt.Printf("[SingleColQuerier-Init] table=%v, col=%v, sql=%v, cost=%v\n", tb, col, q, time.Since(begin))
 			}
 		}
@@ -80,11 +123,15 @@ func (tv *singleColQuerier) init(ins tidb.Instance) (rerr error) {
 	return nil
 }
 
-func (tv *singleColQuerier) Collect(nSamples int, qt QueryType, ers []EstResult, ins tidb.Instance, ignoreErr bool) ([]EstResult, error) {
+func (tv *singleColQuerier) Collect(nSamples int, qt QueryType, ers []EstResult, ins tidb.Instance, copt collectOpt) ([]EstResult, error) {
 	if err := tv.init(ins); err != nil {
 		return nil, err
 	}
 
+	gen, ok := singleColQueryGens[qt]
+	if _, supported := tv.qMap[qt]; !ok || !supported {
+		return nil, errors.Errorf("unsupported query-type=%v", qt)
+	}
 	tbIdx, colIdx := tv.qMap[qt][0], tv.qMap[qt][1]
 	rowBegin, rowEnd := 0, tv.ndv(tbIdx, colIdx)
 	if qt == QTSingleColMCVPointOnCol || qt == QTSingleColMCVPointOnIndex {
@@ -92,6 +139,18 @@ func (tv *singleColQuerier) Collect(nSamples int, qt QueryType, ers []EstResult,
 		numMCVs := numNDVs * 10 / 100 // 10%
 		rowBegin = rowEnd - numMCVs
 	}
+	if qt == QTSingleColPrefixLikeQueryOnCol && tv.colTypes[tbIdx][colIdx] != DTString {
+		return nil, errors.Errorf("query-type=%v requires a string column", qt)
+	}
+	if qt == QTSingleColPointGetQueryOnUniqueKey && !tv.unique(tbIdx, colIdx) {
+		return nil, errors.Errorf("query-type=%v requires a unique column", qt)
+	}
+	if qt == QTSingleColBoundaryQueryOnCol {
+		if tv.colTypes[tbIdx][colIdx] != DTInt {
+			return nil, errors.Errorf("query-type=%v requires an integer column", qt)
+		}
+		rowBegin, rowEnd, nSamples = 0, len(intBoundaries)*len(boundaryOps), 0 // each case once
+	}
 
 	if nSamples == 0 {
 		nSamples = rowEnd - rowBegin
@@ -101,61 +160,360 @@ func (tv *singleColQuerier) Collect(nSamples int, qt QueryType, ers []EstResult,
 		sampleRate = 1
 	}
 
-	concurrency := 64
+	concurrency := copt.workers()
 	var wg sync.WaitGroup
 	var resultLock sync.Mutex
 	processed := 0
 
 	begin := time.Now()
+	pg := newProgress(copt.progress)
+	cases := copt.cases(rowEnd-rowBegin, sampleRate)
 	for workerID := 0; workerID < concurrency; workerID++ {
 		wg.Add(1)
-		go func(id int) {
+		go func() {
 			defer wg.Done()
-			for rowIdx := rowBegin + id; rowIdx < rowEnd; rowIdx += concurrency {
-				if rand.Float64() > sampleRate {
+			for {
+				i, biased, ok := cases.next()
+				if !ok {
+					break
+				}
+				rowIdx := rowBegin + i
+				q, act, consts := gen(tv, tbIdx, colIdx, rowIdx)
+				tags := tv.caseTags(qt, tbIdx, colIdx, rowIdx, act, consts)
+				if !matchTags(copt.tagFilter, tags) {
 					continue
 				}
-				cond, act := tv.pointCond(tbIdx, colIdx, rowIdx)
-				q := fmt.Sprintf("SELECT * FROM %v.%v WHERE %v", tv.db, tv.tbs[tbIdx], cond)
-				est, err := getEstRowFromExplain(ins, q)
+				if biased {
+					tags = append(tags, TagImportanceSampled)
+				}
+				if copt.malformed(q, float64(act)) {
+					continue
+				}
+				copt.acquire()
+				r, err := copt.execute(ins, q, float64(act))
+				copt.release()
 				if err != nil {
-					if !ignoreErr {
+					if !copt.ignoreErr {
 						panic(err)
 					}
 					fmt.Println(q, err)
+					copt.fail(q, float64(act), err)
 					continue
 
 				}
+				if qt == QTSingleColCTEQueryOnCol {
+					tags = append(tags, cteTag(r))
+				} else if qt == QTSingleColApplyQueryOnCol {
+					tags = append(tags, TagCorrelated)
+				} else if qt == QTSingleColPointGetQueryOnUniqueKey && !isPointGetPlan(r.PlanFingerprint) {
+					tags = append(tags, TagNotPointGet)
+				}
+				r.SQL, r.TrueCard, r.Tags = q, float64(act), tags
+				if qt == QTSingleColApplyQueryOnCol {
+					r = correlatedEstResult(r)
+				}
 				resultLock.Lock()
-				ers = append(ers, EstResult{q, est, float64(act)})
+				ers = append(ers, r)
+				copt.observe(r)
+				cases.observe(i, r)
 				processed++
-				if processed%5000 == 0 {
+				if pg.tick(processed) {
 					fmt.Printf("[SingleColQuerier-Process] ins=%v, table=%v, col=%v, qt=%v, concurrency=%v, time-cost=%v, progress (%v/%v)\n",
 						ins.Opt().Label, tv.tbs[tbIdx], tv.cols[tbIdx][colIdx], qt, concurrency, time.Since(begin), processed, nSamples)
 				}
 				resultLock.Unlock()
 			}
-		}(workerID)
+		}()
 	}
 
 	wg.Wait()
 	return ers, nil
 }
 
+// singleColQueryGen generates the query of the case rowIdx on this column, its true cardinality and values the column
+// is compared with.
+type singleColQueryGen func(tv *singleColQuerier, tbIdx, colIdx, rowIdx int) (q string, actRows int, consts []string)
+
+// singleColQueryGens are generators of all query types supported by singleColQuerier.
+var singleColQueryGens = map[QueryType]singleColQueryGen{
+	QTSingleColPointQueryOnCol:          selectWhere((*singleColQuerier).pointCond),
+	QTSingleColPointQueryOnIndex:        selectWhere((*singleColQuerier).pointCond),
+	QTSingleColMCVPointOnCol:            selectWhere((*singleColQuerier).pointCond),
+	QTSingleColMCVPointOnIndex:          selectWhere((*singleColQuerier).pointCond),
+	QTSingleColNullRangeQueryOnCol:      selectWhere(ignoreRowIdx((*singleColQuerier).nullRangeCond)),
+	QTSingleColBoundaryQueryOnCol:       selectWhere((*singleColQuerier).boundaryCond),
+	QTSingleColInQueryOnCol:             selectWhere((*singleColQuerier).inCond),
+	QTSingleColRangeQueryOnCol:          selectWhere(ignoreRowIdx((*singleColQuerier).rangeCond)),
+	QTSingleColPrefixLikeQueryOnCol:     selectWhere((*singleColQuerier).prefixLikeCond),
+	QTSingleColLatestRangeQueryOnCol:    selectWhere(ignoreRowIdx((*singleColQuerier).latestRangeCond)),
+	QTSingleColCTEQueryOnCol:            (*singleColQuerier).cteQuery,
+	QTSingleColApplyQueryOnCol:          (*singleColQuerier).applyQuery,
+	QTSingleColPointGetQueryOnUniqueKey: selectWhere((*singleColQuerier).pointGetCond),
+}
+
+// singleColCond generates the condition of the case rowIdx on this column, its true cardinality and values the
+// column is compared with.
+type singleColCond func(tv *singleColQuerier, tbIdx, colIdx, rowIdx int) (cond string, actRows int, consts []string)
+
+// selectWhere returns the generator of queries selecting rows of the table by conditions generated by cond.
+func selectWhere(cond singleColCond) singleColQueryGen {
+	return func(tv *singleColQuerier, tbIdx, colIdx, rowIdx int) (string, int, []string) {
+		c, act, consts := cond(tv, tbIdx, colIdx, rowIdx)
+		return fmt.Sprintf("SELECT * FROM %v.%v WHERE %v", tv.db, tv.tbs[tbIdx], c), act, consts
+	}
+}
+
+// ignoreRowIdx adapts generators of random conditions which don't depend on the case.
+func ignoreRowIdx(cond func(tv *singleColQuerier, tbIdx, colIdx int) (string, int, []string)) singleColCond {
+	return func(tv *singleColQuerier, tbIdx, colIdx, _ int) (string, int, []string) {
+		return cond(tv, tbIdx, colIdx)
+	}
+}
+
+// cteQuery generates a point query referencing the CTE twice, so whether it's inlined or materialized depends on the optimizer.
+func (tv *singleColQuerier) cteQuery(tbIdx, colIdx, rowIdx int) (q string, actRows int, consts []string) {
+	q, actRows, consts = selectWhere((*singleColQuerier).pointCond)(tv, tbIdx, colIdx, rowIdx)
+	return fmt.Sprintf("WITH cte AS (%v) SELECT * FROM cte UNION ALL SELECT * FROM cte", q), actRows * 2, consts
+}
+
+// applyQuery generates a correlated EXISTS subquery, all outer rows have the same value, so the inner side returns
+// actRows rows for each of them.
+func (tv *singleColQuerier) applyQuery(tbIdx, colIdx, rowIdx int) (q string, actRows int, consts []string) {
+	cond, actRows, consts := tv.pointCond(tbIdx, colIdx, rowIdx)
+	col := tv.cols[tbIdx][colIdx]
+	return fmt.Sprintf("SELECT * FROM %v.%v t1 WHERE t1.%v AND EXISTS (SELECT /*+ NO_DECORRELATE() */ 1 FROM %v.%v t2 WHERE t2.%v = t1.%v)",
+		tv.db, tv.tbs[tbIdx], cond, tv.db, tv.tbs[tbIdx], col, col), actRows, consts
+}
+
+// pointGetCond generates point conditions on the unique key for even cases and IN conditions for odd ones, which
+// are expected to be PointGet and BatchPointGet.
+func (tv *singleColQuerier) pointGetCond(tbIdx, colIdx, rowIdx int) (cond string, actRows int, consts []string) {
+	if rowIdx%2 == 1 {
+		return tv.inCond(tbIdx, colIdx, rowIdx)
+	}
+	return tv.pointCond(tbIdx, colIdx, rowIdx)
+}
+
 func (tv *singleColQuerier) ndv(tbIdx, colIdx int) int {
 	return len(tv.orderedDistVals[tbIdx][colIdx])
 }
 
-func (tv *singleColQuerier) pointCond(tbIdx, colIdx, rowIdx int) (cond string, actRows int) {
-	pattern := "%v=" + tv.colPlaceHolder(tbIdx, colIdx)
-	cond = fmt.Sprintf(pattern, tv.cols[tbIdx][colIdx], tv.orderedDistVals[tbIdx][colIdx][rowIdx])
-	actRows = tv.valActRows[tbIdx][colIdx][rowIdx]
-	return
+// unique returns whether all values of this column are distinct.
+func (tv *singleColQuerier) unique(tbIdx, colIdx int) bool {
+	for _, cnt := range tv.valActRows[tbIdx][colIdx] {
+		if cnt > 1 {
+			return false
+		}
+	}
+	return true
+}
+
+func (tv *singleColQuerier) pointCond(tbIdx, colIdx, rowIdx int) (cond string, actRows int, consts []string) {
+	val := tv.orderedDistVals[tbIdx][colIdx][rowIdx]
+	cond = fmt.Sprintf("%v=%v", tv.cols[tbIdx][colIdx], tv.literal(tbIdx, colIdx, val))
+	return cond, tv.valActRows[tbIdx][colIdx][rowIdx], []string{val}
+}
+
+// literal returns the SQL literal of this value of this column.
+func (tv *singleColQuerier) literal(tbIdx, colIdx int, v string) string {
+	return tv.colTypes[tbIdx][colIdx].literal(v)
+}
+
+// initFromTruth initializes this column by the TruthProvider without querying instances.
+func (tv *singleColQuerier) initFromTruth(tbIdx, colIdx int) {
+	cnt := make(map[string]int)
+	for _, row := range tv.truth.Rows(tv.tbs[tbIdx], []string{tv.cols[tbIdx][colIdx]}) {
+		cnt[row[0]]++
+	}
+	vals := make([]string, 0, len(cnt))
+	for val := range cnt {
+		vals = append(vals, val)
+	}
+	tp := tv.colTypes[tbIdx][colIdx]
+	sort.Slice(vals, func(i, j int) bool {
+		if cnt[vals[i]] != cnt[vals[j]] {
+			return cnt[vals[i]] < cnt[vals[j]]
+		}
+		return compareVals(vals[i], vals[j], tp) < 0
+	})
+	tv.orderedDistVals[tbIdx][colIdx] = vals
+	tv.valActRows[tbIdx][colIdx] = make([]int, len(vals))
+	for i, val := range vals {
+		tv.valActRows[tbIdx][colIdx][i] = cnt[val]
+	}
+	tv.nullRows[tbIdx][colIdx] = 0
+	tv.initSortedDistVals(tbIdx, colIdx)
+}
+
+// used returns whether this column is used by any query type, unused columns are not initialized
+// since their tables may not be loaded.
+func (tv *singleColQuerier) used(tbIdx, colIdx int) bool {
+	for _, pos := range tv.qMap {
+		if pos[0] == tbIdx && pos[1] == colIdx {
+			return true
+		}
+	}
+	return false
+}
+
+func (tv *singleColQuerier) initNullRows(ins tidb.Instance, tbIdx, colIdx int) error {
+	q := fmt.Sprintf("SELECT COUNT(*) FROM %v.%v WHERE %v IS NULL", tv.db, tv.tbs[tbIdx], tv.cols[tbIdx][colIdx])
+	rows, err := ins.Query(q)
+	if err != nil {
+		return err
+	}
+	defer rows.Close()
+	rows.Next()
+	return rows.Scan(&tv.nullRows[tbIdx][colIdx])
 }
 
-func (tv *singleColQuerier) colPlaceHolder(tbIdx, colIdx int) string {
-	if tv.colTypes[tbIdx][colIdx] == DTString {
-		return "'%v'"
+func (tv *singleColQuerier) initSortedDistVals(tbIdx, colIdx int) {
+	n := tv.ndv(tbIdx, colIdx)
+	idx := make([]int, n)
+	for i := range idx {
+		idx[i] = i
+	}
+	vals := tv.orderedDistVals[tbIdx][colIdx]
+	tp := tv.colTypes[tbIdx][colIdx]
+	sort.Slice(idx, func(i, j int) bool { return compareVals(vals[idx[i]], vals[idx[j]], tp) < 0 })
+	tv.sortedDistVals[tbIdx][colIdx] = make([]string, n)
+	tv.sortedActRows[tbIdx][colIdx] = make([]int, n)
+	for i, k := range idx {
+		tv.sortedDistVals[tbIdx][colIdx][i] = vals[k]
+		tv.sortedActRows[tbIdx][colIdx][i] = tv.valActRows[tbIdx][colIdx][k]
+	}
+	tv.bucketBounds[tbIdx][colIdx] = bucketBounds(tv.sortedDistVals[tbIdx][colIdx], tv.sortedActRows[tbIdx][colIdx])
+}
+
+// caseTags returns tags of the case generated from rowIdx, which compares the column with these values.
+func (tv *singleColQuerier) caseTags(qt QueryType, tbIdx, colIdx, rowIdx, act int, consts []string) []string {
+	tags := emptyTags(act)
+	if onBucketBound(tv.bucketBounds[tbIdx][colIdx], consts) {
+		tags = append(tags, TagBucketBoundary)
+	}
+	switch qt {
+	case QTSingleColPointQueryOnCol, QTSingleColPointQueryOnIndex, QTSingleColMCVPointOnCol, QTSingleColMCVPointOnIndex, QTSingleColInQueryOnCol:
+		ndv := tv.ndv(tbIdx, colIdx)
+		if rowIdx >= ndv-ndv*10/100 { // the top 10% values
+			tags = append(tags, TagMCV)
+		}
+	case QTSingleColNullRangeQueryOnCol:
+		tags = append(tags, TagNull)
+	case QTSingleColBoundaryQueryOnCol:
+		vals := tv.sortedDistVals[tbIdx][colIdx]
+		bound := intBoundaries[rowIdx%len(intBoundaries)]
+		tp := tv.colTypes[tbIdx][colIdx]
+		if len(vals) == 0 || compareVals(bound, vals[0], tp) < 0 || compareVals(bound, vals[len(vals)-1], tp) > 0 {
+			tags = append(tags, TagOutOfRange)
+		}
+	}
+	return tags
+}
+
+// nullRangeCond generates a condition mixing IS NULL with a random range on the same column.
+func (tv *singleColQuerier) nullRangeCond(tbIdx, colIdx int) (cond string, actRows int, consts []string) {
+	rangeCond, rangeRows, consts := tv.rangeCond(tbIdx, colIdx)
+	col := tv.cols[tbIdx][colIdx]
+	return fmt.Sprintf("%v IS NULL OR (%v)", col, rangeCond), tv.nullRows[tbIdx][colIdx] + rangeRows, consts
+}
+
+// rangeCond generates a random range on this column, whose width is a random fraction of the NDV.
+// The range of a column without non-NULL values is the whole range, which matches no row.
+func (tv *singleColQuerier) rangeCond(tbIdx, colIdx int) (cond string, actRows int, consts []string) {
+	vals := tv.sortedDistVals[tbIdx][colIdx]
+	if len(vals) == 0 {
+		return fmt.Sprintf("%v IS NOT NULL", tv.cols[tbIdx][colIdx]), 0, nil
+	}
+	low := rand.Intn(len(vals))
+	high := low + int(rangeSweepWidths[rand.Intn(len(rangeSweepWidths))]*float64(len(vals)))
+	if high >= len(vals) {
+		high = len(vals) - 1
+	}
+	col := tv.cols[tbIdx][colIdx]
+	cond = fmt.Sprintf("%v>=%v AND %v<=%v", col, tv.literal(tbIdx, colIdx, vals[low]), col, tv.literal(tbIdx, colIdx, vals[high]))
+	for i := low; i <= high; i++ {
+		actRows += tv.sortedActRows[tbIdx][colIdx][i]
+	}
+	return cond, actRows, []string{vals[low], vals[high]}
+}
+
+// latestRangeFraction is the fraction of the largest distinct values used as lower bounds by QTSingleColLatestRangeQueryOnCol.
+const latestRangeFraction = 0.05
+
+// latestRangeCond generates a range condition covering the latest values of this column, like recent data of time-series tables.
+// Like rangeCond, the range of a column without non-NULL values is the whole range.
+func (tv *singleColQuerier) latestRangeCond(tbIdx, colIdx int) (cond string, actRows int, consts []string) {
+	vals := tv.sortedDistVals[tbIdx][colIdx]
+	if len(vals) == 0 {
+		return fmt.Sprintf("%v IS NOT NULL", tv.cols[tbIdx][colIdx]), 0, nil
+	}
+	n := int(float64(len(vals))*latestRangeFraction) + 1
+	low := len(vals) - 1 - rand.Intn(n)
+	for i := low; i < len(vals); i++ {
+		actRows += tv.sortedActRows[tbIdx][colIdx][i]
+	}
+	return fmt.Sprintf("%v>=%v", tv.cols[tbIdx][colIdx], tv.literal(tbIdx, colIdx, vals[low])), actRows, []string{vals[low]}
+}
+
+// prefixLikeCond generates a LIKE condition matching a random prefix of the value of rowIdx, the prefix of an empty
+// value is empty, which matches all non-NULL values. Prefixes are not compared with values, so no value is returned.
+func (tv *singleColQuerier) prefixLikeCond(tbIdx, colIdx, rowIdx int) (cond string, actRows int, consts []string) {
+	val := tv.orderedDistVals[tbIdx][colIdx][rowIdx]
+	runes := []rune(val)
+	prefix := ""
+	if len(runes) > 0 {
+		prefix = string(runes[:1+rand.Intn(len(runes))]) // never split a multi-byte character
+	}
+	vals := tv.sortedDistVals[tbIdx][colIdx]
+	for i := sort.SearchStrings(vals, prefix); i < len(vals) && strings.HasPrefix(vals[i], prefix); i++ {
+		actRows += tv.sortedActRows[tbIdx][colIdx][i]
+	}
+	return fmt.Sprintf("%v LIKE %v", tv.cols[tbIdx][colIdx], QuoteLikePrefix(prefix)), actRows, nil
+}
+
+// intBoundaries are values at boundaries of integer types, most of them are out of the range of the column.
+var intBoundaries = []string{
+	"0", "-1", "1",
+	"-2147483648", "2147483647", "2147483648", "4294967295", "4294967296", // INT, INT UNSIGNED
+	"-9223372036854775808", "9223372036854775807", "9223372036854775808", "18446744073709551615", // BIGINT, BIGINT UNSIGNED
+}
+
+var boundaryOps = []string{"=", ">=", "<"}
+
+// boundaryCond generates the caseIdx-th condition comparing the column with a boundary value.
+func (tv *singleColQuerier) boundaryCond(tbIdx, colIdx, caseIdx int) (cond string, actRows int, consts []string) {
+	val, op := intBoundaries[caseIdx%len(intBoundaries)], boundaryOps[caseIdx/len(intBoundaries)]
+	bound, _ := new(big.Int).SetString(val, 10)
+	for i, v := range tv.orderedDistVals[tbIdx][colIdx] {
+		x, ok := new(big.Int).SetString(v, 10)
+		if !ok {
+			continue
+		}
+		c := x.Cmp(bound)
+		if (op == "=" && c == 0) || (op == ">=" && c >= 0) || (op == "<" && c < 0) {
+			actRows += tv.valActRows[tbIdx][colIdx][i]
+		}
+	}
+	return fmt.Sprintf("%v%v%v", tv.cols[tbIdx][colIdx], op, val), actRows, []string{val}
+}
+
+// maxInListLen is the max number of values in IN lists generated by QTSingleColInQueryOnCol.
+const maxInListLen = 8
+
+// inCond generates an IN condition containing the value of rowIdx and some other random distinct values.
+func (tv *singleColQuerier) inCond(tbIdx, colIdx, rowIdx int) (cond string, actRows int, consts []string) {
+	ndv := tv.ndv(tbIdx, colIdx)
+	picked := map[int]struct{}{rowIdx: {}}
+	for n := rand.Intn(maxInListLen); n > 0 && len(picked) < ndv; n-- {
+		picked[rand.Intn(ndv)] = struct{}{}
+	}
+	vals := make([]string, 0, len(picked))
+	for i := range picked {
+		val := tv.orderedDistVals[tbIdx][colIdx][i]
+		consts = append(consts, val)
+		vals = append(vals, tv.literal(tbIdx, colIdx, val))
+		actRows += tv.valActRows[tbIdx][colIdx][i]
 	}
-	return "%v"
+	sort.Strings(vals)
+	return fmt.Sprintf("%v IN (%v)", tv.cols[tbIdx][colIdx], strings.Join(vals, ", ")), actRows, consts
 }
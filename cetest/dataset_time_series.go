@@ -0,0 +1,44 @@
+package cetest
+
+// datasetTimeSeries's schema is generated by datagen, which is:
+//
+//	CREATE TABLE tts ( ts DATETIME, device_id INT, val DOUBLE, KEY(ts), KEY(device_id, ts) )
+//
+// It's an append-only table whose newest rows are loaded after analyzing, so don't put it into
+// analyze-tables if you want to measure estimations on out-of-range values with stale statistics.
+type datasetTimeSeries struct {
+	datasetBase
+}
+
+func newDatasetTimeSeries(opt DatasetOpt) Dataset {
+	return &datasetTimeSeries{datasetBase{
+		opt:  opt,
+		args: parseArgs(opt.Args),
+		scq: newSingleColQuerier(opt.DB,
+			[]string{"tts"},
+			[][]string{{"ts", "device_id"}},
+			[][]DATATYPE{{DTDateTime, DTInt}},
+			map[QueryType][2]int{
+				QTSingleColPointQueryOnCol:   {0, 1}, // SELECT * FROM tts WHERE device_id=?
+				QTSingleColPointQueryOnIndex: {0, 0}, // SELECT * FROM tts WHERE ts=?
+				QTSingleColMCVPointOnCol:     {0, 1}, // SELECT * FROM tts WHERE device_id=?
+				QTSingleColMCVPointOnIndex:   {0, 0}, // SELECT * FROM tts WHERE ts=?
+
+				QTSingleColRangeQueryOnCol:       {0, 0}, // SELECT * FROM tts WHERE ts>=? AND ts<=?
+				QTSingleColLatestRangeQueryOnCol: {0, 0}, // SELECT * FROM tts WHERE ts>=?
+			}),
+		mciq: newMulColIndexQuerier(opt.DB,
+			[]string{"device_id"},
+			[]string{"tts"},
+			[][]string{{"device_id", "ts"}},
+			[][]DATATYPE{{DTInt, DTDateTime}},
+			map[QueryType]int{
+				QTMulColsRangeQueryOnIndex: 0, // SELECT * FROM tts WHERE device_id=? AND ts>=? AND ts<=?
+				QTMulColsPointQueryOnIndex: 0, // SELECT * FROM tts WHERE device_id=? AND ts=?
+			}),
+	}}
+}
+
+func (ds *datasetTimeSeries) Name() string {
+	return "TimeSeries"
+}
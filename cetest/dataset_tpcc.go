@@ -1,5 +1,12 @@
 package cetest
 
+import (
+	"fmt"
+
+	"github.com/pingcap/errors"
+	"github.com/qw4990/OptimizerTester/tidb"
+)
+
 type datasetTPCC struct {
 	datasetBase
 }
@@ -9,27 +16,62 @@ func (ds *datasetTPCC) Name() string {
 }
 
 func newDatasetTPCC(opt DatasetOpt) Dataset {
-	return &datasetTPCC{datasetBase{
+	ds := &datasetTPCC{datasetBase{
 		opt:  opt,
 		args: parseArgs(opt.Args),
 		scq: newSingleColQuerier(opt.DB,
 			[]string{"order_line", "customer"},
 			[][]string{{"ol_amount"}, {"c_ytd_payment"}},
-			[][]DATATYPE{{DTDouble}, {DTDouble}},
+			[][]DATATYPE{{DTDecimal}, {DTDecimal}},
 			map[QueryType][2]int{
 				QTSingleColPointQueryOnCol:   {0, 0}, // select * from order_line where ol_amount = ?
 				QTSingleColPointQueryOnIndex: {1, 0}, // select * from customer where c_ytd_payment = ?
 				QTSingleColMCVPointOnCol:     {0, 0}, // select * from order_line where ol_amount = ?
 				QTSingleColMCVPointOnIndex:   {1, 0}, // select * from customer where c_ytd_payment = ?
+
+				QTSingleColNullRangeQueryOnCol: {0, 0}, // select * from order_line where ol_amount is null or (ol_amount >= ? and ol_amount <= ?)
+				QTSingleColInQueryOnCol:        {0, 0}, // select * from order_line where ol_amount in (?, ?, ?)
+				QTSingleColCTEQueryOnCol:       {0, 0}, // with cte as (select * from order_line where ol_amount = ?) select * from cte union all select * from cte
+
+				QTCrossDBJoinQuery: {1, 0}, // select * from db1.customer t1 join db2.customer t2 on t1.c_ytd_payment = t2.c_ytd_payment where t1.c_ytd_payment = ?
 			}),
 		mciq: newMulColIndexQuerier(opt.DB,
 			[]string{"idx_c_discount_balance"},
 			[]string{"customer"},
 			[][]string{{"c_discount", "c_balance"}},
-			[][]DATATYPE{{DTDouble, DTDouble}},
+			[][]DATATYPE{{DTDecimal, DTDecimal}},
 			map[QueryType]int{
-				QTMulColsRangeQueryOnIndex: 0,
-				QTMulColsPointQueryOnIndex: 0,
+				QTMulColsRangeQueryOnIndex:      0,
+				QTMulColsPointQueryOnIndex:      0,
+				QTMulColsRangeSweepQueryOnIndex: 0,
 			}),
 	}}
+	ds.selectTables()
+	return ds
+}
+
+// CheckRequirements also checks whether the number of warehouses is as expected, since data distributions of TPCC
+// datasets with different scales are different.
+func (ds *datasetTPCC) CheckRequirements(ins tidb.Instance) error {
+	if err := ds.datasetBase.CheckRequirements(ins); err != nil {
+		return err
+	}
+	if ds.opt.Warehouses <= 0 {
+		return nil
+	}
+	rows, err := ins.Query(fmt.Sprintf("SELECT COUNT(*) FROM %v.warehouse", ds.opt.DB))
+	if err != nil {
+		return err
+	}
+	defer rows.Close()
+	var n int
+	if rows.Next() {
+		if err := rows.Scan(&n); err != nil {
+			return errors.Trace(err)
+		}
+	}
+	if n != ds.opt.Warehouses {
+		return errors.Errorf("expect %v warehouses but got %v in %v.warehouse", ds.opt.Warehouses, n, ds.opt.DB)
+	}
+	return nil
 }
@@ -0,0 +1,44 @@
+package cetest
+
+// datasetWide's schema is generated by datagen, which is:
+//
+//	CREATE TABLE twide ( c0 INT, c1 INT, ..., cN INT, KEY idx_c0_c1(c0, c1), KEY idx_c0(c0), KEY idx_c10(c10), ... )
+//
+// Every 10th column is indexed, so there are lots of statistics objects on this table,
+// which is used to measure both estimation accuracy and latencies of the optimizer on wide tables.
+type datasetWide struct {
+	datasetBase
+}
+
+func newDatasetWide(opt DatasetOpt) Dataset {
+	return &datasetWide{datasetBase{
+		opt:  opt,
+		args: parseArgs(opt.Args),
+		scq: newSingleColQuerier(opt.DB,
+			[]string{"twide"},
+			[][]string{{"c0", "c1"}},
+			[][]DATATYPE{{DTInt, DTInt}},
+			map[QueryType][2]int{
+				QTSingleColPointQueryOnCol:   {0, 1}, // SELECT * FROM twide WHERE c1=?
+				QTSingleColPointQueryOnIndex: {0, 0}, // SELECT * FROM twide WHERE c0=?
+				QTSingleColMCVPointOnCol:     {0, 1}, // SELECT * FROM twide WHERE c1=?
+				QTSingleColMCVPointOnIndex:   {0, 0}, // SELECT * FROM twide WHERE c0=?
+
+				QTSingleColInQueryOnCol: {0, 1}, // SELECT * FROM twide WHERE c1 IN (?, ?, ?)
+			}),
+		mciq: newMulColIndexQuerier(opt.DB,
+			[]string{"idx_c0_c1"},
+			[]string{"twide"},
+			[][]string{{"c0", "c1"}},
+			[][]DATATYPE{{DTInt, DTInt}},
+			map[QueryType]int{
+				QTMulColsRangeQueryOnIndex:      0,
+				QTMulColsPointQueryOnIndex:      0,
+				QTMulColsRangeSweepQueryOnIndex: 0,
+			}),
+	}}
+}
+
+func (ds *datasetWide) Name() string {
+	return "Wide"
+}
@@ -1,40 +1,78 @@
 package cetest
 
+import "github.com/pingcap/errors"
+
 /*
 	datasetZipFX's schemas are:
 		CREATE TABLE tint ( a INT, b INT, KEY(a), KEY(a, b) )
 		CREATE TABLE tdouble ( a DOUBLE, b DOUBLE, KEY(a), KEY(a, b) )
 		CREATE TABLE tstring ( a VARCHAR(32), b VARCHAR(32), KEY(a), KEY(a, b) )
 		CREATE TABLE tdatetime (a DATETIME, b DATATIME, KEY(a), KEY(a, b))
+		CREATE TABLE tdecimal ( a DECIMAL(20, 4), b DECIMAL(20, 4), KEY(a), KEY(a, b) )
+		CREATE TABLE tbit ( a BIT(16), b BIT(16), KEY(a), KEY(a, b) )
+		CREATE TABLE tenum ( a ENUM('e0', ..., 'e63'), b ENUM('e0', ..., 'e63'), KEY(a), KEY(a, b) )
+		CREATE TABLE tset ( a SET('s0', ..., 's15'), b SET('s0', ..., 's15'), KEY(a), KEY(a, b) )
+	The type of tables to test is specified by the argument "type", which is "int" by default.
 */
 type datasetZipFX struct {
 	datasetBase
 }
 
+var zipFXTables = map[string]struct {
+	name string
+	tp   DATATYPE
+}{
+	"int":     {"tint", DTInt},
+	"double":  {"tdouble", DTDouble},
+	"decimal": {"tdecimal", DTDecimal},
+	"string":  {"tstring", DTString},
+	"bit":     {"tbit", DTBit},
+	"enum":    {"tenum", DTEnum},
+	"set":     {"tset", DTSet},
+}
+
 func newDatasetZipFX(opt DatasetOpt) Dataset {
-	// TODO: only support int now
-	scqTbs := []string{"tint"}
+	args := parseArgs(opt.Args)
+	if args.dataType == "" {
+		args.dataType = "int"
+	}
+	tb, ok := zipFXTables[args.dataType]
+	if !ok {
+		panic(errors.Errorf("unsupported type=%v for zipfx", args.dataType))
+	}
+
+	scqTbs := []string{tb.name}
 	scqCols := [][]string{{"a", "b"}}
-	scqColTypes := [][]DATATYPE{{DTInt, DTInt}}
+	scqColTypes := [][]DATATYPE{{tb.tp, tb.tp}}
 	scqMap := map[QueryType][2]int{
 		QTSingleColPointQueryOnCol:   {0, 1}, // SELECT * FROM tint WHERE b=?
 		QTSingleColPointQueryOnIndex: {0, 0}, // SELECT * FROM tint WHERE a=?
 		QTSingleColMCVPointOnCol:     {0, 1}, // SELECT * FROM tint WHERE b=?
 		QTSingleColMCVPointOnIndex:   {0, 0}, // SELECT * FROM tint WHERE a=?
+
+		QTSingleColNullRangeQueryOnCol: {0, 1}, // SELECT * FROM tint WHERE b IS NULL OR (b>=? AND b<=?)
+		QTSingleColBoundaryQueryOnCol:  {0, 1}, // SELECT * FROM tint WHERE b>=2147483647
+		QTSingleColInQueryOnCol:        {0, 1}, // SELECT * FROM tint WHERE b IN (?, ?, ?)
+		QTSingleColCTEQueryOnCol:       {0, 1}, // WITH cte AS (SELECT * FROM tint WHERE b=?) SELECT * FROM cte UNION ALL SELECT * FROM cte
+		QTSingleColApplyQueryOnCol:     {0, 1}, // SELECT * FROM tint t1 WHERE t1.b=? AND EXISTS (SELECT 1 FROM tint t2 WHERE t2.b=t1.b)
+
+		QTCrossDBJoinQuery: {0, 0}, // SELECT * FROM db1.tint t1 JOIN db2.tint t2 ON t1.a=t2.a WHERE t1.a=?
 	}
 
 	mciqIdxs := []string{"a_2"}
-	mciqTbs := []string{"tint"}
+	mciqTbs := []string{tb.name}
 	mciqIdxCols := [][]string{{"a", "b"}}
-	mciqColTypes := [][]DATATYPE{{DTInt, DTInt}}
+	mciqColTypes := [][]DATATYPE{{tb.tp, tb.tp}}
 	mciqMap := map[QueryType]int{
 		QTMulColsPointQueryOnIndex: 0, // SELECT * FROM tint WHERE a=? AND b=?
 		QTMulColsRangeQueryOnIndex: 0, // SELECT * FROM tint WHERE a=? AND b>=? AND b<=?
+
+		QTMulColsRangeSweepQueryOnIndex: 0, // SELECT * FROM tint WHERE a>=? AND a<=? AND b>=? AND b<=?
 	}
 
 	return &datasetZipFX{datasetBase{
 		opt:  opt,
-		args: parseArgs(opt.Args),
+		args: args,
 		scq:  newSingleColQuerier(opt.DB, scqTbs, scqCols, scqColTypes, scqMap),
 		mciq: newMulColIndexQuerier(opt.DB, mciqIdxs, mciqTbs, mciqIdxCols, mciqColTypes, mciqMap),
 	}}
@@ -0,0 +1,116 @@
+package cetest
+
+import (
+	"bytes"
+	"fmt"
+	"math"
+	"strings"
+
+	"github.com/qw4990/OptimizerTester/tidb"
+)
+
+// TagDefaultSelectivity tags cases whose estimations are well-known default selectivities of TiDB applied to rows of
+// tables, which means the optimizer gives up and guesses instead of using statistics.
+const TagDefaultSelectivity = "default-selectivity"
+
+// defaultSelectivity is a constant selectivity used by TiDB when predicates can't be estimated by statistics.
+type defaultSelectivity struct {
+	name  string
+	value float64
+	desc  string
+}
+
+var defaultSelectivities = []defaultSelectivity{ // read-only
+	{"0.8", 0.8, "selection factor of predicates without statistics"},
+	{"0.1", 0.1, "selectivity of unknown predicates on some versions"},
+	{"1/3", 1.0 / 3, "pseudo selectivity of less or greater than"},
+	{"1/40", 1.0 / 40, "pseudo selectivity of between"},
+	{"1/1000", 1.0 / 1000, "pseudo selectivity of equal"},
+}
+
+// minDefaultSelectivityRows is the min rows of tables to detect default selectivities, below which estimations
+// equal to them are mostly coincidences.
+const minDefaultSelectivityRows = 100
+
+// matchDefaultSelectivity returns the name of the default selectivity which the estimation of this case equals,
+// and false if there is none or rows of its tables are unknown. Estimated rows are rounded to 2 decimals by EXPLAIN.
+func matchDefaultSelectivity(r EstResult) (string, bool) {
+	if r.TableRows < minDefaultSelectivityRows {
+		return "", false
+	}
+	for _, ds := range defaultSelectivities {
+		if math.Abs(r.EstCard-ds.value*r.TableRows) <= 0.005 {
+			return ds.name, true
+		}
+	}
+	return "", false
+}
+
+// tagDefaultSelectivities tags all cases whose estimations equal default selectivities with TagDefaultSelectivity,
+// which requires rows of their tables.
+func tagDefaultSelectivities(opt Option, instances []tidb.Instance, collector EstResultCollector) {
+	for insIdx := range instances {
+		for dsIdx := range opt.Datasets {
+			for qtIdx := range opt.QueryTypes {
+				for i, r := range collector.EstResults(insIdx, dsIdx, qtIdx) {
+					if _, ok := matchDefaultSelectivity(r); ok && !r.HasTag(TagDefaultSelectivity) {
+						r.Tags = append(r.Tags, TagDefaultSelectivity)
+						collector.UpdateEstResult(insIdx, dsIdx, qtIdx, i, r)
+					}
+				}
+			}
+		}
+	}
+}
+
+// writeDefaultSelectivities writes how often estimations of each instance in this cell are default selectivities,
+// grouped by constants. It's skipped if rows of tables are unknown.
+func writeDefaultSelectivities(md *bytes.Buffer, opt Option, collector EstResultCollector, dsIdx, qtIdx int) {
+	header := false
+	for insIdx, ins := range opt.Instances {
+		cases, guessed := 0, 0
+		byConst := make(map[string]int)
+		example := "-"
+		for _, r := range collector.EstResults(insIdx, dsIdx, qtIdx) {
+			if r.TableRows < minDefaultSelectivityRows {
+				continue
+			}
+			cases++
+			name, ok := matchDefaultSelectivity(r)
+			if !ok {
+				continue
+			}
+			guessed++
+			byConst[name]++
+			if example == "-" {
+				example = fmt.Sprintf("`%v`: %v of %v rows", strings.Replace(opt.reportSQL(r.SQL), "|", "\\|", -1), name, opt.NumberFormat.rows(r.TableRows))
+			}
+		}
+		if cases == 0 {
+			continue
+		}
+		if !header {
+			md.WriteString("\nDefault Selectivities\n")
+			var legend []string
+			for _, ds := range defaultSelectivities {
+				legend = append(legend, fmt.Sprintf("%v is the %v", ds.name, ds.desc))
+			}
+			md.WriteString(fmt.Sprintf("\nEstimations equal to default selectivities applied to table rows, where %v.\n", strings.Join(legend, "; ")))
+			md.WriteString("\n| Instance | Cases | Guessed | Fraction | By Constant | Example |\n")
+			md.WriteString("| ---- | ---- | ---- | ---- | ---- | ---- |\n")
+			header = true
+		}
+		var consts []string
+		for _, ds := range defaultSelectivities {
+			if byConst[ds.name] > 0 {
+				consts = append(consts, fmt.Sprintf("%v: %v", ds.name, byConst[ds.name]))
+			}
+		}
+		byConstText := "-"
+		if len(consts) > 0 {
+			byConstText = strings.Join(consts, ", ")
+		}
+		md.WriteString(fmt.Sprintf("| %v | %v | %v | %.1f%% | %v | %v |\n", ins.Label, cases, guessed,
+			float64(guessed)*100/float64(cases), byConstText, example))
+	}
+}
@@ -0,0 +1,301 @@
+package cetest
+
+import (
+	"bytes"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path"
+	"regexp"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/BurntSushi/toml"
+	"github.com/pingcap/errors"
+	"github.com/qw4990/OptimizerTester/tidb"
+)
+
+// DistributeOpt describes Kubernetes Jobs running the test in parallel, see Distribute.
+type DistributeOpt struct {
+	Name      string `toml:"name"`       // prefix of names of all resources, "optimizer-tester" if empty
+	Namespace string `toml:"namespace"`  // "default" if empty
+	Image     string `toml:"image"`      // image with the binary of the tester
+	Binary    string `toml:"binary"`     // path of the binary in the image, "optimizer-tester" if empty
+	Volume    string `toml:"volume"`     // persistent volume claim shared by all Jobs to keep reports, which must be ReadWriteMany
+	ReportDir string `toml:"report-dir"` // mount path of the volume in containers, "/report" if empty
+}
+
+// k8sNamePattern matches valid names of Kubernetes resources.
+var k8sNamePattern = regexp.MustCompile(`^[a-z0-9]([-a-z0-9]*[a-z0-9])?$`)
+
+func (do DistributeOpt) check() error {
+	if do.Image == "" || do.Volume == "" {
+		return errors.Errorf("distribute requires image and volume")
+	}
+	if !k8sNamePattern.MatchString(do.name()) || !k8sNamePattern.MatchString(do.namespace()) {
+		return errors.Errorf("invalid distribute name=%v or namespace=%v, which should be lowercase letters, digits and '-'", do.Name, do.Namespace)
+	}
+	return nil
+}
+
+func (do DistributeOpt) name() string {
+	if do.Name != "" {
+		return do.Name
+	}
+	return "optimizer-tester"
+}
+
+func (do DistributeOpt) namespace() string {
+	if do.Namespace != "" {
+		return do.Namespace
+	}
+	return "default"
+}
+
+func (do DistributeOpt) binary() string {
+	if do.Binary != "" {
+		return do.Binary
+	}
+	return "optimizer-tester"
+}
+
+func (do DistributeOpt) reportDir() string {
+	if do.ReportDir != "" {
+		return do.ReportDir
+	}
+	return "/report"
+}
+
+// shardReportDir returns the report directory of the shard running the instance insIdx.
+func shardReportDir(reportDir string, insIdx int) string {
+	return path.Join(reportDir, fmt.Sprintf("shard-%v", insIdx))
+}
+
+// Distribute splits the test of these configs into shards and writes Kubernetes manifests running them into outDir.
+// Each shard runs the whole matrix on one instance, since runs of the matrix on the same instance set different
+// global variables and can't be parallel. jobs.yaml has a Secret of configs, which hold passwords and tokens, and a Job
+// of each shard, and merge-job.yaml has a Job generating reports of all shards by merge-shards after all shards
+// complete. Shards don't send emails, file issues or record history, which are done by the merge Job for all shards.
+func Distribute(confPaths []string, outDir string) error {
+	opt, err := DecodeOptionFiles(confPaths)
+	if err != nil {
+		return err
+	}
+	do := opt.Distribute
+	if err := do.check(); err != nil {
+		return err
+	}
+	if len(opt.Instances) == 0 {
+		return errors.Errorf("no instance to distribute")
+	}
+	contents := make([]string, 0, len(confPaths))
+	for _, p := range confPaths {
+		content, err := ioutil.ReadFile(p)
+		if err != nil {
+			return errors.Trace(err)
+		}
+		contents = append(contents, string(content))
+	}
+	config := contents[0]
+	if len(contents) > 1 {
+		if config, err = mergeConfigs(contents[0], contents[1:]...); err != nil {
+			return err
+		}
+	}
+
+	formats := []string{"bin"}
+	for _, f := range opt.ExportFormats {
+		if !strings.EqualFold(f, "bin") {
+			formats = append(formats, f)
+		}
+	}
+	files := map[string]string{"cetest.toml": config}
+	files["merge.toml"] = fmt.Sprintf("report-dir = %q\n", do.reportDir())
+	for insIdx, ins := range opt.Instances {
+		var buf bytes.Buffer
+		overlay := map[string]interface{}{
+			"report-dir":     shardReportDir(do.reportDir(), insIdx),
+			"export-formats": formats,
+			"instances":      []tidb.Option{ins},
+			// delivered by the merge job with results of all shards
+			"email":   map[string]interface{}{"addr": ""},
+			"issues":  map[string]interface{}{"min-p-error": 0.0},
+			"history": map[string]interface{}{"dir": ""},
+		}
+		if err := toml.NewEncoder(&buf).Encode(overlay); err != nil {
+			return errors.Trace(err)
+		}
+		files[fmt.Sprintf("shard-%v.toml", insIdx)] = buf.String()
+	}
+
+	var jobs bytes.Buffer
+	writeConfigSecret(&jobs, do, files)
+	for insIdx := range opt.Instances {
+		jobs.WriteString("---\n")
+		writeJob(&jobs, do, fmt.Sprintf("%v-shard-%v", do.name(), insIdx), fmt.Sprint(insIdx),
+			"cetest", "--config", "/config/cetest.toml", "--config", fmt.Sprintf("/config/shard-%v.toml", insIdx))
+	}
+	var merge bytes.Buffer
+	writeJob(&merge, do, do.name()+"-merge", "merge", "merge-shards", "--config", "/config/cetest.toml", "--config", "/config/merge.toml")
+
+	if err := os.MkdirAll(outDir, 0755); err != nil {
+		return errors.Trace(err)
+	}
+	if err := ioutil.WriteFile(path.Join(outDir, "jobs.yaml"), jobs.Bytes(), 0666); err != nil {
+		return errors.Trace(err)
+	}
+	if err := ioutil.WriteFile(path.Join(outDir, "merge-job.yaml"), merge.Bytes(), 0666); err != nil {
+		return errors.Trace(err)
+	}
+	fmt.Printf("[Distribute] %v shards are written into %v, run them by:\n", len(opt.Instances), outDir)
+	fmt.Printf("  kubectl apply -f %v\n", path.Join(outDir, "jobs.yaml"))
+	fmt.Printf("  kubectl wait -n %v --for=condition=complete --timeout=-1s job -l optimizer-tester/run=%v,optimizer-tester/shard\n", do.namespace(), do.name())
+	fmt.Printf("  kubectl apply -f %v\n", path.Join(outDir, "merge-job.yaml"))
+	return nil
+}
+
+// writeConfigSecret writes configs into a Secret instead of a ConfigMap, since they hold passwords of instances and
+// emails and tokens of issues.
+func writeConfigSecret(buf *bytes.Buffer, do DistributeOpt, files map[string]string) {
+	buf.WriteString("apiVersion: v1\nkind: Secret\ntype: Opaque\nmetadata:\n")
+	buf.WriteString(fmt.Sprintf("  name: %v-config\n  namespace: %v\n", do.name(), do.namespace()))
+	buf.WriteString(fmt.Sprintf("  labels:\n    optimizer-tester/run: %v\nstringData:\n", do.name()))
+	for _, name := range sortedKeys(files) {
+		buf.WriteString(fmt.Sprintf("  %v: |\n", name))
+		for _, line := range strings.Split(strings.TrimRight(files[name], "\n"), "\n") {
+			if line == "" {
+				buf.WriteString("\n")
+			} else {
+				buf.WriteString("    " + line + "\n")
+			}
+		}
+	}
+}
+
+// writeJob writes a Job running the binary with these arguments, which is labeled by the index of its shard unless
+// shard is "merge".
+func writeJob(buf *bytes.Buffer, do DistributeOpt, name, shard string, args ...string) {
+	quoted := make([]string, len(args))
+	for i, a := range args {
+		quoted[i] = fmt.Sprintf("%q", a)
+	}
+	shardLabel := fmt.Sprintf("    optimizer-tester/shard: %q\n", shard)
+	if shard == "merge" {
+		shardLabel = ""
+	}
+	buf.WriteString("apiVersion: batch/v1\nkind: Job\nmetadata:\n")
+	buf.WriteString(fmt.Sprintf("  name: %v\n  namespace: %v\n", name, do.namespace()))
+	buf.WriteString(fmt.Sprintf("  labels:\n    optimizer-tester/run: %v\n%v", do.name(), shardLabel))
+	buf.WriteString("spec:\n  backoffLimit: 0\n  template:\n    spec:\n      restartPolicy: Never\n      containers:\n")
+	buf.WriteString(fmt.Sprintf("      - name: optimizer-tester\n        image: %v\n", do.Image))
+	buf.WriteString(fmt.Sprintf("        command: [%q]\n        args: [%v]\n", do.binary(), strings.Join(quoted, ", ")))
+	buf.WriteString("        volumeMounts:\n        - name: config\n          mountPath: /config\n")
+	buf.WriteString(fmt.Sprintf("        - name: report\n          mountPath: %v\n", do.reportDir()))
+	buf.WriteString(fmt.Sprintf("      volumes:\n      - name: config\n        secret:\n          secretName: %v-config\n          defaultMode: 0400\n", do.name()))
+	buf.WriteString(fmt.Sprintf("      - name: report\n        persistentVolumeClaim:\n          claimName: %v\n", do.Volume))
+}
+
+func sortedKeys(m map[string]string) []string {
+	keys := make([]string, 0, len(m))
+	for k := range m {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	return keys
+}
+
+// MergeShards merges raw results of all shards run by Jobs of Distribute, which are in sub-directories of ReportDir,
+// and generates reports of all runs of the matrix from them into ReportDir like a single run. Only fields of raw
+// results are merged, so sections requiring plans or runtime statistics are empty. Issues, history and emails, which
+// are disabled in shards, are filed, recorded and sent for the merged results of each run.
+func MergeShards(opt Option) error {
+	runs := []matrixRun{{}}
+	if len(opt.Matrix) > 0 {
+		runs = expandMatrix(opt.Matrix)
+	}
+	for _, r := range runs {
+		collector := NewEstResultCollector(len(opt.Instances), len(opt.Datasets), len(opt.QueryTypes))
+		for insIdx, ins := range opt.Instances {
+			p := path.Join(shardReportDir(opt.ReportDir, insIdx), r.key, "results.bin")
+			rs, err := ReadRawResults(p)
+			if err != nil {
+				return fmt.Errorf("merge the shard of %v, err=%v", ins.Label, err)
+			}
+			for _, rr := range rs {
+				dsIdx, qtIdx := opt.datasetIdx(rr.Dataset), opt.queryTypeIdx(rr.QueryType)
+				if rr.Instance != ins.Label || dsIdx == -1 || qtIdx == -1 {
+					continue
+				}
+				collector.AddEstResult(insIdx, dsIdx, qtIdx, EstResult{
+					SQL:            rr.SQL,
+					EstCard:        rr.EstCard,
+					TrueCard:       rr.TrueCard,
+					PlanLatency:    time.Duration(rr.PlanMS * float64(time.Millisecond)),
+					TableRows:      rr.TableRows,
+					Labels:         parseLabelText(rr.Labels),
+					PlanDigest:     rr.PlanDigest,
+					StmtDigest:     rr.StmtDigest,
+					StmtPlanDigest: rr.StmtPlanDigest,
+					ExplainRef:     rr.ExplainRef,
+				})
+			}
+		}
+		runOpt := opt
+		runOpt.Matrix = nil
+		runOpt.ReportDir = path.Join(opt.ReportDir, r.key)
+		if err := GenReports(runOpt, collector); err != nil {
+			return err
+		}
+		if err := ExportRawResults(runOpt, collector); err != nil {
+			return err
+		}
+		if err := deliverMerged(runOpt, collector); err != nil {
+			return err
+		}
+		fmt.Printf("[Merge] merged %v shards into %v\n", len(opt.Instances), runOpt.ReportDir)
+	}
+	if len(opt.Matrix) > 0 {
+		return writeMatrixIndex(opt.ReportDir, runs)
+	}
+	return nil
+}
+
+// deliverMerged files issues, records history and sends the report of merged results of a run like RunCETest does.
+// Instances are only connected to draft issues, which need their schemas and versions.
+func deliverMerged(opt Option, collector EstResultCollector) error {
+	if opt.Issues.MinPError > 0 {
+		instances, err := tidb.ConnectToInstances(opt.Instances)
+		if err != nil {
+			return errors.Trace(err)
+		}
+		err = fileIssues(opt, instances, collector)
+		for _, ins := range instances {
+			ins.Close()
+		}
+		if err != nil {
+			return err
+		}
+	}
+	if err := RecordRunHistory(opt, collector, time.Now()); err != nil {
+		return err
+	}
+	if err := GenTrendReport(opt); err != nil {
+		return err
+	}
+	return SendReport(opt)
+}
+
+// parseLabelText parses labels in the format of EstResult.LabelText.
+func parseLabelText(text string) map[string]string {
+	if text == "" {
+		return nil
+	}
+	labels := make(map[string]string)
+	for _, kv := range strings.Split(text, ";") {
+		if i := strings.Index(kv, "="); i != -1 {
+			labels[kv[:i]] = kv[i+1:]
+		}
+	}
+	return labels
+}
@@ -4,53 +4,181 @@ import (
 	"bytes"
 	"fmt"
 	"io/ioutil"
+	"math"
 	"os"
 	"path"
 	"sort"
+	"strings"
+	"time"
 
 	"github.com/pingcap/errors"
 	"gonum.org/v1/plot"
 	"gonum.org/v1/plot/plotter"
-	"gonum.org/v1/plot/plotutil"
 	"gonum.org/v1/plot/vg"
 )
 
 // GenPErrorBarChartsReport ...
 func GenPErrorBarChartsReport(opt Option, collector EstResultCollector) error {
+	if err := os.MkdirAll(opt.ReportDir, 0755); err != nil {
+		return errors.Trace(err)
+	}
+	opt, collector = opt.orderedForReport(collector)
+	if err := GenCellPages(opt, collector); err != nil {
+		return err
+	}
+	data := ReportData{Instances: reportInstances(opt), Sections: make(map[string]string)}
+	for _, qt := range opt.QueryTypes {
+		data.QueryTypes = append(data.QueryTypes, qt.String())
+	}
+	for _, ds := range opt.Datasets {
+		data.Datasets = append(data.Datasets, ds.Label)
+	}
+	var instances, configDiff, statsChanges, writeLoad, failures, lint, executionSkew, coverage, columnErrors, provenance bytes.Buffer
+	writeInstances(&instances, data.Instances)
+	data.Sections["instances"] = instances.String()
+	if err := writeConfigDiff(&configDiff, opt); err != nil {
+		return err
+	}
+	data.Sections["config-diff"] = configDiff.String()
+	writeStatsChanges(&statsChanges, opt)
+	data.Sections["stats-changes"] = statsChanges.String()
+	writeWriteLoad(&writeLoad, opt)
+	data.Sections["write-load"] = writeLoad.String()
+	writeFailures(&failures, opt)
+	data.Sections["failures"] = failures.String()
+	writeLint(&lint, opt)
+	data.Sections["lint"] = lint.String()
+	writeExecutionSkew(&executionSkew, opt)
+	data.Sections["execution-skew"] = executionSkew.String()
+	writeCoverage(&coverage, opt, collector)
+	data.Sections["coverage"] = coverage.String()
+	writeColumnErrors(&columnErrors, opt, collector)
+	data.Sections["column-errors"] = columnErrors.String()
+	if err := writeProvenance(&provenance, opt, collector); err != nil {
+		return err
+	}
+	data.Sections["provenance"] = provenance.String()
+
 	md := bytes.Buffer{}
+	if err := executeReportTemplate(&md, opt.ReportTemplates.header, data, data.Sections["instances"]+data.Sections["config-diff"]+data.Sections["stats-changes"]+data.Sections["write-load"]+data.Sections["failures"]+data.Sections["lint"]+data.Sections["execution-skew"]+data.Sections["coverage"]+data.Sections["column-errors"]+data.Sections["provenance"]); err != nil {
+		return err
+	}
 	for qtIdx, qt := range opt.QueryTypes {
 		md.WriteString(fmt.Sprintf("# %v\n", qt))
 		for dsIdx, ds := range opt.Datasets {
-			md.WriteString(fmt.Sprintf("## %v\n", ds.Label))
-			picPath, err := DrawBarChartsGroupByQTAndDS(opt, collector, qtIdx, dsIdx, PError)
+			cell, err := genReportCell(opt, collector, dsIdx, qtIdx)
 			if err != nil {
 				return err
 			}
-			md.WriteString(fmt.Sprintf("![pic](%v)\n", picPath))
-
-			md.WriteString("\nOverEstimation Statistics\n")
-			md.WriteString("\n| Instance | Total | P50 | P90 | P99 | Max |\n")
-			md.WriteString("| ---- | ---- | ---- | ---- | ---- | ---- |\n")
-			for insIdx, ins := range opt.Instances {
-				stats := analyzePError(collector.EstResults(insIdx, dsIdx, qtIdx), true)
-				md.WriteString(fmt.Sprintf("| %v | %v | %v | %v | %v | %v |\n",
-					ins.Label, stats["tot"], stats["p50"], stats["p90"], stats["p99"], stats["max"]))
+			var content strings.Builder
+			content.WriteString(fmt.Sprintf("## %v\n", ds.Label))
+			for _, s := range reportSections {
+				content.WriteString(cell.Sections[s])
 			}
-
-			md.WriteString("\nUnderEstimation Statistics\n")
-			md.WriteString("\n| Instance | Total | P50 | P90 | P99 | Max |\n")
-			md.WriteString("| ---- | ---- | ---- | ---- | ---- | ---- |\n")
-			for insIdx, ins := range opt.Instances {
-				stats := analyzePError(collector.EstResults(insIdx, dsIdx, qtIdx), false)
-				md.WriteString(fmt.Sprintf("| %v | %v | %v | %v | %v | %v |\n",
-					ins.Label, stats["tot"], stats["p50"], stats["p90"], stats["p99"], stats["max"]))
+			content.WriteString("\n")
+			if err := executeReportTemplate(&md, opt.ReportTemplates.cell, cell, content.String()); err != nil {
+				return err
 			}
-			md.WriteString("\n")
 		}
 	}
+	if err := executeReportTemplate(&md, opt.ReportTemplates.footer, data, ""); err != nil {
+		return err
+	}
 	return ioutil.WriteFile(path.Join(opt.ReportDir, "report.md"), md.Bytes(), 0666)
 }
 
+// genReportCell draws the chart and generates all default sections of this cell.
+func genReportCell(opt Option, collector EstResultCollector, dsIdx, qtIdx int) (ReportCell, error) {
+	qt := opt.QueryTypes[qtIdx]
+	cell := ReportCell{QueryType: qt.String(), Dataset: opt.Datasets[dsIdx].Label, Sections: make(map[string]string, len(reportSections))}
+	section := func(name string, write func(md *bytes.Buffer)) {
+		var md bytes.Buffer
+		write(&md)
+		cell.Sections[name] = md.String()
+	}
+
+	section("skipped", func(md *bytes.Buffer) {
+		for insIdx, ins := range opt.Instances {
+			if opt.unsupported(insIdx, qt) {
+				md.WriteString(fmt.Sprintf("\n> Skipped on %v (%v), which requires %v.\n\n", ins.Label, opt.insVersions[insIdx], opt.minVersion(qt)))
+			}
+		}
+	})
+	picPath, err := DrawBarChartsGroupByQTAndDS(opt, collector, qtIdx, dsIdx, PError)
+	if err != nil {
+		return cell, err
+	}
+	cell.Chart = picPath
+	section("chart", func(md *bytes.Buffer) {
+		md.WriteString(fmt.Sprintf("![pic](%v)\n", picPath))
+		writeCellLinks(md, opt, dsIdx, qtIdx)
+	})
+
+	for insIdx, ins := range opt.Instances {
+		rs := collector.EstResults(insIdx, dsIdx, qtIdx)
+		cell.Instances = append(cell.Instances, ReportCellInstance{
+			Instance: ins.Label,
+			Page:     cellPage(opt, insIdx, dsIdx, qtIdx),
+			Over:     analyzePError(rs, true),
+			Under:    analyzePError(rs, false),
+		})
+	}
+	section("over-estimation", func(md *bytes.Buffer) {
+		md.WriteString("\nOverEstimation Statistics\n")
+		md.WriteString("\n| Instance | Total | P50 | P90 | P99 | Max |\n")
+		md.WriteString("| ---- | ---- | ---- | ---- | ---- | ---- |\n")
+		for _, ci := range cell.Instances {
+			stats := ci.Over
+			md.WriteString(fmt.Sprintf("| %v | %v | %v | %v | %v | %v |\n",
+				ci.Instance, stats["tot"], stats["p50"], stats["p90"], stats["p99"], stats["max"]))
+		}
+	})
+	section("under-estimation", func(md *bytes.Buffer) {
+		md.WriteString("\nUnderEstimation Statistics\n")
+		md.WriteString("\n| Instance | Total | P50 | P90 | P99 | Max |\n")
+		md.WriteString("| ---- | ---- | ---- | ---- | ---- | ---- |\n")
+		for _, ci := range cell.Instances {
+			stats := ci.Under
+			md.WriteString(fmt.Sprintf("| %v | %v | %v | %v | %v | %v |\n",
+				ci.Instance, stats["tot"], stats["p50"], stats["p90"], stats["p99"], stats["max"]))
+		}
+	})
+	section("selectivity", func(md *bytes.Buffer) { writePErrorBySelectivity(md, opt, collector, dsIdx, qtIdx) })
+	section("selectivity-error", func(md *bytes.Buffer) { writeSelectivityErrors(md, opt, collector, dsIdx, qtIdx) })
+	section("default-selectivity", func(md *bytes.Buffer) { writeDefaultSelectivities(md, opt, collector, dsIdx, qtIdx) })
+	section("tag", func(md *bytes.Buffer) { writePErrorByTag(md, opt, collector, dsIdx, qtIdx) })
+	section("label", func(md *bytes.Buffer) { writePErrorByLabel(md, opt, collector, dsIdx, qtIdx) })
+	if opt.CollectPlanLatency {
+		if cell.Latency, err = DrawErrorLatencyChart(opt, collector, qtIdx, dsIdx); err != nil {
+			return cell, err
+		}
+	}
+	section("plan-latency", func(md *bytes.Buffer) {
+		if opt.CollectPlanLatency {
+			writePlanLatency(md, opt, collector, dsIdx, qtIdx)
+			if cell.Latency != "" {
+				md.WriteString(fmt.Sprintf("\n![latency](%v)\n", cell.Latency))
+			}
+		}
+	})
+	section("resource-usage", func(md *bytes.Buffer) { writeResourceUsage(md, opt, collector, dsIdx, qtIdx) })
+	section("plan-shapes", func(md *bytes.Buffer) { writePlanShapes(md, opt, collector, dsIdx, qtIdx) })
+	section("statements-summary", func(md *bytes.Buffer) { writeStmtSummary(md, opt, collector, dsIdx, qtIdx) })
+	section("point-get", func(md *bytes.Buffer) { writePointGetPlans(md, opt, collector, dsIdx, qtIdx) })
+	section("mpp-joins", func(md *bytes.Buffer) { writeMPPJoins(md, opt, collector, dsIdx, qtIdx) })
+	section("index-lookup", func(md *bytes.Buffer) { writeIndexLookUps(md, opt, collector, dsIdx, qtIdx) })
+	section("risk", func(md *bytes.Buffer) { writePlanRisks(md, opt, collector, dsIdx, qtIdx) })
+	section("what-if", func(md *bytes.Buffer) { writeWhatIfIndexes(md, opt, collector, dsIdx, qtIdx) })
+	section("remediation", func(md *bytes.Buffer) { writeRemediations(md, opt, collector, dsIdx, qtIdx) })
+	section("exec-time", func(md *bytes.Buffer) { writeExecTimeComparison(md, opt, collector, dsIdx, qtIdx) })
+	section("join-order", func(md *bytes.Buffer) { writeJoinOrderScores(md, opt, collector, dsIdx, qtIdx) })
+	section("trace-steps", func(md *bytes.Buffer) { writeTraceSteps(md, opt, collector, dsIdx, qtIdx) })
+	section("topn-check", func(md *bytes.Buffer) { writeTopNCheck(md, opt, collector, dsIdx, qtIdx) })
+	section("unstable-estimates", func(md *bytes.Buffer) { writeUnstableEstimates(md, opt, collector, dsIdx, qtIdx) })
+	section("write-load", func(md *bytes.Buffer) { writeChurnAccuracy(md, opt, collector, dsIdx, qtIdx) })
+	return cell, nil
+}
+
 func analyzePError(results []EstResult, isOverEst bool) map[string]string {
 	pes := make([]float64, 0, len(results))
 	for i := range results {
@@ -86,8 +214,273 @@ func analyzePError(results []EstResult, isOverEst bool) map[string]string {
 	}
 }
 
+// selectivityBuckets are upper bounds of buckets used to group results by their selectivities.
+var selectivityBuckets = []float64{1e-6, 1e-5, 1e-4, 1e-3, 1e-2, 1e-1, 1}
+
+// writePErrorBySelectivity writes a table of absolute PErrors grouped by selectivities of results,
+// it's skipped if no result in this cell has a selectivity.
+func writePErrorBySelectivity(md *bytes.Buffer, opt Option, collector EstResultCollector, dsIdx, qtIdx int) {
+	groups := make([][][]EstResult, len(opt.Instances)) // insIdx, bucketIdx, results
+	hasSelectivity := false
+	for insIdx := range opt.Instances {
+		groups[insIdx] = make([][]EstResult, len(selectivityBuckets))
+		for _, r := range collector.EstResults(insIdx, dsIdx, qtIdx) {
+			if r.Selectivity <= 0 {
+				continue
+			}
+			hasSelectivity = true
+			b := sort.SearchFloat64s(selectivityBuckets, r.Selectivity)
+			if b == len(selectivityBuckets) {
+				b--
+			}
+			groups[insIdx][b] = append(groups[insIdx][b], r)
+		}
+	}
+	if !hasSelectivity {
+		return
+	}
+
+	md.WriteString("\nAbsolute PError by Selectivity\n")
+	md.WriteString("\n| Selectivity | Instance | Total | P50 | P90 | Max |\n")
+	md.WriteString("| ---- | ---- | ---- | ---- | ---- | ---- |\n")
+	for b, upper := range selectivityBuckets {
+		lower := "0"
+		if b > 0 {
+			lower = opt.NumberFormat.ratio(selectivityBuckets[b-1])
+		}
+		for insIdx, ins := range opt.Instances {
+			rs := groups[insIdx][b]
+			if len(rs) == 0 {
+				continue
+			}
+			pes := make([]float64, len(rs))
+			for i := range rs {
+				pes[i] = math.Abs(PError(rs[i]))
+			}
+			sort.Float64s(pes)
+			n := len(pes)
+			md.WriteString(fmt.Sprintf("| (%v, %v] | %v | %v | %.3f | %.3f | %.3f |\n",
+				lower, opt.NumberFormat.ratio(upper), ins.Label, n, pes[n/2], pes[(n*9)/10], pes[n-1]))
+		}
+	}
+}
+
+// writePErrorByTag writes a table of absolute PErrors grouped by tags of cases in this cell.
+func writePErrorByTag(md *bytes.Buffer, opt Option, collector EstResultCollector, dsIdx, qtIdx int) {
+	var tags []string
+	groups := make([]map[string][]EstResult, len(opt.Instances)) // insIdx, tag, results
+	for insIdx := range opt.Instances {
+		groups[insIdx] = make(map[string][]EstResult)
+		for _, r := range collector.EstResults(insIdx, dsIdx, qtIdx) {
+			for _, tag := range r.Tags {
+				if !containsStr(tags, tag) {
+					tags = append(tags, tag)
+				}
+				groups[insIdx][tag] = append(groups[insIdx][tag], r)
+			}
+		}
+	}
+	if len(tags) == 0 {
+		return
+	}
+	sort.Strings(tags)
+
+	md.WriteString("\nAbsolute PError by Tag\n")
+	md.WriteString("\n| Tag | Instance | Total | P50 | P90 | Max |\n")
+	md.WriteString("| ---- | ---- | ---- | ---- | ---- | ---- |\n")
+	for _, tag := range tags {
+		for insIdx, ins := range opt.Instances {
+			rs := groups[insIdx][tag]
+			if len(rs) == 0 {
+				continue
+			}
+			pes := make([]float64, len(rs))
+			for i := range rs {
+				pes[i] = math.Abs(PError(rs[i]))
+			}
+			sort.Float64s(pes)
+			n := len(pes)
+			md.WriteString(fmt.Sprintf("| %v | %v | %v | %.3f | %.3f | %.3f |\n",
+				tag, ins.Label, n, pes[n/2], pes[(n*9)/10], pes[n-1]))
+		}
+	}
+}
+
+// writePErrorByLabel writes absolute PErrors of results keyed by their labels, like results of all runs of the
+// matrix, and grouped by values of each dimension of their labels.
+func writePErrorByLabel(md *bytes.Buffer, opt Option, collector EstResultCollector, dsIdx, qtIdx int) {
+	var all []EstResult
+	for insIdx := range opt.Instances {
+		all = append(all, collector.EstResults(insIdx, dsIdx, qtIdx)...)
+	}
+	if sets := collector.LabelSets(); len(sets) > 1 {
+		md.WriteString("\nAbsolute PError by labels\n")
+		md.WriteString("\n| Labels | Instance | Total | P50 | P90 | Max |\n")
+		md.WriteString("| ---- | ---- | ---- | ---- | ---- | ---- |\n")
+		for _, labels := range sets {
+			for insIdx, ins := range opt.Instances {
+				rs := collector.LabeledEstResults(labels, insIdx, dsIdx, qtIdx)
+				if len(rs) == 0 {
+					continue
+				}
+				pes := make([]float64, len(rs))
+				for i := range rs {
+					pes[i] = math.Abs(PError(rs[i]))
+				}
+				sort.Float64s(pes)
+				n := len(pes)
+				cell := labels
+				if cell == "" {
+					cell = "-" // results without labels
+				}
+				md.WriteString(fmt.Sprintf("| %v | %v | %v | %.3f | %.3f | %.3f |\n",
+					markdownCell(cell), ins.Label, n, pes[n/2], pes[(n*9)/10], pes[n-1]))
+			}
+		}
+	}
+	for _, dim := range LabelDims(all) {
+		md.WriteString(fmt.Sprintf("\nAbsolute PError by %v\n", dim))
+		md.WriteString(fmt.Sprintf("\n| %v | Instance | Total | P50 | P90 | Max |\n", dim))
+		md.WriteString("| ---- | ---- | ---- | ---- | ---- | ---- |\n")
+		for insIdx, ins := range opt.Instances {
+			vals, groups := GroupByLabel(collector.EstResults(insIdx, dsIdx, qtIdx), dim)
+			for _, v := range vals {
+				rs := groups[v]
+				pes := make([]float64, len(rs))
+				for i := range rs {
+					pes[i] = math.Abs(PError(rs[i]))
+				}
+				sort.Float64s(pes)
+				n := len(pes)
+				md.WriteString(fmt.Sprintf("| %v | %v | %v | %.3f | %.3f | %.3f |\n",
+					v, ins.Label, n, pes[n/2], pes[(n*9)/10], pes[n-1]))
+			}
+		}
+	}
+}
+
+func containsStr(strs []string, s string) bool {
+	for _, str := range strs {
+		if str == s {
+			return true
+		}
+	}
+	return false
+}
+
+// writeResourceUsage writes a table of memory and disk usages of cases executed by EXPLAIN ANALYZE in this cell.
+func writeResourceUsage(md *bytes.Buffer, opt Option, collector EstResultCollector, dsIdx, qtIdx int) {
+	header := false
+	for insIdx, ins := range opt.Instances {
+		var n int
+		var maxMem, maxDisk, totMem int64
+		for _, r := range collector.EstResults(insIdx, dsIdx, qtIdx) {
+			if len(r.Operators) == 0 {
+				continue
+			}
+			var mem, disk int64
+			for _, op := range r.Operators {
+				if op.MemBytes > 0 {
+					mem += op.MemBytes
+				}
+				if op.DiskBytes > 0 {
+					disk += op.DiskBytes
+				}
+			}
+			n++
+			totMem += mem
+			if mem > maxMem {
+				maxMem = mem
+			}
+			if disk > maxDisk {
+				maxDisk = disk
+			}
+		}
+		if n == 0 {
+			continue
+		}
+		if !header {
+			md.WriteString("\nResource Usage of Executed Cases\n")
+			md.WriteString("\n| Instance | Total | Avg Memory | Max Memory | Max Disk |\n")
+			md.WriteString("| ---- | ---- | ---- | ---- | ---- |\n")
+			header = true
+		}
+		md.WriteString(fmt.Sprintf("| %v | %v | %v | %v | %v |\n", ins.Label, n,
+			opt.NumberFormat.rows(float64(totMem/int64(n))), opt.NumberFormat.rows(float64(maxMem)), opt.NumberFormat.rows(float64(maxDisk))))
+	}
+}
+
+// maxPlanShapes is the max number of plan shapes of each instance shown in reports.
+const maxPlanShapes = 5
+
+// writePlanShapes writes a table of the most common plan shapes of each instance in this cell.
+func writePlanShapes(md *bytes.Buffer, opt Option, collector EstResultCollector, dsIdx, qtIdx int) {
+	header := false
+	for insIdx, ins := range opt.Instances {
+		cnt := make(map[string]int)
+		total := 0
+		for _, r := range collector.EstResults(insIdx, dsIdx, qtIdx) {
+			if r.PlanFingerprint != "" {
+				cnt[r.PlanFingerprint]++
+				total++
+			}
+		}
+		if total == 0 {
+			continue
+		}
+		shapes := make([]string, 0, len(cnt))
+		for s := range cnt {
+			shapes = append(shapes, s)
+		}
+		sort.Slice(shapes, func(i, j int) bool {
+			if cnt[shapes[i]] != cnt[shapes[j]] {
+				return cnt[shapes[i]] > cnt[shapes[j]]
+			}
+			return shapes[i] < shapes[j]
+		})
+		if !header {
+			md.WriteString("\nPlan Shapes\n")
+			md.WriteString("\n| Instance | Distinct Shapes | Plan Shape | Count | Ratio |\n")
+			md.WriteString("| ---- | ---- | ---- | ---- | ---- |\n")
+			header = true
+		}
+		for i, s := range shapes {
+			if i >= maxPlanShapes {
+				break
+			}
+			md.WriteString(fmt.Sprintf("| %v | %v | `%v` | %v | %.2f%% |\n", ins.Label, len(shapes), s, cnt[s], float64(cnt[s])*100/float64(total)))
+		}
+	}
+}
+
+// writePlanLatency writes a table of latencies of the optimizer in this cell.
+func writePlanLatency(md *bytes.Buffer, opt Option, collector EstResultCollector, dsIdx, qtIdx int) {
+	md.WriteString("\nPlan Latency Statistics\n")
+	md.WriteString("\n| Instance | Total | P50 | P90 | P99 | Max |\n")
+	md.WriteString("| ---- | ---- | ---- | ---- | ---- | ---- |\n")
+	for insIdx, ins := range opt.Instances {
+		var lats []time.Duration
+		for _, r := range collector.EstResults(insIdx, dsIdx, qtIdx) {
+			if r.PlanLatency > 0 {
+				lats = append(lats, r.PlanLatency)
+			}
+		}
+		n := len(lats)
+		if n == 0 {
+			md.WriteString(fmt.Sprintf("| %v | 0 | - | - | - | - |\n", ins.Label))
+			continue
+		}
+		sort.Slice(lats, func(i, j int) bool { return lats[i] < lats[j] })
+		md.WriteString(fmt.Sprintf("| %v | %v | %v | %v | %v | %v |\n",
+			ins.Label, n, lats[n/2], lats[(n*9)/10], lats[(n*99)/100], lats[n-1]))
+	}
+}
+
 // GenQErrorBoxPlotReport generates a report with MarkDown format.
 func GenQErrorBoxPlotReport(opt Option, collector EstResultCollector) error {
+	if err := os.MkdirAll(opt.ReportDir, 0755); err != nil {
+		return errors.Trace(err)
+	}
 	mdContent := bytes.Buffer{}
 	for qtIdx, qt := range opt.QueryTypes {
 		mdContent.WriteString(fmt.Sprintf("## %v q-error report:\n", qt))
@@ -128,6 +521,56 @@ func analyzeQError(results []EstResult) map[string]float64 {
 	}
 }
 
+// reportInstances returns versions and metadata of all instances.
+func reportInstances(opt Option) []ReportInstance {
+	ris := make([]ReportInstance, 0, len(opt.Instances))
+	for insIdx, ins := range opt.Instances {
+		ver := "-" // imported engines have no versions
+		if insIdx < len(opt.insVersions) {
+			ver = opt.insVersions[insIdx]
+		}
+		ri := ReportInstance{Label: ins.Label, Version: ver, Metadata: ins.MetadataText()}
+		if s, ok := opt.latency.get(ins.Label); ok {
+			ri.RTT = &s
+		}
+		ris = append(ris, ri)
+	}
+	return ris
+}
+
+// writeInstances writes versions and metadata of all instances, so reports can be understood long after the run.
+// RTT and concurrency of instances are also written if they're measured by the latency-aware mode.
+func writeInstances(md *bytes.Buffer, instances []ReportInstance) {
+	measured := false
+	for _, ins := range instances {
+		measured = measured || ins.RTT != nil
+	}
+	md.WriteString("# Instances\n")
+	if measured {
+		md.WriteString("\n| Instance | Version | Metadata | RTT P50 | RTT P90 | Concurrency |\n")
+		md.WriteString("| ---- | ---- | ---- | ---- | ---- | ---- |\n")
+	} else {
+		md.WriteString("\n| Instance | Version | Metadata |\n")
+		md.WriteString("| ---- | ---- | ---- |\n")
+	}
+	for _, ins := range instances {
+		meta := ins.Metadata
+		if meta == "" {
+			meta = "-"
+		}
+		md.WriteString(fmt.Sprintf("| %v | %v | %v |", ins.Label, ins.Version, meta))
+		switch {
+		case !measured:
+		case ins.RTT == nil:
+			md.WriteString(" - | - | - |")
+		default:
+			md.WriteString(fmt.Sprintf(" %.2fms | %.2fms | %v |", ins.RTT.P50MS, ins.RTT.P90MS, ins.RTT.Concurrency))
+		}
+		md.WriteString("\n")
+	}
+	md.WriteString("\n")
+}
+
 // DrawBarChartsGroupByQTAndDS ...
 func DrawBarChartsGroupByQTAndDS(opt Option, collector EstResultCollector, qtIdx, dsIdx int, calFunc func(EstResult) float64) (string, error) {
 	p, err := plot.New()
@@ -140,6 +583,7 @@ func DrawBarChartsGroupByQTAndDS(opt Option, collector EstResultCollector, qtIdx
 
 	var w float64 = 20
 	boundaries := adaptiveBoundaries(opt, collector, qtIdx, dsIdx, calFunc)
+	colors := instanceColors(opt.instanceLabels())
 	for insIdx, ins := range opt.Instances {
 		rs := collector.EstResults(insIdx, dsIdx, qtIdx)
 		freqs := distribution(rs, boundaries, calFunc)
@@ -147,10 +591,10 @@ func DrawBarChartsGroupByQTAndDS(opt Option, collector EstResultCollector, qtIdx
 		if err != nil {
 			return "", errors.Trace(err)
 		}
-		bar.Color = plotutil.Color(insIdx)
+		bar.Color = colors[insIdx]
 		bar.Offset = vg.Points(float64(insIdx-(len(opt.Instances)/2)) * w)
 		p.Add(bar)
-		p.Legend.Add(ins.Label, bar)
+		p.Legend.Add(ins.Legend(), bar)
 	}
 	p.Legend.Top = true
 	xNames := make([]string, 0, len(boundaries)-1)
@@ -168,9 +612,12 @@ func DrawBarChartsGroupByQTAndDS(opt Option, collector EstResultCollector, qtIdx
 		prefixDir = path.Join(absPrefix, prefixDir)
 	}
 
-	pngName := fmt.Sprintf("%v-%v-bar.png", opt.QueryTypes[qtIdx], opt.Datasets[dsIdx].Label)
-	pngPath := path.Join(prefixDir, pngName)
-	return pngName, p.Save(vg.Points(w+(w+5)*float64(len(boundaries)*len(opt.Instances))), 3*vg.Inch, pngPath)
+	name := fmt.Sprintf("%v-%v-bar", opt.QueryTypes[qtIdx], opt.Datasets[dsIdx].Label)
+	chartPath, err := saveChart(opt.Charts, p, vg.Points(w+(w+5)*float64(len(boundaries)*len(opt.Instances))), 3*vg.Inch, path.Join(prefixDir, name))
+	if err != nil {
+		return "", err
+	}
+	return path.Base(chartPath), nil
 }
 
 func adaptiveBoundaries(opt Option, collector EstResultCollector, qtIdx, dsIdx int, calFunc func(EstResult) float64) []float64 {
@@ -240,6 +687,9 @@ func DrawQErrorBoxPlotGroupByQueryType(opt Option, collector EstResultCollector,
 	for dsIdx, ds := range opt.Datasets {
 		for insIdx, ins := range opt.Instances {
 			rs := collector.EstResults(insIdx, dsIdx, qtIdx)
+			if len(rs) == 0 { // box plots can't be drawn without values
+				continue
+			}
 			biases := make(plotter.ValueLabels, len(rs))
 			for i, r := range rs {
 				biases[i].Value = QError(r)
@@ -265,6 +715,5 @@ func DrawQErrorBoxPlotGroupByQueryType(opt Option, collector EstResultCollector,
 		prefixDir = path.Join(absPrefix, prefixDir)
 	}
 
-	pngPath := path.Join(prefixDir, fmt.Sprintf("%v-box-plot.png", opt.QueryTypes[qtIdx]))
-	return pngPath, errors.Trace(p.Save(vg.Length(100+80*len(opt.Datasets)*len(opt.Instances)), 200, pngPath))
+	return saveChart(opt.Charts, p, vg.Length(100+80*len(opt.Datasets)*len(opt.Instances)), 200, path.Join(prefixDir, fmt.Sprintf("%v-box-plot", opt.QueryTypes[qtIdx])))
 }
@@ -2,7 +2,11 @@ package cetest_test
 
 import (
 	"fmt"
+	"io/ioutil"
 	"math/rand"
+	"os"
+	"path"
+	"strings"
 	"testing"
 
 	"github.com/qw4990/OptimizerTester/cetest"
@@ -40,7 +44,7 @@ func randEstResultCollector(opt cetest.Option, n int) cetest.EstResultCollector
 
 func TestDrawBiasBoxPlotGroupByQueryType(t *testing.T) {
 	opt := cetest.Option{
-		QueryTypes: []cetest.QueryType{cetest.QTMultiColsPointQuery},
+		QueryTypes: []cetest.QueryType{cetest.QTMulColsPointQueryOnIndex},
 		Datasets: []cetest.DatasetOpt{
 			{Label: "zipfx"},
 			{Label: "tpcc-10G"},
@@ -61,7 +65,7 @@ func TestDrawBiasBoxPlotGroupByQueryType(t *testing.T) {
 
 func TestDrawBarChartsGroupByQTAndDS(t *testing.T) {
 	opt := cetest.Option{
-		QueryTypes: []cetest.QueryType{cetest.QTMultiColsPointQuery},
+		QueryTypes: []cetest.QueryType{cetest.QTMulColsPointQueryOnIndex},
 		Datasets: []cetest.DatasetOpt{
 			{Label: "zipfx"},
 		},
@@ -76,3 +80,42 @@ func TestDrawBarChartsGroupByQTAndDS(t *testing.T) {
 	collector := randEstResultCollector(opt, 100)
 	fmt.Println(cetest.DrawBarChartsGroupByQTAndDS(opt, collector, 0, 0, cetest.PError))
 }
+
+func TestInstanceLegend(t *testing.T) {
+	opt := tidb.Option{Label: "ver1"}
+	if l := opt.Legend(); l != "ver1" {
+		t.Fatalf("unexpected legend %v", l)
+	}
+	opt.Metadata = map[string]string{"git-sha": "abc", "cluster-size": "3"}
+	if l := opt.Legend(); l != "ver1 (cluster-size=3, git-sha=abc)" {
+		t.Fatalf("unexpected legend %v", l)
+	}
+}
+
+func TestDrawChartsInAllFormats(t *testing.T) {
+	dir, err := ioutil.TempDir("", "cetest-charts")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	opt := cetest.Option{
+		QueryTypes: []cetest.QueryType{cetest.QTMulColsPointQueryOnIndex},
+		Datasets:   []cetest.DatasetOpt{{Label: "zipfx"}},
+		Instances:  []tidb.Option{{Label: "v4.0"}},
+		ReportDir:  dir,
+		Charts:     cetest.ChartOpt{Formats: []string{"svg", "png"}, DPI: 192},
+	}
+	collector := randEstResultCollector(opt, 100)
+	name, err := cetest.DrawBarChartsGroupByQTAndDS(opt, collector, 0, 0, cetest.PError)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if path.Ext(name) != ".svg" {
+		t.Fatalf("the first format should be embedded, got %v", name)
+	}
+	for _, ext := range []string{".svg", ".png"} {
+		if _, err := os.Stat(path.Join(dir, strings.TrimSuffix(name, ".svg")+ext)); err != nil {
+			t.Fatal(err)
+		}
+	}
+}
@@ -0,0 +1,117 @@
+package cetest
+
+import (
+	"bytes"
+	"fmt"
+	"io/ioutil"
+	"math"
+	"os"
+	"path"
+	"sort"
+	"strings"
+
+	"github.com/pingcap/errors"
+)
+
+// drillDownCases is the number of the worst and the best cases shown in each drill-down page.
+const drillDownCases = 20
+
+// cellsDir is the sub-directory of ReportDir where drill-down pages are written.
+const cellsDir = "cells"
+
+// cellPage returns the path of the drill-down page of this cell relative to ReportDir.
+func cellPage(opt Option, insIdx, dsIdx, qtIdx int) string {
+	name := fmt.Sprintf("%v-%v-%v.md", opt.QueryTypes[qtIdx], opt.Datasets[dsIdx].Label, opt.Instances[insIdx].Label)
+	return path.Join(cellsDir, strings.Map(func(r rune) rune {
+		if r == '/' || r == '\\' || r == ' ' {
+			return '_'
+		}
+		return r
+	}, name))
+}
+
+// writeCellLinks writes links to drill-down pages of all instances on this dataset and query type.
+func writeCellLinks(md *bytes.Buffer, opt Option, dsIdx, qtIdx int) {
+	links := make([]string, 0, len(opt.Instances))
+	for insIdx, ins := range opt.Instances {
+		links = append(links, fmt.Sprintf("[%v](%v)", ins.Label, cellPage(opt, insIdx, dsIdx, qtIdx)))
+	}
+	md.WriteString(fmt.Sprintf("\nDetails: %v\n", strings.Join(links, " | ")))
+}
+
+// GenCellPages writes a drill-down page for each cell with its PError histogram,
+// the worst and the best cases, and plans captured for these cases.
+func GenCellPages(opt Option, collector EstResultCollector) error {
+	if err := os.MkdirAll(path.Join(opt.ReportDir, cellsDir), 0755); err != nil {
+		return errors.Trace(err)
+	}
+	for qtIdx := range opt.QueryTypes {
+		for dsIdx := range opt.Datasets {
+			boundaries := adaptiveBoundaries(opt, collector, qtIdx, dsIdx, PError)
+			for insIdx := range opt.Instances {
+				page := genCellPage(opt, collector.EstResults(insIdx, dsIdx, qtIdx), boundaries, insIdx, dsIdx, qtIdx)
+				if err := ioutil.WriteFile(path.Join(opt.ReportDir, cellPage(opt, insIdx, dsIdx, qtIdx)), page, 0666); err != nil {
+					return errors.Trace(err)
+				}
+			}
+		}
+	}
+	return nil
+}
+
+func genCellPage(opt Option, rs []EstResult, boundaries []float64, insIdx, dsIdx, qtIdx int) []byte {
+	md := bytes.Buffer{}
+	md.WriteString(fmt.Sprintf("# %v / %v / %v\n", opt.QueryTypes[qtIdx], opt.Datasets[dsIdx].Label, opt.Instances[insIdx].Label))
+	md.WriteString("\n[back to the report](../report.md)\n")
+	if len(rs) == 0 {
+		md.WriteString("\nNo results.\n")
+		return md.Bytes()
+	}
+
+	md.WriteString("\n## PError Histogram\n")
+	md.WriteString("\n| Range | Count | Ratio | |\n")
+	md.WriteString("| ---- | ---- | ---- | ---- |\n")
+	freqs := distribution(rs, boundaries, PError)
+	for i := 1; i < len(boundaries); i++ {
+		ratio := freqs[i] / float64(len(rs))
+		md.WriteString(fmt.Sprintf("| [%v, %v) | %v | %.2f%% | %v |\n",
+			boundaries[i-1], boundaries[i], freqs[i], ratio*100, strings.Repeat("#", int(math.Ceil(ratio*50)))))
+	}
+
+	sorted := make([]EstResult, len(rs))
+	copy(sorted, rs)
+	sort.SliceStable(sorted, func(i, j int) bool { return math.Abs(PError(sorted[i])) > math.Abs(PError(sorted[j])) })
+	best := make([]EstResult, 0, drillDownCases)
+	for i := len(sorted) - 1; i >= 0 && len(best) < drillDownCases; i-- {
+		best = append(best, sorted[i])
+	}
+	if len(sorted) > drillDownCases {
+		sorted = sorted[:drillDownCases]
+	}
+
+	var plans []string
+	writeCases := func(title string, cases []EstResult) {
+		md.WriteString(fmt.Sprintf("\n## %v\n", title))
+		md.WriteString("\n| PError | Est | True | SQL | Plan |\n")
+		md.WriteString("| ---- | ---- | ---- | ---- | ---- |\n")
+		for _, r := range cases {
+			plan := "-"
+			if r.Plan != "" {
+				plans = append(plans, r.Plan)
+				plan = fmt.Sprintf("[plan](#plan-%v)", len(plans))
+			}
+			md.WriteString(fmt.Sprintf("| %.3f | %v | %v | `%v` | %v |\n",
+				PError(r), opt.NumberFormat.rows(r.EstCard), opt.NumberFormat.rows(r.TrueCard), strings.Replace(opt.reportSQL(r.SQL), "|", "\\|", -1), plan))
+		}
+	}
+	writeCases(fmt.Sprintf("Worst %v Cases", len(sorted)), sorted)
+	writeCases(fmt.Sprintf("Best %v Cases", len(best)), best)
+
+	if len(plans) > 0 {
+		md.WriteString("\n## Captured Plans\n")
+		for i, p := range plans {
+			md.WriteString(fmt.Sprintf("\n<a id=\"plan-%v\"></a>\n### Plan %v\n\n```\n%v\n```\n", i+1, i+1, opt.reportSQL(p)))
+		}
+	}
+	return md.Bytes()
+}
@@ -0,0 +1,143 @@
+package cetest
+
+import (
+	"bytes"
+	"encoding/base64"
+	"fmt"
+	"io/ioutil"
+	"mime"
+	"mime/multipart"
+	"net"
+	"net/smtp"
+	"net/textproto"
+	"path"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"github.com/pingcap/errors"
+)
+
+// EmailOpt delivers the report by SMTP after the run, so results of nightly runs don't need to be fetched manually.
+type EmailOpt struct {
+	Addr         string   `toml:"addr"` // address of the SMTP server like "smtp.example.com:587", disabled if empty
+	User         string   `toml:"user"`
+	Password     string   `toml:"password"`
+	From         string   `toml:"from"`
+	To           []string `toml:"to"`
+	Subject      string   `toml:"subject"`       // "CETest Report" with the time if empty
+	AttachCharts bool     `toml:"attach-charts"` // attach all charts in ReportDir
+}
+
+func (eo EmailOpt) check() error {
+	if eo.Addr == "" {
+		return nil
+	}
+	if _, _, err := net.SplitHostPort(eo.Addr); err != nil {
+		return errors.Errorf("invalid email addr=%v", eo.Addr)
+	}
+	if eo.From == "" || len(eo.To) == 0 {
+		return errors.Errorf("email requires from and to")
+	}
+	return nil
+}
+
+// SendReport sends report.md in ReportDir to all recipients, with all charts attached if required.
+func SendReport(opt Option) error {
+	eo := opt.Email
+	if eo.Addr == "" {
+		return nil
+	}
+	report, err := ioutil.ReadFile(path.Join(opt.ReportDir, "report.md"))
+	if err != nil {
+		return errors.Trace(err)
+	}
+	var attachments []string
+	if eo.AttachCharts {
+		for _, pattern := range []string{"*.png", "*.svg"} {
+			matches, err := filepath.Glob(path.Join(opt.ReportDir, pattern))
+			if err != nil {
+				return errors.Trace(err)
+			}
+			attachments = append(attachments, matches...)
+		}
+	}
+	msg, err := buildReportEmail(eo, report, attachments)
+	if err != nil {
+		return err
+	}
+	var auth smtp.Auth
+	if eo.User != "" {
+		host, _, _ := net.SplitHostPort(eo.Addr)
+		auth = smtp.PlainAuth("", eo.User, eo.Password, host)
+	}
+	if err := smtp.SendMail(eo.Addr, auth, eo.From, eo.To, msg); err != nil {
+		return fmt.Errorf("send report to %v, err=%v", eo.To, err)
+	}
+	fmt.Printf("[Email] sent the report to %v\n", eo.To)
+	return nil
+}
+
+// buildReportEmail builds a multipart MIME message with the report as its body and these files as attachments.
+func buildReportEmail(eo EmailOpt, report []byte, attachments []string) ([]byte, error) {
+	subject := eo.Subject
+	if subject == "" {
+		subject = "CETest Report " + time.Now().Format("2006-01-02 15:04")
+	}
+	var buf bytes.Buffer
+	w := multipart.NewWriter(&buf)
+	buf.WriteString(fmt.Sprintf("From: %v\r\n", eo.From))
+	buf.WriteString(fmt.Sprintf("To: %v\r\n", strings.Join(eo.To, ", ")))
+	buf.WriteString(fmt.Sprintf("Subject: %v\r\n", mime.QEncoding.Encode("utf-8", subject)))
+	buf.WriteString("MIME-Version: 1.0\r\n")
+	buf.WriteString(fmt.Sprintf("Content-Type: multipart/mixed; boundary=%v\r\n\r\n", w.Boundary()))
+
+	body, err := w.CreatePart(textproto.MIMEHeader{
+		"Content-Type":              {"text/plain; charset=utf-8"},
+		"Content-Transfer-Encoding": {"base64"},
+	})
+	if err != nil {
+		return nil, errors.Trace(err)
+	}
+	if _, err := body.Write(wrapBase64(report)); err != nil {
+		return nil, errors.Trace(err)
+	}
+	for _, a := range attachments {
+		data, err := ioutil.ReadFile(a)
+		if err != nil {
+			return nil, errors.Trace(err)
+		}
+		name := filepath.Base(a)
+		ctype := mime.TypeByExtension(filepath.Ext(name))
+		if ctype == "" {
+			ctype = "application/octet-stream"
+		}
+		part, err := w.CreatePart(textproto.MIMEHeader{
+			"Content-Type":              {ctype},
+			"Content-Transfer-Encoding": {"base64"},
+			"Content-Disposition":       {fmt.Sprintf("attachment; filename=%q", name)},
+		})
+		if err != nil {
+			return nil, errors.Trace(err)
+		}
+		if _, err := part.Write(wrapBase64(data)); err != nil {
+			return nil, errors.Trace(err)
+		}
+	}
+	if err := w.Close(); err != nil {
+		return nil, errors.Trace(err)
+	}
+	return buf.Bytes(), nil
+}
+
+// wrapBase64 encodes this data by base64 in lines of 76 characters as required by MIME.
+func wrapBase64(data []byte) []byte {
+	enc := base64.StdEncoding.EncodeToString(data)
+	var buf bytes.Buffer
+	for len(enc) > 76 {
+		buf.WriteString(enc[:76] + "\r\n")
+		enc = enc[76:]
+	}
+	buf.WriteString(enc + "\r\n")
+	return buf.Bytes()
+}
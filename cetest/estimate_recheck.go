@@ -0,0 +1,98 @@
+package cetest
+
+import (
+	"bytes"
+	"fmt"
+	"sync"
+	"time"
+
+	"github.com/pingcap/errors"
+	"github.com/qw4990/OptimizerTester/tidb"
+)
+
+// EstimateRecheckOpt explains each case again some time after it's run, and tags cases whose estimations changed
+// between the two EXPLAINs with TagUnstableEstimate. Estimations change when statistics are loaded asynchronously,
+// or auto-analyze or feedback updates them during the run, which pollutes comparisons silently.
+type EstimateRecheckOpt struct {
+	Enabled  bool   `toml:"enabled"`
+	Interval string `toml:"interval"` // cases of a cell are explained again this long after the last one is run, like "5s", 3s if empty
+
+	interval time.Duration
+}
+
+const defaultRecheckInterval = 3 * time.Second
+
+func (er *EstimateRecheckOpt) check() error {
+	er.interval = defaultRecheckInterval
+	if er.Interval != "" {
+		d, err := time.ParseDuration(er.Interval)
+		if err != nil || d < 0 {
+			return errors.Errorf("invalid estimate-recheck interval=%v", er.Interval)
+		}
+		er.interval = d
+	}
+	return nil
+}
+
+// TagUnstableEstimate tags cases whose estimations changed when they're explained again, see EstimateRecheckOpt.
+const TagUnstableEstimate = "unstable-estimate"
+
+// recheckEstimates explains these results of a cell again after the interval, and fills their RecheckEstCard.
+// Cases failing to be explained again are left unchecked.
+func recheckEstimates(ins tidb.Instance, ers []EstResult, er EstimateRecheckOpt, copt collectOpt) {
+	if len(ers) == 0 {
+		return
+	}
+	time.Sleep(er.interval)
+	var wg sync.WaitGroup
+	idxCh := make(chan int, len(ers))
+	for i := range ers {
+		idxCh <- i
+	}
+	close(idxCh)
+	for w := 0; w < copt.workers(); w++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for i := range idxCh {
+				copt.acquire()
+				r, err := explainExecutor{}.Execute(ins, ers[i].SQL, false)
+				copt.release()
+				if err != nil {
+					fmt.Printf("[EstimateRecheck] ins=%v, sql=%v, err=%v\n", ins.Opt().Label, ers[i].SQL, err)
+					continue
+				}
+				ers[i].RecheckEstCard = r.EstCard
+				if r.EstCard != ers[i].EstCard {
+					ers[i].Tags = append(ers[i].Tags, TagUnstableEstimate)
+				}
+			}
+		}()
+	}
+	wg.Wait()
+}
+
+// writeUnstableEstimates writes a table of cases whose estimations changed when they're explained again.
+// It's skipped if estimations are not rechecked.
+func writeUnstableEstimates(md *bytes.Buffer, opt Option, collector EstResultCollector, dsIdx, qtIdx int) {
+	if !opt.EstimateRecheck.Enabled {
+		return
+	}
+	md.WriteString("\nUnstable Estimations\n")
+	md.WriteString("\n| Instance | Cases | Unstable | Example |\n")
+	md.WriteString("| ---- | ---- | ---- | ---- |\n")
+	for insIdx, ins := range opt.Instances {
+		rs := collector.EstResults(insIdx, dsIdx, qtIdx)
+		unstable := 0
+		example := "-"
+		for _, r := range rs {
+			if r.HasTag(TagUnstableEstimate) {
+				unstable++
+				if example == "-" {
+					example = fmt.Sprintf("`%v`: %v => %v", opt.reportSQL(r.SQL), opt.NumberFormat.rows(r.EstCard), opt.NumberFormat.rows(r.RecheckEstCard))
+				}
+			}
+		}
+		md.WriteString(fmt.Sprintf("| %v | %v | %v | %v |\n", ins.Label, len(rs), unstable, example))
+	}
+}
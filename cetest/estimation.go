@@ -1,13 +1,146 @@
 package cetest
 
 import (
+	"sort"
+	"strings"
 	"sync"
+	"time"
 )
 
+// EstResult is the result of a case. Its exported fields are a stable API for tools consuming results, fields are
+// only added and never renamed or removed.
 type EstResult struct {
-	SQL      string
-	EstCard  float64 // estimated cardinality
-	TrueCard float64 // true cardinality
+	SQL         string
+	Operator    string          // ID of the root operator of the plan, whose estRows is the estimated cardinality
+	EstCard     float64         // estimated cardinality
+	TrueCard    float64         // true cardinality
+	Selectivity float64         // true selectivity of the predicate, 0 if unknown
+	EstCost     float64         // estimated cost of the plan, 0 if unknown
+	PlanLatency time.Duration   // latency of EXPLAIN, 0 if unknown
+	Tags        []string        // tags describing this case, like TagMCV
+	Operators   []OperatorStats // runtime statistics of all operators, only available if it's from EXPLAIN ANALYZE
+	Plan        string          // full text of the plan, only kept for sampled cases
+
+	PlanFingerprint string              // normalized shape of the plan, see PlanFingerprint
+	PlanDigest      string              // digest of the plan fingerprint, identical for the same plan shape on all instances
+	StmtDigest      string              // digest of the statement in STATEMENTS_SUMMARY of the instance, see StmtSummaryOpt
+	StmtPlanDigest  string              // digest of the plan in STATEMENTS_SUMMARY of the instance, see StmtSummaryOpt
+	ExplainRef      string              // reference of the archived output of EXPLAIN, see ExplainArchiveOpt
+	ExecTime        time.Duration       // actual execution time of the plan, 0 if it's not executed
+	TraceSteps      []string            // types of selectivity derivation steps fired by the optimizer, only kept for traced cases
+	ApplyEstRows    float64             // estimated rows of the inner side of the first Apply per outer row, 0 if there is no Apply
+	MPPJoin         string              // MPPJoinBroadcast or MPPJoinShuffle if the join is executed by MPP, empty otherwise
+	PseudoStats     bool                // whether any operator of the plan is estimated by pseudo statistics
+	TableRows       float64             // rows of tables read by this case, the product of them for joins, 0 if unknown
+	Risks           []PlanRisk          // risky choices in the executed plan, see planRisks
+	WhatIf          []WhatIfResult      // estimations with candidate indexes, see Option.WhatIfIndexes
+	JoinOrders      []JoinOrderResult   // execution times with the chosen and alternative join orders, see JoinOrderOpt
+	Remediations    []RemediationResult // estimations with candidate statistics remediations of columns, see RemediationOpt
+	TopNCount       float64             // count of the TopN entry of the value of this point case, 0 if it's not in TopN
+	RecheckEstCard  float64             // estimated cardinality when the case is explained again, see EstimateRecheckOpt
+	CalcTrueCard    float64             // true cardinality calculated before the run if it's changed by the write load, see WriteLoadOpt
+	ErrKind         ErrorKind           // kind of the error if this case failed, only set for results of Option.FailedCases
+	Err             string              // message of the error if this case failed
+
+	// Labels are values of dimensions beyond instances, datasets and query types, like {"analyze-version": "2"},
+	// which key results in collectors besides cells, see EstResultCollector.LabeledEstResults, so results can be keyed
+	// by new experiment axes without changing the collector.
+	Labels map[string]string
+}
+
+// Tags of cases, which are finer-grained than query types.
+const (
+	TagMCV            = "mcv"             // predicates on the most common values
+	TagNull           = "null"            // predicates involving NULLs
+	TagOutOfRange     = "out-of-range"    // predicates on values out of the range of the column
+	TagBucketBoundary = "bucket-boundary" // predicates on values at bounds of buckets of histograms
+	TagEmpty          = "empty"           // cases whose true cardinality is 0
+	TagLeaf           = "leaf"            // recursive cases starting from leaves, whose recursive parts return nothing
+
+	TagCorrelated   = "correlated"   // cases with correlated subqueries, whose estimations are of inner sides of Apply
+	TagDecorrelated = "decorrelated" // correlated cases which are decorrelated without Apply
+
+	TagNotPointGet = "not-point-get" // cases on unique keys whose plans degrade from PointGet or BatchPointGet to scans
+
+	TagCTEInlined      = "cte-inlined"      // cases whose CTEs are inlined into the main plan
+	TagCTEMaterialized = "cte-materialized" // cases whose CTEs are materialized by producers in separate plan trees
+
+	TagImportanceSampled = "importance-sampled" // cases drawn by the biased pass of the importance sampling toward high-error regions
+)
+
+// HasTag returns whether this result has this tag.
+func (r EstResult) HasTag(tag string) bool {
+	for _, t := range r.Tags {
+		if t == tag {
+			return true
+		}
+	}
+	return false
+}
+
+// LabelText returns all labels of this result ordered by dimensions, like "analyze-version=2;index=with".
+func (r EstResult) LabelText() string {
+	kvs := make([]string, 0, len(r.Labels))
+	for k, v := range r.Labels {
+		kvs = append(kvs, k+"="+v)
+	}
+	sort.Strings(kvs)
+	return strings.Join(kvs, ";")
+}
+
+// LabelDims returns all dimensions of labels of these results in order.
+func LabelDims(rs []EstResult) []string {
+	var dims []string
+	seen := make(map[string]bool)
+	for _, r := range rs {
+		for k := range r.Labels {
+			if !seen[k] {
+				seen[k] = true
+				dims = append(dims, k)
+			}
+		}
+	}
+	sort.Strings(dims)
+	return dims
+}
+
+// GroupByLabel groups these results by their values of this dimension, and returns all values in order.
+// Results without this dimension are grouped into "".
+func GroupByLabel(rs []EstResult, dim string) ([]string, map[string][]EstResult) {
+	var vals []string
+	groups := make(map[string][]EstResult)
+	for _, r := range rs {
+		v := r.Labels[dim]
+		if _, ok := groups[v]; !ok {
+			vals = append(vals, v)
+		}
+		groups[v] = append(groups[v], r)
+	}
+	sort.Strings(vals)
+	return vals, groups
+}
+
+// matchTags returns whether these tags contain any tag in this filter, and an empty filter matches all tags.
+func matchTags(filter, tags []string) bool {
+	if len(filter) == 0 {
+		return true
+	}
+	for _, f := range filter {
+		for _, t := range tags {
+			if f == t {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// emptyTags returns TagEmpty if act is 0.
+func emptyTags(act int) []string {
+	if act == 0 {
+		return []string{TagEmpty}
+	}
+	return nil
 }
 
 // QError is max(est/true, true/est) or ((numerator+1)/(denominator+1)) if the denominator is 0.
@@ -25,11 +158,12 @@ func QError(r EstResult) float64 {
 }
 
 /*
-	PError is:
-		if est > true && true > 0: (est/true) - 1
-		if est > true && true == 0: ((est+1)/(true+1)) - 1
-		if est <= true && est > 0: 1 - (true/est)
-		if est <= true && est == 0: 1 - ((true+1)/(est+1))
+PError is:
+
+	if est > true && true > 0: (est/true) - 1
+	if est > true && true == 0: ((est+1)/(true+1)) - 1
+	if est <= true && est > 0: 1 - (true/est)
+	if est <= true && est == 0: 1 - ((true+1)/(est+1))
 */
 func PError(r EstResult) float64 {
 	if r.EstCard > r.TrueCard && r.TrueCard > 0 {
@@ -48,10 +182,17 @@ func Bias(r EstResult) float64 {
 	return (r.EstCard - r.TrueCard) / (r.TrueCard + 1)
 }
 
+// EstResultCollector collects results keyed by cells of instances, datasets and query types, and by their labels.
 type EstResultCollector interface {
 	AddEstResult(insIdx, dsIdx, qtIdx int, r EstResult)
 	AppendEstResults(insIdx, dsIdx, qtIdx int, ers []EstResult)
 	EstResults(insIdx, dsIdx, qtIdx int) []EstResult
+	UpdateEstResult(insIdx, dsIdx, qtIdx, idx int, r EstResult)
+
+	// LabelSets returns labels of all collected results in the format of EstResult.LabelText in order.
+	LabelSets() []string
+	// LabeledEstResults returns results of this cell whose labels are these, in the format of EstResult.LabelText.
+	LabeledEstResults(labels string, insIdx, dsIdx, qtIdx int) []EstResult
 }
 
 func NewEstResultCollector(insCap, dsCap, qtCap int) EstResultCollector {
@@ -64,28 +205,82 @@ func NewEstResultCollector(insCap, dsCap, qtCap int) EstResultCollector {
 	}
 	c := new(estResultCollector)
 	c.rs = rs
+	c.mem = newCollectorMemory()
+	c.labelSets = make(map[string]bool)
 	return c
 }
 
 type estResultCollector struct {
-	rs   [][][][]EstResult
-	lock sync.RWMutex
+	rs        [][][][]EstResult
+	lock      sync.RWMutex
+	mem       *collectorMemory // see CollectorOpt
+	labelSets map[string]bool  // labels of all results, see EstResult.LabelText
 }
 
 func (c *estResultCollector) AppendEstResults(insIdx, dsIdx, qtIdx int, ers []EstResult) {
 	c.lock.Lock()
 	defer c.lock.Unlock()
+	k := cellKey{insIdx, dsIdx, qtIdx}
+	c.touch(k)
 	c.rs[insIdx][dsIdx][qtIdx] = append(c.rs[insIdx][dsIdx][qtIdx], ers...)
+	size := int64(0)
+	for _, r := range ers {
+		size += estResultSize(r)
+		c.labelSets[r.LabelText()] = true
+	}
+	c.grow(k, size)
 }
 
 func (c *estResultCollector) AddEstResult(insIdx, dsIdx, qtIdx int, r EstResult) {
 	c.lock.Lock()
 	defer c.lock.Unlock()
+	k := cellKey{insIdx, dsIdx, qtIdx}
+	c.touch(k)
 	c.rs[insIdx][dsIdx][qtIdx] = append(c.rs[insIdx][dsIdx][qtIdx], r)
+	c.labelSets[r.LabelText()] = true
+	c.grow(k, estResultSize(r))
+}
+
+func (c *estResultCollector) UpdateEstResult(insIdx, dsIdx, qtIdx, idx int, r EstResult) {
+	c.lock.Lock()
+	defer c.lock.Unlock()
+	k := cellKey{insIdx, dsIdx, qtIdx}
+	c.touch(k)
+	old := c.rs[insIdx][dsIdx][qtIdx][idx]
+	c.rs[insIdx][dsIdx][qtIdx][idx] = r
+	c.labelSets[r.LabelText()] = true
+	c.grow(k, estResultSize(r)-estResultSize(old))
 }
 
 func (c *estResultCollector) EstResults(insIdx, dsIdx, qtIdx int) []EstResult {
+	if c.mem.limit > 0 { // spilled cells may be loaded back
+		c.lock.Lock()
+		defer c.lock.Unlock()
+		c.touch(cellKey{insIdx, dsIdx, qtIdx})
+		return c.rs[insIdx][dsIdx][qtIdx]
+	}
 	c.lock.RLock()
 	defer c.lock.RUnlock()
 	return c.rs[insIdx][dsIdx][qtIdx]
 }
+
+func (c *estResultCollector) LabelSets() []string {
+	c.lock.RLock()
+	defer c.lock.RUnlock()
+	sets := make([]string, 0, len(c.labelSets))
+	for labels := range c.labelSets {
+		sets = append(sets, labels)
+	}
+	sort.Strings(sets)
+	return sets
+}
+
+func (c *estResultCollector) LabeledEstResults(labels string, insIdx, dsIdx, qtIdx int) []EstResult {
+	var rs []EstResult
+	for _, r := range c.EstResults(insIdx, dsIdx, qtIdx) {
+		if r.LabelText() == labels {
+			rs = append(rs, r)
+		}
+	}
+	return rs
+}
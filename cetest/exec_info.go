@@ -0,0 +1,142 @@
+package cetest
+
+import (
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/pingcap/errors"
+)
+
+// OperatorStats is the runtime statistics of an operator in results of EXPLAIN ANALYZE.
+type OperatorStats struct {
+	ID        string // operator ID without tree prefixes, like TableReader_5
+	Depth     int    // depth of this operator in the plan tree, 0 for the root
+	Tree      int    // index of the plan tree of this operator, 0 for the main plan and others for producers of CTEs
+	Task      string
+	Object    string // access object, like "table:t, index:a(a)"
+	Info      string // operator info, like "eq(test.t.a, 1)"
+	EstRows   float64
+	ActRows   float64
+	Time      time.Duration     // execution time in execution info, 0 if unknown
+	Loops     int               // loops in execution info, 0 if unknown
+	ExecInfo  map[string]string // all top-level items of execution info
+	MemBytes  int64             // -1 if unknown
+	DiskBytes int64             // -1 if unknown
+}
+
+// ParseExplainAnalyze parses all operators in results of EXPLAIN ANALYZE by their column names.
+func ParseExplainAnalyze(header []string, results [][]string) ([]OperatorStats, error) {
+	idx := map[string]int{}
+	for i, h := range header {
+		idx[strings.ToLower(strings.Replace(h, " ", "", -1))] = i
+	}
+	get := func(row []string, cols ...string) string {
+		for _, c := range cols {
+			if i, ok := idx[c]; ok {
+				return row[i]
+			}
+		}
+		return ""
+	}
+	if _, ok := idx["id"]; !ok {
+		return nil, errors.Errorf("unknown explain analyze format with columns %v", header)
+	}
+
+	ops := make([]OperatorStats, 0, len(results))
+	tree := 0
+	for _, row := range results {
+		id, depth := trimTreePrefix(get(row, "id"))
+		if depth == 0 && len(ops) > 0 {
+			tree++ // producers of materialized CTEs follow the main plan as separate trees
+		}
+		op := OperatorStats{
+			ID:       id,
+			Depth:    depth,
+			Tree:     tree,
+			Task:     get(row, "task"),
+			Object:   get(row, "accessobject"),
+			Info:     get(row, "operatorinfo"),
+			ExecInfo: parseExecInfo(get(row, "executioninfo", "execution_info")),
+		}
+		var err error
+		if op.EstRows, err = strconv.ParseFloat(get(row, "estrows", "count"), 64); err != nil {
+			return nil, errors.Errorf("invalid estRows of %v", id)
+		}
+		act := get(row, "actrows")
+		if act == "" {
+			act = op.ExecInfo["rows"] // v3.x
+		}
+		if act != "" {
+			if op.ActRows, err = strconv.ParseFloat(act, 64); err != nil {
+				return nil, errors.Errorf("invalid actRows of %v", id)
+			}
+		}
+		if t, ok := op.ExecInfo["time"]; ok {
+			op.Time, _ = time.ParseDuration(t)
+		}
+		if l, ok := op.ExecInfo["loops"]; ok {
+			op.Loops, _ = strconv.Atoi(l)
+		}
+		op.MemBytes = parseBytes(get(row, "memory"))
+		op.DiskBytes = parseBytes(get(row, "disk"))
+		ops = append(ops, op)
+	}
+	return ops, nil
+}
+
+// trimTreePrefix removes prefixes like "│ └─" of this operator ID and returns its depth.
+func trimTreePrefix(id string) (string, int) {
+	trimmed := strings.TrimLeft(id, " │├└─")
+	prefix := []rune(id[:len(id)-len(trimmed)])
+	return trimmed, (len(prefix) + 1) / 2
+}
+
+// parseExecInfo parses top-level items of execution info like "time:1.2ms, loops:2, cop_task: {num: 1, max: 1ms}".
+func parseExecInfo(info string) map[string]string {
+	items := make(map[string]string)
+	depth, begin := 0, 0
+	add := func(item string) {
+		kv := strings.SplitN(item, ":", 2)
+		if len(kv) == 2 {
+			items[strings.TrimSpace(kv[0])] = strings.TrimSpace(kv[1])
+		}
+	}
+	for i, c := range info {
+		switch c {
+		case '{', '[':
+			depth++
+		case '}', ']':
+			depth--
+		case ',':
+			if depth == 0 {
+				add(info[begin:i])
+				begin = i + 1
+			}
+		}
+	}
+	add(info[begin:])
+	return items
+}
+
+var byteUnits = map[string]float64{ // read-only
+	"bytes": 1,
+	"kb":    1 << 10,
+	"mb":    1 << 20,
+	"gb":    1 << 30,
+	"tb":    1 << 40,
+}
+
+// parseBytes parses sizes like "115 Bytes" or "1.23 KB", and returns -1 if it's unknown like "N/A".
+func parseBytes(s string) int64 {
+	xs := strings.Fields(s)
+	if len(xs) != 2 {
+		return -1
+	}
+	v, err := strconv.ParseFloat(xs[0], 64)
+	unit, ok := byteUnits[strings.ToLower(xs[1])]
+	if err != nil || !ok {
+		return -1
+	}
+	return int64(v * unit)
+}
@@ -0,0 +1,170 @@
+package cetest
+
+import (
+	"bytes"
+	"fmt"
+	"sync"
+	"time"
+)
+
+// executionSkewThreshold is the ratio of time per case between the slowest and the fastest instance of a cell beyond
+// which the cell is highlighted, since it's more likely a regression of executors than noise.
+const executionSkewThreshold = 2
+
+// cellTiming is the wall-clock time an instance spends on running cases of a cell.
+type cellTiming struct {
+	cost  time.Duration
+	cases int
+}
+
+func (ct cellTiming) perCase() time.Duration {
+	if ct.cases == 0 {
+		return ct.cost
+	}
+	return ct.cost / time.Duration(ct.cases)
+}
+
+// cellTimings keeps wall-clock time of all cells on all instances, keyed by their labels since reports reorder them.
+type cellTimings struct {
+	lock  sync.Mutex
+	cells map[string]cellTiming // instance/dataset/query type
+}
+
+func newCellTimings() *cellTimings {
+	return &cellTimings{cells: make(map[string]cellTiming)}
+}
+
+func cellTimingKey(ins, ds string, qt QueryType) string {
+	return fmt.Sprintf("%v/%v/%v", ins, ds, qt)
+}
+
+// record adds the time of running these cases of this cell on this instance.
+func (t *cellTimings) record(ins, ds string, qt QueryType, cost time.Duration, cases int) {
+	if t == nil {
+		return
+	}
+	t.lock.Lock()
+	defer t.lock.Unlock()
+	k := cellTimingKey(ins, ds, qt)
+	ct := t.cells[k]
+	ct.cost += cost
+	ct.cases += cases
+	t.cells[k] = ct
+}
+
+// reset clears all timings, it's called in each run of the matrix.
+func (t *cellTimings) reset() {
+	if t == nil {
+		return
+	}
+	t.lock.Lock()
+	defer t.lock.Unlock()
+	t.cells = make(map[string]cellTiming)
+}
+
+func (t *cellTimings) empty() bool {
+	if t == nil {
+		return true
+	}
+	t.lock.Lock()
+	defer t.lock.Unlock()
+	return len(t.cells) == 0
+}
+
+func (t *cellTimings) get(ins, ds string, qt QueryType) (cellTiming, bool) {
+	t.lock.Lock()
+	defer t.lock.Unlock()
+	ct, ok := t.cells[cellTimingKey(ins, ds, qt)]
+	return ct, ok
+}
+
+// skew returns the ratio of time per case between the slowest and the fastest instance and the index of the slowest
+// one in these timings, or false if there are fewer than two of them.
+func skew(timings []cellTiming, ok []bool) (float64, int, bool) {
+	minIdx, maxIdx := -1, -1
+	for i, ct := range timings {
+		if !ok[i] {
+			continue
+		}
+		if minIdx == -1 || ct.perCase() < timings[minIdx].perCase() {
+			minIdx = i
+		}
+		if maxIdx == -1 || ct.perCase() > timings[maxIdx].perCase() {
+			maxIdx = i
+		}
+	}
+	if minIdx == -1 || minIdx == maxIdx || timings[minIdx].perCase() <= 0 {
+		return 0, -1, false
+	}
+	return float64(timings[maxIdx].perCase()) / float64(timings[minIdx].perCase()), maxIdx, true
+}
+
+// writeExecutionSkew writes wall-clock time of each instance on each cell and in total, and how much slower the
+// slowest instance is than the fastest one per case, cells beyond executionSkewThreshold are highlighted. It's
+// skipped if no cell is timed, like in re-runs.
+func writeExecutionSkew(md *bytes.Buffer, opt Option) {
+	t := opt.timings
+	if t.empty() {
+		return
+	}
+	executor := opt.Executor
+	if executor == "" {
+		executor = "explain"
+	}
+	md.WriteString("# Execution Skew\n")
+	md.WriteString(fmt.Sprintf("\nWall-clock time of each instance running cases of each cell by the %v executor, with time per case in "+
+		"parentheses. Skew is the ratio of time per case between the slowest and the fastest instance, cells beyond %vx "+
+		"are marked with ⚠ and their slowest instances are in bold.\n", executor, executionSkewThreshold))
+	md.WriteString("\n| Dataset | Query Type |")
+	sep := "| ---- | ---- |"
+	for _, ins := range opt.Instances {
+		md.WriteString(fmt.Sprintf(" %v |", ins.Label))
+		sep += " ---- |"
+	}
+	md.WriteString(" Skew |\n" + sep + " ---- |\n")
+
+	writeRow := func(ds, qt string, timings []cellTiming, ok []bool) {
+		ratio, slowest, skewed := skew(timings, ok)
+		highlight := skewed && ratio >= executionSkewThreshold
+		md.WriteString(fmt.Sprintf("| %v | %v |", ds, qt))
+		for i, ct := range timings {
+			switch {
+			case !ok[i]:
+				md.WriteString(" - |")
+			case highlight && i == slowest:
+				md.WriteString(fmt.Sprintf(" **%v (%v)** |", ct.cost.Round(time.Millisecond), ct.perCase().Round(time.Microsecond)))
+			default:
+				md.WriteString(fmt.Sprintf(" %v (%v) |", ct.cost.Round(time.Millisecond), ct.perCase().Round(time.Microsecond)))
+			}
+		}
+		switch {
+		case !skewed:
+			md.WriteString(" - |\n")
+		case highlight:
+			md.WriteString(fmt.Sprintf(" ⚠ %.2fx |\n", ratio))
+		default:
+			md.WriteString(fmt.Sprintf(" %.2fx |\n", ratio))
+		}
+	}
+
+	totals, totalOK := make([]cellTiming, len(opt.Instances)), make([]bool, len(opt.Instances))
+	for _, ds := range opt.Datasets {
+		for _, qt := range opt.QueryTypes {
+			timings, ok := make([]cellTiming, len(opt.Instances)), make([]bool, len(opt.Instances))
+			timed := false
+			for insIdx, ins := range opt.Instances {
+				timings[insIdx], ok[insIdx] = t.get(ins.Label, ds.Label, qt)
+				if ok[insIdx] {
+					totals[insIdx].cost += timings[insIdx].cost
+					totals[insIdx].cases += timings[insIdx].cases
+					totalOK[insIdx], timed = true, true
+				}
+			}
+			if timed {
+				writeRow(ds.Label, qt.String(), timings, ok)
+			}
+		}
+	}
+	writeRow("**Overall**", "", totals, totalOK)
+	md.WriteString("\n")
+}
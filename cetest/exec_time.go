@@ -0,0 +1,128 @@
+package cetest
+
+import (
+	"bytes"
+	"fmt"
+	"sort"
+
+	"github.com/qw4990/OptimizerTester/tidb"
+)
+
+// compareExecTime executes up to ExecTimeCases cases of each cell whose plans are the same on all instances,
+// and records their actual execution times, which are compared in reports as a signal of executors' performance.
+func compareExecTime(opt Option, instances []tidb.Instance, collector EstResultCollector) error {
+	if opt.ExecTimeCases <= 0 || len(instances) < 2 {
+		return nil
+	}
+	for dsIdx := range opt.Datasets {
+		for qtIdx := range opt.QueryTypes {
+			// idxs[sql][insIdx] is the index of the result of this SQL on this instance
+			idxs := make(map[string][]int)
+			var sqls []string
+			for insIdx := range instances {
+				for i, r := range collector.EstResults(insIdx, dsIdx, qtIdx) {
+					if _, ok := idxs[r.SQL]; !ok {
+						idxs[r.SQL] = make([]int, len(instances))
+						for j := range idxs[r.SQL] {
+							idxs[r.SQL][j] = -1
+						}
+						sqls = append(sqls, r.SQL)
+					}
+					idxs[r.SQL][insIdx] = i
+				}
+			}
+
+			n := 0
+			for _, sql := range sqls {
+				if n >= opt.ExecTimeCases {
+					break
+				}
+				if !samePlanOnAllInstances(collector, dsIdx, qtIdx, idxs[sql]) {
+					continue
+				}
+				if admitted, err := admittedOnAllInstances(instances, sql, opt.Guard); err != nil {
+					return err
+				} else if !admitted {
+					continue
+				}
+				for insIdx, ins := range instances {
+					r := collector.EstResults(insIdx, dsIdx, qtIdx)[idxs[sql][insIdx]]
+					ar, err := getEstResultFromExplainAnalyze(ins, opt.Guard.wrap(sql))
+					if err != nil {
+						return fmt.Errorf("execute %v on %v, err=%v", sql, ins.Opt().Label, err)
+					}
+					if len(ar.Operators) > 0 {
+						r.ExecTime = ar.Operators[0].Time
+					}
+					collector.UpdateEstResult(insIdx, dsIdx, qtIdx, idxs[sql][insIdx], r)
+				}
+				n++
+			}
+		}
+	}
+	return nil
+}
+
+func samePlanOnAllInstances(collector EstResultCollector, dsIdx, qtIdx int, idxs []int) bool {
+	fp := ""
+	for insIdx, idx := range idxs {
+		if idx == -1 {
+			return false
+		}
+		r := collector.EstResults(insIdx, dsIdx, qtIdx)[idx]
+		if r.PlanFingerprint == "" || (fp != "" && r.PlanFingerprint != fp) {
+			return false
+		}
+		fp = r.PlanFingerprint
+	}
+	return true
+}
+
+func admittedOnAllInstances(instances []tidb.Instance, sql string, g GuardOpt) (bool, error) {
+	for _, ins := range instances {
+		if err := g.admit(ins, sql); rejectedByGuard(err) {
+			return false, nil
+		} else if err != nil {
+			return false, err
+		}
+	}
+	return true, nil
+}
+
+// writeExecTimeComparison writes ratios of execution times between each pair of instances on identical plans in this cell.
+func writeExecTimeComparison(md *bytes.Buffer, opt Option, collector EstResultCollector, dsIdx, qtIdx int) {
+	times := make([]map[string]float64, len(opt.Instances)) // insIdx, SQL, execution time in seconds
+	for insIdx := range opt.Instances {
+		times[insIdx] = make(map[string]float64)
+		for _, r := range collector.EstResults(insIdx, dsIdx, qtIdx) {
+			if r.ExecTime > 0 {
+				times[insIdx][r.SQL] = r.ExecTime.Seconds()
+			}
+		}
+	}
+
+	header := false
+	for i := range opt.Instances {
+		for j := i + 1; j < len(opt.Instances); j++ {
+			var ratios []float64
+			for sql, ti := range times[i] {
+				if tj, ok := times[j][sql]; ok {
+					ratios = append(ratios, tj/ti)
+				}
+			}
+			if len(ratios) == 0 {
+				continue
+			}
+			if !header {
+				md.WriteString("\nExecution Time Ratios on Identical Plans\n")
+				md.WriteString("\n| Instance A | Instance B | Cases | P10 (B/A) | P50 (B/A) | P90 (B/A) |\n")
+				md.WriteString("| ---- | ---- | ---- | ---- | ---- | ---- |\n")
+				header = true
+			}
+			sort.Float64s(ratios)
+			n := len(ratios)
+			md.WriteString(fmt.Sprintf("| %v | %v | %v | %.3f | %.3f | %.3f |\n", opt.Instances[i].Label, opt.Instances[j].Label,
+				n, ratios[n/10], ratios[n/2], ratios[(n*9)/10]))
+		}
+	}
+}
@@ -0,0 +1,184 @@
+package cetest
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/pingcap/errors"
+	"github.com/qw4990/OptimizerTester/tidb"
+)
+
+// Executor measures a case on an instance, which is selected for each run by Option.Executor,
+// so new measurement strategies don't need to touch queriers.
+type Executor interface {
+	// Name returns the name of this executor used in configs.
+	Name() string
+
+	// Execute returns the estimation of this query, and the full plan if keepPlan is true.
+	Execute(ins tidb.Instance, query string, keepPlan bool) (EstResult, error)
+
+	// MeasuresTruth returns whether Execute measures true cardinalities, which are checked against calculated ones.
+	MeasuresTruth() bool
+}
+
+var executorMap = map[string]func(opt Option) Executor{ // read-only
+	"explain":         func(Option) Executor { return explainExecutor{} },
+	"explain-analyze": func(opt Option) Executor { return explainAnalyzeExecutor{opt.Guard} },
+	"trace":           func(opt Option) Executor { return traceExecutor{opt.Guard} },
+	"count-verify":    func(opt Option) Executor { return countVerifyExecutor{opt.Guard} },
+}
+
+// newExecutor returns the executor of this name, the EXPLAIN executor is used if it's empty.
+func newExecutor(opt Option) (Executor, error) {
+	name := strings.ToLower(opt.Executor)
+	if name == "" {
+		name = "explain"
+	}
+	newExec, ok := executorMap[name]
+	if !ok {
+		names := make([]string, 0, len(executorMap))
+		for n := range executorMap {
+			names = append(names, n)
+		}
+		sort.Strings(names)
+		return nil, errors.Errorf("unknown executor=%v, which should be one of %v", opt.Executor, names)
+	}
+	if name != "explain" && opt.ReadOnly {
+		return nil, errors.Errorf("executor=%v is not allowed in read-only mode since it runs queries", name)
+	}
+	return newExec(opt), nil
+}
+
+// explainExecutor only explains cases, which is the cheapest one and used by default.
+type explainExecutor struct{}
+
+func (explainExecutor) Name() string { return "explain" }
+
+func (explainExecutor) Execute(ins tidb.Instance, query string, keepPlan bool) (EstResult, error) {
+	return getEstResultFromExplain(ins, query, keepPlan)
+}
+
+func (explainExecutor) MeasuresTruth() bool { return false }
+
+// explainAnalyzeExecutor runs cases by EXPLAIN ANALYZE, so runtime statistics of all operators are collected.
+type explainAnalyzeExecutor struct {
+	guard GuardOpt
+}
+
+func (explainAnalyzeExecutor) Name() string { return "explain-analyze" }
+
+func (e explainAnalyzeExecutor) Execute(ins tidb.Instance, query string, keepPlan bool) (EstResult, error) {
+	if err := e.guard.admit(ins, query); err != nil {
+		return EstResult{}, err
+	}
+	header, results, err := queryExplain(ins, "EXPLAIN ANALYZE", e.guard.wrap(query))
+	if err != nil {
+		return EstResult{}, err
+	}
+	r, err := ExtractEstResultByHeader(header, results)
+	if err != nil {
+		return EstResult{}, parseExplainError(query, err)
+	}
+	if r.Operators, err = ParseExplainAnalyze(header, results); err != nil {
+		return EstResult{}, parseExplainError(query, err)
+	}
+	if len(r.Operators) > 0 {
+		r.ExecTime = r.Operators[0].Time
+	}
+	describePlan(&r, header, results, keepPlan)
+	return r, nil
+}
+
+func (explainAnalyzeExecutor) MeasuresTruth() bool { return true }
+
+// traceExecutor explains cases and runs them by TRACE to measure latencies of the optimizer
+// without the overhead of EXPLAIN, which are durations of the compile span.
+type traceExecutor struct {
+	guard GuardOpt
+}
+
+func (traceExecutor) Name() string { return "trace" }
+
+func (e traceExecutor) Execute(ins tidb.Instance, query string, keepPlan bool) (EstResult, error) {
+	r, err := getEstResultFromExplain(ins, query, keepPlan)
+	if err != nil {
+		return EstResult{}, err
+	}
+	if err := e.guard.admit(ins, query); err != nil {
+		return EstResult{}, err
+	}
+	header, results, err := queryText(ins, "TRACE FORMAT='row' "+e.guard.wrap(query))
+	if err != nil {
+		return EstResult{}, err
+	}
+	if r.PlanLatency, err = compileLatency(header, results); err != nil {
+		return EstResult{}, parseExplainError(query, err)
+	}
+	return r, nil
+}
+
+func (traceExecutor) MeasuresTruth() bool { return false }
+
+// compileLatency returns the duration of the compile span in results of TRACE FORMAT='row', like:
+//
+//	operation                   startTS          duration
+//	trace                       10:00:00.000000  2.1ms
+//	  ├─session.ExecuteStmt     10:00:00.000100  1.9ms
+//	  │ ├─executor.Compile      10:00:00.000200  512.3µs
+func compileLatency(header []string, results [][]string) (time.Duration, error) {
+	opIdx, durIdx := -1, -1
+	for i, h := range header {
+		switch strings.ToLower(h) {
+		case "operation":
+			opIdx = i
+		case "duration":
+			durIdx = i
+		}
+	}
+	if opIdx == -1 || durIdx == -1 {
+		return 0, errors.Errorf("unknown trace format with columns %v", header)
+	}
+	for _, row := range results {
+		if strings.Contains(row[opIdx], "Compile") {
+			d, err := time.ParseDuration(strings.TrimSpace(row[durIdx]))
+			if err != nil {
+				return 0, errors.Errorf("invalid duration %v of %v", row[durIdx], row[opIdx])
+			}
+			return d, nil
+		}
+	}
+	return 0, errors.Errorf("no compile span in trace results")
+}
+
+// countVerifyExecutor explains cases and counts their results by SELECT COUNT(*), so calculated true cardinalities
+// are verified without the overhead of EXPLAIN ANALYZE.
+type countVerifyExecutor struct {
+	guard GuardOpt
+}
+
+func (countVerifyExecutor) Name() string { return "count-verify" }
+
+func (e countVerifyExecutor) Execute(ins tidb.Instance, query string, keepPlan bool) (EstResult, error) {
+	r, err := getEstResultFromExplain(ins, query, keepPlan)
+	if err != nil {
+		return EstResult{}, err
+	}
+	if err := e.guard.admit(ins, query); err != nil {
+		return EstResult{}, err
+	}
+	_, results, err := queryText(ins, e.guard.wrap(fmt.Sprintf("SELECT COUNT(*) FROM (%v) t", query)))
+	if err != nil {
+		return EstResult{}, err
+	}
+	if len(results) != 1 || len(results[0]) != 1 {
+		return EstResult{}, parseExplainError(query, errors.Errorf("no result of counting %v", query))
+	}
+	if _, err := fmt.Sscan(results[0][0], &r.TrueCard); err != nil {
+		return EstResult{}, parseExplainError(query, errors.Errorf("invalid count %v of %v", results[0][0], query))
+	}
+	return r, nil
+}
+
+func (countVerifyExecutor) MeasuresTruth() bool { return true }
@@ -0,0 +1,136 @@
+package cetest
+
+import (
+	"compress/gzip"
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path"
+	"regexp"
+	"sync"
+
+	"github.com/pingcap/errors"
+)
+
+// ExplainArchiveOpt archives raw outputs of EXPLAIN, or EXPLAIN ANALYZE of executors measuring true cardinalities, of
+// all cases into a content-addressed store, so any result can be audited later without running it again. Each
+// output is kept once as "<dir>/<first 2 chars of ref>/<ref>.gz", where ref is the sha256 of the output and recorded
+// as explain_ref of exported raw results, see ReadArchivedExplain. Identical outputs, like plans of cases differing
+// only by constants, are deduplicated, and a store can be shared by runs to deduplicate across them.
+type ExplainArchiveOpt struct {
+	Enabled bool   `toml:"enabled"`
+	Dir     string `toml:"dir"` // directory of the store, "<report-dir>/explains" if empty
+}
+
+const defaultExplainArchiveDir = "explains"
+
+// explainRefPattern matches references of archived outputs.
+var explainRefPattern = regexp.MustCompile(`^[0-9a-f]{64}$`)
+
+// explainArchive is the store of ExplainArchiveOpt shared by all instances of a run.
+type explainArchive struct {
+	dir       string
+	anonymize func(string) string // applied to outputs before they're archived, see Option.Anonymize
+
+	mu      sync.Mutex
+	stored  map[string]bool // refs known to be in the store
+	written int             // outputs written into the store by this run
+	deduped int             // outputs already in the store
+}
+
+// newExplainArchive returns nil if archival is disabled.
+func newExplainArchive(opt Option) *explainArchive {
+	if !opt.ExplainArchive.Enabled {
+		return nil
+	}
+	dir := opt.ExplainArchive.Dir
+	if dir == "" {
+		dir = path.Join(opt.ReportDir, defaultExplainArchiveDir)
+	}
+	return &explainArchive{dir: dir, anonymize: opt.reportSQL, stored: make(map[string]bool)}
+}
+
+func explainArchivePath(dir, ref string) string {
+	return path.Join(dir, ref[:2], ref+".gz")
+}
+
+// put archives this output and returns its reference, an output already in the store is not written again.
+func (a *explainArchive) put(output string) (string, error) {
+	output = a.anonymize(output)
+	sum := sha256.Sum256([]byte(output))
+	ref := hex.EncodeToString(sum[:])
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	if a.stored[ref] {
+		a.deduped++
+		return ref, nil
+	}
+	p := explainArchivePath(a.dir, ref)
+	if _, err := os.Stat(p); err == nil { // archived by a previous run sharing the store
+		a.stored[ref] = true
+		a.deduped++
+		return ref, nil
+	}
+	if err := os.MkdirAll(path.Dir(p), 0755); err != nil {
+		return "", errors.Trace(err)
+	}
+	// write into a temporary file and rename it, so a killed run never leaves a truncated output under its ref
+	f, err := ioutil.TempFile(path.Dir(p), ref+".tmp")
+	if err != nil {
+		return "", errors.Trace(err)
+	}
+	zw := gzip.NewWriter(f)
+	_, err = zw.Write([]byte(output))
+	if err == nil {
+		err = zw.Close()
+	}
+	if cerr := f.Close(); err == nil {
+		err = cerr
+	}
+	if err == nil {
+		err = os.Rename(f.Name(), p)
+	}
+	if err != nil {
+		os.Remove(f.Name())
+		return "", errors.Trace(err)
+	}
+	a.stored[ref] = true
+	a.written++
+	return ref, nil
+}
+
+// summary prints how many outputs are archived and deduplicated.
+func (a *explainArchive) summary() {
+	if a == nil {
+		return
+	}
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	fmt.Printf("[ExplainArchive] dir=%v, written=%v, deduplicated=%v\n", a.dir, a.written, a.deduped)
+}
+
+// ReadArchivedExplain returns the output of EXPLAIN referenced by ref in the store of ExplainArchiveOpt in dir.
+func ReadArchivedExplain(dir, ref string) (string, error) {
+	if !explainRefPattern.MatchString(ref) {
+		return "", errors.Errorf("invalid explain ref %v, which should be a sha256 in hex", ref)
+	}
+	f, err := os.Open(explainArchivePath(dir, ref))
+	if err != nil {
+		return "", errors.Trace(err)
+	}
+	defer f.Close()
+	zr, err := gzip.NewReader(f)
+	if err != nil {
+		return "", errors.Errorf("corrupted explain %v, err=%v", ref, err)
+	}
+	output, err := ioutil.ReadAll(zr)
+	if err != nil {
+		return "", errors.Errorf("corrupted explain %v, err=%v", ref, err)
+	}
+	if sum := sha256.Sum256(output); hex.EncodeToString(sum[:]) != ref {
+		return "", errors.Errorf("corrupted explain %v, whose content doesn't match its ref", ref)
+	}
+	return string(output), nil
+}
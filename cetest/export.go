@@ -0,0 +1,212 @@
+package cetest
+
+import (
+	"bufio"
+	"encoding/csv"
+	"encoding/json"
+	"fmt"
+	"os"
+	"path"
+	"strconv"
+	"strings"
+
+	"github.com/pingcap/errors"
+	"github.com/xitongsys/parquet-go/parquet"
+	"github.com/xitongsys/parquet-go/writer"
+)
+
+// RawResult is a flattened EstResult with its instance, dataset and query-type, used to export results.
+type RawResult struct {
+	Instance  string  `json:"instance" parquet:"name=instance, type=BYTE_ARRAY, convertedtype=UTF8, encoding=PLAIN_DICTIONARY"`
+	Dataset   string  `json:"dataset" parquet:"name=dataset, type=BYTE_ARRAY, convertedtype=UTF8, encoding=PLAIN_DICTIONARY"`
+	QueryType string  `json:"query_type" parquet:"name=query_type, type=BYTE_ARRAY, convertedtype=UTF8, encoding=PLAIN_DICTIONARY"`
+	SQL       string  `json:"sql" parquet:"name=sql, type=BYTE_ARRAY, convertedtype=UTF8"`
+	EstCard   float64 `json:"est_card" parquet:"name=est_card, type=DOUBLE"`
+	TrueCard  float64 `json:"true_card" parquet:"name=true_card, type=DOUBLE"`
+	PError    float64 `json:"p_error" parquet:"name=p_error, type=DOUBLE"`
+	PlanMS    float64 `json:"plan_ms" parquet:"name=plan_ms, type=DOUBLE"`                       // latency of the optimizer in milliseconds
+	Labels    string  `json:"labels" parquet:"name=labels, type=BYTE_ARRAY, convertedtype=UTF8"` // see EstResult.LabelText
+	TableRows float64 `json:"table_rows" parquet:"name=table_rows, type=DOUBLE"`                 // 0 if unknown
+	SelError  float64 `json:"selectivity_error" parquet:"name=selectivity_error, type=DOUBLE"`   // see SelectivityError
+
+	PlanDigest     string `json:"plan_digest" parquet:"name=plan_digest, type=BYTE_ARRAY, convertedtype=UTF8, encoding=PLAIN_DICTIONARY"`           // see PlanDigest
+	StmtDigest     string `json:"stmt_digest" parquet:"name=stmt_digest, type=BYTE_ARRAY, convertedtype=UTF8, encoding=PLAIN_DICTIONARY"`           // see StmtSummaryOpt
+	StmtPlanDigest string `json:"stmt_plan_digest" parquet:"name=stmt_plan_digest, type=BYTE_ARRAY, convertedtype=UTF8, encoding=PLAIN_DICTIONARY"` // see StmtSummaryOpt
+	ExplainRef     string `json:"explain_ref" parquet:"name=explain_ref, type=BYTE_ARRAY, convertedtype=UTF8, encoding=PLAIN_DICTIONARY"`           // see ExplainArchiveOpt
+}
+
+var rawResultCSVHeader = []string{"instance", "dataset", "query_type", "sql", "est_card", "true_card", "p_error", "plan_ms", "labels", "table_rows", "selectivity_error", "plan_digest", "stmt_digest", "stmt_plan_digest", "explain_ref"}
+
+var exporterMap = map[string]func(path string, rs []RawResult) error{ // read-only
+	"csv":     exportRawResultsAsCSV,
+	"parquet": exportRawResultsAsParquet,
+	"json":    exportRawResultsAsJSON,
+	"bin":     exportRawResultsAsBinary,
+}
+
+func checkExportFormats(formats []string) error {
+	for _, f := range formats {
+		if _, ok := exporterMap[strings.ToLower(f)]; !ok {
+			return errors.Errorf("unknown export-format=%v", f)
+		}
+	}
+	return nil
+}
+
+// CollectRawResults flattens all results in this collector.
+func CollectRawResults(opt Option, collector EstResultCollector) []RawResult {
+	var rs []RawResult
+	for insIdx, ins := range opt.Instances {
+		for dsIdx, ds := range opt.Datasets {
+			for qtIdx, qt := range opt.QueryTypes {
+				for _, r := range collector.EstResults(insIdx, dsIdx, qtIdx) {
+					rs = append(rs, RawResult{
+						Instance:  ins.Label,
+						Dataset:   ds.Label,
+						QueryType: qt.String(),
+						SQL:       opt.reportSQL(r.SQL),
+						EstCard:   r.EstCard,
+						TrueCard:  r.TrueCard,
+						PError:    PError(r),
+						PlanMS:    r.PlanLatency.Seconds() * 1000,
+						Labels:    r.LabelText(),
+						TableRows: r.TableRows,
+						SelError:  SelectivityError(r),
+
+						PlanDigest:     r.PlanDigest,
+						StmtDigest:     r.StmtDigest,
+						StmtPlanDigest: r.StmtPlanDigest,
+						ExplainRef:     r.ExplainRef,
+					})
+				}
+			}
+		}
+	}
+	return rs
+}
+
+// ExportRawResults writes all raw results into ReportDir with every format in ExportFormats.
+func ExportRawResults(opt Option, collector EstResultCollector) error {
+	if len(opt.ExportFormats) == 0 {
+		return nil
+	}
+	if err := os.MkdirAll(opt.ReportDir, 0755); err != nil {
+		return errors.Trace(err)
+	}
+	rs := CollectRawResults(opt, collector)
+	for _, f := range opt.ExportFormats {
+		f = strings.ToLower(f)
+		p := path.Join(opt.ReportDir, "results."+f)
+		if err := exporterMap[f](p, rs); err != nil {
+			return fmt.Errorf("export results to %v, err=%v", p, err)
+		}
+	}
+	return nil
+}
+
+// ExportPlanSamples writes plans of all sampled cases into plan_samples.csv in ReportDir.
+func ExportPlanSamples(opt Option, collector EstResultCollector) error {
+	var records [][]string
+	for insIdx, ins := range opt.Instances {
+		for dsIdx, ds := range opt.Datasets {
+			for qtIdx, qt := range opt.QueryTypes {
+				for _, r := range collector.EstResults(insIdx, dsIdx, qtIdx) {
+					if r.Plan != "" {
+						records = append(records, []string{ins.Label, ds.Label, qt.String(), opt.reportSQL(r.SQL), opt.reportSQL(r.Plan)})
+					}
+				}
+			}
+		}
+	}
+	if len(records) == 0 {
+		return nil
+	}
+	if err := os.MkdirAll(opt.ReportDir, 0755); err != nil {
+		return errors.Trace(err)
+	}
+	f, err := os.Create(path.Join(opt.ReportDir, "plan_samples.csv"))
+	if err != nil {
+		return errors.Trace(err)
+	}
+	defer f.Close()
+	w := csv.NewWriter(f)
+	if err := w.Write([]string{"instance", "dataset", "query_type", "sql", "plan"}); err != nil {
+		return errors.Trace(err)
+	}
+	if err := w.WriteAll(records); err != nil {
+		return errors.Trace(err)
+	}
+	return errors.Trace(f.Close())
+}
+
+func exportRawResultsAsCSV(p string, rs []RawResult) error {
+	f, err := os.Create(p)
+	if err != nil {
+		return errors.Trace(err)
+	}
+	defer f.Close()
+	w := csv.NewWriter(f)
+	if err := w.Write(rawResultCSVHeader); err != nil {
+		return errors.Trace(err)
+	}
+	for _, r := range rs {
+		if err := w.Write([]string{r.Instance, r.Dataset, r.QueryType, r.SQL,
+			strconv.FormatFloat(r.EstCard, 'f', -1, 64),
+			strconv.FormatFloat(r.TrueCard, 'f', -1, 64),
+			strconv.FormatFloat(r.PError, 'f', -1, 64),
+			strconv.FormatFloat(r.PlanMS, 'f', -1, 64),
+			r.Labels,
+			strconv.FormatFloat(r.TableRows, 'f', -1, 64),
+			strconv.FormatFloat(r.SelError, 'f', -1, 64),
+			r.PlanDigest, r.StmtDigest, r.StmtPlanDigest, r.ExplainRef}); err != nil {
+			return errors.Trace(err)
+		}
+	}
+	w.Flush()
+	if err := w.Error(); err != nil {
+		return errors.Trace(err)
+	}
+	return errors.Trace(f.Close())
+}
+
+func exportRawResultsAsParquet(p string, rs []RawResult) error {
+	f, err := os.Create(p)
+	if err != nil {
+		return errors.Trace(err)
+	}
+	defer f.Close()
+	pw, err := writer.NewParquetWriterFromWriter(f, new(RawResult), 4)
+	if err != nil {
+		return errors.Trace(err)
+	}
+	pw.CompressionType = parquet.CompressionCodec_SNAPPY
+	for _, r := range rs {
+		if err := pw.Write(r); err != nil {
+			return errors.Trace(err)
+		}
+	}
+	if err := pw.WriteStop(); err != nil {
+		return errors.Trace(err)
+	}
+	return errors.Trace(f.Close())
+}
+
+// exportRawResultsAsJSON writes results as JSON lines, one result per line, so huge files can be streamed.
+func exportRawResultsAsJSON(p string, rs []RawResult) error {
+	f, err := os.Create(p)
+	if err != nil {
+		return errors.Trace(err)
+	}
+	defer f.Close()
+	w := bufio.NewWriter(f)
+	enc := json.NewEncoder(w)
+	for _, r := range rs {
+		if err := enc.Encode(r); err != nil {
+			return errors.Trace(err)
+		}
+	}
+	if err := w.Flush(); err != nil {
+		return errors.Trace(err)
+	}
+	return errors.Trace(f.Close())
+}
@@ -0,0 +1,195 @@
+package cetest
+
+import (
+	"bufio"
+	"compress/gzip"
+	"encoding/binary"
+	"io"
+	"math"
+	"os"
+	"path"
+	"strings"
+
+	"github.com/pingcap/errors"
+)
+
+// Raw results in the binary format are a gzip stream of a header and records, which is much more compact than CSV
+// for runs with millions of cases:
+//
+//	header: magic "CERB" and a version byte
+//	record: instance, dataset, query type, labels, plan digest, statement digest, statement plan digest and explain
+//	        ref as dictionary strings, the SQL as a string, and 6 float64s
+//
+// Strings are uvarint lengths followed by their bytes. Dictionary strings are uvarint indexes of strings seen before
+// in the same field, followed by a new string if the index is the number of seen strings, so repeated values cost
+// a byte. Floats are 8 bytes in little endian, in the order of est_card, true_card, p_error, plan_ms, table_rows and
+// selectivity_error. Records of version 1 have no digests, and records of version 2 have no explain refs.
+const (
+	rawResultBinMagic   = "CERB"
+	rawResultBinVersion = 3
+)
+
+// rawResultBinDicts returns numbers of dictionary strings of records of this version.
+func rawResultBinDicts(version byte) int {
+	switch version {
+	case 1:
+		return 4
+	case 2:
+		return 7
+	}
+	return 8
+}
+
+func exportRawResultsAsBinary(p string, rs []RawResult) error {
+	f, err := os.Create(p)
+	if err != nil {
+		return errors.Trace(err)
+	}
+	defer f.Close()
+	zw := gzip.NewWriter(f)
+	w := bufio.NewWriter(zw)
+	if _, err := w.WriteString(rawResultBinMagic); err != nil {
+		return errors.Trace(err)
+	}
+	if err := w.WriteByte(rawResultBinVersion); err != nil {
+		return errors.Trace(err)
+	}
+	dicts := make([]map[string]uint64, rawResultBinDicts(rawResultBinVersion)) // instance, dataset, query type, labels, digests and explain refs
+	for i := range dicts {
+		dicts[i] = make(map[string]uint64)
+	}
+	buf := make([]byte, binary.MaxVarintLen64)
+	writeUvarint := func(v uint64) error {
+		_, err := w.Write(buf[:binary.PutUvarint(buf, v)])
+		return err
+	}
+	writeString := func(s string) error {
+		if err := writeUvarint(uint64(len(s))); err != nil {
+			return err
+		}
+		_, err := w.WriteString(s)
+		return err
+	}
+	for _, r := range rs {
+		for i, s := range []string{r.Instance, r.Dataset, r.QueryType, r.Labels, r.PlanDigest, r.StmtDigest, r.StmtPlanDigest, r.ExplainRef} {
+			idx, ok := dicts[i][s]
+			if !ok {
+				idx = uint64(len(dicts[i]))
+				dicts[i][s] = idx
+			}
+			if err := writeUvarint(idx); err != nil {
+				return errors.Trace(err)
+			}
+			if !ok {
+				if err := writeString(s); err != nil {
+					return errors.Trace(err)
+				}
+			}
+		}
+		if err := writeString(r.SQL); err != nil {
+			return errors.Trace(err)
+		}
+		for _, v := range []float64{r.EstCard, r.TrueCard, r.PError, r.PlanMS, r.TableRows, r.SelError} {
+			binary.LittleEndian.PutUint64(buf, math.Float64bits(v))
+			if _, err := w.Write(buf[:8]); err != nil {
+				return errors.Trace(err)
+			}
+		}
+	}
+	if err := w.Flush(); err != nil {
+		return errors.Trace(err)
+	}
+	if err := zw.Close(); err != nil {
+		return errors.Trace(err)
+	}
+	return errors.Trace(f.Close())
+}
+
+// ReadRawResults reads raw results exported in the binary format.
+func ReadRawResults(p string) ([]RawResult, error) {
+	f, err := os.Open(p)
+	if err != nil {
+		return nil, errors.Trace(err)
+	}
+	defer f.Close()
+	zr, err := gzip.NewReader(f)
+	if err != nil {
+		return nil, errors.Errorf("invalid binary results %v, err=%v", p, err)
+	}
+	r := bufio.NewReader(zr)
+	header := make([]byte, len(rawResultBinMagic)+1)
+	if _, err := io.ReadFull(r, header); err != nil || string(header[:len(rawResultBinMagic)]) != rawResultBinMagic {
+		return nil, errors.Errorf("invalid binary results %v, no magic header", p)
+	}
+	version := header[len(header)-1]
+	if version < 1 || version > rawResultBinVersion {
+		return nil, errors.Errorf("unsupported version %v of binary results %v", version, p)
+	}
+	readString := func() (string, error) {
+		n, err := binary.ReadUvarint(r)
+		if err != nil {
+			return "", err
+		}
+		b := make([]byte, n)
+		_, err = io.ReadFull(r, b)
+		return string(b), err
+	}
+	dicts := make([][]string, rawResultBinDicts(version))
+	var rs []RawResult
+	buf := make([]byte, 8)
+	for {
+		fields := make([]string, len(dicts))
+		for i := range dicts {
+			idx, err := binary.ReadUvarint(r)
+			if err == io.EOF && i == 0 {
+				return rs, nil
+			} else if err != nil {
+				return nil, errors.Errorf("truncated binary results %v, err=%v", p, err)
+			}
+			switch {
+			case idx < uint64(len(dicts[i])):
+				fields[i] = dicts[i][idx]
+			case idx == uint64(len(dicts[i])):
+				if fields[i], err = readString(); err != nil {
+					return nil, errors.Errorf("truncated binary results %v, err=%v", p, err)
+				}
+				dicts[i] = append(dicts[i], fields[i])
+			default:
+				return nil, errors.Errorf("corrupted binary results %v, unknown string %v", p, idx)
+			}
+		}
+		rr := RawResult{Instance: fields[0], Dataset: fields[1], QueryType: fields[2], Labels: fields[3]}
+		if len(fields) > 4 {
+			rr.PlanDigest, rr.StmtDigest, rr.StmtPlanDigest = fields[4], fields[5], fields[6]
+		}
+		if len(fields) > 7 {
+			rr.ExplainRef = fields[7]
+		}
+		var err error
+		if rr.SQL, err = readString(); err != nil {
+			return nil, errors.Errorf("truncated binary results %v, err=%v", p, err)
+		}
+		for _, v := range []*float64{&rr.EstCard, &rr.TrueCard, &rr.PError, &rr.PlanMS, &rr.TableRows, &rr.SelError} {
+			if _, err := io.ReadFull(r, buf); err != nil {
+				return nil, errors.Errorf("truncated binary results %v, err=%v", p, err)
+			}
+			*v = math.Float64frombits(binary.LittleEndian.Uint64(buf))
+		}
+		rs = append(rs, rr)
+	}
+}
+
+// ConvertRawResults converts raw results in the binary format into another export format decided by the extension
+// of dst, like "results.csv" or "results.json".
+func ConvertRawResults(src, dst string) error {
+	f := strings.TrimPrefix(strings.ToLower(path.Ext(dst)), ".")
+	export, ok := exporterMap[f]
+	if !ok {
+		return errors.Errorf("unknown format %v of %v", f, dst)
+	}
+	rs, err := ReadRawResults(src)
+	if err != nil {
+		return err
+	}
+	return export(dst, rs)
+}
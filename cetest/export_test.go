@@ -0,0 +1,143 @@
+package cetest
+
+import "fmt"
+
+// SingleColQuerier exposes condition generators of singleColQuerier to tests.
+type SingleColQuerier struct {
+	tv *singleColQuerier
+}
+
+// NewSingleColQuerier returns a querier of the column t.c, which has these distinct values with these row counts
+// and nulls NULLs, as if they were queried from an instance.
+func NewSingleColQuerier(tp DATATYPE, vals []string, cnts []int, nulls int) SingleColQuerier {
+	tv := newSingleColQuerier("db", []string{"t"}, [][]string{{"c"}}, [][]DATATYPE{{tp}}, nil)
+	tv.orderedDistVals[0][0] = vals
+	tv.valActRows[0][0] = cnts
+	tv.nullRows[0][0] = nulls
+	tv.initSortedDistVals(0, 0)
+	return SingleColQuerier{tv}
+}
+
+func (q SingleColQuerier) PointCond(rowIdx int) (string, int) {
+	c, act, _ := q.tv.pointCond(0, 0, rowIdx)
+	return c, act
+}
+
+func (q SingleColQuerier) NullRangeCond() (string, int) {
+	c, act, _ := q.tv.nullRangeCond(0, 0)
+	return c, act
+}
+
+func (q SingleColQuerier) RangeCond() (string, int) {
+	c, act, _ := q.tv.rangeCond(0, 0)
+	return c, act
+}
+
+func (q SingleColQuerier) LatestRangeCond() (string, int) {
+	c, act, _ := q.tv.latestRangeCond(0, 0)
+	return c, act
+}
+
+func (q SingleColQuerier) PrefixLikeCond(rowIdx int) (string, int) {
+	c, act, _ := q.tv.prefixLikeCond(0, 0, rowIdx)
+	return c, act
+}
+
+func (q SingleColQuerier) BoundaryCond(caseIdx int) (string, int) {
+	c, act, _ := q.tv.boundaryCond(0, 0, caseIdx)
+	return c, act
+}
+
+func (q SingleColQuerier) InCond(rowIdx int) (string, int) {
+	c, act, _ := q.tv.inCond(0, 0, rowIdx)
+	return c, act
+}
+
+// NumBoundaryCases is the number of cases generated by QTSingleColBoundaryQueryOnCol.
+var NumBoundaryCases = len(intBoundaries) * len(boundaryOps)
+
+// Query returns the query of the case rowIdx of this query type generated by the lookup of Collect, and false if the
+// query type is not supported.
+func (q SingleColQuerier) Query(qt QueryType, rowIdx int) (string, int, bool) {
+	gen, ok := singleColQueryGens[qt]
+	if !ok {
+		return "", 0, false
+	}
+	sql, act, _ := gen(q.tv, 0, 0, rowIdx)
+	return sql, act, true
+}
+
+// Tags returns tags of the case rowIdx of this query type.
+func (q SingleColQuerier) Tags(qt QueryType, rowIdx int) []string {
+	_, act, consts := singleColQueryGens[qt](q.tv, 0, 0, rowIdx)
+	return q.tv.caseTags(qt, 0, 0, rowIdx, act, consts)
+}
+
+// MulColIndexQuerier exposes condition generators of mulColIndexQuerier to tests.
+type MulColIndexQuerier struct {
+	q *mulColIndexQuerier
+}
+
+// NewMulColIndexQuerier returns a querier of the index t.idx on these columns, which has these distinct rows with
+// these row counts, as if they were queried from an instance.
+func NewMulColIndexQuerier(tps []DATATYPE, rows [][]string, cnts []int) MulColIndexQuerier {
+	cols := make([]string, len(tps))
+	for i := range cols {
+		cols[i] = fmt.Sprintf("c%v", i)
+	}
+	q := newMulColIndexQuerier("db", []string{"idx"}, []string{"t"}, [][]string{cols}, [][]DATATYPE{tps}, nil)
+	q.orderedVals[0] = rows
+	q.valRows[0] = cnts
+	q.initDistVals(0)
+	return MulColIndexQuerier{q}
+}
+
+// Case returns the condition and tags of the case rowIdx of this query type.
+func (q MulColIndexQuerier) Case(qt QueryType, rowIdx int) (string, []string) {
+	cond, _, _, tags := q.q.caseCond(qt, 0, rowIdx)
+	return cond, tags
+}
+
+// CompareVals exposes compareVals, which orders values of columns, to tests.
+var CompareVals = compareVals
+
+// StartControl starts a control endpoint on this address and returns the function stopping it.
+func StartControl(addr string) (func(), error) {
+	c := newRunControl(addr)
+	if err := c.start(Option{}, nil); err != nil {
+		return nil, err
+	}
+	return c.stop, nil
+}
+
+// PlanRisks exposes planRisks, which classifies risky choices in plans, to tests.
+var PlanRisks = planRisks
+
+// TopNMismatch exposes mismatch, which decides whether actual rows mismatch TopN counts, to tests.
+var TopNMismatch = mismatch
+
+// MatchDefaultSelectivity exposes matchDefaultSelectivity to tests.
+var MatchDefaultSelectivity = matchDefaultSelectivity
+
+// CoverageFeatures returns names of estimation features exercised by this case in order.
+func CoverageFeatures(r EstResult) []string {
+	var names []string
+	for _, f := range coverageFeatures {
+		if f.match(r) {
+			names = append(names, f.name)
+		}
+	}
+	return names
+}
+
+// IndexLookUps exposes indexLookUps to tests.
+var IndexLookUps = indexLookUps
+
+// PredicateColumns exposes predicateColumns to tests.
+var PredicateColumns = predicateColumns
+
+// ColumnStatsSuggestion exposes columnStatsSuggestion to tests.
+var ColumnStatsSuggestion = columnStatsSuggestion
+
+// CrossCheckTopN exposes crossCheckTopN to tests.
+var CrossCheckTopN = crossCheckTopN
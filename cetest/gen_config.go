@@ -0,0 +1,392 @@
+package cetest
+
+import (
+	"bytes"
+	"fmt"
+	"strings"
+
+	"github.com/pingcap/errors"
+)
+
+const genConfigHeader = `# Example config of cetest, generated by gen-config.
+# Lines starting with "# " are optional settings with their default values or examples.
+
+# query types to test, run "list" to see all of them with example SQLs
+query-types = [%v]
+
+# directory of report.md, charts and exported results
+report-dir = "./report"
+
+# number of cases of each query type on each dataset, all possible cases are tested if it's 0
+n-samples = 1000
+
+# tables to analyze before testing, like ["test.tint"]
+# analyze-tables = []
+
+# reject all SQLs that may modify data, useful on shared clusters
+# read-only = false
+
+# resource group and low priority of all instances, to isolate tests from other tenants
+# resource-group = ""
+# low-priority = false
+
+# comments and hints added into all statements of all instances, so load of the tester can be attributed and filtered
+# in slow logs and STATEMENTS_SUMMARY, "{run}" is replaced by the ID of the run and "{instance}" by the label
+# query-prefix = "/* optimizertester run={run} ins={instance} */"
+# query-suffix = ""
+# query-hints = []
+
+# hash literals and identifiers of SQLs in reports
+# anonymize = false
+# anonymize-salt = ""
+
+# formats to export raw results into report-dir, "csv", "parquet", "json" or compressed binary "bin" for huge runs
+# export-formats = ["csv"]
+
+# report latencies of the optimizer, together with errors in a chart of each cell
+# collect-plan-latency = false
+
+# only cases with any of these tags are tested: mcv, null, out-of-range or empty
+# tags = []
+
+# minimum versions of instances required by query types
+# min-versions = { "cross-db-join-query" = "v4.0.0" }
+
+# capture triage bundles of cases whose latencies of EXPLAIN exceed this
+# slow-threshold = "500ms"
+
+# interval of progress prints, a number of cases or a duration
+# progress-interval = "5000"
+
+# number of cases running in parallel on each instance, and on all instances (0 is unlimited)
+# concurrency = 64
+# max-total-connections = 0
+
+# fraction of cases whose full plans are kept into plan_samples.csv
+# plan-sample-rate = 0.0
+
+# number of cases of each cell with identical plans on all instances to execute and compare
+# exec-time-cases = 0
+
+# number of the worst cases of each cell whose estimations are traced by TRACE PLAN, to find mis-estimating rules
+# optimizer-trace-cases = 0
+
+# check generated cases lexically before executing them, malformed ones are skipped and reported per dataset
+# lint = false
+
+# how cases are measured, "explain", "explain-analyze", "trace" or "count-verify"
+# executor = "explain"
+
+# pin data read by executed cases to a snapshot by tidb_snapshot, so true cardinalities are identical during the whole
+# run even if data is being written, "now" for the snapshot when the run starts, a TSO or a time like "2024-01-01 10:00:00"
+# snapshot = "now"
+
+# show a live dashboard in the terminal instead of progress prints
+# dashboard = false
+
+# local endpoint to control the running test without killing it, a loopback address or "unix:<path>", like
+# "curl -X POST 127.0.0.1:9090/pause", also /resume, /concurrency?n=8, /report into report-dir/partial and /status
+# control = "127.0.0.1:9090"
+
+# lock statistics of tables used by datasets by LOCK STATS during the run and unlock them afterwards, so all
+# instances keep constant statistics, it requires v6.5.0 or later and tables are locked after analyze-tables
+# lock-stats = false
+
+# check freshness of statistics before running, stale tables are warned, failed or analyzed
+# [stats-check]
+# min-healthy = 80
+# action = "warn"
+
+# cross-check true cardinalities of point cases against counts of TopN entries in statistics after the run
+# [topn-check]
+# enabled = true
+# tolerance = 0.0
+
+# detect statistics of tables changing during the run, mostly by auto-analyze, and "warn", "pause" cases until
+# they're stable or "lock" them by LOCK STATS until the end of the run
+# [stats-monitor]
+# action = "warn"
+# interval = "10s"
+
+# write tables used by datasets in the background during the run to measure estimations under churn, which requires
+# an executor measuring true cardinalities and scratch databases of all datasets, since only clones are written, and
+# cases are compared against true cardinalities measured under the load
+# [write-load]
+# inserts = 100
+# updates = 100
+# tables = ["scratch_db.tb"]
+
+# execute join cases of each cell with the join order chosen by the optimizer and alternatives forced by LEADING,
+# and score how close chosen orders are to the best ones found
+# [join-order]
+# cases = 10
+# max-orders = 6
+# repeats = 1
+
+# explain cases of each cell again some time after they're run, and tag those whose estimations changed
+# [estimate-recheck]
+# enabled = true
+# interval = "3s"
+
+# formats and sizes of charts, which are rendered without external tools
+# [charts]
+# formats = ["png", "svg"]
+# dpi = 96
+# scale = 1.0
+
+# Go templates replacing sections of report.md, see ReportTemplateOpt for their data
+# [report-templates]
+# header = "./templates/header.tmpl"
+# cell = "./templates/cell.tmpl"
+# footer = "./templates/footer.tmpl"
+
+# reports to generate, "markdown", "charts", "json", "junit" or "html", only "markdown" if empty
+# reporters = ["markdown", "junit"]
+
+# a cell fails on an instance in the junit report if P90 of its absolute PErrors exceeds this
+# [junit]
+# max-p90 = 1.0
+
+# order of instances, datasets and query types in reports, listed ones come first and the others are sorted
+# [report-order]
+# instances = ["v7.5.0"]
+# datasets = ["zipfx"]
+# query-types = ["single-col-point-query-on-col"]
+
+# formats of row counts and selectivities in reports, raw float prints are used if it's empty
+# [number-format]
+# locale = "en"
+# thousands-separator = ","
+# scientific = true
+# significant-digits = 3
+
+# keep summaries of runs in a shared directory and draw error trends across them into trend.md,
+# report.md shows changes of the effective configuration since the previous run
+# [history]
+# dir = "./history"
+# x-axis = "date"
+
+# the failing cell used by the bisect command, instances must be builds ordered from the good one to the bad one
+# [bisect]
+# dataset = "zipfx"
+# query-type = "single-col-point-query-on-col"
+# threshold = 1.0
+# n-samples = 200
+
+# draft GitHub issues for the worst cases into report-dir/issues, and post them if a token is provided unless an open
+# issue already has the marker of the same query type, dataset and operator
+# [issues]
+# min-p-error = 10.0
+# max-issues = 10
+# repo = "pingcap/tidb"
+# token = ""
+# labels = ["type/bug", "sig/planner"]
+
+# export cases of each dataset as versioned corpora after the run, or run loaded corpora instead of generating cases
+# [corpus]
+# export = "./corpus"
+# load = ["./corpus/zipfx.corpus.json"]
+# ignore-fingerprint = false
+
+# send report.md by email after the run
+# [email]
+# addr = "smtp.example.com:587"
+# user = ""
+# password = ""
+# from = "cetest@example.com"
+# to = ["team@example.com"]
+# attach-charts = true
+
+# resource limits of cases which are actually executed
+# [guard]
+# max-execution-time = "10s"
+# mem-quota-mb = 1024
+# max-scan-rows = 10000000.0
+
+# stop generating cases of a cell once the confidence interval of its mean absolute PError is within this precision,
+# and spend a fraction of cases on a biased pass toward regions of values with high errors
+# [adaptive]
+# precision = 0.1
+# confidence = 0.95
+# min-cases = 30
+# importance = 0.3
+# regions = 10
+
+# estimate the run time of n-samples by calibration cases of each cell before the run, and ask for confirmation
+# [preflight]
+# samples = 20
+# confirm = false
+
+# memory limit of collected results, cells not accessed recently are spilled to disk beyond it
+# [collector]
+# memory-limit-mb = 4096
+# spill-dir = "/tmp"
+
+# total resource limits of executed cases on each instance during a run, remaining cases are only explained after it
+# [budget]
+# max-scan-rows = 1000000000.0
+# max-exec-time = "1h"
+
+# run the test once for each combination of values of these global variables, reports of runs are in sub-directories
+# [[matrix]]
+# name = "analyze-version"
+# variable = "tidb_analyze_version"
+# values = ["1", "2"]
+
+# Kubernetes Jobs generated by "optimizer-tester distribute", each of which runs the test on one instance,
+# and reports of all of them are merged by "optimizer-tester merge-shards" into report-dir of the volume,
+# configs are kept in a Secret, and emails, issues and history are done by the merge job instead of shards
+# [distribute]
+# name = "optimizer-tester"
+# namespace = "default"
+# image = ""
+# volume = ""
+# report-dir = "/report"
+
+# candidate indexes evaluated by re-estimating cases reading their tables, by hypothetical indexes (v7.3+)
+# or real ones on copies of tables in scratch databases "<db>_whatif"
+# [[what-if-indexes]]
+# db = "zipfx"
+# table = "tint"
+# columns = ["a", "b"]
+# mode = "hypo"
+
+# try candidate statistics remediations of the worst-estimated columns of each dataset on copies of their tables
+# in databases "<db>_remedy", candidates are "buckets", "topn", "sample-rate" and "extended-stats"
+# [remediation]
+# columns = 3
+# min-perror = 1.0
+# candidates = ["buckets", "topn", "sample-rate", "extended-stats"]
+
+# cross-reference cases against STATEMENTS_SUMMARY tables of each instance after the run, so results can be joined
+# with server-side telemetry by digests of statements and plans, which are exported with raw results
+# [statements-summary]
+# enabled = true
+# cluster = false
+
+# archive raw outputs of EXPLAIN or EXPLAIN ANALYZE of all cases, deduplicated and compressed, in a content-addressed
+# store referenced by explain_ref of exported raw results, which can be shared by runs, see "optimizer-tester show-explain"
+# [explain-archive]
+# enabled = true
+# dir = "./report/explains"
+
+# measure round-trip time of each instance before running cases, and scale its concurrency by P50 RTT / base-rtt,
+# so remote clusters with high RTT keep the throughput, RTT and concurrency of instances are shown in reports
+# [latency-aware]
+# enabled = true
+# probes = 10
+# base-rtt = "1ms"
+# max-concurrency = 256
+
+# re-run the worst cases of a previous run instead of generating new cases
+# [rerun]
+# path = "./report/results.csv"
+# worst = 0.05
+# max-p-error = 0.0
+# ignore-error = false
+
+# results of external engines to compare with
+# [[imports]]
+# path = "./postgres.csv"
+# dataset = "zipf"
+# query-type = "single-col-point-query-on-col"
+`
+
+const genConfigDataset = `
+[[datasets]]
+name = "%v"
+db = "%v"
+label = "%v"
+# other databases with the same schema, used by cross-db-join-query
+# dbs = []
+# arguments of the dataset: "analyze", "error" or "type=xxx"
+# args = []
+# subset of tables and columns to test, all tables are tested if empty
+# tables = [{ name = "t", columns = ["a", "b"] }]
+# number of queries of each query type verified by EXPLAIN ANALYZE if the dataset provides true cardinalities
+# truth-check = 0
+# minimum number of rows of each table used by the dataset
+# min-rows = 1
+# tags = []
+# SQLs executed before and after cases of this dataset on each instance
+# setup = ["CREATE INDEX idx_tmp ON t(b)"]
+# teardown = ["DROP INDEX idx_tmp ON t"]
+# run cases on a clone of db with sampled rows in a scratch database, which must not exist before the run and is
+# dropped after the run unless kept
+# scratch = { db = "scratch", sample-rate = 0.0, keep = false }
+`
+
+const genConfigInstance = `
+[[instances]]
+addr = "127.0.0.1"
+port = %v
+user = "root"
+password = ""
+label = "ins%v"
+# format of EXPLAIN statements, like "brief"
+# explain-format = ""
+# read-only = false
+# resource-group = ""
+# low-priority = false
+# comments and hints of this instance's statements, overriding the default ones
+# query-prefix = ""
+# query-suffix = ""
+# query-hints = ["MAX_EXECUTION_TIME(10000)"]
+# read TiFlash replicas by MPP only, to record broadcast and shuffle joins
+# mpp = false
+# override the detected version, useful for forks
+# version = ""
+# number of connections probed to check whether they land on the same server behind load balancers
+# sticky-check = 0
+# server = ""
+# endpoints of clusters identical to this one, cases are sharded across all of them and results are merged
+# replicas = ["127.0.0.2:4000"]
+# encrypt connections, "true", "skip-verify", "preferred" or the path of a CA file
+# tls = ""
+# extra parameters of connections, like session variables or tokens required by cloud endpoints
+# params = {}
+# TiDB Cloud Serverless endpoint, whose addr can contain the port like "gateway01.us-west-2.prod.aws.tidbcloud.com:4000",
+# connections are encrypted and statements unsupported there like SET GLOBAL are rejected
+# serverless = false
+# freeform descriptions shown in reports
+# metadata = { git-sha = "", cluster-size = "" }
+`
+
+// GenConfig generates a commented example config with these datasets and the number of instances.
+// Query types supported by all these datasets are tested.
+func GenConfig(datasets []string, nInstances int) (string, error) {
+	if nInstances <= 0 {
+		return "", errors.Errorf("invalid number of instances %v", nInstances)
+	}
+	infos := make(map[string]DatasetInfo)
+	for _, info := range ListDatasets() {
+		infos[info.Name] = info
+	}
+	supported := make(map[QueryType]int)
+	for _, name := range datasets {
+		info, ok := infos[strings.ToLower(name)]
+		if !ok {
+			return "", errors.Errorf("unknown dataset=%v", name)
+		}
+		for _, qt := range info.QueryTypes {
+			supported[qt]++
+		}
+	}
+	var qts []string
+	for qt := QTSingleColPointQueryOnCol; qt < numQueryTypes; qt++ {
+		if supported[qt] == len(datasets) {
+			qts = append(qts, fmt.Sprintf("%q", qt.String()))
+		}
+	}
+
+	var buf bytes.Buffer
+	buf.WriteString(fmt.Sprintf(genConfigHeader, strings.Join(qts, ", ")))
+	for _, name := range datasets {
+		name = strings.ToLower(name)
+		buf.WriteString(fmt.Sprintf(genConfigDataset, name, "test", name))
+	}
+	for i := 0; i < nInstances; i++ {
+		buf.WriteString(fmt.Sprintf(genConfigInstance, 4000+i, i+1))
+	}
+	return buf.String(), nil
+}
@@ -0,0 +1,83 @@
+package cetest
+
+import (
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/pingcap/errors"
+	"github.com/qw4990/OptimizerTester/tidb"
+)
+
+// GuardOpt limits resources used by each case which is actually executed, like cases checked by EXPLAIN ANALYZE,
+// to protect shared clusters from runaway queries. Cases only explained are not affected.
+type GuardOpt struct {
+	MaxExecutionTime string  `toml:"max-execution-time"` // kill cases running longer than this by the hint MAX_EXECUTION_TIME, like "10s"
+	MemQuotaMB       int     `toml:"mem-quota-mb"`       // memory quota of each case by the hint MEMORY_QUOTA, like tidb_mem_quota_query
+	MaxScanRows      float64 `toml:"max-scan-rows"`      // skip cases whose scan operators are estimated to read more rows than this
+
+	maxExecTime time.Duration
+}
+
+// errGuardRejected is returned when a case is rejected by max-scan-rows.
+var errGuardRejected = errors.New("rejected by the max-scan-rows guard")
+
+func (g *GuardOpt) check() error {
+	if g.MaxExecutionTime != "" {
+		d, err := time.ParseDuration(g.MaxExecutionTime)
+		if err != nil || d < time.Millisecond {
+			return errors.Errorf("invalid max-execution-time=%v", g.MaxExecutionTime)
+		}
+		g.maxExecTime = d
+	}
+	if g.MemQuotaMB < 0 || g.MaxScanRows < 0 {
+		return errors.Errorf("invalid mem-quota-mb=%v or max-scan-rows=%v", g.MemQuotaMB, g.MaxScanRows)
+	}
+	return nil
+}
+
+// wrap adds hints of this guard into this SELECT statement.
+func (g GuardOpt) wrap(query string) string {
+	var hints []string
+	if g.maxExecTime > 0 {
+		hints = append(hints, fmt.Sprintf("MAX_EXECUTION_TIME(%v)", g.maxExecTime.Milliseconds()))
+	}
+	if g.MemQuotaMB > 0 {
+		hints = append(hints, fmt.Sprintf("MEMORY_QUOTA(%v MB)", g.MemQuotaMB))
+	}
+	return tidb.AddHints(query, hints...)
+}
+
+// admit returns errGuardRejected if any scan operator of this query is estimated to read more rows than MaxScanRows.
+func (g GuardOpt) admit(ins tidb.Instance, query string) error {
+	if g.MaxScanRows <= 0 {
+		return nil
+	}
+	header, results, err := queryExplain(ins, "EXPLAIN", query)
+	if err != nil {
+		return err
+	}
+	ops, err := ParseExplainAnalyze(header, results)
+	if err != nil {
+		return err
+	}
+	for _, op := range ops {
+		if strings.Contains(op.ID, "Scan") && op.EstRows > g.MaxScanRows {
+			return errors.Annotatef(errGuardRejected, "%v is estimated to scan %v rows", op.ID, op.EstRows)
+		}
+	}
+	return nil
+}
+
+// executeWithGuard runs this query with EXPLAIN ANALYZE if it's admitted by this guard.
+func executeWithGuard(ins tidb.Instance, query string, g GuardOpt) (EstResult, error) {
+	if err := g.admit(ins, query); err != nil {
+		return EstResult{}, err
+	}
+	return getEstResultFromExplainAnalyze(ins, g.wrap(query))
+}
+
+// rejectedByGuard returns whether this error is returned because the case is rejected by a guard.
+func rejectedByGuard(err error) bool {
+	return errors.Cause(err) == errGuardRejected
+}
@@ -0,0 +1,253 @@
+package cetest
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"math"
+	"os"
+	"path"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/pingcap/errors"
+	"gonum.org/v1/plot"
+	"gonum.org/v1/plot/plotter"
+	"gonum.org/v1/plot/plotutil"
+	"gonum.org/v1/plot/vg"
+)
+
+// HistoryOpt keeps summaries of all runs in a directory, which are used to draw error trends across runs.
+type HistoryOpt struct {
+	Dir   string `toml:"dir"`    // directory of summaries of all runs, shared by all runs to compare
+	XAxis string `toml:"x-axis"` // "date" or "commit", x-axis of trend charts, "date" if empty
+}
+
+// RunSummary is the summary of a run kept in the history directory.
+type RunSummary struct {
+	Time      time.Time         `json:"time"`
+	Instances []InstanceSummary `json:"instances"`
+	Cells     []CellSummary     `json:"cells"`
+	Config    map[string]string `json:"config,omitempty"` // effective configuration of the run, absent in old summaries
+}
+
+// InstanceSummary describes an instance of a run.
+type InstanceSummary struct {
+	Label   string `json:"label"`
+	Version string `json:"version"`
+	Commit  string `json:"commit"`
+}
+
+// CellSummary contains statistics of absolute PErrors of a cell of a run.
+type CellSummary struct {
+	Instance  string  `json:"instance"`
+	Dataset   string  `json:"dataset"`
+	QueryType string  `json:"query_type"`
+	Total     int     `json:"total"`
+	P50       float64 `json:"p50"`
+	P90       float64 `json:"p90"`
+	P99       float64 `json:"p99,omitempty"` // absent in old summaries
+	Max       float64 `json:"max,omitempty"` // absent in old summaries
+}
+
+// summarizeCell returns statistics of absolute PErrors of these results of a cell, and false if there are none.
+func summarizeCell(ins, ds, qt string, rs []EstResult) (CellSummary, bool) {
+	if len(rs) == 0 {
+		return CellSummary{}, false
+	}
+	pes := make([]float64, len(rs))
+	for i := range rs {
+		pes[i] = math.Abs(PError(rs[i]))
+	}
+	sort.Float64s(pes)
+	n := len(pes)
+	return CellSummary{Instance: ins, Dataset: ds, QueryType: qt, Total: n,
+		P50: pes[n/2], P90: pes[(n*9)/10], P99: pes[(n*99)/100], Max: pes[n-1]}, true
+}
+
+func (ho HistoryOpt) check() error {
+	switch strings.ToLower(ho.XAxis) {
+	case "", "date", "commit":
+		return nil
+	}
+	return errors.Errorf("invalid history x-axis=%v", ho.XAxis)
+}
+
+// RecordRunHistory writes the summary of this run into the history directory.
+func RecordRunHistory(opt Option, collector EstResultCollector, at time.Time) error {
+	if opt.History.Dir == "" {
+		return nil
+	}
+	summary := RunSummary{Time: at, Config: effectiveConfig(opt)}
+	for insIdx, ins := range opt.Instances {
+		is := InstanceSummary{Label: ins.Label}
+		if insIdx < len(opt.insVersions) {
+			is.Version = opt.insVersions[insIdx]
+		}
+		if insIdx < len(opt.insCommits) {
+			is.Commit = opt.insCommits[insIdx]
+		}
+		summary.Instances = append(summary.Instances, is)
+		for dsIdx, ds := range opt.Datasets {
+			for qtIdx, qt := range opt.QueryTypes {
+				if cs, ok := summarizeCell(ins.Label, ds.Label, qt.String(), collector.EstResults(insIdx, dsIdx, qtIdx)); ok {
+					summary.Cells = append(summary.Cells, cs)
+				}
+			}
+		}
+	}
+	content, err := json.MarshalIndent(summary, "", "  ")
+	if err != nil {
+		return errors.Trace(err)
+	}
+	if err := os.MkdirAll(opt.History.Dir, 0755); err != nil {
+		return errors.Trace(err)
+	}
+	return errors.Trace(ioutil.WriteFile(path.Join(opt.History.Dir, fmt.Sprintf("run-%v.json", at.UTC().Format("20060102-150405.000"))), content, 0666))
+}
+
+// readRunHistory reads summaries of all runs in this directory ordered by their time.
+func readRunHistory(dir string) ([]RunSummary, error) {
+	files, err := ioutil.ReadDir(dir)
+	if err != nil {
+		return nil, errors.Trace(err)
+	}
+	var runs []RunSummary
+	for _, f := range files {
+		if f.IsDir() || !strings.HasPrefix(f.Name(), "run-") || path.Ext(f.Name()) != ".json" {
+			continue
+		}
+		content, err := ioutil.ReadFile(path.Join(dir, f.Name()))
+		if err != nil {
+			return nil, errors.Trace(err)
+		}
+		var run RunSummary
+		if err := json.Unmarshal(content, &run); err != nil {
+			return nil, errors.Errorf("invalid run summary %v, err=%v", f.Name(), err)
+		}
+		runs = append(runs, run)
+	}
+	sort.SliceStable(runs, func(i, j int) bool { return runs[i].Time.Before(runs[j].Time) })
+	return runs, nil
+}
+
+// runAxisLabel returns the label of this run on x-axes, which is its date or distinct commits of its instances.
+func runAxisLabel(run RunSummary, xAxis string) string {
+	if strings.ToLower(xAxis) != "commit" {
+		return run.Time.Local().Format("2006-01-02 15:04")
+	}
+	var commits []string
+	seen := make(map[string]bool)
+	for _, ins := range run.Instances {
+		c := ins.Commit
+		if len(c) > 7 {
+			c = c[:7]
+		}
+		if c != "" && !seen[c] {
+			seen[c] = true
+			commits = append(commits, c)
+		}
+	}
+	if len(commits) == 0 {
+		return "unknown"
+	}
+	return strings.Join(commits, "/")
+}
+
+// GenTrendReport draws p50 and p90 of absolute PErrors of each dataset and query type across all runs in the
+// history directory, and writes these charts into trend.md in ReportDir.
+func GenTrendReport(opt Option) error {
+	if opt.History.Dir == "" {
+		return nil
+	}
+	runs, err := readRunHistory(opt.History.Dir)
+	if err != nil {
+		return err
+	}
+	if err := os.MkdirAll(opt.ReportDir, 0755); err != nil {
+		return errors.Trace(err)
+	}
+	xNames := make([]string, len(runs))
+	for i, run := range runs {
+		xNames[i] = runAxisLabel(run, opt.History.XAxis)
+	}
+
+	var md bytes.Buffer
+	md.WriteString(fmt.Sprintf("# Trends of %v Runs\n", len(runs)))
+	for _, qt := range opt.QueryTypes {
+		for _, ds := range opt.Datasets {
+			picPath, err := drawTrendChart(opt, runs, xNames, ds.Label, qt.String())
+			if err != nil {
+				return err
+			}
+			if picPath == "" {
+				continue
+			}
+			md.WriteString(fmt.Sprintf("\n## %v / %v\n\n![pic](%v)\n", qt, ds.Label, picPath))
+		}
+	}
+	return ioutil.WriteFile(path.Join(opt.ReportDir, "trend.md"), md.Bytes(), 0666)
+}
+
+// drawTrendChart draws a line chart of p50 and p90 of each instance of this cell, it returns "" if there are no results.
+func drawTrendChart(opt Option, runs []RunSummary, xNames []string, ds, qt string) (string, error) {
+	var instances []string
+	points := make(map[string][2]plotter.XYs) // instance, {p50, p90}
+	for i, run := range runs {
+		for _, c := range run.Cells {
+			if c.Dataset != ds || c.QueryType != qt {
+				continue
+			}
+			ps, ok := points[c.Instance]
+			if !ok {
+				instances = append(instances, c.Instance)
+			}
+			ps[0] = append(ps[0], plotter.XY{X: float64(i), Y: c.P50})
+			ps[1] = append(ps[1], plotter.XY{X: float64(i), Y: c.P90})
+			points[c.Instance] = ps
+		}
+	}
+	if len(instances) == 0 {
+		return "", nil
+	}
+	orderNames(instances, opt.ReportOrder.Instances)
+	colors := instanceColors(instances)
+
+	p, err := plot.New()
+	if err != nil {
+		return "", errors.Trace(err)
+	}
+	p.Title.Text = fmt.Sprintf("Absolute PError trend of %v on %v", qt, ds)
+	p.Y.Label.Text = "absolute PError"
+	for insIdx, ins := range instances {
+		for i, name := range []string{"p50", "p90"} {
+			l, err := plotter.NewLine(points[ins][i])
+			if err != nil {
+				return "", errors.Trace(err)
+			}
+			l.Color = colors[insIdx]
+			l.Dashes = plotutil.Dashes(i)
+			p.Add(l)
+			p.Legend.Add(fmt.Sprintf("%v %v", ins, name), l)
+		}
+	}
+	p.Legend.Top = true
+	p.NominalX(xNames...)
+
+	prefixDir := opt.ReportDir
+	if !path.IsAbs(prefixDir) {
+		absPrefix, err := os.Getwd()
+		if err != nil {
+			return "", errors.Trace(err)
+		}
+		prefixDir = path.Join(absPrefix, prefixDir)
+	}
+	chartPath, err := saveChart(opt.Charts, p, vg.Points(math.Max(300, float64(60*len(runs)))), 3*vg.Inch,
+		path.Join(prefixDir, fmt.Sprintf("%v-%v-trend", qt, ds)))
+	if err != nil {
+		return "", err
+	}
+	return path.Base(chartPath), nil
+}
@@ -0,0 +1,162 @@
+package cetest
+
+import (
+	"encoding/csv"
+	"fmt"
+	"io"
+	"os"
+	"strconv"
+	"strings"
+
+	"github.com/pingcap/errors"
+	"github.com/qw4990/OptimizerTester/tidb"
+)
+
+// ImportOpt describes a CSV file of results produced by external engines.
+// The file must have a header with columns "engine", "query", "est" and "act",
+// and optional columns "dataset" and "query_type" to override Dataset and QueryType of this option.
+type ImportOpt struct {
+	Path      string `toml:"path"`
+	Dataset   string `toml:"dataset"`    // label of the dataset these results belong to
+	QueryType string `toml:"query-type"` // query-type these results belong to
+}
+
+type importedResult struct {
+	engine string
+	dsIdx  int
+	qtIdx  int
+	r      EstResult
+}
+
+// importEstResults reads all imported results and returns them with labels of all engines in order of appearance.
+func importEstResults(opt Option) (irs []importedResult, engines []string, err error) {
+	seen := make(map[string]bool)
+	for _, imp := range opt.Imports {
+		rs, err := readImportedCSV(opt, imp)
+		if err != nil {
+			return nil, nil, fmt.Errorf("import results from %v, err=%v", imp.Path, err)
+		}
+		for _, r := range rs {
+			if !seen[r.engine] {
+				seen[r.engine] = true
+				engines = append(engines, r.engine)
+			}
+		}
+		irs = append(irs, rs...)
+	}
+	for _, e := range engines {
+		if opt.instanceIdx(e) != -1 {
+			return nil, nil, errors.Errorf("imported engine %v conflicts with an instance label", e)
+		}
+	}
+	return irs, engines, nil
+}
+
+func readImportedCSV(opt Option, imp ImportOpt) ([]importedResult, error) {
+	f, err := os.Open(imp.Path)
+	if err != nil {
+		return nil, errors.Trace(err)
+	}
+	defer f.Close()
+	r := csv.NewReader(f)
+	header, err := r.Read()
+	if err != nil {
+		return nil, errors.Trace(err)
+	}
+	colIdx := make(map[string]int, len(header))
+	for i, h := range header {
+		colIdx[strings.ToLower(strings.TrimSpace(h))] = i
+	}
+	for _, c := range []string{"engine", "query", "est", "act"} {
+		if _, ok := colIdx[c]; !ok {
+			return nil, errors.Errorf("column %v is missing", c)
+		}
+	}
+
+	var rs []importedResult
+	for line := 2; ; line++ {
+		record, err := r.Read()
+		if err == io.EOF {
+			break
+		} else if err != nil {
+			return nil, errors.Trace(err)
+		}
+		ds, qt := imp.Dataset, imp.QueryType
+		if i, ok := colIdx["dataset"]; ok && record[i] != "" {
+			ds = record[i]
+		}
+		if i, ok := colIdx["query_type"]; ok && record[i] != "" {
+			qt = record[i]
+		}
+		dsIdx, qtIdx := opt.datasetIdx(ds), opt.queryTypeIdx(qt)
+		if dsIdx == -1 || qtIdx == -1 {
+			return nil, errors.Errorf("line %v: unknown dataset=%v or query-type=%v", line, ds, qt)
+		}
+		est, err := strconv.ParseFloat(record[colIdx["est"]], 64)
+		if err != nil {
+			return nil, errors.Errorf("line %v: invalid est=%v", line, record[colIdx["est"]])
+		}
+		act, err := strconv.ParseFloat(record[colIdx["act"]], 64)
+		if err != nil {
+			return nil, errors.Errorf("line %v: invalid act=%v", line, record[colIdx["act"]])
+		}
+		rs = append(rs, importedResult{
+			engine: record[colIdx["engine"]],
+			dsIdx:  dsIdx,
+			qtIdx:  qtIdx,
+			r:      EstResult{SQL: record[colIdx["query"]], EstCard: est, TrueCard: act},
+		})
+	}
+	return rs, nil
+}
+
+// ImportEstResults appends all imported engines to opt as instances which are only used in reports,
+// and returns a collector which has already contained all imported results.
+func ImportEstResults(opt Option) (Option, EstResultCollector, error) {
+	irs, engines, err := importEstResults(opt)
+	if err != nil {
+		return opt, nil, err
+	}
+	instances := make([]tidb.Option, 0, len(opt.Instances)+len(engines))
+	instances = append(instances, opt.Instances...)
+	for _, e := range engines {
+		instances = append(instances, tidb.Option{Label: e})
+	}
+	opt.Instances = instances
+
+	collector, err := NewEstResultCollectorWithOpt(len(opt.Instances), len(opt.Datasets), len(opt.QueryTypes), opt.Collector)
+	if err != nil {
+		return opt, nil, err
+	}
+	for _, ir := range irs {
+		collector.AddEstResult(opt.instanceIdx(ir.engine), ir.dsIdx, ir.qtIdx, ir.r)
+	}
+	return opt, collector, nil
+}
+
+func (opt Option) instanceIdx(label string) int {
+	for i, ins := range opt.Instances {
+		if ins.Label == label {
+			return i
+		}
+	}
+	return -1
+}
+
+func (opt Option) datasetIdx(label string) int {
+	for i, ds := range opt.Datasets {
+		if ds.Label == label {
+			return i
+		}
+	}
+	return -1
+}
+
+func (opt Option) queryTypeIdx(name string) int {
+	for i, qt := range opt.QueryTypes {
+		if qt.String() == name {
+			return i
+		}
+	}
+	return -1
+}
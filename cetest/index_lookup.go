@@ -0,0 +1,90 @@
+package cetest
+
+import (
+	"bytes"
+	"fmt"
+	"math"
+	"sort"
+	"strings"
+)
+
+// IndexLookUpSides are estimated and actual rows of both sides of an IndexLookUp, the double-read plan which reads
+// handles from the index side and then looks them up in the table side. Errors of the index side are the most costly
+// in TiDB, since each row of it is a random read of the table.
+type IndexLookUpSides struct {
+	Operator string // ID of the IndexLookUp
+	IndexEst float64
+	IndexAct float64 // rows of the index side, which are looked up in the table
+	TableEst float64
+	TableAct float64 // rows of the table side after its filters
+	Act      float64 // rows returned by the IndexLookUp
+}
+
+// Blowup returns rows looked up in the table for each returned row, which is 1 if no looked up row is filtered.
+func (s IndexLookUpSides) Blowup() float64 {
+	return s.IndexAct / math.Max(s.Act, 1)
+}
+
+// indexLookUps returns both sides of all IndexLookUps in these operators, which requires runtime statistics.
+func indexLookUps(ops []OperatorStats) []IndexLookUpSides {
+	var sides []IndexLookUpSides
+	for i, op := range ops {
+		if !strings.HasPrefix(op.ID, "IndexLookUp") {
+			continue
+		}
+		s := IndexLookUpSides{Operator: op.ID, Act: op.ActRows}
+		build, probe := false, false
+		for _, c := range operatorChildren(ops, i) {
+			switch {
+			case strings.HasSuffix(ops[c].ID, "(Build)"):
+				s.IndexEst, s.IndexAct, build = ops[c].EstRows, ops[c].ActRows, true
+			case strings.HasSuffix(ops[c].ID, "(Probe)"):
+				s.TableEst, s.TableAct, probe = ops[c].EstRows, ops[c].ActRows, true
+			}
+		}
+		if build && probe {
+			sides = append(sides, s)
+		}
+	}
+	return sides
+}
+
+// writeIndexLookUps writes estimations of both sides of IndexLookUps of this cell and how many rows are looked up
+// for each returned row, with the case whose index side is underestimated the most. It's skipped if there is no
+// IndexLookUp with runtime statistics.
+func writeIndexLookUps(md *bytes.Buffer, opt Option, collector EstResultCollector, dsIdx, qtIdx int) {
+	header := false
+	for insIdx, ins := range opt.Instances {
+		var indexPEs, tablePEs, blowups []float64
+		worst := 0.0
+		example := "-"
+		for _, r := range collector.EstResults(insIdx, dsIdx, qtIdx) {
+			for _, s := range indexLookUps(r.Operators) {
+				indexPE := PError(EstResult{EstCard: s.IndexEst, TrueCard: s.IndexAct})
+				indexPEs = append(indexPEs, math.Abs(indexPE))
+				tablePEs = append(tablePEs, math.Abs(PError(EstResult{EstCard: s.TableEst, TrueCard: s.TableAct})))
+				blowups = append(blowups, s.Blowup())
+				if indexPE < worst {
+					worst = indexPE
+					example = fmt.Sprintf("`%v`: index side %v => %v, blowup %.1f", strings.Replace(opt.reportSQL(r.SQL), "|", "\\|", -1),
+						opt.NumberFormat.rows(s.IndexEst), opt.NumberFormat.rows(s.IndexAct), s.Blowup())
+				}
+			}
+		}
+		if len(indexPEs) == 0 {
+			continue
+		}
+		if !header {
+			md.WriteString("\nIndexLookUp Double Reads\n")
+			md.WriteString("\n| Instance | IndexLookUps | P50 Index Side | P90 Index Side | P50 Table Side | P90 Table Side | P50 Blowup | P90 Blowup | Most Underestimated |\n")
+			md.WriteString("| ---- | ---- | ---- | ---- | ---- | ---- | ---- | ---- | ---- |\n")
+			header = true
+		}
+		sort.Float64s(indexPEs)
+		sort.Float64s(tablePEs)
+		sort.Float64s(blowups)
+		n := len(indexPEs)
+		md.WriteString(fmt.Sprintf("| %v | %v | %.3f | %.3f | %.3f | %.3f | %.1f | %.1f | %v |\n", ins.Label, n,
+			indexPEs[n/2], indexPEs[(n*9)/10], tablePEs[n/2], tablePEs[(n*9)/10], blowups[n/2], blowups[(n*9)/10], example))
+	}
+}
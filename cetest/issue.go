@@ -0,0 +1,278 @@
+package cetest
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"math"
+	"net/http"
+	"net/url"
+	"os"
+	"path"
+	"regexp"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/pingcap/errors"
+	"github.com/qw4990/OptimizerTester/tidb"
+)
+
+// IssueOpt drafts GitHub issues for the worst cases, which are written into ReportDir/issues,
+// and also posted to the repository if a token is provided. Each draft carries a marker of its query type, dataset
+// and operator, and it's not posted if an open issue already has the marker, so repeated runs don't file duplicates.
+type IssueOpt struct {
+	MinPError float64  `toml:"min-p-error"` // severity threshold, cases whose absolute PErrors exceed this are drafted, disabled if 0
+	MaxIssues int      `toml:"max-issues"`  // max number of issues drafted in each run, 10 if it's 0
+	Repo      string   `toml:"repo"`        // repository to post issues to, like "pingcap/tidb"
+	Token     string   `toml:"token"`       // GitHub token to post issues, issues are only written into files if empty
+	Labels    []string `toml:"labels"`      // labels of posted issues, like ["type/bug", "sig/planner"]
+	API       string   `toml:"api"`         // GitHub API endpoint, "https://api.github.com" if empty
+}
+
+// IssueDraft is a drafted GitHub issue.
+type IssueDraft struct {
+	Title  string   `json:"title"`
+	Body   string   `json:"body"`
+	Labels []string `json:"labels,omitempty"`
+	Marker string   `json:"-"` // stable marker of the problem in the body, see issueMarker
+}
+
+func (iopt IssueOpt) check() error {
+	if iopt.MinPError < 0 || iopt.MaxIssues < 0 {
+		return errors.Errorf("invalid issues min-p-error=%v or max-issues=%v", iopt.MinPError, iopt.MaxIssues)
+	}
+	if iopt.Token != "" && len(strings.Split(iopt.Repo, "/")) != 2 {
+		return errors.Errorf("invalid issues repo=%v, which should be like pingcap/tidb", iopt.Repo)
+	}
+	return nil
+}
+
+type issueCase struct {
+	insIdx, dsIdx, qtIdx int
+	r                    EstResult
+}
+
+// fileIssues drafts issues for the worst cases whose absolute PErrors exceed MinPError, and posts them if required.
+func fileIssues(opt Option, instances []tidb.Instance, collector EstResultCollector) error {
+	iopt := opt.Issues
+	if iopt.MinPError <= 0 {
+		return nil
+	}
+	var cases []issueCase
+	for insIdx := range instances {
+		for dsIdx := range opt.Datasets {
+			for qtIdx := range opt.QueryTypes {
+				for _, r := range collector.EstResults(insIdx, dsIdx, qtIdx) {
+					if math.Abs(PError(r)) > iopt.MinPError {
+						cases = append(cases, issueCase{insIdx, dsIdx, qtIdx, r})
+					}
+				}
+			}
+		}
+	}
+	sort.SliceStable(cases, func(i, j int) bool { return math.Abs(PError(cases[i].r)) > math.Abs(PError(cases[j].r)) })
+	maxIssues := iopt.MaxIssues
+	if maxIssues == 0 {
+		maxIssues = 10
+	}
+
+	dir := path.Join(opt.ReportDir, "issues")
+	if err := os.MkdirAll(dir, 0755); err != nil {
+		return errors.Trace(err)
+	}
+	drafted := make(map[string]bool) // the same problem on different instances or by different SQLs is drafted only once
+	for _, c := range cases {
+		if len(drafted) >= maxIssues {
+			break
+		}
+		marker := issueMarker(opt, c)
+		if drafted[marker] {
+			continue
+		}
+		drafted[marker] = true
+		draft := draftIssue(opt, instances[c.insIdx], c)
+		name := path.Join(dir, fmt.Sprintf("%v.md", len(drafted)))
+		if err := ioutil.WriteFile(name, []byte(fmt.Sprintf("# %v\n\n%v", draft.Title, draft.Body)), 0666); err != nil {
+			return errors.Trace(err)
+		}
+		if iopt.Token == "" {
+			continue
+		}
+		if existing, found, err := FindIssue(iopt, draft.Marker); err != nil {
+			return fmt.Errorf("search issues of %v, err=%v", name, err)
+		} else if found {
+			fmt.Printf("[Issue] %v is not posted since it's already open as %v\n", name, existing)
+			continue
+		}
+		url, err := PostIssue(iopt, draft)
+		if err != nil {
+			return fmt.Errorf("post issue %v, err=%v", name, err)
+		}
+		fmt.Printf("[Issue] %v is posted as %v\n", name, url)
+	}
+	if len(drafted) > 0 {
+		fmt.Printf("[Issue] drafted %v issues into %v\n", len(drafted), dir)
+	}
+	return nil
+}
+
+// planIDSuffix matches suffixes of IDs of operators in plans, like "_7" of "TableReader_7".
+var planIDSuffix = regexp.MustCompile(`_\d+$`)
+
+// issueMarker returns a stable marker of the problem of this case, which is a hash of its query type, dataset and
+// root operator, so the same problem found by different runs, instances or SQLs has the same marker.
+func issueMarker(opt Option, c issueCase) string {
+	op := planIDSuffix.ReplaceAllString(c.r.Operator, "")
+	sum := sha256.Sum256([]byte(opt.QueryTypes[c.qtIdx].String() + "\x00" + opt.Datasets[c.dsIdx].Label + "\x00" + op))
+	return "optimizer-tester-" + hex.EncodeToString(sum[:8])
+}
+
+// issueIdent returns the name of a database or table shown in issues, which is anonymized like identifiers of SQLs
+// in reports if required.
+func issueIdent(opt Option, name string) string {
+	if opt.Anonymize {
+		return fmt.Sprintf("id_%08x", anonymizeHash(strings.ToLower(name), opt.AnonymizeSalt))
+	}
+	return name
+}
+
+// draftIssue drafts an issue for this case, with the schema and statistics of its tables queried from the instance.
+// With Option.Anonymize, names in the body are anonymized like reports and the address of the instance is omitted.
+func draftIssue(opt Option, ins tidb.Instance, c issueCase) IssueDraft {
+	r, qt := c.r, opt.QueryTypes[c.qtIdx]
+	draft := IssueDraft{
+		Title:  fmt.Sprintf("planner: wrong estimation of %v, est %v vs act %v", qt, r.EstCard, r.TrueCard),
+		Labels: opt.Issues.Labels,
+		Marker: issueMarker(opt, c),
+	}
+	var body bytes.Buffer
+	body.WriteString("## Bug Report\n\n")
+	body.WriteString(fmt.Sprintf("Found by OptimizerTester on dataset `%v`, query type `%v`.\n\n", opt.Datasets[c.dsIdx].Label, qt))
+	body.WriteString("### 1. Minimal reproduce step\n\n")
+	if opt.Anonymize {
+		body.WriteString("Schemas are omitted since the SQL is anonymized.\n\n")
+	} else {
+		for _, ref := range tableRefs(r.SQL) {
+			if _, rows, err := queryText(ins, fmt.Sprintf("SHOW CREATE TABLE %v.%v", ref[0], ref[1])); err == nil && len(rows) > 0 && len(rows[0]) > 1 {
+				body.WriteString(fmt.Sprintf("```sql\nUSE %v;\n%v;\n```\n\n", ref[0], rows[0][1]))
+			}
+		}
+	}
+	body.WriteString(fmt.Sprintf("```sql\nEXPLAIN %v;\n```\n\n", opt.reportSQL(r.SQL)))
+	body.WriteString("Statistics: ")
+	var token string
+	if !opt.ReadOnly { // PLAN REPLAYER writes a file on the server
+		if _, rows, err := queryText(ins, "PLAN REPLAYER DUMP EXPLAIN "+r.SQL); err == nil && len(rows) > 0 && len(rows[0]) > 0 {
+			token = rows[0][0]
+		}
+	}
+	if token != "" {
+		body.WriteString(fmt.Sprintf("captured by `PLAN REPLAYER DUMP` with token `%v` on %v.\n\n", token, ins.Opt().Label))
+	} else {
+		addr := ins.Opt().Addr
+		if opt.Anonymize {
+			addr = "<tidb-addr>"
+		}
+		var urls []string
+		for _, ref := range tableRefs(r.SQL) {
+			urls = append(urls, fmt.Sprintf("`http://%v:10080/stats/dump/%v/%v`", addr, issueIdent(opt, ref[0]), issueIdent(opt, ref[1])))
+		}
+		body.WriteString(fmt.Sprintf("can be dumped by %v.\n\n", strings.Join(urls, ", ")))
+	}
+	body.WriteString("### 2. What did you expect to see?\n\n")
+	body.WriteString(fmt.Sprintf("The estimated row count is close to the actual one, %v.\n\n", r.TrueCard))
+	body.WriteString("### 3. What did you see instead?\n\n")
+	body.WriteString(fmt.Sprintf("The estimated row count is %v, PError=%.3f, QError=%.3f.\n\n", r.EstCard, PError(r), QError(r)))
+	if r.Plan != "" {
+		body.WriteString(fmt.Sprintf("```\n%v\n```\n\n", opt.reportSQL(r.Plan)))
+	}
+	body.WriteString("### 4. What is your TiDB version?\n\n")
+	ver := ins.Version()
+	if commit := ins.Build().Commit; commit != "" {
+		ver += ", commit " + commit
+	}
+	body.WriteString(ver + "\n")
+	body.WriteString(fmt.Sprintf("\nMarker: `%v`\n", draft.Marker))
+	draft.Body = body.String()
+	return draft
+}
+
+// PostIssue posts this draft to the repository and returns the URL of the created issue.
+func PostIssue(iopt IssueOpt, draft IssueDraft) (string, error) {
+	content, err := json.Marshal(draft)
+	if err != nil {
+		return "", errors.Trace(err)
+	}
+	respContent, err := requestGitHub(iopt, http.MethodPost, fmt.Sprintf("/repos/%v/issues", iopt.Repo), content, http.StatusCreated)
+	if err != nil {
+		return "", err
+	}
+	var created struct {
+		HTMLURL string `json:"html_url"`
+	}
+	if err := json.Unmarshal(respContent, &created); err != nil {
+		return "", errors.Trace(err)
+	}
+	return created.HTMLURL, nil
+}
+
+// FindIssue searches open issues of the repository with this marker in their bodies, and returns the URL of the
+// first one.
+func FindIssue(iopt IssueOpt, marker string) (string, bool, error) {
+	query := url.QueryEscape(fmt.Sprintf("repo:%v is:issue is:open in:body \"%v\"", iopt.Repo, marker))
+	respContent, err := requestGitHub(iopt, http.MethodGet, "/search/issues?q="+query, nil, http.StatusOK)
+	if err != nil {
+		return "", false, err
+	}
+	var found struct {
+		Items []struct {
+			HTMLURL string `json:"html_url"`
+			Body    string `json:"body"`
+		} `json:"items"`
+	}
+	if err := json.Unmarshal(respContent, &found); err != nil {
+		return "", false, errors.Trace(err)
+	}
+	for _, item := range found.Items {
+		if strings.Contains(item.Body, marker) { // the search is fuzzy
+			return item.HTMLURL, true, nil
+		}
+	}
+	return "", false, nil
+}
+
+// requestGitHub sends a request to the GitHub API with the token, and returns the body of the response, which is an
+// error if its status is not the expected one.
+func requestGitHub(iopt IssueOpt, method, uri string, content []byte, status int) ([]byte, error) {
+	api := iopt.API
+	if api == "" {
+		api = "https://api.github.com"
+	}
+	req, err := http.NewRequest(method, strings.TrimSuffix(api, "/")+uri, bytes.NewReader(content))
+	if err != nil {
+		return nil, errors.Trace(err)
+	}
+	req.Header.Set("Authorization", "token "+iopt.Token)
+	req.Header.Set("Accept", "application/vnd.github.v3+json")
+	if content != nil {
+		req.Header.Set("Content-Type", "application/json")
+	}
+	client := http.Client{Timeout: 30 * time.Second}
+	resp, err := client.Do(req)
+	if err != nil {
+		return nil, errors.Trace(err)
+	}
+	defer resp.Body.Close()
+	respContent, err := ioutil.ReadAll(resp.Body)
+	if err != nil {
+		return nil, errors.Trace(err)
+	}
+	if resp.StatusCode != status {
+		return nil, errors.Errorf("status=%v, body=%s", resp.Status, respContent)
+	}
+	return respContent, nil
+}
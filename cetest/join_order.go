@@ -0,0 +1,247 @@
+package cetest
+
+import (
+	"bytes"
+	"fmt"
+	"regexp"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/pingcap/errors"
+	"github.com/qw4990/OptimizerTester/tidb"
+)
+
+// JoinOrderOpt scores join orders chosen by the optimizer after the run. Join cases are executed with the chosen
+// order and with alternative orders forced by the hint LEADING, and the score of a case is the execution time of
+// the best order found divided by the one of the chosen order, so it's 1 if the chosen order is the best.
+type JoinOrderOpt struct {
+	Cases     int `toml:"cases"`      // number of join cases of each cell scored on each instance, disabled if 0
+	MaxOrders int `toml:"max-orders"` // max number of join orders forced for each case, 6 if 0
+	Repeats   int `toml:"repeats"`    // each order is executed this many times and the fastest is kept, 1 if 0
+}
+
+const (
+	defaultMaxJoinOrders = 6
+	nearOptimalJoinOrder = 0.9 // scores of near-optimal join orders are at least this
+)
+
+func (jo JoinOrderOpt) check(readOnly bool) error {
+	if jo.Cases < 0 || jo.MaxOrders < 0 || jo.Repeats < 0 {
+		return errors.Errorf("invalid join-order cases=%v, max-orders=%v or repeats=%v", jo.Cases, jo.MaxOrders, jo.Repeats)
+	}
+	if jo.Cases > 0 && readOnly {
+		return errors.Errorf("join-order is not allowed in read-only mode since it runs queries")
+	}
+	return nil
+}
+
+func (jo JoinOrderOpt) maxOrders() int {
+	if jo.MaxOrders > 0 {
+		return jo.MaxOrders
+	}
+	return defaultMaxJoinOrders
+}
+
+func (jo JoinOrderOpt) repeats() int {
+	if jo.Repeats > 0 {
+		return jo.Repeats
+	}
+	return 1
+}
+
+// JoinOrderResult is the execution time of a case with a join order.
+type JoinOrderResult struct {
+	Order           string // aliases of tables in the forced order like "t2,t1", empty for the order chosen by the optimizer
+	ExecTime        time.Duration
+	PlanFingerprint string
+}
+
+// JoinOrderScore returns the execution time of the best order of this case divided by the one of the chosen order,
+// and false if its join orders are not scored.
+func JoinOrderScore(r EstResult) (float64, bool) {
+	var chosen, best time.Duration
+	found := false
+	for _, jr := range r.JoinOrders {
+		if jr.Order == "" {
+			chosen, found = jr.ExecTime, true
+		}
+		if best == 0 || jr.ExecTime < best {
+			best = jr.ExecTime
+		}
+	}
+	if !found || len(r.JoinOrders) < 2 {
+		return 0, false
+	}
+	if chosen <= 0 {
+		return 1, true
+	}
+	return float64(best) / float64(chosen), true
+}
+
+// joinTablePattern matches tables joined by cases with their aliases, like "FROM db.t t1" and "JOIN db.t AS t2".
+var joinTablePattern = regexp.MustCompile("(?i)\\b(?:FROM|JOIN)\\s+`?([\\w$]+)`?(?:\\.`?([\\w$]+)`?)?(?:\\s+(?:AS\\s+)?`?(\\w+)`?)?")
+
+// joinKeywords can follow tables without aliases.
+var joinKeywords = map[string]bool{"where": true, "on": true, "using": true, "join": true, "inner": true, "left": true,
+	"right": true, "cross": true, "natural": true, "straight_join": true, "group": true, "order": true, "limit": true, "union": true}
+
+// joinAliases returns aliases of all tables joined by this SQL in order, or names of tables without aliases.
+func joinAliases(sql string) []string {
+	var aliases []string
+	for _, m := range joinTablePattern.FindAllStringSubmatch(sql, -1) {
+		alias := m[3]
+		if alias == "" || joinKeywords[strings.ToLower(alias)] {
+			alias = m[1]
+			if m[2] != "" {
+				alias = m[2]
+			}
+		}
+		aliases = append(aliases, alias)
+	}
+	return aliases
+}
+
+// joinOrders returns up to n permutations of these aliases in lexicographic order.
+func joinOrders(aliases []string, n int) [][]string {
+	cur := append([]string(nil), aliases...)
+	sort.Strings(cur)
+	var orders [][]string
+	for len(orders) < n {
+		orders = append(orders, append([]string(nil), cur...))
+		// the next permutation
+		i := len(cur) - 2
+		for i >= 0 && cur[i] >= cur[i+1] {
+			i--
+		}
+		if i < 0 {
+			break
+		}
+		j := len(cur) - 1
+		for cur[j] <= cur[i] {
+			j--
+		}
+		cur[i], cur[j] = cur[j], cur[i]
+		for l, r := i+1, len(cur)-1; l < r; l, r = l+1, r-1 {
+			cur[l], cur[r] = cur[r], cur[l]
+		}
+	}
+	return orders
+}
+
+// scoreJoinOrders executes up to JoinOrderOpt.Cases join cases of each cell on each instance with the chosen order
+// and alternative orders, and keeps their execution times in results. Cases rejected by the guard are skipped.
+func scoreJoinOrders(opt Option, instances []tidb.Instance, collector EstResultCollector) error {
+	if opt.JoinOrder.Cases <= 0 {
+		return nil
+	}
+	for insIdx, ins := range instances {
+		for dsIdx := range opt.Datasets {
+			for qtIdx := range opt.QueryTypes {
+				n := 0
+				for i, r := range collector.EstResults(insIdx, dsIdx, qtIdx) {
+					if n >= opt.JoinOrder.Cases {
+						break
+					}
+					aliases := joinAliases(r.SQL)
+					if len(aliases) < 2 {
+						continue
+					}
+					jrs, err := executeJoinOrders(opt, ins, r.SQL, aliases)
+					if rejectedByGuard(err) {
+						continue
+					} else if err != nil {
+						return fmt.Errorf("score join orders of %v on %v, err=%v", r.SQL, ins.Opt().Label, err)
+					}
+					r.JoinOrders = jrs
+					collector.UpdateEstResult(insIdx, dsIdx, qtIdx, i, r)
+					n++
+				}
+			}
+		}
+	}
+	return nil
+}
+
+// executeJoinOrders executes this case with the chosen order and alternative orders of these aliases.
+func executeJoinOrders(opt Option, ins tidb.Instance, sql string, aliases []string) ([]JoinOrderResult, error) {
+	e := explainAnalyzeExecutor{opt.Guard}
+	run := func(order []string) (JoinOrderResult, error) {
+		q := sql
+		if len(order) > 0 {
+			q = tidb.AddHints(sql, fmt.Sprintf("LEADING(%v)", strings.Join(order, ", ")))
+		}
+		var jr JoinOrderResult
+		for i := 0; i < opt.JoinOrder.repeats(); i++ {
+			r, err := e.Execute(ins, q, false)
+			if err != nil {
+				return JoinOrderResult{}, err
+			}
+			if i == 0 || r.ExecTime < jr.ExecTime {
+				jr = JoinOrderResult{Order: strings.Join(order, ","), ExecTime: r.ExecTime, PlanFingerprint: r.PlanFingerprint}
+			}
+		}
+		return jr, nil
+	}
+	chosen, err := run(nil)
+	if err != nil {
+		return nil, err
+	}
+	jrs := []JoinOrderResult{chosen}
+	for _, order := range joinOrders(aliases, opt.JoinOrder.maxOrders()) {
+		jr, err := run(order)
+		if err != nil {
+			return nil, err
+		}
+		jrs = append(jrs, jr)
+	}
+	return jrs, nil
+}
+
+// writeJoinOrderScores writes scores of join orders chosen on each instance in this cell, and the case with the
+// worst score. It's skipped if no case of this cell is scored.
+func writeJoinOrderScores(md *bytes.Buffer, opt Option, collector EstResultCollector, dsIdx, qtIdx int) {
+	header := false
+	for insIdx, ins := range opt.Instances {
+		cases, nearOptimal := 0, 0
+		total, worst := 0.0, 2.0
+		example := "-"
+		for _, r := range collector.EstResults(insIdx, dsIdx, qtIdx) {
+			score, ok := JoinOrderScore(r)
+			if !ok {
+				continue
+			}
+			cases++
+			total += score
+			if score >= nearOptimalJoinOrder {
+				nearOptimal++
+			}
+			if score < worst {
+				worst = score
+				example = fmt.Sprintf("`%v`: chosen %v, best `%v` %v", strings.Replace(opt.reportSQL(r.SQL), "|", "\\|", -1),
+					r.JoinOrders[0].ExecTime, bestJoinOrder(r).Order, bestJoinOrder(r).ExecTime)
+			}
+		}
+		if cases == 0 {
+			continue
+		}
+		if !header {
+			md.WriteString("\nJoin Order Scores\n")
+			md.WriteString(fmt.Sprintf("\n| Instance | Cases | Mean Score | Near-Optimal (>= %v) | Worst Score | Worst Case |\n", nearOptimalJoinOrder))
+			md.WriteString("| ---- | ---- | ---- | ---- | ---- | ---- |\n")
+			header = true
+		}
+		md.WriteString(fmt.Sprintf("| %v | %v | %.3f | %v | %.3f | %v |\n", ins.Label, cases, total/float64(cases), nearOptimal, worst, example))
+	}
+}
+
+// bestJoinOrder returns the fastest join order of this case.
+func bestJoinOrder(r EstResult) JoinOrderResult {
+	best := r.JoinOrders[0]
+	for _, jr := range r.JoinOrders[1:] {
+		if jr.ExecTime < best.ExecTime {
+			best = jr
+		}
+	}
+	return best
+}
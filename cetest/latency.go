@@ -0,0 +1,181 @@
+package cetest
+
+import (
+	"fmt"
+	"math"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/pingcap/errors"
+	"github.com/qw4990/OptimizerTester/tidb"
+)
+
+// LatencyAwareOpt measures round-trip time of each instance before running cases on it, and scales the number of
+// cases running in parallel on it by the RTT, so runs against remote clusters, like those in other regions with 100ms+
+// RTT, aren't dominated by waiting for round-trips. Each case is mostly a few round-trips with little work on the
+// server, so the throughput of an instance is about concurrency/RTT, and the concurrency is multiplied by P50 RTT
+// divided by BaseRTT to keep it. RTT statistics and the scaled concurrency of each instance are shown in reports.
+type LatencyAwareOpt struct {
+	Enabled        bool   `toml:"enabled"`
+	Probes         int    `toml:"probes"`          // number of round-trips measured on each instance, 10 if 0
+	BaseRTT        string `toml:"base-rtt"`        // RTT the configured concurrency is tuned for, "1ms" if empty
+	MaxConcurrency int    `toml:"max-concurrency"` // upper bound of the scaled concurrency, 256 if 0
+}
+
+const (
+	defaultRTTProbes         = 10
+	defaultBaseRTT           = time.Millisecond
+	defaultMaxConcurrency    = 256 // connections of each instance are limited to 256, see tidb.ConnectTo
+	latencyAwareRTTProbeStmt = "SELECT 1"
+)
+
+func (lo LatencyAwareOpt) check() error {
+	if !lo.Enabled {
+		return nil
+	}
+	if lo.Probes < 0 || lo.MaxConcurrency < 0 {
+		return errors.Errorf("invalid latency-aware probes=%v or max-concurrency=%v", lo.Probes, lo.MaxConcurrency)
+	}
+	if lo.BaseRTT != "" {
+		if d, err := time.ParseDuration(lo.BaseRTT); err != nil || d <= 0 {
+			return errors.Errorf("invalid latency-aware base-rtt=%v", lo.BaseRTT)
+		}
+	}
+	return nil
+}
+
+func (lo LatencyAwareOpt) probes() int {
+	if lo.Probes > 0 {
+		return lo.Probes
+	}
+	return defaultRTTProbes
+}
+
+func (lo LatencyAwareOpt) baseRTT() time.Duration {
+	if d, err := time.ParseDuration(lo.BaseRTT); err == nil && d > 0 {
+		return d
+	}
+	return defaultBaseRTT
+}
+
+func (lo LatencyAwareOpt) maxConcurrency() int {
+	if lo.MaxConcurrency > 0 {
+		return lo.MaxConcurrency
+	}
+	return defaultMaxConcurrency
+}
+
+// RTTStats is the round-trip time measured on an instance, in milliseconds.
+type RTTStats struct {
+	Probes      int     `json:"probes"`
+	MinMS       float64 `json:"min_ms"`
+	P50MS       float64 `json:"p50_ms"`
+	P90MS       float64 `json:"p90_ms"`
+	MaxMS       float64 `json:"max_ms"`
+	Concurrency int     `json:"concurrency"` // number of cases running in parallel on the instance, scaled by the RTT
+}
+
+// newRTTStats summarizes these round-trips, which are sorted in place.
+func newRTTStats(rtts []time.Duration) RTTStats {
+	sort.Slice(rtts, func(i, j int) bool { return rtts[i] < rtts[j] })
+	ms := func(d time.Duration) float64 { return float64(d) / float64(time.Millisecond) }
+	at := func(q float64) time.Duration { return rtts[int(q*float64(len(rtts)-1)+0.5)] }
+	return RTTStats{
+		Probes: len(rtts),
+		MinMS:  ms(rtts[0]),
+		P50MS:  ms(at(0.5)),
+		P90MS:  ms(at(0.9)),
+		MaxMS:  ms(rtts[len(rtts)-1]),
+	}
+}
+
+// instanceLatencies keeps RTT statistics of all instances of a run, keyed by their labels.
+type instanceLatencies struct {
+	opt LatencyAwareOpt
+
+	mu    sync.Mutex
+	stats map[string]RTTStats
+}
+
+// newInstanceLatencies returns nil if the latency-aware mode is disabled.
+func newInstanceLatencies(opt LatencyAwareOpt) *instanceLatencies {
+	if !opt.Enabled {
+		return nil
+	}
+	return &instanceLatencies{opt: opt, stats: make(map[string]RTTStats)}
+}
+
+// measure measures RTT of this instance by round-trips of a trivial statement and scales its concurrency, which
+// configures concurrency of all cells. It's only done once for each instance, since cells are run sequentially on
+// it. The first round-trip is not measured, since it may open a new connection.
+func (l *instanceLatencies) measure(ins tidb.Instance, concurrency int) {
+	if l == nil {
+		return
+	}
+	label := ins.Opt().Label
+	l.mu.Lock()
+	_, ok := l.stats[label]
+	l.mu.Unlock()
+	if ok {
+		return
+	}
+	if concurrency <= 0 {
+		concurrency = defaultConcurrency
+	}
+	rtts := make([]time.Duration, 0, l.opt.probes())
+	for i := 0; i <= l.opt.probes(); i++ {
+		begin := time.Now()
+		rows, err := ins.Query(latencyAwareRTTProbeStmt)
+		if err != nil {
+			fmt.Printf("[LatencyAware] measure RTT of ins=%v, err=%v, concurrency=%v is used\n", label, err, concurrency)
+			return
+		}
+		rows.Close()
+		if i > 0 {
+			rtts = append(rtts, time.Since(begin))
+		}
+	}
+	s := newRTTStats(rtts)
+	s.Concurrency = scaledConcurrency(concurrency, s.P50MS, l.opt.baseRTT(), l.opt.maxConcurrency())
+	fmt.Printf("[LatencyAware] ins=%v, rtt-p50=%.2fms, rtt-p90=%.2fms, concurrency=%v\n", label, s.P50MS, s.P90MS, s.Concurrency)
+	l.mu.Lock()
+	l.stats[label] = s
+	l.mu.Unlock()
+}
+
+// scaledConcurrency multiplies the concurrency by how many times the RTT is larger than the base, the concurrency is
+// never lowered and never exceeds the upper bound unless it's configured beyond it.
+func scaledConcurrency(concurrency int, rttMS float64, base time.Duration, max int) int {
+	factor := math.Ceil(rttMS * float64(time.Millisecond) / float64(base))
+	if factor <= 1 {
+		return concurrency
+	}
+	scaled := float64(concurrency) * factor
+	if scaled > float64(max) {
+		scaled = float64(max)
+	}
+	if int(scaled) < concurrency {
+		return concurrency
+	}
+	return int(scaled)
+}
+
+// concurrency returns the scaled concurrency of this instance, or 0 if its RTT is not measured.
+func (l *instanceLatencies) concurrency(ins string) int {
+	s, ok := l.get(ins)
+	if !ok {
+		return 0
+	}
+	return s.Concurrency
+}
+
+func (l *instanceLatencies) get(ins string) (RTTStats, bool) {
+	if l == nil {
+		return RTTStats{}, false
+	}
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	s, ok := l.stats[ins]
+	return s, ok
+}
@@ -0,0 +1,119 @@
+package cetest
+
+import (
+	"fmt"
+	"math"
+	"os"
+	"path"
+	"sort"
+
+	"github.com/pingcap/errors"
+	"gonum.org/v1/plot"
+	"gonum.org/v1/plot/plotter"
+	"gonum.org/v1/plot/plotutil"
+	"gonum.org/v1/plot/vg"
+)
+
+// DrawErrorLatencyChart draws P90 of absolute PErrors and P90 of plan latencies of each instance of this cell into
+// one chart with two scales, so an accuracy improvement which doubles the planning time can be seen at a glance.
+// It returns "" if no latency is collected in this cell.
+func DrawErrorLatencyChart(opt Option, collector EstResultCollector, qtIdx, dsIdx int) (string, error) {
+	errs := make(plotter.Values, len(opt.Instances))
+	lats := make(plotter.Values, len(opt.Instances)) // in milliseconds
+	insNames := make([]string, len(opt.Instances))
+	for insIdx, ins := range opt.Instances {
+		insNames[insIdx] = ins.Label
+		var pes, ms []float64
+		for _, r := range collector.EstResults(insIdx, dsIdx, qtIdx) {
+			pes = append(pes, math.Abs(PError(r)))
+			if r.PlanLatency > 0 {
+				ms = append(ms, r.PlanLatency.Seconds()*1000)
+			}
+		}
+		errs[insIdx], lats[insIdx] = p90(pes), p90(ms)
+	}
+	maxErr, maxLat := maxValue(errs), maxValue(lats)
+	if maxLat == 0 {
+		return "", nil
+	}
+	// latencies are drawn on the scale of errors, and labeled with their own values on the same ticks
+	scale := 1.0
+	if maxErr > 0 {
+		scale = maxErr / maxLat
+	}
+	scaled := make(plotter.Values, len(lats))
+	for i, lat := range lats {
+		scaled[i] = lat * scale
+	}
+
+	p, err := plot.New()
+	if err != nil {
+		return "", errors.Trace(err)
+	}
+	p.Title.Text = fmt.Sprintf("Accuracy and plan latency of %v on %v", opt.QueryTypes[qtIdx], opt.Datasets[dsIdx].Label)
+	p.Y.Label.Text = "P90 absolute PError | P90 plan latency"
+	p.Y.Tick.Marker = dualTicker{scale: scale}
+	var w float64 = 20
+	for i, series := range []struct {
+		name   string
+		values plotter.Values
+	}{{"P90 absolute PError", errs}, {"P90 plan latency", scaled}} {
+		bar, err := plotter.NewBarChart(series.values, vg.Points(w))
+		if err != nil {
+			return "", errors.Trace(err)
+		}
+		bar.Color = plotutil.Color(i)
+		bar.Offset = vg.Points(float64(i)*w - w/2)
+		p.Add(bar)
+		p.Legend.Add(series.name, bar)
+	}
+	p.Legend.Top = true
+	p.NominalX(insNames...)
+
+	prefixDir := opt.ReportDir
+	if !path.IsAbs(prefixDir) {
+		absPrefix, err := os.Getwd()
+		if err != nil {
+			return "", errors.Trace(err)
+		}
+		prefixDir = path.Join(absPrefix, prefixDir)
+	}
+
+	name := fmt.Sprintf("%v-%v-latency", opt.QueryTypes[qtIdx], opt.Datasets[dsIdx].Label)
+	chartPath, err := saveChart(opt.Charts, p, vg.Points(100+(2*w+20)*float64(len(opt.Instances))), 3*vg.Inch, path.Join(prefixDir, name))
+	if err != nil {
+		return "", err
+	}
+	return path.Base(chartPath), nil
+}
+
+// dualTicker labels each tick with both the value of errors and the latency it stands for.
+type dualTicker struct {
+	scale float64 // latencies are multiplied by it to be drawn on the scale of errors
+}
+
+func (t dualTicker) Ticks(min, max float64) []plot.Tick {
+	ticks := plot.DefaultTicks{}.Ticks(min, max)
+	for i := range ticks {
+		if ticks[i].Label != "" {
+			ticks[i].Label = fmt.Sprintf("%.3g | %.3gms", ticks[i].Value, ticks[i].Value/t.scale)
+		}
+	}
+	return ticks
+}
+
+func p90(vs []float64) float64 {
+	if len(vs) == 0 {
+		return 0
+	}
+	sort.Float64s(vs)
+	return vs[(len(vs)*9)/10]
+}
+
+func maxValue(vs []float64) float64 {
+	m := 0.0
+	for _, v := range vs {
+		m = math.Max(m, v)
+	}
+	return m
+}
@@ -0,0 +1,190 @@
+package cetest
+
+import (
+	"bytes"
+	"fmt"
+	"regexp"
+	"sort"
+	"strings"
+	"sync"
+
+	"github.com/pingcap/errors"
+)
+
+// lintPatterns match malformed parts of skeletons of cases, whose quoted strings and comments are replaced by "?".
+var lintPatterns = []struct {
+	pattern *regexp.Regexp
+	msg     string
+}{ // read-only
+	{regexp.MustCompile(`%!|<nil>|\bNaN\b|[+-]Inf\b`), "formatting artifact"},
+	{regexp.MustCompile(`(?i)(=|<>|!=|<=|>=|<|>|\bLIKE|\bIN)\s*(\bAND\b|\bOR\b|\)|,|\bLIMIT\b|\bORDER\b|$)`), "operator without operand"},
+	{regexp.MustCompile(`(?i)\b(WHERE|ON|AND|OR)\s*(\bAND\b|\bOR\b|\)|\bLIMIT\b|\bORDER\b|$)`), "dangling condition"},
+	{regexp.MustCompile(`(?i)\bIN\s*\(\s*\)`), "empty IN list"},
+	{regexp.MustCompile(`(?i)\bFROM\s*(\.|\bWHERE\b|$)|\w+\.\.`), "missing identifier"},
+}
+
+// LintSQL checks whether this case is well-formed without any instance, to catch broken templates and
+// quoting bugs of generators before they fail at execution time. It's a lexical check of quotes, parentheses and
+// operands rather than a full parse, so it never rejects cases accepted by TiDB.
+func LintSQL(sql string) error {
+	sql = strings.TrimSpace(sql)
+	if first := strings.ToUpper(strings.SplitN(sql, " ", 2)[0]); first != "SELECT" && first != "WITH" {
+		return errors.Errorf("not a query")
+	}
+	skeleton, err := sqlSkeleton(sql)
+	if err != nil {
+		return err
+	}
+	for _, lp := range lintPatterns {
+		if loc := lp.pattern.FindStringIndex(skeleton); loc != nil {
+			near := skeleton[loc[0]:]
+			if len(near) > 32 {
+				near = near[:32]
+			}
+			return errors.Errorf("%v near %q", lp.msg, near)
+		}
+	}
+	return nil
+}
+
+// sqlSkeleton replaces quoted strings, quoted identifiers and comments of this SQL by "?", and checks whether quotes,
+// comments and parentheses are balanced.
+func sqlSkeleton(sql string) (string, error) {
+	var b strings.Builder
+	depth := 0
+	for i := 0; i < len(sql); i++ {
+		c := sql[i]
+		switch {
+		case c == '\'' || c == '"' || c == '`':
+			j := i + 1
+			for ; j < len(sql); j++ {
+				if sql[j] == '\\' && c != '`' {
+					j++
+				} else if sql[j] == c {
+					if j+1 < len(sql) && sql[j+1] == c { // doubled quotes
+						j++
+						continue
+					}
+					break
+				}
+			}
+			if j >= len(sql) {
+				return "", errors.Errorf("unterminated quote %c at %v", c, i)
+			}
+			b.WriteString("?")
+			i = j
+		case c == '/' && i+1 < len(sql) && sql[i+1] == '*':
+			j := strings.Index(sql[i+2:], "*/")
+			if j == -1 {
+				return "", errors.Errorf("unterminated comment at %v", i)
+			}
+			b.WriteString(" ")
+			i += j + 3
+		case c == '(':
+			depth++
+			b.WriteByte(c)
+		case c == ')':
+			if depth--; depth < 0 {
+				return "", errors.Errorf("unbalanced parenthesis at %v", i)
+			}
+			b.WriteByte(c)
+		default:
+			b.WriteByte(c)
+		}
+	}
+	if depth != 0 {
+		return "", errors.Errorf("%v unclosed parentheses", depth)
+	}
+	return b.String(), nil
+}
+
+// lintStats is the number of generated and malformed cases of a dataset.
+type lintStats struct {
+	cases, invalid int
+	example        string // the first malformed case and its error
+}
+
+// lintLog counts malformed cases of each dataset during a run, nil if the lint is disabled.
+type lintLog struct {
+	lock  sync.Mutex
+	stats map[string]*lintStats // keyed by labels of datasets
+}
+
+func newLintLog(enabled bool) *lintLog {
+	if !enabled {
+		return nil
+	}
+	return &lintLog{stats: make(map[string]*lintStats)}
+}
+
+// check lints this case of this dataset, and returns the error if it's malformed.
+func (l *lintLog) check(ds, sql string) error {
+	if l == nil {
+		return nil
+	}
+	err := LintSQL(sql)
+	l.lock.Lock()
+	defer l.lock.Unlock()
+	st, ok := l.stats[ds]
+	if !ok {
+		st = new(lintStats)
+		l.stats[ds] = st
+	}
+	st.cases++
+	if err != nil {
+		st.invalid++
+		if st.example == "" {
+			st.example = fmt.Sprintf("%v: %v", sql, err)
+		}
+		return newCaseError(ErrKindLint, sql, err)
+	}
+	return nil
+}
+
+// datasets returns labels of all linted datasets in order, it's called with the lock held.
+func (l *lintLog) datasets() []string {
+	labels := make([]string, 0, len(l.stats))
+	for ds := range l.stats {
+		labels = append(labels, ds)
+	}
+	sort.Strings(labels)
+	return labels
+}
+
+// print prints generation error rates of all datasets.
+func (l *lintLog) print() {
+	if l == nil {
+		return
+	}
+	l.lock.Lock()
+	defer l.lock.Unlock()
+	for _, ds := range l.datasets() {
+		st := l.stats[ds]
+		fmt.Printf("[Lint] ds=%v, cases=%v, malformed=%v, error-rate=%.2f%%\n", ds, st.cases, st.invalid, 100*float64(st.invalid)/float64(st.cases))
+		if st.example != "" {
+			fmt.Printf("[Lint] ds=%v, example=%v\n", ds, st.example)
+		}
+	}
+}
+
+// writeLint writes generation error rates of all datasets, nothing if the lint is disabled.
+func writeLint(md *bytes.Buffer, opt Option) {
+	l := opt.lint
+	if l == nil {
+		return
+	}
+	l.lock.Lock()
+	defer l.lock.Unlock()
+	md.WriteString("# Lint\n")
+	md.WriteString("\n| Dataset | Cases | Malformed | Error Rate | Example |\n")
+	md.WriteString("| ---- | ---- | ---- | ---- | ---- |\n")
+	for _, ds := range l.datasets() {
+		st := l.stats[ds]
+		example := "-"
+		if st.example != "" {
+			example = "`" + opt.reportSQL(st.example) + "`"
+		}
+		md.WriteString(fmt.Sprintf("| %v | %v | %v | %.2f%% | %v |\n", ds, st.cases, st.invalid, 100*float64(st.invalid)/float64(st.cases), example))
+	}
+	md.WriteString("\n")
+}
@@ -0,0 +1,115 @@
+package cetest
+
+import (
+	"sort"
+)
+
+// qtExamples are example SQLs of all query types, shown by the list command.
+var qtExamples = map[QueryType]string{ // read-only
+	QTSingleColPointQueryOnCol:          "SELECT * FROM t WHERE b = ?",
+	QTSingleColPointQueryOnIndex:        "SELECT * FROM t WHERE a = ? -- a is indexed",
+	QTSingleColMCVPointOnCol:            "SELECT * FROM t WHERE b = ? -- ? is one of the most common values",
+	QTSingleColMCVPointOnIndex:          "SELECT * FROM t WHERE a = ? -- a is indexed, ? is one of the most common values",
+	QTSingleColNullRangeQueryOnCol:      "SELECT * FROM t WHERE b IS NULL OR (b >= ? AND b <= ?)",
+	QTSingleColBoundaryQueryOnCol:       "SELECT * FROM t WHERE b >= 2147483647",
+	QTSingleColInQueryOnCol:             "SELECT * FROM t WHERE b IN (?, ?, ?)",
+	QTSingleColRangeQueryOnCol:          "SELECT * FROM t WHERE b >= ? AND b <= ?",
+	QTSingleColPrefixLikeQueryOnCol:     "SELECT * FROM t WHERE b LIKE 'prefix%'",
+	QTSingleColLatestRangeQueryOnCol:    "SELECT * FROM t WHERE ts >= ? -- ? is close to the max value",
+	QTSingleColCTEQueryOnCol:            "WITH cte AS (SELECT * FROM t WHERE b = ?) SELECT * FROM cte UNION ALL SELECT * FROM cte",
+	QTSingleColApplyQueryOnCol:          "SELECT * FROM t t1 WHERE t1.b = ? AND EXISTS (SELECT /*+ NO_DECORRELATE() */ 1 FROM t t2 WHERE t2.b = t1.b) -- estimated rows of the inner side per outer row",
+	QTSingleColPointGetQueryOnUniqueKey: "SELECT * FROM t WHERE id = ? or id IN (?, ?, ?) -- id is unique, plans should be PointGet or BatchPointGet",
+	QTMulColsPointQueryOnIndex:          "SELECT * FROM t WHERE a = ? AND b = ? -- (a, b) is indexed",
+	QTMulColsRangeQueryOnIndex:          "SELECT * FROM t WHERE a = ? AND b >= ? AND b <= ? -- (a, b) is indexed",
+	QTMulColsRangeSweepQueryOnIndex:     "SELECT * FROM t WHERE a >= ? AND a <= ? AND b >= ? AND b <= ? -- (a, b) is indexed",
+	QTCrossDBJoinQuery:                  "SELECT * FROM db1.t t1 JOIN db2.t t2 ON t1.a = t2.a WHERE t1.a = ?",
+	QTRecursiveCTEQuery:                 "WITH RECURSIVE sub AS (SELECT id FROM t WHERE id = ? UNION ALL SELECT t.id FROM t JOIN sub ON t.parent_id = sub.id) SELECT * FROM sub",
+}
+
+// metricDescs are descriptions of all metrics used in reports.
+var metricDescs = map[string]string{ // read-only
+	"p-error": "est/true-1 on over-estimations and 1-true/est on under-estimations, see PError",
+	"q-error": "max(est/true, true/est), see QError",
+	"bias":    "(est-true)/(true+1), see Bias",
+}
+
+// DatasetInfo describes a registered dataset with the schema it requires.
+type DatasetInfo struct {
+	Name       string
+	QueryTypes []QueryType
+	Tables     map[string]map[string]string // table, column, type
+}
+
+// QueryTypeInfo describes a registered query type.
+type QueryTypeInfo struct {
+	Name    string
+	Example string
+}
+
+// MetricInfo describes a metric used in reports.
+type MetricInfo struct {
+	Name string
+	Desc string
+}
+
+// ListDatasets returns all registered datasets ordered by names.
+func ListDatasets() []DatasetInfo {
+	names := make([]string, 0, len(datasetMap))
+	for name := range datasetMap {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	infos := make([]DatasetInfo, 0, len(names))
+	for _, name := range names {
+		ds := datasetMap[name](DatasetOpt{Name: name, DB: "test", Label: name})
+		info := DatasetInfo{Name: name, Tables: make(map[string]map[string]string)}
+		if b, ok := ds.(interface{ base() *datasetBase }); ok {
+			for tb, cols := range b.base().usedColumns() {
+				info.Tables[tb] = make(map[string]string, len(cols))
+				for col, tp := range cols {
+					info.Tables[tb][col] = tp.String()
+				}
+			}
+			info.QueryTypes = b.base().queryTypes()
+		}
+		infos = append(infos, info)
+	}
+	return infos
+}
+
+// ListQueryTypes returns all registered query types in order.
+func ListQueryTypes() []QueryTypeInfo {
+	infos := make([]QueryTypeInfo, 0, len(qtNameMap))
+	for qt := QTSingleColPointQueryOnCol; qt < numQueryTypes; qt++ {
+		infos = append(infos, QueryTypeInfo{Name: qt.String(), Example: qtExamples[qt]})
+	}
+	return infos
+}
+
+// ListMetrics returns all metrics used in reports ordered by names.
+func ListMetrics() []MetricInfo {
+	infos := make([]MetricInfo, 0, len(metricDescs))
+	for name, desc := range metricDescs {
+		infos = append(infos, MetricInfo{Name: name, Desc: desc})
+	}
+	sort.Slice(infos, func(i, j int) bool { return infos[i].Name < infos[j].Name })
+	return infos
+}
+
+func (ds *datasetBase) base() *datasetBase {
+	return ds
+}
+
+// queryTypes returns all query types supported by this dataset in order.
+func (ds *datasetBase) queryTypes() []QueryType {
+	var qts []QueryType
+	for qt := QTSingleColPointQueryOnCol; qt < numQueryTypes; qt++ {
+		_, ok1 := ds.scq.qMap[qt]
+		_, ok2 := ds.mciq.qMap[qt]
+		ok3 := qt == QTRecursiveCTEQuery && ds.rcq != nil
+		if ok1 || ok2 || ok3 {
+			qts = append(qts, qt)
+		}
+	}
+	return qts
+}
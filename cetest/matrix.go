@@ -0,0 +1,161 @@
+package cetest
+
+import (
+	"bytes"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"os"
+	"path"
+	"strings"
+
+	"github.com/pingcap/errors"
+	"github.com/qw4990/OptimizerTester/tidb"
+)
+
+// MatrixDim is a dimension of the experiment matrix, which is a global variable with all values to test.
+type MatrixDim struct {
+	Name     string   `toml:"name"`     // name of this dimension used in keys of runs, like "analyze-version"
+	Variable string   `toml:"variable"` // global variable set on all instances, like "tidb_analyze_version"
+	Values   []string `toml:"values"`
+}
+
+// matrixRun is a run of a combination of values of all dimensions.
+type matrixRun struct {
+	key    string            // like "analyze-version=1,prune-mode=static"
+	vars   map[string]string // global variables of this combination
+	labels map[string]string // values of all dimensions of this combination, which label all results of this run
+}
+
+func checkMatrix(dims []MatrixDim, readOnly bool) error {
+	if len(dims) > 0 && readOnly {
+		return errors.Errorf("matrix is not allowed in read-only mode since it sets global variables")
+	}
+	for _, d := range dims {
+		if d.Name == "" || d.Variable == "" || len(d.Values) == 0 {
+			return errors.Errorf("matrix dimension %v requires name, variable and values", d.Name)
+		}
+	}
+	return nil
+}
+
+// expandMatrix returns runs of all combinations of values of these dimensions, the last dimension changes fastest.
+func expandMatrix(dims []MatrixDim) []matrixRun {
+	runs := []matrixRun{{vars: map[string]string{}, labels: map[string]string{}}}
+	for _, d := range dims {
+		expanded := make([]matrixRun, 0, len(runs)*len(d.Values))
+		for _, r := range runs {
+			for _, v := range d.Values {
+				vars := make(map[string]string, len(r.vars)+1)
+				labels := make(map[string]string, len(r.labels)+1)
+				for k, val := range r.vars {
+					vars[k] = val
+				}
+				for k, val := range r.labels {
+					labels[k] = val
+				}
+				vars[d.Variable] = v
+				labels[d.Name] = v
+				key := fmt.Sprintf("%v=%v", d.Name, v)
+				if r.key != "" {
+					key = r.key + "," + key
+				}
+				expanded = append(expanded, matrixRun{key: key, vars: vars, labels: labels})
+			}
+		}
+		runs = expanded
+	}
+	return runs
+}
+
+// matrixResults collects results of all runs of the matrix, which are keyed by labels of their runs, so they're
+// reported together.
+type matrixResults struct {
+	collector EstResultCollector
+	instances int // number of instances running cases, results of imported engines are only collected once
+}
+
+// collect appends results of a run of the matrix on instances.
+func (m *matrixResults) collect(opt Option, collector EstResultCollector) {
+	if m == nil {
+		return
+	}
+	for insIdx := 0; insIdx < m.instances; insIdx++ {
+		for dsIdx := range opt.Datasets {
+			for qtIdx := range opt.QueryTypes {
+				m.collector.AppendEstResults(insIdx, dsIdx, qtIdx, collector.EstResults(insIdx, dsIdx, qtIdx))
+			}
+		}
+	}
+}
+
+// runMatrix runs the test once for each combination of the matrix, results of each run are reported into
+// a sub-directory of ReportDir named by its key, results of all runs are reported together into ReportDir keyed by
+// labels of their runs, and an index of all runs is written into ReportDir/matrix.md.
+func runMatrix(opt Option, tags []string) error {
+	runs := expandMatrix(opt.Matrix)
+	m := &matrixResults{instances: len(opt.Instances)}
+	reportOpt, collector, err := ImportEstResults(opt)
+	if err != nil {
+		return err
+	}
+	if c, ok := collector.(io.Closer); ok {
+		defer c.Close()
+	}
+	m.collector = collector
+	for i, r := range runs {
+		fmt.Printf("[Matrix] run %v/%v: %v\n", i+1, len(runs), r.key)
+		runOpt := opt
+		runOpt.Matrix = nil
+		runOpt.matrixVars = r.vars
+		runOpt.matrixResults = m
+		runOpt.ReportDir = path.Join(opt.ReportDir, r.key)
+		runOpt.Datasets = make([]DatasetOpt, len(opt.Datasets))
+		for dsIdx, ds := range opt.Datasets {
+			labels := make(map[string]string, len(ds.Labels)+len(r.labels))
+			for k, v := range ds.Labels {
+				labels[k] = v
+			}
+			for k, v := range r.labels {
+				labels[k] = v
+			}
+			ds.Labels = labels
+			runOpt.Datasets[dsIdx] = ds
+		}
+		if err := RunCETest(runOpt, tags); err != nil {
+			return fmt.Errorf("matrix run %v, err=%v", r.key, err)
+		}
+	}
+	reportOpt.Matrix = nil
+	if err := GenReports(reportOpt, m.collector); err != nil {
+		return fmt.Errorf("report all matrix runs, err=%v", err)
+	}
+	return writeMatrixIndex(opt.ReportDir, runs)
+}
+
+// writeMatrixIndex writes an index of reports of all these runs into reportDir/matrix.md.
+func writeMatrixIndex(reportDir string, runs []matrixRun) error {
+	var md bytes.Buffer
+	md.WriteString("# Matrix\n\nResults of all runs are reported together in [report](report.md), keyed by labels of runs.\n")
+	md.WriteString("\n| Run | Report |\n| ---- | ---- |\n")
+	for _, r := range runs {
+		md.WriteString(fmt.Sprintf("| %v | [report](%v/report.md) |\n", r.key, r.key))
+	}
+	if err := os.MkdirAll(reportDir, 0755); err != nil {
+		return errors.Trace(err)
+	}
+	return errors.Trace(ioutil.WriteFile(path.Join(reportDir, "matrix.md"), md.Bytes(), 0666))
+}
+
+// setMatrixVars sets global variables of the current matrix run on all instances.
+func setMatrixVars(instances []tidb.Instance, vars map[string]string) error {
+	for _, ins := range instances {
+		for k, v := range vars {
+			sql := fmt.Sprintf("SET GLOBAL %v = '%v'", k, strings.Replace(v, "'", "''", -1))
+			if err := ins.Exec(sql); err != nil {
+				return fmt.Errorf("ins=%v, sql=%v, err=%v", ins.Opt().Label, sql, err)
+			}
+		}
+	}
+	return nil
+}
@@ -0,0 +1,130 @@
+package cetest
+
+import (
+	"bytes"
+	"fmt"
+	"math"
+	"sort"
+	"strings"
+)
+
+// Types of joins executed by MPP on TiFlash.
+const (
+	MPPJoinBroadcast = "broadcast" // the build side is broadcast to all nodes
+	MPPJoinShuffle   = "shuffle"   // both sides are shuffled by join keys
+)
+
+// broadcastJoinThresholdCount is the default tidb_broadcast_join_threshold_count, the optimizer prefers broadcast joins
+// if the estimated rows of the build side are below it.
+const broadcastJoinThresholdCount = 10240
+
+// mppJoinType returns the type of the join in results of EXPLAIN by types of its exchanges, empty if there is no MPP join.
+func mppJoinType(header []string, results [][]string) string {
+	infoIdx := -1
+	for i, h := range header {
+		if strings.ToLower(strings.Replace(h, " ", "", -1)) == "operatorinfo" {
+			infoIdx = i
+		}
+	}
+	if infoIdx == -1 {
+		return ""
+	}
+	tp := ""
+	for _, row := range results {
+		switch {
+		case strings.Contains(row[infoIdx], "ExchangeType: Broadcast"):
+			return MPPJoinBroadcast
+		case strings.Contains(row[infoIdx], "ExchangeType: HashPartition"):
+			tp = MPPJoinShuffle
+		}
+	}
+	return tp
+}
+
+// mppBuildSide returns estimated and actual rows of the build side of the first HashJoin in these operators,
+// false if it's unknown.
+func mppBuildSide(ops []OperatorStats) (est, act float64, ok bool) {
+	for i, op := range ops {
+		if !strings.HasPrefix(op.ID, "HashJoin") {
+			continue
+		}
+		for _, child := range ops[i+1:] {
+			if child.Tree != op.Tree || child.Depth <= op.Depth {
+				break
+			}
+			if child.Depth == op.Depth+1 && strings.HasSuffix(child.ID, "(Build)") {
+				return child.EstRows, child.ActRows, true
+			}
+		}
+		return 0, 0, false
+	}
+	return 0, 0, false
+}
+
+// wrongMPPJoin returns whether the type of the MPP join of this result differs from the one chosen by the actual
+// rows of its build side, false if it's unknown, which requires runtime statistics of operators.
+func wrongMPPJoin(r EstResult) (wrong, known bool) {
+	if r.MPPJoin == "" {
+		return false, false
+	}
+	_, act, ok := mppBuildSide(r.Operators)
+	if !ok {
+		return false, false
+	}
+	broadcast := act < broadcastJoinThresholdCount
+	return broadcast != (r.MPPJoin == MPPJoinBroadcast), true
+}
+
+// writeMPPJoins writes a table of MPP joins of this cell grouped by their types, with absolute PErrors of their
+// cardinalities, and choices which are wrong according to actual rows of build sides, so wrong choices can be
+// correlated with misestimates. It's skipped if there is no MPP join.
+func writeMPPJoins(md *bytes.Buffer, opt Option, collector EstResultCollector, dsIdx, qtIdx int) {
+	header := false
+	for insIdx, ins := range opt.Instances {
+		groups := make(map[string][]EstResult)
+		for _, r := range collector.EstResults(insIdx, dsIdx, qtIdx) {
+			if r.MPPJoin != "" {
+				groups[r.MPPJoin] = append(groups[r.MPPJoin], r)
+			}
+		}
+		if len(groups) == 0 {
+			continue
+		}
+		if !header {
+			md.WriteString("\nMPP Joins\n")
+			md.WriteString("\n| Instance | Join | Cases | P50 | P90 | Wrong Choices | P50 of Wrong Choices |\n")
+			md.WriteString("| ---- | ---- | ---- | ---- | ---- | ---- | ---- |\n")
+			header = true
+		}
+		for _, tp := range []string{MPPJoinBroadcast, MPPJoinShuffle} {
+			rs := groups[tp]
+			if len(rs) == 0 {
+				continue
+			}
+			var pes, wrongPEs []float64
+			nKnown := 0
+			for _, r := range rs {
+				pe := math.Abs(PError(r))
+				pes = append(pes, pe)
+				if wrong, known := wrongMPPJoin(r); known {
+					nKnown++
+					if wrong {
+						wrongPEs = append(wrongPEs, pe)
+					}
+				}
+			}
+			sort.Float64s(pes)
+			sort.Float64s(wrongPEs)
+			n := len(pes)
+			wrong, wrongP50 := "-", "-"
+			if nKnown > 0 {
+				wrong = fmt.Sprintf("%v/%v", len(wrongPEs), nKnown)
+			}
+			if len(wrongPEs) > 0 {
+				wrongP50 = fmt.Sprintf("%.3f", wrongPEs[len(wrongPEs)/2])
+			}
+			md.WriteString(fmt.Sprintf("| %v | %v | %v | %.3f | %.3f | %v | %v |\n",
+				ins.Label, tp, n, pes[n/2], pes[(n*9)/10], wrong, wrongP50))
+		}
+	}
+}
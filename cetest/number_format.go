@@ -0,0 +1,93 @@
+package cetest
+
+import (
+	"fmt"
+	"math"
+	"strconv"
+	"strings"
+
+	"github.com/pingcap/errors"
+)
+
+// NumberFormatOpt controls how row counts and selectivities are printed in reports, raw float prints are used if it's empty.
+// Exported results are not affected.
+type NumberFormatOpt struct {
+	Locale             string `toml:"locale"`              // "en", "de" or "fr", which decides default separators
+	ThousandsSeparator string `toml:"thousands-separator"` // separator of thousands, like ",", overrides the one of the locale
+	Scientific         bool   `toml:"scientific"`          // print row counts >= 1e6 and selectivities < 1e-3 in scientific notation
+	SignificantDigits  int    `toml:"significant-digits"`  // significant digits of non-integers, all digits if 0
+
+	decimalSep string
+}
+
+var localeSeparators = map[string][2]string{ // read-only, locale: {thousands separator, decimal separator}
+	"en": {",", "."},
+	"de": {".", ","},
+	"fr": {" ", ","},
+}
+
+func (nf *NumberFormatOpt) check() error {
+	if nf.SignificantDigits < 0 || nf.SignificantDigits > 17 {
+		return errors.Errorf("invalid significant-digits=%v", nf.SignificantDigits)
+	}
+	if nf.Locale == "" {
+		return nil
+	}
+	seps, ok := localeSeparators[strings.ToLower(nf.Locale)]
+	if !ok {
+		return errors.Errorf("unknown locale=%v", nf.Locale)
+	}
+	if nf.ThousandsSeparator == "" {
+		nf.ThousandsSeparator = seps[0]
+	}
+	nf.decimalSep = seps[1]
+	return nil
+}
+
+// rows formats a row count or any other large number, like 1,234,567.
+func (nf NumberFormatOpt) rows(v float64) string {
+	return nf.format(v, nf.Scientific && math.Abs(v) >= 1e6)
+}
+
+// ratio formats a selectivity or any other small number, like 1.5e-06.
+func (nf NumberFormatOpt) ratio(v float64) string {
+	return nf.format(v, nf.Scientific && v != 0 && math.Abs(v) < 1e-3)
+}
+
+func (nf NumberFormatOpt) format(v float64, scientific bool) string {
+	if nf == (NumberFormatOpt{}) || math.IsInf(v, 0) || math.IsNaN(v) {
+		return fmt.Sprintf("%v", v)
+	}
+	if nf.SignificantDigits > 0 && (scientific || v != math.Trunc(v)) {
+		v, _ = strconv.ParseFloat(strconv.FormatFloat(v, 'g', nf.SignificantDigits, 64), 64)
+	}
+	var s string
+	if scientific {
+		s = strconv.FormatFloat(v, 'e', -1, 64)
+	} else {
+		s = strconv.FormatFloat(v, 'f', -1, 64)
+	}
+
+	intPart, rest := s, ""
+	if i := strings.IndexAny(s, ".e"); i != -1 {
+		intPart, rest = s[:i], s[i:]
+	}
+	if strings.HasPrefix(rest, ".") && nf.decimalSep != "" {
+		rest = nf.decimalSep + rest[1:]
+	}
+	sign := ""
+	if strings.HasPrefix(intPart, "-") {
+		sign, intPart = "-", intPart[1:]
+	}
+	if nf.ThousandsSeparator != "" && !scientific {
+		var buf strings.Builder
+		for i, c := range intPart {
+			if i > 0 && (len(intPart)-i)%3 == 0 {
+				buf.WriteString(nf.ThousandsSeparator)
+			}
+			buf.WriteRune(c)
+		}
+		intPart = buf.String()
+	}
+	return sign + intPart + rest
+}
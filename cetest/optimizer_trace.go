@@ -0,0 +1,127 @@
+package cetest
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"math"
+	"sort"
+	"strings"
+
+	"github.com/pingcap/errors"
+	"github.com/qw4990/OptimizerTester/tidb"
+)
+
+// ceTraceRecord is a selectivity derivation step in results of TRACE PLAN TARGET = 'estimation'.
+type ceTraceRecord struct {
+	TableName string `json:"table_name"`
+	Type      string `json:"type"` // like "Column Stats-Point", "Index Stats-Range" or "Table Stats-Expression-CNF"
+	Expr      string `json:"expr"`
+	RowCount  uint64 `json:"row_count"`
+}
+
+// traceEstimation returns types of all selectivity derivation steps fired when estimating this query,
+// each type is returned once in order of its first appearance.
+func traceEstimation(ins tidb.Instance, query string) ([]string, error) {
+	_, results, err := queryText(ins, "TRACE PLAN TARGET = 'estimation' "+query)
+	if err != nil {
+		return nil, err
+	}
+	if len(results) == 0 || len(results[0]) == 0 {
+		return nil, errors.Errorf("no result of tracing %v", query)
+	}
+	var records []ceTraceRecord
+	if err := json.Unmarshal([]byte(results[0][0]), &records); err != nil {
+		return nil, errors.Errorf("invalid estimation trace of %v, err=%v", query, err)
+	}
+	var steps []string
+	seen := make(map[string]bool)
+	for _, r := range records {
+		if !seen[r.Type] {
+			seen[r.Type] = true
+			steps = append(steps, r.Type)
+		}
+	}
+	return steps, nil
+}
+
+// traceWorstCases traces estimations of the OptimizerTraceCases worst cases of each cell, and keeps fired steps in
+// their results. Instances which don't support the estimation trace, like those before v6.2, are skipped.
+func traceWorstCases(opt Option, instances []tidb.Instance, collector EstResultCollector) error {
+	if opt.OptimizerTraceCases <= 0 {
+		return nil
+	}
+	for insIdx, ins := range instances {
+		if tidb.ToComparableVersion(ins.Version()) < tidb.ToComparableVersion("v6.2.0") {
+			fmt.Printf("[OptimizerTrace] skip ins=%v (%v), which doesn't support the estimation trace\n", ins.Opt().Label, ins.Version())
+			continue
+		}
+		for dsIdx := range opt.Datasets {
+			for qtIdx := range opt.QueryTypes {
+				rs := collector.EstResults(insIdx, dsIdx, qtIdx)
+				idxs := make([]int, len(rs))
+				for i := range idxs {
+					idxs[i] = i
+				}
+				sort.SliceStable(idxs, func(i, j int) bool { return math.Abs(PError(rs[idxs[i]])) > math.Abs(PError(rs[idxs[j]])) })
+				for i := 0; i < len(idxs) && i < opt.OptimizerTraceCases; i++ {
+					r := rs[idxs[i]]
+					steps, err := traceEstimation(ins, r.SQL)
+					if err != nil {
+						return fmt.Errorf("trace %v on %v, err=%v", r.SQL, ins.Opt().Label, err)
+					}
+					r.TraceSteps = steps
+					collector.UpdateEstResult(insIdx, dsIdx, qtIdx, idxs[i], r)
+				}
+			}
+		}
+	}
+	return nil
+}
+
+// writeTraceSteps writes a table of selectivity derivation steps fired in traced cases of this cell, ordered by
+// the number of cases they're fired in, and absolute PErrors of these cases, so the most common mis-estimating
+// rules stand out.
+func writeTraceSteps(md *bytes.Buffer, opt Option, collector EstResultCollector, dsIdx, qtIdx int) {
+	header := false
+	for insIdx, ins := range opt.Instances {
+		cases := make(map[string][]float64) // step, absolute PErrors of cases firing it
+		traced := 0
+		for _, r := range collector.EstResults(insIdx, dsIdx, qtIdx) {
+			if len(r.TraceSteps) == 0 {
+				continue
+			}
+			traced++
+			for _, s := range r.TraceSteps {
+				cases[s] = append(cases[s], math.Abs(PError(r)))
+			}
+		}
+		if traced == 0 {
+			continue
+		}
+		steps := make([]string, 0, len(cases))
+		for s := range cases {
+			steps = append(steps, s)
+		}
+		sort.Slice(steps, func(i, j int) bool {
+			if len(cases[steps[i]]) != len(cases[steps[j]]) {
+				return len(cases[steps[i]]) > len(cases[steps[j]])
+			}
+			return steps[i] < steps[j]
+		})
+		if !header {
+			md.WriteString("\nSelectivity Steps of the Worst Cases\n")
+			md.WriteString("\n| Instance | Step | Cases | Ratio | Avg Abs PError |\n")
+			md.WriteString("| ---- | ---- | ---- | ---- | ---- |\n")
+			header = true
+		}
+		for _, s := range steps {
+			tot := 0.0
+			for _, pe := range cases[s] {
+				tot += pe
+			}
+			md.WriteString(fmt.Sprintf("| %v | %v | %v | %.2f%% | %.3f |\n", ins.Label, strings.Replace(s, "|", "\\|", -1),
+				len(cases[s]), float64(len(cases[s]))*100/float64(traced), tot/float64(len(cases[s]))))
+		}
+	}
+}
@@ -0,0 +1,41 @@
+package cetest
+
+import (
+	"bytes"
+
+	"github.com/BurntSushi/toml"
+	"github.com/pingcap/errors"
+)
+
+// mergeConfigs merges these overlays into the base config in order and returns the merged config.
+// Tables are merged recursively, and other values, including arrays like query-types and [[datasets]], are replaced.
+func mergeConfigs(base string, overlays ...string) (string, error) {
+	merged := make(map[string]interface{})
+	if _, err := toml.Decode(base, &merged); err != nil {
+		return "", errors.Trace(err)
+	}
+	for _, o := range overlays {
+		m := make(map[string]interface{})
+		if _, err := toml.Decode(o, &m); err != nil {
+			return "", errors.Trace(err)
+		}
+		mergeTables(merged, m)
+	}
+	var buf bytes.Buffer
+	if err := toml.NewEncoder(&buf).Encode(merged); err != nil {
+		return "", errors.Trace(err)
+	}
+	return buf.String(), nil
+}
+
+func mergeTables(dst, src map[string]interface{}) {
+	for k, v := range src {
+		sub, ok1 := v.(map[string]interface{})
+		old, ok2 := dst[k].(map[string]interface{})
+		if ok1 && ok2 {
+			mergeTables(old, sub)
+		} else {
+			dst[k] = v
+		}
+	}
+}
@@ -0,0 +1,95 @@
+package cetest
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"regexp"
+	"strings"
+)
+
+// operatorIDSuffix matches IDs of operators with optional labels, like "_5" in "IndexRangeScan_5(Build)".
+var operatorIDSuffix = regexp.MustCompile(`_\d+(\(\w+\))?$`)
+
+type planNode struct {
+	name     string
+	children []*planNode
+}
+
+func (n *planNode) String() string {
+	if len(n.children) == 0 {
+		return n.name
+	}
+	cs := make([]string, len(n.children))
+	for i, c := range n.children {
+		cs[i] = c.String()
+	}
+	return n.name + "(" + strings.Join(cs, ",") + ")"
+}
+
+// PlanFingerprint returns a normalized fingerprint of the plan in results of EXPLAIN, which only contains
+// operators and their access objects, like "IndexLookUp(IndexRangeScan{table:t, index:a(a)},TableRowIDScan{table:t})".
+// Estimated rows, costs and IDs of operators are ignored, so the same plan shape always has the same fingerprint.
+// Producers of materialized CTEs are separate trees following the main plan, whose fingerprints are joined by ";".
+func PlanFingerprint(header []string, results [][]string) string {
+	idIdx, objIdx := -1, -1
+	for i, h := range header {
+		switch strings.ToLower(strings.Replace(h, " ", "", -1)) {
+		case "id":
+			idIdx = i
+		case "accessobject":
+			objIdx = i
+		}
+	}
+	if idIdx == -1 || len(results) == 0 {
+		return ""
+	}
+
+	var roots []*planNode
+	var stack []*planNode // the path from the root to the last node, stack[i] has depth i
+	for _, row := range results {
+		id, depth := trimTreePrefix(row[idIdx])
+		n := &planNode{name: operatorIDSuffix.ReplaceAllString(id, "$1")}
+		if objIdx != -1 && row[objIdx] != "" {
+			n.name += "{" + row[objIdx] + "}"
+		}
+		if depth == 0 || len(stack) == 0 {
+			roots, stack = append(roots, n), []*planNode{n}
+			continue
+		}
+		if depth > len(stack) {
+			depth = len(stack)
+		}
+		parent := stack[depth-1]
+		parent.children = append(parent.children, n)
+		stack = append(stack[:depth], n)
+	}
+	trees := make([]string, len(roots))
+	for i, root := range roots {
+		trees[i] = root.String()
+	}
+	return strings.Join(trees, ";")
+}
+
+// PlanDigest returns the hex SHA-256 digest of this plan fingerprint, which is short enough to join results of the
+// same plan shape across instances and runs, or "" if the fingerprint is empty.
+func PlanDigest(fingerprint string) string {
+	if fingerprint == "" {
+		return ""
+	}
+	sum := sha256.Sum256([]byte(fingerprint))
+	return hex.EncodeToString(sum[:])
+}
+
+// cteTag returns TagCTEMaterialized if any CTE of this result is read by CTEFullScan from its producer,
+// or TagCTEInlined otherwise.
+func cteTag(r EstResult) string {
+	if strings.Contains(r.PlanFingerprint, "CTEFullScan") {
+		return TagCTEMaterialized
+	}
+	return TagCTEInlined
+}
+
+// isPointGetPlan returns whether the plan of this fingerprint reads rows by unique keys directly.
+func isPointGetPlan(fingerprint string) bool {
+	return strings.HasPrefix(fingerprint, "Point_Get") || strings.HasPrefix(fingerprint, "Batch_Point_Get")
+}
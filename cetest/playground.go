@@ -0,0 +1,44 @@
+package cetest
+
+import (
+	"fmt"
+
+	"github.com/pingcap/errors"
+	"github.com/qw4990/OptimizerTester/tidb"
+)
+
+// playgroundPorts are default ports of TiDB servers started by `tiup playground`.
+var playgroundPorts = []int{4000, 4001, 4002}
+
+// playgroundConf is a small matrix on the mock dataset which finishes in minutes.
+const playgroundConf = `
+query-types = ["single-col-point-query-on-col", "single-col-point-query-on-index", "single-col-range-query-on-col", "mul-cols-point-query-on-index"]
+report-dir = "./playground-report"
+n-samples = 500
+
+[[datasets]]
+name = "mock"
+db = "optimizer_tester_playground"
+label = "mock"
+
+[[instances]]
+addr = "127.0.0.1"
+port = %v
+user = "root"
+label = "playground"
+`
+
+// PlaygroundOption discovers a local tiup playground and returns an option to test it with the mock dataset,
+// which needs neither credentials nor prepared data.
+func PlaygroundOption() (Option, error) {
+	for _, port := range playgroundPorts {
+		ins, err := tidb.ConnectTo(tidb.Option{Addr: "127.0.0.1", Port: port, User: "root", Label: "playground"})
+		if err != nil {
+			continue
+		}
+		ins.Close()
+		fmt.Printf("[Playground] found TiDB %v on 127.0.0.1:%v\n", ins.Version(), port)
+		return DecodeOption(fmt.Sprintf(playgroundConf, port))
+	}
+	return Option{}, errors.Errorf("no tiup playground found on 127.0.0.1 with ports %v, start one by `tiup playground`", playgroundPorts)
+}
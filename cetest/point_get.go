@@ -0,0 +1,34 @@
+package cetest
+
+import (
+	"bytes"
+	"fmt"
+)
+
+// writePointGetPlans writes a table of cases on unique keys whose plans degrade from PointGet or BatchPointGet,
+// or whose estimations are inexact, to flag versions where they regress. It's skipped for other query types.
+func writePointGetPlans(md *bytes.Buffer, opt Option, collector EstResultCollector, dsIdx, qtIdx int) {
+	if opt.QueryTypes[qtIdx] != QTSingleColPointGetQueryOnUniqueKey {
+		return
+	}
+	md.WriteString("\nPointGet Plans\n")
+	md.WriteString("\n| Instance | Cases | Degraded Plans | Inexact Estimations | Example |\n")
+	md.WriteString("| ---- | ---- | ---- | ---- | ---- |\n")
+	for insIdx, ins := range opt.Instances {
+		rs := collector.EstResults(insIdx, dsIdx, qtIdx)
+		degraded, inexact := 0, 0
+		example := "-"
+		for _, r := range rs {
+			if r.HasTag(TagNotPointGet) {
+				degraded++
+				if example == "-" {
+					example = fmt.Sprintf("`%v`: `%v`", opt.reportSQL(r.SQL), r.PlanFingerprint)
+				}
+			}
+			if r.EstCard != r.TrueCard {
+				inexact++
+			}
+		}
+		md.WriteString(fmt.Sprintf("| %v | %v | %v | %v | %v |\n", ins.Label, len(rs), degraded, inexact, example))
+	}
+}
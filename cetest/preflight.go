@@ -0,0 +1,150 @@
+package cetest
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"strings"
+	"time"
+
+	"github.com/pingcap/errors"
+	"github.com/qw4990/OptimizerTester/tidb"
+)
+
+// PreflightOpt runs a small calibration sample of each cell before the main run, and extrapolates the run time of
+// the configured n-samples, so it can be adjusted before committing a machine for days.
+type PreflightOpt struct {
+	Samples int  `toml:"samples"` // number of calibration cases of each cell, the pre-flight estimate is disabled if it's 0
+	Confirm bool `toml:"confirm"` // ask for confirmation on the standard input after printing the estimate
+}
+
+func (po PreflightOpt) check(opt Option) error {
+	if po.Samples < 0 {
+		return errors.Errorf("invalid preflight samples=%v", po.Samples)
+	}
+	if po.Samples > 0 && opt.NSamples == 0 {
+		return errors.Errorf("preflight requires n-samples since the number of all possible cases is unknown")
+	}
+	return nil
+}
+
+// errPreflightAborted is returned if the run is not confirmed after the pre-flight estimate.
+var errPreflightAborted = errors.New("the run is aborted after the pre-flight estimate")
+
+// PreflightCell is the estimated run time of a cell on an instance.
+type PreflightCell struct {
+	Instance  string
+	Dataset   string
+	QueryType string
+	Init      time.Duration // time of preparing cases once, like reading values of columns, paid by the first run
+	PerCase   time.Duration
+	Estimated time.Duration // Init + PerCase * n-samples
+}
+
+// EstimateRunTime runs Samples calibration cases of each cell on each instance twice, the first run pays the one-time
+// preparation of cases, and the second one measures the time of each case, which is extrapolated to n-samples.
+// Calibration cases are detached from the run, see calibrationOpt.
+func EstimateRunTime(opt Option, instances []tidb.Instance, datasets []Dataset) ([]PreflightCell, error) {
+	for _, ds := range datasets {
+		if b, ok := ds.(interface{ base() *datasetBase }); ok {
+			runOpt := b.base().opt
+			b.base().opt = calibrationOpt(runOpt)
+			defer func() { b.base().opt = runOpt }()
+		}
+	}
+	var cells []PreflightCell
+	for insIdx, ins := range instances {
+		for dsIdx, ds := range datasets {
+			dsOpt := opt.Datasets[dsIdx]
+			if err := runHooks(ins, dsOpt.Setup); err != nil {
+				return nil, fmt.Errorf("Setup ins=%v, ds=%v, err=%v", ins.Opt().Label, dsOpt.Label, err)
+			}
+			for _, qt := range opt.QueryTypes {
+				if opt.unsupported(insIdx, qt) {
+					continue
+				}
+				var elapsed [2]time.Duration
+				var n int
+				for i := range elapsed {
+					begin := time.Now()
+					rs, err := ds.GenEstResults(ins, opt.Preflight.Samples, qt)
+					if err != nil {
+						return nil, fmt.Errorf("calibrate ins=%v, ds=%v, qt=%v, err=%v", ins.Opt().Label, dsOpt.Label, qt, err)
+					}
+					elapsed[i], n = time.Since(begin), len(rs)
+				}
+				c := PreflightCell{Instance: ins.Opt().Label, Dataset: dsOpt.Label, QueryType: qt.String()}
+				if elapsed[0] > elapsed[1] {
+					c.Init = elapsed[0] - elapsed[1]
+				}
+				if n > 0 {
+					c.PerCase = elapsed[1] / time.Duration(n)
+				}
+				c.Estimated = c.Init + c.PerCase*time.Duration(opt.NSamples)
+				cells = append(cells, c)
+			}
+			if err := runHooks(ins, dsOpt.Teardown); err != nil {
+				return nil, fmt.Errorf("Teardown ins=%v, ds=%v, err=%v", ins.Opt().Label, dsOpt.Label, err)
+			}
+		}
+	}
+	return cells, nil
+}
+
+// calibrationOpt returns this option of a dataset without subsystems accounting or recording cases of the run, like
+// the budget, failed cases, the EXPLAIN archive and the dashboard, so calibration cases have no side effects on the run.
+func calibrationOpt(dsOpt DatasetOpt) DatasetOpt {
+	dsOpt.budget = nil
+	dsOpt.failures = nil
+	dsOpt.lint = nil
+	dsOpt.monitor = nil
+	dsOpt.writes = nil
+	dsOpt.control = nil
+	dsOpt.archive = nil
+	dsOpt.dashboard = nil
+	return dsOpt
+}
+
+// totalRunTime returns the estimated run time of all cells, which is the time of the slowest instance since
+// instances run in parallel, and the label of this instance.
+func totalRunTime(cells []PreflightCell) (time.Duration, string) {
+	perIns := make(map[string]time.Duration)
+	var total time.Duration
+	slowest := ""
+	for _, c := range cells {
+		perIns[c.Instance] += c.Estimated
+		if perIns[c.Instance] > total {
+			total, slowest = perIns[c.Instance], c.Instance
+		}
+	}
+	return total, slowest
+}
+
+// preflight prints the estimated run time and asks for confirmation if it's required.
+func preflight(opt Option, instances []tidb.Instance, datasets []Dataset, in io.Reader) error {
+	if opt.Preflight.Samples <= 0 {
+		return nil
+	}
+	cells, err := EstimateRunTime(opt, instances, datasets)
+	if err != nil {
+		return err
+	}
+	for _, c := range cells {
+		fmt.Printf("[Preflight] ins=%v, ds=%v, qt=%v, init=%v, per-case=%v, estimated=%v\n",
+			c.Instance, c.Dataset, c.QueryType, c.Init, c.PerCase, c.Estimated.Round(time.Second))
+	}
+	total, slowest := totalRunTime(cells)
+	fmt.Printf("[Preflight] estimated run time of n-samples=%v is %v, bounded by ins=%v\n", opt.NSamples, total.Round(time.Second), slowest)
+	if !opt.Preflight.Confirm {
+		return nil
+	}
+	fmt.Print("Continue? [y/N] ")
+	line, err := bufio.NewReader(in).ReadString('\n')
+	if err != nil && err != io.EOF {
+		return errors.Trace(err)
+	}
+	if answer := strings.ToLower(strings.TrimSpace(line)); answer != "y" && answer != "yes" {
+		return errPreflightAborted
+	}
+	return nil
+}
@@ -0,0 +1,60 @@
+package cetest
+
+import (
+	"strconv"
+	"time"
+
+	"github.com/pingcap/errors"
+)
+
+// defaultProgressCases is the default number of cases between two progress prints.
+const defaultProgressCases = 5000
+
+// progressOpt controls how often progresses are printed, by the number of cases or the elapsed time.
+type progressOpt struct {
+	cases    int
+	interval time.Duration
+}
+
+// parseProgressOpt parses a progress interval which is a number of cases like "1000" or a duration like "30s".
+func parseProgressOpt(s string) (progressOpt, error) {
+	if s == "" {
+		return progressOpt{cases: defaultProgressCases}, nil
+	}
+	if n, err := strconv.Atoi(s); err == nil {
+		if n <= 0 {
+			return progressOpt{}, errors.Errorf("invalid progress-interval=%v", s)
+		}
+		return progressOpt{cases: n}, nil
+	}
+	d, err := time.ParseDuration(s)
+	if err != nil || d <= 0 {
+		return progressOpt{}, errors.Errorf("invalid progress-interval=%v", s)
+	}
+	return progressOpt{interval: d}, nil
+}
+
+// progress decides when to print the progress of a querier, it's not thread-safe.
+type progress struct {
+	opt       progressOpt
+	lastPrint time.Time
+}
+
+func newProgress(opt progressOpt) *progress {
+	if opt.cases <= 0 && opt.interval <= 0 {
+		opt.cases = defaultProgressCases
+	}
+	return &progress{opt: opt, lastPrint: time.Now()}
+}
+
+// tick returns whether to print the progress after processing this number of cases.
+func (p *progress) tick(processed int) bool {
+	if p.opt.interval > 0 {
+		if time.Since(p.lastPrint) < p.opt.interval {
+			return false
+		}
+		p.lastPrint = time.Now()
+		return true
+	}
+	return processed%p.opt.cases == 0
+}
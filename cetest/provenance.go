@@ -0,0 +1,142 @@
+package cetest
+
+import (
+	"bufio"
+	"bytes"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/pingcap/errors"
+)
+
+// Provenance is a SHA-256 hash chain over the effective configuration, versions of instances and raw results of a
+// run. The chain starts from the hash of the configuration, and each link hashes the previous one with a result, so
+// published results can be verified as unmodified by recomputing the head from them.
+// Results are chained in the order of their canonical forms, so the head doesn't depend on the order of exports.
+type Provenance struct {
+	Config     map[string]string `json:"config"`      // effective configuration including versions, see effectiveConfig
+	ConfigHash string            `json:"config_hash"` // the first link of the chain
+	Results    int               `json:"results"`     // number of chained results
+	Head       string            `json:"head"`        // the last link of the chain, shown in report.md
+}
+
+const provenanceFile = "provenance.json"
+
+// NewProvenance computes the provenance of this run.
+func NewProvenance(opt Option, collector EstResultCollector) Provenance {
+	return chainProvenance(effectiveConfig(opt), CollectRawResults(opt, collector))
+}
+
+func chainProvenance(conf map[string]string, rs []RawResult) Provenance {
+	keys := make([]string, 0, len(conf))
+	for k := range conf {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	h := sha256.New()
+	for _, k := range keys {
+		h.Write([]byte(strconv.Quote(k) + "=" + strconv.Quote(conf[k]) + "\n"))
+	}
+	link := h.Sum(nil)
+	p := Provenance{Config: conf, ConfigHash: hex.EncodeToString(link), Results: len(rs)}
+
+	lines := make([]string, len(rs))
+	for i, r := range rs {
+		lines[i] = canonicalRawResult(r)
+	}
+	sort.Strings(lines)
+	for _, line := range lines {
+		h.Reset()
+		h.Write(link)
+		h.Write([]byte(line))
+		link = h.Sum(nil)
+	}
+	p.Head = hex.EncodeToString(link)
+	return p
+}
+
+// canonicalRawResult formats all fields of this result losslessly, floats are formatted in the shortest form which
+// is parsed back into the same value.
+func canonicalRawResult(r RawResult) string {
+	fields := []string{strconv.Quote(r.Instance), strconv.Quote(r.Dataset), strconv.Quote(r.QueryType), strconv.Quote(r.SQL), strconv.Quote(r.Labels)}
+	for _, v := range []float64{r.EstCard, r.TrueCard, r.PError, r.PlanMS, r.TableRows, r.SelError} {
+		fields = append(fields, strconv.FormatFloat(v, 'g', -1, 64))
+	}
+	return strings.Join(fields, ",") + "\n"
+}
+
+// writeProvenance writes the provenance of this run into ReportDir and its head into the report.
+func writeProvenance(md *bytes.Buffer, opt Option, collector EstResultCollector) error {
+	p := NewProvenance(opt, collector)
+	content, err := json.MarshalIndent(p, "", "  ")
+	if err != nil {
+		return errors.Trace(err)
+	}
+	if err := ioutil.WriteFile(path.Join(opt.ReportDir, provenanceFile), content, 0666); err != nil {
+		return errors.Trace(err)
+	}
+	md.WriteString("# Provenance\n")
+	md.WriteString(fmt.Sprintf("\nSHA-256 hash chain over the configuration, versions and %v raw results: `%v`\n", p.Results, p.Head))
+	md.WriteString(fmt.Sprintf("\nThe chain is kept in %v, verify it with raw results exported in the json or bin format by `optimizer-tester verify-provenance <report-dir>`.\n\n", provenanceFile))
+	return nil
+}
+
+// VerifyProvenance recomputes the hash chain of the run in this report directory from its provenance.json and raw
+// results exported in the bin or json format, and returns an error if anything is modified.
+func VerifyProvenance(dir string) (Provenance, error) {
+	content, err := ioutil.ReadFile(path.Join(dir, provenanceFile))
+	if err != nil {
+		return Provenance{}, errors.Trace(err)
+	}
+	var p Provenance
+	if err := json.Unmarshal(content, &p); err != nil {
+		return Provenance{}, errors.Errorf("invalid %v, err=%v", provenanceFile, err)
+	}
+	rs, err := readExportedRawResults(dir)
+	if err != nil {
+		return p, err
+	}
+	got := chainProvenance(p.Config, rs)
+	if got.ConfigHash != p.ConfigHash {
+		return p, errors.Errorf("the configuration is modified, its hash is %v instead of %v", got.ConfigHash, p.ConfigHash)
+	}
+	if got.Results != p.Results {
+		return p, errors.Errorf("%v results are found instead of %v", got.Results, p.Results)
+	}
+	if got.Head != p.Head {
+		return p, errors.Errorf("results are modified, the head of the chain is %v instead of %v", got.Head, p.Head)
+	}
+	return p, nil
+}
+
+// readExportedRawResults reads raw results exported into this directory, the lossless binary format is preferred.
+func readExportedRawResults(dir string) ([]RawResult, error) {
+	if _, err := os.Stat(path.Join(dir, "results.bin")); err == nil {
+		return ReadRawResults(path.Join(dir, "results.bin"))
+	}
+	f, err := os.Open(path.Join(dir, "results.json"))
+	if os.IsNotExist(err) {
+		return nil, errors.Errorf("no raw results exported in the bin or json format in %v", dir)
+	} else if err != nil {
+		return nil, errors.Trace(err)
+	}
+	defer f.Close()
+	var rs []RawResult
+	dec := json.NewDecoder(bufio.NewReader(f))
+	for dec.More() {
+		var r RawResult
+		if err := dec.Decode(&r); err != nil {
+			return nil, errors.Trace(err)
+		}
+		rs = append(rs, r)
+	}
+	return rs, nil
+}
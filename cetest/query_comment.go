@@ -0,0 +1,71 @@
+package cetest
+
+import (
+	"crypto/rand"
+	"encoding/hex"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/pingcap/errors"
+	"github.com/qw4990/OptimizerTester/tidb"
+)
+
+// newRunID returns an ID of the run like "20240101-100000-1a2b3c", which is unique enough to filter statements of a
+// run in server-side logs.
+func newRunID() string {
+	b := make([]byte, 3)
+	rand.Read(b)
+	return time.Now().UTC().Format("20060102-150405") + "-" + hex.EncodeToString(b)
+}
+
+// expandQueryComment replaces placeholders in this comment of tidb.Option.QueryPrefix or QuerySuffix, "{run}" by
+// the ID of the run shared by all runs of the matrix, and "{instance}" by the label of the instance. Values never
+// close the comment.
+func expandQueryComment(comment, runID, ins string) string {
+	if comment == "" {
+		return ""
+	}
+	sanitize := func(v string) string { return strings.Replace(v, "*/", "", -1) }
+	return strings.NewReplacer("{run}", sanitize(runID), "{instance}", sanitize(ins)).Replace(comment)
+}
+
+// setQueryComments sets comments and hints of all instances, whose own ones override those of the option, and
+// checks all comments are plain comments and no hint can close its hint comment.
+func setQueryComments(opt *Option) error {
+	for i := range opt.Instances {
+		ins := &opt.Instances[i]
+		if ins.QueryPrefix == "" {
+			ins.QueryPrefix = opt.QueryPrefix
+		}
+		if ins.QuerySuffix == "" {
+			ins.QuerySuffix = opt.QuerySuffix
+		}
+		if len(ins.QueryHints) == 0 {
+			ins.QueryHints = opt.QueryHints
+		}
+		ins.QueryPrefix = expandQueryComment(ins.QueryPrefix, opt.runID, ins.Label)
+		ins.QuerySuffix = expandQueryComment(ins.QuerySuffix, opt.runID, ins.Label)
+		for _, c := range []string{ins.QueryPrefix, ins.QuerySuffix} {
+			if err := tidb.CheckQueryComment(c); err != nil {
+				return errors.Errorf("invalid query-prefix or query-suffix of instance %v, err=%v", ins.Label, err)
+			}
+		}
+		for _, h := range ins.Hints() {
+			if err := tidb.CheckQueryHint(h); err != nil {
+				return errors.Errorf("invalid query-hints or resource-group of instance %v, err=%v", ins.Label, err)
+			}
+		}
+	}
+	return nil
+}
+
+// printRunID prints the ID of the run if it's in comments of any instance, so its statements can be filtered.
+func printRunID(opt Option) {
+	for _, ins := range opt.Instances {
+		if strings.Contains(ins.QueryPrefix+ins.QuerySuffix, opt.runID) {
+			fmt.Printf("[QueryComment] run=%v, statements are commented like %v\n", opt.runID, strings.TrimSpace(ins.QueryPrefix+" "+ins.QuerySuffix))
+			return
+		}
+	}
+}
@@ -0,0 +1,88 @@
+package cetest
+
+import (
+	"encoding/hex"
+	"strings"
+	"unicode/utf8"
+)
+
+// String literals of generated cases are quoted by these helpers instead of being interpolated into "'%v'", so values
+// of real datasets with quotes, backslashes or any UTF-8 characters like emoji can't break cases or inject SQL.
+// Backslash escapes assume NO_BACKSLASH_ESCAPES is not in sql_mode, which is the default of TiDB and MySQL.
+
+var stringEscaper = strings.NewReplacer(
+	`\`, `\\`,
+	`'`, `''`,
+	"\x00", `\0`,
+	"\n", `\n`,
+	"\r", `\r`,
+	"\x1a", `\Z`,
+)
+
+// QuoteString returns the SQL string literal of this value. Values which are not valid UTF-8 are returned as hex
+// literals like X'ff', since they can't be sent as text through connections with utf8mb4 charset.
+func QuoteString(s string) string {
+	if !utf8.ValidString(s) {
+		return "X'" + hex.EncodeToString([]byte(s)) + "'"
+	}
+	return "'" + stringEscaper.Replace(s) + "'"
+}
+
+var likeEscaper = strings.NewReplacer(`\`, `\\`, `%`, `\%`, `_`, `\_`)
+
+// QuoteLikePrefix returns the pattern literal of LIKE matching all values with this prefix, whose wildcards are
+// escaped in both the pattern and the string literal.
+func QuoteLikePrefix(prefix string) string {
+	return QuoteString(likeEscaper.Replace(prefix) + "%")
+}
+
+// UnquoteString returns the value of this SQL string literal generated by QuoteString, and false if it's not one.
+func UnquoteString(lit string) (string, bool) {
+	if len(lit) >= 3 && (lit[0] == 'X' || lit[0] == 'x') && lit[1] == '\'' && lit[len(lit)-1] == '\'' {
+		b, err := hex.DecodeString(lit[2 : len(lit)-1])
+		return string(b), err == nil
+	}
+	if len(lit) < 2 || lit[0] != '\'' || lit[len(lit)-1] != '\'' {
+		return "", false
+	}
+	var b strings.Builder
+	body := lit[1 : len(lit)-1]
+	for i := 0; i < len(body); i++ {
+		switch c := body[i]; {
+		case c == '\'':
+			if i+1 >= len(body) || body[i+1] != '\'' {
+				return "", false
+			}
+			b.WriteByte('\'')
+			i++
+		case c == '\\':
+			if i+1 >= len(body) {
+				return "", false
+			}
+			i++
+			switch body[i] {
+			case '0':
+				b.WriteByte(0)
+			case 'n':
+				b.WriteByte('\n')
+			case 'r':
+				b.WriteByte('\r')
+			case 'Z':
+				b.WriteByte('\x1a')
+			default:
+				b.WriteByte(body[i])
+			}
+		default:
+			b.WriteByte(c)
+		}
+	}
+	return b.String(), true
+}
+
+// literal returns the SQL literal of this value of this type, only values of quoted types are quoted.
+func (dt DATATYPE) literal(v string) string {
+	if dt.quoted() {
+		return QuoteString(v)
+	}
+	return v
+}
@@ -0,0 +1,344 @@
+package cetest
+
+import (
+	"bytes"
+	"fmt"
+	"math"
+	"regexp"
+	"sort"
+	"strings"
+
+	"github.com/pingcap/errors"
+	"github.com/qw4990/OptimizerTester/tidb"
+)
+
+// RemediationOpt tests candidate statistics remediations of the worst-estimated columns after the run. For each
+// candidate, tables of these columns are copied into the database "<db>_remedy" and analyzed with the candidate, and
+// cases referencing these columns are estimated on the copy again, so reports show the fix which improves them most.
+// The database is a scratch database, which must not exist before and is dropped afterwards, see scratchDBs.
+type RemediationOpt struct {
+	Columns    int      `toml:"columns"`    // number of the worst-estimated columns of each dataset remediated on each instance, disabled if 0
+	MinPError  float64  `toml:"min-perror"` // columns whose mean absolute PErrors are below this are not remediated, 1 if 0
+	Candidates []string `toml:"candidates"` // names of candidates in remediationCandidates, all of them if empty
+}
+
+const defaultRemediationMinPError = 1
+
+func (ro RemediationOpt) check(opt Option) error {
+	if ro.Columns < 0 || ro.MinPError < 0 {
+		return errors.Errorf("invalid remediation columns=%v or min-perror=%v", ro.Columns, ro.MinPError)
+	}
+	if ro.Columns > 0 && opt.ReadOnly {
+		return errors.Errorf("remediation is not allowed in read-only mode since it copies tables")
+	}
+	if ro.Columns > 0 {
+		for _, ds := range opt.Datasets {
+			for _, db := range append([]string{ds.DB, ds.Scratch.DB}, ds.DBs...) {
+				if db == "" {
+					continue
+				}
+				if err := checkScratchDB(remediationDB(db), opt); err != nil {
+					return errors.Errorf("invalid remediation database of dataset=%v, err=%v", ds.Label, err)
+				}
+				for _, other := range opt.Datasets {
+					if strings.EqualFold(other.Scratch.DB, remediationDB(db)) {
+						return errors.Errorf("remediation database %v is the scratch database of dataset=%v", remediationDB(db), other.Label)
+					}
+				}
+			}
+		}
+	}
+	for _, name := range ro.Candidates {
+		if _, ok := findRemediationCandidate(name); !ok {
+			return errors.Errorf("unknown remediation candidate=%v", name)
+		}
+	}
+	return nil
+}
+
+// remediationDB returns the scratch database of remediations of tables in this database.
+func remediationDB(db string) string {
+	return db + "_remedy"
+}
+
+func (ro RemediationOpt) minPError() float64 {
+	if ro.MinPError > 0 {
+		return ro.MinPError
+	}
+	return defaultRemediationMinPError
+}
+
+func (ro RemediationOpt) candidates() []remediationCandidate {
+	if len(ro.Candidates) == 0 {
+		return remediationCandidates
+	}
+	var cands []remediationCandidate
+	for _, name := range ro.Candidates {
+		c, _ := findRemediationCandidate(name)
+		cands = append(cands, c)
+	}
+	return cands
+}
+
+// remediationCandidate is a way to collect statistics of a table, stmts returns statements collecting them on the
+// copied table for these columns, whose first one is the remediated column, or nil if it's not applicable.
+type remediationCandidate struct {
+	name  string
+	desc  string
+	stmts func(tbl string, cols []string) []string
+}
+
+// extendedStatsVar enables extended statistics, which is only read by new sessions once it's set globally.
+const extendedStatsVar = "tidb_enable_extended_stats"
+
+var remediationCandidates = []remediationCandidate{ // read-only
+	{"buckets", "ANALYZE WITH 1024 BUCKETS", func(tbl string, cols []string) []string {
+		return []string{fmt.Sprintf("ANALYZE TABLE %v WITH 1024 BUCKETS", tbl)}
+	}},
+	{"topn", "ANALYZE WITH 500 TOPN", func(tbl string, cols []string) []string {
+		return []string{fmt.Sprintf("ANALYZE TABLE %v WITH 500 TOPN", tbl)}
+	}},
+	{"sample-rate", "ANALYZE WITH 1 SAMPLERATE", func(tbl string, cols []string) []string {
+		return []string{fmt.Sprintf("ANALYZE TABLE %v WITH 1 SAMPLERATE", tbl)}
+	}},
+	{"extended-stats", "correlation extended statistics with another filtered column", func(tbl string, cols []string) []string {
+		if len(cols) < 2 {
+			return nil
+		}
+		return []string{
+			fmt.Sprintf("ALTER TABLE %v ADD STATS_EXTENDED remedy_corr CORRELATION(%v, %v)", tbl, cols[0], cols[1]),
+			fmt.Sprintf("ANALYZE TABLE %v", tbl),
+		}
+	}},
+}
+
+func findRemediationCandidate(name string) (remediationCandidate, bool) {
+	for _, c := range remediationCandidates {
+		if strings.EqualFold(c.name, name) {
+			return c, true
+		}
+	}
+	return remediationCandidate{}, false
+}
+
+// RemediationResult is the estimation of a case on a copy of its table with a remediation of a column.
+type RemediationResult struct {
+	Column      string // the remediated column like "t.a"
+	Remediation string // name of the candidate
+	EstCard     float64
+}
+
+// remediateColumns tries all candidate remediations of the worst-estimated columns of each dataset on each
+// instance, and keeps new estimations of cases referencing them in results.
+func remediateColumns(opt Option, instances []tidb.Instance, collector EstResultCollector) error {
+	if opt.Remediation.Columns <= 0 {
+		return nil
+	}
+	for insIdx, ins := range instances {
+		for dsIdx := range opt.Datasets {
+			n := 0
+			for _, ce := range rankColumnErrors(opt, collector, dsIdx, insIdx) {
+				if n >= opt.Remediation.Columns || ce.mean() < opt.Remediation.minPError() {
+					break
+				}
+				db, tb, ok := columnTable(ce.worst.SQL, ce.column)
+				if !ok {
+					continue
+				}
+				if err := remediateColumn(opt, insIdx, ins, dsIdx, db, tb, ce, collector); err != nil {
+					return fmt.Errorf("remediate column %v on %v, err=%v", ce.column, ins.Opt().Label, err)
+				}
+				n++
+			}
+		}
+	}
+	return nil
+}
+
+// columnTable returns the database and the table of this column like "t.a" read by this SQL.
+func columnTable(sql, column string) (string, string, bool) {
+	tb := column[:strings.LastIndex(column, ".")+1]
+	if tb == "" {
+		return "", "", false
+	}
+	for _, m := range tableRefPattern.FindAllStringSubmatch(sql, -1) {
+		if strings.EqualFold(m[2]+".", tb) {
+			return m[1], m[2], true
+		}
+	}
+	return "", "", false
+}
+
+func remediateColumn(opt Option, insIdx int, ins tidb.Instance, dsIdx int, db, tb string, ce *columnErrors, collector EstResultCollector) error {
+	scratchDB := remediationDB(db)
+	scratchTbl := scratchDB + "." + tb
+	cols := []string{ce.column[strings.LastIndex(ce.column, ".")+1:]}
+	for _, c := range predicateColumns(ce.worst.SQL) {
+		if c != ce.column && strings.HasPrefix(c, strings.ToLower(tb)+".") {
+			cols = append(cols, c[len(tb)+1:])
+			break
+		}
+	}
+	refPattern := regexp.MustCompile(fmt.Sprintf("(?i)\\b`?%v`?\\.`?%v`?\\b", regexp.QuoteMeta(db), regexp.QuoteMeta(tb)))
+	defer func() {
+		if err := opt.scratches.drop(ins, scratchDB); err != nil {
+			fmt.Printf("[Remediation] drop the scratch database %v on %v, err=%v\n", scratchDB, ins.Opt().Label, err)
+		}
+	}()
+	for _, cand := range opt.Remediation.candidates() {
+		stmts := cand.stmts(scratchTbl, cols)
+		if stmts == nil {
+			continue
+		}
+		if cand.name == "extended-stats" && ins.Opt().Serverless {
+			fmt.Printf("[Remediation] skip candidate %v on serverless instance %v, which doesn't support SET GLOBAL\n", cand.name, ins.Opt().Label)
+			continue
+		}
+		if err := opt.scratches.create(ins, scratchDB); err != nil {
+			return err
+		}
+		if err := cloneTable(ins, db, tb, scratchDB, 0); err != nil {
+			return err
+		}
+		estimate := func(ins tidb.Instance) error {
+			for _, sql := range stmts {
+				if err := ins.Exec(sql); err != nil {
+					return err
+				}
+			}
+			for qtIdx := range opt.QueryTypes {
+				for i, r := range collector.EstResults(insIdx, dsIdx, qtIdx) {
+					if !refPattern.MatchString(r.SQL) || !containsColumn(predicateColumns(r.SQL), ce.column) {
+						continue
+					}
+					rr, err := getEstResultFromExplain(ins, refPattern.ReplaceAllString(r.SQL, scratchTbl), false)
+					if err != nil {
+						return err
+					}
+					r.Remediations = append(r.Remediations, RemediationResult{Column: ce.column, Remediation: cand.name, EstCard: rr.EstCard})
+					collector.UpdateEstResult(insIdx, dsIdx, qtIdx, i, r)
+				}
+			}
+			return nil
+		}
+		var err error
+		if cand.name == "extended-stats" {
+			err = withExtendedStats(ins, estimate)
+		} else {
+			err = estimate(ins)
+		}
+		if err != nil {
+			return fmt.Errorf("candidate %v, err=%v", cand.name, err)
+		}
+	}
+	return nil
+}
+
+func containsColumn(cols []string, col string) bool {
+	for _, c := range cols {
+		if c == col {
+			return true
+		}
+	}
+	return false
+}
+
+// withExtendedStats enables extended statistics globally and runs f on new connections to this instance, which
+// read the global value, and restores the previous value at the end.
+func withExtendedStats(ins tidb.Instance, f func(ins tidb.Instance) error) error {
+	_, rows, err := queryText(ins, fmt.Sprintf("SELECT @@GLOBAL.%v", extendedStatsVar))
+	if err != nil {
+		return err
+	}
+	if err := ins.Exec(fmt.Sprintf("SET GLOBAL %v = ON", extendedStatsVar)); err != nil {
+		return err
+	}
+	defer func() {
+		if err := ins.Exec(fmt.Sprintf("SET GLOBAL %v = '%v'", extendedStatsVar, rows[0][0])); err != nil {
+			fmt.Printf("[Remediation] restore %v on %v, err=%v\n", extendedStatsVar, ins.Opt().Label, err)
+		}
+	}()
+	o := ins.Opt()
+	o.Snapshot = ""
+	fresh, err := tidb.ConnectTo(o)
+	if err != nil {
+		return err
+	}
+	defer fresh.Close()
+	return f(fresh)
+}
+
+// remediationErrors are absolute PErrors of cases of a column before and after a remediation.
+type remediationErrors struct {
+	cases         int
+	before, after float64
+}
+
+// writeRemediations writes the candidate which improves estimations of each remediated column most in this cell,
+// with mean absolute PErrors of its cases before and after it. It's skipped if no column is remediated.
+func writeRemediations(md *bytes.Buffer, opt Option, collector EstResultCollector, dsIdx, qtIdx int) {
+	header := false
+	for insIdx, ins := range opt.Instances {
+		errs := make(map[string]map[string]*remediationErrors) // column, candidate, errors
+		for _, r := range collector.EstResults(insIdx, dsIdx, qtIdx) {
+			for _, rr := range r.Remediations {
+				if errs[rr.Column] == nil {
+					errs[rr.Column] = make(map[string]*remediationErrors)
+				}
+				re := errs[rr.Column][rr.Remediation]
+				if re == nil {
+					re = &remediationErrors{}
+					errs[rr.Column][rr.Remediation] = re
+				}
+				re.cases++
+				re.before += math.Abs(PError(r))
+				re.after += math.Abs(PError(EstResult{EstCard: rr.EstCard, TrueCard: r.TrueCard}))
+			}
+		}
+		if len(errs) == 0 {
+			continue
+		}
+		if !header {
+			md.WriteString("\nSuggested Statistics Fixes\n")
+			md.WriteString("\n| Instance | Column | Suggested Fix | Cases | Mean Abs PError Before | Mean Abs PError After | Improvement | Other Candidates |\n")
+			md.WriteString("| ---- | ---- | ---- | ---- | ---- | ---- | ---- | ---- |\n")
+			header = true
+		}
+		cols := make([]string, 0, len(errs))
+		for col := range errs {
+			cols = append(cols, col)
+		}
+		sort.Strings(cols)
+		for _, col := range cols {
+			var best remediationCandidate
+			var bestErrs *remediationErrors
+			for _, cand := range remediationCandidates {
+				re, ok := errs[col][cand.name]
+				if ok && (bestErrs == nil || re.after/float64(re.cases) < bestErrs.after/float64(bestErrs.cases)) {
+					best, bestErrs = cand, re
+				}
+			}
+			var others []string
+			for _, cand := range remediationCandidates {
+				if re, ok := errs[col][cand.name]; ok && cand.name != best.name {
+					others = append(others, fmt.Sprintf("%v: %.3f", cand.name, re.after/float64(re.cases)))
+				}
+			}
+			othersText := "-"
+			if len(others) > 0 {
+				othersText = strings.Join(others, ", ")
+			}
+			before, after := bestErrs.before/float64(bestErrs.cases), bestErrs.after/float64(bestErrs.cases)
+			fix := fmt.Sprintf("%v (%v)", best.name, best.desc)
+			if after >= before {
+				fix = "none"
+			}
+			improvement := 0.0
+			if before > 0 {
+				improvement = (before - after) * 100 / before
+			}
+			md.WriteString(fmt.Sprintf("| %v | %v | %v | %v | %.3f | %.3f | %.1f%% | %v |\n", ins.Label, col, fix, bestErrs.cases,
+				before, after, improvement, othersText))
+		}
+	}
+}
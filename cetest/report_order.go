@@ -0,0 +1,195 @@
+package cetest
+
+import (
+	"hash/fnv"
+	"image/color"
+	"sort"
+
+	"github.com/pingcap/errors"
+	"github.com/qw4990/OptimizerTester/tidb"
+	"gonum.org/v1/plot/plotutil"
+)
+
+// ReportOrderOpt is the explicit order of instances, datasets and query types in reports.
+// Listed ones come first in the given order, and the others follow sorted by their labels, or by their
+// definitions for query types, so reports of runs with the same config can be diffed whatever the order in it.
+type ReportOrderOpt struct {
+	Instances  []string `toml:"instances"`   // labels of instances
+	Datasets   []string `toml:"datasets"`    // labels of datasets
+	QueryTypes []string `toml:"query-types"` // names of query types, like "single-col-point-query-on-col"
+}
+
+func (ro ReportOrderOpt) check(opt Option) error {
+	for _, c := range []struct {
+		kind     string
+		explicit []string
+		names    []string
+	}{{"instance", ro.Instances, opt.instanceLabels()}, {"dataset", ro.Datasets, opt.datasetLabels()}, {"query type", ro.QueryTypes, opt.queryTypeNames()}} {
+		listed := make(map[string]bool, len(c.explicit))
+		for _, name := range c.explicit {
+			if listed[name] {
+				return errors.Errorf("duplicated %v=%v in report-order", c.kind, name)
+			}
+			listed[name] = true
+			if indexOf(c.names, name) < 0 {
+				return errors.Errorf("unknown %v=%v in report-order", c.kind, name)
+			}
+		}
+	}
+	return nil
+}
+
+func indexOf(names []string, name string) int {
+	for i, n := range names {
+		if n == name {
+			return i
+		}
+	}
+	return -1
+}
+
+// reportOrder returns indexes of these names in the order of reports, explicit ones come first and the others are
+// sorted by less, which is stable so duplicated names keep their order in the config.
+func reportOrder(names, explicit []string, less func(i, j int) bool) []int {
+	order := make([]int, 0, len(names))
+	listed := make([]bool, len(names))
+	for _, name := range explicit {
+		for i, n := range names {
+			if n == name && !listed[i] {
+				order = append(order, i)
+				listed[i] = true
+			}
+		}
+	}
+	rest := make([]int, 0, len(names)-len(order))
+	for i := range names {
+		if !listed[i] {
+			rest = append(rest, i)
+		}
+	}
+	sort.SliceStable(rest, func(i, j int) bool { return less(rest[i], rest[j]) })
+	return append(order, rest...)
+}
+
+// orderNames sorts these names in place in the order of reports.
+func orderNames(names, explicit []string) {
+	sorted := make([]string, len(names))
+	for i, idx := range reportOrder(names, explicit, func(i, j int) bool { return names[i] < names[j] }) {
+		sorted[i] = names[idx]
+	}
+	copy(names, sorted)
+}
+
+// orderedForReport returns a view of this run whose instances, datasets and query types are in the order of
+// reports, results in the collector are reordered accordingly without being copied.
+func (opt Option) orderedForReport(collector EstResultCollector) (Option, EstResultCollector) {
+	insLabels, dsLabels, qtNames := opt.instanceLabels(), opt.datasetLabels(), opt.queryTypeNames()
+	oc := &orderedCollector{
+		EstResultCollector: collector,
+		ins:                reportOrder(insLabels, opt.ReportOrder.Instances, func(i, j int) bool { return insLabels[i] < insLabels[j] }),
+		ds:                 reportOrder(dsLabels, opt.ReportOrder.Datasets, func(i, j int) bool { return dsLabels[i] < dsLabels[j] }),
+		qt:                 reportOrder(qtNames, opt.ReportOrder.QueryTypes, func(i, j int) bool { return opt.QueryTypes[i] < opt.QueryTypes[j] }),
+	}
+
+	ordered := opt
+	ordered.Instances = make([]tidb.Option, len(oc.ins))
+	ordered.insVersions, ordered.insCommits = nil, nil
+	for i, idx := range oc.ins {
+		ordered.Instances[i] = opt.Instances[idx]
+		if idx < len(opt.insVersions) {
+			ordered.insVersions = append(ordered.insVersions, opt.insVersions[idx])
+		}
+		if idx < len(opt.insCommits) {
+			ordered.insCommits = append(ordered.insCommits, opt.insCommits[idx])
+		}
+	}
+	ordered.Datasets = make([]DatasetOpt, len(oc.ds))
+	for i, idx := range oc.ds {
+		ordered.Datasets[i] = opt.Datasets[idx]
+	}
+	ordered.QueryTypes = make([]QueryType, len(oc.qt))
+	for i, idx := range oc.qt {
+		ordered.QueryTypes[i] = opt.QueryTypes[idx]
+	}
+	return ordered, oc
+}
+
+func (opt Option) instanceLabels() []string {
+	labels := make([]string, len(opt.Instances))
+	for i, ins := range opt.Instances {
+		labels[i] = ins.Label
+	}
+	return labels
+}
+
+func (opt Option) datasetLabels() []string {
+	labels := make([]string, len(opt.Datasets))
+	for i, ds := range opt.Datasets {
+		labels[i] = ds.Label
+	}
+	return labels
+}
+
+func (opt Option) queryTypeNames() []string {
+	names := make([]string, len(opt.QueryTypes))
+	for i, qt := range opt.QueryTypes {
+		names[i] = qt.String()
+	}
+	return names
+}
+
+// orderedCollector maps indexes of reordered instances, datasets and query types to those of the collector.
+type orderedCollector struct {
+	EstResultCollector
+	ins, ds, qt []int // original indexes of reordered ones
+}
+
+func (c *orderedCollector) AddEstResult(insIdx, dsIdx, qtIdx int, r EstResult) {
+	c.EstResultCollector.AddEstResult(c.ins[insIdx], c.ds[dsIdx], c.qt[qtIdx], r)
+}
+
+func (c *orderedCollector) AppendEstResults(insIdx, dsIdx, qtIdx int, ers []EstResult) {
+	c.EstResultCollector.AppendEstResults(c.ins[insIdx], c.ds[dsIdx], c.qt[qtIdx], ers)
+}
+
+func (c *orderedCollector) EstResults(insIdx, dsIdx, qtIdx int) []EstResult {
+	return c.EstResultCollector.EstResults(c.ins[insIdx], c.ds[dsIdx], c.qt[qtIdx])
+}
+
+func (c *orderedCollector) UpdateEstResult(insIdx, dsIdx, qtIdx, idx int, r EstResult) {
+	c.EstResultCollector.UpdateEstResult(c.ins[insIdx], c.ds[dsIdx], c.qt[qtIdx], idx, r)
+}
+
+func (c *orderedCollector) LabeledEstResults(labels string, insIdx, dsIdx, qtIdx int) []EstResult {
+	return c.EstResultCollector.LabeledEstResults(labels, c.ins[insIdx], c.ds[dsIdx], c.qt[qtIdx])
+}
+
+// instancePalette is the palette of instances in charts.
+var instancePalette = append(append([]color.Color{}, plotutil.DarkColors...), plotutil.SoftColors...)
+
+// instanceColors returns colors of these instances in charts. The color of an instance is picked by the hash of its
+// label, so it's the same across runs and reports; labels are resolved in sorted order when their hashes collide,
+// so the assignment doesn't depend on the order of instances either.
+func instanceColors(labels []string) []color.Color {
+	sorted := append([]string{}, labels...)
+	sort.Strings(sorted)
+	picked := make(map[string]int, len(labels))
+	used := make(map[int]bool, len(labels))
+	for _, label := range sorted {
+		if _, ok := picked[label]; ok {
+			continue
+		}
+		h := fnv.New32a()
+		h.Write([]byte(label))
+		c := int(h.Sum32() % uint32(len(instancePalette)))
+		for i := 0; i < len(instancePalette) && used[c]; i++ {
+			c = (c + 1) % len(instancePalette)
+		}
+		picked[label], used[c] = c, true
+	}
+	colors := make([]color.Color, len(labels))
+	for i, label := range labels {
+		colors[i] = instancePalette[picked[label]]
+	}
+	return colors
+}
@@ -0,0 +1,110 @@
+package cetest
+
+import (
+	"bytes"
+	"io/ioutil"
+	"strings"
+	"text/template"
+
+	"github.com/pingcap/errors"
+)
+
+// ReportTemplateOpt contains paths of Go templates (text/template) replacing sections of report.md,
+// so reports can match internal formats, including HTML embedded in Markdown. Default sections are used if empty.
+//
+// The header and the footer are executed with ReportData, and the cell template is executed with ReportCell
+// once for each dataset of each query type.
+type ReportTemplateOpt struct {
+	Header string `toml:"header"` // replaces the table of instances at the beginning
+	Cell   string `toml:"cell"`   // replaces the section of each dataset
+	Footer string `toml:"footer"` // appended at the end, nothing by default
+
+	header, cell, footer *template.Template
+}
+
+// ReportData is the data of header and footer templates.
+type ReportData struct {
+	Instances  []ReportInstance
+	QueryTypes []string
+	Datasets   []string
+	Sections   map[string]string // default sections in Markdown, "instances", "config-diff", "stats-changes", "write-load", "failures", "lint", "execution-skew", "coverage", "column-errors" and "provenance", which are empty if unused
+}
+
+// ReportInstance describes an instance in reports.
+type ReportInstance struct {
+	Label    string
+	Version  string    // "-" if unknown
+	Metadata string    // see tidb.Option.MetadataText
+	RTT      *RTTStats `json:",omitempty"` // nil unless the latency-aware mode is enabled
+}
+
+// ReportCell is the data of cell templates.
+type ReportCell struct {
+	QueryType string
+	Dataset   string
+	Chart     string // file name of the PError chart
+	Latency   string // file name of the chart of errors and plan latencies, empty if latencies are not collected
+	Instances []ReportCellInstance
+
+	// Sections are default sections of this cell in Markdown keyed by names in reportSections,
+	// empty if the section is skipped, so templates can reorder or drop them.
+	Sections map[string]string
+}
+
+// ReportCellInstance contains statistics of an instance in a cell.
+type ReportCellInstance struct {
+	Instance string
+	Page     string            // path of the drill-down page relative to ReportDir
+	Over     map[string]string // statistics of over-estimations, keyed by "tot", "p50", "p90", "p99" and "max"
+	Under    map[string]string // statistics of under-estimations, with the same keys as Over
+}
+
+// reportSections are names of default sections of each cell in their default order.
+var reportSections = []string{"skipped", "chart", "over-estimation", "under-estimation", "selectivity", "selectivity-error", "default-selectivity", "tag", "label",
+	"plan-latency", "resource-usage", "plan-shapes", "statements-summary", "point-get", "mpp-joins", "index-lookup",
+	"risk", "what-if", "remediation", "exec-time", "join-order", "trace-steps", "topn-check", "unstable-estimates", "write-load"}
+
+var reportTemplateFuncs = template.FuncMap{ // read-only
+	"join":  strings.Join,
+	"upper": strings.ToUpper,
+	"lower": strings.ToLower,
+}
+
+func (rt *ReportTemplateOpt) check() error {
+	var err error
+	if rt.header, err = parseReportTemplate(rt.Header); err != nil {
+		return err
+	}
+	if rt.cell, err = parseReportTemplate(rt.Cell); err != nil {
+		return err
+	}
+	rt.footer, err = parseReportTemplate(rt.Footer)
+	return err
+}
+
+func parseReportTemplate(p string) (*template.Template, error) {
+	if p == "" {
+		return nil, nil
+	}
+	content, err := ioutil.ReadFile(p)
+	if err != nil {
+		return nil, errors.Trace(err)
+	}
+	t, err := template.New(p).Funcs(reportTemplateFuncs).Parse(string(content))
+	if err != nil {
+		return nil, errors.Errorf("invalid report template %v, err=%v", p, err)
+	}
+	return t, nil
+}
+
+// executeReportTemplate executes this template into md if it's not nil, or writes the default content.
+func executeReportTemplate(md *bytes.Buffer, t *template.Template, data interface{}, defaultContent string) error {
+	if t == nil {
+		md.WriteString(defaultContent)
+		return nil
+	}
+	if err := t.Execute(md, data); err != nil {
+		return errors.Errorf("execute report template %v, err=%v", t.Name(), err)
+	}
+	return nil
+}
@@ -0,0 +1,272 @@
+package cetest
+
+import (
+	"encoding/json"
+	"encoding/xml"
+	"fmt"
+	"html/template"
+	"io/ioutil"
+	"os"
+	"path"
+	"strings"
+
+	"github.com/pingcap/errors"
+)
+
+// reporterMap contains all reporters selectable by Option.Reporters, which generate different kinds of reports
+// from the same collected results of a run into ReportDir.
+var reporterMap = map[string]func(opt Option, collector EstResultCollector) error{ // read-only
+	"markdown": GenPErrorBarChartsReport, // report.md with charts and all sections
+	"charts":   GenChartsReport,          // charts only
+	"json":     GenJSONReport,            // report.json with statistics of all cells
+	"junit":    GenJUnitReport,           // report.xml with a test case for each cell and instance, see JUnitOpt
+	"html":     GenHTMLReport,            // report.html with charts and statistics of all cells
+}
+
+// defaultReporters are reporters used if Option.Reporters is empty.
+var defaultReporters = []string{"markdown"}
+
+// JUnitOpt decides which cells fail in JUnit reports, so CI systems can show regressions of estimations.
+type JUnitOpt struct {
+	MaxP90 float64 `toml:"max-p90"` // a cell fails on an instance if P90 of its absolute PErrors exceeds this, no cell fails if it's 0
+}
+
+func checkReporters(opt Option) error {
+	for _, r := range opt.Reporters {
+		if _, ok := reporterMap[strings.ToLower(r)]; !ok {
+			return errors.Errorf("unknown reporter=%v", r)
+		}
+	}
+	if opt.Email.Addr != "" && len(opt.Reporters) > 0 && !containsFold(opt.Reporters, "markdown") {
+		return errors.Errorf("the email requires the markdown reporter since report.md is sent")
+	}
+	if opt.JUnit.MaxP90 < 0 {
+		return errors.Errorf("invalid junit max-p90=%v", opt.JUnit.MaxP90)
+	}
+	return nil
+}
+
+func containsFold(ss []string, s string) bool {
+	for _, x := range ss {
+		if strings.EqualFold(x, s) {
+			return true
+		}
+	}
+	return false
+}
+
+// GenReports generates reports of all reporters in Option.Reporters.
+func GenReports(opt Option, collector EstResultCollector) error {
+	reporters := opt.Reporters
+	if len(reporters) == 0 {
+		reporters = defaultReporters
+	}
+	if err := os.MkdirAll(opt.ReportDir, 0755); err != nil {
+		return errors.Trace(err)
+	}
+	for _, r := range reporters {
+		if err := reporterMap[strings.ToLower(r)](opt, collector); err != nil {
+			return fmt.Errorf("generate the %v report, err=%v", r, err)
+		}
+	}
+	return nil
+}
+
+// GenChartsReport draws the PError chart of each cell and the QError box plot of each query type without any report.
+func GenChartsReport(opt Option, collector EstResultCollector) error {
+	if err := os.MkdirAll(opt.ReportDir, 0755); err != nil {
+		return errors.Trace(err)
+	}
+	opt, collector = opt.orderedForReport(collector)
+	for qtIdx := range opt.QueryTypes {
+		for dsIdx := range opt.Datasets {
+			if _, err := DrawBarChartsGroupByQTAndDS(opt, collector, qtIdx, dsIdx, PError); err != nil {
+				return err
+			}
+		}
+		if _, err := DrawQErrorBoxPlotGroupByQueryType(opt, collector, qtIdx); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// JSONReport is the content of report.json.
+type JSONReport struct {
+	Instances []ReportInstance `json:"instances"`
+	Cells     []CellSummary    `json:"cells"` // cells without results are absent
+}
+
+// GenJSONReport writes statistics of absolute PErrors of all cells into report.json.
+func GenJSONReport(opt Option, collector EstResultCollector) error {
+	opt, collector = opt.orderedForReport(collector)
+	report := JSONReport{Instances: reportInstances(opt), Cells: summarizeCells(opt, collector)}
+	content, err := json.MarshalIndent(report, "", "  ")
+	if err != nil {
+		return errors.Trace(err)
+	}
+	return errors.Trace(ioutil.WriteFile(path.Join(opt.ReportDir, "report.json"), content, 0666))
+}
+
+// summarizeCells returns statistics of all cells with results.
+func summarizeCells(opt Option, collector EstResultCollector) []CellSummary {
+	var cells []CellSummary
+	for qtIdx, qt := range opt.QueryTypes {
+		for dsIdx, ds := range opt.Datasets {
+			for insIdx, ins := range opt.Instances {
+				if cs, ok := summarizeCell(ins.Label, ds.Label, qt.String(), collector.EstResults(insIdx, dsIdx, qtIdx)); ok {
+					cells = append(cells, cs)
+				}
+			}
+		}
+	}
+	return cells
+}
+
+type junitSuites struct {
+	XMLName xml.Name     `xml:"testsuites"`
+	Suites  []junitSuite `xml:"testsuite"`
+}
+
+type junitSuite struct {
+	Name     string      `xml:"name,attr"`
+	Tests    int         `xml:"tests,attr"`
+	Failures int         `xml:"failures,attr"`
+	Skipped  int         `xml:"skipped,attr"`
+	Cases    []junitCase `xml:"testcase"`
+}
+
+type junitCase struct {
+	Name      string        `xml:"name,attr"`
+	ClassName string        `xml:"classname,attr"`
+	Failure   *junitMessage `xml:"failure"`
+	Skipped   *junitMessage `xml:"skipped"`
+	SystemOut string        `xml:"system-out,omitempty"`
+}
+
+type junitMessage struct {
+	Message string `xml:"message,attr"`
+}
+
+// GenJUnitReport writes report.xml in the JUnit format, each query type is a suite and each dataset and instance
+// is a test case, which fails if P90 of its absolute PErrors exceeds JUnitOpt.MaxP90.
+func GenJUnitReport(opt Option, collector EstResultCollector) error {
+	opt, collector = opt.orderedForReport(collector)
+	var report junitSuites
+	for qtIdx, qt := range opt.QueryTypes {
+		suite := junitSuite{Name: qt.String()}
+		for dsIdx, ds := range opt.Datasets {
+			for insIdx, ins := range opt.Instances {
+				c := junitCase{Name: fmt.Sprintf("%v/%v", ds.Label, ins.Label), ClassName: qt.String()}
+				cs, ok := summarizeCell(ins.Label, ds.Label, qt.String(), collector.EstResults(insIdx, dsIdx, qtIdx))
+				switch {
+				case opt.unsupported(insIdx, qt):
+					c.Skipped = &junitMessage{Message: fmt.Sprintf("%v requires %v", qt, opt.minVersion(qt))}
+					suite.Skipped++
+				case !ok:
+					c.Skipped = &junitMessage{Message: "no results"}
+					suite.Skipped++
+				default:
+					c.SystemOut = fmt.Sprintf("total=%v, p50=%.3f, p90=%.3f, p99=%.3f, max=%.3f", cs.Total, cs.P50, cs.P90, cs.P99, cs.Max)
+					if opt.JUnit.MaxP90 > 0 && cs.P90 > opt.JUnit.MaxP90 {
+						c.Failure = &junitMessage{Message: fmt.Sprintf("p90 of absolute PErrors %.3f exceeds %v", cs.P90, opt.JUnit.MaxP90)}
+						suite.Failures++
+					}
+				}
+				suite.Cases = append(suite.Cases, c)
+				suite.Tests++
+			}
+		}
+		report.Suites = append(report.Suites, suite)
+	}
+	content, err := xml.MarshalIndent(report, "", "  ")
+	if err != nil {
+		return errors.Trace(err)
+	}
+	content = append([]byte(xml.Header), content...)
+	return errors.Trace(ioutil.WriteFile(path.Join(opt.ReportDir, "report.xml"), content, 0666))
+}
+
+var htmlReportTemplate = template.Must(template.New("report.html").Parse(`<!DOCTYPE html>
+<html>
+<head>
+<meta charset="utf-8">
+<title>CETest Report</title>
+<style>
+body { font-family: sans-serif; margin: 2em; }
+table { border-collapse: collapse; margin: 1em 0; }
+th, td { border: 1px solid #ccc; padding: 4px 8px; text-align: right; }
+th:first-child, td:first-child { text-align: left; }
+</style>
+</head>
+<body>
+<h1>Instances</h1>
+<table>
+<tr><th>Instance</th><th>Version</th><th>Metadata</th></tr>
+{{- range .Instances}}
+<tr><td>{{.Label}}</td><td>{{.Version}}</td><td>{{.Metadata}}</td></tr>
+{{- end}}
+</table>
+{{- range .QueryTypes}}
+<h1>{{.Name}}</h1>
+{{- range .Cells}}
+<h2>{{.Dataset}}</h2>
+<img src="{{.Chart}}" alt="PError chart of {{.Dataset}}">
+<table>
+<tr><th>Instance</th><th>Total</th><th>P50</th><th>P90</th><th>P99</th><th>Max</th></tr>
+{{- range .Stats}}
+<tr><td>{{.Instance}}</td><td>{{.Total}}</td><td>{{printf "%.3f" .P50}}</td><td>{{printf "%.3f" .P90}}</td><td>{{printf "%.3f" .P99}}</td><td>{{printf "%.3f" .Max}}</td></tr>
+{{- end}}
+</table>
+{{- end}}
+{{- end}}
+</body>
+</html>
+`))
+
+type htmlQueryType struct {
+	Name  string
+	Cells []htmlCell
+}
+
+type htmlCell struct {
+	Dataset string
+	Chart   string
+	Stats   []CellSummary // statistics of absolute PErrors of instances with results
+}
+
+// GenHTMLReport writes report.html with the PError chart and statistics of absolute PErrors of each cell, which can
+// be published as a static page.
+func GenHTMLReport(opt Option, collector EstResultCollector) error {
+	opt, collector = opt.orderedForReport(collector)
+	data := struct {
+		Instances  []ReportInstance
+		QueryTypes []htmlQueryType
+	}{Instances: reportInstances(opt)}
+	for qtIdx, qt := range opt.QueryTypes {
+		hqt := htmlQueryType{Name: qt.String()}
+		for dsIdx, ds := range opt.Datasets {
+			chart, err := DrawBarChartsGroupByQTAndDS(opt, collector, qtIdx, dsIdx, PError)
+			if err != nil {
+				return err
+			}
+			cell := htmlCell{Dataset: ds.Label, Chart: chart}
+			for insIdx, ins := range opt.Instances {
+				if cs, ok := summarizeCell(ins.Label, ds.Label, qt.String(), collector.EstResults(insIdx, dsIdx, qtIdx)); ok {
+					cell.Stats = append(cell.Stats, cs)
+				}
+			}
+			hqt.Cells = append(hqt.Cells, cell)
+		}
+		data.QueryTypes = append(data.QueryTypes, hqt)
+	}
+	f, err := os.Create(path.Join(opt.ReportDir, "report.html"))
+	if err != nil {
+		return errors.Trace(err)
+	}
+	defer f.Close()
+	if err := htmlReportTemplate.Execute(f, data); err != nil {
+		return errors.Trace(err)
+	}
+	return errors.Trace(f.Close())
+}
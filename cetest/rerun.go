@@ -0,0 +1,159 @@
+package cetest
+
+import (
+	"encoding/csv"
+	"fmt"
+	"io"
+	"math"
+	"os"
+	"sort"
+	"strconv"
+	"sync"
+
+	"github.com/pingcap/errors"
+	"github.com/qw4990/OptimizerTester/tidb"
+)
+
+// RerunOpt makes the tester re-run only the worst cases of a previous run instead of generating new cases,
+// which is used to iterate fast when developing a fix of the optimizer.
+// Cases whose absolute PErrors exceed MaxPError or are among the Worst fraction are re-run, true cardinalities
+// of the previous run are reused, so data must not be changed between these two runs.
+type RerunOpt struct {
+	Path        string  `toml:"path"`         // raw results exported as CSV by the previous run
+	Worst       float64 `toml:"worst"`        // fraction of cases with the largest absolute PErrors to re-run, like 0.05
+	MaxPError   float64 `toml:"max-p-error"`  // cases whose absolute PErrors exceed this threshold are considered failed and re-run
+	IgnoreError bool    `toml:"ignore-error"` // skip cases which can't be explained on the new build
+}
+
+func (ro RerunOpt) check() error {
+	if ro.Path == "" {
+		return nil
+	}
+	if ro.Worst < 0 || ro.Worst > 1 {
+		return errors.Errorf("invalid rerun worst=%v", ro.Worst)
+	}
+	if ro.Worst == 0 && ro.MaxPError <= 0 {
+		return errors.Errorf("rerun requires worst or max-p-error")
+	}
+	return nil
+}
+
+type rerunCase struct {
+	dsIdx  int
+	qtIdx  int
+	r      EstResult
+	pError float64 // the largest absolute PError of this case among all instances of the previous run
+}
+
+// readRerunCases reads results of the previous run and returns cases to re-run.
+func readRerunCases(opt Option) ([]rerunCase, error) {
+	f, err := os.Open(opt.Rerun.Path)
+	if err != nil {
+		return nil, errors.Trace(err)
+	}
+	defer f.Close()
+	r := csv.NewReader(f)
+	header, err := r.Read()
+	if err != nil {
+		return nil, errors.Trace(err)
+	}
+	colIdx := make(map[string]int, len(header))
+	for i, h := range header {
+		colIdx[h] = i
+	}
+	for _, c := range []string{"dataset", "query_type", "sql", "est_card", "true_card"} {
+		if _, ok := colIdx[c]; !ok {
+			return nil, errors.Errorf("column %v is missing in %v", c, opt.Rerun.Path)
+		}
+	}
+
+	caseIdx := make(map[string]int) // dataset, query-type and SQL of a case, its index in cases
+	var cases []rerunCase
+	for line := 2; ; line++ {
+		record, err := r.Read()
+		if err == io.EOF {
+			break
+		} else if err != nil {
+			return nil, errors.Trace(err)
+		}
+		ds, qt, sql := record[colIdx["dataset"]], record[colIdx["query_type"]], record[colIdx["sql"]]
+		dsIdx, qtIdx := opt.datasetIdx(ds), opt.queryTypeIdx(qt)
+		if dsIdx == -1 || qtIdx == -1 {
+			continue // not tested in this run
+		}
+		est, err1 := strconv.ParseFloat(record[colIdx["est_card"]], 64)
+		act, err2 := strconv.ParseFloat(record[colIdx["true_card"]], 64)
+		if err1 != nil || err2 != nil {
+			return nil, errors.Errorf("line %v: invalid est_card or true_card", line)
+		}
+		pe := math.Abs(PError(EstResult{EstCard: est, TrueCard: act}))
+		key := fmt.Sprintf("%v\x00%v\x00%v", ds, qt, sql)
+		if i, ok := caseIdx[key]; ok {
+			cases[i].pError = math.Max(cases[i].pError, pe)
+			continue
+		}
+		caseIdx[key] = len(cases)
+		cases = append(cases, rerunCase{dsIdx: dsIdx, qtIdx: qtIdx, r: EstResult{SQL: sql, TrueCard: act}, pError: pe})
+	}
+
+	sort.SliceStable(cases, func(i, j int) bool { return cases[i].pError > cases[j].pError })
+	nWorst := int(math.Ceil(float64(len(cases)) * opt.Rerun.Worst))
+	selected := cases[:0]
+	for i, c := range cases {
+		if i < nWorst || (opt.Rerun.MaxPError > 0 && c.pError > opt.Rerun.MaxPError) {
+			selected = append(selected, c)
+		}
+	}
+	return selected, nil
+}
+
+// labelRerunCases labels these cases by labels of their datasets in this run, like values of the current run of the
+// matrix, instead of labels recorded by the previous run.
+func labelRerunCases(opt Option, cases []rerunCase) {
+	for i := range cases {
+		cases[i].r.Labels = opt.Datasets[cases[i].dsIdx].Labels
+	}
+}
+
+// rerunEstResults re-runs these cases on this instance and puts their results into the collector.
+func rerunEstResults(ins tidb.Instance, insIdx int, cases []rerunCase, collector EstResultCollector, copt collectOpt) error {
+	concurrency := copt.workers()
+	var wg sync.WaitGroup
+	var resultLock sync.Mutex
+	var rerr error
+	for workerID := 0; workerID < concurrency; workerID++ {
+		wg.Add(1)
+		go func(id int) {
+			defer wg.Done()
+			for i := id; i < len(cases); i += concurrency {
+				c := cases[i]
+				copt.acquire()
+				er, err := copt.execute(ins, c.r.SQL, c.r.TrueCard)
+				copt.release()
+				resultLock.Lock()
+				if err != nil {
+					fmt.Println(c.r.SQL, err)
+					copt.fail(c.r.SQL, c.r.TrueCard, err)
+					if !copt.ignoreErr && rerr == nil {
+						rerr = err
+					}
+				} else {
+					r := c.r
+					r.EstCard, r.EstCost, r.PlanLatency, r.Plan, r.PlanFingerprint = er.EstCard, er.EstCost, er.PlanLatency, er.Plan, er.PlanFingerprint
+					r.PlanDigest, r.ExplainRef = er.PlanDigest, er.ExplainRef
+					r.Operators, r.ExecTime, r.MPPJoin, r.PseudoStats = er.Operators, er.ExecTime, er.MPPJoin, er.PseudoStats
+					if r.HasTag(TagCorrelated) {
+						r.ApplyEstRows = er.ApplyEstRows
+						r = correlatedEstResult(r)
+					}
+					copt.writes.churn(copt.ins, &r)
+					collector.AddEstResult(insIdx, c.dsIdx, c.qtIdx, r)
+					copt.observe(r)
+				}
+				resultLock.Unlock()
+			}
+		}(workerID)
+	}
+	wg.Wait()
+	return rerr
+}
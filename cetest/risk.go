@@ -0,0 +1,212 @@
+package cetest
+
+import (
+	"bytes"
+	"fmt"
+	"math"
+	"regexp"
+	"strings"
+
+	"github.com/qw4990/OptimizerTester/tidb"
+)
+
+// Kinds of risky plan choices found in executed plans.
+const (
+	RiskIndexJoinHugeOuter  = "index-join-huge-outer"  // index joins looking up the inner side for too many outer rows
+	RiskHashJoinLargerBuild = "hash-join-larger-build" // hash joins building hash tables on the larger input
+	RiskFullScanWithIndex   = "full-scan-with-index"   // full scans filtering most rows by indexed columns
+)
+
+var riskKinds = []string{RiskIndexJoinHugeOuter, RiskHashJoinLargerBuild, RiskFullScanWithIndex} // read-only
+
+const (
+	riskIndexJoinOuterRows = 10000 // outer rows of index joins above which hash joins are usually better
+	riskHashJoinBuildRows  = 1000  // build rows of hash joins below which building on the larger input is harmless
+	riskFullScanRows       = 1000  // scanned rows of full scans below which they're harmless
+	riskFullScanFraction   = 0.01  // fraction of rows returned by filters on full scans below which indexes are better
+)
+
+// PlanRisk is a risky choice in an executed plan, with the estimation of the operator which drove it.
+type PlanRisk struct {
+	Kind     string
+	Operator string // ID of the operator whose estimation drove this choice
+	EstRows  float64
+	ActRows  float64
+}
+
+// Misestimated returns whether this choice is attributed to an estimation error, whose absolute PError is at least 1,
+// which means the estimation is off by at least 2x.
+func (pr PlanRisk) Misestimated() bool {
+	return math.Abs(PError(EstResult{EstCard: pr.EstRows, TrueCard: pr.ActRows})) >= 1
+}
+
+// columnRefPattern matches qualified columns in operator info, like "test.t.a" in "eq(test.t.a, 1)".
+var columnRefPattern = regexp.MustCompile(`\b(\w+)\.(\w+)\.(\w+)\b`)
+
+// classifyPlanRisks finds risky choices in all executed plans, which requires runtime statistics of operators.
+func classifyPlanRisks(opt Option, instances []tidb.Instance, collector EstResultCollector) error {
+	for insIdx, ins := range instances {
+		indexes := make(map[string]map[string]bool) // db.tb, leading columns of indexes
+		indexed := func(db, tb, col string) (bool, error) {
+			key := strings.ToLower(db + "." + tb)
+			if _, ok := indexes[key]; !ok {
+				cols, err := indexLeadingColumns(ins, db, tb)
+				if err != nil {
+					return false, err
+				}
+				indexes[key] = cols
+			}
+			return indexes[key][strings.ToLower(col)], nil
+		}
+		for dsIdx := range opt.Datasets {
+			for qtIdx := range opt.QueryTypes {
+				for i, r := range collector.EstResults(insIdx, dsIdx, qtIdx) {
+					if len(r.Operators) == 0 {
+						continue
+					}
+					risks, err := planRisks(r.Operators, indexed)
+					if err != nil {
+						return fmt.Errorf("classify risks of %v on %v, err=%v", r.SQL, ins.Opt().Label, err)
+					}
+					if len(risks) > 0 {
+						r.Risks = risks
+						collector.UpdateEstResult(insIdx, dsIdx, qtIdx, i, r)
+					}
+				}
+			}
+		}
+	}
+	return nil
+}
+
+// indexLeadingColumns returns lower-cased leading columns of all indexes of this table.
+func indexLeadingColumns(ins tidb.Instance, db, tb string) (map[string]bool, error) {
+	_, rows, err := queryText(ins, fmt.Sprintf("SELECT LOWER(COLUMN_NAME) FROM information_schema.statistics WHERE TABLE_SCHEMA='%v' AND TABLE_NAME='%v' AND SEQ_IN_INDEX=1", db, tb))
+	if err != nil {
+		return nil, err
+	}
+	cols := make(map[string]bool, len(rows))
+	for _, row := range rows {
+		cols[row[0]] = true
+	}
+	return cols, nil
+}
+
+// planRisks returns risky choices in these operators, indexed returns whether a column leads any index of its table.
+func planRisks(ops []OperatorStats, indexed func(db, tb, col string) (bool, error)) ([]PlanRisk, error) {
+	var risks []PlanRisk
+	for i, op := range ops {
+		children := operatorChildren(ops, i)
+		switch {
+		case strings.HasPrefix(op.ID, "IndexJoin") || strings.HasPrefix(op.ID, "IndexHashJoin") || strings.HasPrefix(op.ID, "IndexMergeJoin"):
+			for _, c := range children {
+				if strings.HasSuffix(ops[c].ID, "(Build)") && ops[c].ActRows > riskIndexJoinOuterRows {
+					risks = append(risks, PlanRisk{RiskIndexJoinHugeOuter, ops[c].ID, ops[c].EstRows, ops[c].ActRows})
+				}
+			}
+		case strings.HasPrefix(op.ID, "HashJoin") && len(children) == 2:
+			build, probe := ops[children[0]], ops[children[1]]
+			if strings.HasSuffix(probe.ID, "(Build)") {
+				build, probe = probe, build
+			}
+			if build.ActRows > riskHashJoinBuildRows && build.ActRows > probe.ActRows {
+				risks = append(risks, PlanRisk{RiskHashJoinLargerBuild, build.ID, build.EstRows, build.ActRows})
+			}
+		case strings.HasPrefix(op.ID, "Selection"):
+			for _, c := range children {
+				scan := ops[c]
+				if !strings.HasPrefix(scan.ID, "TableFullScan") || strings.Contains(scan.Task, "tiflash") ||
+					scan.ActRows < riskFullScanRows || op.ActRows > scan.ActRows*riskFullScanFraction {
+					continue
+				}
+				found, err := filtersOnIndexedColumn(op.Info, scanTable(scan.Object), indexed)
+				if err != nil {
+					return nil, err
+				}
+				if found {
+					risks = append(risks, PlanRisk{RiskFullScanWithIndex, op.ID, op.EstRows, op.ActRows})
+				}
+			}
+		}
+	}
+	return risks, nil
+}
+
+// operatorChildren returns indexes of children of the i-th operator.
+func operatorChildren(ops []OperatorStats, i int) []int {
+	var children []int
+	for j := i + 1; j < len(ops); j++ {
+		if ops[j].Tree != ops[i].Tree || ops[j].Depth <= ops[i].Depth {
+			break
+		}
+		if ops[j].Depth == ops[i].Depth+1 {
+			children = append(children, j)
+		}
+	}
+	return children
+}
+
+// scanTable returns the table in this access object, like "t" in "table:t, partition:p0".
+func scanTable(object string) string {
+	for _, item := range strings.Split(object, ",") {
+		if kv := strings.SplitN(strings.TrimSpace(item), ":", 2); len(kv) == 2 && kv[0] == "table" {
+			return kv[1]
+		}
+	}
+	return ""
+}
+
+// filtersOnIndexedColumn returns whether any column of this table in these filters leads an index.
+func filtersOnIndexedColumn(info, tb string, indexed func(db, tb, col string) (bool, error)) (bool, error) {
+	for _, ref := range columnRefPattern.FindAllStringSubmatch(info, -1) {
+		if !strings.EqualFold(ref[2], tb) {
+			continue
+		}
+		ok, err := indexed(ref[1], ref[2], ref[3])
+		if err != nil || ok {
+			return ok, err
+		}
+	}
+	return false, nil
+}
+
+// writePlanRisks writes a table of risky choices in executed plans of this cell grouped by their kinds, and how many of
+// them are attributed to estimation errors. It's skipped if there is no risky choice.
+func writePlanRisks(md *bytes.Buffer, opt Option, collector EstResultCollector, dsIdx, qtIdx int) {
+	header := false
+	for insIdx, ins := range opt.Instances {
+		for _, kind := range riskKinds {
+			cases, misestimated := 0, 0
+			totPE := 0.0
+			example := ""
+			for _, r := range collector.EstResults(insIdx, dsIdx, qtIdx) {
+				for _, risk := range r.Risks {
+					if risk.Kind != kind {
+						continue
+					}
+					cases++
+					totPE += math.Abs(PError(EstResult{EstCard: risk.EstRows, TrueCard: risk.ActRows}))
+					if risk.Misestimated() {
+						misestimated++
+					}
+					if example == "" {
+						example = fmt.Sprintf("`%v` (%v: est %v, act %v)", strings.Replace(opt.reportSQL(r.SQL), "|", "\\|", -1), risk.Operator,
+							opt.NumberFormat.rows(risk.EstRows), opt.NumberFormat.rows(risk.ActRows))
+					}
+					break
+				}
+			}
+			if cases == 0 {
+				continue
+			}
+			if !header {
+				md.WriteString("\nRisky Plan Choices\n")
+				md.WriteString("\n| Instance | Risk | Cases | Misestimated | Avg Abs PError of Operators | Example |\n")
+				md.WriteString("| ---- | ---- | ---- | ---- | ---- | ---- |\n")
+				header = true
+			}
+			md.WriteString(fmt.Sprintf("| %v | %v | %v | %v | %.3f | %v |\n",
+				ins.Label, kind, cases, misestimated, totPE/float64(cases), example))
+		}
+	}
+}
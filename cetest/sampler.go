@@ -0,0 +1,160 @@
+package cetest
+
+import (
+	"math"
+	"math/rand"
+	"sync"
+)
+
+// caseSampler decides which of n cases of a cell are visited and in which order, it's shared by all workers of
+// the cell. Cases are visited in the natural order with probability rate, or in a random order if the adaptive
+// mode is enabled. If the importance sampling is enabled, the uniform pass only spends 1-Importance of the cases,
+// and the remaining ones are drawn from regions of adjacent cases in proportion to their mean absolute PError.
+type caseSampler struct {
+	conv *convergence
+	rate float64 // probability of visiting each case in the uniform pass
+
+	lock  sync.Mutex
+	order []int
+	pos   int
+
+	biased  int   // remaining cases of the biased pass
+	regions []int // upper bounds of regions, cases in [regions[i-1], regions[i]) are in the i-th region
+	errSum  []float64
+	errCnt  []int
+	pending [][]int // unvisited cases of regions in random orders, built when the biased pass starts
+	visited []bool
+}
+
+func newCaseSampler(opt AdaptiveOpt, conv *convergence, n int, rate float64) *caseSampler {
+	s := &caseSampler{conv: conv, rate: rate}
+	if !opt.enabled() {
+		s.order = make([]int, n)
+		for i := range s.order {
+			s.order[i] = i
+		}
+		return s
+	}
+	s.order = rand.Perm(n)
+	if opt.Importance <= 0 || n == 0 {
+		return s
+	}
+	s.rate = rate * (1 - opt.Importance)
+	s.biased = int(math.Round(rate * float64(n) * opt.Importance))
+	nRegions := opt.Regions
+	if nRegions > n {
+		nRegions = n
+	}
+	s.regions = make([]int, nRegions)
+	for i := range s.regions {
+		s.regions[i] = n * (i + 1) / nRegions
+	}
+	s.errSum = make([]float64, nRegions)
+	s.errCnt = make([]int, nRegions)
+	s.visited = make([]bool, n)
+	return s
+}
+
+// next returns the next case to visit and whether it's drawn by the biased pass, false if no more case is needed.
+func (s *caseSampler) next() (idx int, biased bool, ok bool) {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+	for s.pos < len(s.order) && !s.conv.stopped() {
+		idx = s.order[s.pos]
+		s.pos++
+		if rand.Float64() > s.rate {
+			continue
+		}
+		if s.visited != nil {
+			s.visited[idx] = true
+		}
+		return idx, false, true
+	}
+	if s.biased <= 0 {
+		return 0, false, false
+	}
+	if s.pending == nil {
+		s.pending = make([][]int, len(s.regions))
+		for i := range s.visited {
+			if !s.visited[i] {
+				r := s.region(i)
+				s.pending[r] = append(s.pending[r], i)
+			}
+		}
+		for _, p := range s.pending {
+			rand.Shuffle(len(p), func(i, j int) { p[i], p[j] = p[j], p[i] })
+		}
+	}
+	r := s.pickRegion()
+	if r < 0 {
+		return 0, false, false
+	}
+	s.biased--
+	p := s.pending[r]
+	idx, s.pending[r] = p[len(p)-1], p[:len(p)-1]
+	return idx, true, true
+}
+
+// pickRegion draws a region with unvisited cases in proportion to its mean absolute PError in the uniform pass,
+// regions without any result in the uniform pass are weighted by the mean of all regions.
+func (s *caseSampler) pickRegion() int {
+	sum, cnt := 0.0, 0
+	for i := range s.regions {
+		sum += s.errSum[i]
+		cnt += s.errCnt[i]
+	}
+	avg := 0.0
+	if cnt > 0 {
+		avg = sum / float64(cnt)
+	}
+	weights := make([]float64, len(s.regions))
+	total := 0.0
+	for i := range s.regions {
+		if len(s.pending[i]) == 0 {
+			continue
+		}
+		w := avg
+		if s.errCnt[i] > 0 {
+			w = s.errSum[i] / float64(s.errCnt[i])
+		}
+		weights[i] = w + 1e-3 // regions without errors still have a small chance
+		total += weights[i]
+	}
+	if total == 0 {
+		return -1
+	}
+	x := rand.Float64() * total
+	last := -1
+	for i, w := range weights {
+		if w == 0 {
+			continue
+		}
+		if last = i; x < w {
+			return i
+		}
+		x -= w
+	}
+	return last
+}
+
+// region returns the region of this case.
+func (s *caseSampler) region(idx int) int {
+	for i, upper := range s.regions {
+		if idx < upper {
+			return i
+		}
+	}
+	return len(s.regions) - 1
+}
+
+// observe accounts the error of this case of the uniform pass into its region.
+func (s *caseSampler) observe(idx int, r EstResult) {
+	if s.regions == nil || r.HasTag(TagImportanceSampled) {
+		return
+	}
+	s.lock.Lock()
+	defer s.lock.Unlock()
+	reg := s.region(idx)
+	s.errSum[reg] += math.Abs(PError(r))
+	s.errCnt[reg]++
+}
@@ -0,0 +1,213 @@
+package cetest
+
+import (
+	"fmt"
+	"strings"
+	"sync"
+
+	"github.com/pingcap/errors"
+	"github.com/qw4990/OptimizerTester/tidb"
+)
+
+// ScratchOpt clones all tables of the database of a dataset into a scratch database on each instance before the run,
+// and cases of the dataset run on the clone, so destructive experiments like changing indexes, tinkering statistics
+// or DML query types never touch the original data. Other databases in DBs are not cloned. The scratch database must
+// not exist before the run, since it's dropped afterwards, see scratchDBs.
+type ScratchOpt struct {
+	DB         string  `toml:"db"`          // the scratch database, cloning is disabled if it's empty
+	SampleRate float64 `toml:"sample-rate"` // fraction of rows cloned, all rows are cloned if it's 0
+	Keep       bool    `toml:"keep"`        // keep the scratch database after the run instead of dropping it
+
+	source string // the original database of the dataset
+}
+
+func (so ScratchOpt) check(ds DatasetOpt, opt Option) error {
+	if so.DB == "" {
+		return nil
+	}
+	if opt.ReadOnly {
+		return errors.Errorf("scratch database of dataset=%v is not allowed in read-only mode", ds.Label)
+	}
+	if err := checkScratchDB(so.DB, opt); err != nil {
+		return errors.Errorf("invalid scratch database of dataset=%v, err=%v", ds.Label, err)
+	}
+	for _, other := range opt.Datasets {
+		if other.Label != ds.Label && strings.EqualFold(other.Scratch.DB, so.DB) {
+			return errors.Errorf("scratch database %v is shared by datasets %v and %v", so.DB, ds.Label, other.Label)
+		}
+	}
+	if so.SampleRate < 0 || so.SampleRate > 1 {
+		return errors.Errorf("invalid scratch sample-rate=%v of dataset=%v", so.SampleRate, ds.Label)
+	}
+	return nil
+}
+
+// systemSchemas are databases of servers, which are never scratch databases.
+var systemSchemas = map[string]bool{
+	"mysql":              true,
+	"information_schema": true,
+	"metrics_schema":     true,
+	"performance_schema": true,
+	"sys":                true,
+}
+
+// checkScratchDB checks this database can be a scratch database dropped after the run, which must not be a system
+// schema or a database read by any dataset.
+func checkScratchDB(db string, opt Option) error {
+	if systemSchemas[strings.ToLower(db)] {
+		return errors.Errorf("%v is a system schema", db)
+	}
+	for _, ds := range opt.Datasets {
+		source := ds.DB
+		if ds.Scratch.source != "" {
+			source = ds.Scratch.source
+		}
+		for _, used := range append([]string{source}, ds.DBs...) {
+			if strings.EqualFold(db, used) {
+				return errors.Errorf("%v is used by dataset=%v", db, ds.Label)
+			}
+		}
+	}
+	return nil
+}
+
+// scratchDBs keeps scratch databases created by the tester on each instance, and only they are ever dropped, so a
+// database of users configured as a scratch database by mistake is refused instead of being dropped.
+type scratchDBs struct {
+	mu      sync.Mutex
+	created map[string]bool // instance/database
+}
+
+func newScratchDBs() *scratchDBs {
+	return &scratchDBs{created: make(map[string]bool)}
+}
+
+func scratchDBKey(ins tidb.Instance, db string) string {
+	return ins.Opt().Label + "/" + strings.ToLower(db)
+}
+
+// create creates this scratch database on this instance, which must not exist unless it's created by the tester
+// before, like kept ones in previous runs of the matrix.
+func (s *scratchDBs) create(ins tidb.Instance, db string) error {
+	if s == nil {
+		return errors.Errorf("scratch database %v is not tracked", db)
+	}
+	if systemSchemas[strings.ToLower(db)] {
+		return errors.Errorf("system schema %v can't be a scratch database", db)
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.created[scratchDBKey(ins, db)] {
+		return nil
+	}
+	_, rows, err := queryText(ins, fmt.Sprintf("SELECT SCHEMA_NAME FROM information_schema.SCHEMATA WHERE LOWER(SCHEMA_NAME)='%v'", strings.ToLower(db)))
+	if err != nil {
+		return err
+	}
+	if len(rows) > 0 {
+		return errors.Errorf("scratch database %v already exists on ins=%v, drop it or use another one, since it'd be dropped after the run", db, ins.Opt().Label)
+	}
+	if err := ins.Exec(fmt.Sprintf("CREATE DATABASE %v", db)); err != nil {
+		return err
+	}
+	s.created[scratchDBKey(ins, db)] = true
+	return nil
+}
+
+// drop drops this scratch database on this instance if it's created by the tester.
+func (s *scratchDBs) drop(ins tidb.Instance, db string) error {
+	if s == nil {
+		return nil
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if !s.created[scratchDBKey(ins, db)] {
+		return nil
+	}
+	if err := ins.Exec(fmt.Sprintf("DROP DATABASE IF EXISTS %v", db)); err != nil {
+		return err
+	}
+	delete(s.created, scratchDBKey(ins, db))
+	return nil
+}
+
+// cloneScratchDatabases clones databases of all datasets with scratch databases on all instances.
+func cloneScratchDatabases(opt Option, instances []tidb.Instance) error {
+	for _, ins := range instances {
+		for _, ds := range opt.Datasets {
+			if err := cloneScratch(ins, ds, opt.scratches); err != nil {
+				return fmt.Errorf("clone scratch ins=%v, ds=%v, err=%v", ins.Opt().Label, ds.Label, err)
+			}
+		}
+	}
+	return nil
+}
+
+// dropScratchDatabases drops scratch databases of all datasets on all instances unless they're kept,
+// failures are only printed since results are already collected.
+func dropScratchDatabases(opt Option, instances []tidb.Instance) {
+	for _, ins := range instances {
+		for _, ds := range opt.Datasets {
+			if err := dropScratch(ins, ds, opt.scratches); err != nil {
+				fmt.Printf("[Scratch] drop scratch ins=%v, ds=%v, err=%v\n", ins.Opt().Label, ds.Label, err)
+			}
+		}
+	}
+}
+
+// cloneScratch clones the database of this dataset into its scratch database on this instance and analyzes all
+// cloned tables, it does nothing if the scratch database is disabled.
+func cloneScratch(ins tidb.Instance, ds DatasetOpt, scratches *scratchDBs) error {
+	so := ds.Scratch
+	if so.DB == "" {
+		return nil
+	}
+	if err := scratches.create(ins, so.DB); err != nil {
+		return err
+	}
+	_, rows, err := queryText(ins, fmt.Sprintf("SELECT TABLE_NAME FROM information_schema.tables WHERE TABLE_SCHEMA='%v' AND TABLE_TYPE='BASE TABLE'", so.source))
+	if err != nil {
+		return err
+	}
+	if len(rows) == 0 {
+		return errors.Errorf("no table in database %v", so.source)
+	}
+	for _, row := range rows {
+		if err := cloneTable(ins, so.source, row[0], so.DB, so.SampleRate); err != nil {
+			return err
+		}
+		if err := ins.Exec(fmt.Sprintf("ANALYZE TABLE %v.%v", so.DB, row[0])); err != nil {
+			return err
+		}
+	}
+	fmt.Printf("[Scratch] cloned %v tables of %v into %v on ins=%v, sample-rate=%v\n", len(rows), so.source, so.DB, ins.Opt().Label, so.SampleRate)
+	return nil
+}
+
+// dropScratch drops the scratch database of this dataset on this instance unless it's disabled or kept.
+func dropScratch(ins tidb.Instance, ds DatasetOpt, scratches *scratchDBs) error {
+	if ds.Scratch.DB == "" || ds.Scratch.Keep {
+		return nil
+	}
+	return scratches.drop(ins, ds.Scratch.DB)
+}
+
+// cloneTable copies the schema and sampled data of this table into the scratch database dstDB created by
+// scratchDBs, whose existing table is replaced. sampleRate is the fraction of copied rows, all rows are copied if
+// it's 0.
+func cloneTable(ins tidb.Instance, db, tb, dstDB string, sampleRate float64) error {
+	insert := fmt.Sprintf("INSERT INTO %v.%v SELECT * FROM %v.%v", dstDB, tb, db, tb)
+	if sampleRate > 0 && sampleRate < 1 {
+		insert += fmt.Sprintf(" WHERE RAND() < %v", sampleRate)
+	}
+	for _, sql := range []string{
+		fmt.Sprintf("DROP TABLE IF EXISTS %v.%v", dstDB, tb),
+		fmt.Sprintf("CREATE TABLE %v.%v LIKE %v.%v", dstDB, tb, db, tb),
+		insert,
+	} {
+		if err := ins.Exec(sql); err != nil {
+			return err
+		}
+	}
+	return nil
+}
@@ -0,0 +1,131 @@
+package cetest
+
+import (
+	"bytes"
+	"fmt"
+	"math"
+	"regexp"
+	"sort"
+	"strings"
+
+	"github.com/pingcap/errors"
+	"github.com/qw4990/OptimizerTester/tidb"
+)
+
+// tableRefPattern matches qualified tables read by cases, like "FROM db.t" and "JOIN db.t".
+var tableRefPattern = regexp.MustCompile("(?i)\\b(?:FROM|JOIN)\\s+`?(\\w+)`?\\.`?(\\w+)`?")
+
+// EstSelectivity returns the estimated selectivity of this result, which is EstCard / TableRows, 0 if TableRows is unknown.
+func EstSelectivity(r EstResult) float64 {
+	if r.TableRows <= 0 {
+		return 0
+	}
+	return r.EstCard / r.TableRows
+}
+
+// SelectivityError returns the error of this result in selectivity-space, which is (EstCard - TrueCard) / TableRows,
+// 0 if TableRows is unknown. Unlike errors in row-space, it's comparable across differently sized datasets.
+func SelectivityError(r EstResult) float64 {
+	if r.TableRows <= 0 {
+		return 0
+	}
+	return (r.EstCard - r.TrueCard) / r.TableRows
+}
+
+// recordTableRows sets TableRows of all results by row counts of tables they read in each instance,
+// and fills their selectivities if unknown.
+func recordTableRows(opt Option, instances []tidb.Instance, collector EstResultCollector) error {
+	for insIdx, ins := range instances {
+		rowCounts := make(map[string]float64) // db.tb, rows
+		for dsIdx := range opt.Datasets {
+			for qtIdx := range opt.QueryTypes {
+				for i, r := range collector.EstResults(insIdx, dsIdx, qtIdx) {
+					rows, err := tableRowsOf(ins, r.SQL, rowCounts)
+					if err != nil {
+						return fmt.Errorf("count rows of tables in %v on %v, err=%v", r.SQL, ins.Opt().Label, err)
+					}
+					if rows <= 0 {
+						continue
+					}
+					r.TableRows = rows
+					if r.Selectivity == 0 {
+						r.Selectivity = r.TrueCard / rows
+					}
+					collector.UpdateEstResult(insIdx, dsIdx, qtIdx, i, r)
+				}
+			}
+		}
+	}
+	return nil
+}
+
+// tableRowsOf returns the product of row counts of all distinct tables read by this query, which is the size of
+// the space its selectivity is relative to, 0 if it reads no known table. Row counts are cached in rowCounts.
+func tableRowsOf(ins tidb.Instance, query string, rowCounts map[string]float64) (float64, error) {
+	refs := tableRefPattern.FindAllStringSubmatch(query, -1)
+	if len(refs) == 0 {
+		return 0, nil
+	}
+	rows := 1.0
+	seen := make(map[string]bool, len(refs))
+	for _, ref := range refs {
+		tb := strings.ToLower(ref[1] + "." + ref[2])
+		if seen[tb] {
+			continue // like tables read by both parts of recursive CTEs
+		}
+		seen[tb] = true
+		cnt, ok := rowCounts[tb]
+		if !ok {
+			_, results, err := queryText(ins, fmt.Sprintf("SELECT COUNT(*) FROM %v", tb))
+			if err != nil {
+				return 0, err
+			}
+			if len(results) != 1 || len(results[0]) != 1 {
+				return 0, errors.Errorf("no result of counting %v", tb)
+			}
+			if _, err := fmt.Sscan(results[0][0], &cnt); err != nil {
+				return 0, errors.Errorf("invalid count %v of %v", results[0][0], tb)
+			}
+			rowCounts[tb] = cnt
+		}
+		rows *= cnt
+	}
+	return rows, nil
+}
+
+// writeSelectivityErrors writes a table of absolute errors of this cell in row-space and selectivity-space,
+// it's skipped if no result in this cell knows its table size.
+func writeSelectivityErrors(md *bytes.Buffer, opt Option, collector EstResultCollector, dsIdx, qtIdx int) {
+	header := false
+	for insIdx, ins := range opt.Instances {
+		var rowErrs, selErrs []float64
+		minRows, maxRows := math.MaxFloat64, 0.0
+		for _, r := range collector.EstResults(insIdx, dsIdx, qtIdx) {
+			if r.TableRows <= 0 {
+				continue
+			}
+			rowErrs = append(rowErrs, math.Abs(r.EstCard-r.TrueCard))
+			selErrs = append(selErrs, math.Abs(SelectivityError(r)))
+			minRows, maxRows = math.Min(minRows, r.TableRows), math.Max(maxRows, r.TableRows)
+		}
+		if len(rowErrs) == 0 {
+			continue
+		}
+		if !header {
+			md.WriteString("\nErrors in Row-Space and Selectivity-Space\n")
+			md.WriteString("\n| Instance | Cases | Table Rows | Row P50 | Row P90 | Row Max | Selectivity P50 | Selectivity P90 | Selectivity Max |\n")
+			md.WriteString("| ---- | ---- | ---- | ---- | ---- | ---- | ---- | ---- | ---- |\n")
+			header = true
+		}
+		sort.Float64s(rowErrs)
+		sort.Float64s(selErrs)
+		n := len(rowErrs)
+		tableRows := opt.NumberFormat.rows(minRows)
+		if maxRows != minRows {
+			tableRows += " ~ " + opt.NumberFormat.rows(maxRows)
+		}
+		md.WriteString(fmt.Sprintf("| %v | %v | %v | %v | %v | %v | %v | %v | %v |\n", ins.Label, n, tableRows,
+			opt.NumberFormat.rows(rowErrs[n/2]), opt.NumberFormat.rows(rowErrs[(n*9)/10]), opt.NumberFormat.rows(rowErrs[n-1]),
+			opt.NumberFormat.ratio(selErrs[n/2]), opt.NumberFormat.ratio(selErrs[(n*9)/10]), opt.NumberFormat.ratio(selErrs[n-1])))
+	}
+}
@@ -0,0 +1,135 @@
+package cetest
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/pingcap/errors"
+	"github.com/qw4990/OptimizerTester/tidb"
+)
+
+// snapshotNow pins reads of a run to the snapshot when the run starts, see Option.Snapshot.
+const snapshotNow = "now"
+
+// checkSnapshot checks Option.Snapshot, which is "now", a TSO or a time like "2024-01-01 10:00:00".
+func checkSnapshot(opt Option) error {
+	ts := strings.TrimSpace(opt.Snapshot)
+	if ts == "" {
+		return nil
+	}
+	if !opt.executor.MeasuresTruth() {
+		return errors.Errorf("snapshot requires an executor running cases like explain-analyze, but the executor is %v", opt.executor.Name())
+	}
+	if strings.EqualFold(ts, snapshotNow) {
+		return nil
+	}
+	if _, err := strconv.ParseUint(ts, 10, 64); err == nil {
+		return nil
+	}
+	if _, err := time.Parse("2006-01-02 15:04:05.999999", ts); err == nil {
+		return nil
+	}
+	return errors.Errorf("invalid snapshot=%v, which should be \"now\", a TSO or a time like \"2024-01-01 10:00:00\"", opt.Snapshot)
+}
+
+// snapshotReads keeps connections of each instance reading data at the snapshot of the run by tidb_snapshot, which
+// cases are executed on, so true cardinalities stay identical during the whole run even if data is being written.
+// Cases are still explained against the latest statistics.
+type snapshotReads struct {
+	ts string
+
+	mu        sync.RWMutex
+	instances map[tidb.Instance]tidb.Instance // instance, its snapshot connections
+}
+
+// newSnapshotReads returns nil if reads are not pinned to a snapshot.
+func newSnapshotReads(ts string) *snapshotReads {
+	ts = strings.TrimSpace(ts)
+	if ts == "" {
+		return nil
+	}
+	return &snapshotReads{ts: ts, instances: make(map[tidb.Instance]tidb.Instance)}
+}
+
+// open connects to these instances reading at the snapshot, which is resolved on each instance if it's "now".
+func (s *snapshotReads) open(instances []tidb.Instance) error {
+	if s == nil {
+		return nil
+	}
+	for _, ins := range instances {
+		ts := s.ts
+		if strings.EqualFold(ts, snapshotNow) {
+			var err error
+			if ts, err = currentTSO(ins); err != nil {
+				return err
+			}
+		}
+		opt := ins.Opt()
+		opt.Snapshot = ts
+		snap, err := tidb.ConnectTo(opt)
+		if err != nil {
+			return err
+		}
+		fmt.Printf("[Snapshot] cases on %v read data at snapshot %v\n", opt.Label, ts)
+		s.mu.Lock()
+		s.instances[ins] = snap
+		s.mu.Unlock()
+	}
+	return nil
+}
+
+// of returns snapshot connections of this instance, or itself if there are none.
+func (s *snapshotReads) of(ins tidb.Instance) tidb.Instance {
+	if s == nil {
+		return ins
+	}
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	if snap, ok := s.instances[ins]; ok {
+		return snap
+	}
+	return ins
+}
+
+// close closes all snapshot connections.
+func (s *snapshotReads) close() {
+	if s == nil {
+		return
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	for ins, snap := range s.instances {
+		snap.Close()
+		delete(s.instances, ins)
+	}
+}
+
+// currentTSO returns the current TSO of this instance allocated by PD, instead of one built from the wall clock of
+// the server, which may be skewed into the future or miss committed data. TIDB_CURRENT_TSO() is required, and
+// snapshots should be set by TSOs or times explicitly on versions without it.
+func currentTSO(ins tidb.Instance) (string, error) {
+	_, results, err := queryText(ins, "SELECT TIDB_CURRENT_TSO()")
+	if err != nil {
+		return "", errors.Errorf("get the current TSO of %v, set the snapshot by a TSO or time instead of %q if TIDB_CURRENT_TSO() is unsupported, err=%v", ins.Opt().Label, snapshotNow, err)
+	}
+	if len(results) != 1 || len(results[0]) != 1 {
+		return "", errors.Errorf("no current TSO of %v", ins.Opt().Label)
+	}
+	if ts, err := strconv.ParseUint(results[0][0], 10, 64); err != nil || ts == 0 {
+		return "", errors.Errorf("invalid current TSO %v of %v", results[0][0], ins.Opt().Label)
+	}
+	return results[0][0], nil
+}
+
+// snapshotExecutor executes cases by its executor on snapshot connections of instances.
+type snapshotExecutor struct {
+	Executor
+	reads *snapshotReads
+}
+
+func (e snapshotExecutor) Execute(ins tidb.Instance, query string, keepPlan bool) (EstResult, error) {
+	return e.Executor.Execute(e.reads.of(ins), query, keepPlan)
+}
@@ -0,0 +1,133 @@
+package cetest
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+
+	"github.com/pingcap/errors"
+	"github.com/qw4990/OptimizerTester/tidb"
+)
+
+// StatsCheckOpt checks the freshness of statistics of all tables used by datasets before running,
+// since results measured against stale statistics are easily misinterpreted.
+type StatsCheckOpt struct {
+	MinHealthy int    `toml:"min-healthy"` // tables whose healthy scores are lower than this are stale, the check is disabled if it's 0
+	Action     string `toml:"action"`      // what to do with stale tables: "warn", "fail" or "analyze", "warn" if empty
+}
+
+func (sc StatsCheckOpt) check(readOnly bool) error {
+	if sc.MinHealthy < 0 || sc.MinHealthy > 100 {
+		return errors.Errorf("invalid stats-check min-healthy=%v", sc.MinHealthy)
+	}
+	switch strings.ToLower(sc.Action) {
+	case "", "warn", "fail":
+	case "analyze":
+		if readOnly {
+			return errors.Errorf("stats-check action=analyze is not allowed in read-only mode")
+		}
+	default:
+		return errors.Errorf("unknown stats-check action=%v", sc.Action)
+	}
+	return nil
+}
+
+// tableStats is the freshness of statistics of a table.
+type tableStats struct {
+	healthy     int // the lowest healthy score of all partitions, -1 if the table has no statistics
+	modifyCount int64
+	rowCount    int64
+}
+
+// checkStatsFreshness checks statistics of all tables used by these datasets on all instances, and warns, fails or
+// analyzes stale tables according to StatsCheck. Tables in AnaTables are skipped since they are analyzed anyway.
+func checkStatsFreshness(opt Option, instances []tidb.Instance, datasets []Dataset) error {
+	if opt.StatsCheck.MinHealthy <= 0 {
+		return nil
+	}
+	skipped := make(map[string]bool, len(opt.AnaTables))
+	for _, tbl := range opt.AnaTables {
+		skipped[strings.ToLower(tbl)] = true
+	}
+	for _, ins := range instances {
+		for dsIdx, ds := range datasets {
+			b, ok := ds.(interface{ base() *datasetBase })
+			if !ok {
+				continue
+			}
+			db := opt.Datasets[dsIdx].DB
+			for tb := range b.base().usedColumns() {
+				if skipped[strings.ToLower(db+"."+tb)] {
+					continue
+				}
+				st, err := readTableStats(ins, db, tb)
+				if err != nil {
+					return err
+				}
+				if st.healthy >= opt.StatsCheck.MinHealthy {
+					continue
+				}
+				msg := fmt.Sprintf("statistics of %v.%v on %v are stale, healthy=%v, modify_count=%v, row_count=%v",
+					db, tb, ins.Opt().Label, st.healthy, st.modifyCount, st.rowCount)
+				switch strings.ToLower(opt.StatsCheck.Action) {
+				case "fail":
+					return errors.New(msg)
+				case "analyze":
+					fmt.Printf("[StatsCheck] %v, analyze it\n", msg)
+					if err := ins.Exec(fmt.Sprintf("ANALYZE TABLE %v.%v", db, tb)); err != nil {
+						return err
+					}
+				default:
+					fmt.Printf("[StatsCheck] %v\n", msg)
+				}
+			}
+		}
+	}
+	return nil
+}
+
+func readTableStats(ins tidb.Instance, db, tb string) (tableStats, error) {
+	st := tableStats{healthy: -1}
+	where := fmt.Sprintf("WHERE db_name='%v' AND table_name='%v'", db, tb)
+	header, results, err := queryText(ins, "SHOW STATS_HEALTHY "+where)
+	if err != nil {
+		return st, err
+	}
+	if i := columnIdx(header, "healthy"); i != -1 {
+		for _, row := range results {
+			h, err := strconv.Atoi(row[i])
+			if err != nil {
+				return st, errors.Errorf("invalid healthy=%v of %v.%v", row[i], db, tb)
+			}
+			if st.healthy == -1 || h < st.healthy {
+				st.healthy = h
+			}
+		}
+	}
+	header, results, err = queryText(ins, "SHOW STATS_META "+where)
+	if err != nil {
+		return st, err
+	}
+	mi, ri := columnIdx(header, "modify_count"), columnIdx(header, "row_count")
+	for _, row := range results {
+		if mi != -1 {
+			n, _ := strconv.ParseInt(row[mi], 10, 64)
+			st.modifyCount += n
+		}
+		if ri != -1 {
+			n, _ := strconv.ParseInt(row[ri], 10, 64)
+			st.rowCount += n
+		}
+	}
+	return st, nil
+}
+
+// columnIdx returns the index of this column in this header ignoring cases, -1 if it's not found.
+func columnIdx(header []string, col string) int {
+	for i, h := range header {
+		if strings.EqualFold(h, col) {
+			return i
+		}
+	}
+	return -1
+}
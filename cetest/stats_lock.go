@@ -0,0 +1,101 @@
+package cetest
+
+import (
+	"fmt"
+	"strings"
+	"sync"
+
+	"github.com/pingcap/errors"
+	"github.com/qw4990/OptimizerTester/tidb"
+)
+
+// statsLocker locks statistics of all tables used by datasets by LOCK STATS for the duration of the run and unlocks
+// them afterwards, so neither auto-analyze nor anything else changes statistics of any instance during the run.
+// Tables locked before the run are left locked.
+type statsLocker struct {
+	mu     sync.Mutex
+	locked map[tidb.Instance][]string // tables locked by the locker
+}
+
+// newStatsLocker returns nil if statistics are not locked.
+func newStatsLocker(enabled bool) *statsLocker {
+	if !enabled {
+		return nil
+	}
+	return &statsLocker{locked: make(map[tidb.Instance][]string)}
+}
+
+// check returns an error if any of these instances doesn't support LOCK STATS.
+func (l *statsLocker) check(instances []tidb.Instance) error {
+	if l == nil {
+		return nil
+	}
+	for _, ins := range instances {
+		if tidb.ToComparableVersion(ins.Version()) < tidb.ToComparableVersion(lockStatsVersion) {
+			return errors.Errorf("lock-stats requires %v or later, but %v is %v", lockStatsVersion, ins.Opt().Label, ins.Version())
+		}
+	}
+	return nil
+}
+
+// lock locks statistics of these tables like "db.tb" on this instance.
+func (l *statsLocker) lock(ins tidb.Instance, tables []string) error {
+	if l == nil || len(tables) == 0 {
+		return nil
+	}
+	locked, err := readLockedStats(ins)
+	if err != nil {
+		return err
+	}
+	var toLock []string
+	for _, tbl := range tables {
+		if !locked[strings.ToLower(tbl)] {
+			toLock = append(toLock, tbl)
+		}
+	}
+	if len(toLock) == 0 {
+		return nil
+	}
+	if err := ins.Exec("LOCK STATS " + strings.Join(toLock, ", ")); err != nil {
+		return err
+	}
+	fmt.Printf("[LockStats] locked statistics of %v on %v\n", toLock, ins.Opt().Label)
+	l.mu.Lock()
+	l.locked[ins] = toLock
+	l.mu.Unlock()
+	return nil
+}
+
+// unlock unlocks statistics locked by the locker on all instances.
+func (l *statsLocker) unlock() {
+	if l == nil {
+		return
+	}
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	for ins, tables := range l.locked {
+		if err := ins.Exec("UNLOCK STATS " + strings.Join(tables, ", ")); err != nil {
+			fmt.Printf("[LockStats] unlock statistics of %v on %v, err=%v\n", tables, ins.Opt().Label, err)
+			continue
+		}
+		fmt.Printf("[LockStats] unlocked statistics of %v on %v\n", tables, ins.Opt().Label)
+		delete(l.locked, ins)
+	}
+}
+
+// readLockedStats returns tables like "db.tb" in lower cases whose statistics are locked on this instance.
+func readLockedStats(ins tidb.Instance) (map[string]bool, error) {
+	header, results, err := queryText(ins, "SHOW STATS_LOCKED")
+	if err != nil {
+		return nil, err
+	}
+	di, ti := columnIdx(header, "db_name"), columnIdx(header, "table_name")
+	if di == -1 || ti == -1 {
+		return nil, errors.Errorf("no db_name or table_name in SHOW STATS_LOCKED of %v", ins.Opt().Label)
+	}
+	locked := make(map[string]bool, len(results))
+	for _, row := range results {
+		locked[strings.ToLower(row[di]+"."+row[ti])] = true
+	}
+	return locked, nil
+}
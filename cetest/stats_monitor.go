@@ -0,0 +1,302 @@
+package cetest
+
+import (
+	"bytes"
+	"fmt"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/pingcap/errors"
+	"github.com/qw4990/OptimizerTester/tidb"
+)
+
+// StatsMonitorOpt detects statistics of tables used by datasets changing during the run, mostly by auto-analyze,
+// since results measured before and after the change are against different statistics. Changes are detected by
+// versions of statistics, which are the latest update time of histograms of each table.
+type StatsMonitorOpt struct {
+	Action   string `toml:"action"`   // "warn", "pause" or "lock" once statistics change, the monitor is disabled if empty
+	Interval string `toml:"interval"` // interval of polling versions of statistics, like "10s", 10s if empty
+
+	interval time.Duration
+}
+
+// Actions of the statistics monitor. All changes are warned and listed in reports, besides:
+//
+//	pause: cases on the instance are paused until statistics are stable for an interval, so no case is measured
+//	       while statistics are being loaded
+//	lock:  statistics of the changed table are locked by LOCK STATS until the end of the run, so they change once
+//	       at most, it falls back to warn on versions before v6.5.0 which don't support it
+const (
+	statsActionWarn  = "warn"
+	statsActionPause = "pause"
+	statsActionLock  = "lock"
+)
+
+const defaultStatsMonitorInterval = 10 * time.Second
+
+// lockStatsVersion is the first version supporting LOCK STATS.
+const lockStatsVersion = "v6.5.0"
+
+func (sm *StatsMonitorOpt) check(readOnly bool) error {
+	switch strings.ToLower(sm.Action) {
+	case "", statsActionWarn, statsActionPause:
+	case statsActionLock:
+		if readOnly {
+			return errors.Errorf("stats-monitor action=lock is not allowed in read-only mode")
+		}
+	default:
+		return errors.Errorf("unknown stats-monitor action=%v", sm.Action)
+	}
+	sm.interval = defaultStatsMonitorInterval
+	if sm.Interval != "" {
+		d, err := time.ParseDuration(sm.Interval)
+		if err != nil || d <= 0 {
+			return errors.Errorf("invalid stats-monitor interval=%v", sm.Interval)
+		}
+		sm.interval = d
+	}
+	return nil
+}
+
+// statsChange is a change of statistics of a table detected during the run.
+type statsChange struct {
+	Instance string
+	Table    string // db.tb
+	Before   string // version before the change, "" if the table had no statistics
+	After    string
+	At       time.Time
+	Action   string // what's done, see actions of the statistics monitor
+}
+
+// statsMonitor polls versions of statistics of all tables used by datasets on all instances during the run.
+type statsMonitor struct {
+	opt StatsMonitorOpt
+
+	mu       sync.Mutex
+	resumed  *sync.Cond
+	versions map[string]string          // instance/db.tb, version
+	paused   map[string]bool            // labels of paused instances
+	locked   map[tidb.Instance][]string // tables locked by the monitor
+	changes  []statsChange              // all detected changes in order
+
+	stopCh chan struct{} // nil if it's not started
+	done   chan struct{}
+}
+
+// newStatsMonitor returns nil if the monitor is disabled.
+func newStatsMonitor(opt StatsMonitorOpt) *statsMonitor {
+	if opt.Action == "" {
+		return nil
+	}
+	m := &statsMonitor{
+		opt:      opt,
+		versions: make(map[string]string),
+		paused:   make(map[string]bool),
+		locked:   make(map[tidb.Instance][]string),
+	}
+	m.resumed = sync.NewCond(&m.mu)
+	return m
+}
+
+// start reads versions of statistics of these tables on these instances, and polls them until it's stopped.
+func (m *statsMonitor) start(instances []tidb.Instance, tables []string) error {
+	if m == nil {
+		return nil
+	}
+	m.changes = nil // the monitor is started again in each run of the matrix
+	for _, ins := range instances {
+		for _, tbl := range tables {
+			v, err := readStatsVersion(ins, tbl)
+			if err != nil {
+				return err
+			}
+			m.versions[ins.Opt().Label+"/"+tbl] = v
+		}
+	}
+	m.stopCh, m.done = make(chan struct{}), make(chan struct{})
+	go func() {
+		defer close(m.done)
+		ticker := time.NewTicker(m.opt.interval)
+		defer ticker.Stop()
+		for {
+			select {
+			case <-m.stopCh:
+				return
+			case <-ticker.C:
+				m.poll(instances, tables)
+			}
+		}
+	}()
+	return nil
+}
+
+func (m *statsMonitor) poll(instances []tidb.Instance, tables []string) {
+	for _, ins := range instances {
+		label := ins.Opt().Label
+		changed := false
+		for _, tbl := range tables {
+			v, err := readStatsVersion(ins, tbl)
+			if err != nil {
+				fmt.Printf("[StatsMonitor] read the version of statistics of %v on %v, err=%v\n", tbl, label, err)
+				continue
+			}
+			m.mu.Lock()
+			before := m.versions[label+"/"+tbl]
+			m.versions[label+"/"+tbl] = v
+			m.mu.Unlock()
+			if v != before {
+				changed = true
+				m.changeDetected(ins, tbl, before, v)
+			}
+		}
+		m.mu.Lock()
+		if !changed && m.paused[label] {
+			fmt.Printf("[StatsMonitor] statistics on %v are stable, resume cases\n", label)
+			m.paused[label] = false
+			m.resumed.Broadcast()
+		}
+		m.mu.Unlock()
+	}
+}
+
+func (m *statsMonitor) changeDetected(ins tidb.Instance, tbl, before, after string) {
+	label := ins.Opt().Label
+	action := strings.ToLower(m.opt.Action)
+	if action == statsActionLock && tidb.ToComparableVersion(ins.Version()) < tidb.ToComparableVersion(lockStatsVersion) {
+		action = statsActionWarn
+	}
+	if action == statsActionLock && !m.isLocked(ins, tbl) {
+		if err := ins.Exec("LOCK STATS " + tbl); err != nil {
+			fmt.Printf("[StatsMonitor] lock statistics of %v on %v, err=%v\n", tbl, label, err)
+			action = statsActionWarn
+		}
+	}
+	fmt.Printf("[StatsMonitor] WARNING: statistics of %v on %v changed during the run (%v => %v), results before and after it are against different statistics, action=%v\n",
+		tbl, label, before, after, action)
+
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.changes = append(m.changes, statsChange{Instance: label, Table: tbl, Before: before, After: after, At: time.Now(), Action: action})
+	switch action {
+	case statsActionPause:
+		m.paused[label] = true
+	case statsActionLock:
+		if !m.hasLocked(ins, tbl) {
+			m.locked[ins] = append(m.locked[ins], tbl)
+		}
+	}
+}
+
+// isLocked returns whether statistics of this table are locked by the monitor on this instance.
+func (m *statsMonitor) isLocked(ins tidb.Instance, tbl string) bool {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	return m.hasLocked(ins, tbl)
+}
+
+// hasLocked is isLocked, the caller must hold the mutex.
+func (m *statsMonitor) hasLocked(ins tidb.Instance, tbl string) bool {
+	for _, t := range m.locked[ins] {
+		if t == tbl {
+			return true
+		}
+	}
+	return false
+}
+
+// wait blocks until cases on this instance are resumed if they're paused.
+func (m *statsMonitor) wait(ins string) {
+	if m == nil {
+		return
+	}
+	m.mu.Lock()
+	for m.paused[ins] {
+		m.resumed.Wait()
+	}
+	m.mu.Unlock()
+}
+
+// stop stops polling, resumes all paused cases and unlocks statistics locked by the monitor.
+func (m *statsMonitor) stop() {
+	if m == nil || m.stopCh == nil {
+		return
+	}
+	close(m.stopCh)
+	<-m.done
+	m.stopCh = nil
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	for ins := range m.paused {
+		m.paused[ins] = false
+	}
+	m.resumed.Broadcast()
+	for ins, tables := range m.locked {
+		if err := ins.Exec("UNLOCK STATS " + strings.Join(tables, ", ")); err != nil {
+			fmt.Printf("[StatsMonitor] unlock statistics of %v on %v, err=%v\n", tables, ins.Opt().Label, err)
+		}
+		delete(m.locked, ins)
+	}
+}
+
+// readStatsVersion returns the version of statistics of this table, which is the latest update time of its
+// histograms, or "" if it has no statistics.
+func readStatsVersion(ins tidb.Instance, tbl string) (string, error) {
+	db, tb := tbl, ""
+	if i := strings.Index(tbl, "."); i != -1 {
+		db, tb = tbl[:i], tbl[i+1:]
+	}
+	header, results, err := queryText(ins, fmt.Sprintf("SHOW STATS_HISTOGRAMS WHERE db_name='%v' AND table_name='%v'", db, tb))
+	if err != nil {
+		return "", err
+	}
+	i := columnIdx(header, "update_time")
+	if i == -1 {
+		return "", errors.Errorf("no update_time in SHOW STATS_HISTOGRAMS of %v", tbl)
+	}
+	version := ""
+	for _, row := range results {
+		if row[i] > version {
+			version = row[i]
+		}
+	}
+	return version, nil
+}
+
+// datasetTables returns all tables used by these datasets like "db.tb", ordered by names.
+func datasetTables(opt Option, datasets []Dataset) []string {
+	var tables []string
+	for dsIdx, ds := range datasets {
+		b, ok := ds.(interface{ base() *datasetBase })
+		if !ok {
+			continue
+		}
+		for tb := range b.base().usedColumns() {
+			tables = append(tables, opt.Datasets[dsIdx].DB+"."+tb)
+		}
+	}
+	sort.Strings(tables)
+	return tables
+}
+
+// writeStatsChanges writes all changes of statistics detected during the run, it's skipped if there are none.
+func writeStatsChanges(md *bytes.Buffer, opt Option) {
+	m := opt.monitor
+	if m == nil {
+		return
+	}
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	if len(m.changes) == 0 {
+		return
+	}
+	md.WriteString("# Statistics Changes\n")
+	md.WriteString("\n> WARNING: statistics of tables below changed during the run, results measured before and after a change are against different statistics.\n")
+	md.WriteString("\n| Instance | Table | Time | Before | After | Action |\n")
+	md.WriteString("| ---- | ---- | ---- | ---- | ---- | ---- |\n")
+	for _, c := range m.changes {
+		md.WriteString(fmt.Sprintf("| %v | %v | %v | %v | %v | %v |\n", c.Instance, c.Table, c.At.Format("15:04:05"), markdownCell(c.Before), markdownCell(c.After), c.Action))
+	}
+	md.WriteString("\n")
+}
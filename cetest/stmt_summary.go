@@ -0,0 +1,184 @@
+package cetest
+
+import (
+	"bytes"
+	"fmt"
+	"regexp"
+	"strings"
+
+	"github.com/qw4990/OptimizerTester/tidb"
+)
+
+// StmtSummaryOpt cross-references cases against STATEMENTS_SUMMARY tables of each instance after the run, so results
+// of the tester can be joined with server-side telemetry, like dashboards and slow logs, by digests of their
+// statements and plans. Cases are matched with summaries by their normalized statements, and by their plan shapes if
+// a statement has several plans. Summaries are only kept for tidb_stmt_summary_history_size windows of at most
+// tidb_stmt_summary_max_stmt_count statements, so the cross-reference is done first after the run.
+type StmtSummaryOpt struct {
+	Enabled bool `toml:"enabled"`
+	Cluster bool `toml:"cluster"` // read CLUSTER_STATEMENTS_SUMMARY tables of all TiDB servers of each instance
+}
+
+// stmtSummary is a statement with a plan in STATEMENTS_SUMMARY tables.
+type stmtSummary struct {
+	digest     string
+	planDigest string
+	planShape  string // see planShape, empty if the plan is unknown
+}
+
+// readStmtSummaries reads statements in current and history STATEMENTS_SUMMARY tables of this instance, keyed by
+// their normalized statements, see NormalizeDigestText.
+func readStmtSummaries(ins tidb.Instance, cluster bool) (map[string][]stmtSummary, error) {
+	prefix := ""
+	if cluster {
+		prefix = "CLUSTER_"
+	}
+	var queries []string
+	for _, tbl := range []string{"STATEMENTS_SUMMARY", "STATEMENTS_SUMMARY_HISTORY"} {
+		queries = append(queries, fmt.Sprintf("SELECT DIGEST, DIGEST_TEXT, PLAN_DIGEST, PLAN FROM INFORMATION_SCHEMA.%v%v", prefix, tbl))
+	}
+	_, rows, err := queryText(ins, strings.Join(queries, " UNION ALL "))
+	if err != nil {
+		return nil, err
+	}
+	summaries := make(map[string][]stmtSummary)
+	seen := make(map[string]bool)
+	for _, row := range rows {
+		if len(row) < 4 || seen[row[0]+"/"+row[2]] {
+			continue
+		}
+		seen[row[0]+"/"+row[2]] = true
+		key := NormalizeDigestText(row[1])
+		summaries[key] = append(summaries[key], stmtSummary{digest: row[0], planDigest: row[2], planShape: summaryPlanShape(row[3])})
+	}
+	return summaries, nil
+}
+
+var (
+	digestCommentPattern  = regexp.MustCompile(`/\*.*?\*/`)
+	digestExplainPattern  = regexp.MustCompile(`^\s*(?:explain|desc|describe)(?:\s+analyze)?(?:\s+format\s*=\s*(?:'[^']*'|"[^"]*"|\?|\w+))?\s+`)
+	digestStringPattern   = regexp.MustCompile(`'(?:[^'\\]|\\.|'')*'|"(?:[^"\\]|\\.|"")*"`)
+	digestNumberPattern   = regexp.MustCompile(`\b\d+(?:\.\d+)?(?:e[-+]?\d+)?\b`)
+	digestListPattern     = regexp.MustCompile(`\(\s*(?:\.\.\.|\?(?:\s*,\s*\?)*)\s*\)`)
+	digestNegativePattern = regexp.MustCompile(`-\s*\?`)
+)
+
+// NormalizeDigestText normalizes a statement or DIGEST_TEXT of STATEMENTS_SUMMARY into the same form, so cases can
+// be matched with their summaries. Literals are replaced by "?", lists of literals are folded, and quotes, comments,
+// whitespaces and EXPLAIN prefixes are removed, like "select*fromdb.twherea=?andbin(?)".
+func NormalizeDigestText(sql string) string {
+	s := strings.ToLower(digestCommentPattern.ReplaceAllString(sql, " "))
+	s = digestExplainPattern.ReplaceAllString(s, "")
+	s = digestStringPattern.ReplaceAllString(s, "?")
+	s = digestNumberPattern.ReplaceAllString(s, "?")
+	s = digestNegativePattern.ReplaceAllString(s, "?")
+	s = digestListPattern.ReplaceAllString(s, "(?)")
+	return strings.Join(strings.Fields(strings.Replace(s, "`", "", -1)), "")
+}
+
+// accessObjectPattern matches access objects in plan fingerprints, which are in operator info of plans in
+// STATEMENTS_SUMMARY instead of a separate column.
+var accessObjectPattern = regexp.MustCompile(`\{[^{}]*\}`)
+
+// planShape returns the tree of operators of this plan fingerprint without access objects.
+func planShape(fingerprint string) string {
+	return accessObjectPattern.ReplaceAllString(fingerprint, "")
+}
+
+// summaryPlanShape returns the plan shape of a decoded plan in STATEMENTS_SUMMARY, whose lines are tab-separated
+// columns with a header line, like "\tid\ttask\testRows\toperator info".
+func summaryPlanShape(plan string) string {
+	var header []string
+	var results [][]string
+	for _, line := range strings.Split(strings.Trim(plan, "\n"), "\n") {
+		fields := strings.Split(strings.TrimPrefix(line, "\t"), "\t")
+		for i := range fields {
+			fields[i] = strings.TrimRight(fields[i], " ")
+		}
+		if header == nil {
+			header = fields
+		} else if len(fields) == len(header) {
+			results = append(results, fields)
+		}
+	}
+	return planShape(PlanFingerprint(header, results))
+}
+
+// matchStmtSummary returns the summary of this case, the one with the same plan shape is preferred if its statement
+// has several plans.
+func matchStmtSummary(summaries map[string][]stmtSummary, r EstResult) (stmtSummary, bool) {
+	candidates := summaries[NormalizeDigestText(r.SQL)]
+	if len(candidates) == 0 {
+		return stmtSummary{}, false
+	}
+	shape := planShape(r.PlanFingerprint)
+	for _, c := range candidates {
+		if shape != "" && c.planShape == shape {
+			return c, true
+		}
+	}
+	if len(candidates) == 1 {
+		return candidates[0], true
+	}
+	return stmtSummary{}, false
+}
+
+// crossReferenceStmtSummary records digests of statements and plans in STATEMENTS_SUMMARY of each instance into
+// results of matched cases.
+func crossReferenceStmtSummary(opt Option, instances []tidb.Instance, collector EstResultCollector) error {
+	if !opt.StmtSummary.Enabled {
+		return nil
+	}
+	for insIdx, ins := range instances {
+		summaries, err := readStmtSummaries(ins, opt.StmtSummary.Cluster)
+		if err != nil {
+			return fmt.Errorf("read statements summary of %v, err=%v", ins.Opt().Label, err)
+		}
+		matched := 0
+		for dsIdx := range opt.Datasets {
+			for qtIdx := range opt.QueryTypes {
+				for i, r := range collector.EstResults(insIdx, dsIdx, qtIdx) {
+					s, ok := matchStmtSummary(summaries, r)
+					if !ok {
+						continue
+					}
+					r.StmtDigest, r.StmtPlanDigest = s.digest, s.planDigest
+					collector.UpdateEstResult(insIdx, dsIdx, qtIdx, i, r)
+					matched++
+				}
+			}
+		}
+		fmt.Printf("[StmtSummary] ins=%v, statements=%v, matched-cases=%v\n", ins.Opt().Label, len(summaries), matched)
+	}
+	return nil
+}
+
+// writeStmtSummary writes how many cases of this cell are matched in STATEMENTS_SUMMARY of each instance, and numbers
+// of distinct digests of their statements and plans.
+func writeStmtSummary(md *bytes.Buffer, opt Option, collector EstResultCollector, dsIdx, qtIdx int) {
+	if !opt.StmtSummary.Enabled {
+		return
+	}
+	md.WriteString("\nStatements Summary Cross-Reference\n")
+	md.WriteString("\n| Instance | Cases | Matched | Statement Digests | Plan Digests | Tester Plan Digests |\n")
+	md.WriteString("| ---- | ---- | ---- | ---- | ---- | ---- |\n")
+	for insIdx, ins := range opt.Instances {
+		rs := collector.EstResults(insIdx, dsIdx, qtIdx)
+		matched := 0
+		digests, planDigests, testerDigests := make(map[string]bool), make(map[string]bool), make(map[string]bool)
+		for _, r := range rs {
+			if r.PlanDigest != "" {
+				testerDigests[r.PlanDigest] = true
+			}
+			if r.StmtDigest == "" {
+				continue
+			}
+			matched++
+			digests[r.StmtDigest] = true
+			if r.StmtPlanDigest != "" {
+				planDigests[r.StmtPlanDigest] = true
+			}
+		}
+		md.WriteString(fmt.Sprintf("| %v | %v | %v | %v | %v | %v |\n", ins.Label, len(rs), matched, len(digests), len(planDigests), len(testerDigests)))
+	}
+}
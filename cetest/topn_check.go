@@ -0,0 +1,151 @@
+package cetest
+
+import (
+	"bytes"
+	"fmt"
+	"math"
+	"regexp"
+	"strconv"
+	"strings"
+
+	"github.com/pingcap/errors"
+	"github.com/qw4990/OptimizerTester/tidb"
+)
+
+// TopNCheckOpt cross-checks true cardinalities of point cases against counts of TopN entries of their values in
+// SHOW STATS_TOPN after the run. A discrepancy means either actual rows are calculated or parsed wrongly by this tool,
+// or TiDB collects wrong statistics, so both sides are validated at once.
+type TopNCheckOpt struct {
+	Enabled   bool    `toml:"enabled"`
+	Tolerance float64 `toml:"tolerance"` // relative difference allowed since TopN counts of sampled statistics are scaled, exact if it's 0
+}
+
+func (tc TopNCheckOpt) check() error {
+	if tc.Tolerance < 0 {
+		return errors.Errorf("invalid topn-check tolerance=%v", tc.Tolerance)
+	}
+	return nil
+}
+
+// TagTopNMismatch tags point cases whose actual rows mismatch counts of TopN entries of their values.
+const TagTopNMismatch = "topn-mismatch"
+
+// pointCasePattern matches point cases on single columns, like "SELECT * FROM db.t WHERE c='v'".
+var pointCasePattern = regexp.MustCompile(`^SELECT \* FROM (\w+)\.(\w+) WHERE (\w+)=('.*'|X'[0-9a-f]*'|[^'\s]+)$`)
+
+// topNQueryTypes are query types of point cases whose values may be in TopN.
+var topNQueryTypes = map[QueryType]bool{
+	QTSingleColPointQueryOnCol:   true,
+	QTSingleColPointQueryOnIndex: true,
+	QTSingleColMCVPointOnCol:     true,
+	QTSingleColMCVPointOnIndex:   true,
+}
+
+// crossCheckTopN fills TopNCount of point cases whose values are in TopN, and tags them with TagTopNMismatch
+// if their true cardinalities or actRows of their root operators are different from TopN counts.
+func crossCheckTopN(opt Option, instances []tidb.Instance, collector EstResultCollector) error {
+	if !opt.TopNCheck.Enabled {
+		return nil
+	}
+	for insIdx, ins := range instances {
+		topN := make(map[string]map[string]float64) // db.tb.col, value, count
+		read := make(map[string]bool)               // db.tb
+		for dsIdx := range opt.Datasets {
+			for qtIdx, qt := range opt.QueryTypes {
+				if !topNQueryTypes[qt] {
+					continue
+				}
+				for i, r := range collector.EstResults(insIdx, dsIdx, qtIdx) {
+					m := pointCasePattern.FindStringSubmatch(r.SQL)
+					if m == nil {
+						continue
+					}
+					tb := strings.ToLower(m[1] + "." + m[2])
+					if !read[tb] {
+						if err := readTopN(ins, m[1], m[2], topN); err != nil {
+							return fmt.Errorf("read TopN of %v on %v, err=%v", tb, ins.Opt().Label, err)
+						}
+						read[tb] = true
+					}
+					val := m[4]
+					if unquoted, ok := UnquoteString(val); ok {
+						val = unquoted
+					}
+					cnt, ok := topN[tb+"."+strings.ToLower(m[3])][val]
+					if !ok {
+						continue
+					}
+					r.TopNCount = cnt
+					if mismatch(cnt, r.TrueCard, opt.TopNCheck.Tolerance) ||
+						(len(r.Operators) > 0 && mismatch(cnt, r.Operators[0].ActRows, opt.TopNCheck.Tolerance)) {
+						r.Tags = append(r.Tags, TagTopNMismatch)
+						fmt.Printf("[TopNCheck] ins=%v, sql=%v, true-card=%v, topn-count=%v\n", ins.Opt().Label, r.SQL, r.TrueCard, cnt)
+					}
+					collector.UpdateEstResult(insIdx, dsIdx, qtIdx, i, r)
+				}
+			}
+		}
+	}
+	return nil
+}
+
+// readTopN reads TopN entries of all columns of this table into topN, which is keyed by db.tb.col.
+func readTopN(ins tidb.Instance, db, tb string, topN map[string]map[string]float64) error {
+	header, results, err := queryText(ins, fmt.Sprintf("SHOW STATS_TOPN WHERE db_name='%v' AND table_name='%v'", db, tb))
+	if err != nil {
+		return err
+	}
+	prefix := strings.ToLower(db + "." + tb + ".")
+	ci, ii, vi, ni := columnIdx(header, "column_name"), columnIdx(header, "is_index"), columnIdx(header, "value"), columnIdx(header, "count")
+	if ci == -1 || vi == -1 || ni == -1 {
+		return errors.Errorf("unexpected header %v of SHOW STATS_TOPN", header)
+	}
+	for _, row := range results {
+		if ii != -1 && row[ii] != "0" {
+			continue // TopN of indexes are encoded and may be of multiple columns
+		}
+		cnt, err := strconv.ParseFloat(row[ni], 64)
+		if err != nil {
+			return errors.Errorf("invalid count=%v of TopN of %v.%v", row[ni], tb, row[ci])
+		}
+		key := prefix + strings.ToLower(row[ci])
+		if _, ok := topN[key]; !ok {
+			topN[key] = make(map[string]float64)
+		}
+		topN[key][row[vi]] += cnt // partitions have their own TopN
+	}
+	return nil
+}
+
+// mismatch returns whether act is different from this TopN count beyond the relative tolerance.
+func mismatch(cnt, act, tolerance float64) bool {
+	return math.Abs(cnt-act) > tolerance*math.Max(cnt, act)
+}
+
+// writeTopNCheck writes a table of point cases whose values are in TopN and whose actual rows mismatch TopN counts.
+// It's skipped if the check is disabled or for other query types.
+func writeTopNCheck(md *bytes.Buffer, opt Option, collector EstResultCollector, dsIdx, qtIdx int) {
+	if !opt.TopNCheck.Enabled || !topNQueryTypes[opt.QueryTypes[qtIdx]] {
+		return
+	}
+	md.WriteString("\nTopN Cross-check\n")
+	md.WriteString("\n| Instance | Cases | Cases in TopN | Mismatches | Example |\n")
+	md.WriteString("| ---- | ---- | ---- | ---- | ---- |\n")
+	for insIdx, ins := range opt.Instances {
+		rs := collector.EstResults(insIdx, dsIdx, qtIdx)
+		inTopN, mismatches := 0, 0
+		example := "-"
+		for _, r := range rs {
+			if r.TopNCount > 0 {
+				inTopN++
+			}
+			if r.HasTag(TagTopNMismatch) {
+				mismatches++
+				if example == "-" {
+					example = fmt.Sprintf("`%v`: true-card=%v, topn-count=%v", opt.reportSQL(r.SQL), r.TrueCard, r.TopNCount)
+				}
+			}
+		}
+		md.WriteString(fmt.Sprintf("| %v | %v | %v | %v | %v |\n", ins.Label, len(rs), inTopN, mismatches, example))
+	}
+}
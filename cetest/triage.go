@@ -0,0 +1,152 @@
+package cetest
+
+import (
+	"bytes"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path"
+	"regexp"
+	"strings"
+
+	"github.com/pingcap/errors"
+	"github.com/qw4990/OptimizerTester/tidb"
+)
+
+// maxSlowCases is the max number of slow cases of each instance to capture, so a slow instance won't flood ReportDir.
+const maxSlowCases = 50
+
+var tableRefRegexp = regexp.MustCompile("(?i)\\b(?:FROM|JOIN)\\s+`?([\\w$]+)`?\\.`?([\\w$]+)`?")
+
+// tableRefs returns all tables with their databases referred by this SQL, like [[db1, t1], [db2, t2]].
+func tableRefs(sql string) [][2]string {
+	var refs [][2]string
+	seen := make(map[[2]string]bool)
+	for _, m := range tableRefRegexp.FindAllStringSubmatch(sql, -1) {
+		ref := [2]string{m[1], m[2]}
+		if !seen[ref] {
+			seen[ref] = true
+			refs = append(refs, ref)
+		}
+	}
+	return refs
+}
+
+// triageSlowCases captures a triage bundle for each case whose latency of EXPLAIN exceeds SlowThreshold,
+// which is a directory under ReportDir/slow with the query, its EXPLAIN ANALYZE results, statistics and regions of its tables.
+func triageSlowCases(opt Option, instances []tidb.Instance, collector EstResultCollector) error {
+	if opt.slowThreshold <= 0 {
+		return nil
+	}
+	for insIdx, ins := range instances {
+		n := 0
+		for dsIdx, ds := range opt.Datasets {
+			for qtIdx, qt := range opt.QueryTypes {
+				for _, r := range collector.EstResults(insIdx, dsIdx, qtIdx) {
+					if r.PlanLatency <= opt.slowThreshold || n >= maxSlowCases {
+						continue
+					}
+					dir := path.Join(opt.ReportDir, "slow", fmt.Sprintf("%v-%v-%v-%v", ins.Opt().Label, ds.Label, qt, n))
+					if err := writeTriageBundle(ins, dir, r, opt.Guard); err != nil {
+						return fmt.Errorf("triage %v, err=%v", r.SQL, err)
+					}
+					n++
+				}
+			}
+		}
+		if n > 0 {
+			fmt.Printf("[Triage] ins=%v, captured %v slow cases into %v\n", ins.Opt().Label, n, path.Join(opt.ReportDir, "slow"))
+		}
+	}
+	return nil
+}
+
+func writeTriageBundle(ins tidb.Instance, dir string, r EstResult, g GuardOpt) error {
+	if err := os.MkdirAll(dir, 0755); err != nil {
+		return errors.Trace(err)
+	}
+	query := fmt.Sprintf("-- plan latency: %v, est: %v, true: %v\n%v;\n", r.PlanLatency, r.EstCard, r.TrueCard, r.SQL)
+	if err := ioutil.WriteFile(path.Join(dir, "query.sql"), []byte(query), 0666); err != nil {
+		return errors.Trace(err)
+	}
+
+	var stats, regions []string
+	for _, ref := range tableRefs(r.SQL) {
+		stats = append(stats,
+			fmt.Sprintf("SHOW STATS_META WHERE db_name='%v' AND table_name='%v'", ref[0], ref[1]),
+			fmt.Sprintf("SHOW STATS_HEALTHY WHERE db_name='%v' AND table_name='%v'", ref[0], ref[1]),
+			fmt.Sprintf("SHOW STATS_HISTOGRAMS WHERE db_name='%v' AND table_name='%v'", ref[0], ref[1]))
+		regions = append(regions, fmt.Sprintf("SHOW TABLE %v.%v REGIONS", ref[0], ref[1]))
+	}
+	explain := "EXPLAIN ANALYZE " + g.wrap(r.SQL)
+	if err := g.admit(ins, r.SQL); err != nil { // don't execute it if it's rejected by the guard
+		explain = "EXPLAIN " + r.SQL
+	}
+	files := []struct {
+		name string
+		sqls []string
+	}{
+		{"explain_analyze.txt", []string{explain}},
+		{"stats.txt", stats},
+		{"regions.txt", regions},
+	}
+	for _, f := range files {
+		var buf bytes.Buffer
+		for _, sql := range f.sqls {
+			buf.WriteString(fmt.Sprintf("> %v\n", sql))
+			header, results, err := queryText(ins, sql)
+			if err != nil {
+				buf.WriteString(fmt.Sprintf("error: %v\n\n", err))
+				continue
+			}
+			if strings.HasPrefix(sql, "SHOW TABLE") {
+				buf.WriteString(fmt.Sprintf("region count: %v\n", len(results)))
+			}
+			buf.WriteString(strings.Join(header, "\t") + "\n")
+			for _, row := range results {
+				buf.WriteString(strings.Join(row, "\t") + "\n")
+			}
+			buf.WriteString("\n")
+		}
+		if err := ioutil.WriteFile(path.Join(dir, f.name), buf.Bytes(), 0666); err != nil {
+			return errors.Trace(err)
+		}
+	}
+	return nil
+}
+
+// queryText runs this query and returns its column names and all rows as strings, NULLs are returned as "NULL".
+func queryText(ins tidb.Instance, query string) (header []string, results [][]string, re error) {
+	rows, err := ins.Query(query)
+	if err != nil {
+		return nil, nil, err
+	}
+	defer func() {
+		if err := rows.Close(); err != nil && re == nil {
+			re = err
+		}
+	}()
+	if header, err = rows.Columns(); err != nil {
+		return nil, nil, errors.Trace(err)
+	}
+	for rows.Next() {
+		vals := make([]*string, len(header))
+		ptrs := make([]interface{}, len(header))
+		for i := range vals {
+			ptrs[i] = &vals[i]
+		}
+		if err := rows.Scan(ptrs...); err != nil {
+			return nil, nil, errors.Trace(err)
+		}
+		row := make([]string, len(header))
+		for i, v := range vals {
+			if v == nil {
+				row[i] = "NULL"
+			} else {
+				row[i] = *v
+			}
+		}
+		results = append(results, row)
+	}
+	return header, results, errors.Trace(rows.Err())
+}
@@ -10,11 +10,56 @@ import (
 	"github.com/qw4990/OptimizerTester/tidb"
 )
 
-func getEstRowFromExplain(ins tidb.Instance, query string) (estRow float64, re error) {
-	sql := "EXPLAIN " + query
+// getEstResultFromExplain returns the estimated row count and cost of this query and the latency of EXPLAIN,
+// which is approximately the time cost of the optimizer, and the full plan is kept if keepPlan is true.
+func getEstResultFromExplain(ins tidb.Instance, query string, keepPlan bool) (r EstResult, re error) {
+	begin := time.Now()
+	header, results, err := queryExplain(ins, "EXPLAIN", query)
+	if err != nil {
+		return EstResult{}, err
+	}
+	latency := time.Since(begin)
+	if r, err = ExtractEstResultByHeader(header, results); err != nil {
+		return EstResult{}, parseExplainError(query, err)
+	}
+	r.PlanLatency = latency
+	describePlan(&r, header, results, keepPlan)
+	return r, nil
+}
+
+// describePlan sets all fields of this result derived from the plan in results of EXPLAIN.
+func describePlan(r *EstResult, header []string, results [][]string, keepPlan bool) {
+	r.PlanFingerprint = PlanFingerprint(header, results)
+	r.PlanDigest = PlanDigest(r.PlanFingerprint)
+	r.ApplyEstRows, _ = applyProbeEstRows(header, results)
+	r.MPPJoin = mppJoinType(header, results)
+	r.PseudoStats = pseudoStats(header, results)
+	if keepPlan {
+		r.Plan = planText(header, results)
+	}
+}
+
+// planText formats results of EXPLAIN as lines of tab-separated columns with a header line.
+func planText(header []string, results [][]string) string {
+	var b strings.Builder
+	b.WriteString(strings.Join(header, "\t"))
+	for _, row := range results {
+		b.WriteString("\n")
+		b.WriteString(strings.Join(row, "\t"))
+	}
+	return b.String()
+}
+
+// queryExplain runs this query with this EXPLAIN prefix and the explain format of this instance,
+// and returns column names and all rows of its results.
+func queryExplain(ins tidb.Instance, prefix, query string) (header []string, results [][]string, re error) {
+	sql := prefix + " " + query
+	if f := ins.Opt().ExplainFormat; f != "" {
+		sql = fmt.Sprintf("%v FORMAT='%v' %v", prefix, f, query)
+	}
 	rows, err := ins.Query(sql)
 	if err != nil {
-		return 0, fmt.Errorf("run sql=%v, err=%v", sql, err)
+		return nil, nil, fmt.Errorf("run sql=%v, err=%v", sql, err)
 	}
 	defer func() {
 		if err := rows.Close(); err != nil && re == nil {
@@ -22,12 +67,12 @@ func getEstRowFromExplain(ins tidb.Instance, query string) (estRow float64, re e
 		}
 	}()
 
-	types, err := rows.ColumnTypes()
+	header, err = rows.Columns()
 	if err != nil {
-		return 0, err
+		return nil, nil, err
 	}
-	nCols := len(types)
-	results := make([][]string, 0, 8)
+	nCols := len(header)
+	results = make([][]string, 0, 8)
 	for rows.Next() {
 		cols := make([]string, nCols)
 		ptrs := make([]interface{}, nCols)
@@ -35,12 +80,69 @@ func getEstRowFromExplain(ins tidb.Instance, query string) (estRow float64, re e
 			ptrs[i] = &cols[i]
 		}
 		if err := rows.Scan(ptrs...); err != nil {
-			return 0, err
+			return nil, nil, err
 		}
 		results = append(results, cols)
 	}
+	return header, results, nil
+}
 
-	return ExtractEstRows(results, ins.Version())
+// ExtractEstResultByHeader extracts the EstResult of the root operator from results of EXPLAIN or EXPLAIN ANALYZE
+// by their column names, so it works with all explain formats like 'row', 'brief' and 'verbose' of all versions.
+// TrueCard is extracted from actRows, or rows in execution info for v3.x, and EstCost is 0 if it's not in results.
+func ExtractEstResultByHeader(header []string, results [][]string) (EstResult, error) {
+	idIdx, estIdx, actIdx, costIdx, infoIdx := -1, -1, -1, -1, -1
+	for i, h := range header {
+		switch strings.ToLower(strings.Replace(h, " ", "", -1)) {
+		case "id":
+			idIdx = i
+		case "estrows", "count":
+			estIdx = i
+		case "actrows":
+			actIdx = i
+		case "estcost":
+			costIdx = i
+		case "executioninfo", "execution_info":
+			infoIdx = i
+		}
+	}
+	if estIdx == -1 {
+		return EstResult{}, errors.Errorf("unknown explain format with columns %v", header)
+	}
+	if len(results) == 0 {
+		return EstResult{}, errors.Errorf("empty explain results")
+	}
+	root := results[0]
+
+	var r EstResult
+	var err error
+	if idIdx != -1 {
+		r.Operator = strings.TrimSpace(root[idIdx])
+	}
+	if r.EstCard, err = strconv.ParseFloat(root[estIdx], 64); err != nil {
+		return EstResult{}, errors.Trace(err)
+	}
+	if costIdx != -1 && root[costIdx] != "" && root[costIdx] != "N/A" {
+		if r.EstCost, err = strconv.ParseFloat(root[costIdx], 64); err != nil {
+			return EstResult{}, errors.Trace(err)
+		}
+	}
+	if actIdx != -1 {
+		if r.TrueCard, err = strconv.ParseFloat(root[actIdx], 64); err != nil {
+			return EstResult{}, errors.Trace(err)
+		}
+	} else if infoIdx != -1 {
+		//	time:2.95024ms, loops:1, rows:0
+		for _, item := range strings.Split(root[infoIdx], ",") {
+			item = strings.TrimSpace(item)
+			if strings.HasPrefix(item, "rows:") {
+				if r.TrueCard, err = strconv.ParseFloat(strings.TrimPrefix(item, "rows:"), 64); err != nil {
+					return EstResult{}, errors.Trace(err)
+				}
+			}
+		}
+	}
+	return r, nil
 }
 
 func ExtractEstRows(explainResults [][]string, version string) (float64, error) {
@@ -63,41 +165,17 @@ func extractEstRowsForV4(explainResults [][]string) (float64, error) {
 	return est, nil
 }
 
-func getEstResultFromExplainAnalyze(ins tidb.Instance, query string) (r EstResult, re error) {
-	begin := time.Now()
-	sql := "EXPLAIN ANALYZE " + query
-	rows, err := ins.Query(sql)
-	if err != nil {
-		return EstResult{}, errors.Trace(err)
-	}
-	if time.Since(begin) > time.Millisecond*50 {
-		fmt.Printf("[SLOW QUERY] %v cost %v\n", sql, time.Since(begin))
-	}
-	defer func() {
-		if err := rows.Close(); err != nil && re == nil {
-			re = err
-		}
-	}()
-
-	types, err := rows.ColumnTypes()
+func getEstResultFromExplainAnalyze(ins tidb.Instance, query string) (EstResult, error) {
+	header, results, err := queryExplain(ins, "EXPLAIN ANALYZE", query)
 	if err != nil {
 		return EstResult{}, err
 	}
-	nCols := len(types)
-	results := make([][]string, 0, 8)
-	for rows.Next() {
-		cols := make([]string, nCols)
-		ptrs := make([]interface{}, nCols)
-		for i := 0; i < nCols; i++ {
-			ptrs[i] = &cols[i]
-		}
-		if err := rows.Scan(ptrs...); err != nil {
-			return EstResult{}, err
-		}
-		results = append(results, cols)
+	r, err := ExtractEstResultByHeader(header, results)
+	if err != nil {
+		return EstResult{}, parseExplainError(query, err)
 	}
-
-	return ExtractEstResult(results, ins.Version())
+	r.Operators, err = ParseExplainAnalyze(header, results)
+	return r, parseExplainError(query, err)
 }
 
 // ExtractEstResult extracts EstResults from results of explain analyze
@@ -147,3 +225,20 @@ func extractEstResultForV3(analyzeResults [][]string) (EstResult, error) {
 		TrueCard: act,
 	}, nil
 }
+
+// validVersion returns whether this version can be converted by tidb.ToComparableVersion, like v4.0.0.
+func validVersion(ver string) bool {
+	if !strings.HasPrefix(ver, "v") {
+		return false
+	}
+	xs := strings.Split(ver[1:], ".")
+	if len(xs) != 3 {
+		return false
+	}
+	for _, x := range xs {
+		if _, err := strconv.Atoi(x); err != nil {
+			return false
+		}
+	}
+	return true
+}
@@ -0,0 +1,182 @@
+package cetest
+
+import (
+	"bytes"
+	"fmt"
+	"math"
+	"regexp"
+	"strings"
+
+	"github.com/pingcap/errors"
+	"github.com/qw4990/OptimizerTester/tidb"
+)
+
+// WhatIfIndexOpt is a candidate index, all cases reading its table are re-estimated with it after the run,
+// so reports show whether it would change their plans and estimations, like an evaluator of index advisors.
+type WhatIfIndexOpt struct {
+	DB      string   `toml:"db"`
+	Table   string   `toml:"table"`
+	Columns []string `toml:"columns"`
+
+	// Mode is how the candidate is created: "hypo" by the hint HYPO_INDEX which requires v7.3 or later and modifies
+	// nothing, or "scratch" by a real index on a copy of the table in the database "<db>_whatif". "hypo" if empty.
+	Mode string `toml:"mode"`
+}
+
+// whatIfIndexName is the name of candidate indexes in hints and scratch tables.
+const whatIfIndexName = "whatif_idx"
+
+// Name returns the description of this candidate used in reports, like "db.t(a,b)".
+func (wi WhatIfIndexOpt) Name() string {
+	return fmt.Sprintf("%v.%v(%v)", wi.DB, wi.Table, strings.Join(wi.Columns, ","))
+}
+
+func (wi WhatIfIndexOpt) scratchDB() string {
+	return wi.DB + "_whatif"
+}
+
+func checkWhatIfIndexes(opt Option) error {
+	for _, wi := range opt.WhatIfIndexes {
+		if wi.DB == "" || wi.Table == "" || len(wi.Columns) == 0 {
+			return errors.Errorf("what-if index %v requires db, table and columns", wi.Name())
+		}
+		switch strings.ToLower(wi.Mode) {
+		case "", "hypo":
+		case "scratch":
+			if opt.ReadOnly {
+				return errors.Errorf("what-if index %v in scratch mode is not allowed in read-only mode", wi.Name())
+			}
+			if err := checkScratchDB(wi.scratchDB(), opt); err != nil {
+				return errors.Errorf("invalid scratch database of what-if index %v, err=%v", wi.Name(), err)
+			}
+		default:
+			return errors.Errorf("unknown mode=%v of what-if index %v", wi.Mode, wi.Name())
+		}
+	}
+	return nil
+}
+
+// WhatIfResult is the estimation of a case with a candidate index.
+type WhatIfResult struct {
+	Index           string // see WhatIfIndexOpt.Name
+	EstCard         float64
+	PlanFingerprint string
+}
+
+// evaluateWhatIfIndexes re-estimates all cases reading tables of candidate indexes with them on each instance,
+// and keeps new estimations in results. Candidates in hypo mode are skipped on instances before v7.3. Scratch
+// databases of candidates in scratch mode are dropped at the end.
+func evaluateWhatIfIndexes(opt Option, instances []tidb.Instance, collector EstResultCollector) error {
+	for insIdx, ins := range instances {
+		defer func(ins tidb.Instance) {
+			for _, wi := range opt.WhatIfIndexes {
+				if err := opt.scratches.drop(ins, wi.scratchDB()); err != nil {
+					fmt.Printf("[WhatIf] drop the scratch database %v on %v, err=%v\n", wi.scratchDB(), ins.Opt().Label, err)
+				}
+			}
+		}(ins)
+		for _, wi := range opt.WhatIfIndexes {
+			if err := evaluateWhatIfIndex(opt, insIdx, ins, wi, collector); err != nil {
+				return fmt.Errorf("evaluate what-if index %v on %v, err=%v", wi.Name(), ins.Opt().Label, err)
+			}
+		}
+	}
+	return nil
+}
+
+func evaluateWhatIfIndex(opt Option, insIdx int, ins tidb.Instance, wi WhatIfIndexOpt, collector EstResultCollector) error {
+	refPattern := regexp.MustCompile(fmt.Sprintf("(?i)\\b`?%v`?\\.`?%v`?\\b", regexp.QuoteMeta(wi.DB), regexp.QuoteMeta(wi.Table)))
+	var rewrite func(sql string) string
+	if strings.ToLower(wi.Mode) == "scratch" {
+		if err := opt.scratches.create(ins, wi.scratchDB()); err != nil {
+			return err
+		}
+		if err := cloneTable(ins, wi.DB, wi.Table, wi.scratchDB(), 0); err != nil {
+			return err
+		}
+		defer func() {
+			if err := ins.Exec(fmt.Sprintf("DROP TABLE IF EXISTS %v.%v", wi.scratchDB(), wi.Table)); err != nil {
+				fmt.Printf("[WhatIf] drop the scratch table of %v on %v, err=%v\n", wi.Name(), ins.Opt().Label, err)
+			}
+		}()
+		for _, sql := range []string{
+			fmt.Sprintf("ALTER TABLE %v.%v ADD INDEX %v(%v)", wi.scratchDB(), wi.Table, whatIfIndexName, strings.Join(wi.Columns, ",")),
+			fmt.Sprintf("ANALYZE TABLE %v.%v", wi.scratchDB(), wi.Table),
+		} {
+			if err := ins.Exec(sql); err != nil {
+				return err
+			}
+		}
+		rewrite = func(sql string) string {
+			return refPattern.ReplaceAllString(sql, wi.scratchDB()+"."+wi.Table)
+		}
+	} else {
+		if tidb.ToComparableVersion(ins.Version()) < tidb.ToComparableVersion("v7.3.0") {
+			fmt.Printf("[WhatIf] skip %v on ins=%v (%v), which doesn't support hypothetical indexes\n", wi.Name(), ins.Opt().Label, ins.Version())
+			return nil
+		}
+		hint := fmt.Sprintf("HYPO_INDEX(%v.%v, %v, %v)", wi.DB, wi.Table, whatIfIndexName, strings.Join(wi.Columns, ", "))
+		rewrite = func(sql string) string {
+			return tidb.AddHints(sql, hint)
+		}
+	}
+
+	for dsIdx := range opt.Datasets {
+		for qtIdx := range opt.QueryTypes {
+			for i, r := range collector.EstResults(insIdx, dsIdx, qtIdx) {
+				if !refPattern.MatchString(r.SQL) {
+					continue
+				}
+				wr, err := getEstResultFromExplain(ins, rewrite(r.SQL), false)
+				if err != nil {
+					return err
+				}
+				r.WhatIf = append(r.WhatIf, WhatIfResult{Index: wi.Name(), EstCard: wr.EstCard, PlanFingerprint: wr.PlanFingerprint})
+				collector.UpdateEstResult(insIdx, dsIdx, qtIdx, i, r)
+			}
+		}
+	}
+	return nil
+}
+
+// writeWhatIfIndexes writes a table of candidate indexes evaluated on cases of this cell, with how many plans they
+// change and absolute PErrors before and after them. It's skipped if no candidate is evaluated on this cell.
+func writeWhatIfIndexes(md *bytes.Buffer, opt Option, collector EstResultCollector, dsIdx, qtIdx int) {
+	header := false
+	for insIdx, ins := range opt.Instances {
+		for _, wi := range opt.WhatIfIndexes {
+			cases, changed := 0, 0
+			totBefore, totAfter := 0.0, 0.0
+			example := "-"
+			for _, r := range collector.EstResults(insIdx, dsIdx, qtIdx) {
+				for _, w := range r.WhatIf {
+					if w.Index != wi.Name() {
+						continue
+					}
+					cases++
+					totBefore += math.Abs(PError(r))
+					totAfter += math.Abs(PError(EstResult{EstCard: w.EstCard, TrueCard: r.TrueCard}))
+					if w.PlanFingerprint != r.PlanFingerprint {
+						changed++
+						if example == "-" {
+							example = fmt.Sprintf("`%v`: `%v` => `%v`", strings.Replace(opt.reportSQL(r.SQL), "|", "\\|", -1),
+								r.PlanFingerprint, w.PlanFingerprint)
+						}
+					}
+					break
+				}
+			}
+			if cases == 0 {
+				continue
+			}
+			if !header {
+				md.WriteString("\nWhat-If Indexes\n")
+				md.WriteString("\n| Instance | Index | Cases | Changed Plans | Avg Abs PError Before | Avg Abs PError After | Example |\n")
+				md.WriteString("| ---- | ---- | ---- | ---- | ---- | ---- | ---- |\n")
+				header = true
+			}
+			md.WriteString(fmt.Sprintf("| %v | %v | %v | %v | %.3f | %.3f | %v |\n", ins.Label, wi.Name(), cases, changed,
+				totBefore/float64(cases), totAfter/float64(cases), example))
+		}
+	}
+}
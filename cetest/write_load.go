@@ -0,0 +1,319 @@
+package cetest
+
+import (
+	"bytes"
+	"fmt"
+	"math"
+	"math/rand"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/pingcap/errors"
+	"github.com/qw4990/OptimizerTester/tidb"
+)
+
+// WriteLoadOpt runs a background write workload against tables used by datasets on all instances during the run,
+// so estimations are measured under churn like in production, where statistics always lag behind data. Writes are
+// never reverted, so all datasets must run on scratch databases, see ScratchOpt, and only their clones are written.
+// True cardinalities calculated before the run go stale under writes, so it requires an executor measuring true
+// cardinalities, and cases whose true cardinalities changed are compared against measured ones and tagged with
+// TagChurned.
+type WriteLoadOpt struct {
+	Inserts int      `toml:"inserts"` // rows inserted into each table per second by copying existing rows
+	Updates int      `toml:"updates"` // rows updated in each table per second by moving them between existing values of used columns
+	Tables  []string `toml:"tables"`  // tables like "scratch_db.tb" to write, all tables used by datasets if empty
+}
+
+// TagChurned tags cases whose true cardinalities are changed by the write load, see WriteLoadOpt.
+const TagChurned = "churned"
+
+// writeLoadValues is the number of distinct values of each column sampled for updates.
+const writeLoadValues = 100
+
+func (wl WriteLoadOpt) enabled() bool {
+	return wl.Inserts > 0 || wl.Updates > 0
+}
+
+func (wl WriteLoadOpt) check(opt Option) error {
+	if wl.Inserts < 0 || wl.Updates < 0 {
+		return errors.Errorf("invalid write-load inserts=%v or updates=%v", wl.Inserts, wl.Updates)
+	}
+	if !wl.enabled() {
+		return nil
+	}
+	if opt.ReadOnly {
+		return errors.Errorf("write-load is not allowed in read-only mode")
+	}
+	if !opt.executor.MeasuresTruth() {
+		return errors.Errorf("write-load requires an executor measuring true cardinalities like explain-analyze, but the executor is %v", opt.executor.Name())
+	}
+	if strings.TrimSpace(opt.Snapshot) != "" {
+		return errors.Errorf("write-load is not allowed with snapshot=%v, since cases reading the snapshot never see the churn", opt.Snapshot)
+	}
+	for _, ds := range opt.Datasets {
+		if ds.Scratch.DB == "" {
+			return errors.Errorf("write-load requires a scratch database of dataset=%v, since writes would change its data permanently", ds.Label)
+		}
+	}
+	for _, tbl := range wl.Tables {
+		if !strings.Contains(tbl, ".") {
+			return errors.Errorf("invalid write-load table=%v, which should be like db.tb", tbl)
+		}
+		db := strings.SplitN(tbl, ".", 2)[0]
+		scratch := false
+		for _, ds := range opt.Datasets {
+			scratch = scratch || strings.EqualFold(ds.Scratch.DB, db)
+		}
+		if !scratch {
+			return errors.Errorf("write-load table=%v is not in a scratch database of any dataset", tbl)
+		}
+	}
+	return nil
+}
+
+// writeStats counts writes of the write load to a table on an instance.
+type writeStats struct {
+	Instance string
+	Table    string
+	Inserted int64
+	Updated  int64
+	Errors   int
+	LastErr  string
+}
+
+// writeLoad writes tables on all instances during the run, and keeps true cardinalities of cases changed by it.
+type writeLoad struct {
+	opt WriteLoadOpt
+
+	mu     sync.Mutex
+	stats  []*writeStats
+	truths map[string][2]float64 // instance/sql, calculated and measured true cardinalities
+
+	stopCh chan struct{} // nil if it's not started
+	wg     sync.WaitGroup
+}
+
+// newWriteLoad returns nil if the write load is disabled.
+func newWriteLoad(opt WriteLoadOpt) *writeLoad {
+	if !opt.enabled() {
+		return nil
+	}
+	return &writeLoad{opt: opt, truths: make(map[string][2]float64)}
+}
+
+// start starts writing these tables on these instances until it's stopped. Tables and their used columns are
+// keyed by names like "db.tb", and only tables in WriteLoadOpt.Tables are written if it's set.
+func (w *writeLoad) start(instances []tidb.Instance, tables map[string]map[string]DATATYPE) error {
+	if w == nil {
+		return nil
+	}
+	names := make([]string, 0, len(tables))
+	for tbl := range tables {
+		if len(w.opt.Tables) == 0 || containsFold(w.opt.Tables, tbl) {
+			names = append(names, tbl)
+		}
+	}
+	sort.Strings(names)
+	if len(names) == 0 {
+		return errors.Errorf("no table to write by the write load")
+	}
+	w.stats = nil // the load is started again in each run of the matrix
+	w.stopCh = make(chan struct{})
+	for _, ins := range instances {
+		for _, tbl := range names {
+			values, err := sampleColumnValues(ins, tbl, tables[tbl])
+			if err != nil {
+				w.stop()
+				return err
+			}
+			s := &writeStats{Instance: ins.Opt().Label, Table: tbl}
+			w.stats = append(w.stats, s)
+			w.wg.Add(1)
+			go w.run(ins, tbl, values, s)
+		}
+	}
+	fmt.Printf("[WriteLoad] write %v on all instances, inserts=%v/s, updates=%v/s\n", names, w.opt.Inserts, w.opt.Updates)
+	return nil
+}
+
+// run writes this table on this instance every second. Inserts are given up once they fail, since copying rows
+// fails on all tables with unique keys, but updates go on.
+func (w *writeLoad) run(ins tidb.Instance, tbl string, values map[string][]string, s *writeStats) {
+	defer w.wg.Done()
+	cols := make([]string, 0, len(values))
+	for col, vals := range values {
+		if len(vals) > 1 {
+			cols = append(cols, col)
+		}
+	}
+	sort.Strings(cols)
+	inserts := w.opt.Inserts
+	ticker := time.NewTicker(time.Second)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-w.stopCh:
+			return
+		case <-ticker.C:
+		}
+		if inserts > 0 {
+			err := ins.Exec(fmt.Sprintf("INSERT INTO %v SELECT * FROM %v LIMIT %v", tbl, tbl, inserts))
+			w.mu.Lock()
+			if err != nil {
+				s.Errors++
+				s.LastErr = err.Error()
+				inserts = 0
+				fmt.Printf("[WriteLoad] stop inserting into %v on %v, err=%v\n", tbl, s.Instance, err)
+			} else {
+				s.Inserted += int64(inserts)
+			}
+			w.mu.Unlock()
+		}
+		if w.opt.Updates > 0 && len(cols) > 0 {
+			col := cols[rand.Intn(len(cols))]
+			vals := values[col]
+			from, to := rand.Intn(len(vals)), rand.Intn(len(vals)-1)
+			if to >= from {
+				to++
+			}
+			err := ins.Exec(fmt.Sprintf("UPDATE %v SET %v = %v WHERE %v = %v LIMIT %v", tbl, col, vals[to], col, vals[from], w.opt.Updates))
+			w.mu.Lock()
+			if err != nil {
+				s.Errors++
+				s.LastErr = err.Error()
+			} else {
+				s.Updated += int64(w.opt.Updates)
+			}
+			w.mu.Unlock()
+		}
+	}
+}
+
+// sampleColumnValues returns literals of some distinct non-NULL values of these columns of this table, which rows
+// are moved between by updates.
+func sampleColumnValues(ins tidb.Instance, tbl string, cols map[string]DATATYPE) (map[string][]string, error) {
+	values := make(map[string][]string, len(cols))
+	for col, tp := range cols {
+		_, results, err := queryText(ins, fmt.Sprintf("SELECT DISTINCT %v FROM %v WHERE %v IS NOT NULL LIMIT %v", col, tbl, col, writeLoadValues))
+		if err != nil {
+			return nil, err
+		}
+		for _, row := range results {
+			values[col] = append(values[col], tp.literal(row[0]))
+		}
+	}
+	return values, nil
+}
+
+// stop stops writing and waits for all writers.
+func (w *writeLoad) stop() {
+	if w == nil || w.stopCh == nil {
+		return
+	}
+	close(w.stopCh)
+	w.wg.Wait()
+	w.stopCh = nil
+}
+
+// measured records the true cardinality of this case measured on this instance, which differs from the calculated
+// one. It returns false if there is no write load, then the difference is an error.
+func (w *writeLoad) measured(ins, query string, calculated, measured float64) bool {
+	if w == nil {
+		return false
+	}
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	w.truths[ins+"/"+query] = [2]float64{calculated, measured}
+	return true
+}
+
+// churn replaces the calculated true cardinality of this result on this instance with the measured one if it's
+// changed by the write load, and tags it with TagChurned.
+func (w *writeLoad) churn(ins string, r *EstResult) {
+	if w == nil {
+		return
+	}
+	w.mu.Lock()
+	truth, ok := w.truths[ins+"/"+r.SQL]
+	delete(w.truths, ins+"/"+r.SQL)
+	w.mu.Unlock()
+	if !ok || r.TrueCard != truth[0] {
+		return // correlated cases are changed after they're measured
+	}
+	r.CalcTrueCard, r.TrueCard = truth[0], truth[1]
+	r.Tags = append(r.Tags, TagChurned)
+}
+
+// datasetColumns returns all columns used by these datasets and their types, grouped by tables like "db.tb", where
+// db is the scratch database cases run on.
+func datasetColumns(opt Option, datasets []Dataset) map[string]map[string]DATATYPE {
+	tables := make(map[string]map[string]DATATYPE)
+	for dsIdx, ds := range datasets {
+		b, ok := ds.(interface{ base() *datasetBase })
+		if !ok {
+			continue
+		}
+		for tb, cols := range b.base().usedColumns() {
+			tbl := opt.Datasets[dsIdx].DB + "." + tb
+			if tables[tbl] == nil {
+				tables[tbl] = make(map[string]DATATYPE)
+			}
+			for col, tp := range cols {
+				tables[tbl][col] = tp
+			}
+		}
+	}
+	return tables
+}
+
+// writeWriteLoad writes rows written by the write load into each table, it's skipped if there is no write load.
+func writeWriteLoad(md *bytes.Buffer, opt Option) {
+	w := opt.writes
+	if w == nil {
+		return
+	}
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	md.WriteString("# Write Load\n")
+	md.WriteString(fmt.Sprintf("\nTables are written during the run, inserts=%v/s, updates=%v/s. Cases whose true cardinalities are changed are tagged with `%v` and compared against measured true cardinalities.\n",
+		w.opt.Inserts, w.opt.Updates, TagChurned))
+	md.WriteString("\n| Instance | Table | Inserted | Updated | Errors | Last Error |\n")
+	md.WriteString("| ---- | ---- | ---- | ---- | ---- | ---- |\n")
+	for _, s := range w.stats {
+		md.WriteString(fmt.Sprintf("| %v | %v | %v | %v | %v | %v |\n", s.Instance, s.Table, s.Inserted, s.Updated, s.Errors, markdownCell(s.LastErr)))
+	}
+	md.WriteString("\n")
+}
+
+// writeChurnAccuracy compares mean absolute PErrors of each instance against measured and calculated true
+// cardinalities, which shows how much estimations lag behind data under the write load.
+func writeChurnAccuracy(md *bytes.Buffer, opt Option, collector EstResultCollector, dsIdx, qtIdx int) {
+	if opt.writes == nil {
+		return
+	}
+	md.WriteString("\nAccuracy under Write Load\n")
+	md.WriteString("\n| Instance | Cases | Churned | Mean \\|PError\\| (Measured) | Mean \\|PError\\| (Before Writes) |\n")
+	md.WriteString("| ---- | ---- | ---- | ---- | ---- |\n")
+	for insIdx, ins := range opt.Instances {
+		rs := collector.EstResults(insIdx, dsIdx, qtIdx)
+		churned := 0
+		var measured, before float64
+		for _, r := range rs {
+			pe := PError(r)
+			measured += math.Abs(pe)
+			if r.HasTag(TagChurned) {
+				churned++
+				calc := r
+				calc.TrueCard = r.CalcTrueCard
+				pe = PError(calc)
+			}
+			before += math.Abs(pe)
+		}
+		if len(rs) > 0 {
+			measured, before = measured/float64(len(rs)), before/float64(len(rs))
+		}
+		md.WriteString(fmt.Sprintf("| %v | %v | %v | %.3f | %.3f |\n", ins.Label, len(rs), churned, measured, before))
+	}
+}
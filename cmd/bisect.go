@@ -0,0 +1,36 @@
+package cmd
+
+import (
+	"fmt"
+
+	"github.com/pingcap/errors"
+	"github.com/qw4990/OptimizerTester/cetest"
+	"github.com/spf13/cobra"
+)
+
+func newBisectCmd() *cobra.Command {
+	var confs []string
+	cmd := &cobra.Command{
+		Use:   "bisect",
+		Short: "Locate the builds where a regression of a cell appeared",
+		RunE: func(cmd *cobra.Command, args []string) error {
+			if len(confs) == 0 {
+				return errors.New("no config")
+			}
+			opt, err := cetest.DecodeOptionFiles(confs)
+			if err != nil {
+				return err
+			}
+			result, err := cetest.RunBisect(opt)
+			if err != nil {
+				return err
+			}
+			fmt.Printf("The regression appeared between %v (%v, commit %v, p90=%.3f) and %v (%v, commit %v, p90=%.3f)\n",
+				result.Good.Instance, result.Good.Version, result.Good.Commit, result.Good.P90,
+				result.Bad.Instance, result.Bad.Version, result.Bad.Commit, result.Bad.P90)
+			return nil
+		},
+	}
+	cmd.Flags().StringSliceVar(&confs, "config", nil, "CETester config path with the bisect section, instances are builds ordered from the good one to the bad one")
+	return cmd
+}
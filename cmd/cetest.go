@@ -7,17 +7,28 @@ import (
 )
 
 func newCETestCmd() *cobra.Command {
-	var conf string
+	var confs []string
+	var tags []string
+	var playground bool
 	cmd := &cobra.Command{
 		Use:   "cetest",
 		Short: "Cardinality Estimation Test",
 		RunE: func(cmd *cobra.Command, args []string) error {
-			if conf == "" {
+			if playground {
+				opt, err := cetest.PlaygroundOption()
+				if err != nil {
+					return err
+				}
+				return cetest.RunCETest(opt, tags)
+			}
+			if len(confs) == 0 {
 				return errors.New("no config")
 			}
-			return cetest.RunCETestWithConfig(conf)
+			return cetest.RunCETestWithConfig(confs, tags)
 		},
 	}
-	cmd.Flags().StringVar(&conf, "config", "", "CETester config path")
+	cmd.Flags().StringSliceVar(&confs, "config", nil, "CETester config path, later configs are overlays of the first one, like --config base.toml --config nightly.toml")
+	cmd.Flags().BoolVar(&playground, "playground", false, "run a small test on the mock dataset against a local tiup playground")
+	cmd.Flags().StringSliceVar(&tags, "tags", nil, "only test cases with any of these tags, like mcv,out-of-range")
 	return cmd
 }
@@ -0,0 +1,18 @@
+package cmd
+
+import (
+	"github.com/qw4990/OptimizerTester/cetest"
+	"github.com/spf13/cobra"
+)
+
+func newConvertResultsCmd() *cobra.Command {
+	cmd := &cobra.Command{
+		Use:   "convert-results <results.bin> <output>",
+		Short: "Convert raw results in the binary format into CSV, JSON or Parquet by the extension of the output",
+		Args:  cobra.ExactArgs(2),
+		RunE: func(cmd *cobra.Command, args []string) error {
+			return cetest.ConvertRawResults(args[0], args[1])
+		},
+	}
+	return cmd
+}
@@ -0,0 +1,45 @@
+package cmd
+
+import (
+	"github.com/pingcap/errors"
+	"github.com/qw4990/OptimizerTester/cetest"
+	"github.com/spf13/cobra"
+)
+
+func newDistributeCmd() *cobra.Command {
+	var confs []string
+	var output string
+	cmd := &cobra.Command{
+		Use:   "distribute",
+		Short: "Split the test into shards of instances and generate Kubernetes Jobs running them in parallel, whose reports are merged by merge-shards",
+		RunE: func(cmd *cobra.Command, args []string) error {
+			if len(confs) == 0 {
+				return errors.New("no config")
+			}
+			return cetest.Distribute(confs, output)
+		},
+	}
+	cmd.Flags().StringSliceVar(&confs, "config", nil, "CETester config path with the [distribute] section, later configs are overlays of the first one")
+	cmd.Flags().StringVar(&output, "output", "./k8s", "directory of generated manifests")
+	return cmd
+}
+
+func newMergeShardsCmd() *cobra.Command {
+	var confs []string
+	cmd := &cobra.Command{
+		Use:   "merge-shards",
+		Short: "Merge raw results of all shards generated by distribute and generate reports into report-dir",
+		RunE: func(cmd *cobra.Command, args []string) error {
+			if len(confs) == 0 {
+				return errors.New("no config")
+			}
+			opt, err := cetest.DecodeOptionFiles(confs)
+			if err != nil {
+				return err
+			}
+			return cetest.MergeShards(opt)
+		},
+	}
+	cmd.Flags().StringSliceVar(&confs, "config", nil, "CETester config path of the distributed test, later configs are overlays of the first one")
+	return cmd
+}
@@ -0,0 +1,34 @@
+package cmd
+
+import (
+	"fmt"
+	"io/ioutil"
+
+	"github.com/qw4990/OptimizerTester/cetest"
+	"github.com/spf13/cobra"
+)
+
+func newGenConfigCmd() *cobra.Command {
+	var datasets []string
+	var instances int
+	var output string
+	cmd := &cobra.Command{
+		Use:   "gen-config",
+		Short: "Generate a commented example config of cetest",
+		RunE: func(cmd *cobra.Command, args []string) error {
+			conf, err := cetest.GenConfig(datasets, instances)
+			if err != nil {
+				return err
+			}
+			if output == "" {
+				fmt.Print(conf)
+				return nil
+			}
+			return ioutil.WriteFile(output, []byte(conf), 0666)
+		},
+	}
+	cmd.Flags().StringSliceVar(&datasets, "datasets", []string{"zipfx"}, "datasets to test, run list to see all of them")
+	cmd.Flags().IntVar(&instances, "instances", 2, "number of instances to compare")
+	cmd.Flags().StringVar(&output, "output", "", "path to write the config, it's printed if empty")
+	return cmd
+}
@@ -0,0 +1,50 @@
+package cmd
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+
+	"github.com/qw4990/OptimizerTester/cetest"
+	"github.com/spf13/cobra"
+)
+
+func newListCmd() *cobra.Command {
+	cmd := &cobra.Command{
+		Use:   "list",
+		Short: "List all datasets, query types and metrics",
+		RunE: func(cmd *cobra.Command, args []string) error {
+			fmt.Println("Datasets:")
+			for _, ds := range cetest.ListDatasets() {
+				qts := make([]string, 0, len(ds.QueryTypes))
+				for _, qt := range ds.QueryTypes {
+					qts = append(qts, qt.String())
+				}
+				fmt.Printf("  %v\n    query-types: %v\n", ds.Name, strings.Join(qts, ", "))
+				tbs := make([]string, 0, len(ds.Tables))
+				for tb := range ds.Tables {
+					tbs = append(tbs, tb)
+				}
+				sort.Strings(tbs)
+				for _, tb := range tbs {
+					cols := make([]string, 0, len(ds.Tables[tb]))
+					for col, tp := range ds.Tables[tb] {
+						cols = append(cols, col+" "+tp)
+					}
+					sort.Strings(cols)
+					fmt.Printf("    table %v(%v)\n", tb, strings.Join(cols, ", "))
+				}
+			}
+			fmt.Println("\nQuery Types:")
+			for _, qt := range cetest.ListQueryTypes() {
+				fmt.Printf("  %-40v %v\n", qt.Name, qt.Example)
+			}
+			fmt.Println("\nMetrics:")
+			for _, m := range cetest.ListMetrics() {
+				fmt.Printf("  %-10v %v\n", m.Name, m.Desc)
+			}
+			return nil
+		},
+	}
+	return cmd
+}
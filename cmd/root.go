@@ -19,4 +19,12 @@ func init() {
 	cobra.OnInitialize()
 	rootCmd.AddCommand(newCETestCmd())
 	rootCmd.AddCommand(newDatagenCmd())
+	rootCmd.AddCommand(newListCmd())
+	rootCmd.AddCommand(newGenConfigCmd())
+	rootCmd.AddCommand(newBisectCmd())
+	rootCmd.AddCommand(newConvertResultsCmd())
+	rootCmd.AddCommand(newVerifyProvenanceCmd())
+	rootCmd.AddCommand(newDistributeCmd())
+	rootCmd.AddCommand(newMergeShardsCmd())
+	rootCmd.AddCommand(newShowExplainCmd())
 }
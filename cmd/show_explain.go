@@ -0,0 +1,27 @@
+package cmd
+
+import (
+	"fmt"
+
+	"github.com/qw4990/OptimizerTester/cetest"
+	"github.com/spf13/cobra"
+)
+
+func newShowExplainCmd() *cobra.Command {
+	var dir string
+	cmd := &cobra.Command{
+		Use:   "show-explain <explain-ref>",
+		Short: "Show the archived output of EXPLAIN referenced by explain_ref of raw results",
+		Args:  cobra.ExactArgs(1),
+		RunE: func(cmd *cobra.Command, args []string) error {
+			output, err := cetest.ReadArchivedExplain(dir, args[0])
+			if err != nil {
+				return err
+			}
+			fmt.Println(output)
+			return nil
+		},
+	}
+	cmd.Flags().StringVar(&dir, "dir", "./report/explains", "directory of the explain archive")
+	return cmd
+}
@@ -0,0 +1,25 @@
+package cmd
+
+import (
+	"fmt"
+
+	"github.com/qw4990/OptimizerTester/cetest"
+	"github.com/spf13/cobra"
+)
+
+func newVerifyProvenanceCmd() *cobra.Command {
+	cmd := &cobra.Command{
+		Use:   "verify-provenance <report-dir>",
+		Short: "Verify results of a report are unmodified by recomputing their hash chain from provenance.json and exported raw results",
+		Args:  cobra.ExactArgs(1),
+		RunE: func(cmd *cobra.Command, args []string) error {
+			p, err := cetest.VerifyProvenance(args[0])
+			if err != nil {
+				return err
+			}
+			fmt.Printf("%v results are verified, the head of the chain is %v\n", p.Results, p.Head)
+			return nil
+		},
+	}
+	return cmd
+}
@@ -13,6 +13,10 @@ const (
 	TypeDouble
 	TypeDateTime
 	TypeString
+	TypeDecimal
+	TypeBit
+	TypeEnum
+	TypeSet
 )
 
 func (dt DATAType) String() string {
@@ -25,6 +29,10 @@ var (
 		TypeDouble:   "double",
 		TypeDateTime: "datetime",
 		TypeString:   "string",
+		TypeDecimal:  "decimal",
+		TypeBit:      "bit",
+		TypeEnum:     "enum",
+		TypeSet:      "set",
 	}
 )
 
@@ -33,6 +41,14 @@ func Generate(dataset, args, dir string) error {
 	switch strings.ToLower(dataset) {
 	case "zipfx":
 		return GenZipfXData(args, dir)
+	case "wide":
+		return GenWideData(args, dir)
+	case "prefixstr":
+		return GenPrefixStrData(args, dir)
+	case "timeseries":
+		return GenTimeSeriesData(args, dir)
+	case "hierarchy":
+		return GenHierarchyData(args, dir)
 	}
 	return errors.Errorf("unsupported dataset=%v", dataset)
 }
@@ -0,0 +1,118 @@
+package datagen
+
+import (
+	"bytes"
+	"encoding/csv"
+	"fmt"
+	"io/ioutil"
+	"math/rand"
+	"os"
+	"path"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/pingcap/errors"
+)
+
+// The Hierarchy dataset simulates a tree like an organization chart or a category taxonomy.
+// Node 1 is the root whose parent_id is 0, and the parent of node i is chosen from nodes in (i-window, i),
+// so a small window produces a deep tree and a large window produces a wide one.
+
+type hierarchyOpt struct {
+	n      int64
+	window int64 // number of preceding nodes the parent of a node is chosen from, 0 for all of them
+	ndv    int64 // number of distinct values of val
+}
+
+func parseHierarchyOpt(args string) (opt hierarchyOpt, err error) {
+	opt = hierarchyOpt{n: 100000, window: 0, ndv: 1000}
+	for _, kv := range strings.Split(args, ",") {
+		if kv == "" {
+			continue
+		}
+		tmp := strings.Split(kv, "=")
+		if len(tmp) != 2 {
+			return opt, errors.Errorf("invalid kv=%v", kv)
+		}
+		k, v := tmp[0], tmp[1]
+		switch strings.ToLower(k) {
+		case "n":
+			if opt.n, err = strconv.ParseInt(v, 10, 64); err != nil || opt.n <= 0 {
+				return opt, errors.Errorf("invalid n=%v", v)
+			}
+		case "window":
+			if opt.window, err = strconv.ParseInt(v, 10, 64); err != nil || opt.window < 0 {
+				return opt, errors.Errorf("invalid window=%v", v)
+			}
+		case "ndv":
+			if opt.ndv, err = strconv.ParseInt(v, 10, 64); err != nil || opt.ndv <= 0 {
+				return opt, errors.Errorf("invalid ndv=%v", v)
+			}
+		}
+	}
+	return
+}
+
+func GenHierarchyData(args, dir string) error {
+	opt, err := parseHierarchyOpt(args)
+	if err != nil {
+		return err
+	}
+	if err := GenHierarchySchema(dir); err != nil {
+		return err
+	}
+
+	f, err := os.OpenFile(path.Join(dir, "hierarchy.csv"), os.O_CREATE|os.O_RDWR|os.O_TRUNC, 0666)
+	if err != nil {
+		return err
+	}
+	r := rand.New(rand.NewSource(time.Now().Unix()))
+	w := csv.NewWriter(f)
+	for id := int64(1); id <= opt.n; id++ {
+		var parent int64
+		if id > 1 {
+			lower := int64(1)
+			if opt.window > 0 && id-opt.window > lower {
+				lower = id - opt.window
+			}
+			parent = lower + r.Int63n(id-lower)
+		}
+		row := []string{strconv.FormatInt(id, 10), strconv.FormatInt(parent, 10), strconv.FormatInt(r.Int63n(opt.ndv), 10)}
+		if err := w.Write(row); err != nil {
+			f.Close()
+			return err
+		}
+	}
+	w.Flush()
+	if err := w.Error(); err != nil {
+		f.Close()
+		return err
+	}
+	if err := f.Close(); err != nil {
+		return err
+	}
+	return GenHierarchyLoadSQL(dir)
+}
+
+func GenHierarchySchema(dir string) error {
+	content := "CREATE TABLE thier ( id INT PRIMARY KEY, parent_id INT, val INT, KEY(parent_id) );\n"
+	schemaFile := path.Join(dir, "hierarchy_schema.sql")
+	return ioutil.WriteFile(schemaFile, []byte(content), 0666)
+}
+
+func GenHierarchyLoadSQL(dir string) error {
+	var buf bytes.Buffer
+	buf.WriteString("SET @@tidb_dml_batch_size=500000;\n")
+	if !path.IsAbs(dir) {
+		absPrefix, err := os.Getwd()
+		if err != nil {
+			return errors.Trace(err)
+		}
+		dir = path.Join(absPrefix, dir)
+	}
+	buf.WriteString(fmt.Sprintf("LOAD DATA LOCAL INFILE '%v' INTO TABLE thier FIELDS TERMINATED BY ',';\n", path.Join(dir, "hierarchy.csv")))
+	buf.WriteString("ANALYZE TABLE thier;\n")
+	loadFile := path.Join(dir, "hierarchy_load.sql")
+	return ioutil.WriteFile(loadFile, buf.Bytes(), 0666)
+}
@@ -0,0 +1,83 @@
+package datagen
+
+import (
+	"bytes"
+	"encoding/csv"
+	"fmt"
+	"io/ioutil"
+	"math/rand"
+	"os"
+	"path"
+	"time"
+
+	"github.com/pingcap/errors"
+)
+
+// The PrefixStr dataset contains long strings sharing long common prefixes, like URLs and file paths.
+// Values follow the Zipf distribution controlled by x, n and ndv, the same as the ZipfX dataset.
+
+func GenPrefixStrData(args, dir string) error {
+	opt, err := parseZipfXOpt(args)
+	if err != nil {
+		return err
+	}
+	if opt.ndv <= 0 || opt.n <= 0 || opt.x <= 1 {
+		return errors.Errorf("invalid arguments=%v, x > 1, n > 0 and ndv > 0 are required", args)
+	}
+	if err := GenPrefixStrSchema(dir); err != nil {
+		return err
+	}
+
+	csvFile := path.Join(dir, "prefixstr_tprefix.csv")
+	f, err := os.OpenFile(csvFile, os.O_CREATE|os.O_RDWR|os.O_TRUNC, 0666)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+	w := csv.NewWriter(f)
+
+	r := rand.New(rand.NewSource(time.Now().Unix()))
+	zipfx := rand.NewZipf(r, opt.x, 2, uint64(opt.ndv))
+	for i := 0; i < int(opt.n); i++ {
+		if err := w.Write([]string{prefixURL(zipfx.Uint64()), prefixPath(zipfx.Uint64())}); err != nil {
+			return err
+		}
+	}
+	w.Flush()
+	if err := w.Error(); err != nil {
+		return err
+	}
+	return GenPrefixStrLoadSQL(dir)
+}
+
+// prefixURL generates URLs like https://www.example.com/catalog/category-7/items/item-000123456?ref=home.
+func prefixURL(v uint64) string {
+	return fmt.Sprintf("https://www.example.com/catalog/category-%v/items/item-%09d?ref=home", v%16, v)
+}
+
+// prefixPath generates paths like /data/warehouse/events/region=3/year=2020/month=07/part-000123456.parquet.
+func prefixPath(v uint64) string {
+	return fmt.Sprintf("/data/warehouse/events/region=%v/year=%v/month=%02d/part-%09d.parquet", v%4, 2000+v%21, 1+v%12, v)
+}
+
+func GenPrefixStrSchema(dir string) error {
+	content := "CREATE TABLE tprefix ( url VARCHAR(512), path VARCHAR(512), KEY(url), KEY(url, path) );\n"
+	schemaFile := path.Join(dir, "prefixstr_schema.sql")
+	return ioutil.WriteFile(schemaFile, []byte(content), 0666)
+}
+
+func GenPrefixStrLoadSQL(dir string) error {
+	var buf bytes.Buffer
+	buf.WriteString("SET @@tidb_dml_batch_size=500000;\n")
+	if !path.IsAbs(dir) {
+		absPrefix, err := os.Getwd()
+		if err != nil {
+			return errors.Trace(err)
+		}
+		dir = path.Join(absPrefix, dir)
+	}
+	csvFile := path.Join(dir, "prefixstr_tprefix.csv")
+	buf.WriteString(fmt.Sprintf("LOAD DATA LOCAL INFILE '%v' INTO TABLE tprefix FIELDS TERMINATED BY ',';\n", csvFile))
+	loadFile := path.Join(dir, "prefixstr_load.sql")
+	return ioutil.WriteFile(loadFile, buf.Bytes(), 0666)
+}
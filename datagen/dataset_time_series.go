@@ -0,0 +1,125 @@
+package datagen
+
+import (
+	"bytes"
+	"encoding/csv"
+	"fmt"
+	"io/ioutil"
+	"math/rand"
+	"os"
+	"path"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/pingcap/errors"
+)
+
+// The TimeSeries dataset simulates an append-only table of device metrics with monotonic timestamps.
+// Rows are split into two files, the load script analyzes the table after loading the first one
+// and then appends the second one without analyzing, so the newest rows are out of the range of statistics.
+
+type timeSeriesOpt struct {
+	n        int64
+	devices  int64
+	stale    float64       // fraction of rows appended after analyzing
+	interval time.Duration // interval between two rows
+}
+
+func parseTimeSeriesOpt(args string) (opt timeSeriesOpt, err error) {
+	opt = timeSeriesOpt{n: 100000, devices: 100, stale: 0.2, interval: time.Second}
+	for _, kv := range strings.Split(args, ",") {
+		if kv == "" {
+			continue
+		}
+		tmp := strings.Split(kv, "=")
+		if len(tmp) != 2 {
+			return opt, errors.Errorf("invalid kv=%v", kv)
+		}
+		k, v := tmp[0], tmp[1]
+		switch strings.ToLower(k) {
+		case "n":
+			if opt.n, err = strconv.ParseInt(v, 10, 64); err != nil || opt.n <= 0 {
+				return opt, errors.Errorf("invalid n=%v", v)
+			}
+		case "devices":
+			if opt.devices, err = strconv.ParseInt(v, 10, 64); err != nil || opt.devices <= 0 {
+				return opt, errors.Errorf("invalid devices=%v", v)
+			}
+		case "stale":
+			if opt.stale, err = strconv.ParseFloat(v, 64); err != nil || opt.stale < 0 || opt.stale >= 1 {
+				return opt, errors.Errorf("invalid stale=%v", v)
+			}
+		case "interval":
+			if opt.interval, err = time.ParseDuration(v); err != nil || opt.interval < time.Second {
+				return opt, errors.Errorf("invalid interval=%v", v)
+			}
+		}
+	}
+	return
+}
+
+func GenTimeSeriesData(args, dir string) error {
+	opt, err := parseTimeSeriesOpt(args)
+	if err != nil {
+		return err
+	}
+	if err := GenTimeSeriesSchema(dir); err != nil {
+		return err
+	}
+
+	const layout = "2006-01-02 15:04:05"
+	ts, _ := time.Parse(layout, "2020-01-01 00:00:00")
+	r := rand.New(rand.NewSource(time.Now().Unix()))
+	nBase := int64(float64(opt.n) * (1 - opt.stale))
+	for _, part := range []struct {
+		file     string
+		from, to int64
+	}{{"timeseries_base.csv", 0, nBase}, {"timeseries_append.csv", nBase, opt.n}} {
+		f, err := os.OpenFile(path.Join(dir, part.file), os.O_CREATE|os.O_RDWR|os.O_TRUNC, 0666)
+		if err != nil {
+			return err
+		}
+		w := csv.NewWriter(f)
+		for i := part.from; i < part.to; i++ {
+			ts = ts.Add(opt.interval)
+			row := []string{ts.Format(layout), strconv.FormatInt(r.Int63n(opt.devices), 10), strconv.FormatFloat(r.Float64()*100, 'f', 2, 64)}
+			if err := w.Write(row); err != nil {
+				f.Close()
+				return err
+			}
+		}
+		w.Flush()
+		if err := w.Error(); err != nil {
+			f.Close()
+			return err
+		}
+		if err := f.Close(); err != nil {
+			return err
+		}
+	}
+	return GenTimeSeriesLoadSQL(dir)
+}
+
+func GenTimeSeriesSchema(dir string) error {
+	content := "CREATE TABLE tts ( ts DATETIME, device_id INT, val DOUBLE, KEY(ts), KEY(device_id, ts) );\n"
+	schemaFile := path.Join(dir, "timeseries_schema.sql")
+	return ioutil.WriteFile(schemaFile, []byte(content), 0666)
+}
+
+func GenTimeSeriesLoadSQL(dir string) error {
+	var buf bytes.Buffer
+	buf.WriteString("SET @@tidb_dml_batch_size=500000;\n")
+	if !path.IsAbs(dir) {
+		absPrefix, err := os.Getwd()
+		if err != nil {
+			return errors.Trace(err)
+		}
+		dir = path.Join(absPrefix, dir)
+	}
+	buf.WriteString(fmt.Sprintf("LOAD DATA LOCAL INFILE '%v' INTO TABLE tts FIELDS TERMINATED BY ',';\n", path.Join(dir, "timeseries_base.csv")))
+	buf.WriteString("ANALYZE TABLE tts;\n")
+	buf.WriteString(fmt.Sprintf("LOAD DATA LOCAL INFILE '%v' INTO TABLE tts FIELDS TERMINATED BY ',';\n", path.Join(dir, "timeseries_append.csv")))
+	loadFile := path.Join(dir, "timeseries_load.sql")
+	return ioutil.WriteFile(loadFile, buf.Bytes(), 0666)
+}
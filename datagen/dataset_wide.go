@@ -0,0 +1,119 @@
+package datagen
+
+import (
+	"bytes"
+	"encoding/csv"
+	"fmt"
+	"io/ioutil"
+	"math/rand"
+	"os"
+	"path"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/pingcap/errors"
+)
+
+// The Wide dataset is a single table with a large number of INT columns, and every 10th column is indexed.
+// It's used to measure the optimizer on tables with lots of statistics objects.
+
+type wideOpt struct {
+	n    int64
+	cols int
+	ndv  int64
+}
+
+func parseWideOpt(args string) (opt wideOpt, err error) {
+	opt = wideOpt{n: 10000, cols: 200, ndv: 1000}
+	kvs := strings.Split(args, ",")
+	for _, kv := range kvs {
+		if kv == "" {
+			continue
+		}
+		tmp := strings.Split(kv, "=")
+		if len(tmp) != 2 {
+			return opt, errors.Errorf("invalid kv=%v", kv)
+		}
+		k, v := tmp[0], tmp[1]
+		switch strings.ToLower(k) {
+		case "n":
+			if opt.n, err = strconv.ParseInt(v, 10, 64); err != nil {
+				return opt, errors.Errorf("invalid n=%v", v)
+			}
+		case "cols":
+			if opt.cols, err = strconv.Atoi(v); err != nil || opt.cols < 2 {
+				return opt, errors.Errorf("invalid cols=%v", v)
+			}
+		case "ndv":
+			if opt.ndv, err = strconv.ParseInt(v, 10, 64); err != nil || opt.ndv < 1 {
+				return opt, errors.Errorf("invalid ndv=%v", v)
+			}
+		}
+	}
+	return
+}
+
+func GenWideData(args, dir string) error {
+	opt, err := parseWideOpt(args)
+	if err != nil {
+		return err
+	}
+	if err := GenWideSchema(opt, dir); err != nil {
+		return err
+	}
+
+	csvFile := path.Join(dir, "wide_twide.csv")
+	f, err := os.OpenFile(csvFile, os.O_CREATE|os.O_RDWR|os.O_TRUNC, 0666)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+	w := csv.NewWriter(f)
+
+	r := rand.New(rand.NewSource(time.Now().Unix()))
+	cols := make([]string, opt.cols)
+	for i := 0; i < int(opt.n); i++ {
+		for c := range cols {
+			cols[c] = strconv.FormatInt(r.Int63n(opt.ndv), 10)
+		}
+		if err := w.Write(cols); err != nil {
+			return err
+		}
+	}
+	w.Flush()
+	if err := w.Error(); err != nil {
+		return err
+	}
+	return GenWideLoadSQL(dir)
+}
+
+func GenWideSchema(opt wideOpt, dir string) error {
+	defs := make([]string, 0, opt.cols+opt.cols/10+1)
+	for c := 0; c < opt.cols; c++ {
+		defs = append(defs, fmt.Sprintf("c%v INT", c))
+	}
+	defs = append(defs, "KEY idx_c0_c1(c0, c1)")
+	for c := 0; c < opt.cols; c += 10 {
+		defs = append(defs, fmt.Sprintf("KEY idx_c%v(c%v)", c, c))
+	}
+	content := fmt.Sprintf("CREATE TABLE twide ( %v );\n", strings.Join(defs, ", "))
+	schemaFile := path.Join(dir, "wide_schema.sql")
+	return ioutil.WriteFile(schemaFile, []byte(content), 0666)
+}
+
+func GenWideLoadSQL(dir string) error {
+	var buf bytes.Buffer
+	buf.WriteString("SET @@tidb_dml_batch_size=500000;\n")
+	if !path.IsAbs(dir) {
+		absPrefix, err := os.Getwd()
+		if err != nil {
+			return errors.Trace(err)
+		}
+		dir = path.Join(absPrefix, dir)
+	}
+	csvFile := path.Join(dir, "wide_twide.csv")
+	buf.WriteString(fmt.Sprintf("LOAD DATA LOCAL INFILE '%v' INTO TABLE twide FIELDS TERMINATED BY ',';\n", csvFile))
+	loadFile := path.Join(dir, "wide_load.sql")
+	return ioutil.WriteFile(loadFile, buf.Bytes(), 0666)
+}
@@ -19,9 +19,10 @@ import (
 // to get more details about ZipfX dataset.
 
 type zipfXOpt struct {
-	x   float64
-	n   int64
-	ndv int64
+	x        float64
+	n        int64
+	ndv      int64
+	nullFrac float64 // fraction of NULLs in column b
 }
 
 func parseZipfXOpt(args string) (opt zipfXOpt, err error) {
@@ -45,11 +46,35 @@ func parseZipfXOpt(args string) (opt zipfXOpt, err error) {
 			if opt.ndv, err = strconv.ParseInt(v, 10, 64); err != nil {
 				return opt, errors.Errorf("invalid ndv=%v", v)
 			}
+		case "nullfrac":
+			if opt.nullFrac, err = strconv.ParseFloat(v, 64); err != nil || opt.nullFrac < 0 || opt.nullFrac > 1 {
+				return opt, errors.Errorf("invalid nullfrac=%v", v)
+			}
 		}
 	}
 	return
 }
 
+var zipfXTables = []struct {
+	name string
+	tp   DATAType
+}{
+	{"tint", TypeInt},
+	{"tdouble", TypeDouble},
+	{"tstring", TypeString},
+	{"tdatetime", TypeDateTime},
+	{"tdecimal", TypeDecimal},
+	{"tbit", TypeBit},
+	{"tenum", TypeEnum},
+	{"tset", TypeSet},
+}
+
+const (
+	zipfXBitWidth = 16 // BIT(16)
+	zipfXEnumNDV  = 64 // ENUM('e0', ..., 'e63')
+	zipfXSetNDV   = 16 // SET('s0', ..., 's15')
+)
+
 func GenZipfXData(args, dir string) error {
 	opt, err := parseZipfXOpt(args)
 	if err != nil {
@@ -59,13 +84,12 @@ func GenZipfXData(args, dir string) error {
 		return err
 	}
 
-	tbNames := []string{"tint", "tdouble", "tstring", "tdatetime"}
 	ints1 := prepareIntNDV(int(opt.ndv+1))
 	ints2 := prepareIntNDV(int(opt.ndv+1))
 	doubles1 := prepareDoubleNDV(int(opt.ndv+1))
 	doubles2 := prepareDoubleNDV(int(opt.ndv+1))
-	for tbIdx, tp := range []DATAType{TypeInt, TypeDouble, TypeString, TypeDateTime} {
-		tb := tbNames[tbIdx]
+	for _, zt := range zipfXTables {
+		tb, tp := zt.name, zt.tp
 		csvFile := path.Join(dir, fmt.Sprintf("zipfx_%v.csv", tb))
 		f, err := os.OpenFile(csvFile, os.O_CREATE|os.O_RDWR|os.O_TRUNC, 0666)
 		if err != nil {
@@ -85,7 +109,7 @@ func GenZipfXData(args, dir string) error {
 			switch tp {
 			case TypeInt:
 				cols = append(cols, strconv.FormatUint(uint64(ints1[c1]), 10), strconv.FormatUint(uint64(ints2[c2]), 10))
-			case TypeDouble:
+			case TypeDouble, TypeDecimal:
 				cols = append(cols, strconv.FormatFloat(doubles1[c1], 'f', 4, 64),
 					strconv.FormatFloat(doubles2[c2], 'f', 4, 64))
 			case TypeDateTime:
@@ -100,6 +124,15 @@ func GenZipfXData(args, dir string) error {
 				cols = append(cols, t1.Format(layout), t2.Format(layout))
 			case TypeString:
 				cols = append(cols, uint2Str(c1+strFactor), uint2Str(c2+strFactor))
+			case TypeBit: // loaded as numbers, see GenZipfXLoadSQL
+				cols = append(cols, strconv.FormatUint(c1%(1<<zipfXBitWidth), 10), strconv.FormatUint(c2%(1<<zipfXBitWidth), 10))
+			case TypeEnum:
+				cols = append(cols, fmt.Sprintf("e%v", c1%zipfXEnumNDV), fmt.Sprintf("e%v", c2%zipfXEnumNDV))
+			case TypeSet: // bitmasks of members, loaded as numbers
+				cols = append(cols, strconv.FormatUint(c1%(1<<zipfXSetNDV), 10), strconv.FormatUint(c2%(1<<zipfXSetNDV), 10))
+			}
+			if opt.nullFrac > 0 && r.Float64() < opt.nullFrac {
+				cols[1] = `\N` // NULL in LOAD DATA
 			}
 			if err := w.Write(cols); err != nil {
 				return err
@@ -136,11 +169,23 @@ func uint2Str(v uint64) string {
 }
 
 func GenZipfXSchema(dir string) error {
+	enums := make([]string, zipfXEnumNDV)
+	for i := range enums {
+		enums[i] = fmt.Sprintf("'e%v'", i)
+	}
+	sets := make([]string, zipfXSetNDV)
+	for i := range sets {
+		sets[i] = fmt.Sprintf("'s%v'", i)
+	}
 	content := `CREATE TABLE tint ( a INT, b INT, KEY(a), KEY(a, b) );
 CREATE TABLE tdouble ( a DOUBLE, b DOUBLE, KEY(a), KEY(a, b) );
 CREATE TABLE tstring ( a VARCHAR(32), b VARCHAR(32), KEY(a), KEY(a, b) );
 CREATE TABLE tdatetime (a DATETIME, b DATETIME, KEY(a), KEY(a, b));
+CREATE TABLE tdecimal ( a DECIMAL(20, 4), b DECIMAL(20, 4), KEY(a), KEY(a, b) );
 `
+	content += fmt.Sprintf("CREATE TABLE tbit ( a BIT(%v), b BIT(%v), KEY(a), KEY(a, b) );\n", zipfXBitWidth, zipfXBitWidth)
+	content += fmt.Sprintf("CREATE TABLE tenum ( a ENUM(%v), b ENUM(%v), KEY(a), KEY(a, b) );\n", strings.Join(enums, ","), strings.Join(enums, ","))
+	content += fmt.Sprintf("CREATE TABLE tset ( a SET(%v), b SET(%v), KEY(a), KEY(a, b) );\n", strings.Join(sets, ","), strings.Join(sets, ","))
 	schemaFile := path.Join(dir, "zipfx_schema.sql")
 	return ioutil.WriteFile(schemaFile, []byte(content), 0666)
 }
@@ -149,7 +194,6 @@ CREATE TABLE tdatetime (a DATETIME, b DATETIME, KEY(a), KEY(a, b));
 func GenZipfXLoadSQL(dir string) error {
 	var buf bytes.Buffer
 	buf.WriteString("SET @@tidb_dml_batch_size=500000;\n")
-	tbNames := []string{"tint", "tdouble", "tstring", "tdatetime"}
 
 	if !path.IsAbs(dir) {
 		absPrefix, err := os.Getwd()
@@ -159,9 +203,13 @@ func GenZipfXLoadSQL(dir string) error {
 		dir = path.Join(absPrefix, dir)
 	}
 
-	for _, tb := range tbNames {
-		csvFile := path.Join(dir, fmt.Sprintf("zipfx_%v.csv", tb))
-		buf.WriteString(fmt.Sprintf("LOAD DATA LOCAL INFILE '%v' INTO TABLE %v FIELDS TERMINATED BY ',';\n", csvFile, tb))
+	for _, zt := range zipfXTables {
+		csvFile := path.Join(dir, fmt.Sprintf("zipfx_%v.csv", zt.name))
+		setClause := ""
+		if zt.tp == TypeBit || zt.tp == TypeSet { // numbers in CSV files are treated as strings without casting
+			setClause = " (@a, @b) SET a=CAST(@a AS UNSIGNED), b=CAST(@b AS UNSIGNED)"
+		}
+		buf.WriteString(fmt.Sprintf("LOAD DATA LOCAL INFILE '%v' INTO TABLE %v FIELDS TERMINATED BY ','%v;\n", csvFile, zt.name, setClause))
 	}
 
 	loadFile := path.Join(dir, "zipfx_load.sql")
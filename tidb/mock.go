@@ -0,0 +1,118 @@
+package tidb
+
+import (
+	"database/sql"
+	"database/sql/driver"
+	"fmt"
+	"io"
+	"sync"
+
+	"github.com/pingcap/errors"
+)
+
+// MockHandler returns column names and rows of this statement, rows of statements executed by Exec are ignored.
+type MockHandler func(query string) (columns []string, rows [][]string, err error)
+
+const mockDriverName = "optimizer-tester-mock"
+
+var (
+	mockHandlers    = make(map[string]MockHandler) // DSN, handler
+	mockHandlerLock sync.Mutex
+	mockRegister    sync.Once
+)
+
+// NewMockInstance returns an instance whose statements are all answered by this handler without any server,
+// which is used to test and benchmark the tester itself.
+func NewMockInstance(opt Option, ver string, handler MockHandler) (Instance, error) {
+	mockRegister.Do(func() { sql.Register(mockDriverName, mockDriver{}) })
+	mockHandlerLock.Lock()
+	dsn := fmt.Sprintf("mock-%v", len(mockHandlers))
+	mockHandlers[dsn] = handler
+	mockHandlerLock.Unlock()
+	db, err := sql.Open(mockDriverName, dsn)
+	if err != nil {
+		return nil, errors.Trace(err)
+	}
+	return &instance{db: db, opt: opt, ver: ver, build: BuildInfo{Release: ver}}, nil
+}
+
+type mockDriver struct{}
+
+func (mockDriver) Open(dsn string) (driver.Conn, error) {
+	mockHandlerLock.Lock()
+	defer mockHandlerLock.Unlock()
+	h, ok := mockHandlers[dsn]
+	if !ok {
+		return nil, errors.Errorf("unknown mock instance %v", dsn)
+	}
+	return mockConn{h}, nil
+}
+
+type mockConn struct {
+	handler MockHandler
+}
+
+func (c mockConn) Prepare(query string) (driver.Stmt, error) {
+	return mockStmt{c.handler, query}, nil
+}
+
+func (c mockConn) Close() error {
+	return nil
+}
+
+func (c mockConn) Begin() (driver.Tx, error) {
+	return nil, errors.New("transactions are not supported by mock instances")
+}
+
+type mockStmt struct {
+	handler MockHandler
+	query   string
+}
+
+func (s mockStmt) Close() error {
+	return nil
+}
+
+func (s mockStmt) NumInput() int {
+	return -1
+}
+
+func (s mockStmt) Exec(args []driver.Value) (driver.Result, error) {
+	if _, _, err := s.handler(s.query); err != nil {
+		return nil, err
+	}
+	return driver.RowsAffected(0), nil
+}
+
+func (s mockStmt) Query(args []driver.Value) (driver.Rows, error) {
+	cols, rows, err := s.handler(s.query)
+	if err != nil {
+		return nil, err
+	}
+	return &mockRows{cols: cols, rows: rows}, nil
+}
+
+type mockRows struct {
+	cols []string
+	rows [][]string
+	next int
+}
+
+func (r *mockRows) Columns() []string {
+	return r.cols
+}
+
+func (r *mockRows) Close() error {
+	return nil
+}
+
+func (r *mockRows) Next(dest []driver.Value) error {
+	if r.next >= len(r.rows) {
+		return io.EOF
+	}
+	for i := range dest {
+		dest[i] = r.rows[r.next][i]
+	}
+	r.next++
+	return nil
+}
@@ -0,0 +1,124 @@
+package tidb
+
+import (
+	"database/sql"
+	"fmt"
+	"hash/fnv"
+	"net"
+	"regexp"
+	"strconv"
+	"sync"
+
+	"github.com/pingcap/errors"
+)
+
+// replicaGroup is a logical instance over several identical clusters. Queries are sharded across them by their
+// statements, so a case always lands on the same replica, and statements executed by Exec are applied to all
+// replicas, so ANALYZE, DDL and global variables keep them identical.
+type replicaGroup struct {
+	opt      Option
+	replicas []Instance
+}
+
+// NewReplicaGroup groups these connected replicas running the same version as one logical instance of this option,
+// whose first replica is the primary one providing the version and build information.
+func NewReplicaGroup(opt Option, replicas []Instance) (Instance, error) {
+	if len(replicas) == 0 {
+		return nil, errors.Errorf("no replica of instance %v", opt.Label)
+	}
+	for i, r := range replicas[1:] {
+		if r.Version() != replicas[0].Version() {
+			return nil, errors.Errorf("replica %v of instance %v runs %v instead of %v", i+1, opt.Label, r.Version(), replicas[0].Version())
+		}
+	}
+	return &replicaGroup{opt: opt, replicas: replicas}, nil
+}
+
+// connectReplicas connects to the endpoint of this option and all its replicas, and groups them.
+func connectReplicas(opt Option) (ins Instance, err error) {
+	replicas := make([]Instance, 0, len(opt.Replicas)+1)
+	defer func() {
+		if err != nil {
+			for _, r := range replicas {
+				r.Close()
+			}
+		}
+	}()
+	endpoints := append([]string{opt.Endpoint()}, opt.Replicas...)
+	for i, ep := range endpoints {
+		o := opt
+		o.Replicas = nil
+		if i > 0 {
+			host, port, err := net.SplitHostPort(ep)
+			if err != nil {
+				return nil, errors.Errorf("invalid replica %v of instance %v, err=%v", ep, opt.Label, err)
+			}
+			if o.Port, err = strconv.Atoi(port); err != nil {
+				return nil, errors.Errorf("invalid replica %v of instance %v, err=%v", ep, opt.Label, err)
+			}
+			o.Addr, o.Server = host, "" // the server is of the primary endpoint
+		}
+		r, err := ConnectTo(o)
+		if err != nil {
+			return nil, errors.Errorf("connect to replica %v of instance %v, err=%v", ep, opt.Label, err)
+		}
+		replicas = append(replicas, r)
+	}
+	return NewReplicaGroup(opt, replicas)
+}
+
+// explainPrefixPattern matches prefixes of EXPLAIN statements, which are ignored when sharding queries, so a case
+// is explained and executed on the same replica.
+var explainPrefixPattern = regexp.MustCompile(`(?is)^\s*(?:EXPLAIN|DESC|DESCRIBE)(?:\s+ANALYZE)?(?:\s+FORMAT\s*=\s*(?:'[^']*'|"[^"]*"|\w+))?\s+`)
+
+// shard returns the replica which this query lands on.
+func (g *replicaGroup) shard(query string) Instance {
+	h := fnv.New32a()
+	h.Write([]byte(explainPrefixPattern.ReplaceAllString(query, "")))
+	return g.replicas[h.Sum32()%uint32(len(g.replicas))]
+}
+
+func (g *replicaGroup) Exec(sql string) error {
+	errs := make([]error, len(g.replicas))
+	var wg sync.WaitGroup
+	for i := range g.replicas {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			errs[i] = g.replicas[i].Exec(sql)
+		}(i)
+	}
+	wg.Wait()
+	for i, err := range errs {
+		if err != nil {
+			return fmt.Errorf("replica %v of instance %v, err=%v", i, g.opt.Label, err)
+		}
+	}
+	return nil
+}
+
+func (g *replicaGroup) Query(query string) (*sql.Rows, error) {
+	return g.shard(query).Query(query)
+}
+
+func (g *replicaGroup) Version() string {
+	return g.replicas[0].Version()
+}
+
+func (g *replicaGroup) Build() BuildInfo {
+	return g.replicas[0].Build()
+}
+
+func (g *replicaGroup) Opt() Option {
+	return g.opt
+}
+
+func (g *replicaGroup) Close() error {
+	var first error
+	for _, r := range g.replicas {
+		if err := r.Close(); err != nil && first == nil {
+			first = err
+		}
+	}
+	return first
+}
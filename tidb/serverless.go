@@ -0,0 +1,75 @@
+package tidb
+
+import (
+	"crypto/tls"
+	"crypto/x509"
+	"fmt"
+	"hash/fnv"
+	"io/ioutil"
+	"net"
+	"regexp"
+	"strings"
+
+	"github.com/go-sql-driver/mysql"
+	"github.com/pingcap/errors"
+)
+
+// serverlessUnsupported are statements rejected by TiDB Cloud Serverless, and what they are in errors.
+var serverlessUnsupported = []struct {
+	pattern *regexp.Regexp
+	what    string
+}{
+	{regexp.MustCompile(`(?i)^\s*SET\s+(GLOBAL\b|@@GLOBAL\.)`), "SET GLOBAL"},
+	{regexp.MustCompile(`(?i)\bINFORMATION_SCHEMA\s*\.\s*` + "`?" + `CLUSTER_`), "CLUSTER_ tables"},
+	{regexp.MustCompile(`(?i)^\s*PLAN\s+REPLAYER\b`), "PLAN REPLAYER"},
+	{regexp.MustCompile(`(?i)^\s*SHOW\s+CONFIG\b`), "SHOW CONFIG"},
+}
+
+// UnsupportedOnServerless returns what this SQL uses which is unsupported on TiDB Cloud Serverless, like "SET GLOBAL",
+// or "" if it's supported. Comments and literals are ignored.
+func UnsupportedOnServerless(sql string) string {
+	stripped := stripCommentsAndLiterals(sql)
+	for _, u := range serverlessUnsupported {
+		if u.pattern.MatchString(stripped) {
+			return u.what
+		}
+	}
+	return ""
+}
+
+// registerTLS returns the name of the TLS config of connections to this instance used in DSNs, a CA file is
+// registered as a custom config verifying the host of the instance. It's "" if connections are not encrypted.
+func registerTLS(opt Option) (string, error) {
+	mode := opt.TLS
+	if mode == "" && opt.Serverless {
+		mode = "true"
+	}
+	switch strings.ToLower(mode) {
+	case "", "false":
+		if opt.Serverless {
+			return "", errors.Errorf("instance %v is serverless, which requires TLS", opt.Label)
+		}
+		return "", nil
+	case "true", "skip-verify", "preferred":
+		return strings.ToLower(mode), nil
+	}
+	ca, err := ioutil.ReadFile(mode)
+	if err != nil {
+		return "", errors.Errorf("read the CA file %v of instance %v, err=%v", mode, opt.Label, err)
+	}
+	pool := x509.NewCertPool()
+	if !pool.AppendCertsFromPEM(ca) {
+		return "", errors.Errorf("no certificate in the CA file %v of instance %v", mode, opt.Label)
+	}
+	host, _, err := net.SplitHostPort(opt.Endpoint())
+	if err != nil {
+		return "", errors.Trace(err)
+	}
+	h := fnv.New64a()
+	h.Write([]byte(mode + "\x00" + host))
+	name := fmt.Sprintf("ca-%x", h.Sum64())
+	if err := mysql.RegisterTLSConfig(name, &tls.Config{RootCAs: pool, ServerName: host, MinVersion: tls.VersionTLS12}); err != nil {
+		return "", errors.Trace(err)
+	}
+	return name, nil
+}
@@ -0,0 +1,259 @@
+package tidb
+
+import (
+	"regexp"
+	"strings"
+
+	"github.com/pingcap/errors"
+)
+
+// scannedSQL is a SQL whose comments are replaced by spaces and quoted literals by '?', so its keywords can be found
+// without being fooled by literals and comments. Contents of executable comments like "/*!40000 xxx */" are kept,
+// since servers execute them.
+type scannedSQL struct {
+	code       string
+	offsets    []int // offsets in the original SQL of bytes of code
+	executable bool  // whether the SQL has executable comments
+}
+
+// executableCommentRegexp matches openings of executable comments of MySQL "/*!40000", MariaDB "/*M!" and TiDB
+// "/*T![feature]".
+var executableCommentRegexp = regexp.MustCompile(`^/\*(?:!\d*|M!\d*|T!(?:\[[^\]]*\])?)`)
+
+// plainIdentRegexp matches quoted identifiers which can be kept as words.
+var plainIdentRegexp = regexp.MustCompile(`^[\w$]+$`)
+
+// scanSQL scans this SQL, quoted identifiers are kept as words if they're plain, otherwise they're replaced like
+// literals. Unterminated literals and comments are errors, and the part scanned before them is returned.
+func scanSQL(sql string) (scannedSQL, error) {
+	var s scannedSQL
+	var code []byte
+	emit := func(c byte, at int) {
+		code = append(code, c)
+		s.offsets = append(s.offsets, at)
+	}
+	fail := func(format string, args ...interface{}) (scannedSQL, error) {
+		s.code = string(code)
+		return s, errors.Errorf(format, args...)
+	}
+	inExecutable := false
+	for i := 0; i < len(sql); i++ {
+		switch c := sql[i]; {
+		case c == '\'' || c == '"' || c == '`':
+			j := i + 1
+			for ; j < len(sql) && sql[j] != c; j++ {
+				if sql[j] == '\\' && c != '`' {
+					j++
+				}
+			}
+			if j >= len(sql) {
+				return fail("unterminated quote at %v of %v", i, sql)
+			}
+			if c == '`' && plainIdentRegexp.MatchString(sql[i+1:j]) {
+				for k := i + 1; k < j; k++ {
+					emit(sql[k], k)
+				}
+			} else {
+				emit(c, i)
+				emit('?', i+1)
+				emit(c, j)
+			}
+			i = j
+		case inExecutable && strings.HasPrefix(sql[i:], "*/"):
+			inExecutable = false
+			emit(' ', i)
+			i++
+		case strings.HasPrefix(sql[i:], "/*"):
+			if m := executableCommentRegexp.FindString(sql[i:]); m != "" && !inExecutable {
+				s.executable, inExecutable = true, true
+				emit(' ', i)
+				i += len(m) - 1
+				continue
+			}
+			end := strings.Index(sql[i+2:], "*/")
+			if end == -1 {
+				return fail("unterminated comment at %v of %v", i, sql)
+			}
+			emit(' ', i)
+			i += end + 3
+		case c == '#' || (strings.HasPrefix(sql[i:], "--") && (i+2 == len(sql) || sql[i+2] <= ' ')):
+			end := strings.IndexByte(sql[i:], '\n')
+			emit(' ', i)
+			if end == -1 {
+				i = len(sql)
+			} else {
+				i += end
+			}
+		default:
+			emit(c, i)
+		}
+	}
+	if inExecutable {
+		return fail("unterminated executable comment in %v", sql)
+	}
+	s.code = string(code)
+	return s, nil
+}
+
+// stripCommentsAndLiterals removes all comments in this SQL and replaces all quoted literals with '?'.
+func stripCommentsAndLiterals(sql string) string {
+	s, _ := scanSQL(sql)
+	return s.code
+}
+
+func isSQLWordByte(c byte) bool {
+	return c == '_' || c == '$' || c == '@' || c == '.' || c >= 0x80 ||
+		('a' <= c && c <= 'z') || ('A' <= c && c <= 'Z') || ('0' <= c && c <= '9')
+}
+
+// sqlTokens splits the code of a scanned SQL into upper-cased words like "@@SESSION.X" or "DB.T", literals like
+// "'?'" and single punctuation characters.
+func sqlTokens(code string) []string {
+	var tokens []string
+	for i := 0; i < len(code); {
+		c := code[i]
+		switch {
+		case c <= ' ':
+			i++
+		case isSQLWordByte(c):
+			j := i
+			for j < len(code) && isSQLWordByte(code[j]) {
+				j++
+			}
+			tokens = append(tokens, strings.ToUpper(code[i:j]))
+			i = j
+		case (c == '\'' || c == '"' || c == '`') && strings.HasPrefix(code[i+1:], "?"+string(c)):
+			tokens = append(tokens, code[i:i+3])
+			i += 3
+		default:
+			tokens = append(tokens, string(c))
+			i++
+		}
+	}
+	return tokens
+}
+
+// splitTopLevel splits these tokens by commas out of parentheses.
+func splitTopLevel(tokens []string) [][]string {
+	var parts [][]string
+	depth, begin := 0, 0
+	for i, t := range tokens {
+		switch {
+		case t == "(":
+			depth++
+		case t == ")":
+			depth--
+		case t == "," && depth == 0:
+			parts = append(parts, tokens[begin:i])
+			begin = i + 1
+		}
+	}
+	return append(parts, tokens[begin:])
+}
+
+// modifyingWords are words which make any statement modify data or state, like "WITH ... DELETE", "FOR UPDATE"
+// or sequence functions.
+var modifyingWords = map[string]bool{
+	"INSERT":  true,
+	"UPDATE":  true,
+	"DELETE":  true,
+	"REPLACE": true,
+	"NEXTVAL": true,
+	"SETVAL":  true,
+	"INTO":    true, // SELECT ... INTO OUTFILE
+}
+
+// unsafeSetWords are targets of SET which change global state, credentials, roles or the read-only mode of sessions.
+var unsafeSetWords = map[string]bool{
+	"GLOBAL":                true,
+	"PERSIST":               true,
+	"PERSIST_ONLY":          true,
+	"INSTANCE":              true,
+	"PASSWORD":              true,
+	"ROLE":                  true,
+	"DEFAULT":               true,
+	"CONFIG":                true,
+	"BINDING":               true,
+	"TRANSACTION":           true,
+	"TRANSACTION_READ_ONLY": true,
+	"TX_READ_ONLY":          true,
+}
+
+// IsReadOnlySQL checks whether this SQL can be executed without modifying any data, schema or global state by an
+// allowlist of single statements: SELECT, WITH, TABLE, VALUES, SHOW, USE, DESC and SET of session variables. EXPLAIN
+// prefixes are skipped since EXPLAIN ANALYZE actually executes the statement. Executable comments and multiple
+// statements are rejected.
+func IsReadOnlySQL(sql string) bool {
+	s, err := scanSQL(sql)
+	if err != nil || s.executable || strings.Contains(s.code, ";") {
+		return false
+	}
+	tokens := sqlTokens(s.code)
+	explained, analyzed := false, false
+prefixes:
+	for len(tokens) > 0 {
+		switch {
+		case tokens[0] == "EXPLAIN" || tokens[0] == "DESC" || tokens[0] == "DESCRIBE":
+			explained = true
+			tokens = tokens[1:]
+		case tokens[0] == "ANALYZE" && explained:
+			analyzed = true
+			tokens = tokens[1:]
+		case tokens[0] == "FORMAT" && explained:
+			tokens = tokens[1:]
+			if len(tokens) > 1 && tokens[0] == "=" { // FORMAT = 'xxx'
+				tokens = tokens[2:]
+			}
+		default:
+			break prefixes
+		}
+	}
+	if len(tokens) == 0 {
+		return false
+	}
+	for _, t := range tokens {
+		if modifyingWords[t] {
+			return false
+		}
+	}
+	switch tokens[0] {
+	case "SELECT", "WITH", "TABLE", "VALUES", "SHOW", "USE":
+		return true
+	case "SET":
+		return !explained && isSessionSet(tokens[1:])
+	}
+	// DESC t [column] describes a table
+	return explained && !analyzed && len(tokens) <= 2
+}
+
+// isSessionSet checks every assignment of a SET statement only sets session or user variables, names or charsets.
+func isSessionSet(tokens []string) bool {
+	for _, a := range splitTopLevel(tokens) {
+		if len(a) == 0 {
+			return false
+		}
+		name := a[0]
+		switch name {
+		case "NAMES", "CHARACTER", "CHARSET":
+			continue
+		case "SESSION", "LOCAL":
+			if len(a) < 2 {
+				return false
+			}
+			a = a[1:]
+			name = a[0]
+		}
+		if strings.HasPrefix(name, "@@") {
+			name = strings.TrimPrefix(strings.TrimPrefix(name[2:], "SESSION."), "LOCAL.")
+			if strings.Contains(name, ".") { // @@GLOBAL.x, @@PERSIST.x and so on
+				return false
+			}
+		} else if strings.HasPrefix(name, "@") {
+			continue // user variables
+		}
+		if unsafeSetWords[name] || len(a) < 2 || (a[1] != "=" && a[1] != ":") {
+			return false
+		}
+	}
+	return true
+}
@@ -1,8 +1,14 @@
 package tidb
 
 import (
+	"context"
 	"database/sql"
 	"fmt"
+	"net"
+	"net/url"
+	"regexp"
+	"sort"
+	"strconv"
 	"strings"
 	"time"
 
@@ -16,25 +22,112 @@ type Option struct {
 	User     string `toml:"user"`
 	Password string `toml:"password"`
 	Label    string `toml:"label"`
+	ReadOnly bool   `toml:"read-only"` // reject all statements which may modify data and set sessions to read-only
+
+	ExplainFormat string `toml:"explain-format"` // format of EXPLAIN statements, like "row", "brief" or "verbose", the default format is used if empty
+
+	ResourceGroup string `toml:"resource-group"` // resource group of all queries by the hint RESOURCE_GROUP, to isolate them from other tenants
+	LowPriority   bool   `toml:"low-priority"`   // run all statements with low priority by tidb_force_priority
+
+	MPP bool `toml:"mpp"` // read TiFlash replicas by MPP only, so joins are planned as broadcast or shuffle joins
+
+	Metadata map[string]string `toml:"metadata"` // freeform descriptions shown in reports, like git-sha, build-date or cluster-size
+
+	// Snapshot makes all sessions read data at this snapshot by tidb_snapshot, like a TSO "446312097402388481" or a
+	// time "2024-01-01 10:00:00", so results don't change with concurrent writes, but nothing can be written then.
+	Snapshot string `toml:"snapshot"`
+
+	Version string `toml:"version"` // override the detected version like "v6.5.0", useful for forks with their own version schemes
+
+	// StickyCheck is the number of connections probed when connecting to check whether all of them land on the same
+	// TiDB server, which may not hold behind load balancers, and servers with different statistics corrupt results.
+	StickyCheck int    `toml:"sticky-check"`
+	Server      string `toml:"server"` // the TiDB server like "tidb-0:4000" which all probed connections must land on
+
+	// Replicas are endpoints like "10.0.0.2:4000" of clusters identical to this one, which are grouped with it as one
+	// logical instance. Cases are sharded across all of them and results are merged, and statements modifying data,
+	// statistics or variables are applied to all of them. Other connection settings are shared.
+	Replicas []string `toml:"replicas"`
+
+	// TLS encrypts connections, "true" verifies servers by system CAs, "skip-verify" doesn't verify them, "preferred"
+	// only uses TLS if servers support it, or it's the path of a CA file like "/etc/ssl/ca.pem". It's "true" on
+	// serverless instances if empty, which reject plaintext connections.
+	TLS string `toml:"tls"`
+
+	// Params are extra parameters of all connections, like session variables or tokens required by cloud endpoints.
+	// Parameters weakening the read-only mode or TLS are rejected, see CheckParams.
+	Params map[string]string `toml:"params"`
+
+	// Serverless marks TiDB Cloud Serverless endpoints like "gateway01.us-west-2.prod.aws.tidbcloud.com:4000", whose
+	// users are prefixed like "2xxxx.root". Connections are encrypted, and statements unsupported there, see
+	// UnsupportedOnServerless, are rejected with clear errors before they're sent.
+	Serverless bool `toml:"serverless"`
+
+	// QueryPrefix and QuerySuffix are comments added before and after all statements, like
+	// "/* optimizertester run=xxx */", so load of the tester can be attributed in slow logs, processlists and
+	// QUERY_SAMPLE_TEXT of STATEMENTS_SUMMARY. Only plain comments are allowed, see CheckQueryComment.
+	QueryPrefix string   `toml:"query-prefix"`
+	QuerySuffix string   `toml:"query-suffix"`
+	QueryHints  []string `toml:"query-hints"` // optimizer hints added into all statements, see AddHints
+}
+
+// defaultPort is the port of instances whose ports are not set.
+const defaultPort = 4000
+
+// Endpoint returns the address of this instance like "127.0.0.1:4000". Addr may contain the port like the host
+// format of cloud endpoints, which overrides Port.
+func (opt Option) Endpoint() string {
+	if _, _, err := net.SplitHostPort(opt.Addr); err == nil {
+		return opt.Addr
+	}
+	port := opt.Port
+	if port == 0 {
+		port = defaultPort
+	}
+	return net.JoinHostPort(opt.Addr, strconv.Itoa(port))
+}
+
+// MetadataText returns all metadata of this instance ordered by keys, like "cluster-size=3, git-sha=abc".
+func (opt Option) MetadataText() string {
+	kvs := make([]string, 0, len(opt.Metadata))
+	for k, v := range opt.Metadata {
+		kvs = append(kvs, k+"="+v)
+	}
+	sort.Strings(kvs)
+	return strings.Join(kvs, ", ")
+}
+
+// Legend returns the label with all metadata of this instance, like "ver1 (cluster-size=3, git-sha=abc)".
+func (opt Option) Legend() string {
+	if len(opt.Metadata) == 0 {
+		return opt.Label
+	}
+	return fmt.Sprintf("%v (%v)", opt.Label, opt.MetadataText())
 }
 
 type Instance interface {
 	Exec(sql string) error
 	Query(query string) (*sql.Rows, error)
 	Version() string
+	Build() BuildInfo
 	Opt() Option
 	Close() error
 }
 
 type instance struct {
-	db  *sql.DB
-	opt Option
-	ver string
+	db    *sql.DB
+	opt   Option
+	ver   string
+	build BuildInfo
 }
 
 func (ins *instance) Exec(sql string) error {
+	sql, err := ins.prepare(sql)
+	if err != nil {
+		return err
+	}
 	begin := time.Now()
-	_, err := ins.db.Exec(sql)
+	_, err = ins.db.Exec(sql)
 	if time.Since(begin) > time.Second*3 {
 		fmt.Printf("[SLOW-QUERY] access %v with SQL %v cost %v\n", ins.opt.Label, sql, time.Since(begin))
 	}
@@ -42,6 +135,10 @@ func (ins *instance) Exec(sql string) error {
 }
 
 func (ins *instance) Query(query string) (*sql.Rows, error) {
+	query, err := ins.prepare(query)
+	if err != nil {
+		return nil, err
+	}
 	begin := time.Now()
 	rows, err := ins.db.Query(query)
 	if time.Since(begin) > time.Second*3 {
@@ -50,10 +147,64 @@ func (ins *instance) Query(query string) (*sql.Rows, error) {
 	return rows, errors.Trace(err)
 }
 
+// checkSQL rejects this SQL if it may modify data of a read-only instance or it's unsupported on a serverless one.
+func (ins *instance) checkSQL(sql string) error {
+	if ins.opt.ReadOnly && !IsReadOnlySQL(sql) {
+		return errors.Errorf("instance %v is read-only, reject sql=%v", ins.opt.Label, sql)
+	}
+	if ins.opt.Serverless {
+		if what := UnsupportedOnServerless(sql); what != "" {
+			return errors.Errorf("instance %v is serverless, which doesn't support %v, reject sql=%v", ins.opt.Label, what, sql)
+		}
+	}
+	return nil
+}
+
+// prepare checks this SQL, adds hints and comments of this instance into it, and checks the final text again, so
+// neither of them can make a rejected statement run.
+func (ins *instance) prepare(sql string) (string, error) {
+	if err := ins.checkSQL(sql); err != nil {
+		return "", err
+	}
+	final := ins.comment(ins.isolate(sql))
+	if err := ins.checkSQL(final); err != nil {
+		return "", err
+	}
+	return final, nil
+}
+
+// Hints returns the resource group hint and other hints added into all statements of this instance.
+func (opt Option) Hints() []string {
+	if opt.ResourceGroup == "" {
+		return opt.QueryHints
+	}
+	return append([]string{fmt.Sprintf("RESOURCE_GROUP(%v)", opt.ResourceGroup)}, opt.QueryHints...)
+}
+
+// isolate adds the resource group and hints of this instance into this SQL.
+func (ins *instance) isolate(sql string) string {
+	return AddHints(sql, ins.opt.Hints()...)
+}
+
+// comment adds the prefix and suffix comments of this instance around this SQL.
+func (ins *instance) comment(sql string) string {
+	if ins.opt.QueryPrefix != "" {
+		sql = ins.opt.QueryPrefix + " " + sql
+	}
+	if ins.opt.QuerySuffix != "" {
+		sql = sql + " " + ins.opt.QuerySuffix
+	}
+	return sql
+}
+
 func (ins *instance) Version() string {
 	return ins.ver
 }
 
+func (ins *instance) Build() BuildInfo {
+	return ins.build
+}
+
 func (ins *instance) Opt() Option {
 	return ins.opt
 }
@@ -62,20 +213,43 @@ func (ins *instance) Close() error {
 	return ins.db.Close()
 }
 
+// initVersion detects the version of this instance by tidb_version(), and falls back to VERSION() like "5.7.25-TiDB-v4.0.0"
+// on old versions without it. The detected version is normalized to "vX.Y.Z" unless it's overridden by Option.Version.
 func (ins *instance) initVersion() error {
-	rows, err := ins.Query(`SELECT VERSION()`)
+	var out string
+	if err := ins.queryOne(`SELECT tidb_version()`, &out); err == nil {
+		ins.build = ParseBuildInfo(out)
+	} else {
+		if err := ins.queryOne(`SELECT VERSION()`, &out); err != nil {
+			return err
+		}
+		if i := strings.Index(out, "-TiDB-"); i != -1 {
+			ins.build.Release = out[i+len("-TiDB-"):]
+		}
+	}
+	if ins.opt.Version != "" {
+		ins.ver = ins.opt.Version
+		return nil
+	}
+	if ins.ver = NormalizeVersion(ins.build.Release); ins.ver == "" {
+		return errors.Errorf("unknown version of instance %v: %v, set its version explicitly", ins.opt.Label, out)
+	}
+	return nil
+}
+
+func (ins *instance) queryOne(query string, dest interface{}) error {
+	rows, err := ins.Query(query)
 	if err != nil {
 		return err
 	}
 	defer rows.Close()
-	var version string
-	rows.Next()
-	if err := rows.Scan(&version); err != nil {
-		return err
+	if !rows.Next() {
+		if err := rows.Err(); err != nil {
+			return errors.Trace(err)
+		}
+		return errors.Errorf("no result of %v", query)
 	}
-	tmp := strings.Split(version, "-")
-	ins.ver = tmp[2]
-	return nil
+	return errors.Trace(rows.Scan(dest))
 }
 
 func ConnectToInstances(opts []Option) (xs []Instance, err error) {
@@ -99,18 +273,178 @@ func ConnectToInstances(opts []Option) (xs []Instance, err error) {
 }
 
 func ConnectTo(opt Option) (Instance, error) {
-	dns := fmt.Sprintf("%s:%s@tcp(%s:%v)/%v", opt.User, opt.Password, opt.Addr, opt.Port, "mysql")
+	for _, c := range []string{opt.QueryPrefix, opt.QuerySuffix} {
+		if err := CheckQueryComment(c); err != nil {
+			return nil, errors.Errorf("invalid query comment of instance %v, err=%v", opt.Label, err)
+		}
+	}
+	for _, h := range opt.Hints() {
+		if err := CheckQueryHint(h); err != nil {
+			return nil, errors.Errorf("invalid query hint of instance %v, err=%v", opt.Label, err)
+		}
+	}
+	if err := CheckParams(opt); err != nil {
+		return nil, err
+	}
+	if len(opt.Replicas) > 0 {
+		return connectReplicas(opt)
+	}
+	params := make(map[string]string)
+	if opt.ReadOnly {
+		// session variables in DSN are set on every new connection, but unknown variables make connecting fail,
+		// so probe which one is supported by this instance first.
+		for _, v := range []string{"transaction_read_only", "tx_read_only"} {
+			if err := probeSessionVar(opt, v, "1"); err == nil {
+				params[v] = "1"
+				break
+			}
+		}
+		if len(params) == 0 {
+			fmt.Printf("[READ-ONLY] instance %v doesn't support read-only sessions, only static checks are applied\n", opt.Label)
+		}
+	}
+	if opt.LowPriority {
+		if err := probeSessionVar(opt, "tidb_force_priority", "'LOW_PRIORITY'"); err == nil {
+			params["tidb_force_priority"] = "'LOW_PRIORITY'"
+		} else {
+			fmt.Printf("[LOW-PRIORITY] instance %v doesn't support session-level tidb_force_priority, use resource-group instead\n", opt.Label)
+		}
+	}
+	if opt.MPP {
+		for _, kv := range [][2]string{{"tidb_isolation_read_engines", "'tiflash,tidb'"}, {"tidb_enforce_mpp", "1"}} {
+			if err := probeSessionVar(opt, kv[0], kv[1]); err != nil {
+				return nil, errors.Errorf("instance %v doesn't support MPP, err=%v", opt.Label, err)
+			}
+			params[kv[0]] = kv[1]
+		}
+	}
+	if opt.Snapshot != "" {
+		v := "'" + opt.Snapshot + "'"
+		if err := probeSessionVar(opt, "tidb_snapshot", v); err != nil {
+			return nil, errors.Errorf("instance %v can't read data at snapshot %v, err=%v", opt.Label, opt.Snapshot, err)
+		}
+		params["tidb_snapshot"] = v
+	}
+	db, err := open(opt, params)
+	if err != nil {
+		return nil, err
+	}
+	ins := &instance{db: db, opt: opt}
+	db.SetMaxOpenConns(256)
+	// keep connections of all workers, otherwise most of them are closed and opened again between cases, which costs
+	// several round-trips and TLS handshakes each time on remote clusters
+	db.SetMaxIdleConns(256)
+	if err := ins.checkSticky(); err != nil {
+		db.Close()
+		return nil, err
+	}
+	return ins, ins.initVersion()
+}
+
+// checkSticky opens StickyCheck connections at the same time and checks whether all of them land on the same server.
+func (ins *instance) checkSticky() error {
+	if ins.opt.StickyCheck <= 0 && ins.opt.Server == "" {
+		return nil
+	}
+	n := ins.opt.StickyCheck
+	if n <= 0 {
+		n = 1
+	}
+	ctx := context.Background()
+	servers := make(map[string]int)
+	for i := 0; i < n; i++ {
+		conn, err := ins.db.Conn(ctx) // hold all connections until the end, so new ones are opened
+		if err != nil {
+			return errors.Trace(err)
+		}
+		defer conn.Close()
+		var host, port string
+		if err := conn.QueryRowContext(ctx, "SELECT @@hostname, @@port").Scan(&host, &port); err != nil {
+			return errors.Trace(err)
+		}
+		servers[host+":"+port]++
+	}
+	if len(servers) > 1 {
+		return errors.Errorf("connections of instance %v land on different servers %v, connect to a server directly or make the proxy sticky", ins.opt.Label, servers)
+	}
+	if ins.opt.Server != "" && servers[ins.opt.Server] == 0 {
+		return errors.Errorf("connections of instance %v land on %v instead of server %v", ins.opt.Label, servers, ins.opt.Server)
+	}
+	return nil
+}
+
+func probeSessionVar(opt Option, name, val string) error {
+	db, err := open(opt, nil)
+	if err != nil {
+		return err
+	}
+	defer db.Close()
+	_, err = db.Exec(fmt.Sprintf("SET SESSION %v = %v", name, val))
+	return errors.Trace(err)
+}
+
+// open opens connections to this instance with these session variables, and extra parameters and TLS of the option.
+// unsafeParams are parameters of connections never allowed in Option.Params: TLS is set by Option.TLS, multiple
+// statements defeat checks of single statements, and local files shouldn't be read by servers.
+var unsafeParams = map[string]bool{
+	"tls":              true,
+	"multistatements":  true,
+	"allowallfiles":    true,
+	"allowlocalinfile": true,
+}
+
+// paramKeyRegexp matches keys of parameters, which are options of the driver or session variables set by
+// "SET <key>=<value>" on new connections.
+var paramKeyRegexp = regexp.MustCompile(`^[A-Za-z_][A-Za-z0-9_]*$`)
+
+// CheckParams rejects unsafe parameters of connections of this instance, and parameters setting session variables
+// which aren't allowed in the read-only mode, like transaction_read_only=0.
+func CheckParams(opt Option) error {
+	for k, v := range opt.Params {
+		if !paramKeyRegexp.MatchString(k) || unsafeParams[strings.ToLower(k)] {
+			return errors.Errorf("parameter %v of instance %v is not allowed", k, opt.Label)
+		}
+		if opt.ReadOnly && !IsReadOnlySQL(fmt.Sprintf("SET %v=%v", k, v)) {
+			return errors.Errorf("parameter %v=%v of instance %v is not allowed in read-only mode", k, v, opt.Label)
+		}
+	}
+	return nil
+}
+
+func open(opt Option, vars map[string]string) (*sql.DB, error) {
+	dns := fmt.Sprintf("%s:%s@tcp(%s)/%v", opt.User, opt.Password, opt.Endpoint(), "mysql")
 	if opt.Password == "" {
-		dns = fmt.Sprintf("%s@tcp(%s:%v)/%v", opt.User, opt.Addr, opt.Port, "mysql")
+		dns = fmt.Sprintf("%s@tcp(%s)/%v", opt.User, opt.Endpoint(), "mysql")
+	}
+	params := make(map[string]string, len(opt.Params)+len(vars)+1)
+	for k, v := range opt.Params {
+		params[k] = v
+	}
+	for k, v := range vars {
+		params[k] = v
+	}
+	tlsName, err := registerTLS(opt)
+	if err != nil {
+		return nil, err
+	}
+	if tlsName != "" {
+		params["tls"] = tlsName
+	}
+	if len(params) > 0 {
+		kvs := make([]string, 0, len(params))
+		for k, v := range params {
+			kvs = append(kvs, k+"="+url.QueryEscape(v))
+		}
+		sort.Strings(kvs)
+		dns += "?" + strings.Join(kvs, "&")
 	}
 	db, err := sql.Open("mysql", dns)
 	if err != nil {
 		return nil, errors.Trace(err)
 	}
 	if err := db.Ping(); err != nil {
+		db.Close()
 		return nil, errors.Trace(err)
 	}
-	ins := &instance{db: db, opt: opt}
-	db.SetMaxOpenConns(256)
-	return ins, ins.initVersion()
+	return db, nil
 }
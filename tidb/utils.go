@@ -1,6 +1,8 @@
 package tidb
 
 import (
+	"fmt"
+	"regexp"
 	"strconv"
 	"strings"
 )
@@ -15,3 +17,143 @@ func ToComparableVersion(ver string) int {
 	z, _ := strconv.Atoi(xs[2])
 	return x*10000 + y*100 + z
 }
+
+// AddHints adds these optimizer hints into the main SELECT of this SQL, which may have EXPLAIN prefixes, see
+// mainSelectEnd. The SQL is returned as it is if it can't be scanned. Hints are merged into the existing hint comment
+// of the SELECT if there is one, since only one is allowed.
+func AddHints(sql string, hints ...string) string {
+	if len(hints) == 0 {
+		return sql
+	}
+	s, err := scanSQL(sql)
+	if err != nil {
+		return sql
+	}
+	end := mainSelectEnd(sql, s)
+	if end == -1 {
+		return sql
+	}
+	h := strings.Join(hints, " ")
+	rest := strings.TrimLeft(sql[end:], " \t\r\n")
+	if strings.HasPrefix(rest, "/*+") { // SELECT /*+ xxx */ => SELECT /*+ hints xxx */
+		at := len(sql) - len(rest) + len("/*+")
+		return sql[:at] + " " + h + sql[at:]
+	}
+	return sql[:end] + " /*+ " + h + " */" + sql[end:]
+}
+
+// mainSelectEnd returns the offset in this SQL right after the keyword of its main SELECT, which is the first SELECT
+// out of parentheses, like the one after CTEs of "WITH c AS (SELECT ...) SELECT ...", or the first one in the fewest
+// parentheses if all SELECTs are in parentheses. SELECTs in literals, comments and quoted identifiers are skipped.
+// It returns -1 if there is no SELECT.
+func mainSelectEnd(sql string, s scannedSQL) int {
+	const kw = "SELECT"
+	end, endDepth, depth := -1, 0, 0
+	for i := 0; i < len(s.code); i++ {
+		switch c := s.code[i]; {
+		case c == '(':
+			depth++
+		case c == ')':
+			depth--
+		case i+len(kw) <= len(s.code) && strings.EqualFold(s.code[i:i+len(kw)], kw) &&
+			(i == 0 || !isSQLWordByte(s.code[i-1])) && (i+len(kw) == len(s.code) || !isSQLWordByte(s.code[i+len(kw)])):
+			if s.offsets[i] > 0 && sql[s.offsets[i]-1] == '`' { // `select` kept as a word by the scan
+				i += len(kw) - 1
+				continue
+			}
+			if end == -1 || depth < endDepth {
+				end, endDepth = s.offsets[i+len(kw)-1]+1, depth
+			}
+			if depth <= 0 {
+				return end
+			}
+			i += len(kw) - 1
+		}
+	}
+	return end
+}
+
+// queryHintRegexp matches optimizer hints like "MAX_EXECUTION_TIME(1000)".
+var queryHintRegexp = regexp.MustCompile(`^[A-Za-z_][A-Za-z0-9_]*\s*\(.*\)$`)
+
+// CheckQueryHint checks this hint can be added into hint comments by AddHints, so it never closes the comment or
+// starts another statement.
+func CheckQueryHint(hint string) error {
+	if strings.Contains(hint, "*/") || strings.Contains(hint, "/*") || strings.Contains(hint, ";") {
+		return fmt.Errorf("%q has comment delimiters or semicolons, which are not allowed in hints", hint)
+	}
+	if !queryHintRegexp.MatchString(strings.TrimSpace(hint)) {
+		return fmt.Errorf("%q is not a hint like NAME(args)", hint)
+	}
+	return nil
+}
+
+// CheckQueryComment checks this text consists of plain comments like "/* run=1 */", which never change what a
+// statement does. Executable comments "/*! */" and hints "/*+ */" are rejected, and "--" or "#" comments are rejected
+// since they'd comment out the rest of a statement. Semicolons are rejected even in comments.
+func CheckQueryComment(text string) error {
+	if strings.Contains(text, ";") {
+		return fmt.Errorf("%q has semicolons, which are not allowed", text)
+	}
+	for rest := strings.TrimSpace(text); rest != ""; rest = strings.TrimSpace(rest) {
+		if !strings.HasPrefix(rest, "/*") {
+			return fmt.Errorf("%q is not a comment like /* xxx */", text)
+		}
+		if strings.HasPrefix(rest, "/*!") || strings.HasPrefix(rest, "/*+") {
+			return fmt.Errorf("%q is an executable comment or a hint, which is not allowed", text)
+		}
+		end := strings.Index(rest[2:], "*/")
+		if end == -1 {
+			return fmt.Errorf("%q has an unclosed comment", text)
+		}
+		rest = rest[2+end+2:]
+	}
+	return nil
+}
+
+// BuildInfo is the build information of a TiDB instance reported by tidb_version().
+type BuildInfo struct {
+	Release string // release version like "v7.5.0" or "v7.6.0-alpha-123-gabcdef"
+	Commit  string // git commit hash
+	Branch  string // git branch like "heads/refs/tags/v7.5.0" or "release-7.5"
+}
+
+// ParseBuildInfo parses the output of tidb_version(), like:
+//	Release Version: v7.5.0
+//	Edition: Community
+//	Git Commit Hash: 069631e2ecfedc000ffd92c67207bea81380f020
+//	Git Branch: heads/refs/tags/v7.5.0
+func ParseBuildInfo(out string) BuildInfo {
+	var b BuildInfo
+	for _, line := range strings.Split(out, "\n") {
+		kv := strings.SplitN(line, ":", 2)
+		if len(kv) != 2 {
+			continue
+		}
+		v := strings.TrimSpace(kv[1])
+		switch strings.ToLower(strings.TrimSpace(kv[0])) {
+		case "release version":
+			b.Release = v
+		case "git commit hash":
+			b.Commit = v
+		case "git branch":
+			b.Branch = v
+		}
+	}
+	return b
+}
+
+var versionRegexp = regexp.MustCompile(`^v?(\d+)\.(\d+)(?:\.(\d+))?`)
+
+// NormalizeVersion normalizes this release version to "vX.Y.Z" which can be compared by ToComparableVersion,
+// like "v7.6.0-alpha-123-gabcdef" => "v7.6.0" and "6.5" => "v6.5.0". It returns "" if it's not a version.
+func NormalizeVersion(release string) string {
+	m := versionRegexp.FindStringSubmatch(strings.TrimSpace(release))
+	if m == nil {
+		return ""
+	}
+	if m[3] == "" {
+		m[3] = "0"
+	}
+	return fmt.Sprintf("v%v.%v.%v", m[1], m[2], m[3])
+}
@@ -0,0 +1,162 @@
+package tidb_test
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/qw4990/OptimizerTester/tidb"
+)
+
+func TestIsReadOnlySQL(t *testing.T) {
+	for sql, readOnly := range map[string]bool{
+		"SELECT * FROM t WHERE a=1":                       true,
+		"EXPLAIN ANALYZE SELECT * FROM t WHERE a='x;'":    true,
+		"EXPLAIN FORMAT='brief' SELECT * FROM t":          true,
+		"SELECT * FROM t WHERE b='delete into'":           true,
+		"/* DELETE */ SHOW STATS_META":                    true,
+		"/*+ hint */ SELECT 1":                            true,
+		"WITH c AS (SELECT 1) SELECT * FROM c":            true,
+		"DESC t":                                          true,
+		"SET @@session.tidb_snapshot='2024-01-01'":        true,
+		"SET tidb_opt_agg_push_down=1, @x=2":              true,
+		"SET SESSION tidb_executor_concurrency = 2":       true,
+		"SET NAMES utf8mb4":                               true,
+		"SELECT `a;b` FROM t -- DELETE":                   true,
+		"EXPLAIN ANALYZE DELETE FROM t":                   false,
+		"ANALYZE TABLE t":                                 false,
+		"INSERT INTO t VALUES (1)":                        false,
+		"  drop table t":                                  false,
+		"SET GLOBAL tidb_enable_fast_analyze=1":           false,
+		"SELECT * FROM t INTO OUTFILE '/tmp/x'":           false,
+		"SELECT * FROM t WHERE a=1 FOR UPDATE":            false,
+		"/*+ SET_VAR(x=1) */ UPDATE t SET a=1 WHERE a=2":  false,
+		"WITH c AS (SELECT 1) DELETE FROM t":              false,
+		"WITH c AS (SELECT a FROM t) UPDATE t SET a=1":    false,
+		"SET PASSWORD = 'x'":                              false,
+		"SET PASSWORD FOR u = 'x'":                        false,
+		"SET DEFAULT ROLE ALL TO u":                       false,
+		"SET ROLE ALL":                                    false,
+		"SET PERSIST max_connections=1":                   false,
+		"SET @@persist.max_connections=1":                 false,
+		"SET a=1, GLOBAL x=1":                             false,
+		"SET a=1, @@global.x=1":                           false,
+		"SET SESSION transaction_read_only=0":             false,
+		"SET tx_read_only=0":                              false,
+		"SET SESSION TRANSACTION READ WRITE":              false,
+		"/*!40000 DELETE FROM t */ SELECT 1":              false,
+		"/*T![clustered_index] DELETE FROM t */ SELECT 1": false,
+		"SELECT 1; DELETE FROM t":                         false,
+		"SELECT 1;":                                       false,
+		"SELECT `a/*` FROM t; DELETE FROM t -- */":        false,
+		"SELECT 'unterminated":                            false,
+		"SELECT 1 /* unterminated":                        false,
+		"SELECT NEXTVAL(seq)":                             false,
+	} {
+		if tidb.IsReadOnlySQL(sql) != readOnly {
+			t.Fatalf("sql=%v, expected read-only=%v", sql, readOnly)
+		}
+	}
+}
+
+func TestCheckParams(t *testing.T) {
+	for _, c := range []struct {
+		params   map[string]string
+		readOnly bool
+		ok       bool
+	}{
+		{map[string]string{"tidb_isolation_read_engines": "tikv", "charset": "utf8mb4"}, true, true},
+		{map[string]string{"transaction_read_only": "0"}, false, true},
+		{map[string]string{"multiStatements": "true"}, false, false},
+		{map[string]string{"MultiStatements": "true"}, false, false},
+		{map[string]string{"tls": "false"}, false, false},
+		{map[string]string{"allowAllFiles": "true"}, false, false},
+		{map[string]string{"a=1&tls": "false"}, false, false},
+		{map[string]string{"transaction_read_only": "0"}, true, false},
+		{map[string]string{"tx_read_only": "0"}, true, false},
+		{map[string]string{"tidb_snapshot": "'x'; DELETE FROM t"}, true, false},
+	} {
+		opt := tidb.Option{Addr: "127.0.0.1", Port: 1, Label: "ins", ReadOnly: c.readOnly, Params: c.params}
+		if err := tidb.CheckParams(opt); (err == nil) != c.ok {
+			t.Fatalf("params=%v, read-only=%v, err=%v", c.params, c.readOnly, err)
+		}
+		if !c.ok {
+			if _, err := tidb.ConnectTo(opt); err == nil || !strings.Contains(err.Error(), "not allowed") {
+				t.Fatalf("params=%v should be rejected before connecting, err=%v", c.params, err)
+			}
+		}
+	}
+}
+
+func TestAddHints(t *testing.T) {
+	for sql, expected := range map[string]string{
+		"SELECT * FROM t":                         "SELECT /*+ HINT(1) */ * FROM t",
+		"EXPLAIN ANALYZE select a FROM t":         "EXPLAIN ANALYZE select /*+ HINT(1) */ a FROM t",
+		"SELECT /*+ USE_INDEX(t, a) */ * FROM t":  "SELECT /*+ HINT(1) USE_INDEX(t, a) */ * FROM t",
+		"SELECT\n/*+ USE_INDEX(t, a) */ * FROM t": "SELECT\n/*+ HINT(1) USE_INDEX(t, a) */ * FROM t",
+		"/* SELECT */ SELECT * FROM t":            "/* SELECT */ SELECT /*+ HINT(1) */ * FROM t",
+		"EXPLAIN FORMAT='select' SELECT * FROM t": "EXPLAIN FORMAT='select' SELECT /*+ HINT(1) */ * FROM t",
+		"SELECT * FROM `select`":                  "SELECT /*+ HINT(1) */ * FROM `select`",
+		"SHOW STATS_META WHERE db_name='select'":  "SHOW STATS_META WHERE db_name='select'",
+		"SELECT * FROM t WHERE a='unterminated":   "SELECT * FROM t WHERE a='unterminated",
+		"SELECT * FROM t -- SELECT":               "SELECT /*+ HINT(1) */ * FROM t -- SELECT",
+		"SELECTED":                                "SELECTED",
+	} {
+		if got := tidb.AddHints(sql, "HINT(1)"); got != expected {
+			t.Fatalf("sql=%q, expected %q, got %q", sql, expected, got)
+		}
+	}
+}
+
+func TestCheckQueryHint(t *testing.T) {
+	for hint, ok := range map[string]bool{
+		"MAX_EXECUTION_TIME(1000)":             true,
+		"RESOURCE_GROUP(rg1)":                  true,
+		"USE_INDEX(t, a)":                      true,
+		"x */ DELETE FROM t /*+ y":             false,
+		"MAX_EXECUTION_TIME(1); DELETE FROM t": false,
+		"HINT(1) /* x */":                      false,
+		"MAX_EXECUTION_TIME":                   false,
+		"":                                     false,
+		"RESOURCE_GROUP(rg) */ DELETE FROM t /*+ HINT(x)": false,
+	} {
+		if err := tidb.CheckQueryHint(hint); (err == nil) != ok {
+			t.Fatalf("hint=%q, err=%v", hint, err)
+		}
+	}
+}
+
+func TestCheckFinalSQL(t *testing.T) {
+	var executed []string
+	opt := tidb.Option{Label: "mock", ReadOnly: true, QueryHints: []string{"HINT(1) */ DELETE FROM t /*+ HINT(2)"}}
+	ins, err := tidb.NewMockInstance(opt, "v7.5.0", func(query string) ([]string, [][]string, error) {
+		executed = append(executed, query)
+		return nil, nil, nil
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer ins.Close()
+	if _, err := ins.Query("SELECT 1"); err == nil || len(executed) > 0 {
+		t.Fatalf("hints breaking out of the hint comment should be rejected, executed=%v, err=%v", executed, err)
+	}
+	if _, err := tidb.ConnectTo(opt); err == nil || !strings.Contains(err.Error(), "invalid query hint") {
+		t.Fatalf("hints breaking out of the hint comment should be rejected before connecting, err=%v", err)
+	}
+}
+
+func TestAddHintsToMainSelect(t *testing.T) {
+	for sql, expected := range map[string]string{
+		"WITH c AS (SELECT a FROM t) SELECT * FROM c":                                                     "WITH c AS (SELECT a FROM t) SELECT /*+ HINT(1) */ * FROM c",
+		"EXPLAIN WITH RECURSIVE c(n) AS (SELECT 1 UNION ALL SELECT n+1 FROM c WHERE n<3) SELECT * FROM c": "EXPLAIN WITH RECURSIVE c(n) AS (SELECT 1 UNION ALL SELECT n+1 FROM c WHERE n<3) SELECT /*+ HINT(1) */ * FROM c",
+		"WITH c AS (SELECT 1) SELECT /*+ USE_INDEX(t, a) */ * FROM c":                                     "WITH c AS (SELECT 1) SELECT /*+ HINT(1) USE_INDEX(t, a) */ * FROM c",
+		"WITH `select` AS (SELECT 1) SELECT * FROM `select`":                                              "WITH `select` AS (SELECT 1) SELECT /*+ HINT(1) */ * FROM `select`",
+		"SELECT * FROM t WHERE a IN (SELECT b FROM s)":                                                    "SELECT /*+ HINT(1) */ * FROM t WHERE a IN (SELECT b FROM s)",
+		"(SELECT a FROM t) UNION (SELECT b FROM s)":                                                       "(SELECT /*+ HINT(1) */ a FROM t) UNION (SELECT b FROM s)",
+		"WITH c AS (SELECT ')' FROM t) SELECT * FROM c":                                                   "WITH c AS (SELECT ')' FROM t) SELECT /*+ HINT(1) */ * FROM c",
+		"WITH c AS (SELECT 1 /* ( */) SELECT * FROM c":                                                    "WITH c AS (SELECT 1 /* ( */) SELECT /*+ HINT(1) */ * FROM c",
+	} {
+		if got := tidb.AddHints(sql, "HINT(1)"); got != expected {
+			t.Fatalf("sql=%q, expected %q, got %q", sql, expected, got)
+		}
+	}
+}